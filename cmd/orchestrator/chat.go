@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/notify"
+)
+
+// chatPromptWidth is how much of a run's prompt its start message shows
+const chatPromptWidth = 200
+
+// chatRequestMaxAge is how old a signed Slack request or Discord interaction may be before it is rejected as a
+// possible replay
+const chatRequestMaxAge = 5 * time.Minute
+
+// Discord interaction and response types used by slash commands
+const (
+	discordPing               = 1
+	discordApplicationCommand = 2
+	discordPong               = 1
+	discordChannelMessage     = 4
+
+	// discordEphemeral shows a response only to the user who ran the command
+	discordEphemeral = 64
+)
+
+// announceRunStarted posts a run's start to the chat channel, if one is configured
+func announceRunStarted(ctx context.Context, cfg *core.Config, task core.Task, runID string) {
+	if !cfg.Chat.Enabled() {
+		return
+	}
+	postChat(ctx, cfg, "Orchestrator run started", chatStartedText(cfg, task, runID))
+}
+
+// announceRunFinished posts a run's outcome to the chat channel, if one is configured
+func announceRunFinished(ctx context.Context, cfg *core.Config, runID string, result *core.TaskResult, err error) {
+	if !cfg.Chat.Enabled() || (result == nil && err == nil) {
+		return
+	}
+	title, text := chatFinishedMessage(cfg, runID, result, err)
+	postChat(ctx, cfg, title, text)
+}
+
+// chatStartedText describes a run that has just started: the start of its prompt, its repository, and its agents
+func chatStartedText(cfg *core.Config, task core.Task, runID string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Run %s started with %s\n", runID, strings.Join(runAgentIDs(cfg), ", "))
+	fmt.Fprintf(&sb, "Task: %s\n", truncate(firstLine(task.Prompt), chatPromptWidth))
+	if repo := runRepo(task); repo != "" {
+		fmt.Fprintf(&sb, "Repository: %s\n", repo)
+	}
+	return sb.String()
+}
+
+// chatFinishedMessage summarizes a finished run with its ranking and a link to its report
+func chatFinishedMessage(cfg *core.Config, runID string, result *core.TaskResult, err error) (string, string) {
+	n := runNotification(runID, result, err)
+	text := n.Summary + "\n"
+
+	runDir := filepath.Join(cfg.ArtifactsDir, runID)
+	if page, err := core.LoadRunPage(runDir); err == nil && len(page.Agents) > 0 {
+		text += "```\n" + page.ScoresText() + "```\n"
+	}
+	if fileExists(filepath.Join(runDir, core.ReportHTMLFile)) {
+		text += "Report: " + cfg.Chat.ReportLink(cfg.ArtifactsDir, runID) + "\n"
+	}
+	return n.Title, text
+}
+
+// postChat posts a message to the chat channel, logging rather than failing if it can't be sent
+// It still runs after Ctrl-C, since an interrupted run is worth announcing too
+func postChat(ctx context.Context, cfg *core.Config, title, text string) {
+	if err := notify.PostMessage(context.WithoutCancel(ctx), cfg.Chat.Webhook, title, cfg.Redact(text)); err != nil {
+		slog.Warn("failed to post to chat", "error", err)
+	}
+}
+
+// chatRunStarted is the reply to a slash command that queued a run
+func chatRunStarted(r *serverRun, prompt string) string {
+	return fmt.Sprintf("Queued run %s: %s", r.id, truncate(firstLine(prompt), chatPromptWidth))
+}
+
+// handleSlackCommand starts a run from a Slack slash command, such as `/orchestrate fix the flaky test`,
+// whose text is the prompt
+func (s *server) handleSlackCommand(w http.ResponseWriter, req *http.Request) {
+	secret := s.watcher.Current().Chat.SlackSigningSecret
+	if secret == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("slack commands are not configured"))
+		return
+	}
+	body, err := readBody(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !validSlackSignature(secret, req.Header.Get("X-Slack-Request-Timestamp"), body, req.Header.Get("X-Slack-Signature"), time.Now()) {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid slack signature"))
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid slack command: %w", err))
+		return
+	}
+
+	// Slack shows the reply in the channel; failures are only shown to whoever ran the command
+	prompt := strings.TrimSpace(form.Get("text"))
+	if prompt == "" {
+		writeJSON(w, http.StatusOK, map[string]string{"response_type": "ephemeral", "text": "Usage: " + form.Get("command") + " <prompt>"})
+		return
+	}
+	r, err := s.submit(submitRequest{Prompt: prompt, Labels: []string{"slack"}})
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]string{"response_type": "ephemeral", "text": "Error: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"response_type": "in_channel", "text": chatRunStarted(r, prompt)})
+}
+
+// validSlackSignature checks a Slack request's signature, an HMAC of its timestamp and body keyed with the
+// signing secret, and that it was sent recently
+func validSlackSignature(secret, timestamp string, body []byte, signature string, now time.Time) bool {
+	if !recentTimestamp(timestamp, now) {
+		return false
+	}
+	digest, ok := strings.CutPrefix(signature, "v0=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// recentTimestamp reports whether a request's Unix timestamp is within chatRequestMaxAge of now
+func recentTimestamp(timestamp string, now time.Time) bool {
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(sent, 0))
+	return age <= chatRequestMaxAge && age >= -chatRequestMaxAge
+}
+
+// discordInteraction is the part of a Discord interaction that is used
+type discordInteraction struct {
+	Type int `json:"type"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string          `json:"name"`
+			Value json.RawMessage `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+// handleDiscordInteraction starts a run from a Discord slash command, such as `/orchestrate prompt: fix the flaky test`
+// The command's "prompt" option is the prompt; Discord's pings, sent when the endpoint is set up, are answered
+func (s *server) handleDiscordInteraction(w http.ResponseWriter, req *http.Request) {
+	publicKey := s.watcher.Current().Chat.DiscordPublicKey
+	if publicKey == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("discord commands are not configured"))
+		return
+	}
+	body, err := readBody(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !validDiscordSignature(publicKey, req.Header.Get("X-Signature-Timestamp"), body, req.Header.Get("X-Signature-Ed25519"), time.Now()) {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid discord signature"))
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid discord interaction: %w", err))
+		return
+	}
+	switch interaction.Type {
+	case discordPing:
+		writeJSON(w, http.StatusOK, map[string]int{"type": discordPong})
+		return
+	case discordApplicationCommand:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported discord interaction type %d", interaction.Type))
+		return
+	}
+
+	reply := func(content string, flags int) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"type": discordChannelMessage,
+			"data": map[string]interface{}{"content": content, "flags": flags},
+		})
+	}
+	var prompt string
+	for _, option := range interaction.Data.Options {
+		if option.Name == "prompt" {
+			_ = json.Unmarshal(option.Value, &prompt)
+		}
+	}
+	if prompt = strings.TrimSpace(prompt); prompt == "" {
+		reply("Usage: /"+interaction.Data.Name+" prompt: <prompt>", discordEphemeral)
+		return
+	}
+	r, err := s.submit(submitRequest{Prompt: prompt, Labels: []string{"discord"}})
+	if err != nil {
+		reply("Error: "+err.Error(), discordEphemeral)
+		return
+	}
+	reply(chatRunStarted(r, prompt), 0)
+}
+
+// validDiscordSignature checks a Discord interaction's Ed25519 signature of its timestamp and body, and that it
+// was sent recently
+func validDiscordSignature(publicKey, timestamp string, body []byte, signature string, now time.Time) bool {
+	if !recentTimestamp(timestamp, now) {
+		return false
+	}
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(key, append([]byte(timestamp), body...), sig)
+}
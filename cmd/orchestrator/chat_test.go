@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatMessages(t *testing.T) {
+	var posted map[string]string
+	channel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&posted))
+	}))
+	defer channel.Close()
+
+	artifacts := t.TempDir()
+	cfg := &core.Config{
+		ArtifactsDir: artifacts,
+		Agents:       []core.AgentConfig{{ID: "claude", Type: "cli"}, {ID: "codex", Type: "cli"}},
+		Chat:         core.ChatConfig{Webhook: channel.URL, ServerURL: "https://orchestrator.example.com/"},
+	}
+	task := core.Task{Prompt: "Fix the flaky test\n\nIt fails one run in ten", Repo: "https://github.com/octo/app.git"}
+
+	announceRunStarted(context.Background(), cfg, task, "run-1")
+	assert.Equal(t, "*Orchestrator run started*\nRun run-1 started with claude, codex\nTask: Fix the flaky test\nRepository: https://github.com/octo/app.git\n", posted["text"])
+
+	w, err := core.NewRunWriter(filepath.Join(artifacts, "run-1"), cfg)
+	require.NoError(t, err)
+	best := &core.PatchResult{AgentID: "claude", Score: 150, Reason: "Tests now passing", Diff: testPatch, TestResults: &core.TestResult{Success: true, TotalTests: 2, PassedTests: 2}}
+	result := &core.TaskResult{Task: task, RunID: "run-1", Best: best, Candidates: []*core.PatchResult{best}}
+	require.NoError(t, w.WriteReport(result))
+	require.NoError(t, core.RenderRunPages(w.Dir()))
+
+	announceRunFinished(context.Background(), cfg, "run-1", result, nil)
+	assert.Contains(t, posted["text"], "*Orchestrator run solved*\nRun run-1 solved by claude, scoring 150 (Tests now passing)\n```\n#  Agent")
+	assert.Contains(t, posted["text"], "1  claude  150    2/2")
+	assert.Contains(t, posted["text"], "```\nReport: https://orchestrator.example.com/runs/run-1/report.html\n")
+
+	// Without a server, the report is linked to in the artifacts directory
+	cfg.Chat.ServerURL = ""
+	_, text := chatFinishedMessage(cfg, "run-1", result, nil)
+	assert.Contains(t, text, "Report: "+filepath.Join(artifacts, "run-1", core.ReportHTMLFile))
+}
+
+// slackRequest posts a Slack slash command signed with secret, sent at the given time
+func slackRequest(t *testing.T, url, secret string, sent time.Time, form url.Values) (int, map[string]interface{}) {
+	body := form.Encode()
+	timestamp := strconv.FormatInt(sent.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return deliver(t, url, map[string]string{
+		"Content-Type":              "application/x-www-form-urlencoded",
+		"X-Slack-Request-Timestamp": timestamp,
+		"X-Slack-Signature":         "v0=" + hex.EncodeToString(mac.Sum(nil)),
+	}, body)
+}
+
+func TestServer_SlackCommand(t *testing.T) {
+	tasks, runTask := recordTasks()
+	_, httpServer := newTestServerWithConfig(t, "chat:\n  slack_signing_secret: s3cret\n", runTask)
+	url := httpServer.URL + "/chat/slack"
+
+	status, body := slackRequest(t, url, "s3cret", time.Now(), map[string][]string{"command": {"/orchestrate"}, "text": {"fix the flaky test"}})
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "in_channel", body["response_type"])
+	assert.Contains(t, body["text"], ": fix the flaky test")
+	task := receiveTask(t, tasks)
+	assert.Equal(t, "fix the flaky test", task.Prompt)
+	assert.Equal(t, []string{"slack"}, task.Labels)
+
+	status, body = slackRequest(t, url, "s3cret", time.Now(), map[string][]string{"command": {"/orchestrate"}, "text": {" "}})
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{"response_type": "ephemeral", "text": "Usage: /orchestrate <prompt>"}, body)
+
+	status, _ = slackRequest(t, url, "wrong", time.Now(), map[string][]string{"text": {"fix it"}})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = slackRequest(t, url, "s3cret", time.Now().Add(-time.Hour), map[string][]string{"text": {"fix it"}})
+	assert.Equal(t, http.StatusUnauthorized, status, "Old requests may be replays")
+}
+
+func TestServer_DiscordInteraction(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	tasks, runTask := recordTasks()
+	_, httpServer := newTestServerWithConfig(t, "chat:\n  discord_public_key: "+hex.EncodeToString(publicKey)+"\n", runTask)
+	url := httpServer.URL + "/chat/discord"
+
+	interactAt := func(sent time.Time, key ed25519.PrivateKey, body string) (int, map[string]interface{}) {
+		timestamp := strconv.FormatInt(sent.Unix(), 10)
+		signature := ed25519.Sign(key, []byte(timestamp+body))
+		return deliver(t, url, map[string]string{"X-Signature-Timestamp": timestamp, "X-Signature-Ed25519": hex.EncodeToString(signature)}, body)
+	}
+	interact := func(key ed25519.PrivateKey, body string) (int, map[string]interface{}) {
+		return interactAt(time.Now(), key, body)
+	}
+
+	status, body := interact(privateKey, `{"type": 1}`)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(discordPong), body["type"])
+
+	status, body = interact(privateKey, `{"type": 2, "data": {"name": "orchestrate", "options": [{"name": "prompt", "type": 3, "value": "fix the flaky test"}]}}`)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(discordChannelMessage), body["type"])
+	assert.Contains(t, body["data"].(map[string]interface{})["content"], ": fix the flaky test")
+	task := receiveTask(t, tasks)
+	assert.Equal(t, "fix the flaky test", task.Prompt)
+	assert.Equal(t, []string{"discord"}, task.Labels)
+
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	status, _ = interact(otherKey, `{"type": 1}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = interactAt(time.Now().Add(-time.Hour), privateKey, `{"type": 2, "data": {"name": "orchestrate", "options": [{"name": "prompt", "type": 3, "value": "fix it"}]}}`)
+	assert.Equal(t, http.StatusUnauthorized, status, "Old interactions may be replays")
+}
+
+func TestServer_ChatDisabled(t *testing.T) {
+	_, httpServer := newTestServer(t, nil)
+	status, _ := deliver(t, httpServer.URL+"/chat/slack", nil, "text=fix")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = deliver(t, httpServer.URL+"/chat/discord", nil, `{"type": 1}`)
+	assert.Equal(t, http.StatusNotFound, status)
+}
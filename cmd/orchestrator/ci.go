@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/github"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// ciGitHub is the --ci value that formats output for GitHub Actions
+const ciGitHub = "github"
+
+// reportGitHubActions writes a finished run to a GitHub Actions log as workflow commands
+// Each agent's timeline and test output is folded into a log group, the lines the winning patch changes
+// are annotated, and the ranking is added to the job summary when the runner provides one
+func reportGitHubActions(out io.Writer, runDir, repo string, result *core.TaskResult) error {
+	page, err := core.LoadRunPage(runDir)
+	if err != nil {
+		return err
+	}
+
+	// Annotations name files relative to the workspace, which the repository may be inside of
+	prefix := ""
+	if workspace := os.Getenv("GITHUB_WORKSPACE"); workspace != "" {
+		if rel, err := filepath.Rel(workspace, repo); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			prefix = filepath.ToSlash(rel) + "/"
+		}
+	}
+	token, err := stopCommandsToken()
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, githubActionsLog(page, result.Solved(), prefix, token))
+
+	summaryPath := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryPath == "" {
+		return nil
+	}
+	summary, err := os.OpenFile(summaryPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open job summary: %w", err)
+	}
+	if _, err := summary.WriteString(githubActionsSummary(page)); err != nil {
+		summary.Close()
+		return fmt.Errorf("failed to write job summary: %w", err)
+	}
+	return summary.Close()
+}
+
+// githubActionsLog renders a run's log groups and annotations as workflow commands
+// The winning patch's changes are annotated as errors when it leaves tests failing, and as notices when it solves the task
+// prefix is prepended to the patch's file paths to make them relative to the workspace. Agent and test output
+// is written between stop-commands markers ending at token, so nothing in it is run as a workflow command
+func githubActionsLog(page *core.RunPage, solved bool, prefix, token string) string {
+	var sb strings.Builder
+	var best *core.AgentPage
+	for i, agent := range page.Agents {
+		if agent.Best {
+			best = &page.Agents[i]
+		}
+
+		title := fmt.Sprintf("%s: score %d, %s", agent.AgentID, agent.Score, agent.Reason)
+		if status := agent.Status(); status != "" {
+			title += " (" + status + ")"
+		}
+		fmt.Fprintf(&sb, "::group::%s\n", githubEscapeData(title))
+		fmt.Fprintf(&sb, "::stop-commands::%s\n", token)
+		for _, component := range agent.Breakdown {
+			fmt.Fprintf(&sb, "%+d %s\n", component.Points, component.Factor)
+		}
+		for _, entry := range agent.Timeline {
+			fmt.Fprintf(&sb, "+%v %s %s\n", entry.Offset, entry.Type, firstLine(entry.Text))
+		}
+		if agent.TestOutput != "" {
+			fmt.Fprintf(&sb, "Test output:\n%s\n", agent.TestOutput)
+		}
+		fmt.Fprintf(&sb, "::%s::\n", token)
+		sb.WriteString("::endgroup::\n")
+	}
+
+	if best == nil || best.Diff == "" {
+		sb.WriteString("::warning title=No patch selected::No agent produced a patch\n")
+		return sb.String()
+	}
+
+	level, title := "error", "Tests still failing with the patch from "+best.AgentID
+	if solved {
+		level, title = "notice", "Changed by "+best.AgentID
+	}
+	message := fmt.Sprintf("The winning patch from %s changes these lines (score %d, %s)", best.AgentID, best.Score, best.Reason)
+	for _, file := range gitutil.SplitDiff(best.Diff) {
+		for _, lines := range file.ChangedLines() {
+			fmt.Fprintf(&sb, "::%s file=%s,line=%d,endLine=%d,title=%s::%s\n", level,
+				githubEscapeProperty(prefix+file.Path), lines.Start, lines.End, githubEscapeProperty(title), githubEscapeData(message))
+		}
+	}
+
+	// Review notes are warnings, since they are what a reviewer should check before merging
+	for _, note := range page.Report.ReviewNotes {
+		location := "file=" + githubEscapeProperty(prefix+note.File)
+		if note.Line > 0 {
+			location += fmt.Sprintf(",line=%d", note.Line)
+		}
+		fmt.Fprintf(&sb, "::warning %s,title=%s::%s\n", location, githubEscapeProperty("Review note ("+note.Kind+")"), githubEscapeData(note.Message))
+	}
+	return sb.String()
+}
+
+// githubActionsSummary renders a run's ranking, and its winning patch, for the job summary
+func githubActionsSummary(page *core.RunPage) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Orchestrator run %s\n\n", page.Report.RunID)
+	if page.Report.Best != "" {
+		fmt.Fprintf(&sb, "Best patch: **%s**\n\n", page.Report.Best)
+	} else {
+		sb.WriteString("No patch was selected.\n\n")
+	}
+	sb.WriteString(page.ScoresMarkdown())
+	if len(page.Report.ReviewNotes) > 0 {
+		sb.WriteString("\n### Review notes\n\n")
+		sb.WriteString(core.ReviewNotesMarkdown(page.Report.ReviewNotes))
+	}
+
+	for _, agent := range page.Agents {
+		if !agent.Best || agent.Diff == "" {
+			continue
+		}
+		if len(agent.Diff) > maxCommentPatchBytes {
+			fmt.Fprintf(&sb, "\nThe patch is too large to include here (%d bytes); it is saved as best.patch in the run directory.\n", len(agent.Diff))
+			break
+		}
+		fence := "```"
+		for strings.Contains(agent.Diff, fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(&sb, "\n<details>\n<summary>Patch</summary>\n\n%sdiff\n%s\n%s\n\n</details>\n", fence, strings.TrimRight(agent.Diff, "\n"), fence)
+	}
+	return sb.String() + "\n"
+}
+
+// githubRunFailed reports a failed run as an error annotation
+func githubRunFailed(out io.Writer, err error) {
+	fmt.Fprintf(out, "::error title=Orchestrator run failed::%s\n", githubEscapeData(err.Error()))
+}
+
+// stopCommandsToken returns an unguessable token for ending a stop-commands block
+func stopCommandsToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate stop-commands token: %w", err)
+	}
+	return "orchestrator-" + hex.EncodeToString(b), nil
+}
+
+// githubEscapeData escapes the message of a workflow command
+func githubEscapeData(text string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(text)
+}
+
+// githubEscapeProperty escapes a property of a workflow command, such as a file name
+func githubEscapeProperty(text string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(text)
+}
+
+// githubActionsCommit returns the commit a GitHub Actions workflow is running for, and the URL of the workflow run,
+// whose job summary holds the report. For pull request events it is the head of the pull request, where GitHub shows
+// statuses, rather than the merge commit the workflow checks out
+func githubActionsCommit() (*commitTarget, string, error) {
+	repository, sha := os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_SHA")
+	owner, repo, ok := strings.Cut(repository, "/")
+	if !ok || sha == "" {
+		return nil, "", errors.New("--commit-status needs GITHUB_REPOSITORY and GITHUB_SHA, which GitHub Actions sets")
+	}
+
+	if path := os.Getenv("GITHUB_EVENT_PATH"); path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			var event struct {
+				PullRequest *struct {
+					Head struct {
+						SHA string `json:"sha"`
+					} `json:"head"`
+				} `json:"pull_request"`
+			}
+			if json.Unmarshal(data, &event) == nil && event.PullRequest != nil && event.PullRequest.Head.SHA != "" {
+				sha = event.PullRequest.Head.SHA
+			}
+		}
+	}
+
+	serverURL := os.Getenv("GITHUB_SERVER_URL")
+	if serverURL == "" {
+		serverURL = "https://" + github.DefaultHost
+	}
+	host := github.DefaultHost
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	runURL := ""
+	if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+		runURL = strings.TrimRight(serverURL, "/") + "/" + repository + "/actions/runs/" + runID
+	}
+	return &commitTarget{host: host, owner: owner, repo: repo, sha: sha}, runURL, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportGitHubActions(t *testing.T) {
+	runDir := filepath.Join(t.TempDir(), "20240102-030405-abcdef")
+	w, err := core.NewRunWriter(runDir, &core.Config{})
+	require.NoError(t, err)
+
+	diff := "diff --git a/pkg/f.go b/pkg/f.go\n--- a/pkg/f.go\n+++ b/pkg/f.go\n@@ -3,3 +3,3 @@ func F() int {\n \t// F returns two\n-\treturn 1\n+\treturn 2\n }\n"
+	best := &core.PatchResult{
+		AgentID:     "claude",
+		Score:       170,
+		Reason:      "Tests now passing",
+		Diff:        diff,
+		DiffStats:   gitutil.GetDiffStats(diff),
+		TestResults: &core.TestResult{Success: true, TotalTests: 3, PassedTests: 3, Output: "ok  \texample\n"},
+	}
+	other := &core.PatchResult{AgentID: "codex", Reason: "No changes made"}
+	result := &core.TaskResult{Task: core.Task{Prompt: "Fix F"}, RunID: "20240102-030405-abcdef", Best: best, Candidates: []*core.PatchResult{best, other}}
+
+	// Output that looks like a workflow command stays inert inside the group
+	thinking, err := protocol.NewEvent(protocol.EventTypeThinking, "claude", 0).WithPayload(protocol.ThinkingPayload{Content: "::error::not a real error"})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTranscript("claude", []*protocol.Event{thinking}))
+	require.NoError(t, w.WriteTestLog("claude", best.TestResults))
+	require.NoError(t, w.WriteReport(result))
+	_, err = core.ExportPatches(runDir, map[string]*core.PatchDetails{"claude": {Diff: diff}}, best)
+	require.NoError(t, err)
+
+	workspace := t.TempDir()
+	summaryPath := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv("GITHUB_WORKSPACE", workspace)
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryPath)
+
+	var out bytes.Buffer
+	require.NoError(t, reportGitHubActions(&out, runDir, filepath.Join(workspace, "service"), result))
+	log := out.String()
+
+	assert.Contains(t, log, "::group::claude: score 170, Tests now passing (best)\n::stop-commands::orchestrator-")
+	assert.Contains(t, log, "+0s thinking ::error::not a real error\n")
+	assert.Contains(t, log, "Test output:\nTests PASSED (3 total, 3 passed, 0 failed, 0 skipped) in 0s\n\nok  \texample\n")
+	assert.Contains(t, log, "::group::codex: score 0, No changes made\n")
+	assert.Equal(t, 2, strings.Count(log, "::endgroup::\n"))
+
+	// Each group turns commands back on with the token it turned them off with
+	for _, group := range strings.Split(log, "::group::")[1:] {
+		token := strings.SplitN(strings.SplitN(group, "::stop-commands::", 2)[1], "\n", 2)[0]
+		assert.Contains(t, group, "::"+token+"::\n::endgroup::")
+	}
+
+	assert.Contains(t, log, "::notice file=service/pkg/f.go,line=3,endLine=5,title=Changed by claude::The winning patch from claude changes these lines (score 170, Tests now passing)\n")
+
+	summary, err := os.ReadFile(summaryPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(summary), "## Orchestrator run 20240102-030405-abcdef\n\nBest patch: **claude**\n")
+	assert.Contains(t, string(summary), "| 1 | claude | 170 | 3/3 |")
+	assert.Contains(t, string(summary), "<summary>Patch</summary>\n\n```diff\ndiff --git a/pkg/f.go b/pkg/f.go\n")
+}
+
+func TestGitHubActionsLogUnsolved(t *testing.T) {
+	page := &core.RunPage{
+		Report: &core.RunReport{RunID: "run-1", Best: "codex", ReviewNotes: []core.ReviewNote{
+			{Kind: core.ReviewNoteTODO, File: "a,b.go", Line: 1, Message: "leaves `// TODO`"},
+			{Kind: core.ReviewNoteRisky, File: "go.mod", Message: "changes dependencies"},
+		}},
+		Agents: []core.AgentPage{{
+			ReportCandidate: core.ReportCandidate{AgentID: "codex", Score: -20, Reason: "Tests still failing"},
+			Best:            true,
+			Diff:            "diff --git a/a,b.go b/a,b.go\n--- a/a,b.go\n+++ b/a,b.go\n@@ -1 +1 @@\n-x\n+y\n",
+		}},
+	}
+
+	log := githubActionsLog(page, false, "", "token")
+	assert.Contains(t, log, "::error file=a%2Cb.go,line=1,endLine=1,title=Tests still failing with the patch from codex::")
+	assert.Contains(t, log, "::warning file=a%2Cb.go,line=1,title=Review note (todo)::leaves `// TODO`\n")
+	assert.Contains(t, log, "::warning file=go.mod,title=Review note (risky)::changes dependencies\n")
+
+	page.Agents[0].Diff = ""
+	assert.Contains(t, githubActionsLog(page, false, "", "token"), "::warning title=No patch selected::No agent produced a patch\n")
+
+	var out bytes.Buffer
+	githubRunFailed(&out, errors.New("baseline tests failed\nexit status 1"))
+	assert.Equal(t, "::error title=Orchestrator run failed::baseline tests failed%0Aexit status 1\n", out.String())
+}
+
+func TestGitHubActionsCommit(t *testing.T) {
+	t.Setenv("GITHUB_REPOSITORY", "")
+	_, _, err := githubActionsCommit()
+	assert.ErrorContains(t, err, "GITHUB_REPOSITORY")
+
+	t.Setenv("GITHUB_REPOSITORY", "octo/app")
+	t.Setenv("GITHUB_SHA", "merge123")
+	t.Setenv("GITHUB_SERVER_URL", "https://github.example.com")
+	t.Setenv("GITHUB_RUN_ID", "42")
+	t.Setenv("GITHUB_EVENT_PATH", "")
+	target, runURL, err := githubActionsCommit()
+	require.NoError(t, err)
+	assert.Equal(t, &commitTarget{host: "github.example.com", owner: "octo", repo: "app", sha: "merge123"}, target)
+	assert.Equal(t, "https://github.example.com/octo/app/actions/runs/42", runURL)
+
+	// Pull request workflows report on the pull request's head rather than the merge commit
+	event := filepath.Join(t.TempDir(), "event.json")
+	require.NoError(t, os.WriteFile(event, []byte(`{"pull_request": {"head": {"sha": "head456"}}}`), 0644))
+	t.Setenv("GITHUB_EVENT_PATH", event)
+	target, _, err = githubActionsCommit()
+	require.NoError(t, err)
+	assert.Equal(t, "head456", target.sha)
+}
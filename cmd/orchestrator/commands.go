@@ -0,0 +1,1254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
+	"github.com/brettsmith212/orchestrator/internal/sandbox"
+)
+
+// version is the orchestrator release, set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// command is a subcommand of the orchestrator CLI
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order they are shown in the usage message
+var commands = []command{
+	{name: "run", summary: "Run agents on a task and select the best patch", run: runCommand},
+	{name: "batch", summary: "Run every task in a task file and summarize the results", run: batchCommand},
+	{name: "serve", summary: "Accept tasks over an HTTP API, keeping the configuration loaded", run: serveCommand},
+	{name: "mcp", summary: "Serve runs to MCP clients, such as IDE assistants, over stdin and stdout", run: mcpCommand},
+	{name: "watch", summary: "Start a run to fix the tests whenever they start failing", run: watchCommand},
+	{name: "validate", summary: "Check a configuration file for errors", run: validateCommand},
+	{name: "init", summary: "Write a starter configuration for a repository", run: initCommand},
+	{name: "list-agents", summary: "Show the configured agents", run: listAgentsCommand},
+	{name: "replay", summary: "Re-evaluate the patches from a previous run", run: replayCommand},
+	{name: "resume", summary: "Finish evaluating a run that was interrupted", run: resumeCommand},
+	{name: "apply", summary: "Apply a patch from a previous run to the repository", run: applyCommand},
+	{name: "rollback", summary: "Undo applying or committing a previous run's patch", run: rollbackCommand},
+	{name: "report", summary: "Summarize the patches from a previous run", run: reportCommand},
+	{name: "transcript", summary: "Render what agents did in a previous run as Markdown", run: transcriptCommand},
+	{name: "stats", summary: "Rank agents by win rate, score, cost, and time over previous runs", run: statsCommand},
+	{name: "clean", summary: "Remove the worktrees kept by --keep-worktrees, or old runs with --runs", run: cleanCommand},
+	{name: "version", summary: "Print the orchestrator version", run: versionCommand},
+}
+
+// dispatch runs the subcommand named by the first argument and returns the process exit code
+// Arguments that start with a flag are passed to run, as they were before subcommands existed
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return 1
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	if strings.HasPrefix(args[0], "-") {
+		return runCommand(args)
+	}
+
+	// The egress proxy runs inside sandbox containers rather than by hand, so it isn't listed in the usage message
+	if args[0] == sandbox.ProxyCommand {
+		return egressProxyCommand(args[1:])
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+	printUsage(os.Stderr)
+	return 1
+}
+
+// printUsage lists the available subcommands
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: orchestrator <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun \"orchestrator <command> -h\" for the flags of a command.\n")
+	fmt.Fprintf(w, "Flags given without a command are passed to run.\n")
+}
+
+// configFlags defines the flags that select a configuration file
+func configFlags(fs *flag.FlagSet) (path, format *string) {
+	path = fs.String("config", defaultConfigPath, "Path to configuration file")
+	format = fs.String("config-format", "", "Configuration format: yaml, json, or toml (detected from the extension by default)")
+	return path, format
+}
+
+// validateCommand checks a configuration file and reports every problem found
+// It returns the process exit code
+func validateCommand(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	path, format := configFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator validate [flags] [config-file]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	// Allow the config file to be given as a positional argument
+	if fs.NArg() > 0 {
+		*path = fs.Arg(0)
+	}
+
+	cfg, err := core.LoadWithFormat(*path, core.ConfigFormat(*format))
+	if err == nil {
+		// Agent types are checked against the adapters this binary provides
+		registry := adapter.NewRegistry()
+		engine.RegisterAdapters(registry)
+		err = registry.Validate(cfg)
+	}
+	if err != nil {
+		var configErrs core.ConfigErrors
+		if errors.As(err, &configErrs) {
+			fmt.Printf("%s: invalid configuration\n", *path)
+			for _, configErr := range configErrs {
+				fmt.Printf("  %s\n", configErr)
+			}
+			return 1
+		}
+		fmt.Printf("%s: %v\n", *path, err)
+		return 1
+	}
+
+	// Every profile must produce a valid configuration too
+	valid := true
+	for _, name := range cfg.ProfileNames() {
+		profileCfg := *cfg
+		if err := profileCfg.ApplyProfile(name); err != nil {
+			fmt.Printf("%s: %v\n", *path, err)
+			valid = false
+		}
+	}
+	if !valid {
+		return 1
+	}
+
+	fmt.Printf("%s: configuration is valid (%d agents, %d profiles)\n", *path, len(cfg.Agents), len(cfg.Profiles))
+	return 0
+}
+
+// initCommand inspects a repository and writes a starter configuration file
+// It returns the process exit code
+func initCommand(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	repo := fs.String("repo", ".", "Path to the git repository to inspect")
+	output := fs.String("config", defaultConfigPath, "Path of the configuration file to write, relative to the repository")
+	force := fs.Bool("force", false, "Overwrite an existing configuration file")
+	_ = fs.Parse(args)
+
+	path := *output
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(*repo, path)
+	}
+
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Printf("%s already exists; use --force to overwrite it\n", path)
+		return 1
+	}
+
+	project := core.DetectProject(*repo)
+	agents := core.DiscoverAgents(procutil.LookPath)
+	workingDir := filepath.Join(os.TempDir(), "orchestrator-worktrees")
+
+	if err := os.WriteFile(path, []byte(core.ScaffoldConfig(project, agents, workingDir)), 0644); err != nil {
+		fmt.Printf("Error writing configuration: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s\n", path)
+	if project.Language != "" {
+		fmt.Printf("  Language: %s\n", project.Language)
+	}
+	if project.TestCommand != "" {
+		fmt.Printf("  Test command: %s\n", project.TestCommand)
+	} else {
+		fmt.Printf("  Test command: none detected; edit test_command before running\n")
+	}
+	if len(agents) > 0 {
+		fmt.Printf("  Agents: %s\n", strings.Join(agents, ", "))
+	} else {
+		fmt.Printf("  Agents: none found on PATH; edit the placeholder agent before running\n")
+	}
+
+	return 0
+}
+
+// sharedRuns is set when several runs share a working directory, as in batch and serve
+// Such runs skip orphan recovery since they would reclaim each other's worktrees
+var sharedRuns bool
+
+// startSharedRuns reclaims orphaned worktrees once, before runs that share the working directory begin
+func startSharedRuns(cfg *core.Config) {
+	sharedRuns = true
+	if repoURL != "" {
+		return
+	}
+	if abs, err := filepath.Abs(repoPath); err == nil {
+		if worktreeManager, err := gitutil.NewWorktreeManagerWithBackend(abs, cfg.WorkingDir, gitutil.Backend(cfg.WorktreeBackend)); err == nil {
+			engine.RecoverOrphans(slog.Default(), worktreeManager)
+		}
+	}
+}
+
+// batchCommand runs each task in a task file with the run flags and prints a per-task and aggregate report
+// It returns the process exit code
+func batchCommand(args []string) int {
+	fs := newRunFlags()
+	fs.Init("batch", flag.ExitOnError)
+	taskFile := fs.String("tasks", "", "Task file: YAML list of tasks or JSONL with one task per line")
+	concurrency := fs.Int("concurrency", 1, "Number of tasks to run at the same time")
+	reportPath := fs.String("report", "", "Also write the batch report to this file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator batch --tasks FILE [flags]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if *taskFile == "" {
+		fmt.Println("Error: a task file is required")
+		fs.Usage()
+		return 1
+	}
+	if prompt != "" || issue != "" {
+		fmt.Println("Error: --prompt and --issue cannot be used with batch; prompts come from the task file")
+		return 1
+	}
+	if apply {
+		fmt.Println("Error: --apply cannot be used with batch, use --commit instead")
+		return 1
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+	if tuiMode && *concurrency > 1 {
+		fmt.Println("Error: --tui can only show one task at a time, use --concurrency 1")
+		return 1
+	}
+
+	tasks, err := core.LoadTasks(*taskFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	cfg := loadRunConfig()
+	if cfg == nil {
+		return 1
+	}
+	if !dryRunOnly && !confirmEstimate(cfg, len(tasks), *concurrency) {
+		return 1
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	startSharedRuns(cfg)
+
+	results := make([]*core.TaskResult, len(tasks))
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task core.Task) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// Tasks not yet started when the batch is interrupted are not run
+			if ctx.Err() != nil {
+				results[i] = &core.TaskResult{Task: task, Err: ctx.Err()}
+				return
+			}
+
+			fmt.Printf("\n=== Task %s (%d/%d) ===\n", task.ID, i+1, len(tasks))
+			start := time.Now()
+			result, err := run(ctx, cfg, task, core.NewRunID(), newProgress(cfg))
+			if result == nil {
+				result = &core.TaskResult{Task: task}
+			}
+			result.Err = err
+			result.Duration = time.Since(start)
+			results[i] = result
+		}(i, task)
+	}
+	wg.Wait()
+
+	report := core.FormatBatchReport(results)
+	fmt.Println()
+	fmt.Print(report)
+	if *reportPath != "" {
+		if err := os.WriteFile(*reportPath, []byte(report), 0644); err != nil {
+			fmt.Printf("Error writing report: %v\n", err)
+			return 1
+		}
+	}
+	notifyBatch(ctx, cfg, results, *reportPath)
+
+	for _, result := range results {
+		if result.Err != nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+// listAgentsCommand prints the agents a configuration defines, including disabled ones
+// It returns the process exit code
+func listAgentsCommand(args []string) int {
+	fs := flag.NewFlagSet("list-agents", flag.ExitOnError)
+	path, format := configFlags(fs)
+	profileName := fs.String("profile", "", "Named configuration profile to apply")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator list-agents [flags]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	cfg, err := core.LoadWithFormat(*path, core.ConfigFormat(*format))
+	if err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		return 1
+	}
+	if *profileName != "" {
+		if err := cfg.ApplyProfile(*profileName); err != nil {
+			fmt.Printf("Error applying profile: %v\n", err)
+			return 1
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tENABLED\tCOMMAND\tTAGS")
+	for _, agent := range cfg.Agents {
+		command, _ := agent.Config["command"].(string)
+		if command == "" {
+			command = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n", agent.ID, agent.Type, agent.IsEnabled(), command, strings.Join(agent.Tags, ","))
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// replayCommand evaluates the patches exported by a previous run against the repository's current state
+// It returns the process exit code
+func replayCommand(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	path, format := configFlags(fs)
+	fs.StringVar(&repoPath, "repo", ".", "Path to the git repository")
+	fs.BoolVar(&mutation, "mutation", false, "Run mutation testing on passing patches to estimate test strength")
+	logFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator replay [flags] [run-id|run-dir]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	cfg, err := core.LoadWithFormat(*path, core.ConfigFormat(*format))
+	if err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		return 1
+	}
+
+	runDir, err := resolveRunDir(fs.Arg(0), func() (string, error) { return cfg.ArtifactsDir, nil })
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	patches, _, err := core.ReadPatches(runDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	abs, err := filepath.Abs(repoPath)
+	if err != nil {
+		fmt.Printf("Error: failed to resolve repository path: %v\n", err)
+		return 1
+	}
+	worktreeManager, err := gitutil.NewWorktreeManagerWithBackend(abs, cfg.WorkingDir, gitutil.Backend(cfg.WorktreeBackend))
+	if err != nil {
+		fmt.Printf("Error: failed to create worktree manager: %v\n", err)
+		return 1
+	}
+	defer worktreeManager.Cleanup()
+	worktreeManager.SetLFSPull(cfg.LFSPull)
+	worktreeManager.SetMaxDiffBytes(cfg.DiffLimits.MaxBytes)
+
+	// The replay's worktrees and test runs are audited under the run being replayed
+	ctx = audit.WithRun(ctx, engine.NewAuditLog(cfg), filepath.Base(runDir))
+	arbitrator := engine.NewArbitrator(cfg, abs, mutation)
+	slog.Info("running baseline tests")
+	if err := arbitrator.SetBaselineTestResults(ctx); err != nil {
+		fmt.Printf("Error: failed to run baseline tests: %v\n", err)
+		return 1
+	}
+
+	// Recreate each agent's worktree from the exported patch
+	details := make(map[string]*core.PatchDetails, len(patches))
+	for agentID, diff := range patches {
+		details[agentID] = &core.PatchDetails{Diff: diff}
+	}
+	if err := recreateWorktrees(ctx, worktreeManager, "", details); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	slog.Info("evaluating patches", "count", len(details), "run_dir", runDir)
+	bestPatch, err := arbitrator.SelectBestPatch(ctx, details)
+	if err != nil {
+		fmt.Printf("Error: failed to select best patch: %v\n", err)
+		return 1
+	}
+
+	fmt.Println("\n=== Best Patch Selected ===")
+	fmt.Println(core.FormatPatchResult(bestPatch))
+	if verbosity > 0 {
+		fmt.Println(gitutil.DescribePatch(bestPatch.Diff))
+	}
+
+	return 0
+}
+
+// recreateWorktrees applies each patch to a fresh worktree checked out at ref, setting its WorktreePath
+// Patches that no longer apply are dropped with a warning, and empty ones are left without a worktree
+func recreateWorktrees(ctx context.Context, worktreeManager *gitutil.WorktreeManager, ref string, patches map[string]*core.PatchDetails) error {
+	for agentID, patch := range patches {
+		if strings.TrimSpace(patch.Diff) == "" {
+			continue
+		}
+		worktreePath, err := worktreeManager.CreateWorktree(agentID, ref)
+		if err != nil {
+			return fmt.Errorf("failed to create worktree for %s: %w", agentID, err)
+		}
+		audit.Record(ctx, audit.WorktreeCreated, "agent", agentID, "path", worktreePath)
+		if err := gitutil.ApplyPatch(worktreePath, patch.Diff); err != nil {
+			slog.Warn("skipping patch that no longer applies", "agent", agentID, "error", err)
+			delete(patches, agentID)
+			continue
+		}
+		patch.WorktreePath = worktreePath
+	}
+	return nil
+}
+
+// resumeCommand finishes a run that was interrupted, evaluating the work its agents had done
+// Agents that finished are evaluated from the patches saved as they did; agents that were still running
+// are evaluated from what they left in their worktrees, if those survived, and reported as crashed otherwise
+// It returns the process exit code
+func resumeCommand(args []string) int {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	path, format := configFlags(fs)
+	repo := fs.String("repo", "", "Path to the git repository (defaults to the repository the run worked on)")
+	logFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator resume [flags] [run-id|run-dir]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	cfg, err := core.LoadWithFormat(*path, core.ConfigFormat(*format))
+	if err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		return 1
+	}
+
+	runDir, err := resolveRunDir(fs.Arg(0), func() (string, error) { return cfg.ArtifactsDir, nil })
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	runID := filepath.Base(runDir)
+	checkpoint, err := core.ReadCheckpoint(runDir)
+	if err != nil {
+		fmt.Printf("Error: run %s can't be resumed: %v\n", runID, err)
+		return 1
+	}
+	if !checkpoint.Interrupted() {
+		fmt.Printf("Error: run %s already finished; see orchestrator report %s\n", runID, runID)
+		return 1
+	}
+	patches, err := checkpoint.AgentPatches(runDir, cfg.Cipher(), cfg.DiffLimits.MaxBytes)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(patches) == 0 {
+		fmt.Printf("Error: run %s was interrupted before any agent started; start a new run instead\n", runID)
+		return 1
+	}
+
+	// Runs on remote repositories worked on a clone, which has to be named
+	repoDir := *repo
+	if repoDir == "" {
+		repoDir = checkpoint.Repo
+	}
+	abs, err := filepath.Abs(repoDir)
+	if err != nil {
+		fmt.Printf("Error: failed to resolve repository path: %v\n", err)
+		return 1
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		fmt.Printf("Error: run %s worked on %s; pass --repo with a local clone\n", runID, checkpoint.Repo)
+		return 1
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	artifacts, err := core.NewRunWriter(runDir, cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	resumed := core.ResumeCheckpointer(artifacts, checkpoint)
+
+	worktreeManager, err := gitutil.NewWorktreeManagerWithBackend(abs, cfg.WorkingDir, gitutil.Backend(cfg.WorktreeBackend))
+	if err != nil {
+		fmt.Printf("Error: failed to create worktree manager: %v\n", err)
+		return 1
+	}
+	defer worktreeManager.Cleanup()
+	worktreeManager.SetRunID(runID)
+	worktreeManager.SetLFSPull(cfg.LFSPull)
+	worktreeManager.SetMaxDiffBytes(cfg.DiffLimits.MaxBytes)
+
+	// The agents' patches are evaluated against the ref the run started from, as they would have been
+	ctx = audit.WithRun(ctx, engine.NewAuditLog(cfg), runID)
+	baselinePath := abs
+	if checkpoint.BaseRef != "" {
+		baselinePath, err = worktreeManager.CreateWorktree("baseline", checkpoint.BaseRef)
+		if err != nil {
+			fmt.Printf("Error: failed to check out base ref %s: %v\n", checkpoint.BaseRef, err)
+			return 1
+		}
+	}
+	hooks := engine.HookEnv(worktreeManager, artifacts, checkpoint.BaseRef)
+	if err := engine.RunHooks(ctx, slog.Default(), cfg, core.HookPreRun, baselinePath, hooks); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	arbitrator := engine.NewArbitrator(cfg, baselinePath, mutation)
+	engine.PrepareEvaluations(arbitrator, slog.Default(), cfg, hooks)
+	slog.Info("running baseline tests")
+	if err := arbitrator.SetBaselineTestResults(ctx); err != nil {
+		fmt.Printf("Error: failed to run baseline tests: %v\n", err)
+		return 1
+	}
+	engine.LogArtifactError(slog.Default(), artifacts.WriteTestLog(core.BaselineTestLog, arbitrator.BaselineTestResults()))
+
+	if err := recreateWorktrees(ctx, worktreeManager, checkpoint.BaseRef, patches); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	slog.Info("evaluating patches", "count", len(patches), "run_dir", runDir)
+	resumed.SetStage(core.StageEvaluating)
+	arbitrator.SetEvaluatedHook(resumed.Evaluated)
+	ranked, err := arbitrator.RankPatches(ctx, patches)
+	if err != nil {
+		fmt.Printf("Error: failed to select best patch: %v\n", err)
+		return 1
+	}
+	bestPatch := ranked[0]
+	for _, candidate := range ranked {
+		engine.LogArtifactError(slog.Default(), artifacts.WriteTestLog(candidate.AgentID, candidate.TestResults))
+	}
+	engine.LogArtifactError(slog.Default(), artifacts.WriteTimeline(patches))
+
+	exportedPatches, exportedBest := engine.RedactPatches(slog.Default(), cfg, patches, bestPatch)
+	if _, err := core.ExportPatches(runDir, exportedPatches, exportedBest); err != nil {
+		slog.Error("failed to export patches", "error", err)
+	}
+	result := &core.TaskResult{Task: checkpoint.Task, RunID: runID, Repo: checkpoint.Repo, Best: bestPatch, Candidates: ranked, ReviewNotes: core.ReviewNotes(bestPatch)}
+	engine.LogArtifactError(slog.Default(), artifacts.WriteReport(result))
+	engine.LogArtifactError(slog.Default(), core.RenderRunPages(runDir))
+	resumed.SetStage(core.StageFinished)
+
+	fmt.Println("\n=== Best Patch Selected ===")
+	fmt.Println(core.FormatPatchResult(bestPatch))
+	if verbosity > 0 {
+		fmt.Println(gitutil.DescribePatch(bestPatch.Diff))
+	}
+	if len(result.ReviewNotes) > 0 {
+		fmt.Println("=== Review Notes ===")
+		for _, note := range result.ReviewNotes {
+			fmt.Println(note)
+		}
+	}
+	fmt.Printf("\nRun %s outputs written to %s\n", runID, runDir)
+	return 0
+}
+
+// applyCommand applies the winning patch, or one agent's patch, from a previous run
+// It returns the process exit code
+func applyCommand(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	path, format := configFlags(fs)
+	repo := fs.String("repo", ".", "Path to the git repository")
+	agentID := fs.String("agent", "", "Apply this agent's patch instead of the winning patch")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator apply [flags] [run-id|run-dir]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	runDir, err := resolveRunDir(fs.Arg(0), artifactsDirFromConfig(*path, *format))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	patches, best, err := core.ReadPatches(runDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	diff, source := best, "the winning patch"
+	if *agentID != "" {
+		agentDiff, ok := patches[*agentID]
+		if !ok {
+			fmt.Printf("Error: run %s has no patch from agent %s\n", filepath.Base(runDir), *agentID)
+			return 1
+		}
+		diff, source = agentDiff, "the patch from "+*agentID
+	}
+	if diff == "" {
+		fmt.Printf("Error: run %s has no winning patch; choose one with --agent\n", filepath.Base(runDir))
+		return 1
+	}
+
+	repoAbs, _ := filepath.Abs(*repo)
+	head, headErr := gitutil.ResolveCommit(*repo, "HEAD")
+	before, beforeErr := gitutil.WorkingTreeID(*repo)
+
+	if err := gitutil.ApplyPatch(*repo, diff); err != nil {
+		fmt.Printf("Error: failed to apply %s: %v\n", source, err)
+		return 1
+	}
+
+	// The record keeps a branch the run committed, unless that was already rolled back
+	record, err := core.ReadApplyRecord(runDir)
+	if err != nil || record.RolledBackAt != nil {
+		record = &core.ApplyRecord{}
+	}
+	record.Repo, record.Agent, record.AppliedAt = repoAbs, *agentID, time.Now()
+	after, afterErr := gitutil.WorkingTreeID(*repo)
+	if err := errors.Join(headErr, beforeErr, afterErr); err != nil {
+		fmt.Printf("Warning: the patch can't be rolled back: %v\n", err)
+	} else {
+		record.Head, record.Before, record.After = head, before, after
+		if err := core.WriteApplyRecord(runDir, record); err != nil {
+			fmt.Printf("Warning: the patch can't be rolled back: %v\n", err)
+		}
+	}
+
+	// Patches applied by hand are audited too, when the configuration can be loaded to find the log
+	if cfg, err := core.LoadWithFormat(*path, core.ConfigFormat(*format)); err == nil {
+		ctx := audit.WithRun(context.Background(), engine.NewAuditLog(cfg), filepath.Base(runDir))
+		audit.Record(ctx, audit.PatchApplied, "agent", *agentID, "patch", source, "repo", repoAbs, "files", strconv.Itoa(gitutil.GetDiffStats(diff).FilesChanged))
+	}
+
+	fmt.Printf("Applied %s from run %s to %s\n", source, filepath.Base(runDir), *repo)
+	return 0
+}
+
+// rollbackCommand undoes applying a previous run's patch to the repository and committing it to a branch, as recorded
+// by the run or the apply command
+// It returns the process exit code
+func rollbackCommand(args []string) int {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	path, format := configFlags(fs)
+	force := fs.Bool("force", false, "Roll back even if the repository changed since the patch was applied, discarding the changes")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator rollback [flags] [run-id|run-dir]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	runDir, err := resolveRunDir(fs.Arg(0), artifactsDirFromConfig(*path, *format))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	runID := filepath.Base(runDir)
+	record, err := core.ReadApplyRecord(runDir)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Error: run %s didn't apply or commit a patch\n", runID)
+		return 1
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if record.RolledBackAt != nil {
+		fmt.Printf("Error: run %s was already rolled back at %s\n", runID, record.RolledBackAt.Format(time.RFC3339))
+		return 1
+	}
+
+	if err := checkRollback(record, *force); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if record.Applied() {
+		if err := gitutil.RollBack(record.Repo, record.Before); err != nil {
+			fmt.Printf("Error: failed to roll back %s: %v\n", record.Repo, err)
+			return 1
+		}
+		fmt.Printf("Rolled back the patch applied to %s\n", record.Repo)
+	}
+	if record.Branch != "" {
+		if err := gitutil.DeleteBranch(record.Repo, record.Branch, record.BranchCommit); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Deleted branch %s\n", record.Branch)
+	}
+
+	now := time.Now()
+	record.RolledBackAt = &now
+	if err := core.WriteApplyRecord(runDir, record); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if cfg, err := core.LoadWithFormat(*path, core.ConfigFormat(*format)); err == nil {
+		ctx := audit.WithRun(context.Background(), engine.NewAuditLog(cfg), runID)
+		audit.Record(ctx, audit.PatchRolledBack, "agent", record.Agent, "repo", record.Repo, "branch", record.Branch)
+	}
+	return 0
+}
+
+// checkRollback refuses to roll back changes made to the repository since the patch was applied, unless forced, and a
+// branch that was checked out or committed to since
+func checkRollback(record *core.ApplyRecord, force bool) error {
+	if record.Applied() && !force {
+		head, err := gitutil.ResolveCommit(record.Repo, "HEAD")
+		if err != nil {
+			return err
+		}
+		if head != record.Head {
+			return fmt.Errorf("%s has moved from commit %s since the patch was applied; use --force to roll back anyway", record.Repo, record.Head)
+		}
+		tree, err := gitutil.WorkingTreeID(record.Repo)
+		if err != nil {
+			return err
+		}
+		if tree != record.After {
+			return fmt.Errorf("%s has changed since the patch was applied; use --force to discard the changes and roll back anyway", record.Repo)
+		}
+	}
+
+	if record.Branch != "" {
+		if current, _ := gitutil.CurrentBranch(record.Repo); current == record.Branch {
+			return fmt.Errorf("branch %s is checked out in %s; check out another branch first", record.Branch, record.Repo)
+		}
+		commit, err := gitutil.ResolveCommit(record.Repo, "refs/heads/"+record.Branch)
+		if err != nil {
+			return fmt.Errorf("branch %s no longer exists", record.Branch)
+		}
+		if commit != record.BranchCommit {
+			return fmt.Errorf("branch %s has moved from commit %s since the patch was committed; delete it by hand", record.Branch, record.BranchCommit)
+		}
+	}
+	return nil
+}
+
+// reportCommand summarizes the patches exported by a previous run
+// It returns the process exit code
+func reportCommand(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	path, format := configFlags(fs)
+	render := fs.Bool("render", false, "Write report.html and report.md to the run directory")
+	failures := fs.Bool("failures", false, "Count each agent's failures by kind across every run in the artifacts directory")
+	reviewPR := fs.String("review-pr", "", "GitHub pull request to post the run's review notes on as a review, as a URL or org/repo#123")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator report [flags] [run-id|run-dir]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *failures {
+		artifactsDir, err := artifactsDirFromConfig(*path, *format)()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return printFailureHistory(artifactsDir)
+	}
+
+	runDir, err := resolveRunDir(fs.Arg(0), artifactsDirFromConfig(*path, *format))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	// The review notes of a run's winning patch can be posted once it has a pull request
+	if *reviewPR != "" {
+		return postReviewNotes(*path, *format, runDir, *reviewPR)
+	}
+
+	// Runs render their pages when they finish, so this is for older runs or a changed template
+	if *render {
+		if err := core.RenderRunPages(runDir); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Wrote %s and %s\n", filepath.Join(runDir, core.ReportHTMLFile), filepath.Join(runDir, core.ReportMarkdownFile))
+		return 0
+	}
+
+	// A run that crashed only has the patches its checkpoint saved, and no report
+	if checkpoint, err := core.ReadCheckpoint(runDir); err == nil && checkpoint.Interrupted() {
+		fmt.Printf("Run %s has not finished (last checkpoint %s, %s stage); if it was interrupted, finish it with orchestrator resume %s\n",
+			checkpoint.RunID, checkpoint.Updated.Local().Format(time.DateTime), checkpoint.Stage, filepath.Base(runDir))
+	}
+
+	patches, best, err := core.ReadPatches(runDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	agentIDs := make([]string, 0, len(patches))
+	for agentID := range patches {
+		agentIDs = append(agentIDs, agentID)
+	}
+
+	// Runs that wrote a report also record what each agent consumed, and agents that failed without a patch
+	usage := make(map[string]core.ReportCandidate)
+	if report, err := core.ReadReport(runDir); err == nil {
+		for _, candidate := range report.Candidates {
+			usage[candidate.AgentID] = candidate
+			if _, ok := patches[candidate.AgentID]; !ok && candidate.Failure != "" {
+				agentIDs = append(agentIDs, candidate.AgentID)
+			}
+		}
+	}
+	sort.Strings(agentIDs)
+
+	fmt.Printf("Run %s (%s)\n", filepath.Base(runDir), runDir)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "AGENT\tFILES\tADDED\tREMOVED\tTOKENS\tCOST\tTIME\tIDLE\tWARNINGS\t")
+	for _, agentID := range agentIDs {
+		stats := gitutil.GetDiffStats(patches[agentID])
+		marker := ""
+		if patches[agentID] == best {
+			marker = "best"
+		}
+		candidate := usage[agentID]
+		if candidate.Terminated != "" {
+			marker = strings.TrimSpace(marker + " (stopped: " + candidate.Terminated + ")")
+		} else if candidate.Failure != "" {
+			marker = strings.TrimSpace(marker + " (failed: " + string(candidate.Failure) + ")")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t+%d\t-%d\t%d\t$%.2f\t%v\t%v\t%d\t%s\n", agentID, stats.FilesChanged, stats.LinesAdded, stats.LinesRemoved,
+			candidate.Tokens, candidate.CostUSD, seconds(candidate.DurationSeconds), seconds(candidate.IdleSeconds), len(candidate.Warnings), marker)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	// A patch reduced with --accept matches no agent's full patch
+	if best != "" && !containsValue(patches, best) {
+		stats := gitutil.GetDiffStats(best)
+		fmt.Printf("Winning patch (partial): %d files, +%d -%d\n", stats.FilesChanged, stats.LinesAdded, stats.LinesRemoved)
+	}
+
+	return 0
+}
+
+// transcriptCommand renders saved agent transcripts as Markdown on stdout
+// The argument is a run, as for report, or a transcript file; without --agent every transcript in the run is rendered
+// Encrypted transcripts are decrypted with the key in the configuration
+// It returns the process exit code
+func transcriptCommand(args []string) int {
+	fs := flag.NewFlagSet("transcript", flag.ExitOnError)
+	path, format := configFlags(fs)
+	agentID := fs.String("agent", "", "Render only this agent's transcript")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator transcript [flags] [run-id|run-dir|transcript-file]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	var paths []string
+	if info, err := os.Stat(fs.Arg(0)); err == nil && !info.IsDir() {
+		paths = []string{fs.Arg(0)}
+	} else {
+		runDir, err := resolveRunDir(fs.Arg(0), artifactsDirFromConfig(*path, *format))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if *agentID != "" {
+			paths = []string{core.TranscriptPath(runDir, *agentID)}
+		} else if paths, err = filepath.Glob(filepath.Join(runDir, core.TranscriptsDir, "*.jsonl")); err != nil || len(paths) == 0 {
+			fmt.Printf("Error: no transcripts found in %s\n", runDir)
+			return 1
+		}
+	}
+
+	var cipher *core.Cipher
+	for i, transcript := range paths {
+		events, err := core.ReadTranscript(transcript, cipher)
+		// Encrypted transcripts are decrypted with the configured key, loaded when the first one is found
+		if errors.Is(err, core.ErrEncrypted) && cipher == nil {
+			cfg, loadErr := core.LoadWithFormat(*path, core.ConfigFormat(*format))
+			if loadErr != nil {
+				fmt.Printf("Error loading configuration: %v\n", loadErr)
+				return 1
+			}
+			cipher = cfg.Cipher()
+			events, err = core.ReadTranscript(transcript, cipher)
+		}
+		// An unfinished transcript, of a running agent or an interrupted run, is shown as far as it goes
+		if errors.Is(err, core.ErrUnfinished) {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", transcript, err)
+			err = nil
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+
+		// File names have slashes replaced, so the agent ID comes from its events when they have one
+		name := *agentID
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(transcript), ".jsonl")
+			for _, event := range events {
+				if event.AgentID != "" {
+					name = event.AgentID
+					break
+				}
+			}
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(core.TranscriptMarkdown(name, events))
+	}
+	return 0
+}
+
+// printFailureHistory prints how often each agent failed, by kind, across the runs in an artifacts directory
+// Only the kinds that occurred get a column; it returns the process exit code
+func printFailureHistory(artifactsDir string) int {
+	history, err := core.LoadFailureHistory(artifactsDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(history.Agents) == 0 {
+		fmt.Printf("No agent results found in %s\n", artifactsDir)
+		return 0
+	}
+
+	var kinds []core.FailureKind
+	for _, kind := range core.FailureKinds {
+		for _, agent := range history.Agents {
+			if agent.Kinds[kind] > 0 {
+				kinds = append(kinds, kind)
+				break
+			}
+		}
+	}
+	agentIDs := make([]string, 0, len(history.Agents))
+	for agentID := range history.Agents {
+		agentIDs = append(agentIDs, agentID)
+	}
+	sort.Strings(agentIDs)
+
+	fmt.Printf("Failures over %d runs in %s\n", history.Runs, artifactsDir)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "AGENT\tRUNS\tFAILED\t")
+	for _, kind := range kinds {
+		fmt.Fprintf(tw, "%s\t", strings.ToUpper(string(kind)))
+	}
+	fmt.Fprintln(tw)
+	for _, agentID := range agentIDs {
+		agent := history.Agents[agentID]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t", agentID, agent.Runs, agent.Failed())
+		for _, kind := range kinds {
+			fmt.Fprintf(tw, "%d\t", agent.Kinds[kind])
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// statsCommand prints a leaderboard of the agents over the runs in the artifacts directory
+// It returns the process exit code
+func statsCommand(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	path, format := configFlags(fs)
+	since := fs.String("since", "", "Only count runs from this long ago, e.g. 30d or 12h, or since a date such as 2024-01-31")
+	repo := fs.String("repo", "", "Only count runs on repositories whose path or URL contains this")
+	labels := fs.String("label", "", "Only count runs of tasks with any of these comma-separated labels")
+	by := fs.String("by", "", "Group the statistics by week or month to show how agents change over time")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator stats [flags]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	filter := core.StatsFilter{Repo: *repo, Labels: splitList(*labels)}
+	if *since != "" {
+		t, err := parseSince(*since, time.Now())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		filter.Since = t
+	}
+	// A repository given as a local path is recorded by its absolute path
+	if info, err := os.Stat(filter.Repo); err == nil && info.IsDir() {
+		filter.Repo, _ = filepath.Abs(filter.Repo)
+	}
+
+	artifactsDir, err := artifactsDirFromConfig(*path, *format)()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	leaderboard, runs, err := core.LoadAgentStats(artifactsDir, filter, *by)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if runs == 0 {
+		fmt.Printf("No matching runs in %s\n", artifactsDir)
+		return 0
+	}
+
+	fmt.Printf("Agents over %d runs in %s\n", runs, artifactsDir)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if *by != "" {
+		fmt.Fprint(tw, strings.ToUpper(*by)+"\t")
+	}
+	fmt.Fprintln(tw, "AGENT\tRUNS\tWINS\tWIN RATE\tSOLVED\tAVG SCORE\tAVG COST\tAVG TIME\t")
+	for _, stats := range leaderboard {
+		if *by != "" {
+			fmt.Fprint(tw, stats.Period+"\t")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f%%\t%d\t%.1f\t$%.2f\t%v\t\n", stats.AgentID, stats.Runs, stats.Wins, 100*stats.WinRate(), stats.Solved,
+			stats.AvgScore(), stats.AvgCostUSD(), stats.AvgDuration().Round(time.Second))
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseSince turns a --since value into the time it refers to: a duration before now, in days ("30d")
+// or any unit time.ParseDuration accepts, or a date
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since '%s', expected a duration such as 30d or 12h, or a date such as 2024-01-31", value)
+}
+
+// seconds converts a duration recorded in seconds for display
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
+
+// cleanCommand removes, or lists, the worktrees that runs with --keep-worktrees left in the working directory
+// Worktrees of runs in progress are never touched
+// It returns the process exit code
+func cleanCommand(args []string) int {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	path, format := configFlags(fs)
+	repo := fs.String("repo", ".", "Path to the git repository the worktrees were created from")
+	list := fs.Bool("list", false, "List the retained worktrees without removing them")
+	runs := fs.Bool("runs", false, "Delete the runs past the artifact_retention limits instead of worktrees")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator clean [flags]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	cfg, err := core.LoadWithFormat(*path, core.ConfigFormat(*format))
+	if err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		return 1
+	}
+
+	if *runs {
+		if !cfg.ArtifactRetention.Enabled() {
+			fmt.Println("Error: artifact_retention sets no limits, so every run is kept")
+			return 1
+		}
+		pruned, err := core.PruneRuns(cfg.ArtifactsDir, cfg.ArtifactRetention, time.Now())
+		if pruned != nil {
+			for _, runID := range pruned.Runs {
+				fmt.Printf("Removed run %s\n", runID)
+			}
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Removed %d runs and %d unused objects; %s now takes %.1f MB\n", len(pruned.Runs), pruned.Objects, cfg.ArtifactsDir, float64(pruned.Size)/(1024*1024))
+		return 0
+	}
+	worktreeManager, err := gitutil.NewWorktreeManagerWithBackend(*repo, cfg.WorkingDir, gitutil.Backend(cfg.WorktreeBackend))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if *list {
+		retained, err := worktreeManager.RetainedWorktrees()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if len(retained) == 0 {
+			fmt.Printf("No retained worktrees in %s\n", cfg.WorkingDir)
+		}
+		for _, path := range retained {
+			fmt.Println(path)
+		}
+		return 0
+	}
+
+	removed, err := worktreeManager.RemoveRetained()
+	for _, path := range removed {
+		fmt.Printf("Removed %s\n", path)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(removed) == 0 {
+		fmt.Printf("No retained worktrees in %s\n", cfg.WorkingDir)
+	}
+	return 0
+}
+
+// versionCommand prints the orchestrator version
+// It returns the process exit code
+func versionCommand(args []string) int {
+	v := version
+	if info, ok := debug.ReadBuildInfo(); ok && v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+
+	fmt.Printf("orchestrator %s\n", v)
+	return 0
+}
+
+// artifactsDirFromConfig returns a function that loads a configuration file for its artifacts directory
+// Commands given a run directory directly never need to load the configuration
+func artifactsDirFromConfig(path, format string) func() (string, error) {
+	return func() (string, error) {
+		cfg, err := core.LoadWithFormat(path, core.ConfigFormat(format))
+		if err != nil {
+			return "", fmt.Errorf("error loading configuration: %w", err)
+		}
+		return cfg.ArtifactsDir, nil
+	}
+}
+
+// resolveRunDir finds the directory of a previous run from a run directory path or a run ID
+// An empty argument or "latest" selects the most recent run in the artifacts directory
+func resolveRunDir(arg string, artifactsDir func() (string, error)) (string, error) {
+	if arg != "" {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			return arg, nil
+		}
+	}
+
+	dir, err := artifactsDir()
+	if err != nil {
+		return "", err
+	}
+
+	if arg == "" || arg == "latest" {
+		return core.LatestRun(dir)
+	}
+
+	runDir := filepath.Join(dir, arg)
+	if _, err := os.Stat(runDir); err != nil {
+		return "", fmt.Errorf("run %s not found in %s", arg, dir)
+	}
+	return runDir, nil
+}
+
+// containsValue reports whether any entry of a map has the given value
+func containsValue(m map[string]string, value string) bool {
+	for _, v := range m {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatch(t *testing.T) {
+	assert.Equal(t, 0, dispatch([]string{"version"}))
+	assert.Equal(t, 0, dispatch([]string{"help"}))
+	assert.Equal(t, 1, dispatch(nil), "A command is required")
+	assert.Equal(t, 1, dispatch([]string{"bogus"}), "Unknown commands are rejected")
+
+	// Every command shows up in the usage message
+	names := make(map[string]bool)
+	for _, cmd := range commands {
+		assert.False(t, names[cmd.name], "Command %s is listed twice", cmd.name)
+		names[cmd.name] = true
+		assert.NotEmpty(t, cmd.summary)
+	}
+	for _, name := range []string{"run", "validate", "list-agents", "replay", "resume", "mcp", "apply", "rollback", "report", "transcript", "stats", "version"} {
+		assert.True(t, names[name], "Missing command %s", name)
+	}
+}
+
+func TestResolveRunDir(t *testing.T) {
+	artifactsDir := t.TempDir()
+	older := filepath.Join(artifactsDir, "20240101-000000-aaaaaa")
+	newer := filepath.Join(artifactsDir, "20240102-000000-bbbbbb")
+	require.NoError(t, os.MkdirAll(older, 0755))
+	require.NoError(t, os.MkdirAll(newer, 0755))
+
+	fromConfig := func() (string, error) { return artifactsDir, nil }
+
+	// Run IDs are looked up in the artifacts directory
+	runDir, err := resolveRunDir("20240101-000000-aaaaaa", fromConfig)
+	require.NoError(t, err)
+	assert.Equal(t, older, runDir)
+
+	// The latest run is used when none is given
+	for _, arg := range []string{"", "latest"} {
+		runDir, err = resolveRunDir(arg, fromConfig)
+		require.NoError(t, err)
+		assert.Equal(t, newer, runDir)
+	}
+
+	_, err = resolveRunDir("20230101-000000-cccccc", fromConfig)
+	assert.Error(t, err)
+
+	// Run directories are used as given without loading the configuration
+	noConfig := func() (string, error) { return "", errors.New("no configuration") }
+	runDir, err = resolveRunDir(older, noConfig)
+	require.NoError(t, err)
+	assert.Equal(t, older, runDir)
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Time{
+		"30d":        time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+		"12h":        time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		"2024-02-15": time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC),
+	} {
+		got, err := parseSince(value, now)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+	for _, value := range []string{"", "soon", "-3d", "-1h"} {
+		_, err := parseSince(value, now)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"sort"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+)
+
+// dashboardHTML is the web dashboard served at the root of the HTTP API
+// It is a single page that reads everything it shows from the API, so it needs no build step
+//
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// historyEntry is one run listed by the history endpoint
+type historyEntry struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// handleDashboard serves the web dashboard
+func (s *server) handleDashboard(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(dashboardHTML)
+}
+
+// handleHistory lists every run with exported artifacts or submitted since the server started, newest first
+// Runs from before the server started are listed as archived
+func (s *server) handleHistory(w http.ResponseWriter, _ *http.Request) {
+	s.mutex.Lock()
+	runs := make([]*serverRun, 0, len(s.runs))
+	for _, r := range s.runs {
+		runs = append(runs, r)
+	}
+	s.mutex.Unlock()
+
+	entries := make([]historyEntry, 0, len(runs))
+	known := make(map[string]bool, len(runs))
+	for _, r := range runs {
+		entries = append(entries, historyEntry{ID: r.id, Status: r.state()})
+		known[r.id] = true
+	}
+
+	// A missing artifacts directory just means no run has exported anything yet
+	archived, _ := core.ListRuns(s.watcher.Current().ArtifactsDir)
+	for _, id := range archived {
+		if !known[id] {
+			entries = append(entries, historyEntry{ID: id, Status: runArchived})
+		}
+	}
+
+	// Run IDs start with a timestamp, so they sort by age
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	writeJSON(w, http.StatusOK, entries)
+}
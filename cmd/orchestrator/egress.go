@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/sandbox"
+)
+
+// egressProxyCommand serves the proxy an allowlisted agent container reaches the network through
+// Refused hosts are logged to stderr, where the orchestrator reads them from the proxy container's logs
+func egressProxyCommand(args []string) int {
+	fs := flag.NewFlagSet(sandbox.ProxyCommand, flag.ExitOnError)
+	listen := fs.String("listen", fmt.Sprintf(":%d", sandbox.ProxyPort), "Address to listen on")
+	allow := fs.String("allow", "", "Comma-separated hosts to relay to, e.g. api.openai.com,*.anthropic.com")
+	_ = fs.Parse(args)
+
+	var hosts []string
+	for _, host := range strings.Split(*allow, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           sandbox.NewProxy(hosts, os.Stderr),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
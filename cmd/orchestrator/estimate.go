@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+)
+
+// confirmEstimate prints what tasks runs of the configuration, concurrency at a time, are expected
+// to cost and take, and asks before starting them if that is above the configured thresholds
+// It returns false if the runs should not start
+func confirmEstimate(cfg *core.Config, tasks, concurrency int) bool {
+	estimate := engine.EstimateRun(cfg, runOptions(nil)).Repeat(tasks, concurrency)
+	reason := estimate.NeedsConfirmation(cfg.ConfirmAbove)
+	if !quiet || reason != "" {
+		fmt.Print(core.FormatEstimate(estimate))
+	}
+	if reason == "" || assumeYes {
+		return true
+	}
+
+	if confirm(fmt.Sprintf("Confirmation is needed because %s. Start anyway?", reason)) {
+		return true
+	}
+	fmt.Println("Not started; pass --yes to start without confirmation")
+	return false
+}
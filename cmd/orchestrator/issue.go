@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/github"
+)
+
+// maxCommentPatchBytes is the largest patch included in an issue comment
+// GitHub rejects comments over 65536 characters, so larger patches are left in the run directory
+const maxCommentPatchBytes = 60000
+
+// issueSource is a GitHub issue or pull request used as the task of a run
+type issueSource struct {
+	ref    github.IssueRef
+	client *github.Client
+	issue  *github.Issue
+}
+
+// fetchIssue fetches the issue or pull request named by the --issue flag
+func fetchIssue(ctx context.Context, arg string) (*issueSource, error) {
+	ref, err := github.ParseIssueRef(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := github.NewClient(ref.Host, github.TokenFromEnv())
+	issue, err := client.Issue(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &issueSource{ref: ref, client: client, issue: issue}, nil
+}
+
+// String returns the issue's reference, e.g. org/repo#123
+func (s *issueSource) String() string {
+	return s.ref.String()
+}
+
+// task returns the task for the issue, with any --prompt added as further instructions
+func (s *issueSource) task(extra string) core.Task {
+	prompt := github.Prompt(s.ref, s.issue)
+	if extra = strings.TrimSpace(extra); extra != "" {
+		prompt += "\nAdditional instructions:\n" + extra + "\n"
+	}
+	return core.Task{ID: fmt.Sprintf("issue-%d", s.ref.Number), Prompt: prompt}
+}
+
+// report comments on the issue with the outcome of the run, printing the comment's URL
+func (s *issueSource) report(ctx context.Context, cfg *core.Config, result *core.TaskResult) error {
+	url, err := s.client.CreateComment(ctx, s.ref, cfg.Redact(formatIssueComment(result)))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Commented on %s: %s\n", s.ref, url)
+	audit.Record(ctx, audit.IssueCommented, "issue", s.ref.String(), "url", url)
+	return nil
+}
+
+// formatIssueComment summarizes a run's winning patch as a Markdown issue comment
+func formatIssueComment(result *core.TaskResult) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The orchestrator evaluated %d patches for this task (run `%s`).\n\n", len(result.Candidates), result.RunID)
+
+	best := result.Best
+	if best == nil || strings.TrimSpace(best.Diff) == "" {
+		sb.WriteString("No agent produced a patch.\n")
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "- **Best patch:** `%s`, scoring %d (%s)\n", best.AgentID, best.Score, best.Reason)
+	fmt.Fprintf(&sb, "- **Changes:** %d files, +%d -%d\n", best.DiffStats.FilesChanged, best.DiffStats.LinesAdded, best.DiffStats.LinesRemoved)
+	if tests := best.TestResults; tests != nil {
+		fmt.Fprintf(&sb, "- **Tests:** %d of %d passed\n", tests.PassedTests, tests.TotalTests)
+	}
+	if result.Branch != "" {
+		fmt.Fprintf(&sb, "- **Branch:** `%s`\n", result.Branch)
+	}
+
+	if len(result.Candidates) > 1 {
+		sb.WriteString("\n| Agent | Score | Reason |\n| --- | --- | --- |\n")
+		for _, candidate := range result.Candidates {
+			fmt.Fprintf(&sb, "| `%s` | %d | %s |\n", candidate.AgentID, candidate.Score, strings.ReplaceAll(candidate.Reason, "|", `\|`))
+		}
+	}
+
+	if len(result.ReviewNotes) > 0 {
+		sb.WriteString("\n**Review notes**\n\n")
+		sb.WriteString(core.ReviewNotesMarkdown(result.ReviewNotes))
+	}
+
+	if len(best.Diff) > maxCommentPatchBytes {
+		fmt.Fprintf(&sb, "\nThe patch is too large to include here (%d bytes); it is saved as best.patch in the run directory.\n", len(best.Diff))
+		return sb.String()
+	}
+
+	// A fence longer than any backtick run in the patch keeps it from ending the code block early
+	fence := "```"
+	for strings.Contains(best.Diff, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(&sb, "\n<details>\n<summary>Patch</summary>\n\n%sdiff\n%s\n%s\n\n</details>\n", fence, strings.TrimRight(best.Diff, "\n"), fence)
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/github"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssueSourceTask(t *testing.T) {
+	source := &issueSource{
+		ref:   github.IssueRef{Owner: "org", Repo: "repo", Number: 123},
+		issue: &github.Issue{Title: "Crash on empty input", Body: "It panics."},
+	}
+
+	task := source.task("")
+	assert.Equal(t, "issue-123", task.ID)
+	assert.True(t, strings.HasPrefix(task.Prompt, "Fix org/repo#123: Crash on empty input\n"))
+	assert.NotContains(t, task.Prompt, "Additional instructions")
+
+	task = source.task("Keep the public API unchanged")
+	assert.True(t, strings.HasSuffix(task.Prompt, "\nAdditional instructions:\nKeep the public API unchanged\n"), task.Prompt)
+}
+
+func TestFormatIssueComment(t *testing.T) {
+	best := &core.PatchResult{
+		AgentID:     "claude",
+		Score:       170,
+		Reason:      "Tests now passing",
+		Diff:        "diff --git a/f.go b/f.go\n-return 1\n+return 2\n",
+		DiffStats:   gitutil.DiffStats{FilesChanged: 1, LinesAdded: 1, LinesRemoved: 1},
+		TestResults: &core.TestResult{Success: true, TotalTests: 3, PassedTests: 3},
+	}
+	other := &core.PatchResult{AgentID: "codex", Score: 20, Reason: "Tests still failing | partial"}
+	result := &core.TaskResult{RunID: "20240102-030405-abcdef", Best: best, Candidates: []*core.PatchResult{best, other}, Branch: "orchestrator/fix-crash"}
+
+	comment := formatIssueComment(result)
+	assert.Contains(t, comment, "evaluated 2 patches for this task (run `20240102-030405-abcdef`)")
+	assert.Contains(t, comment, "- **Best patch:** `claude`, scoring 170 (Tests now passing)\n")
+	assert.Contains(t, comment, "- **Tests:** 3 of 3 passed\n")
+	assert.Contains(t, comment, "- **Branch:** `orchestrator/fix-crash`\n")
+	assert.Contains(t, comment, "| `codex` | 20 | Tests still failing \\| partial |\n")
+	assert.Contains(t, comment, "```diff\ndiff --git a/f.go b/f.go\n-return 1\n+return 2\n```\n")
+	assert.NotContains(t, comment, "Review notes")
+
+	result.ReviewNotes = []core.ReviewNote{{Kind: core.ReviewNoteUntested, File: "f.go", Line: 1, Message: "line 1 changed"}}
+	assert.Contains(t, formatIssueComment(result), "**Review notes**\n\n- **untested** `f.go:1`: line 1 changed\n")
+
+	// Backticks in the patch lengthen the fence
+	best.Diff = "+// ```go\n"
+	assert.Contains(t, formatIssueComment(result), "````diff\n+// ```go\n````\n")
+
+	best.Diff = strings.Repeat("+x\n", maxCommentPatchBytes)
+	comment = formatIssueComment(result)
+	assert.Contains(t, comment, "too large to include")
+	assert.NotContains(t, comment, "<details>")
+
+	comment = formatIssueComment(&core.TaskResult{RunID: "20240102-030405-abcdef"})
+	assert.Contains(t, comment, "No agent produced a patch.")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/brettsmith212/orchestrator/internal/engine"
+)
+
+// levelTrace is below debug and logs every agent event
+const levelTrace = engine.LevelTrace
+
+// Flags controlling how much is logged and how
+var (
+	quiet     bool
+	verbosity int
+	logLevel  string
+	logFormat string
+)
+
+// verbosityFlag is a boolean flag that raises the verbosity by its value each time it is given
+type verbosityFlag int
+
+// String implements flag.Value
+func (f verbosityFlag) String() string {
+	return ""
+}
+
+// Set implements flag.Value
+func (f verbosityFlag) Set(value string) error {
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if on {
+		verbosity += int(f)
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value
+func (f verbosityFlag) IsBoolFlag() bool {
+	return true
+}
+
+// logFlags defines the output tier and logging flags of commands that run agents
+func logFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&quiet, "quiet", false, "Only print the final result, plus warnings and errors")
+	fs.BoolVar(&quiet, "q", false, "Shorthand for --quiet")
+	fs.Var(verbosityFlag(1), "v", "Also log details such as worktree paths and the changes in the selected patch (repeat or use -vv for more)")
+	fs.Var(verbosityFlag(2), "vv", "Also log every agent event")
+	fs.Var(verbosityFlag(1), "verbose", "Same as -v")
+	fs.StringVar(&logLevel, "log-level", "", "Minimum level of log messages: trace, debug, info, warn, or error (overrides --quiet and -v)")
+	fs.StringVar(&logFormat, "log-format", "text", "Format of log messages: text or json")
+}
+
+// logSink is the writer log records are written to
+// The TUI swaps its destination to keep messages below its table
+type logSink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// Write writes a log record to the current destination
+func (s *logSink) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.w.Write(p)
+}
+
+// swap sends later log records to w and returns the previous destination
+func (s *logSink) swap(w io.Writer) io.Writer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	previous := s.w
+	s.w = w
+	return previous
+}
+
+// logOutput receives all log records, which go to stderr unless the TUI is shown
+var logOutput = &logSink{w: os.Stderr}
+
+// setupLogging installs the default logger selected by the output tier and logging flags
+// Messages from the standard log package are routed through it too
+func setupLogging() error {
+	if quiet && verbosity > 0 {
+		return fmt.Errorf("--quiet cannot be combined with -v")
+	}
+	if quiet && tuiMode {
+		return fmt.Errorf("--quiet cannot be combined with --tui")
+	}
+
+	level, err := outputLevel(quiet, verbosity, logLevel)
+	if err != nil {
+		return err
+	}
+
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: nameTraceLevel}
+	var handler slog.Handler
+	switch strings.ToLower(logFormat) {
+	case "", "text":
+		handler = slog.NewTextHandler(logOutput, options)
+	case "json":
+		handler = slog.NewJSONHandler(logOutput, options)
+	default:
+		return fmt.Errorf("unknown log format %q, must be text or json", logFormat)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// outputLevel returns the minimum level logged for an output tier, unless a level is named explicitly
+// Quiet shows only warnings and errors, the default adds progress milestones, -v adds details, and -vv every agent event
+func outputLevel(quiet bool, verbosity int, name string) (slog.Level, error) {
+	if name != "" {
+		if strings.EqualFold(name, "trace") {
+			return levelTrace, nil
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return 0, fmt.Errorf("unknown log level %q, must be trace, debug, info, warn, or error", name)
+		}
+		return level, nil
+	}
+
+	switch {
+	case quiet:
+		return slog.LevelWarn, nil
+	case verbosity >= 2:
+		return levelTrace, nil
+	case verbosity == 1:
+		return slog.LevelDebug, nil
+	default:
+		return slog.LevelInfo, nil
+	}
+}
+
+// nameTraceLevel labels trace records as TRACE rather than DEBUG-4
+func nameTraceLevel(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == levelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+	return a
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFlags(t *testing.T) {
+	tests := []struct {
+		args      []string
+		quiet     bool
+		verbosity int
+		level     slog.Level
+	}{
+		{args: nil, level: slog.LevelInfo},
+		{args: []string{"-q"}, quiet: true, level: slog.LevelWarn},
+		{args: []string{"--quiet"}, quiet: true, level: slog.LevelWarn},
+		{args: []string{"-v"}, verbosity: 1, level: slog.LevelDebug},
+		{args: []string{"--verbose"}, verbosity: 1, level: slog.LevelDebug},
+		{args: []string{"-vv"}, verbosity: 2, level: levelTrace},
+		{args: []string{"-v", "-v"}, verbosity: 2, level: levelTrace},
+	}
+	for _, tc := range tests {
+		quiet, verbosity = false, 0
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		logFlags(fs)
+		require.NoError(t, fs.Parse(tc.args), tc.args)
+
+		assert.Equal(t, tc.quiet, quiet, tc.args)
+		assert.Equal(t, tc.verbosity, verbosity, tc.args)
+		level, err := outputLevel(quiet, verbosity, "")
+		require.NoError(t, err)
+		assert.Equal(t, tc.level, level, tc.args)
+	}
+	quiet, verbosity = false, 0
+}
+
+func TestOutputLevel(t *testing.T) {
+	// A named level overrides the output tier
+	level, err := outputLevel(true, 0, "DEBUG")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	level, err = outputLevel(false, 0, "trace")
+	require.NoError(t, err)
+	assert.Equal(t, levelTrace, level)
+
+	_, err = outputLevel(false, 0, "loud")
+	assert.ErrorContains(t, err, `unknown log level "loud"`)
+}
+
+func TestSetupLogging(t *testing.T) {
+	defer func() { quiet, verbosity, logFormat = false, 0, "text" }()
+
+	var buf bytes.Buffer
+	previous := logOutput.swap(&buf)
+	defer logOutput.swap(previous)
+
+	verbosity = 2
+	require.NoError(t, setupLogging())
+	slog.Log(context.Background(), levelTrace, "received event")
+	assert.Contains(t, buf.String(), "level=TRACE")
+
+	verbosity, logFormat = 0, "json"
+	buf.Reset()
+	require.NoError(t, setupLogging())
+	slog.Debug("hidden")
+	slog.Info("shown", "agent", "claude")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), `"msg":"shown","agent":"claude"`)
+
+	quiet, verbosity = true, 1
+	assert.ErrorContains(t, setupLogging(), "--quiet cannot be combined with -v")
+
+	quiet, verbosity, logFormat = false, 0, "xml"
+	assert.ErrorContains(t, setupLogging(), `unknown log format "xml"`)
+}
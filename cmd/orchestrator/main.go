@@ -1,419 +1,420 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"sync"
+	"strings"
 	"syscall"
-	"time"
 
-	"github.com/brettsmith212/orchestrator/internal/adapter"
-	"github.com/brettsmith212/orchestrator/internal/adapter/amp"
-	"github.com/brettsmith212/orchestrator/internal/adapter/claude"
-	"github.com/brettsmith212/orchestrator/internal/adapter/cli"
-	"github.com/brettsmith212/orchestrator/internal/adapter/codex"
+	"github.com/brettsmith212/orchestrator/internal/audit"
 	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/github"
 	"github.com/brettsmith212/orchestrator/internal/gitutil"
-	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
 )
 
 const defaultConfigPath = "config.yaml"
 
-// Command line flags
+// Flags of the run command
 var (
-	configPath string
-	prompt     string
-	repoPath   string
-	verbose    bool
-	maxTokens  int
-	timeoutSec int
+	configPath    string
+	configFormat  string
+	profile       string
+	agentIDs      string
+	agentTags     string
+	autoDiscover  bool
+	prompt        string
+	repoPath      string
+	repoURL       string
+	cloneDepth    int
+	cloneFilter   string
+	tuiMode       bool
+	maxTokens     int
+	maxDiskMB     int
+	maxMemoryMB   int
+	maxCPUSec     int
+	maxCost       float64
+	maxRunCost    float64
+	maxRunTokens  int
+	maxIdleSec    int
+	timeoutSec    int
+	mutation      bool
+	speculative   bool
+	refineRounds  int
+	stack         int
+	scopePath     string
+	keepWorktrees bool
+	deterministic bool
+	smokeTest     bool
+	testAuthor    string
+	patchFiles    string
+	dryRunOnly    bool
+	apply         bool
+	dirty         bool
+	commit        bool
+	branchName    string
+	accept        string
+	samples       int
+	variants      int
+	promptTmpl    string
+	issue         string
+	issueComment  bool
+	assumeYes     bool
+	ciMode        string
+	commitStatus  bool
+	reviewPR      string
 )
 
-func init() {
-	// Define command line flags
-	flag.StringVar(&configPath, "config", defaultConfigPath, "Path to configuration file")
-	flag.StringVar(&prompt, "prompt", "", "Task prompt for the agents")
-	flag.StringVar(&repoPath, "repo", ".", "Path to the git repository")
-	flag.BoolVar(&verbose, "verbose", false, "Enable verbose output")
-	flag.IntVar(&maxTokens, "max-tokens", 10000, "Maximum tokens per agent (0 for unlimited)")
-	flag.IntVar(&timeoutSec, "timeout", 300, "Agent timeout in seconds (0 for config default)")
+// newRunFlags defines the flags of the run command
+func newRunFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator run [flags]\n")
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&configPath, "config", defaultConfigPath, "Path to configuration file")
+	fs.StringVar(&configFormat, "config-format", "", "Configuration format: yaml, json, or toml (detected from the extension by default)")
+	fs.StringVar(&profile, "profile", "", "Named configuration profile to apply")
+	fs.BoolVar(&autoDiscover, "auto-discover", false, "Also run every agent CLI found on PATH that the config doesn't already use")
+	fs.StringVar(&agentIDs, "agents", "", "Comma-separated IDs of the agents to run (includes disabled agents)")
+	fs.StringVar(&agentTags, "tags", "", "Comma-separated tags; only agents with at least one of them run")
+	fs.StringVar(&prompt, "prompt", "", "Task prompt for the agents")
+	fs.StringVar(&promptTmpl, "prompt-template", "", "File holding a Go text/template that wraps the prompt (overrides prompt_template in the config)")
+	fs.StringVar(&issue, "issue", "", "GitHub issue or pull request, or Jira or Linear issue, to use as the task, as a URL, org/repo#123, or PROJ-123 (--prompt adds instructions)")
+	fs.BoolVar(&issueComment, "issue-comment", true, "Comment on the --issue with the result, and move a solved Jira or Linear issue along its workflow")
+	fs.StringVar(&reviewPR, "review-pr", "", "GitHub pull request to post the winning patch's review notes on as a review, as a URL or org/repo#123")
+	fs.StringVar(&repoPath, "repo", ".", "Path to the git repository")
+	fs.StringVar(&scopePath, "path", "", "Subtree of the repository, such as pkg/service-a, that agents' changes and the tests are confined to (overrides scope in the config)")
+	fs.StringVar(&repoURL, "repo-url", "", "Remote repository to clone into the working directory instead of using --repo")
+	fs.IntVar(&cloneDepth, "clone-depth", 1, "History depth for --repo-url clones (0 for full history)")
+	fs.StringVar(&cloneFilter, "clone-filter", "blob:none", "Partial clone filter for --repo-url clones (empty for a full clone)")
+	fs.BoolVar(&tuiMode, "tui", false, "Show a live table of agent progress instead of scrolling output (needs a terminal)")
+	fs.IntVar(&maxTokens, "max-tokens", 0, "Maximum tokens per agent (0 for config default)")
+	fs.IntVar(&maxDiskMB, "max-disk-mb", 0, "Maximum worktree size per agent in megabytes (0 for config default)")
+	fs.IntVar(&maxMemoryMB, "max-memory-mb", 0, "Maximum resident memory of each agent's processes in megabytes (0 for config default)")
+	fs.IntVar(&maxCPUSec, "max-cpu", 0, "Maximum CPU seconds each agent's processes can use (0 for config default)")
+	fs.Float64Var(&maxCost, "max-cost", 0, "Maximum spend per agent in US dollars (0 for config default)")
+	fs.Float64Var(&maxRunCost, "max-run-cost", 0, "Maximum spend of all agents together in US dollars (0 for config default)")
+	fs.IntVar(&maxRunTokens, "max-run-tokens", 0, "Maximum tokens of all agents together (0 for config default)")
+	fs.IntVar(&maxIdleSec, "max-idle", 0, "Maximum seconds an agent can go without activity (0 for config default)")
+	fs.IntVar(&timeoutSec, "timeout", 0, "Agent timeout in seconds (0 for config default)")
+	fs.IntVar(&samples, "samples", 0, "Independent attempts per agent, each in its own worktree (0 for config default)")
+	fs.IntVar(&variants, "prompt-variants", 0, "Phrasings of the task every agent runs once each with, from prompt_variants or the built-in ones (0 for config default)")
+	fs.BoolVar(&apply, "apply", false, "Apply the winning patch to the repository")
+	fs.BoolVar(&dirty, "include-dirty", false, "Start agents from the repository's uncommitted changes instead of HEAD")
+	fs.StringVar(&accept, "accept", "", "Comma-separated files or file#hunk specs to keep from the winning patch")
+	fs.BoolVar(&commit, "commit", false, "Commit the winning patch onto a new branch")
+	fs.StringVar(&branchName, "branch", "", "Branch name for --commit (defaults to the configured branch_pattern)")
+	fs.BoolVar(&mutation, "mutation", false, "Run mutation testing on passing patches to estimate test strength")
+	fs.BoolVar(&speculative, "speculative", false, "Evaluate each patch as its agent finishes, stopping the other agents once one is good enough")
+	fs.IntVar(&refineRounds, "refine", 0, "Follow-up rounds giving agents the test failures while the best patch fails tests (0 for config default)")
+	fs.IntVar(&stack, "stack", 0, "Most patches to stack into the result while the best one leaves tests failing, each kept if it applies on top and the tests improve (0 for config default)")
+	fs.BoolVar(&keepWorktrees, "keep-worktrees", false, "Keep every agent's worktree after the run for inspection (remove them later with clean)")
+	fs.BoolVar(&smokeTest, "smoke-test", false, "Give every agent a trivial task first, leaving out of the run the agents that fail it")
+	fs.StringVar(&testAuthor, "test-author", "", "Agent that writes failing tests first, which the other agents start from and make pass (defaults to tdd.test_author)")
+	fs.StringVar(&patchFiles, "patch-file", "", "Comma-separated patch files to judge alongside the agents' patches, each as an agent named patch-<file name>")
+	fs.BoolVar(&deterministic, "deterministic", false, "Run agents one at a time in configuration order, without speculative evaluation, to debug a run")
+	fs.BoolVar(&dryRunOnly, "dry-run", false, "Print what would be executed without starting agents or running tests")
+	fs.BoolVar(&assumeYes, "yes", false, "Start without asking when the estimated cost or time is above confirm_above")
+	fs.StringVar(&ciMode, "ci", "", "Format output for a CI system: github writes GitHub Actions log groups, annotations, and a job summary")
+	fs.BoolVar(&commitStatus, "commit-status", false, "With --ci github, show the run's progress and outcome as a status on the workflow's commit")
+	logFlags(fs)
+
+	return fs
 }
 
 func main() {
-	// Parse command line flags
-	flag.Parse()
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+// runCommand runs agents on a task and selects the best patch
+// It returns the process exit code
+func runCommand(args []string) int {
+	fs := newRunFlags()
+	_ = fs.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
 
 	// Validate required flags
-	if prompt == "" {
-		fmt.Println("Error: task prompt is required")
-		flag.Usage()
-		os.Exit(1)
+	if prompt == "" && issue == "" {
+		fmt.Println("Error: task prompt or --issue is required")
+		fs.Usage()
+		return 1
+	}
+	if ciMode != "" && ciMode != ciGitHub {
+		fmt.Printf("Error: invalid --ci '%s', must be '%s'\n", ciMode, ciGitHub)
+		return 1
+	}
+	if commitStatus && ciMode != ciGitHub {
+		fmt.Printf("Error: --commit-status requires --ci %s\n", ciGitHub)
+		return 1
+	}
+	var reviewRef github.IssueRef
+	if reviewPR != "" {
+		var err error
+		if reviewRef, err = github.ParseIssueRef(reviewPR); err != nil {
+			fmt.Printf("Error: invalid --review-pr: %v\n", err)
+			return 1
+		}
 	}
 
-	// Load configuration
-	cfg, err := core.Load(configPath)
-	if err != nil {
-		fmt.Printf("Error loading configuration: %v\n", err)
-		os.Exit(1)
+	cfg := loadRunConfig()
+	if cfg == nil {
+		return 1
 	}
 
-	// Create context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Runs expected to be expensive need confirmation; a dry run prints the estimate instead
+	if !dryRunOnly && !confirmEstimate(cfg, 1, 1) {
+		return 1
+	}
 
-	// Handle interrupt signals
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigCh
-		fmt.Println("\nReceived interrupt signal, shutting down...")
-		cancel()
-	}()
+	ctx, cancel := interruptContext()
+	defer cancel()
 
-	// Run the orchestrator
-	if err := run(ctx, cfg); err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+	// The task comes from a GitHub, Jira, or Linear issue when one is given
+	task := core.Task{Prompt: prompt}
+	var source taskSource
+	if issue != "" {
+		var err error
+		if source, err = fetchTaskSource(ctx, cfg, issue); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		task = source.task(prompt)
 	}
-}
 
-func run(ctx context.Context, cfg *core.Config) error {
-	// Resolve absolute path to repository
-	abs, err := filepath.Abs(repoPath)
-	if err != nil {
-		return fmt.Errorf("failed to resolve repository path: %w", err)
+	// In GitHub Actions the workflow's commit can show the run's progress as a status; dry runs have none
+	var status *commitTarget
+	var statusURL string
+	var statusClient *github.Client
+	if commitStatus && !dryRunOnly {
+		var err error
+		if status, statusURL, err = githubActionsCommit(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		statusClient = github.NewClient(status.host, github.TokenFromEnv())
 	}
 
-	// Setup git worktree manager
-	worktreeManager, err := gitutil.NewWorktreeManager(abs, cfg.WorkingDir)
+	// Run the orchestrator
+	runID := core.NewRunID()
+	if status != nil {
+		status.set(ctx, statusClient, runID, pendingStatus(runID, statusURL))
+	}
+	result, err := run(ctx, cfg, task, runID, newProgress(cfg))
+	notifyRun(ctx, cfg, runID, result, err)
+	if status != nil {
+		status.set(context.WithoutCancel(ctx), statusClient, runID, finishedStatus(result, err, statusURL))
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create worktree manager: %w", err)
+		if ciMode == ciGitHub {
+			githubRunFailed(os.Stdout, err)
+		}
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if ciMode == ciGitHub && result != nil {
+		if err := reportGitHubActions(os.Stdout, filepath.Join(cfg.ArtifactsDir, runID), runRepo(task), result); err != nil {
+			slog.Warn("failed to report run to GitHub Actions", "error", err)
+		}
 	}
-	defer worktreeManager.Cleanup()
-
-	// Setup test runner
-	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
-	testRunner := core.NewTestRunner(cfg.TestCommand, timeout)
 
-	// Setup arbitrator
-	arbitrator := core.NewArbitrator(testRunner, abs)
+	// Link the outcome back to the issue; dry runs have no outcome
+	if source != nil && issueComment && result != nil {
+		if err := source.report(audit.WithRun(ctx, engine.NewAuditLog(cfg), runID), cfg, result); err != nil {
+			slog.Warn("failed to report to issue", "issue", source.String(), "error", err)
+		}
+	}
 
-	// Run baseline tests
-	fmt.Println("Running baseline tests...")
-	if err := arbitrator.SetBaselineTestResults(ctx); err != nil {
-		return fmt.Errorf("failed to run baseline tests: %w", err)
+	// Post the review notes where the patch is reviewed
+	if reviewPR != "" && result != nil && result.Best != nil {
+		client := github.NewClient(reviewRef.Host, github.TokenFromEnv())
+		if err := reviewPullRequest(audit.WithRun(ctx, engine.NewAuditLog(cfg), runID), client, cfg, reviewRef, runID, result.Best.AgentID, result.ReviewNotes); err != nil {
+			slog.Warn("failed to review pull request", "pull_request", reviewRef.String(), "error", err)
+		}
 	}
 
-	// Setup adapter registry
-	registry := adapter.NewRegistry()
-	registerAdapters(registry)
+	return 0
+}
 
-	// Create adapters based on configuration
-	adapters, err := registry.CreateFromConfig(cfg)
+// loadRunConfig loads the configuration selected by the run flags and narrows it to the agents to run
+// It reports any problem and returns nil if the configuration cannot be used
+func loadRunConfig() *core.Config {
+	// Load configuration, falling back to agent CLIs found on PATH when none are configured
+	cfg, discovered, err := core.LoadWithDiscovery(configPath, core.ConfigFormat(configFormat), autoDiscover, procutil.LookPath)
 	if err != nil {
-		return fmt.Errorf("failed to create adapters: %w", err)
+		fmt.Printf("Error loading configuration: %v\n", err)
+		return nil
 	}
+	if len(discovered) > 0 {
+		fmt.Printf("Discovered agents: %s\n", strings.Join(discovered, ", "))
 
-	// Start agents
-	fmt.Printf("Starting %d agents with prompt: %s\n", len(adapters), prompt)
-	patchDetails, err := runAgents(ctx, adapters, worktreeManager, prompt)
-	if err != nil {
-		return fmt.Errorf("error running agents: %w", err)
+		// Running agents the config never mentioned needs consent unless it was asked for
+		if !autoDiscover && !confirm("The configuration has no agents. Run the discovered agents?") {
+			fmt.Println("No agents to run; add agents to the configuration or pass --auto-discover")
+			return nil
+		}
 	}
 
-	// Select best patch
-	fmt.Println("Evaluating patches...")
-	bestPatch, err := arbitrator.SelectBestPatch(ctx, patchDetails)
-	if err != nil {
-		return fmt.Errorf("failed to select best patch: %w", err)
+	if err := narrowConfig(cfg, profile, splitList(agentIDs), splitList(agentTags)); err != nil {
+		fmt.Printf("Error %v\n", err)
+		return nil
 	}
 
-	// Display results
-	fmt.Println("\n=== Best Patch Selected ===")
-	fmt.Println(core.FormatPatchResult(bestPatch))
-
-	// TODO: Apply the patch to the main repository if requested
+	if scopePath != "" {
+		if err := cfg.SetScope(scopePath); err != nil {
+			fmt.Printf("Error in --path: %v\n", err)
+			return nil
+		}
+	}
 
-	return nil
+	return cfg
 }
 
-// Register all available adapters
-func registerAdapters(registry *adapter.Registry) {
-	// Register CLI adapters
-	registry.Register("cli", adapter.Factory(func(config adapter.Config) (adapter.Adapter, error) {
-		switch {
-		case config.ID == "amp" || config.AdapterConfig["command"] == "amp":
-			// Check for common locations for the binary
-			config.AdapterConfig["binary_path"] = findBinary("amp", []string{
-				"/opt/homebrew/bin/amp",
-				"/usr/local/bin/amp",
-			})
-			return amp.New(config.ID, config.AdapterConfig)
-			
-		case config.ID == "codex" || config.AdapterConfig["command"] == "codex":
-			// Check for common locations for the binary
-			config.AdapterConfig["binary_path"] = findBinary("codex", []string{
-				"/opt/homebrew/bin/codex",
-				"/usr/local/bin/codex",
-			})
-			return codex.New(config.ID, config.AdapterConfig)
-			
-		case config.ID == "claude" || config.AdapterConfig["command"] == "claude":
-			// Check for common locations for the binary
-			config.AdapterConfig["binary_path"] = findBinary("claude", []string{
-				"/opt/homebrew/bin/claude",
-				"/usr/local/bin/claude",
-			})
-			return claude.New(config.ID, config.AdapterConfig)
-			
-		default:
-			// Generic CLI adapter for other command-line tools
-			command, _ := config.AdapterConfig["command"].(string)
-			if command == "" {
-				return nil, fmt.Errorf("missing command for generic CLI adapter")
-			}
-			
-			// Extract arguments
-			var cliArgs []string
-			if args, ok := config.AdapterConfig["args"].([]interface{}); ok {
-				for _, arg := range args {
-					if strArg, ok := arg.(string); ok {
-						cliArgs = append(cliArgs, strArg)
-					}
-				}
-			}
-			
-			return cli.New(config.ID, command, cliArgs), nil
+// narrowConfig applies a profile, if one is named, and selects the agents to run
+// With no ids or tags the enabled agents are kept
+func narrowConfig(cfg *core.Config, profileName string, ids, tags []string) error {
+	if profileName != "" {
+		if err := cfg.ApplyProfile(profileName); err != nil {
+			return fmt.Errorf("applying profile: %w", err)
 		}
-	}))
-
-	// Register specific CLI adapter types
-	amp.RegisterAdapter(registry)
-	codex.RegisterAdapter(registry)
-	claude.RegisterAdapter(registry)
-	
-	// TODO: Register HTTP adapters when implemented
-}
-
-// findBinary looks for a binary in PATH and common locations
-func findBinary(name string, additionalPaths []string) string {
-	// First check if it's in PATH
-	path, err := exec.LookPath(name)
-	if err == nil {
-		return path
 	}
-	
-	// Then check additional locations
-	for _, path := range additionalPaths {
-		if _, err := os.Stat(path); err == nil {
-			return path
-		}
+
+	// Narrow the agents to the enabled ones or those explicitly selected
+	if err := cfg.SelectAgents(ids, tags); err != nil {
+		return fmt.Errorf("selecting agents: %w", err)
 	}
-	
-	// If not found, just return the name and let the system resolve it
-	return name
+	return nil
 }
 
-// runAgents starts all agents and collects their patches
-func runAgents(ctx context.Context, adapters map[string]adapter.Adapter, worktreeManager *gitutil.WorktreeManager, prompt string) (map[string]*core.PatchDetails, error) {
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	patchDetails := make(map[string]*core.PatchDetails)
-	
-	// Set up resource limits
-	limits := core.ResourceLimits{
-		MaxTokens: maxTokens,
-		MaxDuration: time.Duration(timeoutSec) * time.Second,
-	}
-	
-	// If limits aren't specified via flags, use defaults
-	if limits.MaxTokens == 0 {
-		limits.MaxTokens = core.DefaultLimits.MaxTokens
-	}
-	
-	if limits.MaxDuration == 0 {
-		limits.MaxDuration = core.DefaultLimits.MaxDuration
-	}
-	
-	// Create watchdog
-	watchdog := core.NewWatchdog(limits)
-	
-	// Create channels for watchdog communications
-	warningCh := make(chan *protocol.Event, len(adapters))
-	terminateCh := make(chan string, len(adapters))
-	
-	// Start watchdog in background
-	watchdogCtx, watchdogCancel := context.WithCancel(ctx)
-	defer watchdogCancel()
-	go watchdog.RunPeriodicCheck(watchdogCtx, 5*time.Second, warningCh, terminateCh)
-	
-	// Handle watchdog warnings
+// interruptContext returns a context that is cancelled on Ctrl-C or SIGTERM
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		for {
-			select {
-			case warning, ok := <-warningCh:
-				if !ok {
-					return // Channel closed
-				}
-				
-				// Log the warning
-				if verbose {
-					fmt.Printf("Watchdog warning: %s\n", warning.Payload)
-				}
-				
-			case agentID, ok := <-terminateCh:
-				if !ok {
-					return // Channel closed
-				}
-				
-				// Log the termination
-				log.Printf("Terminating agent %s due to resource limit exceeded\n", agentID)
-				
-				// Get the adapter and shut it down
-				if adapter, exists := adapters[agentID]; exists {
-					_ = adapter.Shutdown() // Ignore error, we're terminating anyway
-				}
-				
-			case <-watchdogCtx.Done():
-				return // Context cancelled
-			}
+		select {
+		case <-sigCh:
+			slog.Warn("received interrupt signal, shutting down")
+			cancel()
+		case <-ctx.Done():
 		}
+		signal.Stop(sigCh)
 	}()
 
-	for agentID, agentAdapter := range adapters {
-		wg.Add(1)
-		go func(id string, adpt adapter.Adapter) {
-			defer wg.Done()
-
-			// Create a worktree for this agent
-			worktreePath, err := worktreeManager.CreateWorktree(id, "")
-			if err != nil {
-				log.Printf("Failed to create worktree for agent %s: %v", id, err)
-				return
-			}
-
-			// Start monitoring this agent
-			watchdog.MonitorAgent(id)
-			
-			// Start the agent
-			if verbose {
-				fmt.Printf("Starting agent %s in worktree %s (limits: %d tokens, %v)\n", 
-					id, worktreePath, limits.MaxTokens, limits.MaxDuration)
-			}
-
-			eventCh, err := adpt.Start(ctx, worktreePath, prompt)
-			if err != nil {
-				log.Printf("Failed to start agent %s: %v", id, err)
-				return
-			}
-
-			// Process and collect events with watchdog tracking
-			events := collectEventsWithWatchdog(ctx, id, eventCh, watchdog)
-
-			// Cleanup
-			if err := adpt.Shutdown(); err != nil {
-				log.Printf("Error shutting down agent %s: %v", id, err)
-			}
-
-			// Get the diff
-			diff, err := worktreeManager.GetDiff(worktreePath)
-			if err != nil {
-				log.Printf("Failed to get diff for agent %s: %v", id, err)
-				return
-			}
-
-			// Store patch details
-			mu.Lock()
-			patchDetails[id] = &core.PatchDetails{
-				WorktreePath: worktreePath,
-				Diff:        diff,
-				Events:      events,
-			}
-			mu.Unlock()
-
-			// Stop monitoring this agent
-			watchdog.StopMonitoring(id)
-			
-			if verbose {
-				// Get usage statistics
-				usage := watchdog.GetUsage()
-				if counter, exists := usage[id]; exists {
-					fmt.Printf("Agent %s completed with %d events, %d tokens used, in %v\n", 
-						id, len(events), counter.TotalTokens(), counter.Duration().Round(time.Second))
-				} else {
-					fmt.Printf("Agent %s completed with %d events and %d bytes of diff\n", 
-						id, len(events), len(diff))
-				}
-			}
-		}(agentID, agentAdapter)
+	return ctx, cancel
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to yes
+// It returns false without asking when stdin is not interactive
+func confirm(question string) bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	fmt.Printf("%s [Y/n] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
 	}
 
-	// Wait for all agents to complete
-	wg.Wait()
-	return patchDetails, nil
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
 }
 
-// collectEvents reads all events from the channel
-func collectEvents(ctx context.Context, agentID string, eventCh <-chan *protocol.Event) []*protocol.Event {
-	var events []*protocol.Event
+// splitList splits a comma-separated flag value, ignoring empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-	for {
-		select {
-		case event, ok := <-eventCh:
-			if !ok {
-				// Channel closed, all events received
-				return events
-			}
-			
-			// Only process valid events
-			if event != nil {
-				events = append(events, event)
-				if verbose {
-					fmt.Printf("Agent %s: Received %s event\n", agentID, event.Type)
-				}
-			}
+// runAgentIDs returns the IDs of the agents a run of the configuration starts, one per prompt variant and sample
+func runAgentIDs(cfg *core.Config) []string {
+	return engine.AgentIDs(cfg, samples, variants)
+}
 
-		case <-ctx.Done():
-			// Context cancelled, return what we have
-			return events
-		}
+// run has the agents work on a task and selects, exports, and optionally applies the best patch
+// runID identifies the run in branch names and artifacts, and progress is told what the agents are doing
+// Chat channels hear when a run that isn't a dry run starts and finishes
+func run(ctx context.Context, cfg *core.Config, task core.Task, runID string, progress engine.Progress) (*core.TaskResult, error) {
+	if !dryRunOnly {
+		announceRunStarted(ctx, cfg, task, runID)
+	}
+	result, err := engine.Run(ctx, cfg, task, runID, runOptions(progress))
+	if !dryRunOnly {
+		announceRunFinished(ctx, cfg, runID, result, err)
 	}
+	return result, err
 }
 
-// collectEventsWithWatchdog reads events from the channel and tracks them with the watchdog
-func collectEventsWithWatchdog(ctx context.Context, agentID string, eventCh <-chan *protocol.Event, watchdog *core.Watchdog) []*protocol.Event {
-	var events []*protocol.Event
+// runOptions returns the engine options the run flags select, with progress told what the agents are doing
+func runOptions(progress engine.Progress) engine.Options {
+	_, live := progress.(*progressUI)
+	return engine.Options{
+		Repo:             repoPath,
+		RepoURL:          repoURL,
+		Clone:            gitutil.CloneOptions{Depth: cloneDepth, Filter: cloneFilter},
+		Limits:           flagLimits(),
+		Samples:          samples,
+		PromptVariants:   variants,
+		Mutation:         mutation,
+		Speculative:      speculative,
+		RefineRounds:     refineRounds,
+		Stack:            stack,
+		PromptTemplate:   promptTmpl,
+		IncludeDirty:     dirty,
+		Accept:           splitList(accept),
+		Commit:           commit,
+		Branch:           branchName,
+		Apply:            apply,
+		KeepWorktrees:    keepWorktrees,
+		SmokeTest:        smokeTest,
+		TestAuthor:       testAuthor,
+		PatchFiles:       splitList(patchFiles),
+		Deterministic:    deterministic,
+		DryRun:           dryRunOnly,
+		ConfigPath:       configPath,
+		SharedWorkingDir: sharedRuns,
+		Output:           os.Stdout,
+		Verbose:          verbosity > 0,
+		Ranking:          live,
+		Progress:         progress,
+	}
+}
 
-	for {
-		select {
-		case event, ok := <-eventCh:
-			if !ok {
-				// Channel closed, all events received
-				return events
-			}
-			
-			// Only process valid events
-			if event != nil {
-				// Track the event with the watchdog
-				watchdog.TrackEvent(event)
-				
-				// Store the event
-				events = append(events, event)
-				
-				if verbose {
-					fmt.Printf("Agent %s: Received %s event\n", agentID, event.Type)
-				}
-			}
+// runRepo identifies the repository a task's run works on in its records: its URL when it is cloned, or else its absolute path
+func runRepo(task core.Task) string {
+	return engine.Options{Repo: repoPath, RepoURL: repoURL}.Repository(task)
+}
 
-		case <-ctx.Done():
-			// Context cancelled, return what we have
-			return events
-		}
+// flagLimits returns the agent limits set by the limit flags
+func flagLimits() core.LimitsConfig {
+	return core.LimitsConfig{
+		MaxTokens:          maxTokens,
+		MaxCostUSD:         maxCost,
+		MaxDurationSeconds: timeoutSec,
+		MaxIdleSeconds:     maxIdleSec,
+		MaxDiskMB:          int64(maxDiskMB),
+		MaxMemoryMB:        int64(maxMemoryMB),
+		MaxCPUSeconds:      maxCPUSec,
+		MaxRunCostUSD:      maxRunCost,
+		MaxRunTokens:       maxRunTokens,
 	}
 }
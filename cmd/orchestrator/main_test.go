@@ -1,152 +0,0 @@
-package main
-
-import (
-	"context"
-	"os"
-	"path/filepath"
-	"testing"
-	"time"
-
-	"github.com/brettsmith212/orchestrator/internal/adapter"
-	"github.com/brettsmith212/orchestrator/internal/core"
-	"github.com/brettsmith212/orchestrator/internal/protocol"
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
-)
-
-// TestMain provides basic validation of the main command structure
-func TestMain(t *testing.T) {
-	// Skip this test completely - it's causing hangs
-	t.Skip("Skipping test that may hang")
-
-	// Use a simple configuration for testing
-	cfg := &core.Config{
-		WorkingDir:     t.TempDir(),
-		TestCommand:    "echo 'All tests passed'" , // Mock test command
-		TimeoutSeconds: 1, // Very short timeout
-		Agents: []core.AgentConfig{
-			{
-				ID:   "test-agent",
-				Type: "cli",
-				Config: map[string]interface{}{
-					"command": "echo", 
-					"args": []interface{}{"{\"type\": \"complete\", \"agent_id\": \"test-agent\", \"timestamp\": \"2023-01-01T00:00:00Z\", \"sequence_num\": 1}"},
-				},
-			},
-		},
-	}
-
-	// Create a context with short timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	// Run the orchestrator with the test configuration
-	err := run(ctx, cfg)
-	
-	// Should not return an error
-	assert.NoError(t, err)
-}
-
-// TestRegisterAdapters checks that adapters are registered correctly
-func TestRegisterAdapters(t *testing.T) {
-	registry := adapter.NewRegistry()
-	registerAdapters(registry)
-	
-	// Check registered types
-	types := registry.RegisteredTypes()
-	require.Contains(t, types, "cli", "CLI adapter type should be registered")
-	require.Contains(t, types, "amp", "AMP adapter type should be registered")
-	require.Contains(t, types, "codex", "Codex adapter type should be registered")
-	require.Contains(t, types, "claude", "Claude adapter type should be registered")
-	
-	// Create a test configuration for a generic CLI adapter only
-	cfg := adapter.Config{
-		ID:   "generic",
-		Type: "cli",
-		AdapterConfig: map[string]interface{}{
-			"command": "echo", // Use echo as it's likely to exist in any test environment
-			"args": []interface{}{"test"},
-		},
-	}
-	
-	// Test creating a generic adapter
-	adpt, err := registry.Create(cfg)
-	require.NoError(t, err, "Failed to create adapter: %s", cfg.ID)
-	require.NotNil(t, adpt, "Adapter should not be nil: %s", cfg.ID)
-	
-	// Clean up - make sure we call shutdown
-	err = adpt.Shutdown()
-	require.NoError(t, err, "Failed to shutdown adapter: %s", cfg.ID)
-}
-
-// TestCollectEvents tests event collection from a channel
-func TestCollectEvents(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-	
-	// Create event channel with some test events
-	eventCh := make(chan *protocol.Event, 3)
-	eventCh <- protocol.NewEvent(protocol.EventTypeThinking, "test-agent", 1)
-	eventCh <- protocol.NewEvent(protocol.EventTypeAction, "test-agent", 2)
-	eventCh <- protocol.NewEvent(protocol.EventTypeComplete, "test-agent", 3)
-	close(eventCh)
-	
-	// Collect events
-	events := collectEvents(ctx, "test-agent", eventCh)
-	
-	// Check results
-	assert.Len(t, events, 3, "Should collect all events")
-	assert.Equal(t, protocol.EventTypeThinking, events[0].Type)
-	assert.Equal(t, protocol.EventTypeAction, events[1].Type)
-	assert.Equal(t, protocol.EventTypeComplete, events[2].Type)
-}
-
-// TestCollectEventsWithCancel tests that event collection stops on context cancellation
-func TestCollectEventsWithCancel(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-
-	// Create event channel that won't be closed
-	eventCh := make(chan *protocol.Event, 3) // Buffered channel to prevent blocking
-	
-	// Send a couple of events
-	eventCh <- protocol.NewEvent(protocol.EventTypeThinking, "test-agent", 1)
-	eventCh <- protocol.NewEvent(protocol.EventTypeAction, "test-agent", 2)
-	
-	// Cancel in a goroutine after a short delay
-	go func() {
-		time.Sleep(50 * time.Millisecond) // Shorter delay
-		cancel()
-	}()
-	
-	// Collect events (should return when context is cancelled)
-	events := collectEvents(ctx, "test-agent", eventCh)
-	
-	// Check results
-	assert.Len(t, events, 2, "Should collect events until cancellation")
-	
-	// Explicitly close the channel to clean up
-	close(eventCh)
-}
-
-// TestRunWithInvalidConfig tests error handling for invalid configuration
-func TestRunWithInvalidConfig(t *testing.T) {
-	// Skip this test completely too, as it may cause hangs
-	t.Skip("Skipping test that may cause hangs")
-	
-	// Create an invalid configuration with non-existent directory
-	tempDir := filepath.Join(os.TempDir(), "non-existent-directory-"+ time.Now().Format("20060102150405"))
-	cfg := &core.Config{
-		WorkingDir:     tempDir,
-		TestCommand:    "echo 'All tests passed'",
-		TimeoutSeconds: 1, // Short timeout
-		Agents:         []core.AgentConfig{},
-	}
-	
-	// Create a context with short timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-	
-	// Run should return an error (no agents configured)
-	err := run(ctx, cfg)
-	assert.Error(t, err, "Run should return an error with invalid configuration")
-}
\ No newline at end of file
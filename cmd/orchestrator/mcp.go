@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mcpProtocolVersions are the Model Context Protocol revisions the server speaks, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// maxMCPWait bounds how long a tool call waits for a run, so clients with request timeouts can poll instead
+const maxMCPWait = 10 * time.Minute
+
+// JSON-RPC error codes used by the MCP server
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+)
+
+// mcpCommand serves the orchestrator to MCP clients, such as IDE assistants, over stdin and stdout
+// Clients start runs and read their results with tools; runs are executed as `serve` executes them
+// It returns the process exit code
+func mcpCommand(args []string) int {
+	fs := newRunFlags()
+	fs.Init("mcp", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 1, "Number of tasks to run at the same time; later tasks wait in a queue")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator mcp [flags]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := checkServerFlags("mcp"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+
+	watcher, err := newServerWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Stdout carries the protocol, so anything a run prints goes to stderr instead
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	go watchServerConfig(ctx, watcher)
+	startSharedRuns(watcher.Current())
+
+	srv := newServer(ctx, watcher, *concurrency)
+	err = newMCPServer(srv).serve(ctx, os.Stdin, out)
+
+	// The client closing stdin ends the session, and its runs with it
+	cancel()
+	srv.wait()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// mcpServer answers MCP requests with a server's runs
+type mcpServer struct {
+	srv *server
+
+	// mutex serializes responses, which are written as requests finish
+	mutex sync.Mutex
+	out   *json.Encoder
+}
+
+// newMCPServer creates an MCP server that runs tasks on srv
+func newMCPServer(srv *server) *mcpServer {
+	return &mcpServer{srv: srv}
+}
+
+// jsonrpcMessage is a JSON-RPC request or notification; notifications have no ID
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// jsonrpcResponse answers a request with a result or an error
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+// jsonrpcError is a failed request
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *jsonrpcError) Error() string {
+	return e.Message
+}
+
+// serve reads newline-delimited JSON-RPC messages from in until it ends, writing responses to out
+// Requests are handled concurrently, so a tool waiting for a run doesn't hold up the others
+func (m *mcpServer) serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	m.out = json.NewEncoder(out)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxWebhookBytes)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			m.respond(json.RawMessage("null"), nil, &jsonrpcError{Code: jsonrpcParseError, Message: "invalid JSON: " + err.Error()})
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := m.handle(ctx, msg.Method, msg.Params)
+			if msg.ID == nil {
+				return
+			}
+			var rpcErr *jsonrpcError
+			if err != nil && !errors.As(err, &rpcErr) {
+				rpcErr = &jsonrpcError{Code: jsonrpcInvalidParams, Message: err.Error()}
+			}
+			m.respond(msg.ID, result, rpcErr)
+		}()
+	}
+	return scanner.Err()
+}
+
+// respond writes a response to a request
+func (m *mcpServer) respond(id json.RawMessage, result interface{}, err *jsonrpcError) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	response := jsonrpcResponse{JSONRPC: "2.0", ID: id, Result: result, Error: err}
+	if err == nil && result == nil {
+		response.Result = struct{}{}
+	}
+	if encodeErr := m.out.Encode(response); encodeErr != nil {
+		slog.Warn("failed to write MCP response", "error", encodeErr)
+	}
+}
+
+// handle answers one request; notifications, such as notifications/initialized, need no answer
+func (m *mcpServer) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		var init struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(params, &init)
+		protocolVersion := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, init.ProtocolVersion) {
+			protocolVersion = init.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": protocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "orchestrator", "version": version},
+			"instructions":    "Runs coding agents in parallel on a task and returns the best patch. Start a run with run_task, then poll get_run_status until it has finished and read the result with get_patch.",
+		}, nil
+	case "ping":
+		return nil, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": mcpTools}, nil
+	case "tools/call":
+		var call struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &call); err != nil {
+			return nil, fmt.Errorf("invalid tool call: %w", err)
+		}
+		return m.callTool(ctx, call.Name, call.Arguments)
+	default:
+		if strings.HasPrefix(method, "notifications/") {
+			return nil, nil
+		}
+		return nil, &jsonrpcError{Code: jsonrpcMethodNotFound, Message: fmt.Sprintf("method %q not found", method)}
+	}
+}
+
+// mcpTool describes a tool to clients
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// mcpSchema builds a JSON schema for an object with the given properties
+func mcpSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// mcpStringList is the schema of a list of strings
+func mcpStringList(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}, "description": description}
+}
+
+// Schemas of arguments shared by several tools
+var (
+	mcpRunID = map[string]string{"type": "string", "description": "ID of the run, as returned by run_task"}
+	mcpWait  = map[string]string{"type": "integer", "description": "Seconds to wait for the run to finish before returning (at most 600)"}
+)
+
+// mcpTools are the tools the server offers
+var mcpTools = []mcpTool{
+	{
+		Name:        "run_task",
+		Description: "Start a run in which several coding agents each attempt a task in their own worktree. Their patches are tested and ranked. Returns the queued run; poll get_run_status for its progress.",
+		InputSchema: mcpSchema(map[string]interface{}{
+			"prompt":       map[string]string{"type": "string", "description": "The task for the agents, e.g. a bug to fix"},
+			"repo":         map[string]string{"type": "string", "description": "URL of a repository to clone and work in, instead of the server's repository"},
+			"base_ref":     map[string]string{"type": "string", "description": "Git ref the agents start from (defaults to HEAD)"},
+			"agents":       mcpStringList("IDs of the agents to run, instead of the server's default"),
+			"tags":         mcpStringList("Run only agents with at least one of these tags"),
+			"priority":     map[string]string{"type": "integer", "description": "Queued runs of a higher priority start first (defaults to 0)"},
+			"wait_seconds": mcpWait,
+		}, "prompt"),
+	},
+	{
+		Name:        "get_run_status",
+		Description: "Get a run's state, each agent's progress, and once it has finished, the score and reason of every patch.",
+		InputSchema: mcpSchema(map[string]interface{}{"run_id": mcpRunID, "wait_seconds": mcpWait}, "run_id"),
+	},
+	{
+		Name:        "get_patch",
+		Description: "Get the winning patch of a finished run as a unified diff, or the patch of one agent.",
+		InputSchema: mcpSchema(map[string]interface{}{
+			"run_id": mcpRunID,
+			"agent":  map[string]string{"type": "string", "description": "ID of the agent whose patch to get (defaults to the winning patch)"},
+		}, "run_id"),
+	},
+	{
+		Name:        "list_runs",
+		Description: "List the runs started in this session with their states.",
+		InputSchema: mcpSchema(map[string]interface{}{}),
+	},
+	{
+		Name:        "cancel_run",
+		Description: "Cancel a queued or running run.",
+		InputSchema: mcpSchema(map[string]interface{}{"run_id": mcpRunID}, "run_id"),
+	},
+}
+
+// mcpToolArgs are the arguments of every tool; each uses some of them
+type mcpToolArgs struct {
+	submitRequest
+	RunID       string `json:"run_id"`
+	Agent       string `json:"agent"`
+	WaitSeconds int    `json:"wait_seconds"`
+}
+
+// callTool runs a tool, returning its output as text content
+// Failures the model can act on, such as an unknown run, are results marked as errors rather than protocol errors
+func (m *mcpServer) callTool(ctx context.Context, name string, arguments json.RawMessage) (interface{}, error) {
+	var args mcpToolArgs
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments for %s: %w", name, err)
+		}
+	}
+
+	text, err := m.runTool(ctx, name, args)
+	if errors.As(err, new(*jsonrpcError)) {
+		return nil, err
+	}
+	if err != nil {
+		text = err.Error()
+	}
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+		"isError": err != nil,
+	}, nil
+}
+
+// runTool runs a tool with its arguments
+func (m *mcpServer) runTool(ctx context.Context, name string, args mcpToolArgs) (string, error) {
+	switch name {
+	case "run_task":
+		r, err := m.srv.submit(args.submitRequest)
+		if err != nil {
+			return "", err
+		}
+		return m.status(ctx, r, args.WaitSeconds)
+	case "get_run_status":
+		r, ok := m.srv.find(args.RunID)
+		if !ok {
+			return "", fmt.Errorf("run %q not found", args.RunID)
+		}
+		return m.status(ctx, r, args.WaitSeconds)
+	case "get_patch":
+		if r, ok := m.srv.find(args.RunID); ok && !r.isFinished() {
+			return "", fmt.Errorf("run %s has not finished; wait for it with get_run_status", r.id)
+		}
+		return m.srv.patch(args.RunID, args.Agent)
+	case "list_runs":
+		m.srv.mutex.Lock()
+		views := make([]runView, 0, len(m.srv.order))
+		for _, id := range m.srv.order {
+			views = append(views, m.srv.runs[id].view())
+		}
+		m.srv.mutex.Unlock()
+		return mcpJSON(views)
+	case "cancel_run":
+		r, ok := m.srv.find(args.RunID)
+		if !ok {
+			return "", fmt.Errorf("run %q not found", args.RunID)
+		}
+		if r.isFinished() {
+			return "", fmt.Errorf("run %s has already finished", r.id)
+		}
+		r.cancel()
+		return mcpJSON(r.view())
+	default:
+		return "", &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("unknown tool %q", name)}
+	}
+}
+
+// status waits up to waitSeconds for a run to finish and describes it
+func (m *mcpServer) status(ctx context.Context, r *serverRun, waitSeconds int) (string, error) {
+	if waitSeconds > 0 {
+		wait := min(time.Duration(waitSeconds)*time.Second, maxMCPWait)
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-r.done:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return mcpJSON(r.view())
+}
+
+// mcpJSON formats a tool's result as indented JSON
+func mcpJSON(value interface{}) (string, error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mcpClient talks to an MCP server over pipes, one request at a time
+type mcpClient struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *json.Decoder
+	nextID int
+}
+
+// call sends a request and returns its response
+func (c *mcpClient) call(method string, params interface{}) jsonrpcResponse {
+	c.nextID++
+	request, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	require.NoError(c.t, err)
+	_, err = c.in.Write(append(request, '\n'))
+	require.NoError(c.t, err)
+
+	var response jsonrpcResponse
+	require.NoError(c.t, c.out.Decode(&response))
+	require.Equal(c.t, fmt.Sprint(c.nextID), string(response.ID))
+	return response
+}
+
+// tool calls a tool and returns its text and whether it failed
+func (c *mcpClient) tool(name string, arguments map[string]interface{}) (string, bool) {
+	response := c.call("tools/call", map[string]interface{}{"name": name, "arguments": arguments})
+	require.Nil(c.t, response.Error)
+	result := response.Result.(map[string]interface{})
+	content := result["content"].([]interface{})[0].(map[string]interface{})
+	return content["text"].(string), result["isError"].(bool)
+}
+
+func TestMCPServer(t *testing.T) {
+	srv, _ := newTestServer(t, func(_ context.Context, cfg *core.Config, task core.Task, runID string, _ engine.Progress) (*core.TaskResult, error) {
+		best := &core.PatchResult{AgentID: "codex", Diff: testPatch, Score: 150, Reason: "Tests now passing"}
+		_, err := core.ExportPatches(filepath.Join(cfg.ArtifactsDir, runID), map[string]*core.PatchDetails{"codex": {Diff: testPatch}}, best)
+		require.NoError(t, err)
+		return &core.TaskResult{Task: task, RunID: runID, Best: best, Candidates: []*core.PatchResult{best}}, nil
+	})
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- newMCPServer(srv).serve(context.Background(), inReader, outWriter) }()
+	client := &mcpClient{t: t, in: inWriter, out: json.NewDecoder(outReader)}
+
+	response := client.call("initialize", map[string]interface{}{"protocolVersion": "2025-03-26", "capabilities": map[string]interface{}{}})
+	init := response.Result.(map[string]interface{})
+	assert.Equal(t, "2025-03-26", init["protocolVersion"])
+	assert.Equal(t, "orchestrator", init["serverInfo"].(map[string]interface{})["name"])
+
+	// Notifications get no response, so the next response is the ping's
+	_, err := inWriter.Write([]byte(`{"jsonrpc": "2.0", "method": "notifications/initialized"}` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, client.call("ping", nil).Result)
+
+	tools := client.call("tools/list", nil).Result.(map[string]interface{})["tools"].([]interface{})
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.(map[string]interface{})["name"].(string))
+	}
+	assert.Equal(t, []string{"run_task", "get_run_status", "get_patch", "list_runs", "cancel_run"}, names)
+
+	// A run started with a wait returns once it has finished
+	text, failed := client.tool("run_task", map[string]interface{}{"prompt": "Fix the bug", "agents": []string{"codex"}, "wait_seconds": 10})
+	require.False(t, failed, text)
+	var view runView
+	require.NoError(t, json.Unmarshal([]byte(text), &view))
+	assert.Equal(t, runSucceeded, view.Status)
+	assert.Equal(t, "Fix the bug", view.Task.Prompt)
+
+	text, failed = client.tool("get_run_status", map[string]interface{}{"run_id": view.ID})
+	require.False(t, failed, text)
+	assert.Contains(t, text, `"status": "succeeded"`)
+
+	text, failed = client.tool("get_patch", map[string]interface{}{"run_id": view.ID})
+	require.False(t, failed, text)
+	assert.Equal(t, testPatch, text)
+
+	// Mistakes the model can correct are reported as failed tool results
+	text, failed = client.tool("get_patch", map[string]interface{}{"run_id": view.ID, "agent": "claude"})
+	assert.True(t, failed)
+	assert.Contains(t, text, "no such patch")
+	text, failed = client.tool("run_task", map[string]interface{}{"prompt": " "})
+	assert.True(t, failed)
+	assert.Equal(t, "prompt is required", text)
+	_, failed = client.tool("cancel_run", map[string]interface{}{"run_id": view.ID})
+	assert.True(t, failed, "A finished run can't be cancelled")
+
+	response = client.call("tools/call", map[string]interface{}{"name": "delete_repo"})
+	require.NotNil(t, response.Error)
+	assert.Equal(t, jsonrpcInvalidParams, response.Error.Code)
+	response = client.call("resources/list", nil)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, jsonrpcMethodNotFound, response.Error.Code)
+
+	// Closing stdin ends the session
+	require.NoError(t, inWriter.Close())
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/notify"
+)
+
+// notifyRun announces the outcome of a run, if notifications are configured
+// Dry runs have nothing to announce
+func notifyRun(ctx context.Context, cfg *core.Config, runID string, result *core.TaskResult, err error) {
+	if !cfg.Notify.Enabled() || (result == nil && err == nil) {
+		return
+	}
+
+	n := runNotification(runID, result, err)
+	if report := filepath.Join(cfg.ArtifactsDir, runID, core.ReportFile); fileExists(report) {
+		n.ReportPath = report
+	}
+	sendNotification(ctx, cfg, n)
+}
+
+// runNotification summarizes a run in one line
+func runNotification(runID string, result *core.TaskResult, err error) notify.Notification {
+	n := notify.Notification{RunID: runID}
+	switch {
+	case err != nil:
+		n.Title = "Orchestrator run failed"
+		n.Summary = fmt.Sprintf("Run %s failed: %v", runID, err)
+	case result.Solved():
+		n.Title = "Orchestrator run solved"
+		n.Summary = fmt.Sprintf("Run %s solved by %s, scoring %d (%s)", runID, result.Best.AgentID, result.Best.Score, result.Best.Reason)
+		n.Success = true
+	case result.Best != nil:
+		n.Title = "Orchestrator run unsolved"
+		n.Summary = fmt.Sprintf("Run %s finished unsolved; the best patch from %s scored %d (%s)", runID, result.Best.AgentID, result.Best.Score, result.Best.Reason)
+	default:
+		n.Title = "Orchestrator run unsolved"
+		n.Summary = fmt.Sprintf("Run %s finished without a patch", runID)
+	}
+	return n
+}
+
+// notifyBatch announces the outcome of a batch, pointing at its report if one was written
+func notifyBatch(ctx context.Context, cfg *core.Config, results []*core.TaskResult, reportPath string) {
+	if !cfg.Notify.Enabled() {
+		return
+	}
+
+	n := batchNotification(results)
+	if reportPath != "" {
+		if abs, err := filepath.Abs(reportPath); err == nil {
+			n.ReportPath = abs
+		}
+	}
+	sendNotification(ctx, cfg, n)
+}
+
+// batchNotification summarizes a batch in one line
+func batchNotification(results []*core.TaskResult) notify.Notification {
+	solved, failed := 0, 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		} else if result.Solved() {
+			solved++
+		}
+	}
+
+	n := notify.Notification{
+		Title:   "Orchestrator batch finished",
+		Summary: fmt.Sprintf("Batch finished: %d tasks, %d solved, %d unsolved, %d errors", len(results), solved, len(results)-solved-failed, failed),
+		Success: solved == len(results),
+	}
+	if failed > 0 {
+		n.Title = "Orchestrator batch failed"
+	}
+	return n
+}
+
+// sendNotification delivers a notification, logging rather than failing if it can't be sent
+// It still runs after Ctrl-C, since an interrupted run is worth announcing too
+func sendNotification(ctx context.Context, cfg *core.Config, n notify.Notification) {
+	n.Summary = cfg.Redact(n.Summary)
+	if err := notify.Send(context.WithoutCancel(ctx), cfg.Notify, n); err != nil {
+		slog.Warn("failed to send notification", "error", err)
+	}
+}
+
+// fileExists reports whether a regular file exists at path
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
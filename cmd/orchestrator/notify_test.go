@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunNotification(t *testing.T) {
+	best := &core.PatchResult{AgentID: "claude", Score: 170, Reason: "Tests now passing", Diff: "+fix\n", TestResults: &core.TestResult{Success: true}}
+
+	n := runNotification("run-1", &core.TaskResult{Best: best}, nil)
+	assert.True(t, n.Success)
+	assert.Equal(t, "Orchestrator run solved", n.Title)
+	assert.Equal(t, "Run run-1 solved by claude, scoring 170 (Tests now passing)", n.Summary)
+
+	best.TestResults = &core.TestResult{Success: false}
+	best.Reason = "Tests still failing"
+	n = runNotification("run-1", &core.TaskResult{Best: best}, nil)
+	assert.False(t, n.Success)
+	assert.Equal(t, "Run run-1 finished unsolved; the best patch from claude scored 170 (Tests still failing)", n.Summary)
+
+	n = runNotification("run-1", nil, errors.New("no agents"))
+	assert.False(t, n.Success)
+	assert.Equal(t, "Orchestrator run failed", n.Title)
+	assert.Equal(t, "Run run-1 failed: no agents", n.Summary)
+}
+
+func TestBatchNotification(t *testing.T) {
+	solved := &core.TaskResult{Best: &core.PatchResult{AgentID: "claude", Diff: "+fix\n", TestResults: &core.TestResult{Success: true}}}
+	n := batchNotification([]*core.TaskResult{solved, {}, {Err: errors.New("timeout")}})
+	assert.False(t, n.Success)
+	assert.Equal(t, "Orchestrator batch failed", n.Title)
+	assert.Equal(t, "Batch finished: 3 tasks, 1 solved, 1 unsolved, 1 errors", n.Summary)
+
+	assert.True(t, batchNotification([]*core.TaskResult{solved}).Success)
+}
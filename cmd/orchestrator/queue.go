@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/github"
+)
+
+// queueFileName is the file in the artifacts directory where serve keeps the tasks it has yet to finish
+const queueFileName = "queue.json"
+
+// errQueueFull rejects a task when as many runs are queued as the server allows
+var errQueueFull = errors.New("the queue is full; try again later")
+
+// taskKey identifies what a run would do, so an identical task submitted while one is queued joins it
+func taskKey(prompt, repo, baseRef string, agentIDs []string) string {
+	return strings.Join([]string{strings.TrimSpace(prompt), repo, baseRef, strings.Join(agentIDs, ",")}, "\x00")
+}
+
+// enqueue adds a run to the queue behind every run of the same or a higher priority
+// The caller holds s.mutex
+func (s *server) enqueue(r *serverRun) {
+	i := len(s.queued)
+	for i > 0 && s.queued[i-1].priority < r.priority {
+		i--
+	}
+	s.queued = append(s.queued, nil)
+	copy(s.queued[i+1:], s.queued[i:])
+	s.queued[i] = r
+}
+
+// dequeue removes a run from the queue, reporting whether it was still waiting there
+// The caller holds s.mutex
+func (s *server) dequeue(r *serverRun) bool {
+	for i, queued := range s.queued {
+		if queued == r {
+			s.queued = append(s.queued[:i], s.queued[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// queuedDuplicate returns the queued run of an identical task, or nil if there is none
+// The caller holds s.mutex
+func (s *server) queuedDuplicate(key string) *serverRun {
+	for _, r := range s.queued {
+		if r.key == key {
+			return r
+		}
+	}
+	return nil
+}
+
+// dispatch starts the highest-priority queued runs while slots are free
+// The caller holds s.mutex
+func (s *server) dispatch() {
+	for s.running < s.concurrency && len(s.queued) > 0 {
+		r := s.queued[0]
+		s.queued = s.queued[1:]
+		s.running++
+		close(r.turn)
+	}
+}
+
+// queueEntry is a task kept in the queue file, with where a webhook run reports its outcome
+type queueEntry struct {
+	submitRequest
+	Issue  *queuedIssue  `json:"issue,omitempty"`
+	Commit *queuedCommit `json:"commit,omitempty"`
+}
+
+// queuedIssue is the GitHub issue a kept webhook task is commented on
+type queuedIssue struct {
+	Ref   github.IssueRef `json:"ref"`
+	Issue *github.Issue   `json:"issue"`
+}
+
+// queuedCommit is the pull request head a kept webhook task sets a status on
+type queuedCommit struct {
+	Host      string `json:"host"`
+	Owner     string `json:"owner"`
+	Repo      string `json:"repo"`
+	SHA       string `json:"sha"`
+	ServerURL string `json:"server_url"`
+}
+
+// newQueueEntry records the request a run was submitted with
+func newQueueEntry(req submitRequest) queueEntry {
+	entry := queueEntry{submitRequest: req}
+	if req.issue != nil {
+		entry.Issue = &queuedIssue{Ref: req.issue.ref, Issue: req.issue.issue}
+	}
+	if c := req.commit; c != nil {
+		entry.Commit = &queuedCommit{Host: c.host, Owner: c.owner, Repo: c.repo, SHA: c.sha, ServerURL: c.serverURL}
+	}
+	return entry
+}
+
+// request returns the request to submit the kept task with again
+func (e queueEntry) request() submitRequest {
+	req := e.submitRequest
+	if e.Issue != nil {
+		req.issue = &issueSource{ref: e.Issue.Ref, issue: e.Issue.Issue}
+	}
+	if c := e.Commit; c != nil {
+		req.commit = &commitTarget{host: c.Host, owner: c.Owner, repo: c.Repo, sha: c.SHA, serverURL: c.ServerURL}
+	}
+	return req
+}
+
+// saveQueue writes the tasks the server has yet to finish, running ones first, to its queue file
+// Once the server is shutting down the file is left as it was, so the runs it cancels are picked up again
+// The caller holds s.mutex
+func (s *server) saveQueue() {
+	if s.queueFile == "" || s.ctx.Err() != nil {
+		return
+	}
+
+	entries := []queueEntry{}
+	for _, id := range s.order {
+		if r := s.runs[id]; r.state() == runRunning {
+			entries = append(entries, r.entry)
+		}
+	}
+	for _, r := range s.queued {
+		entries = append(entries, r.entry)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.queueFile), 0755)
+	}
+	if err == nil {
+		// Renaming a complete file into place means a crash never leaves half a queue behind
+		tmp := s.queueFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, s.queueFile)
+		}
+	}
+	if err != nil {
+		slog.Warn("failed to save the task queue", "path", s.queueFile, "error", err)
+	}
+}
+
+// restoreQueue keeps the server's unfinished tasks in file, first queueing the tasks an earlier server left there
+// Tasks that no longer pass submission, such as ones naming an agent that was removed, are dropped with a warning
+func (s *server) restoreQueue(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read the task queue: %w", err)
+	}
+
+	var entries []queueEntry
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("failed to read the task queue %s: %w", file, err)
+		}
+	}
+
+	for _, entry := range entries {
+		r, err := s.queueTask(entry.request(), 0)
+		if err != nil {
+			slog.Warn("dropping queued task", "prompt", entry.Prompt, "error", err)
+			continue
+		}
+		slog.Info("restored queued task", "run", r.id, "priority", entry.Priority)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queueFile = file
+	s.saveQueue()
+	return nil
+}
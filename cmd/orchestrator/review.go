@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/github"
+)
+
+// reviewPullRequest posts the review notes of a run's winning patch as a review of a pull request, printing its URL
+// Notes on a line become comments on it; GitHub rejects a review commenting on lines the pull request doesn't
+// change, so it is then posted again with every note in its body
+func reviewPullRequest(ctx context.Context, client *github.Client, cfg *core.Config, ref github.IssueRef, runID, best string, notes []core.ReviewNote) error {
+	if len(notes) == 0 {
+		fmt.Printf("The patch from %s has no review notes to post on %s\n", best, ref)
+		return nil
+	}
+
+	var fileNotes []core.ReviewNote
+	var comments []github.ReviewComment
+	for _, note := range notes {
+		if note.Line == 0 {
+			fileNotes = append(fileNotes, note)
+			continue
+		}
+		comments = append(comments, github.ReviewComment{Path: note.File, Line: note.Line, Side: "RIGHT", Body: cfg.Redact(fmt.Sprintf("**%s**: %s", note.Kind, note.Message))})
+	}
+
+	url, err := client.CreateReview(ctx, ref, cfg.Redact(reviewBody(runID, best, fileNotes)), comments)
+	if err != nil && len(comments) > 0 {
+		url, err = client.CreateReview(ctx, ref, cfg.Redact(reviewBody(runID, best, notes)), nil)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reviewed %s: %s\n", ref, url)
+	audit.Record(ctx, audit.PullReviewed, "pull_request", ref.String(), "url", url, "notes", fmt.Sprint(len(notes)))
+	return nil
+}
+
+// reviewBody introduces a review of the winning patch, listing the notes that aren't comments on a line
+func reviewBody(runID, best string, notes []core.ReviewNote) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Review notes on the patch from `%s`, selected by orchestrator run `%s`.\n", best, runID)
+	if len(notes) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(core.ReviewNotesMarkdown(notes))
+	}
+	return sb.String()
+}
+
+// postReviewNotes posts the review notes from a finished run's report on a pull request
+// Without a configuration the notes are posted as the report has them, which was redacted when it was written
+func postReviewNotes(path, format, runDir, pullRequest string) int {
+	ref, err := github.ParseIssueRef(pullRequest)
+	if err != nil {
+		fmt.Printf("Error: invalid --review-pr: %v\n", err)
+		return 1
+	}
+	report, err := core.ReadReport(runDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if report.Best == "" {
+		fmt.Printf("Error: run %s selected no patch to review\n", report.RunID)
+		return 1
+	}
+	cfg, err := core.LoadWithFormat(path, core.ConfigFormat(format))
+	if err != nil {
+		cfg = &core.Config{}
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	ctx = audit.WithRun(ctx, engine.NewAuditLog(cfg), report.RunID)
+	client := github.NewClient(ref.Host, github.TokenFromEnv())
+	if err := reviewPullRequest(ctx, client, cfg, ref, report.RunID, report.Best, report.ReviewNotes); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReviewPullRequest(t *testing.T) {
+	type review struct {
+		Body     string                 `json:"body"`
+		Comments []github.ReviewComment `json:"comments"`
+	}
+	var reviews []review
+	rejectComments := false
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var posted review
+		_ = json.NewDecoder(r.Body).Decode(&posted)
+		reviews = append(reviews, posted)
+		if rejectComments && len(posted.Comments) > 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message": "Line could not be resolved"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"html_url": "https://github.com/org/repo/pull/7#pullrequestreview-%d"}`, len(reviews))
+	}))
+	defer api.Close()
+	client := github.NewClient("github.com", "ghp_test")
+	client.BaseURL = api.URL
+	ref := github.IssueRef{Host: "github.com", Owner: "org", Repo: "repo", Number: 7}
+	notes := []core.ReviewNote{
+		{Kind: core.ReviewNoteRisky, File: "pkg/old.go", Message: "deletes the file"},
+		{Kind: core.ReviewNoteTODO, File: "pkg/cache.go", Line: 12, Message: "leaves `// TODO: handle eviction`"},
+	}
+
+	// Notes on a line are comments on it, and the rest are in the review's body
+	require.NoError(t, reviewPullRequest(context.Background(), client, &core.Config{}, ref, "run-1", "claude", notes))
+	require.Len(t, reviews, 1)
+	assert.Contains(t, reviews[0].Body, "patch from `claude`, selected by orchestrator run `run-1`")
+	assert.Contains(t, reviews[0].Body, "- **risky** `pkg/old.go`: deletes the file\n")
+	assert.Equal(t, []github.ReviewComment{{Path: "pkg/cache.go", Line: 12, Side: "RIGHT", Body: "**todo**: leaves `// TODO: handle eviction`"}}, reviews[0].Comments)
+
+	// A review GitHub rejects for commenting on lines the pull request doesn't change is posted with every note in its body
+	reviews, rejectComments = nil, true
+	require.NoError(t, reviewPullRequest(context.Background(), client, &core.Config{}, ref, "run-1", "claude", notes))
+	require.Len(t, reviews, 2)
+	assert.Empty(t, reviews[1].Comments)
+	assert.Contains(t, reviews[1].Body, "- **todo** `pkg/cache.go:12`: leaves `// TODO: handle eviction`\n")
+
+	// Without notes there is nothing to post
+	reviews = nil
+	require.NoError(t, reviewPullRequest(context.Background(), client, &core.Config{}, ref, "run-1", "claude", nil))
+	assert.Empty(t, reviews)
+}
@@ -0,0 +1,1109 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/github"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+const (
+	// configCheckInterval is how often the server checks its configuration file for changes
+	configCheckInterval = 2 * time.Second
+
+	// shutdownTimeout bounds how long the server waits for open requests when it stops
+	shutdownTimeout = 10 * time.Second
+
+	// subscriberBuffer is how many events a slow event stream may fall behind before it is disconnected
+	subscriberBuffer = 256
+
+	// eventHistory is how many of a run's latest events are replayed to event streams opened while it runs
+	// Older events are in the run's transcripts
+	eventHistory = 1000
+)
+
+// Run states reported by the server
+const (
+	runQueued    = "queued"
+	runRunning   = "running"
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+	runCancelled = "cancelled"
+
+	// runArchived is the state of runs from before the server started, known only by their exported patches
+	runArchived = "archived"
+)
+
+// serveCommand runs the orchestrator as a daemon that accepts tasks over HTTP
+// It returns the process exit code
+func serveCommand(args []string) int {
+	fs := newRunFlags()
+	fs.Init("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8420", "Address to listen on")
+	concurrency := fs.Int("concurrency", 1, "Number of tasks to run at the same time; later tasks wait in a queue")
+	maxQueued := fs.Int("max-queued", 0, "Number of tasks that may wait in the queue before more are turned away (0 for no limit)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator serve [flags]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if err := checkServerFlags("serve"); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+
+	watcher, err := newServerWatcher()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	go watchServerConfig(ctx, watcher)
+
+	startSharedRuns(watcher.Current())
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	srv := newServer(ctx, watcher, *concurrency)
+	srv.queueLimit = max(0, *maxQueued)
+	if err := srv.restoreQueue(filepath.Join(watcher.Current().ArtifactsDir, queueFileName)); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		cancel()
+		srv.wait()
+		return 1
+	}
+	httpServer := &http.Server{Handler: srv.handler()}
+	slog.Info("listening", "url", "http://"+listener.Addr().String())
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- httpServer.Serve(listener) }()
+
+	select {
+	case err := <-serveErr:
+		fmt.Printf("Error: %v\n", err)
+		cancel()
+		srv.wait()
+		return 1
+	case <-ctx.Done():
+	}
+
+	// Runs were cancelled with ctx; let their event streams end before closing connections
+	srv.wait()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Error shutting down: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// checkServerFlags rejects run flags that don't apply to a command whose tasks come from requests
+// Such a server never touches the user's checkout or terminal
+func checkServerFlags(command string) error {
+	for _, conflict := range []struct {
+		set  bool
+		flag string
+	}{
+		{prompt != "", "--prompt"},
+		{issue != "", "--issue"},
+		{apply, "--apply"},
+		{tuiMode, "--tui"},
+		{dryRunOnly, "--dry-run"},
+		{commitStatus, "--commit-status"},
+		{autoDiscover, "--auto-discover"},
+	} {
+		if conflict.set {
+			return fmt.Errorf("%s cannot be used with %s", conflict.flag, command)
+		}
+	}
+	return nil
+}
+
+// newServerWatcher loads the configuration a server keeps, rejecting reloads that select agents it can't create
+func newServerWatcher() (*core.ConfigWatcher, error) {
+	registry := adapter.NewRegistry()
+	engine.RegisterAdapters(registry)
+
+	watcher, err := core.NewConfigWatcher(configPath, core.ConfigFormat(configFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// A reloaded configuration must still select agents the server can create
+	validate := func(cfg *core.Config) error {
+		narrowed := *cfg
+		if err := narrowConfig(&narrowed, profile, splitList(agentIDs), splitList(agentTags)); err != nil {
+			return err
+		}
+		return registry.Validate(&narrowed)
+	}
+	if err := validate(watcher.Current()); err != nil {
+		return nil, err
+	}
+	watcher.SetValidator(validate)
+	return watcher, nil
+}
+
+// watchServerConfig reloads a server's configuration when its file changes, until ctx is cancelled
+func watchServerConfig(ctx context.Context, watcher *core.ConfigWatcher) {
+	watcher.Watch(ctx, configCheckInterval, func(_ *core.Config, err error) {
+		if err != nil {
+			slog.Warn("keeping the previous configuration", "error", err)
+			return
+		}
+		slog.Info("reloaded configuration", "path", configPath)
+	})
+}
+
+// server runs tasks submitted over HTTP, keeping the configuration loaded between tasks
+type server struct {
+	// ctx is cancelled when the server shuts down, which cancels every run
+	ctx     context.Context
+	watcher *core.ConfigWatcher
+
+	wg sync.WaitGroup
+
+	// runTask runs one task; it is run outside of tests
+	runTask func(ctx context.Context, cfg *core.Config, task core.Task, runID string, progress engine.Progress) (*core.TaskResult, error)
+
+	// githubClient returns a client for a GitHub host, for webhook runs that read pull requests and comment on issues
+	githubClient func(host string) *github.Client
+
+	mutex sync.Mutex
+	runs  map[string]*serverRun
+	order []string
+
+	// queued are the runs waiting for a slot, highest priority first; running is how many of the concurrency slots are taken
+	queued      []*serverRun
+	concurrency int
+	running     int
+
+	// queueLimit is how many runs may be queued at once (0 for no limit)
+	queueLimit int
+
+	// queueFile keeps the tasks the server has yet to finish, so a restarted server runs them ("" to keep them in memory only)
+	queueFile string
+}
+
+// newServer creates a server that runs up to concurrency tasks at once
+func newServer(ctx context.Context, watcher *core.ConfigWatcher, concurrency int) *server {
+	return &server{
+		ctx:         ctx,
+		watcher:     watcher,
+		concurrency: concurrency,
+		runTask:     run,
+		githubClient: func(host string) *github.Client {
+			return github.NewClient(host, github.TokenFromEnv())
+		},
+		runs: make(map[string]*serverRun),
+	}
+}
+
+// handler routes the server's HTTP API
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleDashboard)
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /history", s.guardAPI(s.handleHistory))
+	mux.HandleFunc("POST /runs", s.guardAPI(s.handleSubmit))
+	mux.HandleFunc("GET /runs", s.guardAPI(s.handleList))
+	mux.HandleFunc("GET /queue", s.guardAPI(s.handleQueue))
+	mux.HandleFunc("GET /runs/{id}", s.guardAPI(s.handleStatus))
+	mux.HandleFunc("DELETE /runs/{id}", s.guardAPI(s.handleCancel))
+	mux.HandleFunc("GET /runs/{id}/events", s.guardAPI(s.handleEvents))
+	mux.HandleFunc("GET /runs/{id}/patch", s.guardAPI(s.handlePatch))
+	mux.HandleFunc("GET /runs/{id}/patches/{agent}", s.guardAPI(s.handlePatch))
+	mux.HandleFunc("GET /runs/{id}/report", s.guardAPI(s.handleReport))
+	mux.HandleFunc("GET /runs/{id}/report.html", s.guardAPI(s.handleReportPage))
+	mux.HandleFunc("POST /webhooks/github", s.handleGitHubWebhook)
+	mux.HandleFunc("POST /webhooks/gitlab", s.handleGitLabWebhook)
+	mux.HandleFunc("POST /chat/slack", s.handleSlackCommand)
+	mux.HandleFunc("POST /chat/discord", s.handleDiscordInteraction)
+	return mux
+}
+
+// guardAPI wraps a handler of runs, so only the server's own clients can call it
+// Browsers let any site post to a server on localhost, so requests from another origin are rejected. A site can also
+// point its own host name at the server (DNS rebinding), so its pages count as the same origin; without server.token,
+// requests must name a loopback host, and with it, the token is required as a bearer token. EventSource can't send
+// headers, so reads may pass the token as the token query parameter instead
+func (s *server) guardAPI(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if origin := req.Header.Get("Origin"); origin != "" && !sameOrigin(origin, req.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("requests from %s are not allowed", origin))
+			return
+		}
+		token := s.watcher.Current().Server.Token
+		if token == "" && !loopbackHost(req.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("requests for %s need server.token to be set; without it only localhost is served", req.Host))
+			return
+		}
+		if token != "" {
+			got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if !ok && req.Method == http.MethodGet {
+				got = req.URL.Query().Get("token")
+				ok = got != ""
+			}
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("a valid bearer token is required"))
+				return
+			}
+		}
+		handler(w, req)
+	}
+}
+
+// loopbackHost reports whether a request's Host header names this machine's loopback interface
+func loopbackHost(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// sameOrigin reports whether a request's Origin header names the host it was sent to
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, host)
+}
+
+// wait blocks until every submitted run has finished
+func (s *server) wait() {
+	s.wg.Wait()
+}
+
+// submitRequest is the body of a task submission
+type submitRequest struct {
+	// Prompt is the task description given to every agent
+	Prompt string `json:"prompt"`
+
+	// Repo is a repository URL to clone and run the task in, instead of the server's --repo
+	Repo string `json:"repo"`
+
+	// BaseRef is the git ref agents start from (defaults to HEAD)
+	BaseRef string `json:"base_ref"`
+
+	// Labels are recorded with the task
+	Labels []string `json:"labels"`
+
+	// Agents and Tags select the agents to run, replacing the server's --agents and --tags
+	Agents []string `json:"agents"`
+	Tags   []string `json:"tags"`
+
+	// Priority orders the queue: queued tasks of a higher priority run first, and of the same priority in the
+	// order they were submitted
+	Priority int `json:"priority,omitempty"`
+
+	// issue is the GitHub issue a webhook started the task from, which is commented on when it finishes
+	issue *issueSource
+
+	// commit is the pull request head a webhook started the task on, which shows the run's progress as a status
+	commit *commitTarget
+}
+
+// submit queues a task with a snapshot of the current configuration
+// A task identical to one still queued returns that run instead, raised to the task's priority
+func (s *server) submit(req submitRequest) (*serverRun, error) {
+	return s.queueTask(req, s.queueLimit)
+}
+
+// queueTask queues a task unless limit runs (if not 0) are queued already
+func (s *server) queueTask(req submitRequest, limit int) (*serverRun, error) {
+	if strings.TrimSpace(req.Prompt) == "" {
+		return nil, fmt.Errorf("prompt is required")
+	}
+
+	ids, tags := splitList(agentIDs), splitList(agentTags)
+	if len(req.Agents) > 0 || len(req.Tags) > 0 {
+		ids, tags = req.Agents, req.Tags
+	}
+
+	// The watcher's configuration is shared, so each run narrows its own copy
+	cfg := *s.watcher.Current()
+	if err := narrowConfig(&cfg, profile, ids, tags); err != nil {
+		return nil, err
+	}
+
+	key := taskKey(req.Prompt, req.Repo, req.BaseRef, runAgentIDs(&cfg))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r := s.queuedDuplicate(key); r != nil {
+		if req.Priority > r.priority {
+			r.raise(req.Priority)
+			s.dequeue(r)
+			s.enqueue(r)
+			s.saveQueue()
+		}
+		slog.Info("task is already queued", "run", r.id, "priority", r.priority)
+		return r, nil
+	}
+	if limit > 0 && len(s.queued) >= limit {
+		return nil, errQueueFull
+	}
+
+	runID := core.NewRunID()
+	task := core.Task{ID: runID, Prompt: req.Prompt, Repo: req.Repo, BaseRef: req.BaseRef, Labels: req.Labels}
+	ctx, cancel := context.WithCancel(s.ctx)
+	r := newServerRun(runID, task, &cfg, cancel)
+	r.issue = req.issue
+	r.commit = req.commit
+	r.priority = req.Priority
+	r.key = key
+	r.entry = newQueueEntry(req)
+
+	s.runs[runID] = r
+	s.order = append(s.order, runID)
+	s.enqueue(r)
+	s.saveQueue()
+
+	s.wg.Add(1)
+	go s.execute(ctx, r, &cfg)
+	s.dispatch()
+
+	return r, nil
+}
+
+// execute runs a submitted task once it reaches the front of the queue and a slot is free
+func (s *server) execute(ctx context.Context, r *serverRun, cfg *core.Config) {
+	defer s.wg.Done()
+
+	select {
+	case <-r.turn:
+	case <-ctx.Done():
+	}
+	s.mutex.Lock()
+	if s.dequeue(r) {
+		// Cancelled while it waited
+		r.finish(nil, ctx.Err())
+		s.saveQueue()
+		s.mutex.Unlock()
+		return
+	}
+	r.begin()
+	s.saveQueue()
+	s.mutex.Unlock()
+	defer s.release()
+
+	r.begin()
+	s.reportStatus(ctx, r, nil, nil)
+	result, err := s.runTask(ctx, cfg, r.task, r.id, r)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	r.finish(result, err)
+	s.reportStatus(ctx, r, result, err)
+
+	if err != nil {
+		slog.Warn("run failed", "run", r.id, "error", err)
+		return
+	}
+	slog.Info("run finished", "run", r.id)
+	s.reportToIssue(ctx, r, cfg, result)
+}
+
+// release frees a finished run's slot for the next queued run
+func (s *server) release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.running--
+	s.saveQueue()
+	s.dispatch()
+}
+
+// find returns a run submitted to the server by ID
+func (s *server) find(runID string) (*serverRun, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, ok := s.runs[runID]
+	return r, ok
+}
+
+// lookup returns a run by ID, writing a 404 response if it is unknown
+func (s *server) lookup(w http.ResponseWriter, req *http.Request) (*serverRun, bool) {
+	r, ok := s.find(req.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %q not found", req.PathValue("id")))
+	}
+	return r, ok
+}
+
+// runDir returns where a run's patches are exported
+// Runs from before the server started are found in the artifacts directory
+func (s *server) runDir(runID string) (string, bool) {
+	s.mutex.Lock()
+	r, ok := s.runs[runID]
+	s.mutex.Unlock()
+	if ok {
+		return r.runDir, true
+	}
+
+	if runID == "" || runID != filepath.Base(runID) || strings.HasPrefix(runID, ".") {
+		return "", false
+	}
+	dir := filepath.Join(s.watcher.Current().ArtifactsDir, runID)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+// handleHealth reports that the server is up and which agents a task would run by default
+func (s *server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	cfg := *s.watcher.Current()
+	agents := []string{}
+	if err := narrowConfig(&cfg, profile, splitList(agentIDs), splitList(agentTags)); err == nil {
+		for _, agent := range cfg.Agents {
+			agents = append(agents, agent.ID)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "ok",
+		"config":  configPath,
+		"profile": profile,
+		"agents":  agents,
+	})
+}
+
+// handleSubmit queues a task from a JSON submitRequest
+// Only JSON is accepted, since browsers send other content types across origins without asking the server first
+func (s *server) handleSubmit(w http.ResponseWriter, req *http.Request) {
+	if mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("request body must be application/json"))
+		return
+	}
+
+	var body submitRequest
+	decoder := json.NewDecoder(req.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if body.Repo != "" && !s.watcher.Current().Server.AllowsRepo(body.Repo) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("repository %s is not on a host in server.repo_hosts", body.Repo))
+		return
+	}
+	if body.BaseRef != "" {
+		if err := gitutil.ValidateRef(body.BaseRef); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	r, err := s.submit(body)
+	if err != nil {
+		writeError(w, submitErrorStatus(err), err)
+		return
+	}
+
+	w.Header().Set("Location", "/runs/"+r.id)
+	writeJSON(w, http.StatusAccepted, r.view())
+}
+
+// handleList lists every run submitted since the server started, oldest first
+func (s *server) handleList(w http.ResponseWriter, _ *http.Request) {
+	s.mutex.Lock()
+	runs := make([]*serverRun, 0, len(s.order))
+	for _, id := range s.order {
+		runs = append(runs, s.runs[id])
+	}
+	s.mutex.Unlock()
+
+	views := make([]runView, 0, len(runs))
+	for _, r := range runs {
+		views = append(views, r.view())
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleQueue lists the queued runs in the order they will start
+func (s *server) handleQueue(w http.ResponseWriter, _ *http.Request) {
+	s.mutex.Lock()
+	runs := append([]*serverRun{}, s.queued...)
+	s.mutex.Unlock()
+
+	views := make([]runView, 0, len(runs))
+	for _, r := range runs {
+		views = append(views, r.view())
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// submitErrorStatus is the status of a response to a task that wasn't queued
+func submitErrorStatus(err error) int {
+	if errors.Is(err, errQueueFull) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// handleStatus reports a run's state and the progress of its agents
+func (s *server) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if r, ok := s.lookup(w, req); ok {
+		writeJSON(w, http.StatusOK, r.view())
+	}
+}
+
+// handleCancel cancels a queued or running run
+func (s *server) handleCancel(w http.ResponseWriter, req *http.Request) {
+	r, ok := s.lookup(w, req)
+	if !ok {
+		return
+	}
+	if r.isFinished() {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s has already finished", r.id))
+		return
+	}
+
+	r.cancel()
+	writeJSON(w, http.StatusAccepted, r.view())
+}
+
+// handleEvents streams a run's agent events as server-sent events
+// The latest events emitted before the request, up to eventHistory, are replayed first; the stream ends with an "end" event carrying the final run state
+func (s *server) handleEvents(w http.ResponseWriter, req *http.Request) {
+	r, ok := s.lookup(w, req)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	history, events, unsubscribe := r.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range history {
+		writeServerEvent(w, "", event)
+	}
+	flusher.Flush()
+
+	for events != nil {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				break
+			}
+			writeServerEvent(w, "", event)
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	// A closed subscription means the run finished, or this client fell too far behind and should reconnect
+	if r.isFinished() {
+		writeServerEvent(w, "end", r.view())
+		flusher.Flush()
+	}
+}
+
+// handlePatch returns the winning patch of a run, or one agent's patch, as a diff
+func (s *server) handlePatch(w http.ResponseWriter, req *http.Request) {
+	patch, err := s.patch(req.PathValue("id"), req.PathValue("agent"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	_, _ = w.Write([]byte(patch))
+}
+
+// patch returns a run's exported patch from an agent, or its best patch if agentID is empty
+func (s *server) patch(runID, agentID string) (string, error) {
+	runDir, ok := s.runDir(runID)
+	if !ok {
+		return "", fmt.Errorf("run %q not found", runID)
+	}
+
+	patches, best, err := core.ReadPatches(runDir)
+	if err != nil {
+		return "", err
+	}
+
+	patch, found := best, best != ""
+	if agentID != "" {
+		patch, found = patches[agentID]
+	}
+	if !found {
+		return "", fmt.Errorf("no such patch in run %s", runID)
+	}
+	return patch, nil
+}
+
+// patchSummary describes one exported patch in a run report
+type patchSummary struct {
+	AgentID      string `json:"agent_id"`
+	FilesChanged int    `json:"files_changed"`
+	LinesAdded   int    `json:"lines_added"`
+	LinesRemoved int    `json:"lines_removed"`
+	Best         bool   `json:"best"`
+}
+
+// handleReport summarizes a run and the patches it exported
+func (s *server) handleReport(w http.ResponseWriter, req *http.Request) {
+	runID := req.PathValue("id")
+	runDir, ok := s.runDir(runID)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %q not found", runID))
+		return
+	}
+
+	report := map[string]interface{}{"id": runID}
+	s.mutex.Lock()
+	r, known := s.runs[runID]
+	s.mutex.Unlock()
+	if known {
+		report["run"] = r.view()
+	}
+
+	summaries := []patchSummary{}
+	if patches, best, err := core.ReadPatches(runDir); err == nil {
+		for agentID, diff := range patches {
+			stats := gitutil.GetDiffStats(diff)
+			summaries = append(summaries, patchSummary{
+				AgentID:      agentID,
+				FilesChanged: stats.FilesChanged,
+				LinesAdded:   stats.LinesAdded,
+				LinesRemoved: stats.LinesRemoved,
+				Best:         diff == best,
+			})
+		}
+		sort.Slice(summaries, func(i, j int) bool { return summaries[i].AgentID < summaries[j].AgentID })
+	} else if !known {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	report["patches"] = summaries
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleReportPage serves a finished run's rendered report, which chat messages link to
+func (s *server) handleReportPage(w http.ResponseWriter, req *http.Request) {
+	runID := req.PathValue("id")
+	runDir, ok := s.runDir(runID)
+	page := filepath.Join(runDir, core.ReportHTMLFile)
+	if !ok || !fileExists(page) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no report for run %q", runID))
+		return
+	}
+	http.ServeFile(w, req, page)
+}
+
+// serverRun tracks a submitted task; it records agent progress and forwards events to streaming clients
+type serverRun struct {
+	id     string
+	task   core.Task
+	runDir string
+	cancel context.CancelFunc
+
+	// issue is commented on when the run finishes, for runs started from a GitHub issue
+	issue *issueSource
+
+	// commit shows the run's progress and outcome as a status, for runs started on a GitHub pull request
+	commit *commitTarget
+
+	// key identifies the task, entry is what the queue file keeps of it, and turn is closed when it leaves the queue
+	// to run; they are guarded by the server's mutex
+	key   string
+	entry queueEntry
+	turn  chan struct{}
+
+	// priority orders the queue; it is changed with both the server's and the run's mutex held
+	priority int
+
+	mutex sync.Mutex
+	agentTracker
+	status     string
+	err        error
+	best       *core.PatchResult
+	candidates []*core.PatchResult
+	submitted  time.Time
+	started    time.Time
+	finished   time.Time
+	usage      func() map[string]*core.TokenCounter
+
+	events      []*protocol.Event // The latest events, holding at most twice eventHistory
+	eventCount  int
+	subscribers map[chan *protocol.Event]struct{}
+
+	// done is closed when the run finishes
+	done chan struct{}
+}
+
+// newServerRun creates a queued run of a task
+func newServerRun(runID string, task core.Task, cfg *core.Config, cancel context.CancelFunc) *serverRun {
+	return &serverRun{
+		id:           runID,
+		task:         task,
+		runDir:       filepath.Join(cfg.ArtifactsDir, runID),
+		cancel:       cancel,
+		agentTracker: newAgentTracker(runAgentIDs(cfg)),
+		status:       runQueued,
+		submitted:    time.Now(),
+		subscribers:  make(map[chan *protocol.Event]struct{}),
+		turn:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// raise moves the run to a higher priority
+func (r *serverRun) raise(priority int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.priority = priority
+	r.entry.Priority = priority
+}
+
+// begin marks the run as started
+func (r *serverRun) begin() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.status = runRunning
+	r.started = time.Now()
+}
+
+// finish records the outcome of the run and ends every event stream
+func (r *serverRun) finish(result *core.TaskResult, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		r.status = runCancelled
+	case err != nil:
+		r.status = runFailed
+	default:
+		r.status = runSucceeded
+	}
+	r.err = err
+	if result != nil {
+		r.best = result.Best
+		r.candidates = result.Candidates
+	}
+	r.finished = time.Now()
+	close(r.done)
+
+	for ch := range r.subscribers {
+		close(ch)
+		delete(r.subscribers, ch)
+	}
+}
+
+// state returns the run's current state
+func (r *serverRun) state() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.status
+}
+
+// isFinished reports whether the run has finished
+func (r *serverRun) isFinished() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return !r.finished.IsZero()
+}
+
+// subscribe returns the events emitted so far and a channel of those still to come
+// The channel is nil if the run has already finished
+func (r *serverRun) subscribe() ([]*protocol.Event, <-chan *protocol.Event, func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	history := append([]*protocol.Event{}, r.events[max(0, len(r.events)-eventHistory):]...)
+	if !r.finished.IsZero() {
+		return history, nil, func() {}
+	}
+
+	ch := make(chan *protocol.Event, subscriberBuffer)
+	r.subscribers[ch] = struct{}{}
+	unsubscribe := func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if _, ok := r.subscribers[ch]; ok {
+			close(ch)
+			delete(r.subscribers, ch)
+		}
+	}
+	return history, ch, unsubscribe
+}
+
+// Start implements engine.Progress
+func (r *serverRun) Start(usage func() map[string]*core.TokenCounter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.usage = usage
+}
+
+// Stop implements engine.Progress
+func (r *serverRun) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.updateUsage(r.usage)
+	r.usage = nil
+}
+
+// SetStatus implements engine.Progress
+func (r *serverRun) SetStatus(agentID, status string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.setStatus(agentID, status)
+}
+
+// SetSnippet implements engine.Progress
+func (r *serverRun) SetSnippet(agentID, snippet string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.agent(agentID).snippet = snippet
+}
+
+// SetUsage implements engine.Progress
+func (r *serverRun) SetUsage(agentID string, counter *core.TokenCounter) {
+	if counter == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.setUsage(agentID, counter)
+}
+
+// TrackEvent implements engine.Progress, forwarding the event to streaming clients
+// Clients that fall too far behind are disconnected rather than holding up the agent
+func (r *serverRun) TrackEvent(event *protocol.Event) {
+	if event == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.trackEvent(event)
+	r.eventCount++
+	// Old events are dropped in batches, so each event is copied at most once
+	if len(r.events) >= 2*eventHistory {
+		r.events = append([]*protocol.Event(nil), r.events[len(r.events)-eventHistory:]...)
+	}
+	r.events = append(r.events, event)
+	for ch := range r.subscribers {
+		select {
+		case ch <- event:
+		default:
+			close(ch)
+			delete(r.subscribers, ch)
+		}
+	}
+}
+
+// runView is the JSON representation of a run
+type runView struct {
+	ID         string          `json:"id"`
+	Task       core.Task       `json:"task"`
+	Status     string          `json:"status"`
+	Priority   int             `json:"priority"`
+	Error      string          `json:"error,omitempty"`
+	Submitted  time.Time       `json:"submitted_at"`
+	Started    *time.Time      `json:"started_at,omitempty"`
+	Finished   *time.Time      `json:"finished_at,omitempty"`
+	Agents     []agentView     `json:"agents"`
+	Best       *candidateView  `json:"best,omitempty"`
+	Candidates []candidateView `json:"candidates,omitempty"`
+	EventCount int             `json:"event_count"`
+}
+
+// agentView is the JSON representation of an agent's progress
+type agentView struct {
+	ID             string  `json:"id"`
+	Status         string  `json:"status"`
+	Activity       string  `json:"activity,omitempty"`
+	Events         int     `json:"events"`
+	Tokens         int     `json:"tokens"`
+	CostUSD        float64 `json:"cost_usd"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// candidateView is the JSON representation of an evaluated patch
+type candidateView struct {
+	AgentID       string                `json:"agent_id"`
+	Score         int                   `json:"score"`
+	Reason        string                `json:"reason"`
+	Breakdown     []core.ScoreComponent `json:"breakdown,omitempty"`
+	FilesChanged  int                   `json:"files_changed"`
+	LinesAdded    int                   `json:"lines_added"`
+	LinesRemoved  int                   `json:"lines_removed"`
+	TestsPassed   int                   `json:"tests_passed"`
+	TestsFailed   int                   `json:"tests_failed"`
+	TestsTotal    int                   `json:"tests_total"`
+	TestsSuccess  bool                  `json:"tests_success"`
+	MutantsKilled int                   `json:"mutants_killed,omitempty"`
+	MutantsTotal  int                   `json:"mutants_total,omitempty"`
+}
+
+// newCandidateView describes an evaluated patch
+func newCandidateView(result *core.PatchResult) candidateView {
+	view := candidateView{
+		AgentID:      result.AgentID,
+		Score:        result.Score,
+		Reason:       result.Reason,
+		Breakdown:    result.Breakdown,
+		FilesChanged: result.DiffStats.FilesChanged,
+		LinesAdded:   result.DiffStats.LinesAdded,
+		LinesRemoved: result.DiffStats.LinesRemoved,
+	}
+	if tests := result.TestResults; tests != nil {
+		view.TestsPassed = tests.PassedTests
+		view.TestsFailed = tests.FailedTests
+		view.TestsTotal = tests.TotalTests
+		view.TestsSuccess = tests.Success
+	}
+	if mutation := result.Mutation; mutation != nil {
+		view.MutantsKilled = mutation.Killed
+		view.MutantsTotal = mutation.Total
+	}
+	return view
+}
+
+// view returns a snapshot of the run for JSON responses
+func (r *serverRun) view() runView {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.updateUsage(r.usage)
+	now := time.Now()
+
+	view := runView{
+		ID:         r.id,
+		Task:       r.task,
+		Status:     r.status,
+		Priority:   r.priority,
+		Submitted:  r.submitted,
+		Agents:     make([]agentView, 0, len(r.order)),
+		EventCount: r.eventCount,
+	}
+	if r.err != nil {
+		view.Error = r.err.Error()
+	}
+	if !r.started.IsZero() {
+		started := r.started
+		view.Started = &started
+	}
+	if !r.finished.IsZero() {
+		finished := r.finished
+		view.Finished = &finished
+	}
+
+	for _, id := range r.order {
+		progress := r.agents[id]
+		view.Agents = append(view.Agents, agentView{
+			ID:             id,
+			Status:         progress.status,
+			Activity:       progress.snippet,
+			Events:         progress.events,
+			Tokens:         progress.tokens,
+			CostUSD:        progress.cost,
+			ElapsedSeconds: progress.elapsed(now).Seconds(),
+		})
+	}
+
+	if r.best != nil {
+		best := newCandidateView(r.best)
+		view.Best = &best
+	}
+	for _, candidate := range r.candidates {
+		view.Candidates = append(view.Candidates, newCandidateView(candidate))
+	}
+
+	return view
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeServerEvent writes one server-sent event with a JSON payload (unnamed events are delivered as "message")
+func writeServerEvent(w http.ResponseWriter, name string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if name != "" {
+		fmt.Fprintf(w, "event: %s\n", name)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/github"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPatch = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-old\n+new\n"
+
+// newTestServer starts a server whose runs are handled by runTask instead of real agents
+func newTestServer(t *testing.T, runTask func(context.Context, *core.Config, core.Task, string, engine.Progress) (*core.TaskResult, error)) (*server, *httptest.Server) {
+	return newTestServerWithConfig(t, "", runTask)
+}
+
+// newTestServerWithConfig starts a test server whose configuration ends with extra YAML
+func newTestServerWithConfig(t *testing.T, extra string, runTask func(context.Context, *core.Config, core.Task, string, engine.Progress) (*core.TaskResult, error)) (*server, *httptest.Server) {
+	workDir := t.TempDir()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+working_dir: %s
+test_command: "go test ./..."
+agents:
+  - id: claude
+    type: cli
+    config: {command: claude}
+  - id: codex
+    type: cli
+    tags: [fast]
+    config: {command: codex}
+%s`, workDir, extra)), 0644))
+
+	watcher, err := core.NewConfigWatcher(configFile, "")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := newServer(ctx, watcher, 1)
+	srv.runTask = runTask
+
+	httpServer := httptest.NewServer(srv.handler())
+	t.Cleanup(func() {
+		cancel()
+		srv.wait()
+		httpServer.Close()
+	})
+	return srv, httpServer
+}
+
+// request sends a request and decodes a JSON response into out (if not nil)
+func request(t *testing.T, method, url, body string, out interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func TestServer_RunLifecycle(t *testing.T) {
+	release := make(chan struct{})
+	_, httpServer := newTestServer(t, func(ctx context.Context, cfg *core.Config, task core.Task, runID string, progress engine.Progress) (*core.TaskResult, error) {
+		progress.Start(nil)
+		progress.SetStatus("codex", engine.AgentRunning)
+		thinking, _ := protocol.NewEvent(protocol.EventTypeThinking, "codex", 1).WithPayload(protocol.ThinkingPayload{Content: "Reading main.go"})
+		progress.TrackEvent(thinking)
+
+		<-release
+		progress.TrackEvent(protocol.NewEvent(protocol.EventTypeComplete, "codex", 2))
+		progress.SetStatus("codex", engine.AgentDone)
+		progress.Stop()
+
+		best := &core.PatchResult{
+			AgentID:     "codex",
+			Diff:        testPatch,
+			Score:       150,
+			Breakdown:   []core.ScoreComponent{{Factor: "all tests pass", Points: 100}, {Factor: "passing tests (3)", Points: 30}, {Factor: "small diff", Points: 20}},
+			TestResults: &core.TestResult{Success: true, TotalTests: 3, PassedTests: 3},
+		}
+		_, err := core.ExportPatches(filepath.Join(cfg.ArtifactsDir, runID), map[string]*core.PatchDetails{"codex": {Diff: testPatch}}, best)
+		require.NoError(t, err)
+		return &core.TaskResult{Task: task, RunID: runID, Best: best, Candidates: []*core.PatchResult{best}}, nil
+	})
+
+	// Submit a task for the agents with the fast tag
+	var submitted runView
+	status := request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "Fix the bug", "tags": ["fast"], "labels": ["bug"]}`, &submitted)
+	require.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, "Fix the bug", submitted.Task.Prompt)
+	assert.Equal(t, []string{"bug"}, submitted.Task.Labels)
+	require.Len(t, submitted.Agents, 1)
+	assert.Equal(t, "codex", submitted.Agents[0].ID)
+
+	// Stream events: earlier events are replayed, later ones arrive live, then the final state
+	resp, err := http.Get(httpServer.URL + "/runs/" + submitted.ID + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	stream := bufio.NewReader(resp.Body)
+	assert.Contains(t, readServerEvent(t, stream), `"type":"thinking"`)
+	close(release)
+	assert.Contains(t, readServerEvent(t, stream), `"type":"complete"`)
+	end := readServerEvent(t, stream)
+	assert.True(t, strings.HasPrefix(end, "event: end\n"), end)
+	assert.Contains(t, end, `"status":"succeeded"`)
+
+	// Status reflects the run's outcome and the agents' progress
+	var finished runView
+	require.Equal(t, http.StatusOK, request(t, http.MethodGet, httpServer.URL+"/runs/"+submitted.ID, "", &finished))
+	assert.Equal(t, runSucceeded, finished.Status)
+	require.NotNil(t, finished.Best)
+	assert.Equal(t, "codex", finished.Best.AgentID)
+	assert.Equal(t, 3, finished.Best.TestsPassed)
+	require.Len(t, finished.Candidates, 1)
+	assert.Len(t, finished.Candidates[0].Breakdown, 3)
+	assert.Equal(t, 2, finished.EventCount)
+	assert.Equal(t, engine.AgentDone, findAgent(finished.Agents, "codex").Status)
+
+	var runs []runView
+	require.Equal(t, http.StatusOK, request(t, http.MethodGet, httpServer.URL+"/runs", "", &runs))
+	require.Len(t, runs, 1)
+	assert.Equal(t, submitted.ID, runs[0].ID)
+
+	// Patches and the report come from the exported artifacts
+	for _, path := range []string{"/patch", "/patches/codex"} {
+		resp, err := http.Get(httpServer.URL + "/runs/" + submitted.ID + path)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.Contains(t, string(body), "+new", path)
+	}
+	assert.Equal(t, http.StatusNotFound, request(t, http.MethodGet, httpServer.URL+"/runs/"+submitted.ID+"/patches/claude", "", nil))
+
+	var report struct {
+		Patches []patchSummary `json:"patches"`
+	}
+	require.Equal(t, http.StatusOK, request(t, http.MethodGet, httpServer.URL+"/runs/"+submitted.ID+"/report", "", &report))
+	assert.Equal(t, []patchSummary{{AgentID: "codex", FilesChanged: 1, LinesAdded: 1, LinesRemoved: 1, Best: true}}, report.Patches)
+
+	// A finished run cannot be cancelled
+	assert.Equal(t, http.StatusConflict, request(t, http.MethodDelete, httpServer.URL+"/runs/"+submitted.ID, "", nil))
+}
+
+func TestServer_Cancel(t *testing.T) {
+	started := make(chan struct{})
+	_, httpServer := newTestServer(t, func(ctx context.Context, cfg *core.Config, task core.Task, runID string, progress engine.Progress) (*core.TaskResult, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	var running, queued runView
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "First"}`, &running))
+	<-started
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "Second"}`, &queued))
+
+	// Both a queued and a running run can be cancelled
+	for _, id := range []string{queued.ID, running.ID} {
+		require.Equal(t, http.StatusAccepted, request(t, http.MethodDelete, httpServer.URL+"/runs/"+id, "", nil))
+
+		var view runView
+		require.Eventually(t, func() bool {
+			request(t, http.MethodGet, httpServer.URL+"/runs/"+id, "", &view)
+			return view.Status == runCancelled
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, context.Canceled.Error(), view.Error)
+	}
+}
+
+func TestServer_Queue(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	srv, httpServer := newTestServer(t, func(ctx context.Context, cfg *core.Config, task core.Task, runID string, progress engine.Progress) (*core.TaskResult, error) {
+		started <- task.Prompt
+		select {
+		case <-release:
+			return &core.TaskResult{Task: task, RunID: runID}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	srv.queueLimit = 2
+
+	var first, low, high, duplicate runView
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "First"}`, &first))
+	assert.Equal(t, "First", <-started)
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "Low"}`, &low))
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "High", "priority": 5}`, &high))
+
+	queue := func() []string {
+		var views []runView
+		require.Equal(t, http.StatusOK, request(t, http.MethodGet, httpServer.URL+"/queue", "", &views))
+		var ids []string
+		for _, view := range views {
+			ids = append(ids, view.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{high.ID, low.ID}, queue(), "Higher priorities are queued first")
+
+	// An identical task joins the queued run, raising its priority
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "Low", "priority": 10, "labels": ["again"]}`, &duplicate))
+	assert.Equal(t, low.ID, duplicate.ID)
+	assert.Equal(t, 10, duplicate.Priority)
+	assert.Equal(t, []string{low.ID, high.ID}, queue())
+
+	// A full queue turns tasks away
+	var body map[string]string
+	assert.Equal(t, http.StatusServiceUnavailable, request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "Another"}`, &body))
+	assert.Contains(t, body["error"], "queue is full")
+
+	for _, want := range []string{"Low", "High"} {
+		release <- struct{}{}
+		assert.Equal(t, want, <-started)
+	}
+	assert.Empty(t, queue())
+	release <- struct{}{}
+}
+
+func TestServer_RestoreQueue(t *testing.T) {
+	queueFile := filepath.Join(t.TempDir(), queueFileName)
+
+	// The first server is still running its first task when the second starts from the tasks it kept
+	first, firstHTTP := newTestServer(t, func(ctx context.Context, cfg *core.Config, task core.Task, runID string, progress engine.Progress) (*core.TaskResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, first.restoreQueue(queueFile))
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, firstHTTP.URL+"/runs", `{"prompt": "Running"}`, nil))
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, firstHTTP.URL+"/runs", `{"prompt": "Queued", "priority": 2, "labels": ["bug"]}`, nil))
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(queueFile)
+		return err == nil && strings.Contains(string(data), `"Running"`) && strings.Contains(string(data), `"Queued"`)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	prompts := make(chan core.Task, 2)
+	second, _ := newTestServer(t, func(ctx context.Context, cfg *core.Config, task core.Task, runID string, progress engine.Progress) (*core.TaskResult, error) {
+		prompts <- task
+		return &core.TaskResult{Task: task, RunID: runID}, nil
+	})
+	require.NoError(t, second.restoreQueue(queueFile))
+	assert.Equal(t, "Running", (<-prompts).Prompt, "The task that was running is restored first")
+	queued := <-prompts
+	assert.Equal(t, "Queued", queued.Prompt)
+	assert.Equal(t, []string{"bug"}, queued.Labels)
+
+	// Finished tasks leave the queue
+	require.Eventually(t, func() bool {
+		var entries []queueEntry
+		data, err := os.ReadFile(queueFile)
+		return err == nil && json.Unmarshal(data, &entries) == nil && len(entries) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestQueueEntry(t *testing.T) {
+	req := submitRequest{
+		Prompt:   "Fix the bug",
+		Repo:     "https://github.com/octo/app.git",
+		Priority: 3,
+		issue:    &issueSource{ref: github.IssueRef{Host: "github.com", Owner: "octo", Repo: "app", Number: 7}, issue: &github.Issue{Number: 7, Title: "Bug"}},
+		commit:   &commitTarget{host: "github.com", owner: "octo", repo: "app", sha: "abc123", serverURL: "http://localhost:8420"},
+	}
+
+	// The issue and commit a webhook run reports to survive the queue file
+	data, err := json.Marshal(newQueueEntry(req))
+	require.NoError(t, err)
+	var entry queueEntry
+	require.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, req, entry.request())
+}
+
+func TestServerRun_EventHistory(t *testing.T) {
+	r := newServerRun("run-1", core.Task{Prompt: "Fix the bug"}, &core.Config{}, func() {})
+	total := 2*eventHistory + 10
+	for i := 1; i <= total; i++ {
+		r.TrackEvent(protocol.NewEvent(protocol.EventTypeThinking, "claude", i))
+	}
+
+	// Only the latest events are replayed, but all of them are counted
+	history, _, unsubscribe := r.subscribe()
+	defer unsubscribe()
+	require.Len(t, history, eventHistory)
+	assert.Equal(t, total, history[len(history)-1].SequenceNum)
+	assert.LessOrEqual(t, len(r.events), 2*eventHistory)
+	assert.Equal(t, total, r.view().EventCount)
+}
+
+func TestServer_Dashboard(t *testing.T) {
+	release := make(chan struct{})
+	srv, httpServer := newTestServer(t, func(ctx context.Context, cfg *core.Config, task core.Task, runID string, progress engine.Progress) (*core.TaskResult, error) {
+		<-release
+		return &core.TaskResult{Task: task, RunID: runID}, nil
+	})
+	defer close(release)
+
+	resp, err := http.Get(httpServer.URL + "/")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "<title>Orchestrator</title>")
+	assert.Equal(t, http.StatusNotFound, request(t, http.MethodGet, httpServer.URL+"/missing", "", nil), "Only the root serves the dashboard")
+
+	// A run exported before the server started is listed alongside runs submitted since
+	archived := "20240101-000000-abcd"
+	_, err = core.ExportPatches(filepath.Join(srv.watcher.Current().ArtifactsDir, archived), map[string]*core.PatchDetails{"claude": {Diff: testPatch}}, nil)
+	require.NoError(t, err)
+
+	var submitted runView
+	require.Equal(t, http.StatusAccepted, request(t, http.MethodPost, httpServer.URL+"/runs", `{"prompt": "Fix the bug"}`, &submitted))
+
+	var history []historyEntry
+	require.Equal(t, http.StatusOK, request(t, http.MethodGet, httpServer.URL+"/history", "", &history))
+	require.Len(t, history, 2)
+	assert.Equal(t, submitted.ID, history[0].ID)
+	assert.Contains(t, []string{runQueued, runRunning}, history[0].Status)
+	assert.Equal(t, historyEntry{ID: archived, Status: runArchived}, history[1])
+
+	// Archived runs still have a report, without live progress
+	var report map[string]interface{}
+	require.Equal(t, http.StatusOK, request(t, http.MethodGet, httpServer.URL+"/runs/"+archived+"/report", "", &report))
+	assert.NotContains(t, report, "run")
+	assert.Len(t, report["patches"], 1)
+}
+
+func TestServer_InvalidRequests(t *testing.T) {
+	_, httpServer := newTestServer(t, func(context.Context, *core.Config, core.Task, string, engine.Progress) (*core.TaskResult, error) {
+		t.Error("no task should run")
+		return nil, nil
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{name: "missing prompt", method: http.MethodPost, path: "/runs", body: `{"prompt": " "}`, status: http.StatusBadRequest, want: "prompt is required"},
+		{name: "unknown field", method: http.MethodPost, path: "/runs", body: `{"promt": "Fix it"}`, status: http.StatusBadRequest, want: "unknown field"},
+		{name: "unknown agent", method: http.MethodPost, path: "/runs", body: `{"prompt": "Fix it", "agents": ["gemini"]}`, status: http.StatusBadRequest, want: "agent 'gemini' is not configured"},
+		{name: "option as base ref", method: http.MethodPost, path: "/runs", body: `{"prompt": "Fix it", "base_ref": "--upload-pack=touch pwned"}`, status: http.StatusBadRequest, want: "invalid ref"},
+		{name: "malformed base ref", method: http.MethodPost, path: "/runs", body: `{"prompt": "Fix it", "base_ref": "main..evil"}`, status: http.StatusBadRequest, want: "invalid ref"},
+		{name: "unknown run", method: http.MethodGet, path: "/runs/missing", status: http.StatusNotFound, want: "not found"},
+		{name: "unknown run events", method: http.MethodGet, path: "/runs/missing/events", status: http.StatusNotFound, want: "not found"},
+		{name: "path outside artifacts", method: http.MethodGet, path: "/runs/..%2F..%2Fetc/patch", status: http.StatusNotFound, want: "not found"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var body map[string]string
+			assert.Equal(t, tc.status, request(t, tc.method, httpServer.URL+tc.path, tc.body, &body))
+			assert.Contains(t, body["error"], tc.want)
+		})
+	}
+
+	var health map[string]interface{}
+	require.Equal(t, http.StatusOK, request(t, http.MethodGet, httpServer.URL+"/health", "", &health))
+	assert.Equal(t, []interface{}{"claude", "codex"}, health["agents"])
+}
+
+func TestServer_APIAccess(t *testing.T) {
+	tasks, runTask := recordTasks()
+	_, httpServer := newTestServerWithConfig(t, `
+server:
+  token: t0ken
+  repo_hosts: [github.com]
+`, runTask)
+
+	submit := func(body string, headers map[string]string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/runs", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer t0ken")
+		for name, value := range headers {
+			if value == "" {
+				req.Header.Del(name)
+			} else {
+				req.Header.Set(name, value)
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+		message, _ := out["error"].(string)
+		return resp.StatusCode, message
+	}
+
+	status, message := submit(`{"prompt": "Fix it", "repo": "https://github.com/octo/app.git"}`, nil)
+	require.Equal(t, http.StatusAccepted, status, message)
+	assert.Equal(t, "https://github.com/octo/app.git", receiveTask(t, tasks).Repo)
+	status, message = submit(`{"prompt": "Fix it", "repo": "git@github.com:octo/other.git"}`, map[string]string{"Origin": httpServer.URL})
+	require.Equal(t, http.StatusAccepted, status, message)
+	receiveTask(t, tasks)
+
+	tests := []struct {
+		name    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "no token", headers: map[string]string{"Authorization": ""}, status: http.StatusUnauthorized},
+		{name: "wrong token", headers: map[string]string{"Authorization": "Bearer nope"}, status: http.StatusUnauthorized},
+		{name: "another origin", headers: map[string]string{"Origin": "https://evil.example"}, status: http.StatusForbidden},
+		{name: "form post", headers: map[string]string{"Content-Type": "text/plain"}, status: http.StatusUnsupportedMediaType},
+		{name: "repo on another host", body: `{"prompt": "Fix it", "repo": "https://evil.example/app.git"}`, status: http.StatusForbidden},
+		{name: "local repo", body: `{"prompt": "Fix it", "repo": "/tmp/github.com:app"}`, status: http.StatusForbidden},
+		{name: "repo over http", body: `{"prompt": "Fix it", "repo": "http://github.com/octo/app.git"}`, status: http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body := tc.body
+			if body == "" {
+				body = `{"prompt": "Fix it"}`
+			}
+			status, message := submit(body, tc.headers)
+			assert.Equal(t, tc.status, status)
+			assert.NotEmpty(t, message)
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, httpServer.URL+"/runs/missing", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "Cancelling needs the token too")
+
+	// Reading runs needs the token, which the event stream passes in the query
+	for _, path := range []string{"/runs", "/queue", "/history", "/runs/missing/events", "/runs/missing/patch"} {
+		resp, err := http.Get(httpServer.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, path)
+	}
+	resp, err = http.Get(httpServer.URL + "/runs?token=t0ken")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServer_DNSRebinding(t *testing.T) {
+	_, httpServer := newTestServer(t, func(context.Context, *core.Config, core.Task, string, engine.Progress) (*core.TaskResult, error) {
+		t.Error("no task should run")
+		return nil, nil
+	})
+
+	// A site that points its own name at the server is the same origin as its pages, but isn't a loopback host
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		req, err := http.NewRequest(method, httpServer.URL+"/runs", strings.NewReader(`{"prompt": "Fix it"}`))
+		require.NoError(t, err)
+		req.Host = "rebound.evil.example"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", "http://rebound.evil.example")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, method)
+	}
+
+	for host, loopback := range map[string]bool{
+		"localhost:8080": true, "app.localhost": true, "127.0.0.1:80": true, "[::1]:8080": true,
+		"192.168.1.2:8080": false, "evil.example": false, "localhost.evil.example": false,
+	} {
+		assert.Equal(t, loopback, loopbackHost(host), host)
+	}
+}
+
+// readServerEvent reads one server-sent event, without its terminating blank line
+func readServerEvent(t *testing.T, stream *bufio.Reader) string {
+	var sb strings.Builder
+	for {
+		line, err := stream.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\n" {
+			return sb.String()
+		}
+		sb.WriteString(line)
+	}
+}
+
+// findAgent returns an agent's progress from a run view (nil if absent)
+func findAgent(agents []agentView, id string) *agentView {
+	for i := range agents {
+		if agents[i].ID == id {
+			return &agents[i]
+		}
+	}
+	return nil
+}
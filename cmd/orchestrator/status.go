@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/github"
+)
+
+// statusContext names the commit statuses runs set, so each run replaces the last one's
+const statusContext = "orchestrator"
+
+// commitTarget is a GitHub commit a run reports its progress and outcome on, such as the head of a pull request
+type commitTarget struct {
+	host  string
+	owner string
+	repo  string
+	sha   string
+
+	// serverURL is where the server running a webhook's run is reached; its statuses link to the run's pages there
+	serverURL string
+}
+
+// String returns the commit as owner/repo@sha
+func (c *commitTarget) String() string {
+	return fmt.Sprintf("%s/%s@%s", c.owner, c.repo, c.sha)
+}
+
+// set sets the commit's status, logging instead of failing since the run itself is unaffected
+func (c *commitTarget) set(ctx context.Context, client *github.Client, runID string, status github.CommitStatus) {
+	if err := client.CreateStatus(ctx, c.owner, c.repo, c.sha, status); err != nil {
+		slog.Warn("failed to set commit status", "run", runID, "commit", c.String(), "error", err)
+	}
+}
+
+// pendingStatus is the status of a commit while a run on it is in progress
+func pendingStatus(runID, targetURL string) github.CommitStatus {
+	return github.CommitStatus{
+		State:       github.StatusPending,
+		TargetURL:   targetURL,
+		Description: fmt.Sprintf("Run %s is in progress", runID),
+		Context:     statusContext,
+	}
+}
+
+// finishedStatus is the status of a commit once a run on it has finished, e.g. "Best patch passes 42/42 tests"
+// It succeeds only when the run solved the task, like the notice annotations of --ci github
+func finishedStatus(result *core.TaskResult, runErr error, targetURL string) github.CommitStatus {
+	status := github.CommitStatus{State: github.StatusFailure, TargetURL: targetURL, Context: statusContext}
+	switch {
+	case runErr != nil:
+		status.State = github.StatusError
+		status.Description = "Run failed: " + runErr.Error()
+	case result == nil || result.Best == nil || strings.TrimSpace(result.Best.Diff) == "":
+		status.Description = "No agent produced a patch"
+	case result.Best.TestResults == nil:
+		status.Description = fmt.Sprintf("Best patch (%s) scored %d; no tests were run", result.Best.AgentID, result.Best.Score)
+	default:
+		tests := result.Best.TestResults
+		status.Description = fmt.Sprintf("Best patch passes %d/%d tests", tests.PassedTests, tests.TotalTests)
+	}
+	if result != nil && runErr == nil && result.Solved() {
+		status.State = github.StatusSuccess
+	}
+	return status
+}
+
+// serverBaseURL returns where GitHub reaches the server: the configured chat.server_url, or else the scheme
+// and host the delivery was sent to, as reported by any proxy in front of the server
+func serverBaseURL(req *http.Request, configured string) string {
+	if configured != "" {
+		return strings.TrimRight(configured, "/")
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	host := req.Host
+	if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return scheme + "://" + host
+}
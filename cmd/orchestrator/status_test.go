@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinishedStatus(t *testing.T) {
+	best := &core.PatchResult{AgentID: "claude", Score: 170, Diff: testPatch, TestResults: &core.TestResult{Success: true, TotalTests: 42, PassedTests: 42}}
+	result := &core.TaskResult{RunID: "run", Best: best}
+
+	status := finishedStatus(result, nil, "https://orchestrator.example.com/runs/run/report.html")
+	assert.Equal(t, github.CommitStatus{
+		State:       github.StatusSuccess,
+		TargetURL:   "https://orchestrator.example.com/runs/run/report.html",
+		Description: "Best patch passes 42/42 tests",
+		Context:     statusContext,
+	}, status)
+
+	best.TestResults = &core.TestResult{TotalTests: 42, PassedTests: 40}
+	status = finishedStatus(result, nil, "")
+	assert.Equal(t, github.StatusFailure, status.State)
+	assert.Equal(t, "Best patch passes 40/42 tests", status.Description)
+
+	status = finishedStatus(&core.TaskResult{RunID: "run"}, nil, "")
+	assert.Equal(t, github.StatusFailure, status.State)
+	assert.Equal(t, "No agent produced a patch", status.Description)
+
+	status = finishedStatus(nil, errors.New("no agents"), "")
+	assert.Equal(t, github.StatusError, status.State)
+	assert.Equal(t, "Run failed: no agents", status.Description)
+}
+
+func TestServerBaseURL(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://orchestrator.internal:8080/webhooks/github", nil)
+	assert.Equal(t, "http://orchestrator.internal:8080", serverBaseURL(req, ""))
+	assert.Equal(t, "https://orchestrator.example.com", serverBaseURL(req, "https://orchestrator.example.com/"), "The configured URL wins")
+
+	req.TLS = &tls.ConnectionState{}
+	assert.Equal(t, "https://orchestrator.internal:8080", serverBaseURL(req, ""))
+
+	// A proxy in front of the server reports where the delivery was sent
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "orchestrator.example.com, proxy.internal")
+	assert.Equal(t, "https://orchestrator.example.com", serverBaseURL(req, ""))
+}
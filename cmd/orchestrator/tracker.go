@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/tracker"
+)
+
+// taskSource is an issue a run's task comes from, which is told the outcome when the run ends
+type taskSource interface {
+	// task returns the task for the issue, with any --prompt added as further instructions
+	task(extra string) core.Task
+
+	// report tells the issue the outcome of the run
+	report(ctx context.Context, cfg *core.Config, result *core.TaskResult) error
+
+	// String names the issue in messages
+	String() string
+}
+
+// fetchTaskSource fetches the issue named by the --issue flag from GitHub, Jira, or Linear
+// A bare key such as PROJ-123 is looked up in whichever of Jira and Linear is configured
+func fetchTaskSource(ctx context.Context, cfg *core.Config, arg string) (taskSource, error) {
+	kind, key, ok := tracker.ParseRef(arg)
+	if !ok {
+		source, err := fetchIssue(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	}
+
+	if kind == tracker.KindKey {
+		switch {
+		case cfg.Jira.Enabled() && cfg.Linear.Enabled():
+			return nil, fmt.Errorf("both Jira and Linear are configured, so give %s as an issue URL", key)
+		case cfg.Jira.Enabled():
+			kind = tracker.KindJira
+		case cfg.Linear.Enabled():
+			kind = tracker.KindLinear
+		default:
+			return nil, fmt.Errorf("%s looks like a Jira or Linear issue, but neither is configured", key)
+		}
+	}
+
+	var client tracker.Tracker
+	switch kind {
+	case tracker.KindJira:
+		if !cfg.Jira.Enabled() {
+			return nil, fmt.Errorf("%s is a Jira issue, but jira.url is not configured", key)
+		}
+		client = tracker.NewJira(cfg.Jira.URL, cfg.Jira.Email, cfg.Jira.Token, cfg.Jira.Transition)
+	case tracker.KindLinear:
+		if !cfg.Linear.Enabled() {
+			return nil, fmt.Errorf("%s is a Linear issue, but linear.token is not configured", key)
+		}
+		client = tracker.NewLinear(cfg.Linear.Token, cfg.Linear.State)
+	}
+
+	issue, err := client.Issue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &trackerSource{client: client, issue: issue}, nil
+}
+
+// trackerSource is a Jira or Linear issue used as the task of a run
+type trackerSource struct {
+	client tracker.Tracker
+	issue  *tracker.Issue
+}
+
+// String returns the issue's key
+func (s *trackerSource) String() string {
+	return s.issue.Key
+}
+
+// task returns the task for the issue, with any --prompt added as further instructions
+func (s *trackerSource) task(extra string) core.Task {
+	prompt := tracker.Prompt(s.client.Name(), s.issue)
+	if extra = strings.TrimSpace(extra); extra != "" {
+		prompt += "\nAdditional instructions:\n" + extra + "\n"
+	}
+	return core.Task{ID: strings.ToLower(s.issue.Key), Prompt: prompt}
+}
+
+// report comments on the issue with the outcome of the run, and moves it along its workflow if the run solved it
+func (s *trackerSource) report(ctx context.Context, cfg *core.Config, result *core.TaskResult) error {
+	if err := s.client.Comment(ctx, s.issue, cfg.Redact(formatTrackerComment(result))); err != nil {
+		return err
+	}
+	fmt.Printf("Commented on %s\n", s.issue.Key)
+	audit.Record(ctx, audit.IssueCommented, "issue", s.issue.Key, "url", s.issue.URL)
+
+	if !result.Solved() {
+		return nil
+	}
+	if err := s.client.Resolve(ctx, s.issue); err != nil {
+		return err
+	}
+	audit.Record(ctx, audit.IssueResolved, "issue", s.issue.Key, "url", s.issue.URL)
+	return nil
+}
+
+// formatTrackerComment summarizes a run's winning patch as a plain-text comment
+// Jira and Linear render different markup, so the comment uses none, and the patch stays in the run directory
+func formatTrackerComment(result *core.TaskResult) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The orchestrator evaluated %d patches for this issue (run %s).\n", len(result.Candidates), result.RunID)
+
+	best := result.Best
+	if best == nil || strings.TrimSpace(best.Diff) == "" {
+		sb.WriteString("\nNo agent produced a patch.\n")
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "\nBest patch: %s, scoring %d (%s)\n", best.AgentID, best.Score, best.Reason)
+	fmt.Fprintf(&sb, "Changes: %d files, +%d -%d\n", best.DiffStats.FilesChanged, best.DiffStats.LinesAdded, best.DiffStats.LinesRemoved)
+	if tests := best.TestResults; tests != nil {
+		fmt.Fprintf(&sb, "Tests: %d of %d passed\n", tests.PassedTests, tests.TotalTests)
+	}
+	if result.Branch != "" {
+		fmt.Fprintf(&sb, "Branch: %s\n", result.Branch)
+	}
+	return sb.String()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchTaskSourceNeedsTracker(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := fetchTaskSource(ctx, &core.Config{}, "PROJ-1")
+	assert.ErrorContains(t, err, "neither is configured")
+
+	both := &core.Config{Jira: core.JiraConfig{URL: "https://example.atlassian.net"}, Linear: core.LinearConfig{Token: "key"}}
+	_, err = fetchTaskSource(ctx, both, "PROJ-1")
+	assert.ErrorContains(t, err, "give PROJ-1 as an issue URL")
+
+	_, err = fetchTaskSource(ctx, &core.Config{}, "https://linear.app/acme/issue/ENG-1/crash")
+	assert.ErrorContains(t, err, "linear.token is not configured")
+}
+
+func TestFormatTrackerComment(t *testing.T) {
+	best := &core.PatchResult{
+		AgentID:     "claude",
+		Score:       170,
+		Reason:      "Tests now passing",
+		Diff:        "diff --git a/f.go b/f.go\n-return 1\n+return 2\n",
+		DiffStats:   gitutil.DiffStats{FilesChanged: 1, LinesAdded: 1, LinesRemoved: 1},
+		TestResults: &core.TestResult{Success: true, TotalTests: 3, PassedTests: 3},
+	}
+	result := &core.TaskResult{RunID: "20240102-030405-abcdef", Best: best, Candidates: []*core.PatchResult{best}, Branch: "orchestrator/fix-crash"}
+
+	comment := formatTrackerComment(result)
+	assert.Contains(t, comment, "evaluated 1 patches for this issue (run 20240102-030405-abcdef)")
+	assert.Contains(t, comment, "Best patch: claude, scoring 170 (Tests now passing)\n")
+	assert.Contains(t, comment, "Tests: 3 of 3 passed\n")
+	assert.Contains(t, comment, "Branch: orchestrator/fix-crash\n")
+	assert.NotContains(t, comment, "return 2", "The patch stays in the run directory")
+
+	comment = formatTrackerComment(&core.TaskResult{RunID: "20240102-030405-abcdef"})
+	assert.Contains(t, comment, "No agent produced a patch.")
+}
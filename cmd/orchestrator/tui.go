@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+const (
+	// tuiRefreshInterval is how often the terminal UI redraws
+	tuiRefreshInterval = 250 * time.Millisecond
+
+	// tuiSnippetWidth is the widest activity snippet shown for an agent
+	tuiSnippetWidth = 60
+
+	// tuiLogLines is how many recent log messages are kept below the table
+	tuiLogLines = 5
+)
+
+// agentProgress is the live state of one agent
+type agentProgress struct {
+	status   string
+	snippet  string
+	events   int
+	tokens   int
+	cost     float64
+	started  time.Time
+	finished time.Time
+}
+
+// elapsed returns how long the agent has been running, or ran for
+func (p *agentProgress) elapsed(now time.Time) time.Duration {
+	switch {
+	case p.started.IsZero():
+		return 0
+	case !p.finished.IsZero():
+		return p.finished.Sub(p.started)
+	default:
+		return now.Sub(p.started)
+	}
+}
+
+// agentTracker holds the progress of every agent in a run
+// It does no locking of its own; its owner guards it
+type agentTracker struct {
+	order  []string
+	agents map[string]*agentProgress
+}
+
+// newAgentTracker creates a tracker for the given agents, listed in ID order
+func newAgentTracker(agentIDs []string) agentTracker {
+	order := append([]string{}, agentIDs...)
+	sort.Strings(order)
+
+	agents := make(map[string]*agentProgress, len(order))
+	for _, id := range order {
+		agents[id] = &agentProgress{status: engine.AgentPending}
+	}
+	return agentTracker{order: order, agents: agents}
+}
+
+// agent returns the progress of an agent, adding agents that were not known up front
+func (t *agentTracker) agent(agentID string) *agentProgress {
+	progress, exists := t.agents[agentID]
+	if !exists {
+		if t.agents == nil {
+			t.agents = make(map[string]*agentProgress)
+		}
+		progress = &agentProgress{status: engine.AgentPending}
+		t.agents[agentID] = progress
+		t.order = append(t.order, agentID)
+	}
+	return progress
+}
+
+// setStatus records an agent's state, starting or stopping its clock as it begins and ends
+// The first final state wins, so an agent stopped by the watchdog is not later shown as done
+func (t *agentTracker) setStatus(agentID, status string) {
+	progress := t.agent(agentID)
+	if !progress.finished.IsZero() {
+		return
+	}
+	progress.status = status
+
+	now := time.Now()
+	switch status {
+	case engine.AgentStarting, engine.AgentRunning:
+		if progress.started.IsZero() {
+			progress.started = now
+		}
+	case engine.AgentDone, engine.AgentFailed, engine.AgentStopped:
+		progress.finished = now
+	}
+}
+
+// setUsage records an agent's token usage and spend
+func (t *agentTracker) setUsage(agentID string, counter *core.TokenCounter) {
+	progress := t.agent(agentID)
+	progress.tokens = counter.TotalTokens()
+	progress.cost = counter.CostUSD
+}
+
+// updateUsage records the usage of every agent still monitored
+// Usage is only available while the watchdog monitors an agent, so the last values seen are kept
+func (t *agentTracker) updateUsage(usage func() map[string]*core.TokenCounter) {
+	if usage == nil {
+		return
+	}
+	for id, counter := range usage() {
+		t.setUsage(id, counter)
+	}
+}
+
+// trackEvent counts an agent's event and notes what it says the agent is doing
+func (t *agentTracker) trackEvent(event *protocol.Event) {
+	progress := t.agent(event.AgentID)
+	progress.events++
+	if snippet := event.Snippet(); snippet != "" {
+		progress.snippet = snippet
+	}
+}
+
+// newProgress returns the progress display selected by the run flags
+func newProgress(cfg *core.Config) engine.Progress {
+	if !tuiMode {
+		return engine.NoProgress{}
+	}
+	if !isTerminal() {
+		slog.Warn("--tui needs an interactive terminal, showing plain output")
+		return engine.NoProgress{}
+	}
+
+	return newProgressUI(os.Stdout, runAgentIDs(cfg))
+}
+
+// progressUI redraws a live table of agent progress in place on a terminal
+type progressUI struct {
+	mutex sync.Mutex
+	agentTracker
+	out  io.Writer
+	logs []string
+
+	// usage reports token usage of running agents (nil if unknown)
+	usage func() map[string]*core.TokenCounter
+
+	// lines is the number of lines drawn by the previous frame, which the next frame overwrites
+	lines int
+
+	logOutput io.Writer
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// newProgressUI creates a UI for the given agents, listed in ID order
+func newProgressUI(out io.Writer, agentIDs []string) *progressUI {
+	return &progressUI{
+		agentTracker: newAgentTracker(agentIDs),
+		out:          out,
+	}
+}
+
+// isTerminal reports whether stdout is an interactive terminal the UI can redraw
+func isTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Start begins redrawing the table and captures log output so it doesn't tear the table apart
+func (ui *progressUI) Start(usage func() map[string]*core.TokenCounter) {
+	ui.mutex.Lock()
+	ui.usage = usage
+	ui.stop = make(chan struct{})
+	ui.stopped = make(chan struct{})
+	ui.mutex.Unlock()
+
+	// Log records are written while the sink is locked and take the UI's lock, so swap without holding it
+	previous := logOutput.swap(ui)
+	ui.mutex.Lock()
+	ui.logOutput = previous
+	ui.mutex.Unlock()
+
+	go func() {
+		defer close(ui.stopped)
+
+		ticker := time.NewTicker(tuiRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			ui.redraw()
+			select {
+			case <-ticker.C:
+			case <-ui.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the final table, leaves it on screen, and restores log output
+func (ui *progressUI) Stop() {
+	if ui.stop == nil {
+		return
+	}
+
+	close(ui.stop)
+	<-ui.stopped
+	ui.redraw()
+
+	ui.mutex.Lock()
+	previous := ui.logOutput
+	ui.stop = nil
+	ui.mutex.Unlock()
+	logOutput.swap(previous)
+}
+
+// SetStatus implements engine.Progress
+func (ui *progressUI) SetStatus(agentID, status string) {
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	ui.setStatus(agentID, status)
+}
+
+// SetSnippet implements engine.Progress
+func (ui *progressUI) SetSnippet(agentID, snippet string) {
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	ui.agent(agentID).snippet = snippet
+}
+
+// SetUsage implements engine.Progress
+func (ui *progressUI) SetUsage(agentID string, counter *core.TokenCounter) {
+	if counter == nil {
+		return
+	}
+
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	ui.setUsage(agentID, counter)
+}
+
+// TrackEvent implements engine.Progress
+func (ui *progressUI) TrackEvent(event *protocol.Event) {
+	if event == nil {
+		return
+	}
+
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	ui.trackEvent(event)
+}
+
+// Write implements io.Writer, keeping the most recent log messages to show below the table
+func (ui *progressUI) Write(p []byte) (int, error) {
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		ui.logs = append(ui.logs, line)
+	}
+	if len(ui.logs) > tuiLogLines {
+		ui.logs = ui.logs[len(ui.logs)-tuiLogLines:]
+	}
+	return len(p), nil
+}
+
+// redraw overwrites the previous frame with the current state
+func (ui *progressUI) redraw() {
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	ui.updateUsage(ui.usage)
+	frame := ui.render(time.Now())
+
+	var sb strings.Builder
+	if ui.lines > 0 {
+		// Move to the start of the previous frame and clear everything below it
+		sb.WriteString(fmt.Sprintf("\x1b[%dA\r\x1b[J", ui.lines))
+	}
+	sb.WriteString(frame)
+	ui.lines = strings.Count(frame, "\n")
+
+	_, _ = io.WriteString(ui.out, sb.String())
+}
+
+// render formats the table and recent log messages
+// The caller must hold the mutex
+func (ui *progressUI) render(now time.Time) string {
+	width := len("AGENT")
+	for _, id := range ui.order {
+		if len(id) > width {
+			width = len(id)
+		}
+	}
+
+	var sb strings.Builder
+	row := func(agent, status, events, tokens, cost, elapsed, activity string) {
+		sb.WriteString(fmt.Sprintf("%-*s  %-8s  %6s  %8s  %7s  %7s  %s\n", width, agent, status, events, tokens, cost, elapsed, activity))
+	}
+
+	row("AGENT", "STATUS", "EVENTS", "TOKENS", "COST", "ELAPSED", "ACTIVITY")
+	for _, id := range ui.order {
+		progress := ui.agents[id]
+
+		cost := "-"
+		if progress.cost > 0 {
+			cost = fmt.Sprintf("$%.2f", progress.cost)
+		}
+
+		row(id, progress.status,
+			fmt.Sprintf("%d", progress.events),
+			fmt.Sprintf("%d", progress.tokens),
+			cost,
+			progress.elapsed(now).Round(time.Second).String(),
+			truncate(progress.snippet, tuiSnippetWidth))
+	}
+
+	if len(ui.logs) > 0 {
+		sb.WriteString("\n")
+		for _, line := range ui.logs {
+			sb.WriteString(truncate(line, width+tuiSnippetWidth+50))
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// firstLine returns the first non-blank line of text
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// truncate shortens text to at most width characters, marking the cut with an ellipsis
+func truncate(text string, width int) string {
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:width-1]) + "…"
+}
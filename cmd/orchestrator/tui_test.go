@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressUI(t *testing.T) {
+	var out bytes.Buffer
+	ui := newProgressUI(&out, []string{"codex", "claude"})
+
+	thinking, err := protocol.NewEvent(protocol.EventTypeThinking, "claude", 1).WithPayload(protocol.ThinkingPayload{Content: "\nReading the failing test\nthen fixing it"})
+	require.NoError(t, err)
+	edit, err := protocol.NewEvent(protocol.EventTypeAction, "codex", 1).WithPayload(protocol.ActionPayload{ActionType: "edit", FilePath: "main.go"})
+	require.NoError(t, err)
+
+	ui.SetStatus("claude", engine.AgentRunning)
+	ui.TrackEvent(thinking)
+	ui.TrackEvent(protocol.NewEvent(protocol.EventTypeAction, "claude", 2)) // Malformed payloads keep the last snippet
+	ui.SetUsage("claude", &core.TokenCounter{InputTokens: 1000, OutputTokens: 234, CostUSD: 0.5})
+	ui.SetStatus("codex", engine.AgentRunning)
+	ui.TrackEvent(edit)
+
+	// A stopped agent stays stopped when its goroutine later finishes
+	ui.SetStatus("codex", engine.AgentStopped)
+	ui.SetStatus("codex", engine.AgentDone)
+
+	ui.mutex.Lock()
+	frame := ui.render(time.Now())
+	ui.mutex.Unlock()
+
+	lines := strings.Split(strings.TrimSuffix(frame, "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"AGENT", "STATUS", "EVENTS", "TOKENS", "COST", "ELAPSED", "ACTIVITY"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"claude", "running", "2", "1234", "$0.50", "0s", "Reading", "the", "failing", "test"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"codex", "stopped", "1", "0", "-", "0s", "edit", "main.go"}, strings.Fields(lines[2]))
+}
+
+func TestProgressUI_StartStop(t *testing.T) {
+	var out bytes.Buffer
+	ui := newProgressUI(&out, []string{"amp"})
+
+	require.NoError(t, setupLogging())
+	previous := logOutput.swap(io.Discard)
+	defer logOutput.swap(previous)
+
+	ui.Start(func() map[string]*core.TokenCounter {
+		return map[string]*core.TokenCounter{"amp": {OutputTokens: 42}}
+	})
+
+	// Log messages are kept below the table while it is shown
+	for i := 0; i < tuiLogLines+2; i++ {
+		slog.Info(fmt.Sprintf("message-%d", i))
+	}
+	ui.SetStatus("amp", engine.AgentDone)
+	ui.Stop()
+
+	assert.Equal(t, io.Discard, logOutput.swap(io.Discard), "Stopping restores log output")
+	assert.Contains(t, out.String(), "\x1b[", "Later frames overwrite earlier ones")
+
+	final := out.String()[strings.LastIndex(out.String(), "AGENT"):]
+	assert.Contains(t, final, "done")
+	assert.Contains(t, final, "42")
+	assert.NotContains(t, final, "msg=message-1\n", "Only the most recent log messages are shown")
+	assert.Contains(t, final, "msg=message-6\n")
+
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "héllo w…", truncate("héllo world", 8))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// testWatch tracks whether the repository's tests pass as its contents change
+type testWatch struct {
+	// state identifies the repository contents that were last tested
+	state string
+
+	// failing is true once the tests have failed, until they pass again
+	failing bool
+}
+
+// changed records the current repository state and reports whether it differs from the last one tested
+func (w *testWatch) changed(state string) bool {
+	if state == w.state {
+		return false
+	}
+	w.state = state
+	return true
+}
+
+// forget makes the next check test the repository again, even if it hasn't changed
+func (w *testWatch) forget() {
+	w.state = ""
+}
+
+// observe records a test outcome and reports whether the tests just started failing
+// Tests that keep failing don't count, so only one fix run starts until they pass again
+func (w *testWatch) observe(passed bool) bool {
+	started := !passed && !w.failing
+	w.failing = !passed
+	return started
+}
+
+// watchCommand tests the repository whenever it changes and starts a run to fix the tests when they start failing
+// It returns the process exit code
+func watchCommand(args []string) int {
+	fs := newRunFlags()
+	fs.Init("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 30*time.Second, "How often to check the repository for changes")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: orchestrator watch [flags]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	// Prompts are generated from the failing tests, and the repository being watched is the local checkout
+	// Uncommitted changes are always included, since that's where new failures usually come from
+	for _, conflict := range []struct {
+		set  bool
+		flag string
+	}{
+		{prompt != "", "--prompt"},
+		{issue != "", "--issue"},
+		{repoURL != "", "--repo-url"},
+		{dirty, "--include-dirty"},
+		{dryRunOnly, "--dry-run"},
+	} {
+		if conflict.set {
+			fmt.Printf("Error: %s cannot be used with watch\n", conflict.flag)
+			return 1
+		}
+	}
+	if *interval <= 0 {
+		fmt.Println("Error: --interval must be positive")
+		return 1
+	}
+
+	cfg := loadRunConfig()
+	if cfg == nil {
+		return 1
+	}
+	if cfg.TestCommand == "" {
+		fmt.Println("Error: watch needs a test_command in the configuration")
+		return 1
+	}
+
+	abs, err := filepath.Abs(repoPath)
+	if err != nil {
+		fmt.Printf("Error: failed to get absolute path: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	runner := engine.NewTestRunner(cfg, cfg.TestCommand, time.Duration(cfg.TimeoutSeconds)*time.Second)
+	fmt.Printf("Watching %s, checking every %s; a fix run starts when %q starts failing\n", abs, *interval, cfg.TestCommand)
+
+	var watch testWatch
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		checkTests(ctx, cfg, runner, abs, &watch)
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkTests runs the tests if the repository changed since they last ran, and starts a fix run if they started failing
+func checkTests(ctx context.Context, cfg *core.Config, runner *core.TestRunner, repo string, watch *testWatch) {
+	state, err := gitutil.WorkingTreeID(repo)
+	if err != nil {
+		slog.Warn("failed to read repository state", "error", err)
+		return
+	}
+	if !watch.changed(state) {
+		return
+	}
+
+	slog.Debug("repository changed, running tests", "state", state)
+	result, err := runner.Run(ctx, repo)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Warn("failed to run tests", "error", err)
+		watch.forget()
+		return
+	}
+
+	if !watch.observe(result.Success) {
+		if result.Success {
+			slog.Info("tests passing", "passed", result.PassedTests, "total", result.TotalTests)
+		} else {
+			slog.Info("tests still failing; waiting for them to pass before starting another fix run", "failed", result.FailedTests)
+		}
+		return
+	}
+
+	fmt.Printf("\n=== Tests started failing: %s ===\n", core.FormatResults(result))
+
+	// Agents start from the uncommitted changes when there are any, and --apply applies on top of them
+	clean, err := gitutil.IsClean(repo)
+	if err != nil {
+		slog.Warn("failed to check repository status", "error", err)
+	}
+	dirty = !clean
+
+	task := core.Task{Prompt: core.FixTestsPrompt(cfg.TestCommand, result)}
+	runID := core.NewRunID()
+	runResult, err := run(ctx, cfg, task, runID, newProgress(cfg))
+	notifyRun(ctx, cfg, runID, runResult, err)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestWatch(t *testing.T) {
+	var watch testWatch
+
+	assert.True(t, watch.changed("a"))
+	assert.False(t, watch.changed("a"), "An unchanged repository isn't tested again")
+	assert.False(t, watch.observe(true))
+
+	// Only the first failure starts a fix run
+	assert.True(t, watch.changed("b"))
+	assert.True(t, watch.observe(false))
+	assert.True(t, watch.changed("c"))
+	assert.False(t, watch.observe(false), "Tests that keep failing don't start another run")
+
+	// Once the tests pass again, the next failure starts a new run
+	assert.True(t, watch.changed("d"))
+	assert.False(t, watch.observe(true))
+	assert.True(t, watch.changed("e"))
+	assert.True(t, watch.observe(false))
+
+	// A repository that fails from the start counts as starting to fail
+	var fresh testWatch
+	assert.True(t, fresh.observe(false))
+
+	watch.forget()
+	assert.True(t, watch.changed("e"), "A forgotten state is tested again")
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/github"
+)
+
+// maxWebhookBytes is the largest webhook delivery or chat command read, GitHub's own limit on payloads
+const maxWebhookBytes = 25 << 20
+
+// webhookLabel is recorded with every task started by a webhook
+const webhookLabel = "webhook"
+
+// collaboratorAssociations are the GitHub author associations of users with access to a repository
+// Comments by anyone else never start runs: on a fork's pull request, the run would execute the fork's code
+var collaboratorAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// webhookTrigger is a webhook delivery that starts a run
+type webhookTrigger struct {
+	// repo is the repository's full name, checked against the configured repos
+	repo string
+
+	// request is the task to queue
+	request submitRequest
+
+	// pull names a GitHub pull request whose head branch the run starts from, once fetched
+	pull *github.IssueRef
+}
+
+// handleGitHubWebhook starts runs from labelled issues and command comments delivered by GitHub
+func (s *server) handleGitHubWebhook(w http.ResponseWriter, req *http.Request) {
+	cfg := s.watcher.Current().Webhooks
+	body, ok := readWebhook(w, req, cfg)
+	if !ok {
+		return
+	}
+	if !validGitHubSignature(cfg.Secret, body, req.Header.Get("X-Hub-Signature-256")) {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid webhook signature"))
+		return
+	}
+
+	trigger, reason, err := parseGitHubWebhook(req.Header.Get("X-GitHub-Event"), body, cfg)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if trigger != nil && trigger.pull != nil {
+		// A command on a pull request works on its branch, which may be in a fork
+		head, err := s.githubClient(trigger.pull.Host).PullRequestHead(req.Context(), *trigger.pull)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		trigger.request.Repo, trigger.request.BaseRef = head.CloneURL, head.Ref
+		trigger.request.commit = &commitTarget{
+			host:      trigger.pull.Host,
+			owner:     trigger.pull.Owner,
+			repo:      trigger.pull.Repo,
+			sha:       head.SHA,
+			serverURL: serverBaseURL(req, s.watcher.Current().Chat.ServerURL),
+		}
+	}
+	s.startWebhookRun(w, trigger, reason, cfg)
+}
+
+// handleGitLabWebhook starts runs from labelled issues and command comments delivered by GitLab
+func (s *server) handleGitLabWebhook(w http.ResponseWriter, req *http.Request) {
+	cfg := s.watcher.Current().Webhooks
+	body, ok := readWebhook(w, req, cfg)
+	if !ok {
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(cfg.Secret), []byte(req.Header.Get("X-Gitlab-Token"))) != 1 {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid webhook token"))
+		return
+	}
+
+	trigger, reason, err := parseGitLabWebhook(req.Header.Get("X-Gitlab-Event"), body, cfg)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.startWebhookRun(w, trigger, reason, cfg)
+}
+
+// readWebhook reads a delivery's body, writing an error response if webhooks are off or it can't be read
+func readWebhook(w http.ResponseWriter, req *http.Request, cfg core.WebhooksConfig) ([]byte, bool) {
+	if !cfg.Enabled() {
+		writeError(w, http.StatusNotFound, fmt.Errorf("webhooks are not configured"))
+		return nil, false
+	}
+	body, err := readBody(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return body, true
+}
+
+// readBody reads a request's body, which signatures are checked against before it is parsed
+func readBody(req *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+	return body, nil
+}
+
+// startWebhookRun queues the run a delivery triggers, or acknowledges a delivery that triggers nothing
+// Deliveries that are ignored still succeed, so the forge doesn't report the webhook as failing
+func (s *server) startWebhookRun(w http.ResponseWriter, trigger *webhookTrigger, reason string, cfg core.WebhooksConfig) {
+	if trigger == nil {
+		writeJSON(w, http.StatusOK, map[string]string{"ignored": reason})
+		return
+	}
+	if !cfg.AllowsRepo(trigger.repo) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("repository %s is not allowed to start runs", trigger.repo))
+		return
+	}
+
+	r, err := s.submit(trigger.request)
+	if err != nil {
+		writeError(w, submitErrorStatus(err), err)
+		return
+	}
+	w.Header().Set("Location", "/runs/"+r.id)
+	writeJSON(w, http.StatusAccepted, r.view())
+}
+
+// validGitHubSignature checks a delivery's X-Hub-Signature-256 header, an HMAC of the body keyed with the secret
+func validGitHubSignature(secret string, body []byte, signature string) bool {
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// githubWebhook is the part of a GitHub issues or issue_comment delivery that is used
+type githubWebhook struct {
+	Action string `json:"action"`
+	Label  *struct {
+		Name string `json:"name"`
+	} `json:"label"`
+	Issue      *github.Issue   `json:"issue"`
+	Comment    *github.Comment `json:"comment"`
+	Repository struct {
+		Name          string `json:"name"`
+		FullName      string `json:"full_name"`
+		HTMLURL       string `json:"html_url"`
+		CloneURL      string `json:"clone_url"`
+		DefaultBranch string `json:"default_branch"`
+		Owner         struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+}
+
+// parseGitHubWebhook returns the run a GitHub delivery triggers, or why it triggers none
+// An issue triggers a run when the trigger label is added to it, and an issue or pull request when a comment
+// on it by a collaborator begins with the trigger command. The results are commented on the issue once the run finishes
+func parseGitHubWebhook(event string, body []byte, cfg core.WebhooksConfig) (*webhookTrigger, string, error) {
+	if event != "issues" && event != "issue_comment" {
+		return nil, fmt.Sprintf("%q events don't start runs", event), nil
+	}
+	var payload githubWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, "", fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if payload.Issue == nil {
+		return nil, "", fmt.Errorf("invalid webhook payload: no issue")
+	}
+
+	repo := payload.Repository
+	host := github.DefaultHost
+	if u, err := url.Parse(repo.HTMLURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	source := &issueSource{
+		ref:   github.IssueRef{Host: host, Owner: repo.Owner.Login, Repo: repo.Name, Number: payload.Issue.Number},
+		issue: payload.Issue,
+	}
+
+	var instructions string
+	switch {
+	case event == "issues" && payload.Action == "labeled":
+		if payload.Label == nil || !strings.EqualFold(payload.Label.Name, cfg.TriggerLabel()) {
+			return nil, "the label added doesn't start runs", nil
+		}
+	case event == "issue_comment" && payload.Action == "created" && payload.Comment != nil:
+		// Bots, such as an app posting a run's results, never start runs
+		if strings.HasSuffix(payload.Comment.User.Login, "[bot]") {
+			return nil, "comments by bots don't start runs", nil
+		}
+		if !slices.Contains(collaboratorAssociations, payload.Comment.AuthorAssociation) {
+			return nil, "comments by users who aren't collaborators don't start runs", nil
+		}
+		rest, ok := commandArgs(payload.Comment.Body, cfg.TriggerCommand())
+		if !ok {
+			return nil, "the comment doesn't begin with " + cfg.TriggerCommand(), nil
+		}
+		instructions = rest
+	default:
+		return nil, fmt.Sprintf("%q %s events don't start runs", payload.Action, event), nil
+	}
+
+	task := source.task(instructions)
+	trigger := &webhookTrigger{
+		repo: repo.FullName,
+		request: submitRequest{
+			Prompt:  task.Prompt,
+			Repo:    repo.CloneURL,
+			BaseRef: repo.DefaultBranch,
+			Labels:  []string{webhookLabel},
+			issue:   source,
+		},
+	}
+	if payload.Issue.IsPullRequest() {
+		trigger.pull = &source.ref
+	}
+	return trigger, "", nil
+}
+
+// gitlabProject is the project a GitLab delivery is about, or the source project of a merge request
+type gitlabProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	GitHTTPURL        string `json:"git_http_url"`
+	DefaultBranch     string `json:"default_branch"`
+}
+
+// gitlabIssue is a GitLab issue or merge request in a delivery
+type gitlabIssue struct {
+	IID          int            `json:"iid"`
+	Title        string         `json:"title"`
+	Description  string         `json:"description"`
+	URL          string         `json:"url"`
+	SourceBranch string         `json:"source_branch"`
+	Source       *gitlabProject `json:"source"`
+}
+
+// gitlabLabel is a label in a GitLab delivery
+type gitlabLabel struct {
+	Title string `json:"title"`
+}
+
+// gitlabWebhook is the part of a GitLab issue or note delivery that is used
+type gitlabWebhook struct {
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project          gitlabProject `json:"project"`
+	ObjectAttributes struct {
+		gitlabIssue
+		Action       string `json:"action"`
+		Note         string `json:"note"`
+		NoteableType string `json:"noteable_type"`
+	} `json:"object_attributes"`
+	Issue        *gitlabIssue `json:"issue"`
+	MergeRequest *gitlabIssue `json:"merge_request"`
+	Changes      struct {
+		Labels *struct {
+			Previous []gitlabLabel `json:"previous"`
+			Current  []gitlabLabel `json:"current"`
+		} `json:"labels"`
+	} `json:"changes"`
+}
+
+// parseGitLabWebhook returns the run a GitLab delivery triggers, or why it triggers none
+// An issue triggers a run when the trigger label is added to it, and an issue or merge request when a note
+// on it by one of the configured GitLab users begins with the trigger command; merge requests are worked on in their source branch
+func parseGitLabWebhook(event string, body []byte, cfg core.WebhooksConfig) (*webhookTrigger, string, error) {
+	if event != "Issue Hook" && event != "Note Hook" {
+		return nil, fmt.Sprintf("%q events don't start runs", event), nil
+	}
+	var payload gitlabWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, "", fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	project := payload.Project
+	repoURL, branch := project.GitHTTPURL, project.DefaultBranch
+	var issue *gitlabIssue
+	var instructions string
+	mergeRequest := false
+
+	switch event {
+	case "Issue Hook":
+		if payload.Changes.Labels == nil || !labelAdded(payload.Changes.Labels.Previous, payload.Changes.Labels.Current, cfg.TriggerLabel()) {
+			return nil, "the trigger label wasn't added", nil
+		}
+		issue = &payload.ObjectAttributes.gitlabIssue
+	case "Note Hook":
+		if payload.ObjectAttributes.Action != "" && payload.ObjectAttributes.Action != "create" {
+			return nil, "only new comments start runs", nil
+		}
+		if !cfg.AllowsGitLabUser(payload.User.Username) {
+			return nil, "comments by users not in webhooks.gitlab_users don't start runs", nil
+		}
+		rest, ok := commandArgs(payload.ObjectAttributes.Note, cfg.TriggerCommand())
+		if !ok {
+			return nil, "the comment doesn't begin with " + cfg.TriggerCommand(), nil
+		}
+		instructions = rest
+		switch payload.ObjectAttributes.NoteableType {
+		case "Issue":
+			issue = payload.Issue
+		case "MergeRequest":
+			issue, mergeRequest = payload.MergeRequest, true
+		}
+		if issue == nil {
+			return nil, "only comments on issues and merge requests start runs", nil
+		}
+		if mergeRequest && issue.Source != nil && issue.SourceBranch != "" {
+			repoURL, branch = issue.Source.GitHTTPURL, issue.SourceBranch
+		}
+	}
+
+	return &webhookTrigger{
+		repo: project.PathWithNamespace,
+		request: submitRequest{
+			Prompt:  gitlabPrompt(project.PathWithNamespace, issue, mergeRequest, instructions),
+			Repo:    repoURL,
+			BaseRef: branch,
+			Labels:  []string{webhookLabel},
+		},
+	}, "", nil
+}
+
+// gitlabPrompt builds a task prompt from a GitLab issue or merge request, like github.Prompt does for GitHub
+func gitlabPrompt(project string, issue *gitlabIssue, mergeRequest bool, instructions string) string {
+	ref := fmt.Sprintf("%s#%d", project, issue.IID)
+	kind, verb := "issue", "Fix"
+	if mergeRequest {
+		ref = fmt.Sprintf("%s!%d", project, issue.IID)
+		kind, verb = "merge request", "Address"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s: %s\n\n", verb, ref, issue.Title)
+	fmt.Fprintf(&sb, "Make the changes requested in GitLab %s %s", kind, ref)
+	if issue.URL != "" {
+		fmt.Fprintf(&sb, " (%s)", issue.URL)
+	}
+	sb.WriteString(".\n")
+	if description := strings.TrimSpace(issue.Description); description != "" {
+		fmt.Fprintf(&sb, "\nDescription:\n\n%s\n", description)
+	}
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		sb.WriteString("\nAdditional instructions:\n" + instructions + "\n")
+	}
+	return sb.String()
+}
+
+// commandArgs returns the rest of a comment that begins with command, and whether it does
+func commandArgs(comment, command string) (string, bool) {
+	comment = strings.TrimSpace(comment)
+	rest, ok := strings.CutPrefix(comment, command)
+	if !ok || (rest != "" && !strings.ContainsAny(rest[:1], " \t\r\n")) {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// labelAdded reports whether label is among the current labels but wasn't among the previous ones
+func labelAdded(previous, current []gitlabLabel, label string) bool {
+	has := func(labels []gitlabLabel) bool {
+		for _, l := range labels {
+			if strings.EqualFold(l.Title, label) {
+				return true
+			}
+		}
+		return false
+	}
+	return has(current) && !has(previous)
+}
+
+// reportToIssue comments the outcome of a run started from a GitHub issue on the issue
+func (s *server) reportToIssue(ctx context.Context, r *serverRun, cfg *core.Config, result *core.TaskResult) {
+	if !issueComment || r.issue == nil || result == nil {
+		return
+	}
+	source := *r.issue
+	source.client = s.githubClient(source.ref.Host)
+	if err := source.report(ctx, cfg, result); err != nil {
+		slog.Warn("failed to comment on issue", "run", r.id, "issue", source.ref.String(), "error", err)
+	}
+}
+
+// reportStatus sets the status of the commit a webhook started a run on: pending while the run is in progress,
+// and its outcome, with a link to its report, once result or err is set
+// The status is set even when the server is shutting down, so it isn't left pending
+func (s *server) reportStatus(ctx context.Context, r *serverRun, result *core.TaskResult, err error) {
+	if r.commit == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	client := s.githubClient(r.commit.host)
+	runURL := r.commit.serverURL + "/runs/" + url.PathEscape(r.id)
+	if result == nil && err == nil {
+		r.commit.set(ctx, client, r.id, pendingStatus(r.id, runURL))
+		return
+	}
+	r.commit.set(ctx, client, r.id, finishedStatus(result, err, runURL+"/"+core.ReportHTMLFile))
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const webhookConfig = `
+webhooks:
+  secret: s3cret
+  repos: [octo/app, group/project]
+  gitlab_users: [carol]
+`
+
+// deliver posts a webhook delivery with the given headers and returns the response status and JSON body
+func deliver(t *testing.T, url string, headers map[string]string, body string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var out map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	return resp.StatusCode, out
+}
+
+// githubDelivery returns the headers GitHub sends with an event, signed with secret
+func githubDelivery(event, secret, body string) map[string]string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return map[string]string{"X-GitHub-Event": event, "X-Hub-Signature-256": "sha256=" + hex.EncodeToString(mac.Sum(nil))}
+}
+
+// recordTasks returns a runTask that sends each task it is given on a channel and produces a patch
+func recordTasks() (chan core.Task, func(context.Context, *core.Config, core.Task, string, engine.Progress) (*core.TaskResult, error)) {
+	tasks := make(chan core.Task, 10)
+	return tasks, func(_ context.Context, _ *core.Config, task core.Task, runID string, _ engine.Progress) (*core.TaskResult, error) {
+		tasks <- task
+		best := &core.PatchResult{AgentID: "claude", Score: 10, Reason: "Tests now passing", Diff: testPatch}
+		return &core.TaskResult{Task: task, RunID: runID, Best: best, Candidates: []*core.PatchResult{best}}, nil
+	}
+}
+
+// receiveTask waits for a run to be given a task
+func receiveTask(t *testing.T, tasks chan core.Task) core.Task {
+	select {
+	case task := <-tasks:
+		return task
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a run")
+		return core.Task{}
+	}
+}
+
+func TestWebhooks_GitHub(t *testing.T) {
+	// A fake GitHub API serves a pull request in a fork and records comments and commit statuses
+	comments := make(chan string, 10)
+	statuses := make(chan github.CommitStatus, 10)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/repos/octo/app/pulls/7":
+			io.WriteString(w, `{"head": {"ref": "feature", "sha": "abc123", "repo": {"clone_url": "https://github.com/fork/app.git"}}}`)
+		case req.Method == http.MethodPost && req.URL.Path == "/repos/octo/app/statuses/abc123":
+			var status github.CommitStatus
+			json.NewDecoder(req.Body).Decode(&status)
+			statuses <- status
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": 1}`)
+		case req.Method == http.MethodPost && req.URL.Path == "/repos/octo/app/issues/5/comments":
+			var comment struct{ Body string }
+			json.NewDecoder(req.Body).Decode(&comment)
+			comments <- comment.Body
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"html_url": "https://github.com/octo/app/issues/5#issuecomment-1"}`)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer api.Close()
+
+	// Results are commented on issues by default, as --issue-comment is set when flags are parsed
+	issueComment = true
+	t.Cleanup(func() { issueComment = false })
+
+	tasks, runTask := recordTasks()
+	srv, httpServer := newTestServerWithConfig(t, webhookConfig, runTask)
+	srv.githubClient = func(host string) *github.Client {
+		client := github.NewClient(host, "token")
+		client.BaseURL = api.URL
+		return client
+	}
+	url := httpServer.URL + "/webhooks/github"
+
+	repository := `"repository": {"name": "app", "full_name": "octo/app", "html_url": "https://github.com/octo/app", "clone_url": "https://github.com/octo/app.git", "default_branch": "main", "owner": {"login": "octo"}}`
+	labeled := `{"action": "labeled", "label": {"name": "orchestrator"}, "issue": {"number": 5, "title": "Crash on empty input", "body": "It panics", "user": {"login": "alice"}}, ` + repository + `}`
+
+	status, _ := deliver(t, url, githubDelivery("issues", "wrong", labeled), labeled)
+	assert.Equal(t, http.StatusUnauthorized, status, "Deliveries signed with another secret are rejected")
+
+	status, body := deliver(t, url, githubDelivery("ping", "s3cret", `{"zen": "hi"}`), `{"zen": "hi"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body["ignored"], "ping")
+
+	// Adding the label runs the issue against the repository's default branch, and the result is commented back
+	status, body = deliver(t, url, githubDelivery("issues", "s3cret", labeled), labeled)
+	require.Equal(t, http.StatusAccepted, status, body)
+	task := receiveTask(t, tasks)
+	assert.Equal(t, "https://github.com/octo/app.git", task.Repo)
+	assert.Equal(t, "main", task.BaseRef)
+	assert.Equal(t, []string{webhookLabel}, task.Labels)
+	assert.Contains(t, task.Prompt, "Crash on empty input")
+	assert.Contains(t, task.Prompt, "It panics")
+	select {
+	case comment := <-comments:
+		assert.Contains(t, comment, "**Best patch:** `claude`")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the issue comment")
+	}
+
+	// A command on a pull request runs on its head branch, with the rest of the comment as instructions
+	command := `{"action": "created", "comment": {"body": "/orchestrate also add a test", "user": {"login": "bob"}, "author_association": "COLLABORATOR"}, "issue": {"number": 7, "title": "Add retries", "pull_request": {}, "user": {"login": "bob"}}, ` + repository + `}`
+	status, body = deliver(t, url, githubDelivery("issue_comment", "s3cret", command), command)
+	require.Equal(t, http.StatusAccepted, status, body)
+	task = receiveTask(t, tasks)
+	assert.Equal(t, "https://github.com/fork/app.git", task.Repo)
+	assert.Equal(t, "feature", task.BaseRef)
+	assert.Contains(t, task.Prompt, "Additional instructions:\nalso add a test\n")
+
+	// The pull request's head shows the run as pending, then its outcome with a link to the report
+	for _, want := range []string{github.StatusPending, github.StatusFailure} {
+		select {
+		case status := <-statuses:
+			assert.Equal(t, want, status.State)
+			assert.Equal(t, statusContext, status.Context)
+			assert.True(t, strings.HasPrefix(status.TargetURL, httpServer.URL+"/runs/"), status.TargetURL)
+			if want == github.StatusFailure {
+				assert.Equal(t, "Best patch (claude) scored 10; no tests were run", status.Description)
+				assert.True(t, strings.HasSuffix(status.TargetURL, "/"+core.ReportHTMLFile), status.TargetURL)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the %s commit status", want)
+		}
+	}
+
+	for name, payload := range map[string]string{
+		"another label":                 strings.Replace(labeled, `"name": "orchestrator"`, `"name": "bug"`, 1),
+		"another command":               strings.Replace(command, "/orchestrate also", "/orchestrated also", 1),
+		"comment by a bot":              strings.Replace(command, `"login": "bob"}, "author_association"`, `"login": "ci[bot]"}, "author_association"`, 1),
+		"comment by a non-collaborator": strings.Replace(command, `"COLLABORATOR"`, `"CONTRIBUTOR"`, 1),
+		"edited comment":                strings.Replace(command, `"created"`, `"edited"`, 1),
+		"unlabeled issue":               strings.Replace(labeled, `"labeled"`, `"unlabeled"`, 1),
+	} {
+		event := "issue_comment"
+		if strings.Contains(payload, `"label"`) {
+			event = "issues"
+		}
+		status, body := deliver(t, url, githubDelivery(event, "s3cret", payload), payload)
+		assert.Equal(t, http.StatusOK, status, name)
+		assert.NotEmpty(t, body["ignored"], name)
+	}
+
+	other := strings.ReplaceAll(labeled, "octo/app", "octo/other")
+	status, _ = deliver(t, url, githubDelivery("issues", "s3cret", other), other)
+	assert.Equal(t, http.StatusForbidden, status, "Repositories not listed can't start runs")
+}
+
+func TestWebhooks_GitLab(t *testing.T) {
+	tasks, runTask := recordTasks()
+	_, httpServer := newTestServerWithConfig(t, webhookConfig, runTask)
+	url := httpServer.URL + "/webhooks/gitlab"
+
+	project := `"project": {"path_with_namespace": "group/project", "git_http_url": "https://gitlab.com/group/project.git", "default_branch": "main"}`
+	note := `{"object_kind": "note", "user": {"username": "carol"}, ` + project + `, "object_attributes": {"note": "/orchestrate keep it small", "noteable_type": "MergeRequest"}, "merge_request": {"iid": 3, "title": "Speed up parsing", "description": "Parsing is slow", "url": "https://gitlab.com/group/project/-/merge_requests/3", "source_branch": "faster", "source": {"git_http_url": "https://gitlab.com/carol/project.git"}}}`
+
+	status, _ := deliver(t, url, map[string]string{"X-Gitlab-Event": "Note Hook", "X-Gitlab-Token": "wrong"}, note)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// A command on a merge request runs on its source branch
+	headers := map[string]string{"X-Gitlab-Event": "Note Hook", "X-Gitlab-Token": "s3cret"}
+	status, body := deliver(t, url, headers, note)
+	require.Equal(t, http.StatusAccepted, status, body)
+	task := receiveTask(t, tasks)
+	assert.Equal(t, "https://gitlab.com/carol/project.git", task.Repo)
+	assert.Equal(t, "faster", task.BaseRef)
+	assert.Contains(t, task.Prompt, "Address group/project!3: Speed up parsing\n")
+	assert.Contains(t, task.Prompt, "Parsing is slow")
+	assert.Contains(t, task.Prompt, "Additional instructions:\nkeep it small\n")
+
+	// GitLab doesn't say what access a comment's author has, so only the configured users' comments start runs
+	stranger := strings.Replace(note, `"username": "carol"`, `"username": "mallory"`, 1)
+	status, body = deliver(t, url, headers, stranger)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, body["ignored"])
+
+	// Adding the label to an issue runs it against the default branch, but updates that keep it don't
+	issue := `{"object_kind": "issue", ` + project + `, "object_attributes": {"iid": 9, "title": "Typo in README", "description": "", "action": "update"}, "changes": {"labels": {"previous": [], "current": [{"title": "orchestrator"}]}}}`
+	headers["X-Gitlab-Event"] = "Issue Hook"
+	status, body = deliver(t, url, headers, issue)
+	require.Equal(t, http.StatusAccepted, status, body)
+	task = receiveTask(t, tasks)
+	assert.Equal(t, "https://gitlab.com/group/project.git", task.Repo)
+	assert.Equal(t, "main", task.BaseRef)
+	assert.Contains(t, task.Prompt, "Fix group/project#9: Typo in README\n")
+
+	kept := strings.Replace(issue, `"previous": []`, `"previous": [{"title": "orchestrator"}]`, 1)
+	status, body = deliver(t, url, headers, kept)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, body["ignored"])
+}
+
+func TestWebhooks_Disabled(t *testing.T) {
+	_, httpServer := newTestServer(t, nil)
+	status, _ := deliver(t, httpServer.URL+"/webhooks/github", githubDelivery("issues", "", "{}"), "{}")
+	assert.Equal(t, http.StatusNotFound, status, "Webhooks are off without a secret")
+}
+
+func TestCommandArgs(t *testing.T) {
+	for comment, want := range map[string]string{
+		"/orchestrate":                "",
+		"  /orchestrate fix it\n":     "fix it",
+		"/orchestrate\nmore\ndetails": "more\ndetails",
+	} {
+		got, ok := commandArgs(comment, "/orchestrate")
+		assert.True(t, ok, comment)
+		assert.Equal(t, want, got, comment)
+	}
+	for _, comment := range []string{"/orchestrated", "please /orchestrate", ""} {
+		_, ok := commandArgs(comment, "/orchestrate")
+		assert.False(t, ok, comment)
+	}
+}
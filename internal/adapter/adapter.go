@@ -2,6 +2,7 @@ package adapter
 
 import (
 	"context"
+	"time"
 
 	"github.com/brettsmith212/orchestrator/internal/protocol"
 )
@@ -19,6 +20,59 @@ type Adapter interface {
 	Shutdown() error
 }
 
+// Describer is implemented by adapters that run a local command
+// It lets callers show what an agent would execute without starting it
+type Describer interface {
+	// Command returns the program and arguments that Start would run for a worktree and prompt
+	Command(worktreePath string, prompt string) (string, []string)
+}
+
+// ContextReceiver is implemented by adapters that can give an agent files relevant to the task
+type ContextReceiver interface {
+	// SetContextFiles sets the files, relative to the worktree, given to the agent when it starts
+	// It reports whether the agent receives them; adapters may need configuration to do so
+	SetContextFiles(files []string) bool
+}
+
+// ProcessReporter is implemented by adapters that run the agent as a local process
+// It lets the watchdog measure the memory and CPU time the agent's processes use
+type ProcessReporter interface {
+	// Pid returns the process ID of the running agent, or 0 if it hasn't started
+	Pid() int
+}
+
+// Messenger is implemented by adapters that can deliver orchestrator events to a running agent
+type Messenger interface {
+	// SendEvent delivers an event, such as a watchdog warning, to the agent
+	// It reports whether the agent receives events; adapters may need configuration to do so
+	SendEvent(event *protocol.Event) (bool, error)
+}
+
+// EventStats describes how well the consumer of an agent's events kept up with it
+type EventStats struct {
+	// Buffer is how many events may wait for the consumer before the buffer's overflow policy applies
+	Buffer int
+
+	// Peak is the most events that waited at once
+	Peak int
+
+	// Dropped counts low-value events, such as thinking, dropped because the buffer was full
+	Dropped int
+
+	// Coalesced counts low-value events merged into the event queued before them because the buffer was full
+	Coalesced int
+
+	// Blocked is how long reading the agent's output waited for room in the buffer
+	Blocked time.Duration
+}
+
+// EventStatsReporter is implemented by adapters that buffer an agent's events
+// It shows whether a chatty agent outpaced the orchestrator, and what that cost
+type EventStatsReporter interface {
+	// EventStats returns the buffer's statistics for the agent's latest run
+	EventStats() EventStats
+}
+
 // Config represents the common configuration structure for adapters
 type Config struct {
 	// ID is a unique identifier for the adapter instance
@@ -2,10 +2,10 @@ package amp
 
 import (
 	"fmt"
-	"os/exec"
 
 	"github.com/brettsmith212/orchestrator/internal/adapter"
 	"github.com/brettsmith212/orchestrator/internal/adapter/cli"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
 )
 
 // Default arguments for Amp CLI
@@ -34,17 +34,12 @@ func New(id string, config map[string]interface{}) (adapter.Adapter, error) {
 	if ampConfig.BinaryPath != "" {
 		command = ampConfig.BinaryPath
 	} else {
-		// Check if amp exists using `which amp`
-		whichCmd := exec.Command("which", "amp")
-		output, err := whichCmd.Output()
+		// Look for amp on PATH and where npm installs it, with its extension on Windows
+		path, err := procutil.LookPath("amp")
 		if err != nil {
 			return nil, fmt.Errorf("amp binary not found. Please install it using 'npm install -g @sourcegraph/amp' or specify binary_path in your configuration")
 		}
-		
-		// Trim newline from output and use the full path
-		if len(output) > 0 {
-			command = string(output[:len(output)-1])
-		}
+		command = path
 	}
 
 	// Combine default arguments with custom arguments
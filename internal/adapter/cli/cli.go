@@ -3,14 +3,24 @@ package cli
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"os"
 	"os/exec"
 	"sync"
+	"time"
 
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
 	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/brettsmith212/orchestrator/internal/sandbox"
 )
 
+// DefaultWorktreeFlag is the flag that passes the worktree path to agent commands
+const DefaultWorktreeFlag = "-w"
+
 // Adapter implements the adapter.Adapter interface for CLI-based AI coding agents
 type Adapter struct {
 	// ID is the unique identifier for this agent instance
@@ -22,70 +32,177 @@ type Adapter struct {
 	// Args are command-line arguments to pass to the command
 	args []string
 
+	// worktreeFlag is the flag that passes the worktree path to the command (empty to omit it)
+	worktreeFlag string
+
+	// contextFlag is the flag that passes each context file to the command (empty if it takes none)
+	contextFlag string
+
+	// contextFiles are the files relevant to the task, relative to the worktree
+	contextFiles []string
+
+	// stdinEvents opens the command's stdin for orchestrator events
+	stdinEvents bool
+
+	// sandbox runs the command in a container that sees only the worktree (nil runs it directly)
+	sandbox *sandbox.Container
+
+	// eventBuffer is how many events may wait for the orchestrator, and overflow what happens once they fill it
+	eventBuffer int
+	overflow    string
+
+	// queue buffers the events of the latest run
+	queue *eventQueue
+
 	// mutex protects concurrent access to cmd
 	mutex sync.Mutex
 
 	// cmd is the running command process
 	cmd *exec.Cmd
+
+	// group holds cmd and every process it starts, so stopping the agent stops them all
+	group *procutil.Group
+
+	// stdin writes events to the running command (nil unless stdinEvents is set)
+	// stdinMutex serializes writes, which can block, without holding mutex
+	stdin      io.WriteCloser
+	stdinMutex sync.Mutex
 }
 
 // New creates a new CLI adapter
 func New(id, command string, args []string) *Adapter {
 	return &Adapter{
-		id:      id,
-		command: command,
-		args:    args,
+		id:           id,
+		command:      command,
+		args:         args,
+		worktreeFlag: DefaultWorktreeFlag,
+		eventBuffer:  DefaultEventBuffer,
+		overflow:     DefaultOverflow,
 	}
 }
 
+// SetWorktreeFlag changes the flag used to pass the worktree path to the command
+// An empty flag omits the worktree path; the command still runs inside the worktree
+func (a *Adapter) SetWorktreeFlag(flag string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.worktreeFlag = flag
+}
+
+// SetContextFlag sets the flag that passes each context file to the command, e.g. "--file"
+func (a *Adapter) SetContextFlag(flag string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.contextFlag = flag
+}
+
+// SetStdinEvents sets whether orchestrator events are written to the command's stdin, one JSON object per line
+// Commands that don't read events keep stdin closed, so they can't block waiting on it
+func (a *Adapter) SetStdinEvents(enabled bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.stdinEvents = enabled
+}
+
+// SetEventBuffer sets how many events may wait for the orchestrator, and the overflow policy once they fill the buffer
+func (a *Adapter) SetEventBuffer(size int, overflow string) error {
+	if size < 1 {
+		return fmt.Errorf("event_buffer must be at least 1, not %d", size)
+	}
+	switch overflow {
+	case OverflowBlock, OverflowCoalesce, OverflowDrop:
+	default:
+		return fmt.Errorf("event_overflow must be %s, %s, or %s, not '%s'", OverflowBlock, OverflowCoalesce, OverflowDrop, overflow)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.eventBuffer, a.overflow = size, overflow
+	return nil
+}
+
+// SetSandbox runs the command in containers described by container, with the worktree mounted at sandbox.Workdir
+func (a *Adapter) SetSandbox(container *sandbox.Container) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.sandbox = container
+}
+
+// SetContextFiles implements the adapter.ContextReceiver interface
+// The files are only passed to commands configured with a context flag
+func (a *Adapter) SetContextFiles(files []string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.contextFiles = files
+	return a.contextFlag != ""
+}
+
 // Start implements the adapter.Adapter interface
 func (a *Adapter) Start(ctx context.Context, worktreePath string, prompt string) (<-chan *protocol.Event, error) {
-	// Create output channel for events
-	eventCh := make(chan *protocol.Event, 10)
+	// Create output channel for events, which wait in the queue until the orchestrator takes them
+	eventCh := make(chan *protocol.Event)
 
-	// Prepare command with worktree path and prompt
+	// Create command with worktree path and prompt
 	a.mutex.Lock()
-	workingArgs := append([]string{}, a.args...)
-	
-	// Add working directory option if not already specified
-	hasWorkingDir := false
-	for _, arg := range workingArgs {
-		if arg == "-w" || arg == "--worktree" || arg == "--workdir" {
-			hasWorkingDir = true
-			break
+	container := ""
+	if a.sandbox != nil {
+		container = sandbox.NewName(a.id)
+		// An allowlisted container reaches the network only through its egress proxy, which must be up first
+		if err := a.sandbox.StartEgress(ctx, container); err != nil {
+			a.mutex.Unlock()
+			close(eventCh)
+			return nil, fmt.Errorf("failed to start the agent's egress proxy: %w", err)
 		}
 	}
-	
-	if !hasWorkingDir {
-		workingArgs = append(workingArgs, "-w", worktreePath)
+	command, workingArgs := a.commandLine(worktreePath, prompt, container)
+	a.cmd = exec.CommandContext(ctx, command, workingArgs...)
+	a.cmd.Dir = worktreePath
+	a.stdin = nil
+
+	// Open stdin for orchestrator events if the command reads them
+	if a.stdinEvents {
+		stdin, err := a.cmd.StdinPipe()
+		if err != nil {
+			a.mutex.Unlock()
+			a.removeContainer(container)
+			close(eventCh)
+			return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+		}
+		a.stdin = stdin
 	}
 	
-	// Add prompt as final argument
-	workingArgs = append(workingArgs, prompt)
-	
-	// Create command
-	a.cmd = exec.CommandContext(ctx, a.command, workingArgs...)
-	
 	// Get stdout pipe for reading events
 	stdout, err := a.cmd.StdoutPipe()
 	if err != nil {
 		a.mutex.Unlock()
+		a.removeContainer(container)
 		close(eventCh)
 		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
 	
-	// Start the command
-	err = a.cmd.Start()
+	// Start the command in a group of its own, so the tools it runs are stopped with it
+	group, err := procutil.Start(a.cmd)
 	if err != nil {
 		a.mutex.Unlock()
+		a.removeContainer(container)
 		close(eventCh)
 		return nil, fmt.Errorf("failed to start command: %w", err)
 	}
+	a.group = group
+	queue := newEventQueue(a.eventBuffer, a.overflow)
+	a.queue = queue
 	a.mutex.Unlock()
+	go queue.forward(ctx, eventCh)
 
 	// Process stdout in a goroutine
 	go func() {
-		defer close(eventCh)
+		defer queue.close()
 		
 		// Create a scanner for reading lines
 		scanner := bufio.NewScanner(stdout)
@@ -105,7 +222,7 @@ func (a *Adapter) Start(ctx context.Context, worktreePath string, prompt string)
 					Code:    "parse_error",
 				}
 				errorEvent, _ = errorEvent.WithPayload(errorPayload)
-				eventCh <- errorEvent
+				queue.push(ctx, errorEvent)
 				seq++
 				continue
 			}
@@ -115,6 +232,11 @@ func (a *Adapter) Start(ctx context.Context, worktreePath string, prompt string)
 				event.AgentID = a.id
 			}
 			
+			// Stamp the time the event was received if the agent didn't
+			if event.Timestamp.IsZero() {
+				event.Timestamp = time.Now().UTC()
+			}
+			
 			// Set sequence number if not present
 			if event.SequenceNum == 0 {
 				event.SequenceNum = seq
@@ -122,7 +244,7 @@ func (a *Adapter) Start(ctx context.Context, worktreePath string, prompt string)
 			}
 			
 			// Send the event
-			eventCh <- event
+			queue.push(ctx, event)
 		}
 		
 		// Check for scanner errors
@@ -133,11 +255,14 @@ func (a *Adapter) Start(ctx context.Context, worktreePath string, prompt string)
 				Code:    "io_error",
 			}
 			errorEvent, _ = errorEvent.WithPayload(errorPayload)
-			eventCh <- errorEvent
+			queue.push(ctx, errorEvent)
 		}
 		
 		// Wait for the command to finish
-		waitErr := a.cmd.Wait()
+		waitErr := group.Wait()
+
+		// A killed runtime CLI, such as on shutdown or cancellation, leaves its container running
+		a.removeContainer(container)
 		
 		// Send error event if command failed (not if it was just canceled)
 		if waitErr != nil && ctx.Err() == nil {
@@ -147,21 +272,143 @@ func (a *Adapter) Start(ctx context.Context, worktreePath string, prompt string)
 				Code:    "command_error",
 			}
 			errorEvent, _ = errorEvent.WithPayload(errorPayload)
-			eventCh <- errorEvent
+			queue.push(ctx, errorEvent)
 		}
 	}()
 
 	return eventCh, nil
 }
 
+// Command implements the adapter.Describer interface
+// A sandboxed command is described as the container runtime invocation that runs it
+func (a *Adapter) Command(worktreePath string, prompt string) (string, []string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	container := ""
+	if a.sandbox != nil {
+		container = sandbox.NewName(a.id)
+	}
+	return a.commandLine(worktreePath, prompt, container)
+}
+
+// commandLine returns the program and arguments that run the agent; the caller holds mutex
+// In a sandbox the command sees the worktree at sandbox.Workdir, in the named container
+func (a *Adapter) commandLine(worktreePath, prompt, container string) (string, []string) {
+	dir := worktreePath
+	if a.sandbox != nil {
+		worktreePath = sandbox.Workdir
+	}
+
+	workingArgs := append([]string{}, a.args...)
+
+	// Add working directory option if not already specified
+	hasWorkingDir := false
+	for _, arg := range workingArgs {
+		if arg == "-w" || arg == "--worktree" || arg == "--workdir" {
+			hasWorkingDir = true
+			break
+		}
+	}
+
+	if !hasWorkingDir && a.worktreeFlag != "" {
+		workingArgs = append(workingArgs, a.worktreeFlag, worktreePath)
+	}
+
+	// Pass each context file with its own flag
+	if a.contextFlag != "" {
+		for _, file := range a.contextFiles {
+			workingArgs = append(workingArgs, a.contextFlag, file)
+		}
+	}
+
+	// Add prompt as final argument
+	workingArgs = append(workingArgs, prompt)
+
+	if a.sandbox != nil {
+		return a.sandbox.Command(container, dir, a.command, workingArgs)
+	}
+	return a.command, workingArgs
+}
+
+// removeContainer removes a sandboxed command's container, which outlives the command if it was killed,
+// and its egress proxy, warning of any hosts outside its allowlist the agent tried to reach
+func (a *Adapter) removeContainer(container string) {
+	if a.sandbox == nil || container == "" {
+		return
+	}
+	if err := a.sandbox.Remove(container); err != nil {
+		slog.Warn("failed to remove agent container", "agent", a.id, "error", err)
+	}
+	denied, err := a.sandbox.StopEgress(container)
+	if err != nil {
+		slog.Warn("failed to remove agent egress proxy", "agent", a.id, "error", err)
+	}
+	if len(denied) > 0 {
+		slog.Warn("agent tried to reach hosts outside its network allowlist", "agent", a.id, "hosts", denied)
+	}
+}
+
+// SendEvent implements the adapter.Messenger interface
+// Events are only delivered to commands configured to read them from stdin
+func (a *Adapter) SendEvent(event *protocol.Event) (bool, error) {
+	a.mutex.Lock()
+	enabled, stdin := a.stdinEvents, a.stdin
+	a.mutex.Unlock()
+
+	if !enabled {
+		return false, nil
+	}
+	if stdin == nil {
+		return true, fmt.Errorf("agent is not running")
+	}
+
+	data, err := protocol.Marshal(event)
+	if err != nil {
+		return true, err
+	}
+
+	a.stdinMutex.Lock()
+	defer a.stdinMutex.Unlock()
+	if _, err := stdin.Write(append(data, '\n')); err != nil {
+		return true, fmt.Errorf("failed to write event to stdin: %w", err)
+	}
+	return true, nil
+}
+
+// EventStats implements the adapter.EventStatsReporter interface
+func (a *Adapter) EventStats() adapter.EventStats {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.queue == nil {
+		return adapter.EventStats{Buffer: a.eventBuffer}
+	}
+	return a.queue.statistics()
+}
+
+// Pid implements the adapter.ProcessReporter interface
+func (a *Adapter) Pid() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.cmd == nil || a.cmd.Process == nil {
+		return 0
+	}
+	return a.cmd.Process.Pid
+}
+
 // Shutdown implements the adapter.Adapter interface
 func (a *Adapter) Shutdown() error {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 	
-	if a.cmd != nil && a.cmd.Process != nil {
-		// Try to kill the process gracefully
-		return a.cmd.Process.Kill()
+	if a.group != nil {
+		// Kill the agent along with anything it started
+		// An agent that already exited has nothing left to shut down
+		if err := a.group.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
 	}
 	
 	return nil
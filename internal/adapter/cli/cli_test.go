@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/brettsmith212/orchestrator/internal/sandbox"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -31,7 +33,7 @@ echo '{"type":"thinking","timestamp":"2023-05-20T10:30:00Z","payload":{"content"
 sleep 0.1
 echo '{"type":"action","timestamp":"2023-05-20T10:30:01Z","payload":{"action_type":"file_edit","file_path":"test.txt","content":"test content"}}'
 sleep 0.1
-echo '{"type":"complete","timestamp":"2023-05-20T10:30:02Z"}'
+echo '{"type":"complete"}'
 `
 
 	// Write the script
@@ -75,6 +77,10 @@ echo '{"type":"complete","timestamp":"2023-05-20T10:30:02Z"}'
 	assert.Equal(t, 2, events[1].SequenceNum, "Second event should have sequence 2")
 	assert.Equal(t, 3, events[2].SequenceNum, "Third event should have sequence 3")
 
+	// Agent timestamps are kept; events without one are stamped on arrival
+	assert.Equal(t, time.Date(2023, 5, 20, 10, 30, 0, 0, time.UTC), events[0].Timestamp)
+	assert.WithinDuration(t, time.Now(), events[2].Timestamp, 5*time.Second)
+
 	// Test shutdown
 	err = adapter.Shutdown()
 	assert.NoError(t, err, "Shutdown should succeed")
@@ -156,4 +162,160 @@ echo '{"type":"complete","timestamp":"2023-05-20T10:30:02Z"}'
 
 	// Second event should be complete
 	assert.Equal(t, protocol.EventTypeComplete, events[1].Type, "Second event should be complete")
-}
\ No newline at end of file
+}
+func TestCLIAdapter_WorktreeFlag(t *testing.T) {
+	// Skip if not running integration tests
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	tempDir := t.TempDir()
+	worktreePath := t.TempDir()
+
+	// The script reports its arguments and working directory
+	testScriptPath := filepath.Join(tempDir, "args-agent.sh")
+	testScript := `#!/bin/sh
+printf '{"type":"complete","timestamp":"2023-05-20T10:30:00Z","payload":{"args":"%s","dir":"%s"}}\n' "$*" "$(pwd -P)"
+`
+	err := os.WriteFile(testScriptPath, []byte(testScript), 0755)
+	require.NoError(t, err, "Failed to write test script")
+
+	resolvedWorktree, err := filepath.EvalSymlinks(worktreePath)
+	require.NoError(t, err)
+
+	run := func(adapter *Adapter) map[string]string {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		eventCh, err := adapter.Start(ctx, worktreePath, "Fix the bug")
+		require.NoError(t, err, "Failed to start adapter")
+
+		var payload map[string]string
+		for event := range eventCh {
+			if event.Type == protocol.EventTypeComplete {
+				require.NoError(t, json.Unmarshal(event.Payload, &payload))
+			}
+		}
+		return payload
+	}
+
+	// By default the worktree is passed with -w before the prompt
+	payload := run(New("default", testScriptPath, []string{"--yes"}))
+	assert.Equal(t, fmt.Sprintf("--yes -w %s Fix the bug", worktreePath), payload["args"])
+	assert.Equal(t, resolvedWorktree, payload["dir"], "The command should run inside the worktree")
+
+	// Without a worktree flag the prompt directly follows the configured arguments
+	adapter := New("no-flag", testScriptPath, []string{"--message"})
+	adapter.SetWorktreeFlag("")
+	payload = run(adapter)
+	assert.Equal(t, "--message Fix the bug", payload["args"])
+	assert.Equal(t, resolvedWorktree, payload["dir"])
+}
+
+func TestCLIAdapter_Command(t *testing.T) {
+	adapter := New("test-agent", "agent", []string{"--json"})
+	command, args := adapter.Command("/tmp/worktree", "Fix the bug")
+	assert.Equal(t, "agent", command)
+	assert.Equal(t, []string{"--json", "-w", "/tmp/worktree", "Fix the bug"}, args)
+
+	// A worktree flag already in the arguments is not added again
+	adapter = New("test-agent", "agent", []string{"--workdir", "/elsewhere"})
+	_, args = adapter.Command("/tmp/worktree", "Fix the bug")
+	assert.Equal(t, []string{"--workdir", "/elsewhere", "Fix the bug"}, args)
+}
+
+func TestCLIAdapter_Sandbox(t *testing.T) {
+	adapter := New("test-agent", "/usr/local/bin/agent", []string{"--json"})
+	adapter.SetSandbox(&sandbox.Container{Runtime: "docker", Image: "sandbox:latest", Network: sandbox.NetworkBridge})
+	command, args := adapter.Command("/tmp/worktree", "Fix the bug")
+	assert.Equal(t, "docker", command)
+
+	// The worktree is mounted into the container, and the agent is told where it is there
+	assert.Contains(t, args, "/tmp/worktree:"+sandbox.Workdir)
+	assert.Equal(t, []string{"sandbox:latest", "agent", "--json", "-w", sandbox.Workdir, "Fix the bug"}, args[len(args)-6:])
+}
+
+func TestCLIAdapter_ContextFiles(t *testing.T) {
+	// Without a context flag the files are not passed on
+	adapter := New("test-agent", "agent", nil)
+	assert.False(t, adapter.SetContextFiles([]string{"main.go"}))
+	_, args := adapter.Command("/tmp/worktree", "Fix the bug")
+	assert.Equal(t, []string{"-w", "/tmp/worktree", "Fix the bug"}, args)
+
+	adapter.SetContextFlag("--file")
+	assert.True(t, adapter.SetContextFiles([]string{"main.go", "docs/design.md"}))
+	_, args = adapter.Command("/tmp/worktree", "Fix the bug")
+	assert.Equal(t, []string{"-w", "/tmp/worktree", "--file", "main.go", "--file", "docs/design.md", "Fix the bug"}, args)
+}
+
+func TestCLIAdapter_Pid(t *testing.T) {
+	// Skip if not running integration tests
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	adapter := New("test-agent", "sleep", []string{"5"})
+	assert.Zero(t, adapter.Pid(), "No process before the agent starts")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// sleep takes the prompt as its last argument, so give it a duration
+	_, err := adapter.Start(ctx, t.TempDir(), "5")
+	require.NoError(t, err)
+	assert.Positive(t, adapter.Pid(), "The running process should be reported")
+	assert.NoError(t, adapter.Shutdown())
+}
+
+func TestCLIAdapter_StdinEvents(t *testing.T) {
+	// Skip if not running integration tests
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	// The script echoes the first event it reads from stdin back as its payload
+	testScriptPath := filepath.Join(t.TempDir(), "stdin-agent.sh")
+	testScript := `#!/bin/sh
+echo '{"type":"thinking","payload":{"content":"waiting"}}'
+read -r line
+printf '{"type":"complete","payload":{"received":%s}}\n' "$line"
+`
+	require.NoError(t, os.WriteFile(testScriptPath, []byte(testScript), 0755))
+
+	// Without stdin events the agent isn't sent anything
+	quiet := New("quiet", testScriptPath, nil)
+	delivered, err := quiet.SendEvent(protocol.NewEvent(protocol.EventTypeWatchdog, "", 0))
+	assert.False(t, delivered)
+	assert.NoError(t, err)
+
+	adapter := New("listener", testScriptPath, nil)
+	adapter.SetWorktreeFlag("")
+	adapter.SetStdinEvents(true)
+	_, err = adapter.SendEvent(protocol.NewEvent(protocol.EventTypeWatchdog, "", 0))
+	assert.Error(t, err, "Events can't be sent before the agent starts")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	eventCh, err := adapter.Start(ctx, t.TempDir(), "Fix the bug")
+	require.NoError(t, err)
+
+	first := <-eventCh
+	require.Equal(t, protocol.EventTypeThinking, first.Type)
+
+	warning, err := protocol.NewEvent(protocol.EventTypeWatchdog, "", 0).WithPayload(map[string]string{"message": "Approaching token limit"})
+	require.NoError(t, err)
+	delivered, err = adapter.SendEvent(warning)
+	require.NoError(t, err)
+	assert.True(t, delivered)
+
+	var payload struct {
+		Received protocol.Event `json:"received"`
+	}
+	for event := range eventCh {
+		if event.Type == protocol.EventTypeComplete {
+			require.NoError(t, json.Unmarshal(event.Payload, &payload))
+		}
+	}
+	assert.Equal(t, protocol.EventTypeWatchdog, payload.Received.Type)
+	assert.JSONEq(t, `{"message":"Approaching token limit"}`, string(payload.Received.Payload))
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// DefaultEventBuffer is how many of an agent's events may wait for the orchestrator by default
+const DefaultEventBuffer = 256
+
+// Overflow policies, applied to an agent's events when its buffer is full
+// Actions, errors, completion, and events reporting usage or cost are never dropped: under every policy they wait for room
+const (
+	// OverflowBlock stops reading the agent's output until there is room, slowing the agent to the orchestrator's pace
+	OverflowBlock = "block"
+
+	// OverflowCoalesce merges a thinking event into the thinking event queued before it, or waits like OverflowBlock
+	OverflowCoalesce = "coalesce"
+
+	// OverflowDrop drops thinking events, and waits like OverflowBlock for the rest
+	OverflowDrop = "drop"
+)
+
+// DefaultOverflow is the overflow policy of agents that don't set one
+const DefaultOverflow = OverflowCoalesce
+
+// eventQueue buffers an agent's events between the goroutine reading its output and the orchestrator
+// Neither side ever waits on the other past the agent's context, so an agent whose consumer has gone can't
+// leave its reader stuck, nor its process unreaped
+type eventQueue struct {
+	mutex    sync.Mutex
+	events   []*protocol.Event
+	size     int
+	overflow string
+	stats    adapter.EventStats
+
+	// ready and room wake the forwarder when an event is queued, and the reader when one is taken
+	ready chan struct{}
+	room  chan struct{}
+
+	// closed is closed when the reader has queued its last event
+	closed     chan struct{}
+	closedOnce sync.Once
+}
+
+// newEventQueue creates a queue holding up to size events, applying overflow when it is full
+func newEventQueue(size int, overflow string) *eventQueue {
+	return &eventQueue{
+		size:     size,
+		overflow: overflow,
+		stats:    adapter.EventStats{Buffer: size},
+		ready:    make(chan struct{}, 1),
+		room:     make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+}
+
+// push queues an event, applying the overflow policy while the queue is full
+// Once the context is done the event is discarded, since nothing is reading them any more
+func (q *eventQueue) push(ctx context.Context, event *protocol.Event) {
+	var waitStarted time.Time
+	for {
+		q.mutex.Lock()
+		if len(q.events) < q.size || q.overflowed(event) {
+			if len(q.events) < q.size {
+				q.events = append(q.events, event)
+				q.stats.Peak = max(q.stats.Peak, len(q.events))
+			}
+			if !waitStarted.IsZero() {
+				q.stats.Blocked += time.Since(waitStarted)
+			}
+			q.mutex.Unlock()
+			signal(q.ready)
+			return
+		}
+		q.mutex.Unlock()
+
+		if waitStarted.IsZero() {
+			waitStarted = time.Now()
+		}
+		select {
+		case <-q.room:
+		case <-ctx.Done():
+			q.mutex.Lock()
+			q.stats.Blocked += time.Since(waitStarted)
+			q.mutex.Unlock()
+			return
+		}
+	}
+}
+
+// overflowed applies the overflow policy to an event that doesn't fit, reporting whether the policy handled it
+// The caller holds the mutex
+func (q *eventQueue) overflowed(event *protocol.Event) bool {
+	if len(q.events) < q.size || event.Type != protocol.EventTypeThinking || reportsUsage(event) {
+		return false
+	}
+	switch q.overflow {
+	case OverflowDrop:
+		q.stats.Dropped++
+		return true
+	case OverflowCoalesce:
+		last := q.events[len(q.events)-1]
+		if last.Type != protocol.EventTypeThinking || reportsUsage(last) {
+			return false
+		}
+		merged, err := coalesceThinking(last, event)
+		if err != nil {
+			return false
+		}
+		q.events[len(q.events)-1] = merged
+		q.stats.Coalesced++
+		return true
+	}
+	return false
+}
+
+// coalesceThinking merges the content of a thinking event into the one before it, keeping the earlier event's time
+func coalesceThinking(earlier, later *protocol.Event) (*protocol.Event, error) {
+	var first, second protocol.ThinkingPayload
+	if err := json.Unmarshal(earlier.Payload, &first); err != nil {
+		return nil, fmt.Errorf("failed to parse thinking event: %w", err)
+	}
+	if err := json.Unmarshal(later.Payload, &second); err != nil {
+		return nil, fmt.Errorf("failed to parse thinking event: %w", err)
+	}
+	merged := *earlier
+	return merged.WithPayload(protocol.ThinkingPayload{Content: first.Content + "\n" + second.Content})
+}
+
+// reportsUsage reports whether an event's payload carries token usage or cost, which the watchdog counts
+// against the agent's budget, so it mustn't be merged away
+func reportsUsage(event *protocol.Event) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(event.Payload, &fields); err != nil {
+		return false
+	}
+	for _, name := range []string{"usage", "token_count", "cost_usd", "total_cost_usd"} {
+		if _, ok := fields[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// close marks the end of the agent's events; those already queued are still forwarded
+func (q *eventQueue) close() {
+	q.closedOnce.Do(func() { close(q.closed) })
+}
+
+// forward sends queued events to eventCh in order, closing it once the queue is closed and empty
+// When the context is done it stops sending, and closes eventCh once the reader has finished
+func (q *eventQueue) forward(ctx context.Context, eventCh chan<- *protocol.Event) {
+	defer close(eventCh)
+
+	for {
+		q.mutex.Lock()
+		var event *protocol.Event
+		if len(q.events) > 0 {
+			event = q.events[0]
+			q.events[0] = nil
+			q.events = q.events[1:]
+		}
+		q.mutex.Unlock()
+
+		if event == nil {
+			select {
+			case <-q.ready:
+				continue
+			case <-q.closed:
+				// Events may have been queued just before the queue was closed
+				q.mutex.Lock()
+				empty := len(q.events) == 0
+				q.mutex.Unlock()
+				if empty {
+					return
+				}
+				continue
+			case <-ctx.Done():
+				<-q.closed
+				return
+			}
+		}
+
+		signal(q.room)
+		select {
+		case eventCh <- event:
+		case <-ctx.Done():
+			<-q.closed
+			return
+		}
+	}
+}
+
+// statistics returns the queue's statistics so far
+func (q *eventQueue) statistics() adapter.EventStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.stats
+}
+
+// signal wakes whoever waits on ch, without waiting if it's already been woken
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
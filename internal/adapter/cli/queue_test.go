@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thinkingEvent returns a thinking event with the given content
+func thinkingEvent(t *testing.T, sequence int, content string) *protocol.Event {
+	event, err := protocol.NewEvent(protocol.EventTypeThinking, "test-agent", sequence).WithPayload(protocol.ThinkingPayload{Content: content})
+	require.NoError(t, err)
+	return event
+}
+
+func TestEventQueue_Overflow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Nothing reads the queue, so it fills after two events
+	for _, overflow := range []string{OverflowCoalesce, OverflowDrop} {
+		q := newEventQueue(2, overflow)
+		q.push(ctx, protocol.NewEvent(protocol.EventTypeAction, "test-agent", 1))
+		q.push(ctx, thinkingEvent(t, 2, "first"))
+		q.push(ctx, thinkingEvent(t, 3, "second"))
+		q.push(ctx, thinkingEvent(t, 4, "third"))
+
+		stats := q.statistics()
+		assert.Equal(t, 2, stats.Buffer)
+		assert.Equal(t, 2, stats.Peak)
+		assert.Zero(t, stats.Blocked, "Thinking events never wait under %s", overflow)
+		require.Len(t, q.events, 2)
+
+		var payload protocol.ThinkingPayload
+		require.NoError(t, json.Unmarshal(q.events[1].Payload, &payload))
+		if overflow == OverflowCoalesce {
+			assert.Equal(t, 2, stats.Coalesced)
+			assert.Equal(t, "first\nsecond\nthird", payload.Content)
+			assert.Equal(t, 2, q.events[1].SequenceNum, "The merged event keeps the place of the first")
+		} else {
+			assert.Equal(t, 2, stats.Dropped)
+			assert.Equal(t, "first", payload.Content)
+		}
+	}
+
+	// Thinking events reporting usage or cost are never merged away, since the watchdog counts them
+	for _, overflow := range []string{OverflowCoalesce, OverflowDrop} {
+		q := newEventQueue(1, overflow)
+		costly, err := protocol.NewEvent(protocol.EventTypeThinking, "test-agent", 1).WithPayload(map[string]any{"content": "first", "cost_usd": 0.5})
+		require.NoError(t, err)
+		q.push(ctx, costly)
+		cancelled, cancelPush := context.WithTimeout(ctx, 50*time.Millisecond)
+		q.push(cancelled, thinkingEvent(t, 2, "second"))
+		cancelPush()
+		require.Len(t, q.events, 1)
+		assert.JSONEq(t, `{"content":"first","cost_usd":0.5}`, string(q.events[0].Payload), "%s keeps the cost", overflow)
+
+		q = newEventQueue(1, overflow)
+		q.push(ctx, thinkingEvent(t, 1, "first"))
+		used, err := protocol.NewEvent(protocol.EventTypeThinking, "test-agent", 2).WithPayload(map[string]any{"content": "second", "usage": map[string]int{"output_tokens": 10}})
+		require.NoError(t, err)
+		cancelled, cancelPush = context.WithTimeout(ctx, 50*time.Millisecond)
+		q.push(cancelled, used)
+		cancelPush()
+		assert.Zero(t, q.statistics().Dropped+q.statistics().Coalesced, "%s waits for room for the usage", overflow)
+	}
+
+	// Other events wait for room under every policy, until the agent's context ends
+	q := newEventQueue(1, OverflowDrop)
+	q.push(ctx, thinkingEvent(t, 1, "first"))
+	cancelled, cancelPush := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelPush()
+	q.push(cancelled, protocol.NewEvent(protocol.EventTypeError, "test-agent", 2))
+	assert.Len(t, q.events, 1, "The event is discarded once nothing reads them")
+	assert.GreaterOrEqual(t, q.statistics().Blocked, 50*time.Millisecond)
+}
+
+func TestEventQueue_Forward(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A blocked reader resumes as the orchestrator takes events, and every event arrives in order
+	q := newEventQueue(2, OverflowBlock)
+	eventCh := make(chan *protocol.Event)
+	go q.forward(ctx, eventCh)
+	go func() {
+		defer q.close()
+		for i := 1; i <= 20; i++ {
+			q.push(ctx, thinkingEvent(t, i, "thinking"))
+		}
+	}()
+
+	var sequences []int
+	for event := range eventCh {
+		sequences = append(sequences, event.SequenceNum)
+		time.Sleep(time.Millisecond)
+	}
+	require.Len(t, sequences, 20)
+	for i, sequence := range sequences {
+		assert.Equal(t, i+1, sequence)
+	}
+	assert.Zero(t, q.statistics().Dropped)
+
+	// Once the agent's context ends, a reader with no one taking its events isn't left stuck
+	agentCtx, agentCancel := context.WithCancel(ctx)
+	q = newEventQueue(1, OverflowBlock)
+	eventCh = make(chan *protocol.Event)
+	go q.forward(agentCtx, eventCh)
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		defer q.close()
+		for i := 1; i <= 10; i++ {
+			q.push(agentCtx, protocol.NewEvent(protocol.EventTypeAction, "test-agent", i))
+		}
+	}()
+	<-eventCh
+	agentCancel()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("reader stuck after the agent's context ended")
+	}
+	for range eventCh {
+	}
+}
@@ -0,0 +1,80 @@
+// Package patch provides the adapter of agents that submit an existing patch file instead of working on the task
+// The patch is applied to the agent's worktree, so it is judged under the same tests and scoring as agents' patches
+package patch
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// Adapter applies a patch file to the agent's worktree
+type Adapter struct {
+	id   string
+	file string
+}
+
+// New creates a patch adapter for the file named by the configuration's file
+func New(id string, config map[string]interface{}) (adapter.Adapter, error) {
+	file, _ := config["file"].(string)
+	if file == "" {
+		return nil, fmt.Errorf("patch agent %s is missing file", id)
+	}
+	return &Adapter{id: id, file: file}, nil
+}
+
+// Start implements the adapter.Adapter interface
+// The patch is applied before Start returns; the events report whether it applied, and the prompt is ignored
+func (a *Adapter) Start(ctx context.Context, worktreePath string, prompt string) (<-chan *protocol.Event, error) {
+	diff, err := os.ReadFile(a.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch: %w", err)
+	}
+
+	eventCh := make(chan *protocol.Event, 2)
+	defer close(eventCh)
+	if err := gitutil.ApplyPatchOnTop(worktreePath, string(diff)); err != nil {
+		event, _ := protocol.NewEvent(protocol.EventTypeError, a.id, 1).WithPayload(protocol.ErrorPayload{
+			Message: fmt.Sprintf("Failed to apply %s: %v", a.file, err),
+			Code:    "apply_error",
+		})
+		eventCh <- event
+		return eventCh, nil
+	}
+
+	action, _ := protocol.NewEvent(protocol.EventTypeAction, a.id, 1).WithPayload(protocol.ActionPayload{
+		ActionType: "apply_patch",
+		FilePath:   a.file,
+	})
+	eventCh <- action
+	eventCh <- protocol.NewEvent(protocol.EventTypeComplete, a.id, 2)
+	return eventCh, nil
+}
+
+// Command implements the adapter.Describer interface
+func (a *Adapter) Command(worktreePath string, prompt string) (string, []string) {
+	return "git", []string{"-C", worktreePath, "apply", "--binary", a.file}
+}
+
+// Shutdown implements the adapter.Adapter interface
+// There is nothing to stop, since the patch is applied before Start returns
+func (a *Adapter) Shutdown() error {
+	return nil
+}
+
+// Factory creates a factory function for the patch adapter
+func Factory() adapter.Factory {
+	return func(config adapter.Config) (adapter.Adapter, error) {
+		return New(config.ID, config.AdapterConfig)
+	}
+}
+
+// RegisterAdapter registers the patch adapter in the adapter registry
+func RegisterAdapter(registry *adapter.Registry) {
+	registry.Register(core.PatchAgentType, Factory())
+}
@@ -0,0 +1,52 @@
+package patch
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchAdapter(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping test that uses git in short mode")
+	}
+
+	worktree := t.TempDir()
+	require.NoError(t, exec.Command("git", "-C", worktree, "init", "-q").Run())
+	file := filepath.Join(t.TempDir(), "fix.patch")
+	require.NoError(t, os.WriteFile(file, []byte("diff --git a/fixed.txt b/fixed.txt\nnew file mode 100644\n--- /dev/null\n+++ b/fixed.txt\n@@ -0,0 +1 @@\n+fixed\n"), 0644))
+
+	_, err := New("human", map[string]interface{}{})
+	assert.ErrorContains(t, err, "missing file")
+	patchAdapter, err := Factory()(adapter.Config{ID: "human", Type: "patch", AdapterConfig: map[string]interface{}{"file": file}})
+	require.NoError(t, err)
+	defer patchAdapter.Shutdown()
+
+	collect := func() []protocol.EventType {
+		eventCh, err := patchAdapter.Start(context.Background(), worktree, "Fix the bug")
+		require.NoError(t, err)
+		var types []protocol.EventType
+		for event := range eventCh {
+			assert.Equal(t, "human", event.AgentID)
+			types = append(types, event.Type)
+		}
+		return types
+	}
+
+	// The patch is applied to the worktree, whatever the prompt
+	assert.Equal(t, []protocol.EventType{protocol.EventTypeAction, protocol.EventTypeComplete}, collect())
+	content, err := os.ReadFile(filepath.Join(worktree, "fixed.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "fixed\n", string(content))
+
+	// A patch that doesn't apply is reported as an error
+	assert.Equal(t, []protocol.EventType{protocol.EventTypeError}, collect())
+}
@@ -2,6 +2,7 @@ package adapter
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/brettsmith212/orchestrator/internal/core"
@@ -49,11 +50,17 @@ func (r *Registry) CreateFromConfig(cfg *core.Config) (map[string]Adapter, error
 	adapters := make(map[string]Adapter)
 	
 	for _, agentCfg := range cfg.Agents {
+		// Factories may fill in defaults, so give each one its own copy of the settings
+		settings := make(map[string]interface{}, len(agentCfg.Config))
+		for key, value := range agentCfg.Config {
+			settings[key] = value
+		}
+
 		// Create adapter configuration
 		adapterConfig := Config{
 			ID:            agentCfg.ID,
 			Type:          agentCfg.Type,
-			AdapterConfig: agentCfg.Config,
+			AdapterConfig: settings,
 		}
 		
 		// Create the adapter
@@ -68,6 +75,11 @@ func (r *Registry) CreateFromConfig(cfg *core.Config) (map[string]Adapter, error
 	return adapters, nil
 }
 
+// Validate checks that every configured agent uses a registered adapter type
+func (r *Registry) Validate(cfg *core.Config) error {
+	return core.ValidateAgentTypes(cfg, r.RegisteredTypes())
+}
+
 // RegisteredTypes returns the list of registered adapter types
 func (r *Registry) RegisteredTypes() []string {
 	r.mutex.RLock()
@@ -77,6 +89,7 @@ func (r *Registry) RegisteredTypes() []string {
 	for adapterType := range r.factories {
 		types = append(types, adapterType)
 	}
+	sort.Strings(types)
 	
 	return types
 }
\ No newline at end of file
@@ -157,4 +157,49 @@ func TestRegistryErrors(t *testing.T) {
 	_, err = registry.CreateFromConfig(coreConfig)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create adapter for agent agent1")
-}
\ No newline at end of file
+}
+func TestRegistryValidate(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("cli", mockFactory("cli"))
+	registry.Register("docker", mockFactory("docker"))
+
+	// Custom registered types pass validation
+	coreConfig := &core.Config{
+		WorkingDir: "/tmp/test",
+		Agents: []core.AgentConfig{
+			{ID: "agent1", Type: "cli"},
+			{ID: "agent2", Type: "docker"},
+		},
+	}
+	assert.NoError(t, registry.Validate(coreConfig))
+
+	// Unregistered types are rejected with the registered alternatives
+	coreConfig.Agents = append(coreConfig.Agents, core.AgentConfig{ID: "agent3", Type: "dockr"})
+	err := registry.Validate(coreConfig)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "registered types are: cli, docker (did you mean 'docker'?)")
+}
+
+func TestCreateFromConfig_CopiesSettings(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("cli", func(config Config) (Adapter, error) {
+		// Factories may fill in defaults
+		config.AdapterConfig["binary_path"] = "/usr/bin/agent"
+		return &mockAdapter{id: config.ID}, nil
+	})
+
+	coreConfig := &core.Config{
+		WorkingDir: "/tmp/test",
+		Agents: []core.AgentConfig{
+			{ID: "with-settings", Type: "cli", Config: map[string]interface{}{"command": "agent"}},
+			{ID: "without-settings", Type: "cli"},
+		},
+	}
+
+	_, err := registry.CreateFromConfig(coreConfig)
+	require.NoError(t, err)
+
+	// The configuration shared by concurrent runs is left untouched
+	assert.Equal(t, map[string]interface{}{"command": "agent"}, coreConfig.Agents[0].Config)
+	assert.Nil(t, coreConfig.Agents[1].Config)
+}
@@ -0,0 +1,179 @@
+// Package audit records the orchestrator's consequential actions in an append-only log
+// Each entry is a JSON object on its own line, written with a single append so entries
+// from concurrent runs, or processes, never interleave
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	RunStarted       = "run.started"
+	RunFinished      = "run.finished"
+	WorktreeCreated  = "worktree.created"
+	AgentStarted     = "agent.started"
+	AgentKilled      = "agent.killed"
+	TestsExecuted    = "tests.executed"
+	PatchApplied     = "patch.applied"
+	PatchRolledBack  = "patch.rolled_back"
+	PathsReverted    = "paths.reverted"
+	MetadataRestored = "metadata.restored"
+	BranchCommitted  = "branch.committed"
+	IssueCommented   = "issue.commented"
+	IssueResolved    = "issue.resolved"
+	PullReviewed     = "pull.reviewed"
+	HookRun          = "hook.run"
+)
+
+// Entry is one action in the audit log
+type Entry struct {
+	// Time is when the action happened
+	Time time.Time `json:"time"`
+
+	// RunID identifies the run the action belongs to (empty for actions outside a run)
+	RunID string `json:"run_id,omitempty"`
+
+	// Action is what happened, e.g. "agent.started"
+	Action string `json:"action"`
+
+	// User and Host identify who ran the orchestrator, and where
+	User string `json:"user,omitempty"`
+	Host string `json:"host,omitempty"`
+
+	// Details describe the action, e.g. the agent and the worktree it ran in
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Log appends entries to an audit log file
+type Log struct {
+	// path is the log file
+	path string
+
+	// redact removes secrets from details before they are written (nil keeps them as they are)
+	redact func(string) string
+
+	// user and host are recorded with every entry
+	user string
+	host string
+
+	// mutex serializes appends from the same process
+	mutex sync.Mutex
+}
+
+// New returns a log appending to path; the file and its directory are created on the first entry
+// redact, if not nil, is applied to every detail so secrets never reach the log
+func New(path string, redact func(string) string) *Log {
+	l := &Log{path: path, redact: redact}
+	if u, err := user.Current(); err == nil {
+		l.user = u.Username
+	}
+	l.host, _ = os.Hostname()
+	return l
+}
+
+// Append writes an entry to the end of the log, filling in its time, user, and host
+func (l *Log) Append(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.User, entry.Host = l.user, l.host
+	if l.redact != nil {
+		for key, value := range entry.Details {
+			entry.Details[key] = l.redact(value)
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return file.Close()
+}
+
+// Read loads every entry of an audit log
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return entries, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// runKey is the context key of the log and run that actions are recorded for
+type runKey struct{}
+
+// run is the log and run carried by a context
+type run struct {
+	log   *Log
+	runID string
+}
+
+// WithRun returns a context in which Record appends to log on behalf of a run
+// A nil log turns recording off
+func WithRun(ctx context.Context, log *Log, runID string) context.Context {
+	if log == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, runKey{}, run{log: log, runID: runID})
+}
+
+// Record appends an action to the log carried by ctx, if there is one
+// details alternate keys and values, and empty values are left out; a log that can't be written
+// is reported as a warning, since the action has already happened
+func Record(ctx context.Context, action string, details ...string) {
+	r, ok := ctx.Value(runKey{}).(run)
+	if !ok {
+		return
+	}
+
+	entry := Entry{RunID: r.runID, Action: action}
+	if len(details) > 0 {
+		entry.Details = make(map[string]string, len(details)/2)
+		for i := 0; i+1 < len(details); i += 2 {
+			if details[i+1] != "" {
+				entry.Details[details[i]] = details[i+1]
+			}
+		}
+	}
+	if err := r.log.Append(entry); err != nil {
+		slog.Warn("failed to record audit entry", "action", action, "path", r.log.path, "error", err)
+	}
+}
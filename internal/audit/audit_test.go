@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	log := New(path, func(s string) string { return strings.ReplaceAll(s, "sk-secret", "[REDACTED]") })
+
+	// Without a log in the context nothing is recorded
+	Record(context.Background(), RunStarted, "prompt", "Fix the bug")
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	ctx := WithRun(context.Background(), log, "20240102-030405-abcdef")
+	assert.Equal(t, context.Background(), WithRun(context.Background(), nil, "run"), "A nil log turns recording off")
+	Record(ctx, RunStarted, "prompt", "Use key sk-secret", "task", "")
+	Record(ctx, AgentKilled, "agent", "claude", "reason", "idle limit exceeded")
+
+	entries, err := Read(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "20240102-030405-abcdef", entries[0].RunID)
+	assert.Equal(t, RunStarted, entries[0].Action)
+	assert.Equal(t, map[string]string{"prompt": "Use key [REDACTED]"}, entries[0].Details, "Secrets are redacted and empty values left out")
+	assert.False(t, entries[0].Time.IsZero())
+	assert.Equal(t, map[string]string{"agent": "claude", "reason": "idle limit exceeded"}, entries[1].Details)
+
+	// Entries are appended to what is already there, even from another log on the same file
+	Record(WithRun(context.Background(), New(path, nil), "other-run"), TestsExecuted, "command", "go test ./...")
+	entries, err = Read(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "other-run", entries[2].RunID)
+}
+
+func TestRecordConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	ctx := WithRun(context.Background(), New(path, nil), "run")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Record(ctx, WorktreeCreated, "agent", fmt.Sprintf("agent-%d", i), "path", strings.Repeat("x", 1000))
+		}(i)
+	}
+	wg.Wait()
+
+	entries, err := Read(path)
+	require.NoError(t, err, "Every entry is a whole line")
+	assert.Len(t, entries, 50)
+}
@@ -3,11 +3,14 @@ package core
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/brettsmith212/orchestrator/internal/gitutil"
 	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/brettsmith212/orchestrator/internal/trace"
 )
 
 // PatchResult represents an agent's patch and its evaluation
@@ -15,6 +18,9 @@ type PatchResult struct {
 	// AgentID identifies which agent generated this patch
 	AgentID string
 
+	// WorktreePath is the path to the worktree containing the patched code
+	WorktreePath string
+
 	// Diff is the git diff of the patch
 	Diff string
 
@@ -24,14 +30,51 @@ type PatchResult struct {
 	// TestResults contains the results of running tests on this patch
 	TestResults *TestResult
 
-	// Events contains all events emitted by the agent
+	// Events contains the agent's notable events, as kept in its PatchDetails
 	Events []*protocol.Event
 
+	// Mutation contains the mutation-testing results (nil if mutation testing was not run)
+	Mutation *MutationResult
+
 	// Score is a numeric evaluation of the patch quality (higher is better)
 	Score int
 
+	// Breakdown lists the factors that add up to Score (empty for patches that were not tested)
+	Breakdown []ScoreComponent
+
 	// Reason is a human-readable explanation for the score
 	Reason string
+
+	// Usage is what the agent consumed producing the patch
+	Usage AgentUsage
+
+	// Termination is why the agent was stopped before it finished (empty if it finished on its own)
+	Termination string
+
+	// Failure categorizes why the agent didn't produce a usable patch (empty if it did)
+	Failure FailureKind
+
+	// FailureMessage is the error or reason the failure was identified from
+	FailureMessage string
+
+	// PathViolations lists the files the agent changed that the path policy doesn't permit, whose changes were reverted
+	PathViolations []string
+
+	// ProtectedChanges describes the changes the agent made or attempted to git metadata and orchestrator files,
+	// e.g. "restored .git/hooks/pre-commit"
+	ProtectedChanges []string
+
+	// Refinements is how many follow-up rounds revised the patch after its tests failed
+	Refinements int
+
+	// Reviewer is the agent that reviewed the patch in a pipeline (empty if it wasn't reviewed)
+	Reviewer string
+
+	// Revisions is how many times the patch was revised after a review
+	Revisions int
+
+	// Stacked lists the agents whose patches were stacked on this one, in the order they were applied
+	Stacked []string
 }
 
 // Arbitrator evaluates and selects the best patch from multiple agents
@@ -44,16 +87,121 @@ type Arbitrator struct {
 
 	// BaseRepoPath is the path to the original repository
 	baseRepoPath string
+
+	// mutationTester estimates test strength for passing patches (nil if disabled)
+	mutationTester *MutationTester
+
+	// ignorePatterns are glob patterns for files excluded from diff stats and scoring
+	ignorePatterns []string
+
+	// maxDiffLineBytes is how much of each diff line is held while parsing diffs (0 for the default)
+	maxDiffLineBytes int
+
+	// agentRunners overrides the test runner for specific agents
+	agentRunners map[string]*TestRunner
+
+	// mutex protects agentBaselines
+	mutex sync.Mutex
+
+	// agentBaselines caches baseline results for overridden test commands
+	agentBaselines map[string]*TestResult
+
+	// weights controls how each factor contributes to a patch's score
+	weights ScoringWeights
+
+	// onEvaluated is told about each patch as soon as it has been scored (nil if nothing is)
+	onEvaluated func(*PatchResult)
+
+	// beforeEvaluating prepares a patch's worktree for its tests (nil if nothing does)
+	beforeEvaluating func(ctx context.Context, agentID, worktreePath string) error
 }
 
 // NewArbitrator creates a new arbitrator for patch selection
 func NewArbitrator(testRunner *TestRunner, baseRepoPath string) *Arbitrator {
 	return &Arbitrator{
-		testRunner:  testRunner,
-		baseRepoPath: baseRepoPath,
+		testRunner:     testRunner,
+		baseRepoPath:   baseRepoPath,
+		agentRunners:   make(map[string]*TestRunner),
+		agentBaselines: make(map[string]*TestResult),
+		weights:        DefaultScoringWeights,
 	}
 }
 
+// SetScoringWeights replaces the default weights used to score patches
+func (a *Arbitrator) SetScoringWeights(weights ScoringWeights) {
+	a.weights = weights
+}
+
+// SetAgentTestRunner overrides the test runner used to validate a specific agent's patch
+// The baseline for an overridden command is run on first use
+func (a *Arbitrator) SetAgentTestRunner(agentID string, testRunner *TestRunner) {
+	a.agentRunners[agentID] = testRunner
+}
+
+// EnableMutationTesting turns on a mutation-testing pass for patches whose tests pass
+// Patches whose mutants survive are down-ranked since their tests barely constrain them
+func (a *Arbitrator) EnableMutationTesting(maxMutants int) {
+	a.mutationTester = NewMutationTester(a.testRunner, maxMutants)
+	a.mutationTester.maxLineBytes = a.maxDiffLineBytes
+}
+
+// SetMaxDiffLineBytes limits how much of each diff line is held while computing diff stats and generating mutants
+// (0 or less for gitutil.DefaultMaxDiffLineBytes)
+func (a *Arbitrator) SetMaxDiffLineBytes(maxLineBytes int) {
+	a.maxDiffLineBytes = maxLineBytes
+	if a.mutationTester != nil {
+		a.mutationTester.maxLineBytes = maxLineBytes
+	}
+}
+
+// diffStats calculates statistics for a diff, holding at most maxDiffLineBytes of any line
+func (a *Arbitrator) diffStats(diff string) gitutil.DiffStats {
+	// Reading a string never fails
+	stats, _ := gitutil.ReadDiffStats(strings.NewReader(diff), a.maxDiffLineBytes)
+	return stats
+}
+
+// SetCommandRunner has the arbitrator's test runners, including the agents' own set so far, run tests with runner
+func (a *Arbitrator) SetCommandRunner(runner CommandRunner) {
+	for _, testRunner := range a.testRunners() {
+		testRunner.Runner = runner
+	}
+}
+
+// SetClock has the arbitrator's test runners, including the agents' own set so far, time tests with clock
+func (a *Arbitrator) SetClock(clock Clock) {
+	for _, testRunner := range a.testRunners() {
+		testRunner.Clock = clock
+	}
+}
+
+// testRunners returns the arbitrator's test runner followed by the agents' overrides
+func (a *Arbitrator) testRunners() []*TestRunner {
+	runners := []*TestRunner{a.testRunner}
+	for _, runner := range a.agentRunners {
+		runners = append(runners, runner)
+	}
+	return runners
+}
+
+// SetEvaluatedHook sets a function told about each patch RankPatches scores, as soon as it is scored
+// Evaluating patches runs their tests, so this lets slow evaluations report, or checkpoint, their progress
+func (a *Arbitrator) SetEvaluatedHook(hook func(*PatchResult)) {
+	a.onEvaluated = hook
+}
+
+// SetPreEvaluateHook sets a function run on each patch's worktree before the patch is tested
+// A patch whose worktree it fails to prepare is left unevaluated
+func (a *Arbitrator) SetPreEvaluateHook(hook func(ctx context.Context, agentID, worktreePath string) error) {
+	a.beforeEvaluating = hook
+}
+
+// SetIgnorePatterns configures glob patterns for files (lockfiles, generated code, vendor/)
+// whose changes are excluded from diff stats and scoring
+func (a *Arbitrator) SetIgnorePatterns(patterns []string) {
+	a.ignorePatterns = patterns
+}
+
 // SetBaselineTestResults runs tests on the original code to establish a baseline
 func (a *Arbitrator) SetBaselineTestResults(ctx context.Context) error {
 	var err error
@@ -61,70 +209,166 @@ func (a *Arbitrator) SetBaselineTestResults(ctx context.Context) error {
 	return err
 }
 
+// BaselineTestResults returns the test results of the original code (nil before SetBaselineTestResults)
+func (a *Arbitrator) BaselineTestResults() *TestResult {
+	return a.baseTestResults
+}
+
 // EvaluatePatch evaluates a single patch
 func (a *Arbitrator) EvaluatePatch(ctx context.Context, agentID, worktreePath, diff string, events []*protocol.Event) (*PatchResult, error) {
 	// Skip empty diffs
 	if strings.TrimSpace(diff) == "" {
 		return &PatchResult{
-			AgentID: agentID,
-			Diff:    "",
-			Score:   0,
-			Reason:  "No changes made",
-			Events:  events,
+			AgentID:      agentID,
+			WorktreePath: worktreePath,
+			Diff:         "",
+			Score:        0,
+			Reason:       "No changes made",
+			Events:       events,
 		}, nil
 	}
 
-	// Analyze the diff
-	diffStats := gitutil.GetDiffStats(diff)
+	// Analyze the diff, leaving out churn in ignored files
+	scoredDiff := gitutil.FilterDiff(diff, a.ignorePatterns)
+	diffStats := a.diffStats(scoredDiff)
 
 	// Skip diffs with conflicts
 	if diffStats.HasConflicts {
 		return &PatchResult{
-			AgentID:   agentID,
-			Diff:      diff,
-			DiffStats: diffStats,
-			Score:     -10,
-			Reason:    "Patch contains merge conflicts",
-			Events:    events,
+			AgentID:      agentID,
+			WorktreePath: worktreePath,
+			Diff:         diff,
+			DiffStats:    diffStats,
+			Score:        -10,
+			Reason:       "Patch contains merge conflicts",
+			Events:       events,
 		}, nil
 	}
 
+	// Prepare the worktree, such as by installing dependencies, before its tests
+	if a.beforeEvaluating != nil {
+		if err := a.beforeEvaluating(ctx, agentID, worktreePath); err != nil {
+			return nil, err
+		}
+	}
+
 	// Run tests on the patched code
-	testResults, err := a.testRunner.Run(ctx, worktreePath)
+	testRunner, baseline, err := a.runnerFor(ctx, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run baseline tests for %s: %w", agentID, err)
+	}
+
+	testResults, err := testRunner.Run(ctx, worktreePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to run tests on patched code: %w", err)
 	}
 
 	// Compare with baseline tests
-	improved, reason := CompareResults(a.baseTestResults, testResults)
+	improved, reason := CompareResults(baseline, testResults)
 
 	// Calculate score
-	score := calculateScore(improved, diffStats, testResults)
+	breakdown := scoreBreakdown(a.weights, improved, diffStats, testResults)
+
+	// Check how well the tests constrain a passing patch
+	// Mutation testing that fails is noted with the patch, which is scored on the mutants evaluated before it failed
+	var mutation *MutationResult
+	if a.mutationTester != nil && testResults.Success {
+		tester := a.mutationTester
+		if testRunner != a.testRunner {
+			tester = NewMutationTester(testRunner, tester.maxMutants)
+			tester.maxLineBytes = a.maxDiffLineBytes
+		}
+		mutation, err = tester.Run(ctx, worktreePath, scoredDiff)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("failed to run mutation tests: %w", err)
+			}
+			slog.Warn("mutation testing failed", "agent", agentID, "error", err)
+			mutation.Error = err.Error()
+			reason = fmt.Sprintf("%s; mutation testing failed", reason)
+		}
+		if mutation.Total > 0 {
+			if penalty := mutationPenalty(mutation); penalty > 0 {
+				breakdown = append(breakdown, ScoreComponent{
+					Factor: fmt.Sprintf("%d/%d mutants survived", mutation.Total-mutation.Killed, mutation.Total),
+					Points: -penalty,
+				})
+			}
+			reason = fmt.Sprintf("%s; %d/%d mutants killed", reason, mutation.Killed, mutation.Total)
+		}
+	}
 
 	return &PatchResult{
-		AgentID:     agentID,
-		Diff:        diff,
-		DiffStats:   diffStats,
-		TestResults: testResults,
-		Events:      events,
-		Score:       score,
-		Reason:      reason,
+		AgentID:      agentID,
+		WorktreePath: worktreePath,
+		Diff:         diff,
+		DiffStats:    diffStats,
+		TestResults:  testResults,
+		Events:       events,
+		Mutation:     mutation,
+		Score:        sumScore(breakdown),
+		Breakdown:    breakdown,
+		Reason:       reason,
 	}, nil
 }
 
+// runnerFor returns the test runner and baseline results to use for an agent
+func (a *Arbitrator) runnerFor(ctx context.Context, agentID string) (*TestRunner, *TestResult, error) {
+	runner, ok := a.agentRunners[agentID]
+	if !ok {
+		return a.testRunner, a.baseTestResults, nil
+	}
+
+	// Agents sharing the global command can reuse the global baseline
+	if runner.TestCommand == a.testRunner.TestCommand {
+		return runner, a.baseTestResults, nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if baseline, ok := a.agentBaselines[runner.TestCommand]; ok {
+		return runner, baseline, nil
+	}
+
+	baseline, err := runner.Run(ctx, a.baseRepoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	a.agentBaselines[runner.TestCommand] = baseline
+
+	return runner, baseline, nil
+}
+
 // SelectBestPatch evaluates all patches and selects the best one
 func (a *Arbitrator) SelectBestPatch(ctx context.Context, patches map[string]*PatchDetails) (*PatchResult, error) {
+	results, err := a.RankPatches(ctx, patches)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the highest scoring patch
+	return results[0], nil
+}
+
+// RankPatches evaluates all patches and returns their results from best to worst
+// Patches that fail evaluation are left out
+func (a *Arbitrator) RankPatches(ctx context.Context, patches map[string]*PatchDetails) ([]*PatchResult, error) {
 	if len(patches) == 0 {
 		return nil, fmt.Errorf("no patches to evaluate")
 	}
 
-	// Evaluate each patch
+	// Evaluate each patch, reusing the results of those evaluated as their agent finished
 	results := make([]*PatchResult, 0, len(patches))
 	for agentID, patch := range patches {
-		result, err := a.EvaluatePatch(ctx, agentID, patch.WorktreePath, patch.Diff, patch.Events)
+		if patch.Result != nil {
+			results = append(results, patch.Result)
+			continue
+		}
+		result, err := a.EvaluateFinished(ctx, agentID, patch)
 		if err != nil {
 			// Skip this patch but continue evaluating others
-			fmt.Printf("Error evaluating patch from %s: %v\n", agentID, err)
+			slog.Warn("failed to evaluate patch", "agent", agentID, "error", err)
 			continue
 		}
 		results = append(results, result)
@@ -134,13 +378,69 @@ func (a *Arbitrator) SelectBestPatch(ctx context.Context, patches map[string]*Pa
 		return nil, fmt.Errorf("all patches failed evaluation")
 	}
 
-	// Sort patches by score (descending)
+	// Sort patches by score (descending), breaking ties by agent ID so rankings are stable
+	// Patches of agents stopped early weren't scored, so they rank after those that were
 	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
+		if skipped := IsStoppedEarly(results[i].Termination); skipped != IsStoppedEarly(results[j].Termination) {
+			return !skipped
+		}
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].AgentID < results[j].AgentID
 	})
 
-	// Return the highest scoring patch
-	return results[0], nil
+	return results, nil
+}
+
+// EvaluateFinished evaluates the patch of a finished agent, carrying over what it consumed and how it ended
+func (a *Arbitrator) EvaluateFinished(ctx context.Context, agentID string, patch *PatchDetails) (*PatchResult, error) {
+	ctx, span := trace.Start(ctx, "evaluate patch")
+	defer span.Finish()
+	span.SetAttribute("agent.id", agentID)
+
+	result, err := a.EvaluatePatch(ctx, agentID, patch.WorktreePath, patch.Diff, patch.Events)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("patch.score", result.Score)
+	if tests := result.TestResults; tests != nil {
+		span.SetAttribute("tests.passed", tests.PassedTests)
+		span.SetAttribute("tests.failed", tests.FailedTests)
+	}
+	result.Usage = patch.Usage
+	result.Termination = patch.Termination
+	result.Failure, result.FailureMessage = patch.Failure, patch.FailureMessage
+	result.PathViolations = patch.PathViolations
+	result.ProtectedChanges = patch.ProtectedChanges
+	result.Refinements = patch.Refinements
+	result.Reviewer, result.Revisions = patch.Reviewer, patch.Revisions
+	if a.onEvaluated != nil {
+		a.onEvaluated(result)
+	}
+	return result, nil
+}
+
+// SkipEvaluation returns the result of a patch left unevaluated, without running its tests
+func (a *Arbitrator) SkipEvaluation(agentID string, patch *PatchDetails, reason string) *PatchResult {
+	return &PatchResult{
+		AgentID:          agentID,
+		WorktreePath:     patch.WorktreePath,
+		Diff:             patch.Diff,
+		DiffStats:        a.diffStats(gitutil.FilterDiff(patch.Diff, a.ignorePatterns)),
+		Events:           patch.Events,
+		Reason:           "Not evaluated: " + reason,
+		Usage:            patch.Usage,
+		Termination:      patch.Termination,
+		Failure:          patch.Failure,
+		FailureMessage:   patch.FailureMessage,
+		PathViolations:   patch.PathViolations,
+		ProtectedChanges: patch.ProtectedChanges,
+		Refinements:      patch.Refinements,
+		Reviewer:         patch.Reviewer,
+		Revisions:        patch.Revisions,
+	}
 }
 
 // PatchDetails contains information about a patch from an agent
@@ -151,62 +451,307 @@ type PatchDetails struct {
 	// Diff is the git diff of the patch
 	Diff string
 
-	// Events is the list of events from the agent
+	// Events are the agent's notable events, kept in memory by its EventLog: the prompt, its errors, and the files
+	// it acted on. Every event is in its transcript
 	Events []*protocol.Event
+
+	// EventCount is how many events the agent emitted
+	EventCount int
+
+	// Usage is what the agent consumed producing the patch
+	Usage AgentUsage
+
+	// Termination is why the agent was stopped before it finished (empty if it finished on its own)
+	Termination string
+
+	// Failure categorizes why the agent didn't produce a usable patch (empty if it did)
+	Failure FailureKind
+
+	// FailureMessage is the error or reason the failure was identified from
+	FailureMessage string
+
+	// PathViolations lists the files the agent changed that the path policy doesn't permit, whose changes were reverted
+	PathViolations []string
+
+	// ProtectedChanges describes the changes the agent made or attempted to git metadata and orchestrator files,
+	// e.g. "restored .git/hooks/pre-commit"
+	ProtectedChanges []string
+
+	// Refinements is how many follow-up rounds revised the patch after its tests failed
+	Refinements int
+
+	// Reviewer is the agent that reviewed the patch in a pipeline (empty if it wasn't reviewed)
+	Reviewer string
+
+	// Revisions is how many times the patch was revised after a review
+	Revisions int
+
+	// Result is the patch's evaluation, when it was evaluated as soon as its agent finished (nil if it wasn't)
+	Result *PatchResult
+}
+
+// Follow carries over to a revised patch what the agent's earlier work on it added up to: its usage, its events,
+// and its rounds of refinement and review
+func (p *PatchDetails) Follow(previous *PatchDetails) {
+	p.Usage = previous.Usage.Add(p.Usage)
+	p.EventCount += previous.EventCount
+	p.Refinements = previous.Refinements
+	p.Reviewer, p.Revisions = previous.Reviewer, previous.Revisions
+}
+
+// ScoringWeights controls how much each factor contributes to a patch's score
+// Penalties are given as positive numbers and subtracted
+type ScoringWeights struct {
+	// Improvement is awarded when tests improve over the baseline
+	Improvement int `yaml:"improvement"`
+
+	// AllTestsPass is awarded when the whole test suite passes
+	AllTestsPass int `yaml:"all_tests_pass"`
+
+	// PassedTest is awarded for each passing test
+	PassedTest int `yaml:"passed_test"`
+
+	// FailedTest is subtracted for each failing test
+	FailedTest int `yaml:"failed_test"`
+
+	// SmallDiff is awarded for diffs of at most 10 changed lines
+	SmallDiff int `yaml:"small_diff"`
+
+	// LargeDiff is subtracted for diffs of more than 50 changed lines
+	LargeDiff int `yaml:"large_diff"`
+
+	// MinimalFix is awarded for passing patches with fewer than 20 changed lines
+	MinimalFix int `yaml:"minimal_fix"`
+}
+
+// DefaultScoringWeights are the weights used when none are configured
+var DefaultScoringWeights = ScoringWeights{
+	Improvement:  100,
+	AllTestsPass: 50,
+	PassedTest:   5,
+	FailedTest:   10,
+	SmallDiff:    5,
+	LargeDiff:    5,
+	MinimalFix:   10,
+}
+
+// ScoreComponent is one factor's contribution to a patch's score
+type ScoreComponent struct {
+	// Factor describes what was awarded or penalized
+	Factor string `json:"factor"`
+
+	// Points is the contribution to the score (negative for penalties)
+	Points int `json:"points"`
 }
 
 // calculateScore computes a numeric score for a patch
-func calculateScore(improved bool, diffStats gitutil.DiffStats, testResults *TestResult) int {
-	var score int
+func calculateScore(weights ScoringWeights, improved bool, diffStats gitutil.DiffStats, testResults *TestResult) int {
+	return sumScore(scoreBreakdown(weights, improved, diffStats, testResults))
+}
+
+// scoreBreakdown lists the factors that contribute to a patch's score, leaving out those worth nothing
+func scoreBreakdown(weights ScoringWeights, improved bool, diffStats gitutil.DiffStats, testResults *TestResult) []ScoreComponent {
+	var components []ScoreComponent
+	add := func(factor string, points int) {
+		if points != 0 {
+			components = append(components, ScoreComponent{Factor: factor, Points: points})
+		}
+	}
 
 	// Base points for test improvement
 	if improved {
-		score += 100
+		add("tests improved over baseline", weights.Improvement)
 	}
 
 	// Additional points for passing all tests
 	if testResults.Success {
-		score += 50
+		add("all tests pass", weights.AllTestsPass)
 	}
 
 	// Points for each passing test
-	score += testResults.PassedTests * 5
+	add(fmt.Sprintf("passing tests (%d)", testResults.PassedTests), testResults.PassedTests*weights.PassedTest)
 
 	// Penalties for failing tests
-	score -= testResults.FailedTests * 10
+	add(fmt.Sprintf("failing tests (%d)", testResults.FailedTests), -testResults.FailedTests*weights.FailedTest)
 
 	// Slight preference for smaller diffs when all else is equal
 	totalChanges := diffStats.LinesAdded + diffStats.LinesRemoved
 	if totalChanges > 0 && totalChanges <= 10 {
-		score += 5 // Small changes are good
+		add("small diff", weights.SmallDiff) // Small changes are good
 	} else if totalChanges > 50 {
-		score -= 5 // Penalize very large changes
+		add("large diff", -weights.LargeDiff) // Penalize very large changes
 	}
 
 	// Bonus for fixing things with minimal changes
 	if testResults.Success && totalChanges < 20 {
-		score += 10 // Clean, minimal fixes are ideal
+		add("minimal fix", weights.MinimalFix) // Clean, minimal fixes are ideal
 	}
 
+	return components
+}
+
+// sumScore adds up the points of score components
+func sumScore(components []ScoreComponent) int {
+	score := 0
+	for _, component := range components {
+		score += component.Points
+	}
 	return score
 }
 
+// Partial reports whether the patch is work an agent left when it was terminated before finishing
+func (r *PatchResult) Partial() bool {
+	return r.Termination != "" && strings.TrimSpace(r.Diff) != ""
+}
+
+// FormatRanking lists every evaluated patch from best to worst
+func FormatRanking(ranked []*PatchResult) string {
+	var sb strings.Builder
+
+	sb.WriteString("=== Arbitration Results ===\n")
+	for i, result := range ranked {
+		tests := "-"
+		if result.TestResults != nil {
+			tests = fmt.Sprintf("%d/%d", result.TestResults.PassedTests, result.TestResults.TotalTests)
+		}
+		sb.WriteString(fmt.Sprintf("%2d. %-20s score %4d  tests %-7s  +%d/-%d  %s\n",
+			i+1, result.AgentID, result.Score, tests,
+			result.DiffStats.LinesAdded, result.DiffStats.LinesRemoved, result.Reason))
+	}
+
+	return sb.String()
+}
+
 // FormatPatchResult returns a human-readable summary of a patch result
 func FormatPatchResult(result *PatchResult) string {
 	var sb strings.Builder
 
 	sb.WriteString(fmt.Sprintf("Agent: %s\n", result.AgentID))
 	sb.WriteString(fmt.Sprintf("Score: %d (%s)\n", result.Score, result.Reason))
+
+	if result.Partial() {
+		sb.WriteString(fmt.Sprintf("Partial: terminated for %s\n", result.Termination))
+	} else if result.Termination != "" {
+		sb.WriteString(fmt.Sprintf("Stopped: %s\n", result.Termination))
+	}
+
+	if len(result.PathViolations) > 0 {
+		action := "Stripped"
+		if result.Failure == FailureDeniedPaths {
+			action = "Disqualified"
+		}
+		sb.WriteString(fmt.Sprintf("%s: %s\n", action, ViolationMessage(result.PathViolations)))
+	}
+
+	if len(result.ProtectedChanges) > 0 {
+		sb.WriteString(fmt.Sprintf("Protected: %s\n", strings.Join(result.ProtectedChanges, ", ")))
+	}
+
+	if variant := PromptVariantOf(result.AgentID); variant != "" {
+		sb.WriteString(fmt.Sprintf("Prompt variant: %s\n", variant))
+	}
+
+	if result.Reviewer != "" {
+		revised := fmt.Sprintf("revised %d times", result.Revisions)
+		switch result.Revisions {
+		case 0:
+			revised = "not revised"
+		case 1:
+			revised = "revised once"
+		}
+		sb.WriteString(fmt.Sprintf("Reviewed: by %s, %s\n", result.Reviewer, revised))
+	}
+
+	if len(result.Stacked) > 0 {
+		sb.WriteString(fmt.Sprintf("Stacked: %s\n", strings.Join(result.Stacked, ", ")))
+	}
+
+	if result.Refinements == 1 {
+		sb.WriteString("Refined: 1 follow-up round after failing tests\n")
+	} else if result.Refinements > 1 {
+		sb.WriteString(fmt.Sprintf("Refined: %d follow-up rounds after failing tests\n", result.Refinements))
+	}
 	
 	if result.DiffStats.FilesChanged > 0 {
 		sb.WriteString(fmt.Sprintf("Changes: %d files modified, %d lines added, %d lines removed\n", 
 			result.DiffStats.FilesChanged, result.DiffStats.LinesAdded, result.DiffStats.LinesRemoved))
 	}
 
+	if result.DiffStats.RenamedFiles > 0 {
+		sb.WriteString(fmt.Sprintf("Renames: %d files renamed or moved\n", result.DiffStats.RenamedFiles))
+	}
+
+	if result.DiffStats.BinaryFiles > 0 {
+		sb.WriteString(fmt.Sprintf("Binary: %d binary files changed\n", result.DiffStats.BinaryFiles))
+	}
+
 	if result.TestResults != nil {
 		sb.WriteString(fmt.Sprintf("Tests: %d total, %d passed, %d failed\n", 
 			result.TestResults.TotalTests, result.TestResults.PassedTests, result.TestResults.FailedTests))
 	}
 
+	if result.Mutation != nil && result.Mutation.Total > 0 {
+		sb.WriteString(fmt.Sprintf("Mutation: %d/%d mutants killed (%.0f%%)\n",
+			result.Mutation.Killed, result.Mutation.Total, result.Mutation.KillRatio()*100))
+	}
+	if result.Mutation != nil && result.Mutation.Error != "" {
+		sb.WriteString(fmt.Sprintf("Mutation testing failed: %s\n", result.Mutation.Error))
+	}
+
+	return sb.String()
+}
+
+// FormatSpend lists the tokens and dollars each agent used and the run's totals, against the run budgets
+// Tokens and dollars are each left out when nothing was used and there is no budget for them; with
+// neither it returns ""
+func FormatSpend(results []*PatchResult, limits ResourceLimits) string {
+	var tokens int
+	var cost float64
+	for _, result := range results {
+		tokens += result.Usage.Tokens
+		cost += result.Usage.CostUSD
+	}
+	showTokens := tokens > 0 || limits.MaxRunTokens > 0
+	showCost := cost > 0 || limits.MaxRunCost > 0
+	if !showTokens && !showCost {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, result := range results {
+		var parts []string
+		if showTokens {
+			part := fmt.Sprintf("%d tokens", result.Usage.Tokens)
+			if limits.MaxRunTokens > 0 {
+				part += fmt.Sprintf(" (%.0f%% of budget)", float64(result.Usage.Tokens)/float64(limits.MaxRunTokens)*100)
+			}
+			parts = append(parts, part)
+		}
+		if showCost {
+			parts = append(parts, fmt.Sprintf("$%.2f", result.Usage.CostUSD))
+		}
+		sb.WriteString(fmt.Sprintf("%-20s %s", result.AgentID, strings.Join(parts, "  ")))
+		if result.Termination != "" {
+			sb.WriteString(fmt.Sprintf(" (stopped: %s)", result.Termination))
+		}
+		sb.WriteString("\n")
+	}
+
+	var totals []string
+	if showTokens {
+		total := fmt.Sprintf("%d tokens", tokens)
+		if limits.MaxRunTokens > 0 {
+			total += fmt.Sprintf(" of %d budget", limits.MaxRunTokens)
+		}
+		totals = append(totals, total)
+	}
+	if showCost {
+		total := fmt.Sprintf("$%.2f", cost)
+		if limits.MaxRunCost > 0 {
+			total += fmt.Sprintf(" of $%.2f budget", limits.MaxRunCost)
+		}
+		totals = append(totals, total)
+	}
+	sb.WriteString(fmt.Sprintf("%-20s %s\n", "Total", strings.Join(totals, "  ")))
 	return sb.String()
-}
\ No newline at end of file
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -46,6 +47,15 @@ func TestArbitrator(t *testing.T) {
 	assert.Equal(t, "good-agent", bestPatch.AgentID)
 	assert.True(t, bestPatch.TestResults.Success)
 	assert.Greater(t, bestPatch.Score, 0)
+
+	// The full ranking puts the same patch first and orders the rest by score
+	ranked, err := arbitrator.RankPatches(ctx, patches)
+	require.NoError(t, err)
+	require.Len(t, ranked, len(patches))
+	assert.Equal(t, "good-agent", ranked[0].AgentID)
+	for i := 1; i < len(ranked); i++ {
+		assert.GreaterOrEqual(t, ranked[i-1].Score, ranked[i].Score)
+	}
 }
 
 func TestCalculateScore(t *testing.T) {
@@ -126,12 +136,113 @@ func TestCalculateScore(t *testing.T) {
 	// Run the test cases
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			score := calculateScore(tc.improved, tc.diffStats, &tc.testResult)
+			score := calculateScore(DefaultScoringWeights, tc.improved, tc.diffStats, &tc.testResult)
 			assert.Equal(t, tc.expected, score)
 		})
 	}
 }
 
+func TestScoreBreakdown(t *testing.T) {
+	breakdown := scoreBreakdown(DefaultScoringWeights, true, gitutil.DiffStats{FilesChanged: 1, LinesAdded: 40, LinesRemoved: 20},
+		&TestResult{Success: false, TotalTests: 4, PassedTests: 3, FailedTests: 1})
+
+	assert.Equal(t, []ScoreComponent{
+		{Factor: "tests improved over baseline", Points: 100},
+		{Factor: "passing tests (3)", Points: 15},
+		{Factor: "failing tests (1)", Points: -10},
+		{Factor: "large diff", Points: -5},
+	}, breakdown)
+	assert.Equal(t, 100, sumScore(breakdown))
+}
+
+func TestEvaluatePatch_IgnorePatterns(t *testing.T) {
+	// Use a trivial test command so only the diff analysis matters
+	dir := t.TempDir()
+	arbitrator := NewArbitrator(NewTestRunner("true", 5*time.Second), dir)
+	arbitrator.baseTestResults = &TestResult{Success: true, TotalTests: 1, PassedTests: 1}
+	arbitrator.SetIgnorePatterns([]string{"go.sum"})
+
+	diff := `diff --git a/go.sum b/go.sum
+--- a/go.sum
++++ b/go.sum
+@@ -1 +1,3 @@
+ example.com/a v1.0.0
++example.com/b v1.0.0
++example.com/c v1.0.0
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-package old
++package main
+`
+
+	result, err := arbitrator.EvaluatePatch(context.Background(), "test-agent", dir, diff, nil)
+	require.NoError(t, err)
+
+	// Only main.go should be counted
+	assert.Equal(t, 1, result.DiffStats.FilesChanged)
+	assert.Equal(t, 1, result.DiffStats.LinesAdded)
+	assert.Equal(t, 1, result.DiffStats.LinesRemoved)
+
+	// The full diff is still kept for applying
+	assert.Equal(t, diff, result.Diff)
+}
+
+func TestEvaluatePatch_AgentTestRunner(t *testing.T) {
+	dir := t.TempDir()
+	arbitrator := NewArbitrator(NewTestRunner("true", 5*time.Second), dir)
+	arbitrator.baseTestResults = &TestResult{Success: true, TotalTests: 1, PassedTests: 1}
+
+	// The override agent validates with a failing command
+	arbitrator.SetAgentTestRunner("strict-agent", NewTestRunner("false", 5*time.Second))
+
+	diff := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-package old
++package main
+`
+
+	result, err := arbitrator.EvaluatePatch(context.Background(), "default-agent", dir, diff, nil)
+	require.NoError(t, err)
+	assert.True(t, result.TestResults.Success, "Default agent should use the global test command")
+
+	result, err = arbitrator.EvaluatePatch(context.Background(), "strict-agent", dir, diff, nil)
+	require.NoError(t, err)
+	assert.False(t, result.TestResults.Success, "Override agent should use its own test command")
+
+	// The override command gets its own baseline
+	require.Contains(t, arbitrator.agentBaselines, "false")
+	assert.False(t, arbitrator.agentBaselines["false"].Success)
+}
+
+func TestEvaluatePatch_MutationError(t *testing.T) {
+	dir := t.TempDir()
+	arbitrator := NewArbitrator(NewTestRunner("true", 5*time.Second), dir)
+	arbitrator.baseTestResults = &TestResult{Success: false, TotalTests: 1, FailedTests: 1}
+	arbitrator.SetScoringWeights(DefaultScoringWeights)
+	arbitrator.EnableMutationTesting(5)
+
+	// The patched file is missing from the worktree, so its mutant can't be evaluated
+	diff := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-	return a
++	return a == b
+`
+
+	result, err := arbitrator.EvaluatePatch(context.Background(), "test-agent", dir, diff, nil)
+	require.NoError(t, err, "A patch whose tests pass is kept when mutation testing fails")
+	assert.True(t, result.TestResults.Success)
+	require.NotNil(t, result.Mutation)
+	assert.Contains(t, result.Mutation.Error, "failed to read file")
+	assert.Contains(t, result.Reason, "mutation testing failed")
+	assert.Contains(t, FormatPatchResult(result), "Mutation testing failed: ")
+}
+
 func TestFormatPatchResult(t *testing.T) {
 	// Create a sample patch result
 	result := &PatchResult{
@@ -163,6 +274,63 @@ func TestFormatPatchResult(t *testing.T) {
 	assert.Contains(t, output, "5 lines removed")
 	assert.Contains(t, output, "10 total")
 	assert.Contains(t, output, "10 passed")
+
+	// Changes reverted by the path policy are listed
+	result.PathViolations = []string{".env"}
+	assert.Contains(t, FormatPatchResult(result), "Stripped: changed files outside the path policy: .env")
+	result.Failure = FailureDeniedPaths
+	assert.Contains(t, FormatPatchResult(result), "Disqualified: changed files outside the path policy: .env")
+
+	// Changes to protected files are flagged
+	result.ProtectedChanges = []string{"restored .git/config", "attempted edit of .git/hooks/pre-commit"}
+	assert.Contains(t, FormatPatchResult(result), "Protected: restored .git/config, attempted edit of .git/hooks/pre-commit")
+}
+
+func TestPatchResult_Partial(t *testing.T) {
+	// A terminated agent's changes are marked as partial work
+	partial := &PatchResult{AgentID: "slow", Diff: "diff --git a/f.go b/f.go\n", Termination: "idle limit exceeded: no activity for 2m0s"}
+	assert.True(t, partial.Partial())
+	assert.Contains(t, FormatPatchResult(partial), "Partial: terminated for idle limit exceeded: no activity for 2m0s")
+
+	// Without changes there is nothing partial to evaluate
+	stopped := &PatchResult{AgentID: "stuck", Termination: "token limit exceeded: 20/10 tokens used"}
+	assert.False(t, stopped.Partial())
+	assert.Contains(t, FormatPatchResult(stopped), "Stopped: token limit exceeded")
+
+	assert.False(t, (&PatchResult{Diff: "diff --git a/f.go b/f.go\n"}).Partial(), "Agents that finished aren't partial")
+}
+
+func TestFormatRanking(t *testing.T) {
+	ranking := FormatRanking([]*PatchResult{
+		{AgentID: "claude", Score: 180, Reason: "all tests pass", TestResults: &TestResult{PassedTests: 4, TotalTests: 4}},
+		{AgentID: "amp", Score: -10, Reason: "no improvement"},
+	})
+
+	lines := strings.Split(strings.TrimSuffix(ranking, "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "=== Arbitration Results ===", lines[0])
+	assert.Equal(t, []string{"1.", "claude", "score", "180", "tests", "4/4", "+0/-0", "all", "tests", "pass"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"2.", "amp", "score", "-10", "tests", "-", "+0/-0", "no", "improvement"}, strings.Fields(lines[2]))
+}
+
+func TestFormatSpend(t *testing.T) {
+	// Nothing is printed when there is no spend and no budget
+	assert.Empty(t, FormatSpend([]*PatchResult{{AgentID: "free"}}, ResourceLimits{}))
+
+	results := []*PatchResult{
+		{AgentID: "claude", Usage: AgentUsage{CostUSD: 1.25}},
+		{AgentID: "codex", Usage: AgentUsage{CostUSD: 0.75}, Termination: "run budget exceeded: $2.00/$2.00 spent by all agents"},
+	}
+	output := FormatSpend(results, ResourceLimits{MaxRunCost: 2})
+	assert.Contains(t, output, "claude               $1.25\n")
+	assert.Contains(t, output, "codex                $0.75 (stopped: run budget exceeded")
+	assert.Contains(t, output, "Total                $2.00 of $2.00 budget\n")
+
+	// Tokens are shown against the shared token budget
+	results[0].Usage.Tokens, results[1].Usage.Tokens = 3000, 1000
+	output = FormatSpend(results, ResourceLimits{MaxRunTokens: 5000})
+	assert.Contains(t, output, "claude               3000 tokens (60% of budget)  $1.25\n")
+	assert.Contains(t, output, "Total                4000 tokens of 5000 budget  $2.00\n")
 }
 
 // Helper functions to set up test patches
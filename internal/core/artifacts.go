@@ -0,0 +1,330 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// Files and directories written to a run directory besides the exported patches
+const (
+	// ConfigSnapshotFile holds the configuration the run used, after profiles and agent selection
+	ConfigSnapshotFile = "config.yaml"
+
+	// PromptFile holds the task prompt
+	PromptFile = "prompt.txt"
+
+	// ReportFile holds the ranking of every evaluated patch as JSON
+	ReportFile = "report.json"
+
+	// TranscriptsDir holds each agent's events as JSON lines, one file per agent
+	TranscriptsDir = "transcripts"
+
+	// TestLogsDir holds the output of every test run, one file per agent plus the baseline
+	TestLogsDir = "tests"
+)
+
+// BaselineTestLog is the name of the test log for the unpatched repository
+const BaselineTestLog = "baseline"
+
+// RunReport summarizes a finished run for its report file
+type RunReport struct {
+	RunID      string            `json:"run_id"`
+	Repo       string            `json:"repo,omitempty"`
+	Task       Task              `json:"task"`
+	Best       string            `json:"best,omitempty"`
+	Candidates []ReportCandidate `json:"candidates"`
+
+	// BestPromptVariant is the prompt variant the best patch's agent was given (empty if the run used none)
+	BestPromptVariant string `json:"best_prompt_variant,omitempty"`
+
+	// ReviewNotes point a human reviewer at the parts of the best patch that need the closest look
+	ReviewNotes []ReviewNote `json:"review_notes,omitempty"`
+
+	// TestAuthor is the agent that wrote failing tests for the other agents to make pass, in TestFiles
+	TestAuthor string   `json:"test_author,omitempty"`
+	TestFiles  []string `json:"test_files,omitempty"`
+
+	// Stacked lists the agents whose patches were stacked on the best one, in the order they were applied
+	Stacked []string `json:"stacked,omitempty"`
+}
+
+// ReportCandidate is one evaluated patch in a run report
+type ReportCandidate struct {
+	AgentID      string           `json:"agent_id"`
+	Score        int              `json:"score"`
+	Reason       string           `json:"reason"`
+	Breakdown    []ScoreComponent `json:"breakdown,omitempty"`
+	FilesChanged int              `json:"files_changed"`
+	LinesAdded   int              `json:"lines_added"`
+	LinesRemoved int              `json:"lines_removed"`
+	TestsPassed  int              `json:"tests_passed"`
+	TestsFailed  int              `json:"tests_failed"`
+	TestsTotal   int              `json:"tests_total"`
+
+	// Usage is recorded so later runs can estimate their cost and duration
+	Tokens          int     `json:"tokens,omitempty"`
+	CostUSD         float64 `json:"cost_usd,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+
+	// Watchdog measurements, for comparing how efficiently agents worked
+	IdleSeconds     float64  `json:"idle_seconds,omitempty"`
+	PeakMemoryBytes int64    `json:"peak_memory_bytes,omitempty"`
+	CPUSeconds      float64  `json:"cpu_seconds,omitempty"`
+	Warnings        []string `json:"warnings,omitempty"`
+
+	// Terminated is why the agent was stopped before it finished
+	Terminated string `json:"terminated,omitempty"`
+
+	// Partial marks a patch holding the work a terminated agent had done when it was stopped
+	Partial bool `json:"partial,omitempty"`
+
+	// Failure categorizes why the agent didn't produce a usable patch, e.g. "rate-limited"
+	Failure        FailureKind `json:"failure,omitempty"`
+	FailureMessage string      `json:"failure_message,omitempty"`
+
+	// PathViolations lists the files the agent changed that the path policy doesn't permit
+	PathViolations []string `json:"path_violations,omitempty"`
+
+	// ProtectedChanges describes the changes the agent made or attempted to git metadata and orchestrator files
+	ProtectedChanges []string `json:"protected_changes,omitempty"`
+
+	// Refinements is how many follow-up rounds revised the patch after its tests failed
+	Refinements int `json:"refinements,omitempty"`
+
+	// Reviewer is the agent that reviewed the patch in a pipeline, and Revisions how often it was revised after
+	Reviewer  string `json:"reviewer,omitempty"`
+	Revisions int    `json:"revisions,omitempty"`
+
+	// PromptVariant is the prompt variant the agent was given
+	PromptVariant string `json:"prompt_variant,omitempty"`
+}
+
+// RunWriter writes a run's outputs to its directory, redacting configured secrets from everything written
+type RunWriter struct {
+	// dir is the run directory
+	dir string
+
+	// cfg supplies the secrets to redact
+	cfg *Config
+}
+
+// NewRunWriter creates the run directory and returns a writer for it
+func NewRunWriter(runDir string, cfg *Config) (*RunWriter, error) {
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run directory: %w", err)
+	}
+	return &RunWriter{dir: runDir, cfg: cfg}, nil
+}
+
+// Dir returns the run directory
+func (w *RunWriter) Dir() string {
+	return w.dir
+}
+
+// WriteConfig writes a snapshot of the configuration the run uses
+// Includes, templates, and profiles are already resolved, so the snapshot leaves them out and loads on its own
+func (w *RunWriter) WriteConfig() error {
+	snapshot := *w.cfg
+	snapshot.Include = nil
+	snapshot.AgentTemplates = nil
+	snapshot.Profiles = nil
+	snapshot.Agents = make([]AgentConfig, len(w.cfg.Agents))
+	for i, agent := range w.cfg.Agents {
+		agent.Extends = ""
+		snapshot.Agents[i] = agent
+	}
+
+	// Secrets are redacted from each value before it is written, since a multi-line value is written as an indented
+	// block that no longer holds it verbatim
+	var node yaml.Node
+	if err := node.Encode(&snapshot); err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	redactNode(&node, w.cfg.Redact)
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+
+	// The active profile isn't part of the encoded configuration, so record it in a comment
+	if w.cfg.ActiveProfile != "" {
+		data = append([]byte(fmt.Sprintf("# profile: %s\n", w.cfg.ActiveProfile)), data...)
+	}
+	return w.write(ConfigSnapshotFile, string(data))
+}
+
+// redactNode redacts every scalar value of a YAML node tree
+func redactNode(node *yaml.Node, redact func(string) string) {
+	if node.Kind == yaml.ScalarNode {
+		node.Value = redact(node.Value)
+		return
+	}
+	for _, child := range node.Content {
+		redactNode(child, redact)
+	}
+}
+
+// WritePrompt writes the task prompt, encrypted if the configuration has an encryption key
+func (w *RunWriter) WritePrompt(task Task) error {
+	data, err := w.private(strings.TrimRight(task.Prompt, "\n") + "\n")
+	if err != nil {
+		return err
+	}
+	return w.writeFile(PromptFile, data)
+}
+
+// WriteTranscript writes an agent's events as JSON lines, encrypted if the configuration has an encryption key
+// Runs write transcripts as events arrive through OpenEventLog; this writes one all at once
+func (w *RunWriter) WriteTranscript(agentID string, events []*protocol.Event) error {
+	log, err := w.OpenEventLog(agentID)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		log.TrackEvent(event)
+	}
+	return log.Close()
+}
+
+// WriteTimeline writes when each agent was thinking, acting, and idle, for viewing in a trace viewer
+// Each agent's events are read from its transcript, falling back to the events kept with its patch
+// When transcripts are encrypted, it leaves out the text of their events
+func (w *RunWriter) WriteTimeline(patches map[string]*PatchDetails) error {
+	timeline := buildTimeline(patches, func(agentID string) []*protocol.Event {
+		if events, err := ReadTranscript(TranscriptPath(w.dir, agentID), w.cfg.Cipher()); err == nil && len(events) > 0 {
+			return events
+		}
+		return patches[agentID].Events
+	})
+	if w.cfg.Privacy.Encrypted() {
+		for _, event := range timeline.TraceEvents {
+			delete(event.Args, "detail")
+		}
+	}
+	data, err := json.Marshal(timeline)
+	if err != nil {
+		return fmt.Errorf("failed to encode timeline: %w", err)
+	}
+	return w.write(TimelineFile, string(data)+"\n")
+}
+
+// WriteTestLog writes the output of a test run under the given name
+func (w *RunWriter) WriteTestLog(name string, result *TestResult) error {
+	if result == nil {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(FormatResults(result))
+	sb.WriteString("\n\n")
+	sb.WriteString(result.Output)
+	return w.store(filepath.Join(TestLogsDir, safeFileName(name)+".log"), sb.String())
+}
+
+// WriteReport writes the ranking of a finished run's patches
+func (w *RunWriter) WriteReport(result *TaskResult) error {
+	report := RunReport{RunID: result.RunID, Repo: result.Repo, Task: result.Task, Candidates: []ReportCandidate{}, ReviewNotes: result.ReviewNotes}
+	if result.TestAuthor != "" {
+		report.TestAuthor, report.TestFiles = result.TestAuthor, TestFiles(result.Tests)
+	}
+	report.Task.Prompt = w.cfg.StoredPrompt(report.Task.Prompt)
+	if result.Best != nil {
+		report.Best = result.Best.AgentID
+		report.BestPromptVariant = PromptVariantOf(result.Best.AgentID)
+		report.Stacked = result.Best.Stacked
+	}
+
+	for _, candidate := range result.Candidates {
+		entry := ReportCandidate{
+			AgentID:      candidate.AgentID,
+			Score:        candidate.Score,
+			Reason:       candidate.Reason,
+			Breakdown:    candidate.Breakdown,
+			FilesChanged: candidate.DiffStats.FilesChanged,
+			LinesAdded:   candidate.DiffStats.LinesAdded,
+			LinesRemoved: candidate.DiffStats.LinesRemoved,
+
+			Tokens:          candidate.Usage.Tokens,
+			CostUSD:         candidate.Usage.CostUSD,
+			DurationSeconds: candidate.Usage.Duration.Seconds(),
+			IdleSeconds:     candidate.Usage.IdleTime.Seconds(),
+			PeakMemoryBytes: candidate.Usage.PeakMemoryBytes,
+			CPUSeconds:      candidate.Usage.CPUTime.Seconds(),
+			Warnings:        candidate.Usage.Warnings,
+			Terminated:      candidate.Termination,
+			Partial:         candidate.Partial(),
+			Failure:         candidate.Failure,
+			FailureMessage:  candidate.FailureMessage,
+			PathViolations:  candidate.PathViolations,
+
+			ProtectedChanges: candidate.ProtectedChanges,
+			Refinements:      candidate.Refinements,
+			Reviewer:         candidate.Reviewer,
+			Revisions:        candidate.Revisions,
+			PromptVariant:    PromptVariantOf(candidate.AgentID),
+		}
+		if tests := candidate.TestResults; tests != nil {
+			entry.TestsPassed, entry.TestsFailed, entry.TestsTotal = tests.PassedTests, tests.FailedTests, tests.TotalTests
+		}
+		report.Candidates = append(report.Candidates, entry)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	return w.write(ReportFile, string(data)+"\n")
+}
+
+// ReadReport loads the report written to a run directory by WriteReport
+func ReadReport(runDir string) (*RunReport, error) {
+	data, err := os.ReadFile(filepath.Join(runDir, ReportFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+
+	var report RunReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report: %w", err)
+	}
+	return &report, nil
+}
+
+// write redacts secrets from content and writes it to a file relative to the run directory
+func (w *RunWriter) write(name, content string) error {
+	return w.writeFile(name, []byte(w.cfg.Redact(content)))
+}
+
+// writeFile writes data to a file relative to the run directory
+func (w *RunWriter) writeFile(name string, data []byte) error {
+	path := filepath.Join(w.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(name), err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// private redacts secrets from content that may hold proprietary context, such as a prompt or transcript,
+// then encrypts it if the configuration has an encryption key
+func (w *RunWriter) private(content string) ([]byte, error) {
+	data := []byte(w.cfg.Redact(content))
+	if c := w.cfg.Cipher(); c != nil {
+		return c.Encrypt(data)
+	}
+	return data, nil
+}
+
+// store redacts secrets from content and writes it to a file relative to the run directory through the
+// artifacts directory's content-addressed store, for files that are written once and shared between runs
+func (w *RunWriter) store(name, content string) error {
+	return storeRunFile(w.dir, name, []byte(w.cfg.Redact(content)))
+}
@@ -0,0 +1,294 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// CheckpointFile records how far a run got, so a run that crashed can be resumed or at least reported
+const CheckpointFile = "checkpoint.json"
+
+// checkpointEventInterval is how often a checkpoint is saved as events arrive; other changes are saved at once
+const checkpointEventInterval = 5 * time.Second
+
+// Stages of a run recorded in its checkpoint
+const (
+	StageBaseline   = "baseline"
+	StageAgents     = "agents"
+	StageEvaluating = "evaluating"
+	StageFinished   = "finished"
+)
+
+// Checkpoint is the state of a run as last saved
+type Checkpoint struct {
+	RunID   string `json:"run_id"`
+	Repo    string `json:"repo,omitempty"`
+	Task    Task   `json:"task"`
+	BaseRef string `json:"base_ref,omitempty"`
+
+	// Stage is what the run was doing
+	Stage string `json:"stage"`
+
+	// Updated is when the checkpoint was saved
+	Updated time.Time `json:"updated"`
+
+	// Agents holds each launched agent's progress
+	Agents map[string]*AgentCheckpoint `json:"agents"`
+}
+
+// AgentCheckpoint is an agent's progress in a checkpoint
+type AgentCheckpoint struct {
+	// Worktree is where the agent works; it survives a crash until the next run reclaims it
+	Worktree string `json:"worktree,omitempty"`
+
+	// Base is the commit the worktree was created at, which its changes are diffed against
+	Base    string    `json:"base,omitempty"`
+	Started time.Time `json:"started"`
+
+	// Events is how many events had been received from the agent
+	Events int `json:"events"`
+
+	// Finished is set once the agent has stopped and its patch and transcript are saved in the run directory
+	Finished bool `json:"finished,omitempty"`
+
+	// How the agent ended, as recorded in the report
+	Termination      string      `json:"termination,omitempty"`
+	Failure          FailureKind `json:"failure,omitempty"`
+	FailureMessage   string      `json:"failure_message,omitempty"`
+	PathViolations   []string    `json:"path_violations,omitempty"`
+	ProtectedChanges []string    `json:"protected_changes,omitempty"`
+	Tokens           int         `json:"tokens,omitempty"`
+	CostUSD          float64     `json:"cost_usd,omitempty"`
+
+	// DurationSeconds is how long the agent ran, once it finished
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+
+	// Evaluated is set once the agent's patch has been scored, with its score
+	Evaluated bool `json:"evaluated,omitempty"`
+	Score     int  `json:"score,omitempty"`
+}
+
+// Usage returns what the agent had consumed when the checkpoint was saved
+func (a *AgentCheckpoint) Usage() AgentUsage {
+	return AgentUsage{Tokens: a.Tokens, CostUSD: a.CostUSD, Duration: time.Duration(a.DurationSeconds * float64(time.Second))}
+}
+
+// Checkpointer saves a run's checkpoint as it makes progress
+// Its methods do nothing on a nil Checkpointer, and a checkpoint that can't be saved is logged as a warning,
+// since the run can carry on without it
+type Checkpointer struct {
+	// writer writes the checkpoint, and each agent's patch and transcript as it finishes
+	writer *RunWriter
+
+	// mutex guards state and saved
+	mutex sync.Mutex
+	state Checkpoint
+	saved time.Time
+}
+
+// NewCheckpointer starts a run's checkpoint in its run directory
+func NewCheckpointer(writer *RunWriter, runID, repo string, task Task, baseRef string) *Checkpointer {
+	return ResumeCheckpointer(writer, &Checkpoint{RunID: runID, Repo: repo, Task: task, BaseRef: baseRef, Stage: StageBaseline, Agents: map[string]*AgentCheckpoint{}})
+}
+
+// ResumeCheckpointer carries on saving a checkpoint read from a run directory, for a run being resumed
+func ResumeCheckpointer(writer *RunWriter, state *Checkpoint) *Checkpointer {
+	c := &Checkpointer{writer: writer, state: *state}
+	c.state.Task.Prompt = writer.cfg.StoredPrompt(c.state.Task.Prompt)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.save()
+	return c
+}
+
+// SetStage records what the run is doing
+func (c *Checkpointer) SetStage(stage string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.state.Stage = stage
+	c.save()
+}
+
+// AgentStarted records an agent launched in a worktree created at a base commit
+func (c *Checkpointer) AgentStarted(agentID, worktree, base string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.state.Agents[agentID] = &AgentCheckpoint{Worktree: worktree, Base: base, Started: time.Now().UTC()}
+	c.save()
+}
+
+// EventReceived counts an event from an agent, saving the checkpoint every few seconds
+func (c *Checkpointer) EventReceived(agentID string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if agent := c.state.Agents[agentID]; agent != nil {
+		agent.Events++
+	}
+	if time.Since(c.saved) >= checkpointEventInterval {
+		c.save()
+	}
+}
+
+// AgentFinished saves an agent's patch to the run directory, where its transcript was written as it ran,
+// so its work survives a crash before evaluation, and records how it ended
+func (c *Checkpointer) AgentFinished(agentID string, patch *PatchDetails) {
+	if c == nil {
+		return
+	}
+	if patch.Diff != "" {
+		c.logError(c.writer.store(patchFileName(agentID), exportableDiff(patch.Diff)))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	agent := c.state.Agents[agentID]
+	if agent == nil {
+		agent = &AgentCheckpoint{Worktree: patch.WorktreePath, Started: time.Now().UTC()}
+		c.state.Agents[agentID] = agent
+	}
+	agent.Finished = true
+	agent.Events = patch.EventCount
+	agent.Termination = patch.Termination
+	agent.Failure, agent.FailureMessage = patch.Failure, patch.FailureMessage
+	agent.PathViolations, agent.ProtectedChanges = patch.PathViolations, patch.ProtectedChanges
+	agent.Tokens, agent.CostUSD, agent.DurationSeconds = patch.Usage.Tokens, patch.Usage.CostUSD, patch.Usage.Duration.Seconds()
+	c.save()
+}
+
+// Evaluated records the score of an agent's patch
+func (c *Checkpointer) Evaluated(result *PatchResult) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if agent := c.state.Agents[result.AgentID]; agent != nil {
+		agent.Evaluated, agent.Score = true, result.Score
+		c.save()
+	}
+}
+
+// save writes the checkpoint to a temporary file and renames it into place, so a crash while saving
+// leaves the previous checkpoint intact; the caller holds the mutex
+func (c *Checkpointer) save() {
+	c.state.Updated = time.Now().UTC()
+	c.saved = time.Now()
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		c.logError(fmt.Errorf("failed to encode checkpoint: %w", err))
+		return
+	}
+
+	path := filepath.Join(c.writer.Dir(), CheckpointFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(c.writer.cfg.Redact(string(data))+"\n"), 0644); err != nil {
+		c.logError(fmt.Errorf("failed to write checkpoint: %w", err))
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		c.logError(fmt.Errorf("failed to write checkpoint: %w", err))
+	}
+}
+
+// logError warns about a checkpoint that couldn't be saved
+func (c *Checkpointer) logError(err error) {
+	if err != nil {
+		slog.Warn("failed to save checkpoint", "run", c.state.RunID, "error", err)
+	}
+}
+
+// ReadCheckpoint loads the checkpoint of a run
+func ReadCheckpoint(runDir string) (*Checkpoint, error) {
+	data, err := os.ReadFile(filepath.Join(runDir, CheckpointFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if checkpoint.Agents == nil {
+		checkpoint.Agents = map[string]*AgentCheckpoint{}
+	}
+	return &checkpoint, nil
+}
+
+// Interrupted reports whether the run stopped before it finished
+func (c *Checkpoint) Interrupted() bool {
+	return c.Stage != StageFinished
+}
+
+// AgentPatches returns each agent's work as of the checkpoint, to be evaluated when the run is resumed
+// Finished agents' patches and transcripts are read from the run directory. Agents that were still running
+// get the diff of their worktree, if it survived, and are otherwise reported as crashed with no patch
+// The patches have no worktrees; the caller applies them to fresh ones. Encrypted transcripts are read with cipher,
+// and worktree diffs up to maxDiffBytes (0 for gitutil.DefaultMaxDiffBytes)
+func (c *Checkpoint) AgentPatches(runDir string, cipher *Cipher, maxDiffBytes int64) (map[string]*PatchDetails, error) {
+	patches := make(map[string]*PatchDetails, len(c.Agents))
+	for agentID, agent := range c.Agents {
+		patch := &PatchDetails{
+			Usage:          agent.Usage(),
+			Termination:    agent.Termination,
+			Failure:        agent.Failure,
+			FailureMessage: agent.FailureMessage,
+			PathViolations: agent.PathViolations,
+
+			ProtectedChanges: agent.ProtectedChanges,
+		}
+		// Only the summary of the transcript is kept, as it is for a run's agents
+		// The transcript of an agent cut off by the interruption was never finished, so what it holds is kept
+		if events, err := ReadTranscript(TranscriptPath(runDir, agentID), cipher); err == nil || errors.Is(err, ErrUnfinished) {
+			summary := NewEventSummary()
+			for _, event := range events {
+				summary.TrackEvent(event)
+			}
+			patch.Events, patch.EventCount = summary.Events(), summary.Count()
+		}
+		patches[agentID] = patch
+
+		if agent.Finished {
+			diff, err := os.ReadFile(filepath.Join(runDir, patchFileName(agentID)))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("failed to read patch for %s: %w", agentID, err)
+			}
+			patch.Diff = string(diff)
+			continue
+		}
+
+		// The agent was cut off, so whatever it left in its worktree is all it produced
+		patch.Failure, patch.FailureMessage = FailureCrashed, "run interrupted before the agent finished"
+		if agent.Worktree == "" || agent.Base == "" {
+			continue
+		}
+		if _, err := os.Stat(agent.Worktree); err != nil {
+			continue
+		}
+		diff, err := gitutil.DiffWorktree(agent.Worktree, agent.Base, maxDiffBytes)
+		if err != nil {
+			slog.Warn("failed to recover work of interrupted agent", "agent", agentID, "error", err)
+			continue
+		}
+		patch.Diff = diff
+		patch.FailureMessage = "run interrupted before the agent finished; its unfinished work is evaluated"
+	}
+	return patches, nil
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointer(t *testing.T) {
+	runDir := t.TempDir()
+	w, err := NewRunWriter(runDir, &Config{secrets: []string{"sk-secret"}})
+	require.NoError(t, err)
+
+	c := NewCheckpointer(w, "run-1", "/src/repo", Task{Prompt: "Fix the bug"}, "main")
+	checkpoint, err := ReadCheckpoint(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, StageBaseline, checkpoint.Stage)
+	assert.True(t, checkpoint.Interrupted())
+	assert.Empty(t, checkpoint.Agents)
+
+	c.SetStage(StageAgents)
+	c.AgentStarted("claude", "/work/worktree-claude", "abc123")
+	c.AgentStarted("codex", filepath.Join(runDir, "gone"), "abc123")
+	c.EventReceived("claude")
+
+	event, err := protocol.NewEvent(protocol.EventTypeThinking, "claude", 0).WithPayload(protocol.ThinkingPayload{Content: "using sk-secret"})
+	require.NoError(t, err)
+	action, err := protocol.NewEvent(protocol.EventTypeAction, "claude", 1).WithPayload(protocol.ActionPayload{ActionType: "edit", FilePath: "main.go"})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTranscript("claude", []*protocol.Event{event, action}))
+	diff := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-return 1\n+return 2 // sk-secret\n"
+	c.AgentFinished("claude", &PatchDetails{
+		Diff:       diff,
+		Events:     []*protocol.Event{action},
+		EventCount: 2,
+		Usage:      AgentUsage{Tokens: 1200, CostUSD: 0.5, Duration: 90 * time.Second},
+	})
+	c.SetStage(StageEvaluating)
+	c.Evaluated(&PatchResult{AgentID: "claude", Score: 12})
+
+	checkpoint, err = ReadCheckpoint(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, "run-1", checkpoint.RunID)
+	assert.Equal(t, "main", checkpoint.BaseRef)
+	assert.Equal(t, StageEvaluating, checkpoint.Stage)
+	claude := checkpoint.Agents["claude"]
+	require.NotNil(t, claude)
+	assert.True(t, claude.Finished)
+	assert.True(t, claude.Evaluated)
+	assert.Equal(t, 12, claude.Score)
+	assert.Equal(t, 2, claude.Events)
+	assert.Equal(t, AgentUsage{Tokens: 1200, CostUSD: 0.5, Duration: 90 * time.Second}, claude.Usage())
+	assert.False(t, checkpoint.Agents["codex"].Finished)
+
+	// The finished agent's work is saved, redacted, as soon as it finishes
+	patches, err := checkpoint.AgentPatches(runDir, nil, 0)
+	require.NoError(t, err)
+	require.Len(t, patches, 2)
+	assert.Contains(t, patches["claude"].Diff, "+return 2")
+	assert.NotContains(t, patches["claude"].Diff, "sk-secret")
+	// Its events are summarized from its transcript, which was written as they arrived
+	require.Len(t, patches["claude"].Events, 1)
+	assert.Equal(t, protocol.EventTypeAction, patches["claude"].Events[0].Type)
+	assert.Equal(t, 2, patches["claude"].EventCount)
+	assert.Empty(t, patches["claude"].Failure)
+	assert.Equal(t, 1200, patches["claude"].Usage.Tokens)
+
+	// An agent cut off whose worktree is gone has nothing to evaluate
+	assert.Empty(t, patches["codex"].Diff)
+	assert.Equal(t, FailureCrashed, patches["codex"].Failure)
+
+	c.SetStage(StageFinished)
+	checkpoint, err = ReadCheckpoint(runDir)
+	require.NoError(t, err)
+	assert.False(t, checkpoint.Interrupted())
+
+	// Nil checkpointers, for runs without one, ignore everything
+	var none *Checkpointer
+	none.SetStage(StageAgents)
+	none.AgentStarted("claude", "", "")
+	none.EventReceived("claude")
+	none.AgentFinished("claude", &PatchDetails{})
+	none.Evaluated(&PatchResult{AgentID: "claude"})
+
+	_, err = ReadCheckpoint(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestCheckpointRecoversUnfinishedWork(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that runs git in short mode")
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		return strings.TrimSpace(string(output))
+	}
+	git("init", "-q")
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0644))
+	git("add", "main.go")
+	git("commit", "-q", "-m", "initial")
+	base := git("rev-parse", "HEAD")
+
+	// The agent had edited a file and added another when the run crashed
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "util.go"), []byte("package main\n"), 0644))
+
+	runDir := t.TempDir()
+	w, err := NewRunWriter(runDir, &Config{})
+	require.NoError(t, err)
+	c := NewCheckpointer(w, "run-1", repo, Task{Prompt: "Fix the bug"}, "")
+	c.AgentStarted("claude", repo, base)
+
+	checkpoint, err := ReadCheckpoint(runDir)
+	require.NoError(t, err)
+	patches, err := checkpoint.AgentPatches(runDir, nil, 0)
+	require.NoError(t, err)
+	patch := patches["claude"]
+	require.NotNil(t, patch)
+	assert.Equal(t, FailureCrashed, patch.Failure)
+	assert.Contains(t, patch.Diff, "+func main() {}")
+	assert.Contains(t, patch.Diff, "b/util.go")
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and makes tickers for the watchdog and test runners
+// SystemClock is the real one; ManualClock lets tests and deterministic runs decide when time passes
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// NewTicker returns a ticker that ticks every d
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on a channel until it is stopped
+type Ticker interface {
+	// C returns the channel ticks are delivered on
+	C() <-chan time.Time
+
+	// Stop turns the ticker off; no more ticks are delivered
+	Stop()
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+// Now implements Clock
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker implements Clock
+func (SystemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker is a Ticker backed by a time.Ticker
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.ticker.C }
+func (t systemTicker) Stop()               { t.ticker.Stop() }
+
+// ManualClock is a clock that only moves when it is advanced
+// Its tickers tick as Advance passes their ticks, dropping ticks nobody was ready for as time.Ticker does
+type ManualClock struct {
+	mutex   sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	tickers map[*manualTicker]bool
+}
+
+// NewManualClock returns a clock stopped at start
+func NewManualClock(start time.Time) *ManualClock {
+	c := &ManualClock{now: start, tickers: make(map[*manualTicker]bool)}
+	c.changed = sync.NewCond(&c.mutex)
+	return c
+}
+
+// Now implements Clock
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// NewTicker implements Clock
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ticker := &manualTicker{clock: c, interval: d, next: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.tickers[ticker] = true
+	c.changed.Broadcast()
+	return ticker
+}
+
+// Advance moves the clock forward by d, ticking every ticker whose ticks it passes
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	for ticker := range c.tickers {
+		for !ticker.next.After(c.now) {
+			select {
+			case ticker.ch <- ticker.next:
+			default:
+			}
+			ticker.next = ticker.next.Add(ticker.interval)
+		}
+	}
+}
+
+// WaitForTickers blocks until at least n tickers are running, so a test can advance the clock knowing the
+// goroutines it started are waiting on it
+func (c *ManualClock) WaitForTickers(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.tickers) < n {
+		c.changed.Wait()
+	}
+}
+
+// manualTicker is a Ticker of a ManualClock
+type manualTicker struct {
+	clock    *ManualClock
+	interval time.Duration
+	next     time.Time
+	ch       chan time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time { return t.ch }
+
+func (t *manualTicker) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	delete(t.clock.tickers, t)
+	t.clock.changed.Broadcast()
+}
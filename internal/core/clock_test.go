@@ -0,0 +1,31 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	ticker := clock.NewTicker(time.Second)
+	clock.WaitForTickers(1)
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, start.Add(500*time.Millisecond), clock.Now())
+	assert.Empty(t, ticker.C(), "No tick is due yet")
+
+	// Ticks nobody received are dropped, leaving the first
+	clock.Advance(3 * time.Second)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+	assert.Empty(t, ticker.C())
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, start.Add(4*time.Second), <-ticker.C())
+
+	ticker.Stop()
+	clock.Advance(time.Minute)
+	assert.Empty(t, ticker.C(), "A stopped ticker doesn't tick")
+}
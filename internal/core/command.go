@@ -0,0 +1,33 @@
+package core
+
+import (
+	"os/exec"
+
+	"github.com/brettsmith212/orchestrator/internal/procutil"
+)
+
+// CommandRunner runs a prepared command to completion, writing its output to the command's Stdout and Stderr
+// ProcessRunner starts real processes; tests and deterministic runs can stand in for them
+type CommandRunner interface {
+	Run(cmd *exec.Cmd) error
+}
+
+// CommandRunnerFunc adapts a function to a CommandRunner
+type CommandRunnerFunc func(cmd *exec.Cmd) error
+
+// Run implements CommandRunner
+func (f CommandRunnerFunc) Run(cmd *exec.Cmd) error {
+	return f(cmd)
+}
+
+// ProcessRunner runs commands as processes in a group of their own, so stopping one also stops what it started
+type ProcessRunner struct{}
+
+// Run implements CommandRunner
+func (ProcessRunner) Run(cmd *exec.Cmd) error {
+	group, err := procutil.Start(cmd)
+	if err != nil {
+		return err
+	}
+	return group.Wait()
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultBranchPattern is the branch naming pattern used when none is configured
+// Supported placeholders are {slug}, {run_id}, and {agent}
+const DefaultBranchPattern = "orchestrator/{slug}-{run_id}"
+
+// maxSlugLength keeps generated branch names readable
+const maxSlugLength = 40
+
+// Slugify converts a task prompt into a short, branch-safe identifier
+func Slugify(text string) string {
+	var sb strings.Builder
+	lastDash := true // Avoid a leading dash
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			sb.WriteRune(r)
+			lastDash = false
+		case !lastDash:
+			sb.WriteRune('-')
+			lastDash = true
+		}
+
+		if sb.Len() >= maxSlugLength {
+			break
+		}
+	}
+
+	slug := strings.Trim(sb.String(), "-")
+	if slug == "" {
+		return "task"
+	}
+
+	return slug
+}
+
+// BranchName expands a branch naming pattern for a run
+func BranchName(pattern, prompt, runID, agentID string) string {
+	if pattern == "" {
+		pattern = DefaultBranchPattern
+	}
+
+	replacer := strings.NewReplacer(
+		"{slug}", Slugify(prompt),
+		"{run_id}", runID,
+		"{agent}", agentID,
+	)
+
+	return replacer.Replace(pattern)
+}
+
+// CommitMessage generates a commit message describing the winning patch
+func CommitMessage(prompt string, result *PatchResult) string {
+	var sb strings.Builder
+
+	// Use the first line of the prompt as the subject
+	subject := strings.TrimSpace(strings.SplitN(strings.TrimSpace(prompt), "\n", 2)[0])
+	// Subjects are cut by runes, so a multi-byte character is never split
+	if runes := []rune(subject); len(runes) > 72 {
+		subject = string(runes[:69]) + "..."
+	}
+	if subject == "" {
+		subject = "Apply orchestrator patch"
+	}
+
+	sb.WriteString(subject + "\n\n")
+	sb.WriteString(fmt.Sprintf("Prompt: %s\n", strings.TrimSpace(prompt)))
+	sb.WriteString(fmt.Sprintf("Agent: %s\n", result.AgentID))
+	sb.WriteString(fmt.Sprintf("Score: %d (%s)\n", result.Score, result.Reason))
+
+	if result.TestResults != nil {
+		sb.WriteString(fmt.Sprintf("Tests: %s\n", FormatResults(result.TestResults)))
+	}
+
+	return sb.String()
+}
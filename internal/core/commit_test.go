@@ -0,0 +1,59 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "simple", input: "Fix the bug", expected: "fix-the-bug"},
+		{name: "punctuation", input: "  Fix: divide-by-zero (again)! ", expected: "fix-divide-by-zero-again"},
+		{name: "empty", input: "!!!", expected: "task"},
+		{name: "long", input: strings.Repeat("word ", 20), expected: "word-word-word-word-word-word-word-word"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Slugify(tc.input))
+		})
+	}
+}
+
+func TestBranchName(t *testing.T) {
+	assert.Equal(t, "orchestrator/fix-the-bug-run1", BranchName("", "Fix the bug", "run1", "amp"))
+	assert.Equal(t, "ai/amp/fix-the-bug", BranchName("ai/{agent}/{slug}", "Fix the bug", "run1", "amp"))
+}
+
+func TestCommitMessage(t *testing.T) {
+	result := &PatchResult{
+		AgentID: "test-agent",
+		Score:   150,
+		Reason:  "Tests now passing",
+		TestResults: &TestResult{
+			Success:     true,
+			TotalTests:  3,
+			PassedTests: 3,
+		},
+	}
+
+	message := CommitMessage("Fix the divide bug\nMore details", result)
+
+	assert.True(t, strings.HasPrefix(message, "Fix the divide bug\n\n"), "Subject should be the first prompt line")
+	assert.Contains(t, message, "Agent: test-agent")
+	assert.Contains(t, message, "Score: 150 (Tests now passing)")
+	assert.Contains(t, message, "Tests PASSED (3 total, 3 passed")
+
+	// Long subjects are cut to 72 characters, never through one
+	message = CommitMessage(strings.Repeat("é", 100), result)
+	subject := strings.SplitN(message, "\n", 2)[0]
+	assert.True(t, utf8.ValidString(subject))
+	assert.Equal(t, strings.Repeat("é", 69)+"...", subject)
+}
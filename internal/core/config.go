@@ -1,84 +1,1094 @@
 package core
 
 import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds orchestrator application configuration
 type Config struct {
+	// Include lists other config files merged beneath this one (paths may be globs)
+	Include []string `yaml:"include,omitempty"`
+
+	// Preset names a built-in configuration for a stack, such as node, python, or rust, merged beneath this one
+	Preset string `yaml:"preset,omitempty"`
+
 	// WorkingDir is the directory where orchestrator will create git worktrees
 	WorkingDir string `yaml:"working_dir"`
 
+	// ArtifactsDir is where per-run outputs such as exported patches are written
+	// Each run gets its own subdirectory named after the run ID (defaults to <working_dir>/runs)
+	ArtifactsDir string `yaml:"artifacts_dir"`
+
+	// WorktreeBackend selects how agent checkouts are created: "auto", "worktree", or "clone"
+	WorktreeBackend string `yaml:"worktree_backend"`
+
+	// LFSPull runs `git lfs install` and `git lfs pull` in each worktree of an LFS repository
+	LFSPull bool `yaml:"lfs_pull"`
+
+	// DiffLimits bounds the memory reading agents' diffs takes, such as of minified or generated files
+	DiffLimits DiffLimitsConfig `yaml:"diff_limits,omitempty"`
+
 	// Agents defines the list of AI coding agents to use
 	Agents []AgentConfig `yaml:"agents"`
 
+	// Pipelines have agents' patches reviewed by other agents, and revised, before they are judged
+	Pipelines []PipelineConfig `yaml:"pipelines,omitempty"`
+
+	// AgentTemplates defines reusable agent settings that agents extend by name
+	AgentTemplates map[string]AgentConfig `yaml:"agent_templates,omitempty"`
+
 	// TestCommand is the command to run tests in the repository
 	TestCommand string `yaml:"test_command"`
 
+	// TestParser reads test counts from the test command's output: go (the default), jest, pytest, or cargo
+	TestParser string `yaml:"test_parser,omitempty"`
+
+	// TestShell runs test commands through sh, cmd, or powershell, for commands using pipes, &&, or variables;
+	// "default" is cmd on Windows and sh elsewhere (empty runs a command's first word with the rest as arguments)
+	TestShell string `yaml:"test_shell,omitempty"`
+
 	// TimeoutSeconds is the maximum time to wait for agent responses
 	TimeoutSeconds int `yaml:"timeout_seconds"`
+
+	// PromptTemplate wraps every task prompt, as a Go text/template rendered with PromptData
+	PromptTemplate string `yaml:"prompt_template"`
+
+	// Context selects files relevant to the task that are offered to agents alongside the prompt
+	Context ContextConfig `yaml:"context"`
+
+	// Samples is how many independent attempts each agent makes, each in its own worktree (defaults to 1)
+	Samples int `yaml:"samples"`
+
+	// PromptVariants phrase the task differently; every agent runs once per variant (empty to give agents the prompt
+	// as it is)
+	PromptVariants []PromptVariant `yaml:"prompt_variants,omitempty"`
+
+	// DiffIgnore lists glob patterns for files whose changes are excluded from diff stats and scoring
+	// Patterns ending in "/" match whole directories, e.g. "vendor/"
+	DiffIgnore []string `yaml:"diff_ignore"`
+
+	// Paths limits the files agents may change; changes to other files are stripped, or disqualify the patch
+	Paths PathPolicy `yaml:"paths,omitempty"`
+
+	// Scope confines a run to a subtree of a monorepo, e.g. "pkg/service-a": changes outside it are stripped like
+	// those the path policy doesn't permit, tests run from it, and context files come from it
+	Scope string `yaml:"scope,omitempty"`
+
+	// BranchPattern is the naming pattern for branches holding winning patches
+	// Supported placeholders are {slug}, {run_id}, and {agent}
+	BranchPattern string `yaml:"branch_pattern"`
+
+	// Limits configures the resource limits the watchdog enforces for every agent
+	Limits LimitsConfig `yaml:"limits"`
+
+	// TypeLimits overrides the global limits for every agent of an adapter type, keyed by type
+	// An agent's own limits block takes precedence over its type's
+	TypeLimits map[string]LimitsConfig `yaml:"type_limits,omitempty"`
+
+	// Sandbox runs agents and tests in containers that see only their worktree
+	Sandbox SandboxConfig `yaml:"sandbox"`
+
+	// Mutation configures the optional mutation-testing evaluation pass
+	Mutation MutationConfig `yaml:"mutation"`
+
+	// TDD has an agent write failing tests before the others start, and the others make them pass
+	TDD TDDConfig `yaml:"tdd,omitempty"`
+
+	// Speculative evaluates patches as agents finish, stopping the rest once one is good enough
+	Speculative SpeculativeConfig `yaml:"speculative"`
+
+	// Refine gives agents more attempts, with the test failures, while the best patch leaves tests failing
+	Refine RefineConfig `yaml:"refine"`
+
+	// Stack stacks several patches into the result when the best one alone leaves tests failing
+	Stack StackConfig `yaml:"stack,omitempty"`
+
+	// SmokeTest gives every agent a trivial task before a run, leaving out of the run the agents that fail it
+	SmokeTest SmokeTestConfig `yaml:"smoke_test"`
+
+	// Scoring adjusts the weights used to score patches (unset weights keep their defaults)
+	Scoring ScoringWeights `yaml:"scoring"`
+
+	// Notify announces finished runs, which are otherwise easy to miss
+	Notify NotifyConfig `yaml:"notify"`
+
+	// Hooks runs commands at points in a run, such as to install dependencies in each worktree
+	Hooks HooksConfig `yaml:"hooks,omitempty"`
+
+	// Chat posts each run's start and finish to a Slack or Discord channel, and lets the channel start runs
+	Chat ChatConfig `yaml:"chat"`
+
+	// Tracing exports each run as an OpenTelemetry trace
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// Server secures the HTTP API of `orchestrator serve`
+	Server ServerConfig `yaml:"server"`
+
+	// Webhooks lets GitHub and GitLab webhooks start runs on a server started with `orchestrator serve`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+
+	// Jira lets --issue take the task from a Jira issue, and reports the outcome back to it
+	Jira JiraConfig `yaml:"jira"`
+
+	// Linear lets --issue take the task from a Linear issue, and reports the outcome back to it
+	Linear LinearConfig `yaml:"linear"`
+
+	// ArtifactRetention limits how much run history is kept in the artifacts directory (unset keeps every run)
+	ArtifactRetention RetentionConfig `yaml:"artifact_retention"`
+
+	// AuditLog is a file every consequential action is appended to, for traceability (empty for none)
+	AuditLog string `yaml:"audit_log,omitempty"`
+
+	// Privacy scrubs text from everything a run stores, and can encrypt its prompt and transcripts at rest
+	Privacy PrivacyConfig `yaml:"privacy,omitempty"`
+
+	// ConfirmAbove sets the estimated cost and time above which a run asks before starting
+	ConfirmAbove ConfirmConfig `yaml:"confirm_above"`
+
+	// Profiles defines named variations of this configuration, selected with --profile
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+
+	// ActiveProfile is the name of the applied profile (empty if none)
+	ActiveProfile string `yaml:"-"`
+
+	// secrets holds resolved secret values so they can be redacted from artifacts
+	secrets []string
+
+	// scrubbers are the compiled privacy.scrub patterns, also redacted from artifacts
+	scrubbers []*regexp.Regexp
+
+	// cipher encrypts prompts and transcripts with privacy.encryption_key (nil if they aren't encrypted)
+	cipher *Cipher
+}
+
+// DiffLimitsConfig bounds how much of a diff is held in memory
+type DiffLimitsConfig struct {
+	// MaxBytes is the largest diff taken from an agent's worktree; the agent fails if its diff is larger, which is
+	// never read past the limit (0 for 100 MiB)
+	MaxBytes int64 `yaml:"max_bytes,omitempty"`
+
+	// MaxLineBytes is how much of each diff line is held while parsing it for scoring (0 for 64 KiB)
+	MaxLineBytes int `yaml:"max_line_bytes,omitempty"`
+}
+
+// MutationConfig controls mutation testing of passing patches
+type MutationConfig struct {
+	// Enabled turns on mutation testing during patch evaluation
+	Enabled bool `yaml:"enabled"`
+
+	// MaxMutants caps the number of mutants evaluated per patch
+	MaxMutants int `yaml:"max_mutants"`
+}
+
+// NotifyConfig selects how a finished run is announced; any combination may be used
+type NotifyConfig struct {
+	// Desktop shows a desktop notification (notify-send on Linux, osascript on macOS)
+	Desktop bool `yaml:"desktop"`
+
+	// Webhook is a Slack or Discord incoming webhook URL the summary is posted to
+	Webhook string `yaml:"webhook"`
+
+	// Command is a shell command run with the outcome in ORCHESTRATOR_* environment variables
+	Command string `yaml:"command"`
+}
+
+// Enabled reports whether any notification is configured
+func (n NotifyConfig) Enabled() bool {
+	return n.Desktop || n.Webhook != "" || n.Command != ""
+}
+
+// ChatConfig connects runs to a Slack or Discord channel
+type ChatConfig struct {
+	// Webhook is a Slack or Discord incoming webhook URL that each run's start and finish are posted to (empty disables the messages)
+	Webhook string `yaml:"webhook"`
+
+	// ServerURL is where `orchestrator serve` is reached, e.g. https://orchestrator.example.com; messages link to the run's
+	// report page there instead of to its file in the artifacts directory
+	ServerURL string `yaml:"server_url,omitempty"`
+
+	// SlackSigningSecret verifies Slack slash commands sent to POST /chat/slack on a server (empty disables them)
+	SlackSigningSecret string `yaml:"slack_signing_secret,omitempty"`
+
+	// DiscordPublicKey is the hex public key of a Discord application, which verifies its slash commands
+	// sent to POST /chat/discord on a server (empty disables them)
+	DiscordPublicKey string `yaml:"discord_public_key,omitempty"`
+}
+
+// Enabled reports whether runs are posted to a channel
+func (c ChatConfig) Enabled() bool {
+	return c.Webhook != ""
+}
+
+// ReportLink returns where a message links to a run's report: its page on the server, if there is one,
+// and otherwise its file in the artifacts directory
+func (c ChatConfig) ReportLink(artifactsDir, runID string) string {
+	if c.ServerURL != "" {
+		return strings.TrimRight(c.ServerURL, "/") + "/runs/" + url.PathEscape(runID) + "/" + ReportHTMLFile
+	}
+	return filepath.Join(artifactsDir, runID, ReportHTMLFile)
+}
+
+// validate checks the chat URLs and Discord key
+func (c ChatConfig) validate() error {
+	for _, field := range []struct{ name, value string }{{"chat.webhook", c.Webhook}, {"chat.server_url", c.ServerURL}} {
+		if field.value == "" {
+			continue
+		}
+		if u, err := url.Parse(field.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fieldError(field.name, "%s must be an http or https URL", field.name)
+		}
+	}
+	if c.DiscordPublicKey != "" {
+		if key, err := hex.DecodeString(c.DiscordPublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+			return fieldError("chat.discord_public_key", "chat.discord_public_key must be a %d-byte hex public key", ed25519.PublicKeySize)
+		}
+	}
+	return nil
+}
+
+// ServerConfig controls who may submit tasks to `orchestrator serve`, and which repositories they may run in
+type ServerConfig struct {
+	// Token must be sent as a bearer token by requests that submit, cancel, or read runs (empty requires none, but
+	// then only requests for a localhost name are served)
+	Token string `yaml:"token,omitempty"`
+
+	// RepoHosts are the hosts submitted tasks may name a repository on, cloned over https or ssh
+	// (empty lets submitted tasks run only in the server's own repository)
+	RepoHosts []string `yaml:"repo_hosts,omitempty"`
+}
+
+// AllowsRepo reports whether a submitted task may clone a repository URL: it must use https or ssh, including
+// scp-like user@host:path addresses, on one of the repo hosts. Hosts are compared case-insensitively
+func (s ServerConfig) AllowsRepo(repoURL string) bool {
+	var host string
+	if u, err := url.Parse(repoURL); err == nil && strings.Contains(repoURL, "://") {
+		if u.Scheme != "https" && u.Scheme != "ssh" {
+			return false
+		}
+		host = u.Hostname()
+	} else if before, _, ok := strings.Cut(repoURL, ":"); ok && !strings.Contains(before, "/") {
+		// Git reads [user@]host:path as ssh only without a slash before the colon, and as a local path otherwise
+		host = before[strings.LastIndex(before, "@")+1:]
+	}
+	if host == "" {
+		return false
+	}
+	for _, allowed := range s.RepoHosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhooksConfig controls which GitHub and GitLab webhook deliveries start runs
+type WebhooksConfig struct {
+	// Secret authenticates deliveries: GitHub signs them with it, and GitLab sends it as a token (empty disables webhooks)
+	Secret string `yaml:"secret"`
+
+	// Label starts a run on an issue when it is added (default "orchestrator")
+	Label string `yaml:"label,omitempty"`
+
+	// Command starts a run when a comment begins with it, with the rest of the comment as the prompt (default "/orchestrate")
+	Command string `yaml:"command,omitempty"`
+
+	// Repos limits runs to these repositories, as owner/repo or group/project (empty allows any that signs deliveries)
+	Repos []string `yaml:"repos,omitempty"`
+
+	// GitLabUsers are the GitLab usernames whose comments may start runs, since GitLab deliveries don't say
+	// what access a comment's author has (empty ignores every GitLab comment)
+	GitLabUsers []string `yaml:"gitlab_users,omitempty"`
+}
+
+// Enabled reports whether webhooks can start runs
+func (w WebhooksConfig) Enabled() bool {
+	return w.Secret != ""
+}
+
+// TriggerLabel returns the label that starts a run on an issue
+func (w WebhooksConfig) TriggerLabel() string {
+	if w.Label == "" {
+		return "orchestrator"
+	}
+	return w.Label
+}
+
+// TriggerCommand returns the comment prefix that starts a run
+func (w WebhooksConfig) TriggerCommand() string {
+	if w.Command == "" {
+		return "/orchestrate"
+	}
+	return w.Command
+}
+
+// AllowsRepo reports whether webhooks from a repository may start runs; names are compared case-insensitively
+func (w WebhooksConfig) AllowsRepo(name string) bool {
+	if len(w.Repos) == 0 {
+		return true
+	}
+	for _, repo := range w.Repos {
+		if strings.EqualFold(repo, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGitLabUser reports whether a GitLab user's comments may start runs; names are compared case-insensitively
+func (w WebhooksConfig) AllowsGitLabUser(name string) bool {
+	for _, user := range w.GitLabUsers {
+		if strings.EqualFold(user, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// JiraConfig connects runs to a Jira site
+type JiraConfig struct {
+	// URL is the site's root, e.g. https://example.atlassian.net (empty disables Jira)
+	URL string `yaml:"url"`
+
+	// Email is the account the token belongs to on Jira Cloud; leave it empty to send the token as a
+	// personal access token, as Jira Data Center expects
+	Email string `yaml:"email,omitempty"`
+
+	// Token is an API token or personal access token
+	Token string `yaml:"token,omitempty"`
+
+	// Transition is applied to an issue once a run solves it, by the transition's name or the status
+	// it leads to, e.g. "In Review" (empty leaves the status alone)
+	Transition string `yaml:"transition,omitempty"`
+}
+
+// Enabled reports whether Jira issues can be used as tasks
+func (j JiraConfig) Enabled() bool {
+	return j.URL != ""
+}
+
+// LinearConfig connects runs to a Linear workspace
+type LinearConfig struct {
+	// Token is a Linear API key (empty disables Linear)
+	Token string `yaml:"token"`
+
+	// State is the workflow state an issue is moved to once a run solves it, e.g. "In Review"
+	// (empty leaves the state alone)
+	State string `yaml:"state,omitempty"`
+}
+
+// Enabled reports whether Linear issues can be used as tasks
+func (l LinearConfig) Enabled() bool {
+	return l.Token != ""
+}
+
+// TracingConfig sends traces of runs to an OpenTelemetry collector over OTLP/HTTP
+type TracingConfig struct {
+	// Endpoint is the collector's base URL, e.g. http://localhost:4318 (empty disables tracing)
+	Endpoint string `yaml:"endpoint"`
+
+	// Headers are sent with every export, e.g. an API key for a hosted backend
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// ServiceName identifies the orchestrator in the tracing backend (default "orchestrator")
+	ServiceName string `yaml:"service_name,omitempty"`
 }
 
 // AgentConfig defines configuration for a single AI coding agent
 type AgentConfig struct {
+	// Extends names the agent template this agent inherits settings from
+	Extends string `yaml:"extends,omitempty"`
+
 	// ID is a unique identifier for the agent
 	ID string `yaml:"id"`
 
-	// Type is the adapter type ("http" or "cli")
+	// Type is the registered adapter type, e.g. "cli"
 	Type string `yaml:"type"`
 
+	// Enabled controls whether the agent runs by default (defaults to true)
+	// Disabled agents only run when selected by ID with --agents
+	Enabled *bool `yaml:"enabled"`
+
+	// Tags label the agent for selection with --tags
+	Tags []string `yaml:"tags"`
+
 	// Config holds adapter-specific configuration
 	Config map[string]interface{} `yaml:"config"`
+
+	// TimeoutSeconds overrides the global timeout for this agent (0 uses the global value)
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+
+	// TestCommand overrides the global test command used to validate this agent's patch
+	TestCommand string `yaml:"test_command"`
+
+	// Samples overrides the global number of attempts for this agent (0 uses the global value)
+	Samples int `yaml:"samples"`
+
+	// Limits overrides the global resource limits for this agent
+	Limits LimitsConfig `yaml:"limits"`
+
+	// Network limits the hosts the agent can reach, which the sandbox enforces (defaults to unrestricted)
+	Network NetworkPolicy `yaml:"network,omitempty"`
+}
+
+// LimitsConfig holds resource limits enforced by the watchdog (0 keeps the inherited value)
+type LimitsConfig struct {
+	// MaxTokens is the maximum number of tokens an agent can consume
+	MaxTokens int `yaml:"max_tokens"`
+
+	// MaxCostUSD is the maximum amount in US dollars an agent can spend
+	MaxCostUSD float64 `yaml:"max_cost_usd"`
+
+	// MaxDurationSeconds is the maximum time an agent can run
+	MaxDurationSeconds int `yaml:"max_duration_seconds"`
+
+	// MaxIdleSeconds is the maximum time an agent can go without emitting an event
+	MaxIdleSeconds int `yaml:"max_idle_seconds"`
+
+	// MaxDiskMB is the maximum size in megabytes an agent's worktree can grow to
+	MaxDiskMB int64 `yaml:"max_disk_mb"`
+
+	// MaxMemoryMB is the most resident memory in megabytes an agent's process tree can use
+	MaxMemoryMB int64 `yaml:"max_memory_mb"`
+
+	// MaxCPUSeconds is the most CPU time an agent's process tree can use
+	MaxCPUSeconds int `yaml:"max_cpu_seconds"`
+
+	// MaxRunCostUSD is the most all of a run's agents together can spend (global limits only)
+	MaxRunCostUSD float64 `yaml:"max_run_cost_usd"`
+
+	// MaxRunTokens is the most tokens all of a run's agents together can use (global limits only)
+	MaxRunTokens int `yaml:"max_run_tokens"`
+
+	// WarnAtPercent lists the percentages of each limit at which agents are warned, e.g. [50, 80, 95]
+	// Unset inherits the thresholds (80% by default); an empty list disables warnings
+	WarnAtPercent []float64 `yaml:"warn_at_percent"`
+
+	// CheckIntervalSeconds is how often the watchdog checks limits (global limits only)
+	CheckIntervalSeconds int `yaml:"check_interval_seconds"`
+
+	// CancelGraceSeconds is how long agents have to wrap up once the run is interrupted, before they are killed
+	// (global limits only)
+	CancelGraceSeconds int `yaml:"cancel_grace_seconds"`
 }
 
-// Load reads and parses a YAML configuration file
+// Apply overlays the configured limits onto base limits
+func (l LimitsConfig) Apply(base ResourceLimits) ResourceLimits {
+	limits := base
+	if l.MaxTokens > 0 {
+		limits.MaxTokens = l.MaxTokens
+	}
+	if l.MaxCostUSD > 0 {
+		limits.MaxCost = l.MaxCostUSD
+	}
+	if l.MaxDurationSeconds > 0 {
+		limits.MaxDuration = time.Duration(l.MaxDurationSeconds) * time.Second
+	}
+	if l.MaxIdleSeconds > 0 {
+		limits.MaxIdle = time.Duration(l.MaxIdleSeconds) * time.Second
+	}
+	if l.MaxDiskMB > 0 {
+		limits.MaxDiskBytes = l.MaxDiskMB * 1024 * 1024
+	}
+	if l.MaxMemoryMB > 0 {
+		limits.MaxMemoryBytes = l.MaxMemoryMB * 1024 * 1024
+	}
+	if l.MaxCPUSeconds > 0 {
+		limits.MaxCPUTime = time.Duration(l.MaxCPUSeconds) * time.Second
+	}
+	if l.MaxRunCostUSD > 0 {
+		limits.MaxRunCost = l.MaxRunCostUSD
+	}
+	if l.MaxRunTokens > 0 {
+		limits.MaxRunTokens = l.MaxRunTokens
+	}
+	if l.WarnAtPercent != nil {
+		limits.WarnAt = make([]float64, len(l.WarnAtPercent))
+		for i, percent := range l.WarnAtPercent {
+			limits.WarnAt[i] = percent / 100
+		}
+		sort.Float64s(limits.WarnAt)
+	}
+	if l.CheckIntervalSeconds > 0 {
+		limits.CheckInterval = time.Duration(l.CheckIntervalSeconds) * time.Second
+	}
+	if l.CancelGraceSeconds > 0 {
+		limits.CancelGrace = time.Duration(l.CancelGraceSeconds) * time.Second
+	}
+	return limits
+}
+
+// validate checks that no limit is negative
+func (l LimitsConfig) validate(field string) error {
+	if l.MaxTokens < 0 || l.MaxCostUSD < 0 || l.MaxDurationSeconds < 0 || l.MaxIdleSeconds < 0 || l.MaxDiskMB < 0 || l.MaxMemoryMB < 0 || l.MaxCPUSeconds < 0 || l.MaxRunCostUSD < 0 || l.MaxRunTokens < 0 || l.CheckIntervalSeconds < 0 || l.CancelGraceSeconds < 0 {
+		return fieldError(field, "%s must not contain negative limits", field)
+	}
+	for _, percent := range l.WarnAtPercent {
+		if percent <= 0 || percent >= 100 {
+			return fieldError(field+".warn_at_percent", "%s.warn_at_percent must be between 0 and 100, got %v", field, percent)
+		}
+	}
+	return nil
+}
+
+// globalOnly names a limit set in this block that only applies to the global limits ("" if none)
+func (l LimitsConfig) globalOnly() string {
+	switch {
+	case l.MaxRunCostUSD != 0:
+		return "max_run_cost_usd"
+	case l.MaxRunTokens != 0:
+		return "max_run_tokens"
+	case l.CheckIntervalSeconds != 0:
+		return "check_interval_seconds"
+	case l.CancelGraceSeconds != 0:
+		return "cancel_grace_seconds"
+	}
+	return ""
+}
+
+// ValidateAgentTypes checks every agent's type against the registered adapter types
+// Types are checked separately from validateConfig because adapters are registered at run time
+func ValidateAgentTypes(cfg *Config, registered []string) error {
+	known := make(map[string]bool, len(registered))
+	for _, adapterType := range registered {
+		known[adapterType] = true
+	}
+
+	var errs ConfigErrors
+	for i, agent := range cfg.Agents {
+		if known[agent.Type] {
+			continue
+		}
+		err := fieldError(fmt.Sprintf("agents[%d].type", i), "agent '%s' has unknown type '%s', registered types are: %s",
+			agent.ID, agent.Type, strings.Join(registered, ", "))
+		err.Suggestion = suggest(agent.Type, registered)
+		errs = append(errs, err)
+	}
+	for _, adapterType := range cfg.limitedTypes() {
+		if known[adapterType] {
+			continue
+		}
+		err := fieldError("type_limits."+adapterType, "type_limits has unknown type '%s', registered types are: %s",
+			adapterType, strings.Join(registered, ", "))
+		err.Suggestion = suggest(adapterType, registered)
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// IsEnabled reports whether the agent runs by default
+func (a AgentConfig) IsEnabled() bool {
+	return a.Enabled == nil || *a.Enabled
+}
+
+// HasAnyTag reports whether the agent is labeled with at least one of the tags
+func (a AgentConfig) HasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, agentTag := range a.Tags {
+			if agentTag == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SelectAgents narrows the configured agents to those that should run
+// With ids only the named agents are kept, including disabled ones; otherwise disabled agents are dropped
+// With tags only agents labeled with at least one of the tags are kept
+func (c *Config) SelectAgents(ids, tags []string) error {
+	known := make(map[string]AgentConfig, len(c.Agents))
+	names := make([]string, 0, len(c.Agents))
+	for _, agent := range c.Agents {
+		known[agent.ID] = agent
+		names = append(names, agent.ID)
+	}
+
+	var candidates []AgentConfig
+	if len(ids) > 0 {
+		for _, id := range ids {
+			agent, ok := known[id]
+			if !ok {
+				err := fieldError("", "agent '%s' is not configured", id)
+				err.Suggestion = suggest(id, names)
+				return err
+			}
+			candidates = append(candidates, agent)
+		}
+	} else {
+		for _, agent := range c.Agents {
+			if agent.IsEnabled() {
+				candidates = append(candidates, agent)
+			}
+		}
+	}
+
+	selected := candidates
+	if len(tags) > 0 {
+		selected = nil
+		for _, agent := range candidates {
+			if agent.HasAnyTag(tags) {
+				selected = append(selected, agent)
+			}
+		}
+	}
+
+	if len(selected) == 0 {
+		return fmt.Errorf("no enabled agents match the selection")
+	}
+
+	c.Agents = selected
+	return nil
+}
+
+// Timeout returns the agent's effective timeout given the global default
+func (a AgentConfig) Timeout(globalSeconds int) time.Duration {
+	if a.TimeoutSeconds > 0 {
+		return time.Duration(a.TimeoutSeconds) * time.Second
+	}
+	return time.Duration(globalSeconds) * time.Second
+}
+
+// ResourceLimits returns the agent's effective resource limits given the global defaults
+func (a AgentConfig) ResourceLimits(global ResourceLimits) ResourceLimits {
+	limits := global
+	if a.TimeoutSeconds > 0 {
+		limits.MaxDuration = time.Duration(a.TimeoutSeconds) * time.Second
+	}
+	return a.Limits.Apply(limits)
+}
+
+// AgentLimits returns an agent's effective resource limits: the global limits,
+// overridden by the limits for the agent's type, then by the agent's own settings
+func (c *Config) AgentLimits(agent AgentConfig, global ResourceLimits) ResourceLimits {
+	return agent.ResourceLimits(c.TypeLimits[agent.Type].Apply(global))
+}
+
+// limitedTypes returns the adapter types with their own limits in sorted order
+func (c *Config) limitedTypes() []string {
+	types := make([]string, 0, len(c.TypeLimits))
+	for adapterType := range c.TypeLimits {
+		types = append(types, adapterType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ResourceLimits returns the global resource limits for agents
+// The limits block takes precedence over timeout_seconds, which in turn replaces the default duration
+func (c *Config) ResourceLimits() ResourceLimits {
+	limits := DefaultLimits
+	if c.TimeoutSeconds > 0 {
+		limits.MaxDuration = time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return c.Limits.Apply(limits)
+}
+
+// ConfigFormat identifies the syntax of a configuration file
+type ConfigFormat string
+
+const (
+	// FormatAuto detects the format from the file extension
+	FormatAuto ConfigFormat = ""
+
+	// FormatYAML parses the file as YAML
+	FormatYAML ConfigFormat = "yaml"
+
+	// FormatJSON parses the file as JSON
+	FormatJSON ConfigFormat = "json"
+
+	// FormatTOML parses the file as TOML
+	FormatTOML ConfigFormat = "toml"
+)
+
+// DetectFormat returns the configuration format implied by a file extension
+// Unknown extensions are treated as YAML
+func DetectFormat(path string) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// Load reads and parses a configuration file, detecting its format from the extension
 func Load(path string) (*Config, error) {
-	cfg := &Config{}
+	return LoadWithFormat(path, FormatAuto)
+}
+
+// LoadWithFormat reads and parses a configuration file in the given format
+// All formats share the same field names, environment expansion, and validation
+func LoadWithFormat(path string, format ConfigFormat) (*Config, error) {
+	return loadConfig(path, format, nil)
+}
 
-	data, err := os.ReadFile(path)
+// loadConfig reads, parses, and validates a configuration file
+// prepare, when set, can adjust the decoded configuration before it is validated
+func loadConfig(path string, format ConfigFormat, prepare func(*Config)) (*Config, error) {
+	// Fields missing from the file keep these defaults
+	cfg := &Config{Scoring: DefaultScoringWeights}
+
+	// Parse into a node tree first so includes and templates are merged before decoding
+	// and environment variables are expanded in values only
+	root, err := loadNode(path, format, make(map[string]bool))
 	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+		return nil, err
+	}
+	if root, err = applyPreset(root); err != nil {
+		return nil, err
+	}
+	if err := resolveTemplates(root); err != nil {
+		return nil, err
+	}
+	for _, name := range expandNode(root) {
+		slog.Warn("config references an undefined environment variable, which expands to an empty string", "variable", name)
 	}
 
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	// Resolve secret references after expansion; their values never go back through ExpandEnv
+	secrets, err := resolveSecrets(root, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	// Report every misspelled or unsupported field rather than silently ignoring them
+	if errs := checkUnknownFields(root, reflect.TypeOf(cfg)); len(errs) > 0 {
+		return nil, errs
+	}
+
+	if err := root.Decode(cfg); err != nil {
 		return nil, fmt.Errorf("error parsing config file: %w", err)
 	}
+	cfg.secrets = secrets
+
+	if prepare != nil {
+		prepare(cfg)
+	}
 
 	if err := validateConfig(cfg); err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			locateErrors(root, ConfigErrors{configErr})
+		}
 		return nil, err
 	}
 
 	return cfg, nil
 }
 
+// parseNode parses configuration data into a YAML node tree
+// JSON and TOML documents are converted so they decode through the same yaml struct tags
+func parseNode(data []byte, format ConfigFormat) (*yaml.Node, error) {
+	var root yaml.Node
+
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, err
+		}
+		return &root, nil
+	case FormatJSON:
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if err := root.Encode(doc); err != nil {
+			return nil, err
+		}
+		return &root, nil
+	case FormatTOML:
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if err := root.Encode(doc); err != nil {
+			return nil, err
+		}
+		return &root, nil
+	default:
+		return nil, fmt.Errorf("unsupported config format '%s', must be 'yaml', 'json', or 'toml'", format)
+	}
+}
+
+// envVarRegex matches ${VAR} and ${VAR:-default} references, and references escaped as $${VAR}
+var envVarRegex = regexp.MustCompile(`\$(\$)?\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ExpandEnv replaces ${VAR} and ${VAR:-default} references with environment variable values
+// Unset variables without a default expand to an empty string, and $${VAR} is left as ${VAR}, e.g. for a shell
+func ExpandEnv(value string) string {
+	expanded, _ := expandEnv(value)
+	return expanded
+}
+
+// expandEnv expands a value like ExpandEnv, also returning the variables it references that are undefined, with no
+// default
+func expandEnv(value string) (string, []string) {
+	var undefined []string
+	expanded := envVarRegex.ReplaceAllStringFunc(value, func(match string) string {
+		groups := envVarRegex.FindStringSubmatch(match)
+		if groups[1] != "" {
+			return match[1:]
+		}
+		envValue, ok := os.LookupEnv(groups[2])
+		if ok && envValue != "" {
+			return envValue
+		}
+		if !ok && groups[3] == "" {
+			undefined = append(undefined, groups[2])
+		}
+		return groups[4]
+	})
+	return expanded, undefined
+}
+
+// expandNode expands environment variables in every scalar value of a YAML node tree
+// It returns the undefined variables the values reference without a default, each once
+func expandNode(node *yaml.Node) []string {
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "${") {
+		var undefined []string
+		node.Value, undefined = expandEnv(node.Value)
+		// Let unquoted values re-resolve their type, e.g. "${TIMEOUT:-300}" becomes an int
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+		return undefined
+	}
+
+	var undefined []string
+	for i, child := range node.Content {
+		// Leave mapping keys alone
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		for _, name := range expandNode(child) {
+			if !slices.Contains(undefined, name) {
+				undefined = append(undefined, name)
+			}
+		}
+	}
+	return undefined
+}
+
 // validateConfig performs validation on the loaded configuration
 func validateConfig(cfg *Config) error {
 	if cfg.WorkingDir == "" {
-		return fmt.Errorf("working_dir is required")
+		return fieldError("working_dir", "working_dir is required")
 	}
 
 	if len(cfg.Agents) == 0 {
-		return fmt.Errorf("at least one agent must be configured")
+		return fieldError("agents", "at least one agent must be configured")
 	}
 
 	for i, agent := range cfg.Agents {
+		field := fmt.Sprintf("agents[%d]", i)
 		if agent.ID == "" {
-			return fmt.Errorf("agent at index %d is missing ID", i)
+			return fieldError(field, "agent at index %d is missing ID", i)
 		}
 		if agent.Type == "" {
-			return fmt.Errorf("agent '%s' is missing type", agent.ID)
+			return fieldError(field, "agent '%s' is missing type", agent.ID)
+		}
+		if agent.TimeoutSeconds < 0 {
+			return fieldError(field+".timeout_seconds", "agent '%s' has negative timeout_seconds", agent.ID)
+		}
+		if agent.Samples < 0 {
+			return fieldError(field+".samples", "agent '%s' has negative samples", agent.ID)
+		}
+		if agent.Type == PatchAgentType {
+			if err := validatePatchAgent(field, agent); err != nil {
+				return err
+			}
+		}
+		if err := agent.Limits.validate(field + ".limits"); err != nil {
+			return err
+		}
+		if name := agent.Limits.globalOnly(); name != "" {
+			return fieldError(field+".limits."+name, "agent '%s' sets %s, which only applies to the global limits", agent.ID, name)
 		}
-		if agent.Type != "http" && agent.Type != "cli" {
-			return fmt.Errorf("agent '%s' has invalid type '%s', must be 'http' or 'cli'", agent.ID, agent.Type)
+		if err := agent.Network.validate(field + ".network"); err != nil {
+			return err
 		}
+		if agent.Network.Restricted() && !cfg.Sandbox.Enabled() {
+			return fieldError(field+".network", "agent '%s' restricts its network, which needs the sandbox; set sandbox.image", agent.ID)
+		}
+	}
+
+	if err := validatePipelines(cfg.Pipelines, cfg.Agents); err != nil {
+		return err
 	}
 
 	if cfg.TimeoutSeconds <= 0 {
 		cfg.TimeoutSeconds = 300 // Default to 5 minutes if not specified
 	}
 
+	if cfg.PromptTemplate != "" {
+		if _, err := ParsePromptTemplate(cfg.PromptTemplate); err != nil {
+			return fieldError("prompt_template", "prompt_template is invalid: %v", err)
+		}
+	}
+
+	if err := cfg.Context.validate(); err != nil {
+		return err
+	}
+
+	if cfg.Samples < 0 {
+		return fieldError("samples", "samples must not be negative")
+	}
+
+	if err := validateTDD(cfg); err != nil {
+		return err
+	}
+
+	if err := validatePromptVariants(cfg.PromptVariants); err != nil {
+		return err
+	}
+
+	if cfg.ArtifactsDir == "" {
+		cfg.ArtifactsDir = filepath.Join(cfg.WorkingDir, "runs")
+	}
+
+	switch cfg.WorktreeBackend {
+	case "":
+		cfg.WorktreeBackend = "auto"
+	case "auto", "worktree", "clone":
+	default:
+		err := fieldError("worktree_backend", "worktree_backend '%s' is invalid, must be 'auto', 'worktree', or 'clone'", cfg.WorktreeBackend)
+		err.Suggestion = suggest(cfg.WorktreeBackend, []string{"auto", "worktree", "clone"})
+		return err
+	}
+
+	if cfg.BranchPattern == "" {
+		cfg.BranchPattern = DefaultBranchPattern
+	}
+
+	if err := cfg.Limits.validate("limits"); err != nil {
+		return err
+	}
+	for _, adapterType := range cfg.limitedTypes() {
+		field := "type_limits." + adapterType
+		if err := cfg.TypeLimits[adapterType].validate(field); err != nil {
+			return err
+		}
+		if name := cfg.TypeLimits[adapterType].globalOnly(); name != "" {
+			return fieldError(field+"."+name, "type_limits for '%s' sets %s, which only applies to the global limits", adapterType, name)
+		}
+	}
+
+	if cfg.ConfirmAbove.CostUSD < 0 || cfg.ConfirmAbove.Minutes < 0 {
+		return fieldError("confirm_above", "confirm_above thresholds must not be negative")
+	}
+
+	if cfg.Notify.Webhook != "" {
+		if u, err := url.Parse(cfg.Notify.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fieldError("notify.webhook", "notify.webhook must be an http or https URL")
+		}
+	}
+
+	if err := cfg.Chat.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Hooks.validate(); err != nil {
+		return err
+	}
+
+	if cfg.Jira.URL != "" {
+		if u, err := url.Parse(cfg.Jira.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fieldError("jira.url", "jira.url must be an http or https URL")
+		}
+	}
+
+	if cfg.TestParser != "" && !slices.Contains(TestParsers, cfg.TestParser) {
+		err := fieldError("test_parser", "test_parser must be one of %s, not '%s'", strings.Join(TestParsers, ", "), cfg.TestParser)
+		err.Suggestion = suggest(cfg.TestParser, TestParsers)
+		return err
+	}
+
+	if cfg.TestShell != "" && cfg.TestShell != TestShellDefault && !slices.Contains(procutil.Shells, cfg.TestShell) {
+		shells := append([]string{TestShellDefault}, procutil.Shells...)
+		err := fieldError("test_shell", "test_shell must be one of %s, not '%s'", strings.Join(shells, ", "), cfg.TestShell)
+		err.Suggestion = suggest(cfg.TestShell, shells)
+		return err
+	}
+
+	if err := cfg.Sandbox.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Paths.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.SetScope(cfg.Scope); err != nil {
+		return err
+	}
+
+	if err := cfg.ArtifactRetention.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Privacy.validate(cfg.secrets); err != nil {
+		return err
+	}
+	cfg.scrubbers = cfg.Privacy.scrubbers()
+	if cfg.Privacy.Encrypted() {
+		cfg.cipher = NewCipher(cfg.Privacy.EncryptionKey)
+	}
+
+	if cfg.Tracing.Endpoint != "" {
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fieldError("tracing.endpoint", "tracing.endpoint must be an http or https URL")
+		}
+	}
+
+	if cfg.Mutation.MaxMutants < 0 {
+		return fieldError("mutation.max_mutants", "mutation.max_mutants must not be negative")
+	}
+
+	if cfg.DiffLimits.MaxBytes < 0 {
+		return fieldError("diff_limits.max_bytes", "diff_limits.max_bytes must not be negative")
+	}
+	if cfg.DiffLimits.MaxLineBytes < 0 {
+		return fieldError("diff_limits.max_line_bytes", "diff_limits.max_line_bytes must not be negative")
+	}
+
+	if err := cfg.Speculative.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Refine.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Stack.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.SmokeTest.validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
\ No newline at end of file
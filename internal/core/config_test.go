@@ -1,12 +1,16 @@
 package core
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/brettsmith212/orchestrator/internal/sandbox"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -44,6 +48,294 @@ agents:
 	assert.NotNil(t, cfg.Agents[0].Config)
 }
 
+func TestLoadConfig_EnvExpansion(t *testing.T) {
+	t.Setenv("ORCH_TEST_WORKDIR", "/tmp/from-env")
+	t.Setenv("ORCH_TEST_MODEL", "claude-test")
+	t.Setenv("ORCH_TEST_EMPTY", "")
+
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configData := `
+working_dir: "${ORCH_TEST_WORKDIR}"
+test_command: "${ORCH_TEST_UNSET:-go test ./...}"
+timeout_seconds: ${ORCH_TEST_TIMEOUT:-120}
+agents:
+  - id: "claude"
+    type: "cli"
+    config:
+      model: "${ORCH_TEST_MODEL}"
+      api_key: "${ORCH_TEST_EMPTY:-fallback}"
+      args: ["--prefix=${ORCH_TEST_MODEL}-x"]
+`
+
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/tmp/from-env", cfg.WorkingDir)
+	assert.Equal(t, "go test ./...", cfg.TestCommand, "Unset variables should use the default")
+	assert.Equal(t, 120, cfg.TimeoutSeconds, "Unquoted numbers should keep their type")
+	assert.Equal(t, "claude-test", cfg.Agents[0].Config["model"])
+	assert.Equal(t, "fallback", cfg.Agents[0].Config["api_key"], "Empty variables should use the default")
+	assert.Equal(t, []interface{}{"--prefix=claude-test-x"}, cfg.Agents[0].Config["args"])
+}
+
+func TestLoadConfig_EnvEscape(t *testing.T) {
+	t.Setenv("ORCH_TEST_MODEL", "claude-test")
+
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configData := `
+working_dir: "/tmp/test-dir"
+test_command: "go test -run $${TEST_FILTER:-.} ./... -tags ${ORCH_TEST_MODEL}"
+agents:
+  - id: "claude"
+    type: "cli"
+`
+
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "go test -run ${TEST_FILTER:-.} ./... -tags claude-test", cfg.TestCommand, "Escaped references are left for the shell")
+}
+
+func TestExpandEnv_Undefined(t *testing.T) {
+	t.Setenv("ORCH_TEST_EMPTY", "")
+
+	expanded, undefined := expandEnv("${ORCH_TEST_UNSET}/${ORCH_TEST_UNSET_DEFAULT:-x}/${ORCH_TEST_EMPTY}/$${ORCH_TEST_ESCAPED}")
+	assert.Equal(t, "/x//${ORCH_TEST_ESCAPED}", expanded)
+	assert.Equal(t, []string{"ORCH_TEST_UNSET"}, undefined, "Only unset variables without a default are undefined")
+
+	var root yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte("a: ${ORCH_TEST_UNSET}\nb: [\"${ORCH_TEST_UNSET}\", \"${ORCH_TEST_OTHER}\"]\n"), &root))
+	assert.Equal(t, []string{"ORCH_TEST_UNSET", "ORCH_TEST_OTHER"}, expandNode(&root), "Each undefined variable is reported once")
+}
+
+func TestLoadConfig_AgentOverrides(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configData := `
+working_dir: "/tmp/test-dir"
+test_command: "go test ./..."
+timeout_seconds: 300
+agents:
+  - id: "fast"
+    type: "cli"
+  - id: "slow"
+    type: "cli"
+    timeout_seconds: 900
+    test_command: "go test -short ./..."
+    limits:
+      max_tokens: 50000
+      max_disk_mb: 100
+`
+
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	require.Len(t, cfg.Agents, 2)
+
+	global := ResourceLimits{MaxTokens: 10000, MaxDuration: 5 * time.Minute}
+
+	// Agents without overrides inherit the global values
+	fast := cfg.Agents[0]
+	assert.Equal(t, 5*time.Minute, fast.Timeout(cfg.TimeoutSeconds))
+	assert.Equal(t, global, fast.ResourceLimits(global))
+	assert.Empty(t, fast.TestCommand)
+
+	// Overrides replace the global values
+	slow := cfg.Agents[1]
+	assert.Equal(t, 15*time.Minute, slow.Timeout(cfg.TimeoutSeconds))
+	assert.Equal(t, "go test -short ./...", slow.TestCommand)
+	assert.Equal(t, ResourceLimits{
+		MaxTokens:    50000,
+		MaxDuration:  15 * time.Minute,
+		MaxDiskBytes: 100 * 1024 * 1024,
+	}, slow.ResourceLimits(global))
+}
+
+func TestLoadConfig_Limits(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configData := `
+working_dir: "/tmp/test-dir"
+test_command: "go test ./..."
+timeout_seconds: 300
+limits:
+  max_tokens: 20000
+  max_cost_usd: 2.5
+  max_duration_seconds: 600
+  max_idle_seconds: 120
+  warn_at_percent: [95, 50, 80]
+  check_interval_seconds: 2
+  cancel_grace_seconds: 3
+type_limits:
+  local:
+    max_duration_seconds: 1800
+    max_tokens: 100000
+agents:
+  - id: "cheap"
+    type: "cli"
+    limits:
+      max_cost_usd: 0.5
+  - id: "ollama"
+    type: "local"
+  - id: "ollama-capped"
+    type: "local"
+    limits:
+      max_tokens: 50000
+      warn_at_percent: []
+`
+
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	// The limits block takes precedence over timeout_seconds
+	global := cfg.ResourceLimits()
+	assert.Equal(t, ResourceLimits{
+		MaxTokens:     20000,
+		MaxCost:       2.5,
+		MaxDuration:   10 * time.Minute,
+		MaxIdle:       2 * time.Minute,
+		WarnAt:        []float64{0.5, 0.8, 0.95},
+		CheckInterval: 2 * time.Second,
+		CancelGrace:   3 * time.Second,
+	}, global)
+
+	// Agent limits override individual global limits
+	cheap := cfg.Agents[0].ResourceLimits(global)
+	assert.Equal(t, 0.5, cheap.MaxCost)
+	assert.Equal(t, 20000, cheap.MaxTokens)
+
+	// Type limits override the global limits for every agent of the type, and agent limits override both
+	assert.Equal(t, ResourceLimits{
+		MaxTokens:     100000,
+		MaxCost:       2.5,
+		MaxDuration:   30 * time.Minute,
+		MaxIdle:       2 * time.Minute,
+		WarnAt:        []float64{0.5, 0.8, 0.95},
+		CheckInterval: 2 * time.Second,
+		CancelGrace:   3 * time.Second,
+	}, cfg.AgentLimits(cfg.Agents[1], global))
+	capped := cfg.AgentLimits(cfg.Agents[2], global)
+	assert.Equal(t, 50000, capped.MaxTokens)
+	assert.Equal(t, 30*time.Minute, capped.MaxDuration)
+	assert.Empty(t, capped.WarningThresholds(), "An empty warn_at_percent disables warnings")
+	assert.Equal(t, cheap, cfg.AgentLimits(cfg.Agents[0], global), "Types without limits inherit the global ones")
+
+	// Without a limits block the defaults and timeout_seconds apply
+	cfg.Limits = LimitsConfig{}
+	assert.Equal(t, ResourceLimits{MaxTokens: DefaultLimits.MaxTokens, MaxDuration: 5 * time.Minute, MaxIdle: 2 * time.Minute}, cfg.ResourceLimits())
+}
+
+func TestLoadConfig_Formats(t *testing.T) {
+	t.Setenv("ORCH_TEST_WORKDIR", "/tmp/from-env")
+
+	tests := []struct {
+		name   string
+		file   string
+		format ConfigFormat
+		data   string
+	}{
+		{
+			name: "json by extension",
+			file: "config.json",
+			data: `{
+  "working_dir": "${ORCH_TEST_WORKDIR}",
+  "test_command": "go test ./...",
+  "timeout_seconds": 600,
+  "diff_ignore": ["go.sum"],
+  "mutation": {"enabled": true, "max_mutants": 5},
+  "agents": [
+    {"id": "test-agent", "type": "cli", "config": {"command": "test-command", "args": ["-a", "-b"]}}
+  ]
+}`,
+		},
+		{
+			name: "toml by extension",
+			file: "config.toml",
+			data: `working_dir = "${ORCH_TEST_WORKDIR}"
+test_command = "go test ./..."
+timeout_seconds = 600
+diff_ignore = ["go.sum"]
+
+[mutation]
+enabled = true
+max_mutants = 5
+
+[[agents]]
+id = "test-agent"
+type = "cli"
+
+[agents.config]
+command = "test-command"
+args = ["-a", "-b"]
+`,
+		},
+		{
+			name:   "toml by explicit format",
+			file:   "orchestrator.conf",
+			format: FormatTOML,
+			data: `working_dir = "${ORCH_TEST_WORKDIR}"
+test_command = "go test ./..."
+timeout_seconds = 600
+diff_ignore = ["go.sum"]
+mutation = { enabled = true, max_mutants = 5 }
+agents = [{ id = "test-agent", type = "cli", config = { command = "test-command", args = ["-a", "-b"] } }]
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), tc.file)
+			require.NoError(t, os.WriteFile(configPath, []byte(tc.data), 0644))
+
+			cfg, err := LoadWithFormat(configPath, tc.format)
+			require.NoError(t, err)
+
+			assert.Equal(t, "/tmp/from-env", cfg.WorkingDir)
+			assert.Equal(t, "go test ./...", cfg.TestCommand)
+			assert.Equal(t, 600, cfg.TimeoutSeconds)
+			assert.Equal(t, []string{"go.sum"}, cfg.DiffIgnore)
+			assert.Equal(t, MutationConfig{Enabled: true, MaxMutants: 5}, cfg.Mutation)
+			assert.Equal(t, "auto", cfg.WorktreeBackend, "Defaults should be applied for every format")
+
+			require.Len(t, cfg.Agents, 1)
+			assert.Equal(t, "test-agent", cfg.Agents[0].ID)
+			assert.Equal(t, "test-command", cfg.Agents[0].Config["command"])
+			assert.Equal(t, []interface{}{"-a", "-b"}, cfg.Agents[0].Config["args"])
+		})
+	}
+
+	// Validation errors are reported the same way for every format
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"working_dir": "/tmp/test", "agents": []}`), 0644))
+	_, err := Load(configPath)
+	assert.EqualError(t, err, "at least one agent must be configured")
+
+	// Unknown formats are rejected
+	_, err = LoadWithFormat(configPath, ConfigFormat("ini"))
+	assert.Error(t, err)
+}
+
+func TestDetectFormat(t *testing.T) {
+	assert.Equal(t, FormatYAML, DetectFormat("config.yaml"))
+	assert.Equal(t, FormatYAML, DetectFormat("config.yml"))
+	assert.Equal(t, FormatJSON, DetectFormat("config.JSON"))
+	assert.Equal(t, FormatTOML, DetectFormat("/etc/orchestrator/config.toml"))
+	assert.Equal(t, FormatYAML, DetectFormat("config"))
+}
+
 func TestLoadConfig_InvalidFile(t *testing.T) {
 	cfg, err := Load("nonexistent-file.yaml")
 	assert.Error(t, err)
@@ -105,15 +397,332 @@ func TestValidateConfig(t *testing.T) {
 			isValid: false,
 		},
 		{
-			name: "agent invalid type",
+			name: "invalid worktree backend",
+			cfg: &Config{
+				WorkingDir:      "/tmp/test",
+				WorktreeBackend: "rsync",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "agent negative timeout",
 			cfg: &Config{
 				WorkingDir: "/tmp/test",
 				Agents: []AgentConfig{
-					{ID: "test", Type: "invalid"},
+					{ID: "test", Type: "cli", TimeoutSeconds: -1},
 				},
 			},
 			isValid: false,
 		},
+		{
+			name: "agent negative limits",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Limits: LimitsConfig{MaxTokens: -5}},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid prompt template",
+			cfg: &Config{
+				WorkingDir:     "/tmp/test",
+				PromptTemplate: "{{.Prompt",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "negative context max files",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Context:    ContextConfig{FromFailures: true, MaxFiles: -1},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid notify webhook",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Notify:     NotifyConfig{Webhook: "hooks.slack.com/services/T000"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid chat server url",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Chat:       ChatConfig{Webhook: "https://hooks.slack.com/services/T000", ServerURL: "orchestrator.example.com"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid discord public key",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Chat:       ChatConfig{DiscordPublicKey: "abcd"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid sandbox runtime",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Sandbox:    SandboxConfig{Image: "sandbox:latest", Runtime: "dokcer"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid sandbox env name",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Sandbox:    SandboxConfig{Image: "sandbox:latest", Env: []string{"OPENAI_API_KEY=sk-123"}},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "network allowlist",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Sandbox:    SandboxConfig{Image: "sandbox:latest"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Network: NetworkPolicy{Allow: []string{"api.openai.com", "*.anthropic.com"}}},
+				},
+			},
+			isValid: true,
+		},
+		{
+			name: "network policy without sandbox",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Network: NetworkPolicy{Mode: NetworkNone}},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "empty network allowlist",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Sandbox:    SandboxConfig{Image: "sandbox:latest"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Network: NetworkPolicy{Mode: NetworkAllowlist}},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid network allowlist host",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Sandbox:    SandboxConfig{Image: "sandbox:latest"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Network: NetworkPolicy{Allow: []string{"https://api.openai.com"}}},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid network mode",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Sandbox:    SandboxConfig{Image: "sandbox:latest"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Network: NetworkPolicy{Mode: "offline"}},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid path policy action",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Paths:      PathPolicy{Deny: []string{"infra/"}, OnViolation: "reject"},
+				Agents:     []AgentConfig{{ID: "test", Type: "cli"}},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid path policy pattern",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Paths:      PathPolicy{Deny: []string{"secrets/[a-"}},
+				Agents:     []AgentConfig{{ID: "test", Type: "cli"}},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid jira url",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Jira:       JiraConfig{URL: "example.atlassian.net"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid tracing endpoint",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Tracing:    TracingConfig{Endpoint: "localhost:4318"},
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "negative artifact retention",
+			cfg: &Config{
+				WorkingDir:        "/tmp/test",
+				ArtifactRetention: RetentionConfig{MaxAgeDays: -1},
+				Agents:            []AgentConfig{{ID: "test", Type: "cli"}},
+			},
+			isValid: false,
+		},
+		{
+			name: "privacy scrub and encryption",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Privacy:    PrivacyConfig{Scrub: []string{`(?i)project falcon`}, EncryptionKey: "key-from-secret"},
+				Agents:     []AgentConfig{{ID: "test", Type: "cli"}},
+				secrets:    []string{"key-from-secret"},
+			},
+			isValid: true,
+		},
+		{
+			name: "invalid privacy scrub",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Privacy:    PrivacyConfig{Scrub: []string{"ACME-[0-9"}},
+				Agents:     []AgentConfig{{ID: "test", Type: "cli"}},
+			},
+			isValid: false,
+		},
+		{
+			name: "literal encryption key",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Privacy:    PrivacyConfig{EncryptionKey: "hunter2"},
+				Agents:     []AgentConfig{{ID: "test", Type: "cli"}},
+			},
+			isValid: false,
+		},
+		{
+			name: "type run budget",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents:     []AgentConfig{{ID: "test", Type: "cli"}},
+				TypeLimits: map[string]LimitsConfig{"cli": {MaxRunCostUSD: 5}},
+			},
+			isValid: false,
+		},
+		{
+			name: "negative type limits",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents:     []AgentConfig{{ID: "test", Type: "cli"}},
+				TypeLimits: map[string]LimitsConfig{"cli": {MaxTokens: -1}},
+			},
+			isValid: false,
+		},
+		{
+			name: "agent check interval",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Limits: LimitsConfig{CheckIntervalSeconds: 1}},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "warning threshold out of range",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents:     []AgentConfig{{ID: "test", Type: "cli"}},
+				Limits:     LimitsConfig{WarnAtPercent: []float64{50, 100}},
+			},
+			isValid: false,
+		},
+		{
+			name: "agent run token budget",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Limits: LimitsConfig{MaxRunTokens: 5000}},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "agent run budget",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Limits: LimitsConfig{MaxRunCostUSD: 5}},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "negative samples",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Samples:    -1,
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli"},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "agent negative samples",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "cli", Samples: -2},
+				},
+			},
+			isValid: false,
+		},
+		{
+			name: "agent custom type",
+			cfg: &Config{
+				WorkingDir: "/tmp/test",
+				Agents: []AgentConfig{
+					{ID: "test", Type: "docker"},
+				},
+			},
+			isValid: true,
+		},
 	}
 
 	for _, tc := range tests {
@@ -126,4 +735,116 @@ func TestValidateConfig(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestSelectAgents(t *testing.T) {
+	disabled := false
+	newConfig := func() *Config {
+		return &Config{
+			WorkingDir: "/tmp/test",
+			Agents: []AgentConfig{
+				{ID: "claude", Type: "cli", Tags: []string{"fast", "anthropic"}},
+				{ID: "amp", Type: "cli", Tags: []string{"thorough"}},
+				{ID: "codex", Type: "cli", Tags: []string{"fast"}, Enabled: &disabled},
+			},
+		}
+	}
+	ids := func(cfg *Config) []string {
+		var result []string
+		for _, agent := range cfg.Agents {
+			result = append(result, agent.ID)
+		}
+		return result
+	}
+
+	// Disabled agents are dropped by default
+	cfg := newConfig()
+	require.NoError(t, cfg.SelectAgents(nil, nil))
+	assert.Equal(t, []string{"claude", "amp"}, ids(cfg))
+
+	// Tags select among enabled agents
+	cfg = newConfig()
+	require.NoError(t, cfg.SelectAgents(nil, []string{"fast"}))
+	assert.Equal(t, []string{"claude"}, ids(cfg))
+
+	// Naming an agent runs it even when disabled
+	cfg = newConfig()
+	require.NoError(t, cfg.SelectAgents([]string{"codex", "amp"}, nil))
+	assert.Equal(t, []string{"codex", "amp"}, ids(cfg))
+
+	// IDs and tags combine
+	cfg = newConfig()
+	require.NoError(t, cfg.SelectAgents([]string{"codex", "amp"}, []string{"fast"}))
+	assert.Equal(t, []string{"codex"}, ids(cfg))
+
+	// Unknown IDs get a suggestion
+	cfg = newConfig()
+	err := cfg.SelectAgents([]string{"claud"}, nil)
+	require.Error(t, err)
+	assert.Equal(t, "agent 'claud' is not configured (did you mean 'claude'?)", err.Error())
+
+	// An empty selection is an error
+	cfg = newConfig()
+	assert.Error(t, cfg.SelectAgents(nil, []string{"missing"}))
+}
+
+func TestValidateAgentTypes(t *testing.T) {
+	cfg := &Config{
+		WorkingDir: "/tmp/test",
+		Agents: []AgentConfig{
+			{ID: "claude", Type: "cli"},
+			{ID: "sandboxed", Type: "docker"},
+			{ID: "typo", Type: "clii"},
+		},
+	}
+
+	// Registered custom types are accepted
+	require.NoError(t, ValidateAgentTypes(cfg, []string{"cli", "docker", "clii"}))
+
+	// Every unregistered type is reported
+	err := ValidateAgentTypes(cfg, []string{"cli", "grpc"})
+	var configErrs ConfigErrors
+	require.True(t, errors.As(err, &configErrs))
+	require.Len(t, configErrs, 2)
+	assert.Equal(t, "agents[1].type", configErrs[0].Field)
+	assert.Equal(t, "", configErrs[0].Suggestion)
+	assert.Equal(t, "agent 'typo' has unknown type 'clii', registered types are: cli, grpc (did you mean 'cli'?)", configErrs[1].Error())
+
+	// Limits for an unregistered type are reported too
+	cfg.TypeLimits = map[string]LimitsConfig{"cli": {MaxTokens: 1}, "dokcer": {MaxTokens: 1}}
+	err = ValidateAgentTypes(cfg, []string{"cli", "docker", "clii"})
+	require.True(t, errors.As(err, &configErrs))
+	require.Len(t, configErrs, 1)
+	assert.Equal(t, "type_limits.dokcer", configErrs[0].Field)
+	assert.Equal(t, "docker", configErrs[0].Suggestion)
+}
+
+func TestSandboxAgentContainer(t *testing.T) {
+	sandboxCfg := SandboxConfig{Image: "sandbox:latest", Env: []string{"OPENAI_API_KEY"}}
+
+	container := sandboxCfg.AgentContainer(NetworkPolicy{}, 0)
+	assert.Equal(t, sandbox.NetworkBridge, container.Network, "Agents reach any host by default")
+
+	container = sandboxCfg.AgentContainer(NetworkPolicy{Mode: NetworkNone}, 0)
+	assert.Equal(t, sandbox.NetworkNone, container.Network)
+
+	container = sandboxCfg.AgentContainer(NetworkPolicy{Allow: []string{"api.openai.com"}}, 1<<30)
+	assert.Equal(t, sandbox.NetworkAllowlist, container.Network, "An allowlist implies the allowlist mode")
+	assert.Equal(t, []string{"api.openai.com"}, container.Allow)
+	assert.Equal(t, int64(1<<30), container.MemoryBytes)
+
+	assert.Nil(t, SandboxConfig{}.AgentContainer(NetworkPolicy{Mode: NetworkNone}, 0))
+}
+
+func TestValidateTestShell(t *testing.T) {
+	cfg := &Config{WorkingDir: "/tmp/test", Agents: []AgentConfig{{ID: "claude", Type: "cli"}}}
+	for _, shell := range []string{"", TestShellDefault, "sh", "cmd", "powershell"} {
+		cfg.TestShell = shell
+		assert.NoError(t, validateConfig(cfg), shell)
+	}
+
+	cfg.TestShell = "pwershell"
+	var configErr *ConfigError
+	require.ErrorAs(t, validateConfig(cfg), &configErr)
+	assert.Equal(t, "test_shell", configErr.Field)
+	assert.Equal(t, "powershell", configErr.Suggestion)
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// DefaultMaxContextFiles caps the context files gathered for a task when max_files is not set
+const DefaultMaxContextFiles = 20
+
+// maxSuffixMatches is how many tracked files a bare file name from test output may resolve to
+// Names matching more files than this are too ambiguous to be useful
+const maxSuffixMatches = 3
+
+// ContextConfig selects files relevant to a task, which are offered to agents alongside the prompt
+type ContextConfig struct {
+	// Files lists glob patterns of tracked files that are always included, e.g. "docs/ARCHITECTURE.md"
+	Files []string `yaml:"files"`
+
+	// FromFailures includes the files named in the output of the failing baseline tests, such as stack traces
+	FromFailures bool `yaml:"from_failures"`
+
+	// RecentCommits includes the files changed by this many of the latest commits
+	RecentCommits int `yaml:"recent_commits"`
+
+	// MaxFiles caps the number of files gathered (defaults to 20)
+	MaxFiles int `yaml:"max_files"`
+
+	// RepoMap offers agents a map of the repository's files and declarations, see RepoMap
+	RepoMap bool `yaml:"repo_map"`
+
+	// InPrompt also lists the files at the end of the prompt, for agents that can't be given them any other way
+	InPrompt bool `yaml:"in_prompt"`
+}
+
+// Enabled reports whether any source of context files is configured
+func (c ContextConfig) Enabled() bool {
+	return len(c.Files) > 0 || c.FromFailures || c.RecentCommits > 0
+}
+
+// validate checks the context settings
+func (c ContextConfig) validate() error {
+	if c.RecentCommits < 0 {
+		return fieldError("context.recent_commits", "context.recent_commits must not be negative")
+	}
+	if c.MaxFiles < 0 {
+		return fieldError("context.max_files", "context.max_files must not be negative")
+	}
+	return nil
+}
+
+// failurePathPatterns match file locations in test output: "path/file.go:12" and Python's `File "path", line 12`
+var failurePathPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:^|[\s"'(\[])((?:[A-Za-z]:)?[\w./\\-]*\w\.\w+):\d+`),
+	regexp.MustCompile(`File "([^"]+)", line \d+`),
+}
+
+// GatherContextFiles picks the files relevant to a task in a checkout, relative to its root
+// Files named by failing tests come first, then those matching the configured globs, then recently changed ones
+// Only files inside scope are picked (every file with an empty scope)
+func GatherContextFiles(repo, scope string, cfg ContextConfig, baseline *TestResult) ([]string, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	tracked, err := gitutil.TrackedFiles(repo)
+	if err != nil {
+		return nil, err
+	}
+	tracked = ScopedFiles(tracked, scope)
+
+	limit := cfg.MaxFiles
+	if limit == 0 {
+		limit = DefaultMaxContextFiles
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	add := func(candidates ...string) {
+		for _, file := range candidates {
+			if len(files) < limit && !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	if cfg.FromFailures && baseline != nil && !baseline.Success {
+		add(FailureFiles(repo, baseline.Output, tracked)...)
+	}
+
+	for _, file := range tracked {
+		if gitutil.MatchesAnyPattern(file, cfg.Files) {
+			add(file)
+		}
+	}
+
+	if cfg.RecentCommits > 0 {
+		recent, err := gitutil.RecentFiles(repo, cfg.RecentCommits)
+		if err != nil {
+			return files, err
+		}
+		add(ScopedFiles(recent, scope)...)
+	}
+
+	return files, nil
+}
+
+// FailureFiles returns the tracked files named in test output, in the order they are first mentioned
+// Absolute paths inside the checkout are made relative, and bare names like "parser_test.go" are
+// matched against the ends of tracked paths, since test runners often print paths relative to a package
+func FailureFiles(repo, output string, tracked []string) []string {
+	isTracked := make(map[string]bool, len(tracked))
+	for _, file := range tracked {
+		isTracked[file] = true
+	}
+	root, _ := filepath.Abs(repo)
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		for _, pattern := range failurePathPatterns {
+			for _, match := range pattern.FindAllStringSubmatch(line, -1) {
+				for _, file := range resolveFailurePath(match[1], root, tracked, isTracked) {
+					if !seen[file] {
+						seen[file] = true
+						files = append(files, file)
+					}
+				}
+			}
+		}
+	}
+	return files
+}
+
+// resolveFailurePath maps a path printed by a test runner to the tracked files it may refer to
+func resolveFailurePath(name, root string, tracked []string, isTracked map[string]bool) []string {
+	name = filepath.ToSlash(name)
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		rel, err := filepath.Rel(root, filepath.FromSlash(name))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil
+		}
+		name = filepath.ToSlash(rel)
+	}
+	name = strings.TrimPrefix(name, "./")
+
+	if isTracked[name] {
+		return []string{name}
+	}
+
+	var matches []string
+	for _, file := range tracked {
+		if strings.HasSuffix(file, "/"+name) {
+			matches = append(matches, file)
+			if len(matches) > maxSuffixMatches {
+				return nil
+			}
+		}
+	}
+	return matches
+}
+
+// ContextFilesPrompt lists context files for inclusion at the end of a prompt
+func ContextFilesPrompt(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\nThese files are likely relevant to the task:\n")
+	for _, file := range files {
+		fmt.Fprintf(&sb, "- %s\n", file)
+	}
+	return sb.String()
+}
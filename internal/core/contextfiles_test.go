@@ -0,0 +1,43 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureFiles(t *testing.T) {
+	repo := t.TempDir()
+	tracked := []string{
+		"cmd/app/main.go",
+		"internal/parser/parser.go",
+		"internal/parser/parser_test.go",
+		"scripts/tool.py",
+		"a/util.go", "b/util.go", "c/util.go", "d/util.go",
+	}
+
+	output := `--- FAIL: TestParse (0.00s)
+    parser_test.go:42: got 1, want 2
+panic: runtime error [recovered]
+	` + filepath.Join(repo, "internal/parser/parser.go") + `:17 +0x1d
+	/usr/local/go/src/testing/testing.go:1595 +0x238
+  File "scripts/tool.py", line 8, in main
+util.go:3: too many candidates
+./cmd/app/main.go:5: again parser_test.go:43
+FAIL`
+
+	assert.Equal(t, []string{
+		"internal/parser/parser_test.go",
+		"internal/parser/parser.go",
+		"scripts/tool.py",
+		"cmd/app/main.go",
+	}, FailureFiles(repo, output, tracked))
+
+	assert.Empty(t, FailureFiles(repo, "ok  \tgithub.com/org/app\t0.01s", tracked))
+}
+
+func TestContextFilesPrompt(t *testing.T) {
+	assert.Equal(t, "", ContextFilesPrompt(nil))
+	assert.Equal(t, "\nThese files are likely relevant to the task:\n- a.go\n- b/c.go\n", ContextFilesPrompt([]string{"a.go", "b/c.go"}))
+}
@@ -0,0 +1,68 @@
+package core
+
+// DiscoveredTag is added to the tags of agents found by discovery so they can be selected with --tags
+const DiscoveredTag = "discovered"
+
+// DiscoveredAgentConfigs returns agent definitions for discovered agent CLIs
+// Each agent runs through the generic CLI adapter with the binary name as its ID and command
+func DiscoveredAgentConfigs(names []string) []AgentConfig {
+	agents := make([]AgentConfig, 0, len(names))
+	for _, name := range names {
+		config := map[string]interface{}{"command": name}
+		if args := knownAgentArgs[name]; len(args) > 0 {
+			values := make([]interface{}, len(args))
+			for i, arg := range args {
+				values[i] = arg
+			}
+			config["args"] = values
+			config["worktree_flag"] = ""
+		}
+
+		agents = append(agents, AgentConfig{
+			ID:     name,
+			Type:   "cli",
+			Tags:   []string{DiscoveredTag},
+			Config: config,
+		})
+	}
+	return agents
+}
+
+// LoadWithDiscovery loads a configuration file and adds the agent CLIs that lookPath finds
+// Discovery runs when the file configures no agents, or on every load when always is set.
+// Agent CLIs that a configured agent already runs are not added again.
+// It returns the IDs of the agents that were added
+func LoadWithDiscovery(path string, format ConfigFormat, always bool, lookPath func(string) (string, error)) (*Config, []string, error) {
+	var added []string
+
+	cfg, err := loadConfig(path, format, func(cfg *Config) {
+		if len(cfg.Agents) > 0 && !always {
+			return
+		}
+
+		// An agent CLI is already configured when an agent uses it by ID, adapter type, or command
+		configured := make(map[string]bool)
+		for _, agent := range cfg.Agents {
+			configured[agent.ID] = true
+			configured[agent.Type] = true
+			if command, ok := agent.Config["command"].(string); ok {
+				configured[command] = true
+			}
+		}
+
+		var names []string
+		for _, name := range DiscoverAgents(lookPath) {
+			if !configured[name] {
+				names = append(names, name)
+			}
+		}
+
+		cfg.Agents = append(cfg.Agents, DiscoveredAgentConfigs(names)...)
+		added = names
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, added, nil
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadWithDiscovery(t *testing.T) {
+	lookPath := func(name string) (string, error) {
+		if name == "aider" || name == "claude" {
+			return "/usr/local/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	tempDir := t.TempDir()
+	emptyPath := filepath.Join(tempDir, "empty.yaml")
+	require.NoError(t, os.WriteFile(emptyPath, []byte("working_dir: \"/tmp/test-dir\"\n"), 0644))
+
+	configuredPath := filepath.Join(tempDir, "configured.yaml")
+	require.NoError(t, os.WriteFile(configuredPath, []byte(`working_dir: "/tmp/test-dir"
+agents:
+  - id: "sonnet"
+    type: "cli"
+    config:
+      command: "claude"
+`), 0644))
+
+	t.Run("config without agents", func(t *testing.T) {
+		cfg, added, err := LoadWithDiscovery(emptyPath, FormatAuto, false, lookPath)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"aider", "claude"}, added)
+		require.Len(t, cfg.Agents, 2)
+
+		aider := cfg.Agents[0]
+		assert.Equal(t, "aider", aider.ID)
+		assert.Equal(t, "cli", aider.Type)
+		assert.Equal(t, []string{DiscoveredTag}, aider.Tags)
+		assert.Equal(t, []interface{}{"--yes-always", "--no-auto-commits", "--message"}, aider.Config["args"])
+		assert.NotContains(t, cfg.Agents[1].Config, "args")
+	})
+
+	t.Run("configured agents are kept", func(t *testing.T) {
+		cfg, added, err := LoadWithDiscovery(configuredPath, FormatAuto, false, lookPath)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		require.Len(t, cfg.Agents, 1)
+		assert.Equal(t, "sonnet", cfg.Agents[0].ID)
+	})
+
+	t.Run("always discover", func(t *testing.T) {
+		// claude is already run by a configured agent, so only aider is added
+		cfg, added, err := LoadWithDiscovery(configuredPath, FormatAuto, true, lookPath)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"aider"}, added)
+		require.Len(t, cfg.Agents, 2)
+		assert.Equal(t, "aider", cfg.Agents[1].ID)
+	})
+
+	t.Run("nothing found", func(t *testing.T) {
+		notFound := func(string) (string, error) { return "", errors.New("not found") }
+		_, _, err := LoadWithDiscovery(emptyPath, FormatAuto, false, notFound)
+		assert.EqualError(t, err, "at least one agent must be configured")
+	})
+}
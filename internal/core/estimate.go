@@ -0,0 +1,245 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyRuns caps how many of the most recent runs usage history is read from
+const historyRuns = 50
+
+// ConfirmConfig sets how large a run can be expected to get before it needs confirmation
+type ConfirmConfig struct {
+	// CostUSD is the estimated spend above which a run needs confirmation (0 never asks)
+	// A run whose spend can't be estimated needs confirmation too
+	CostUSD float64 `yaml:"cost_usd"`
+
+	// Minutes is the estimated wall-clock time above which a run needs confirmation (0 never asks)
+	Minutes int `yaml:"minutes"`
+}
+
+// AgentHistory is an agent's average usage over previous runs
+type AgentHistory struct {
+	// Runs is how many previous runs the averages cover
+	Runs int
+
+	// Tokens, CostUSD, and Duration are the averages per run
+	Tokens   int
+	CostUSD  float64
+	Duration time.Duration
+}
+
+// LoadUsageHistory averages each agent's recorded usage over the most recent runs in an artifacts directory
+// Samples count toward the agent they belong to; runs without usage in their report are skipped
+func LoadUsageHistory(artifactsDir string) (map[string]AgentHistory, error) {
+	entries, err := os.ReadDir(artifactsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]AgentHistory{}, nil
+		}
+		return nil, fmt.Errorf("failed to read run history: %w", err)
+	}
+
+	// Run IDs start with a timestamp, so the newest runs sort last
+	var runDirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			runDirs = append(runDirs, entry.Name())
+		}
+	}
+	sort.Strings(runDirs)
+	if len(runDirs) > historyRuns {
+		runDirs = runDirs[len(runDirs)-historyRuns:]
+	}
+
+	type totals struct {
+		runs     int
+		tokens   int
+		cost     float64
+		duration float64
+	}
+	sums := make(map[string]*totals)
+	for _, dir := range runDirs {
+		report, err := ReadReport(filepath.Join(artifactsDir, dir))
+		if err != nil {
+			continue
+		}
+		for _, candidate := range report.Candidates {
+			if candidate.DurationSeconds <= 0 {
+				continue
+			}
+			id := SampleOf(candidate.AgentID)
+			if sums[id] == nil {
+				sums[id] = &totals{}
+			}
+			sums[id].runs++
+			sums[id].tokens += candidate.Tokens
+			sums[id].cost += candidate.CostUSD
+			sums[id].duration += candidate.DurationSeconds
+		}
+	}
+
+	history := make(map[string]AgentHistory, len(sums))
+	for id, sum := range sums {
+		history[id] = AgentHistory{
+			Runs:     sum.runs,
+			Tokens:   sum.tokens / sum.runs,
+			CostUSD:  sum.cost / float64(sum.runs),
+			Duration: time.Duration(sum.duration / float64(sum.runs) * float64(time.Second)),
+		}
+	}
+	return history, nil
+}
+
+// AgentEstimate is the expected usage of one agent in a run
+type AgentEstimate struct {
+	// AgentID identifies the agent
+	AgentID string
+
+	// HistoryRuns is how many previous runs the estimate averages (0 if it comes from the limits alone)
+	HistoryRuns int
+
+	// CostUSD is the expected spend; without history it is the cost limit
+	CostUSD float64
+
+	// CostKnown is false when there is neither history nor a cost limit to go by
+	CostKnown bool
+
+	// Duration is the expected running time; without history it is the time limit
+	Duration time.Duration
+}
+
+// RunEstimate is the expected cost and wall-clock time of a run
+type RunEstimate struct {
+	// Agents holds each agent's estimate, in configuration order
+	Agents []AgentEstimate
+
+	// CostUSD is the expected spend of every agent together
+	CostUSD float64
+
+	// CostKnown is false when the spend of some agent can't be estimated
+	CostKnown bool
+
+	// Duration is the expected wall-clock time; agents run in parallel, so it is the longest agent's
+	Duration time.Duration
+}
+
+// EstimateRun estimates a run from each agent's history, falling back to its resource limits,
+// which the watchdog enforces and so bound what an agent without history can use
+// limits are the global limits each agent's type and own limits override
+func EstimateRun(cfg *Config, limits ResourceLimits, history map[string]AgentHistory) RunEstimate {
+	estimate := RunEstimate{CostKnown: true}
+	for _, agent := range cfg.Agents {
+		agentLimits := cfg.AgentLimits(agent, limits)
+		agentEstimate := AgentEstimate{
+			AgentID:   agent.ID,
+			CostUSD:   agentLimits.MaxCost,
+			CostKnown: agentLimits.MaxCost > 0,
+			Duration:  agentLimits.MaxDuration,
+		}
+
+		if past, ok := history[SampleOf(agent.ID)]; ok && past.Runs > 0 {
+			agentEstimate.HistoryRuns = past.Runs
+			agentEstimate.CostUSD = capCost(past.CostUSD, agentLimits.MaxCost)
+			agentEstimate.CostKnown = true
+			agentEstimate.Duration = capDuration(past.Duration, agentLimits.MaxDuration)
+		}
+
+		estimate.Agents = append(estimate.Agents, agentEstimate)
+		estimate.CostUSD += agentEstimate.CostUSD
+		estimate.CostKnown = estimate.CostKnown && agentEstimate.CostKnown
+		if agentEstimate.Duration > estimate.Duration {
+			estimate.Duration = agentEstimate.Duration
+		}
+	}
+
+	// The watchdog stops every agent once the run budget is spent
+	if limits.MaxRunCost > 0 && (!estimate.CostKnown || estimate.CostUSD > limits.MaxRunCost) {
+		estimate.CostUSD = limits.MaxRunCost
+		estimate.CostKnown = true
+	}
+	return estimate
+}
+
+// Repeat scales a run estimate to tasks runs, concurrency of them at a time
+func (e RunEstimate) Repeat(tasks, concurrency int) RunEstimate {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	waves := (tasks + concurrency - 1) / concurrency
+
+	repeated := e
+	repeated.CostUSD = e.CostUSD * float64(tasks)
+	repeated.Duration = e.Duration * time.Duration(waves)
+	return repeated
+}
+
+// NeedsConfirmation reports why a run estimate exceeds the confirmation thresholds ("" if it doesn't)
+func (e RunEstimate) NeedsConfirmation(thresholds ConfirmConfig) string {
+	if thresholds.CostUSD > 0 {
+		if !e.CostKnown {
+			return "its cost can't be estimated"
+		}
+		if e.CostUSD > thresholds.CostUSD {
+			return fmt.Sprintf("its estimated cost is above $%.2f", thresholds.CostUSD)
+		}
+	}
+	if thresholds.Minutes > 0 && e.Duration > time.Duration(thresholds.Minutes)*time.Minute {
+		return fmt.Sprintf("its estimated time is above %d minutes", thresholds.Minutes)
+	}
+	return ""
+}
+
+// FormatEstimate describes a run estimate: a total line followed by one line per agent
+func FormatEstimate(e RunEstimate) string {
+	var sb strings.Builder
+	cost := fmt.Sprintf("$%.2f", e.CostUSD)
+	if !e.CostKnown {
+		cost = "unknown cost"
+	}
+	duration := "about " + e.Duration.Round(time.Second).String()
+	if e.Duration == 0 {
+		duration = "unknown time"
+	}
+	fmt.Fprintf(&sb, "Estimate: %s, %s\n", cost, duration)
+
+	for _, agent := range e.Agents {
+		cost, duration := fmt.Sprintf("$%.2f", agent.CostUSD), agent.Duration.Round(time.Second).String()
+		source := fmt.Sprintf("average of %d runs", agent.HistoryRuns)
+		if agent.HistoryRuns == 1 {
+			source = "from 1 run"
+		}
+		if agent.HistoryRuns == 0 {
+			source = "limits, no history"
+			cost, duration = "at most "+cost, "at most "+duration
+		}
+		if !agent.CostKnown {
+			cost = "unknown cost"
+		}
+		if agent.Duration == 0 {
+			duration = "no time limit"
+		}
+		fmt.Fprintf(&sb, "  %-16s %-16s %-18s (%s)\n", agent.AgentID, cost, duration, source)
+	}
+	return sb.String()
+}
+
+// capCost limits an expected spend to a cost limit (0 for none)
+func capCost(cost, limit float64) float64 {
+	if limit > 0 && cost > limit {
+		return limit
+	}
+	return cost
+}
+
+// capDuration limits an expected running time to a time limit (0 for none)
+func capDuration(d, limit time.Duration) time.Duration {
+	if limit > 0 && d > limit {
+		return limit
+	}
+	return d
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadUsageHistory(t *testing.T) {
+	artifactsDir := t.TempDir()
+	writeRun := func(runID string, candidates ...*PatchResult) {
+		w, err := NewRunWriter(filepath.Join(artifactsDir, runID), &Config{})
+		require.NoError(t, err)
+		require.NoError(t, w.WriteReport(&TaskResult{RunID: runID, Candidates: candidates}))
+	}
+	writeRun("20240101-000000-aaaaaa",
+		&PatchResult{AgentID: "claude", Usage: AgentUsage{Tokens: 1000, CostUSD: 0.5, Duration: 60 * time.Second}},
+		&PatchResult{AgentID: "codex"}, // runs from before usage was recorded are skipped
+	)
+	writeRun("20240102-000000-bbbbbb",
+		&PatchResult{AgentID: "claude#1", Usage: AgentUsage{Tokens: 3000, CostUSD: 1.5, Duration: 120 * time.Second}},
+	)
+
+	history, err := LoadUsageHistory(artifactsDir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]AgentHistory{
+		"claude": {Runs: 2, Tokens: 2000, CostUSD: 1.0, Duration: 90 * time.Second},
+	}, history)
+
+	history, err = LoadUsageHistory(filepath.Join(artifactsDir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestEstimateRun(t *testing.T) {
+	cfg := &Config{Agents: []AgentConfig{
+		{ID: "claude#1"},
+		{ID: "claude#2", Limits: LimitsConfig{MaxCostUSD: 0.75}},
+		{ID: "codex", Limits: LimitsConfig{MaxCostUSD: 2}},
+		{ID: "amp"},
+	}}
+	limits := ResourceLimits{MaxDuration: 5 * time.Minute}
+	history := map[string]AgentHistory{"claude": {Runs: 4, CostUSD: 1.0, Duration: 90 * time.Second}}
+
+	estimate := EstimateRun(cfg, limits, history)
+	require.Len(t, estimate.Agents, 4)
+	assert.Equal(t, AgentEstimate{AgentID: "claude#1", HistoryRuns: 4, CostUSD: 1.0, CostKnown: true, Duration: 90 * time.Second}, estimate.Agents[0])
+	assert.Equal(t, 0.75, estimate.Agents[1].CostUSD, "the cost limit caps the history")
+	assert.Equal(t, AgentEstimate{AgentID: "codex", CostUSD: 2, CostKnown: true, Duration: 5 * time.Minute}, estimate.Agents[2])
+	assert.False(t, estimate.Agents[3].CostKnown)
+	assert.False(t, estimate.CostKnown)
+	assert.InDelta(t, 3.75, estimate.CostUSD, 0.001)
+	assert.Equal(t, 5*time.Minute, estimate.Duration)
+
+	assert.Equal(t, "its cost can't be estimated", estimate.NeedsConfirmation(ConfirmConfig{CostUSD: 10}))
+	assert.Equal(t, "", estimate.NeedsConfirmation(ConfirmConfig{Minutes: 5}))
+	assert.Equal(t, "its estimated time is above 4 minutes", estimate.NeedsConfirmation(ConfirmConfig{Minutes: 4}))
+
+	cfg.Agents = cfg.Agents[:3]
+	estimate = EstimateRun(cfg, limits, history)
+	assert.True(t, estimate.CostKnown)
+	assert.Equal(t, "", estimate.NeedsConfirmation(ConfirmConfig{CostUSD: 5}))
+	assert.Equal(t, "its estimated cost is above $3.00", estimate.NeedsConfirmation(ConfirmConfig{CostUSD: 3}))
+
+	// The run budget caps the estimate, even when an agent's spend is unknown
+	cfg.Agents = append(cfg.Agents, AgentConfig{ID: "amp"})
+	limits.MaxRunCost = 3
+	capped := EstimateRun(cfg, limits, history)
+	assert.True(t, capped.CostKnown)
+	assert.Equal(t, 3.0, capped.CostUSD)
+	cfg.Agents = cfg.Agents[:3]
+
+	// Five tasks two at a time take three rounds
+	batch := estimate.Repeat(5, 2)
+	assert.InDelta(t, 18.75, batch.CostUSD, 0.001)
+	assert.Equal(t, 15*time.Minute, batch.Duration)
+}
+
+func TestFormatEstimate(t *testing.T) {
+	estimate := RunEstimate{
+		Agents: []AgentEstimate{
+			{AgentID: "claude", HistoryRuns: 3, CostUSD: 1.25, CostKnown: true, Duration: 90 * time.Second},
+			{AgentID: "amp", Duration: 5 * time.Minute},
+		},
+		CostUSD:  1.25,
+		Duration: 5 * time.Minute,
+	}
+
+	assert.Equal(t, "Estimate: unknown cost, about 5m0s\n"+
+		"  claude           $1.25            1m30s              (average of 3 runs)\n"+
+		"  amp              unknown cost     at most 5m0s       (limits, no history)\n", FormatEstimate(estimate))
+}
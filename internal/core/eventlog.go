@@ -0,0 +1,206 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// Bounds on the events an EventLog keeps in memory; every event is in the transcript either way
+const (
+	// maxKeptErrors is how many of an agent's first error events are kept, which is what classifying its failure reads
+	maxKeptErrors = 100
+
+	// maxKeptActions is how many distinct file actions are kept, which is what checking for protected files reads
+	maxKeptActions = 1000
+)
+
+// EventLog takes an agent's events as they arrive, appending each to the agent's transcript in the run directory,
+// redacted and encrypted like the rest of the run. In memory it keeps only a bounded summary: how many events there
+// were, and the notable ones, namely the prompt, the first errors, and one action per file and kind of action
+type EventLog struct {
+	mutex  sync.Mutex
+	writer *RunWriter
+	file   *os.File
+
+	// sealer encrypts the transcript's records, ending it when the log is closed (nil if it isn't encrypted)
+	sealer *Sealer
+
+	// err is the first error writing the transcript; later events are still summarized
+	err error
+
+	count      int
+	kept       []*protocol.Event
+	errorCount int
+	actions    map[string]bool
+}
+
+// OpenEventLog starts the transcript of an agent, replacing any it already had
+func (w *RunWriter) OpenEventLog(agentID string) (*EventLog, error) {
+	path := TranscriptPath(w.dir, agentID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", TranscriptsDir, err)
+	}
+	// Never write through an existing file, which may be linked into other runs
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to replace transcript: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcript: %w", err)
+	}
+	l := &EventLog{writer: w, file: file, actions: make(map[string]bool)}
+
+	if c := w.cfg.Cipher(); c != nil {
+		sealer, header, err := c.NewSealer()
+		if err == nil {
+			_, err = file.Write(header)
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create transcript: %w", err)
+		}
+		l.sealer = sealer
+	}
+	return l, nil
+}
+
+// ContinueEventLog reopens an agent's transcript to append the events of a follow-up to its earlier work
+// The summary starts empty, so it holds only the follow-up's events. An encrypted transcript, which ended when its
+// log was closed, is started over with its earlier events
+func (w *RunWriter) ContinueEventLog(agentID string) (*EventLog, error) {
+	path := TranscriptPath(w.dir, agentID)
+	c := w.cfg.Cipher()
+	if c == nil {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open transcript: %w", err)
+		}
+		return &EventLog{writer: w, file: file, actions: make(map[string]bool)}, nil
+	}
+
+	earlier, err := readRunFile(path, c)
+	if err != nil && !errors.Is(err, ErrUnfinished) && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	l, err := w.OpenEventLog(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(earlier) > 0 {
+		l.write(earlier)
+	}
+	return l, nil
+}
+
+// NewEventSummary returns an event log that only summarizes events, for events already in a transcript
+func NewEventSummary() *EventLog {
+	return &EventLog{actions: make(map[string]bool)}
+}
+
+// TrackEvent appends an event to the transcript and adds it to the summary
+func (l *EventLog) TrackEvent(event *protocol.Event) {
+	if event == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.count++
+	if l.keep(event) {
+		l.kept = append(l.kept, event)
+	}
+
+	if l.file == nil || l.err != nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		l.err = fmt.Errorf("failed to encode event from %s: %w", event.AgentID, err)
+		return
+	}
+	l.write([]byte(l.writer.cfg.Redact(string(data) + "\n")))
+}
+
+// write appends redacted lines to the transcript, encrypting them as a record if it is encrypted; the caller holds
+// the mutex, or has the log to itself
+func (l *EventLog) write(data []byte) {
+	var err error
+	if l.sealer != nil {
+		data, err = l.sealer.Seal(data)
+	}
+	if err == nil {
+		_, err = l.file.Write(data)
+	}
+	if err != nil {
+		l.err = fmt.Errorf("failed to write transcript: %w", err)
+	}
+}
+
+// keep reports whether an event belongs in the summary; the caller holds the mutex
+func (l *EventLog) keep(event *protocol.Event) bool {
+	switch event.Type {
+	case protocol.EventTypePrompt:
+		return true
+	case protocol.EventTypeError:
+		l.errorCount++
+		return l.errorCount <= maxKeptErrors
+	case protocol.EventTypeAction:
+		var payload protocol.ActionPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil || payload.FilePath == "" {
+			return false
+		}
+		key := payload.ActionType + "\x00" + payload.FilePath
+		if l.actions[key] || len(l.actions) >= maxKeptActions {
+			return false
+		}
+		l.actions[key] = true
+		return true
+	}
+	return false
+}
+
+// Count returns how many events were tracked
+func (l *EventLog) Count() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.count
+}
+
+// Events returns the notable events, in the order they arrived
+func (l *EventLog) Events() []*protocol.Event {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]*protocol.Event(nil), l.kept...)
+}
+
+// Close finishes the transcript, returning the first error writing it
+func (l *EventLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return l.err
+	}
+	// A transcript missing events is left unfinished, so it doesn't read as complete
+	if l.sealer != nil && l.err == nil {
+		end, err := l.sealer.End()
+		if err == nil {
+			_, err = l.file.Write(end)
+		}
+		if err != nil {
+			l.err = fmt.Errorf("failed to write transcript: %w", err)
+		}
+	}
+	err := errors.Join(l.err, l.file.Close())
+	l.file = nil
+	return err
+}
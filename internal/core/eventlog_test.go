@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLog(t *testing.T) {
+	t.Setenv("ORCH_TEST_EVENTS_KEY", "events-key")
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`working_dir: "/tmp/test-dir"
+privacy:
+  encryption_key: "secret://env:ORCH_TEST_EVENTS_KEY"
+agents:
+  - id: codex
+    type: cli
+`), 0644))
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	runDir := filepath.Join(t.TempDir(), "20240102-030405-abcdef")
+	w, err := NewRunWriter(runDir, cfg)
+	require.NoError(t, err)
+	log, err := w.OpenEventLog("codex")
+	require.NoError(t, err)
+
+	event := func(eventType protocol.EventType, payload interface{}) *protocol.Event {
+		e, err := protocol.NewEvent(eventType, "codex", 1).WithPayload(payload)
+		require.NoError(t, err)
+		return e
+	}
+	log.TrackEvent(event(protocol.EventTypePrompt, protocol.PromptPayload{Prompt: "Fix the bug"}))
+	for i := 0; i < 500; i++ {
+		log.TrackEvent(event(protocol.EventTypeThinking, protocol.ThinkingPayload{Content: "Still thinking"}))
+		log.TrackEvent(event(protocol.EventTypeAction, protocol.ActionPayload{ActionType: "edit", FilePath: "main.go"}))
+		log.TrackEvent(event(protocol.EventTypeError, protocol.ErrorPayload{Message: "rate limited"}))
+	}
+	log.TrackEvent(nil)
+
+	// Every event is written as it arrives, so the transcript is readable before the log is closed, though unfinished
+	events, err := ReadTranscript(TranscriptPath(runDir, "codex"), cfg.Cipher())
+	assert.ErrorIs(t, err, ErrUnfinished)
+	assert.Len(t, events, 1501)
+	require.NoError(t, log.Close())
+	events, err = ReadTranscript(TranscriptPath(runDir, "codex"), cfg.Cipher())
+	require.NoError(t, err)
+	assert.Len(t, events, 1501)
+
+	// Only the prompt, the first errors, and one action per file are kept in memory
+	assert.Equal(t, 1501, log.Count())
+	kept := log.Events()
+	assert.Len(t, kept, 1+1+maxKeptErrors)
+	assert.Equal(t, protocol.EventTypePrompt, kept[0].Type)
+	assert.Equal(t, protocol.EventTypeAction, kept[1].Type)
+	assert.Equal(t, protocol.EventTypeError, kept[len(kept)-1].Type)
+
+	// Each line is encrypted on its own, and a line cut short by a crash is skipped, leaving the transcript unfinished
+	data, err := os.ReadFile(TranscriptPath(runDir, "codex"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "Still thinking")
+	finished := data
+	data = data[:bytes.LastIndex(data, []byte(encryptedEnd))]
+	require.NoError(t, os.WriteFile(TranscriptPath(runDir, "codex"), append(data, encryptedRecord+"AAAA"...), 0644))
+	events, err = ReadTranscript(TranscriptPath(runDir, "codex"), cfg.Cipher())
+	assert.ErrorIs(t, err, ErrUnfinished)
+	assert.Len(t, events, 1501)
+	require.NoError(t, os.WriteFile(TranscriptPath(runDir, "codex"), finished, 0644))
+
+	// Summarizing a transcript keeps the same events
+	summary := NewEventSummary()
+	for _, event := range events {
+		summary.TrackEvent(event)
+	}
+	assert.Equal(t, log.Count(), summary.Count())
+	assert.Len(t, summary.Events(), len(kept))
+	assert.NoError(t, summary.Close())
+
+	// Reopening a transcript starts it over
+	log, err = w.OpenEventLog("codex")
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+	events, err = ReadTranscript(TranscriptPath(runDir, "codex"), cfg.Cipher())
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	// Continuing a transcript adds to it, while the summary holds only the new events
+	log, err = w.OpenEventLog("codex")
+	require.NoError(t, err)
+	log.TrackEvent(event(protocol.EventTypePrompt, protocol.PromptPayload{Prompt: "Fix the bug"}))
+	require.NoError(t, log.Close())
+	log, err = w.ContinueEventLog("codex")
+	require.NoError(t, err)
+	log.TrackEvent(event(protocol.EventTypePrompt, protocol.PromptPayload{Prompt: "Fix the failing test"}))
+	require.NoError(t, log.Close())
+	assert.Equal(t, 1, log.Count())
+	events, err = ReadTranscript(TranscriptPath(runDir, "codex"), cfg.Cipher())
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// BestPatchFile is the file name of the winning patch inside a run directory
+const BestPatchFile = "best.patch"
+
+// ExportPatches writes each agent's diff to <runDir>/<agent>.patch and the winner to best.patch
+// The patches are kept in the content-addressed store of the artifacts directory holding the run
+// It returns the paths of the files written, sorted by name
+func ExportPatches(runDir string, patches map[string]*PatchDetails, best *PatchResult) ([]string, error) {
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	var written []string
+
+	for agentID, patch := range patches {
+		if strings.TrimSpace(patch.Diff) == "" {
+			continue
+		}
+
+		path := filepath.Join(runDir, patchFileName(agentID))
+		if err := storeRunFile(runDir, patchFileName(agentID), []byte(exportableDiff(patch.Diff))); err != nil {
+			return written, fmt.Errorf("failed to write patch for %s: %w", agentID, err)
+		}
+		written = append(written, path)
+	}
+
+	if best != nil && strings.TrimSpace(best.Diff) != "" {
+		path := filepath.Join(runDir, BestPatchFile)
+		if err := storeRunFile(runDir, BestPatchFile, []byte(exportableDiff(best.Diff))); err != nil {
+			return written, fmt.Errorf("failed to write best patch: %w", err)
+		}
+		written = append(written, path)
+	}
+
+	sort.Strings(written)
+	return written, nil
+}
+
+// exportableDiff normalizes a diff for export
+// Binary patches keep their index lines since git apply needs them to apply binary hunks
+func exportableDiff(diff string) string {
+	if gitutil.GetDiffStats(diff).BinaryFiles > 0 {
+		return diff
+	}
+	return gitutil.NormalizeDiff(diff)
+}
+
+// patchFileName turns an agent ID into a safe file name
+func patchFileName(agentID string) string {
+	return safeFileName(agentID) + ".patch"
+}
+
+// safeFileName replaces path separators in a name so it stays inside its directory
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// ReadPatches loads the patches exported to a run directory by ExportPatches
+// It returns each agent's diff keyed by the agent name taken from its file name, and the winning diff if one was written
+func ReadPatches(runDir string) (map[string]string, string, error) {
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read run directory: %w", err)
+	}
+
+	patches := make(map[string]string)
+	best := ""
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".patch") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(runDir, entry.Name()))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read patch %s: %w", entry.Name(), err)
+		}
+
+		if entry.Name() == BestPatchFile {
+			best = string(data)
+			continue
+		}
+		patches[strings.TrimSuffix(entry.Name(), ".patch")] = string(data)
+	}
+
+	if len(patches) == 0 && best == "" {
+		return nil, "", fmt.Errorf("no patches found in %s", runDir)
+	}
+
+	return patches, best, nil
+}
+
+// ListRuns returns the IDs of the runs in an artifacts directory, newest first
+// Run IDs start with a UTC timestamp, so they sort by age
+func ListRuns(artifactsDir string) ([]string, error) {
+	entries, err := os.ReadDir(artifactsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifacts directory: %w", err)
+	}
+
+	var runs []string
+	for _, entry := range entries {
+		// The object store and other hidden directories aren't runs
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			runs = append(runs, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(runs)))
+	return runs, nil
+}
+
+// LatestRun returns the directory of the most recent run in an artifacts directory
+func LatestRun(artifactsDir string) (string, error) {
+	runs, err := ListRuns(artifactsDir)
+	if err != nil {
+		return "", err
+	}
+
+	if len(runs) == 0 {
+		return "", fmt.Errorf("no runs found in %s", artifactsDir)
+	}
+	return filepath.Join(artifactsDir, runs[0]), nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportPatches(t *testing.T) {
+	runDir := filepath.Join(t.TempDir(), "run-1")
+
+	diff := `diff --git a/file.txt b/file.txt
+index abcdef1..1234567 100644
+--- a/file.txt
++++ b/file.txt
+@@ -1 +1 @@
+-old
++new
+`
+	patches := map[string]*PatchDetails{
+		"amp":      {Diff: diff},
+		"team/bot": {Diff: diff},
+		"lazy-bot": {Diff: ""},
+	}
+	best := &PatchResult{AgentID: "amp", Diff: diff}
+
+	written, err := ExportPatches(runDir, patches, best)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(runDir, "amp.patch"),
+		filepath.Join(runDir, "best.patch"),
+		filepath.Join(runDir, "team_bot.patch"),
+	}, written, "Empty diffs should be skipped and agent IDs made file-safe")
+
+	content, err := os.ReadFile(filepath.Join(runDir, "best.patch"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "index abcdef1", "Exported text patches should be normalized")
+	assert.Contains(t, string(content), "+new")
+}
+
+func TestReadPatches(t *testing.T) {
+	artifactsDir := t.TempDir()
+	runDir := filepath.Join(artifactsDir, "20240102-030405-abcdef")
+
+	diff := `diff --git a/file.txt b/file.txt
+--- a/file.txt
++++ b/file.txt
+@@ -1 +1 @@
+-old
++new
+`
+	patches := map[string]*PatchDetails{
+		"amp":    {Diff: diff},
+		"claude": {Diff: diff},
+	}
+	_, err := ExportPatches(runDir, patches, &PatchResult{AgentID: "amp", Diff: diff})
+	require.NoError(t, err)
+
+	// Exported patches read back under their agent names
+	read, best, err := ReadPatches(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"amp": diff, "claude": diff}, read)
+	assert.Equal(t, diff, best)
+
+	// An empty directory has nothing to read
+	emptyDir := filepath.Join(artifactsDir, "20240101-000000-000000")
+	require.NoError(t, os.MkdirAll(emptyDir, 0755))
+	_, _, err = ReadPatches(emptyDir)
+	assert.Error(t, err)
+
+	// Runs are listed newest first, and the latest run is the one with the newest timestamp
+	runs, err := ListRuns(artifactsDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20240102-030405-abcdef", "20240101-000000-000000"}, runs)
+
+	latest, err := LatestRun(artifactsDir)
+	require.NoError(t, err)
+	assert.Equal(t, runDir, latest)
+
+	_, err = LatestRun(t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// FailureKind categorizes why an agent didn't produce a usable patch, so failures can be counted across runs
+type FailureKind string
+
+// Failure kinds, from the most to the least specific cause
+const (
+	// FailureBinaryMissing means the agent's command couldn't be found
+	FailureBinaryMissing FailureKind = "binary-missing"
+
+	// FailureAuth means the agent's provider rejected its credentials
+	FailureAuth FailureKind = "auth-failure"
+
+	// FailureRateLimited means the agent's provider refused requests for being too frequent or overloaded
+	FailureRateLimited FailureKind = "rate-limited"
+
+	// FailureTimedOut means the agent was stopped for running too long or going quiet
+	FailureTimedOut FailureKind = "timed-out"
+
+	// FailureLimitExceeded means the watchdog stopped the agent for exceeding another limit, such as tokens or memory
+	FailureLimitExceeded FailureKind = "limit-exceeded"
+
+	// FailureCrashed means the agent exited with an error or couldn't be started
+	FailureCrashed FailureKind = "crashed"
+
+	// FailureNoDiff means the agent finished without changing anything
+	FailureNoDiff FailureKind = "produced-no-diff"
+
+	// FailureDeniedPaths means the patch changed files the path policy doesn't permit, and was disqualified
+	FailureDeniedPaths FailureKind = "denied-paths"
+)
+
+// FailureKinds lists every failure kind in the order they are checked
+var FailureKinds = []FailureKind{
+	FailureBinaryMissing, FailureAuth, FailureRateLimited, FailureTimedOut, FailureLimitExceeded, FailureCrashed, FailureNoDiff, FailureDeniedPaths,
+}
+
+// Phrases in error messages that identify a failure kind, matched case-insensitively
+var (
+	authPhrases      = []string{"unauthorized", "forbidden", "authentication", "not authenticated", "invalid api key", "invalid x-api-key", "api key", "please log in", "login required", "credentials"}
+	rateLimitPhrases = []string{"rate limit", "rate_limit", "ratelimit", "too many requests", "overloaded", "quota"}
+)
+
+// ClassifyFailure works out why an agent didn't produce a usable patch from what is known about its run
+// startErr is the error starting the agent, if it couldn't be started; termination is why the watchdog or its
+// timeout stopped it. It returns the kind and the message that identified it, or "" if the agent succeeded.
+// Credential and rate limit errors take precedence over a termination or crash, since they are usually the cause
+func ClassifyFailure(startErr error, events []*protocol.Event, termination, diff string) (FailureKind, string) {
+	if startErr != nil {
+		if errors.Is(startErr, exec.ErrNotFound) || errors.Is(startErr, fs.ErrNotExist) {
+			return FailureBinaryMissing, startErr.Error()
+		}
+		if kind := classifyMessage(startErr.Error()); kind != "" {
+			return kind, startErr.Error()
+		}
+		return FailureCrashed, startErr.Error()
+	}
+
+	var crash string
+	for _, event := range events {
+		if event.Type != protocol.EventTypeError {
+			continue
+		}
+		payload, err := event.UnmarshalErrorPayload()
+		if err != nil {
+			continue
+		}
+		if kind := classifyMessage(payload.Message + " " + payload.Code); kind != "" {
+			return kind, payload.Message
+		}
+		// The CLI adapter reports a command that exited with an error this way
+		if payload.Code == "command_error" && crash == "" {
+			crash = payload.Message
+		}
+	}
+
+	switch {
+	case termination != "":
+		if strings.HasPrefix(termination, "time limit") || strings.HasPrefix(termination, "idle limit") {
+			return FailureTimedOut, termination
+		}
+		return FailureLimitExceeded, termination
+	case crash != "":
+		return FailureCrashed, crash
+	case strings.TrimSpace(diff) == "":
+		return FailureNoDiff, "no changes made"
+	}
+	return "", ""
+}
+
+// classifyMessage recognizes credential and rate limit errors from their message
+func classifyMessage(message string) FailureKind {
+	message = strings.ToLower(message)
+	for _, phrase := range rateLimitPhrases {
+		if strings.Contains(message, phrase) {
+			return FailureRateLimited
+		}
+	}
+	for _, phrase := range authPhrases {
+		if strings.Contains(message, phrase) {
+			return FailureAuth
+		}
+	}
+	return ""
+}
+
+// FailureHistory counts how each agent's runs ended over the runs in an artifacts directory
+type FailureHistory struct {
+	// Runs is how many runs with a report were read
+	Runs int
+
+	// Agents maps each agent to its failure counts; samples count toward the agent they belong to
+	Agents map[string]*AgentFailures
+}
+
+// AgentFailures counts how an agent's runs ended
+type AgentFailures struct {
+	// Runs is how many times the agent ran
+	Runs int
+
+	// Kinds counts the runs that ended in each kind of failure
+	Kinds map[FailureKind]int
+}
+
+// Failed returns how many of the agent's runs ended in a failure
+func (a *AgentFailures) Failed() int {
+	failed := 0
+	for _, count := range a.Kinds {
+		failed += count
+	}
+	return failed
+}
+
+// LoadFailureHistory counts the failures recorded in the reports of every run in an artifacts directory
+// Runs without a report, e.g. ones still in progress, are skipped
+func LoadFailureHistory(artifactsDir string) (*FailureHistory, error) {
+	runs, err := ListRuns(artifactsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &FailureHistory{Agents: map[string]*AgentFailures{}}, nil
+		}
+		return nil, err
+	}
+
+	history := &FailureHistory{Agents: make(map[string]*AgentFailures)}
+	for _, run := range runs {
+		report, err := ReadReport(filepath.Join(artifactsDir, run))
+		if err != nil {
+			continue
+		}
+		history.Runs++
+		for _, candidate := range report.Candidates {
+			id := SampleOf(candidate.AgentID)
+			agent := history.Agents[id]
+			if agent == nil {
+				agent = &AgentFailures{Kinds: make(map[FailureKind]int)}
+				history.Agents[id] = agent
+			}
+			agent.Runs++
+			if candidate.Failure != "" {
+				agent.Kinds[candidate.Failure]++
+			}
+		}
+	}
+	return history, nil
+}
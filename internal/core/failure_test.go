@@ -0,0 +1,110 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	errorEvent := func(message, code string) *protocol.Event {
+		event, err := protocol.NewEvent(protocol.EventTypeError, "claude", 0).WithPayload(protocol.ErrorPayload{Message: message, Code: code})
+		require.NoError(t, err)
+		return event
+	}
+	crashed := errorEvent("Command failed: exit status 1", "command_error")
+	diff := "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n"
+
+	tests := []struct {
+		name        string
+		startErr    error
+		events      []*protocol.Event
+		termination string
+		diff        string
+		want        FailureKind
+		message     string
+	}{
+		{name: "success", diff: diff},
+		{
+			name:     "binary missing",
+			startErr: fmt.Errorf("failed to start command: %w", &exec.Error{Name: "claude", Err: exec.ErrNotFound}),
+			want:     FailureBinaryMissing,
+			message:  `failed to start command: exec: "claude": executable file not found in $PATH`,
+		},
+		{name: "start error", startErr: errors.New("failed to get stdout pipe"), want: FailureCrashed, message: "failed to get stdout pipe"},
+		{
+			name:    "auth failure",
+			events:  []*protocol.Event{errorEvent("Invalid API key · Please run /login", ""), crashed},
+			want:    FailureAuth,
+			message: "Invalid API key · Please run /login",
+		},
+		{
+			name:        "rate limited before timing out",
+			events:      []*protocol.Event{errorEvent("429 Too Many Requests", "")},
+			termination: "time limit exceeded: ran longer than 10m0s",
+			want:        FailureRateLimited,
+			message:     "429 Too Many Requests",
+		},
+		{name: "overloaded", events: []*protocol.Event{errorEvent("API error", "overloaded_error")}, want: FailureRateLimited, message: "API error"},
+		{name: "timed out", termination: "time limit exceeded: ran longer than 10m0s", diff: diff, want: FailureTimedOut, message: "time limit exceeded: ran longer than 10m0s"},
+		{name: "idle", termination: "idle limit exceeded: no activity for 2m0s", want: FailureTimedOut, message: "idle limit exceeded: no activity for 2m0s"},
+		{name: "over a limit", termination: "token limit exceeded: 200/100 tokens used", want: FailureLimitExceeded, message: "token limit exceeded: 200/100 tokens used"},
+		{name: "crashed", events: []*protocol.Event{crashed}, diff: diff, want: FailureCrashed, message: "Command failed: exit status 1"},
+		{name: "unparseable output isn't a crash", events: []*protocol.Event{errorEvent("Failed to parse output", "parse_error")}, diff: diff},
+		{name: "no diff", diff: " \n", want: FailureNoDiff, message: "no changes made"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, message := ClassifyFailure(tt.startErr, tt.events, tt.termination, tt.diff)
+			assert.Equal(t, tt.want, kind)
+			assert.Equal(t, tt.message, message)
+		})
+	}
+}
+
+func TestLoadFailureHistory(t *testing.T) {
+	artifactsDir := t.TempDir()
+	writeRun := func(runID string, candidates ...*PatchResult) {
+		w, err := NewRunWriter(filepath.Join(artifactsDir, runID), &Config{})
+		require.NoError(t, err)
+		require.NoError(t, w.WriteReport(&TaskResult{RunID: runID, Best: candidates[0], Candidates: candidates}))
+	}
+	writeRun("20240101-000000-aaaaaa",
+		&PatchResult{AgentID: "claude", Score: 100},
+		&PatchResult{AgentID: "codex#1", Failure: FailureRateLimited, FailureMessage: "429 Too Many Requests"},
+		&PatchResult{AgentID: "codex#2", Failure: FailureNoDiff},
+	)
+	writeRun("20240102-000000-bbbbbb",
+		&PatchResult{AgentID: "claude", Failure: FailureTimedOut},
+		&PatchResult{AgentID: "codex", Failure: FailureRateLimited},
+	)
+	// Runs still in progress have no report yet
+	_, err := NewRunWriter(filepath.Join(artifactsDir, "20240103-000000-cccccc"), &Config{})
+	require.NoError(t, err)
+
+	report, err := ReadReport(filepath.Join(artifactsDir, "20240101-000000-aaaaaa"))
+	require.NoError(t, err)
+	assert.Equal(t, "429 Too Many Requests", report.Candidates[1].FailureMessage)
+
+	history, err := LoadFailureHistory(artifactsDir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, history.Runs)
+	require.Contains(t, history.Agents, "claude")
+	assert.Equal(t, 2, history.Agents["claude"].Runs)
+	assert.Equal(t, 1, history.Agents["claude"].Failed())
+	assert.Equal(t, 1, history.Agents["claude"].Kinds[FailureTimedOut])
+	require.Contains(t, history.Agents, "codex", "Samples count toward their agent")
+	assert.Equal(t, 3, history.Agents["codex"].Runs)
+	assert.Equal(t, 3, history.Agents["codex"].Failed())
+	assert.Equal(t, map[FailureKind]int{FailureRateLimited: 2, FailureNoDiff: 1}, history.Agents["codex"].Kinds)
+
+	history, err = LoadFailureHistory(filepath.Join(artifactsDir, "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, history.Runs)
+}
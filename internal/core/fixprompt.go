@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fixPromptOutputLines is how many lines of test output a generated fix prompt includes
+// Test failures are reported at the end of the output, so the last lines are kept
+const fixPromptOutputLines = 80
+
+// FixTestsPrompt generates the prompt for a run that fixes a failing test command
+func FixTestsPrompt(testCommand string, result *TestResult) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The test command `%s` is failing. ", testCommand)
+	sb.WriteString("Find the cause and fix the code so that all tests pass again. ")
+	sb.WriteString("Do not delete, skip, or weaken tests to make them pass.\n")
+
+	if result == nil {
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "\n%s\n", FormatResults(result))
+	if result.Error != "" {
+		fmt.Fprintf(&sb, "Error: %s\n", result.Error)
+	}
+
+	output := strings.TrimRight(result.Output, "\n")
+	if output == "" {
+		return sb.String()
+	}
+
+	lines := strings.Split(output, "\n")
+	if len(lines) > fixPromptOutputLines {
+		fmt.Fprintf(&sb, "\nLast %d lines of test output:\n", fixPromptOutputLines)
+		lines = lines[len(lines)-fixPromptOutputLines:]
+	} else {
+		sb.WriteString("\nTest output:\n")
+	}
+	sb.WriteString(strings.Join(lines, "\n"))
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixTestsPrompt(t *testing.T) {
+	result := &TestResult{
+		TotalTests:  2,
+		PassedTests: 1,
+		FailedTests: 1,
+		Error:       "exit status 1",
+		Output:      "--- FAIL: TestF (0.00s)\n    f_test.go:8: got 1, want 2\nFAIL\texample\t0.01s\n",
+	}
+
+	prompt := FixTestsPrompt("go test ./...", result)
+	assert.Contains(t, prompt, "The test command `go test ./...` is failing.")
+	assert.Contains(t, prompt, "Tests FAILED (2 total, 1 passed, 1 failed, 0 skipped)")
+	assert.Contains(t, prompt, "Error: exit status 1")
+	assert.Contains(t, prompt, "Test output:\n--- FAIL: TestF (0.00s)\n    f_test.go:8: got 1, want 2\nFAIL\texample\t0.01s\n")
+
+	// Long output is cut down to its end, where the failures are reported
+	var output strings.Builder
+	for i := 1; i <= 200; i++ {
+		fmt.Fprintf(&output, "line %d\n", i)
+	}
+	prompt = FixTestsPrompt("make test", &TestResult{Output: output.String()})
+	assert.Contains(t, prompt, fmt.Sprintf("Last %d lines of test output:\n", fixPromptOutputLines))
+	assert.NotContains(t, prompt, "line 120\n")
+	assert.Contains(t, prompt, "line 121\n")
+	assert.True(t, strings.HasSuffix(prompt, "line 200\n"))
+
+	// Without a result only the instructions remain
+	prompt = FixTestsPrompt("make test", nil)
+	assert.Equal(t, "The test command `make test` is failing. Find the cause and fix the code so that all tests pass again. Do not delete, skip, or weaken tests to make them pass.\n", prompt)
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
+)
+
+// Points in a run that hooks run at
+const (
+	// HookPreRun runs in the repository before the baseline tests; a failure aborts the run
+	HookPreRun = "pre_run"
+
+	// HookPostWorktreeCreate runs in each agent's worktree before the agent starts; a failure fails the agent
+	HookPostWorktreeCreate = "post_worktree_create"
+
+	// HookPreEvaluate runs in each patch's worktree before its tests; a failure leaves the patch unevaluated
+	HookPreEvaluate = "pre_evaluate"
+
+	// HookPostSelect runs in the winning patch's worktree once it is selected; a failure is only logged
+	HookPostSelect = "post_select"
+
+	// HookPostApply runs in the repository once the winning patch is applied or committed; a failure is only logged
+	HookPostApply = "post_apply"
+)
+
+// DefaultHookTimeout is how long a hook command may run unless hooks.timeout_seconds says otherwise
+const DefaultHookTimeout = 5 * time.Minute
+
+// maxHookOutput is how much of a failing hook's output its error includes
+const maxHookOutput = 2048
+
+// HooksConfig lists shell commands run at points in a run, with the run's details in ORCHESTRATOR_* environment
+// variables, to set up worktrees, such as by installing dependencies, or to hand results on
+// Each point's commands run in order through the platform's shell, on the host even when agents are sandboxed
+type HooksConfig struct {
+	// PreRun commands run in the repository before the baseline tests
+	PreRun []string `yaml:"pre_run,omitempty"`
+
+	// PostWorktreeCreate commands run in each agent's worktree before the agent starts
+	PostWorktreeCreate []string `yaml:"post_worktree_create,omitempty"`
+
+	// PreEvaluate commands run in each patch's worktree before its tests
+	PreEvaluate []string `yaml:"pre_evaluate,omitempty"`
+
+	// PostSelect commands run in the winning patch's worktree once it is selected
+	PostSelect []string `yaml:"post_select,omitempty"`
+
+	// PostApply commands run in the repository once the winning patch is applied or committed
+	PostApply []string `yaml:"post_apply,omitempty"`
+
+	// TimeoutSeconds limits how long each command may run (0 for 5 minutes)
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+}
+
+// HookEnv is what a hook is told about the run, each field in an ORCHESTRATOR_* environment variable
+// Fields that don't apply at a hook's point are left empty
+type HookEnv struct {
+	RunID     string
+	Repo      string
+	BaseRef   string
+	Artifacts string
+
+	// Agent and Worktree are the agent a hook runs for and its worktree
+	Agent    string
+	Worktree string
+
+	// Winner, Score, and Patch describe the selected patch, Patch being the path of its exported diff
+	Winner string
+	Score  int
+	Patch  string
+
+	// Branch is the branch the winning patch was committed to
+	Branch string
+}
+
+// Commands returns the commands configured for a point in a run
+func (h HooksConfig) Commands(hook string) []string {
+	switch hook {
+	case HookPreRun:
+		return h.PreRun
+	case HookPostWorktreeCreate:
+		return h.PostWorktreeCreate
+	case HookPreEvaluate:
+		return h.PreEvaluate
+	case HookPostSelect:
+		return h.PostSelect
+	case HookPostApply:
+		return h.PostApply
+	}
+	return nil
+}
+
+// Timeout returns how long each hook command may run
+func (h HooksConfig) Timeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return DefaultHookTimeout
+}
+
+// validate checks that no hook command is empty and the timeout isn't negative
+func (h HooksConfig) validate() error {
+	for _, hook := range []string{HookPreRun, HookPostWorktreeCreate, HookPreEvaluate, HookPostSelect, HookPostApply} {
+		for i, command := range h.Commands(hook) {
+			if strings.TrimSpace(command) == "" {
+				return fieldError(fmt.Sprintf("hooks.%s[%d]", hook, i), "hook command at index %d of %s is empty", i, hook)
+			}
+		}
+	}
+	if h.TimeoutSeconds < 0 {
+		return fieldError("hooks.timeout_seconds", "hooks.timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+// Run runs the commands configured for a point in a run from dir, stopping at the first that fails
+// The error of a failing command includes the end of its output
+func (h HooksConfig) Run(ctx context.Context, hook, dir string, env HookEnv) error {
+	for _, command := range h.Commands(hook) {
+		if err := h.run(ctx, hook, command, dir, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run runs one hook command, killing whatever it started if it runs out of time
+func (h HooksConfig) run(ctx context.Context, hook, command, dir string, env HookEnv) error {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout())
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := procutil.ShellCommand(ctx, procutil.DefaultShell(), command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env.environ(hook)...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	started := time.Now()
+	group, err := procutil.Start(cmd)
+	if err == nil {
+		err = group.Wait()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", h.Timeout())
+	}
+	audit.Record(ctx, audit.HookRun, "hook", hook, "command", command, "dir", dir, "success", strconv.FormatBool(err == nil), "duration", time.Since(started).Round(time.Millisecond).String())
+	if err != nil {
+		if tail := strings.TrimSpace(lastBytes(output.String(), maxHookOutput)); tail != "" {
+			return fmt.Errorf("%s hook %q failed: %w\n%s", hook, command, err, tail)
+		}
+		return fmt.Errorf("%s hook %q failed: %w", hook, command, err)
+	}
+	return nil
+}
+
+// environ returns the environment variables telling a hook about the run
+func (e HookEnv) environ(hook string) []string {
+	env := []string{"ORCHESTRATOR_HOOK=" + hook}
+	for _, v := range []struct{ name, value string }{
+		{"RUN_ID", e.RunID},
+		{"REPO", e.Repo},
+		{"BASE_REF", e.BaseRef},
+		{"ARTIFACTS", e.Artifacts},
+		{"AGENT", e.Agent},
+		{"WORKTREE", e.Worktree},
+		{"WINNER", e.Winner},
+		{"PATCH", e.Patch},
+		{"BRANCH", e.Branch},
+	} {
+		if v.value != "" {
+			env = append(env, "ORCHESTRATOR_"+v.name+"="+v.value)
+		}
+	}
+	if e.Winner != "" {
+		env = append(env, "ORCHESTRATOR_SCORE="+strconv.Itoa(e.Score))
+	}
+	return env
+}
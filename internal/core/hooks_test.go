@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateHooks(t *testing.T) {
+	tests := []struct {
+		name  string
+		hooks HooksConfig
+		field string
+	}{
+		{"valid", HooksConfig{PreRun: []string{"make deps"}, PostApply: []string{"./notify.sh"}, TimeoutSeconds: 60}, ""},
+		{"empty command", HooksConfig{PostWorktreeCreate: []string{"npm ci", " "}}, "hooks.post_worktree_create[1]"},
+		{"negative timeout", HooksConfig{TimeoutSeconds: -1}, "hooks.timeout_seconds"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.hooks.validate()
+			if tc.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var configErr *ConfigError
+			require.ErrorAs(t, err, &configErr)
+			assert.Equal(t, tc.field, configErr.Field)
+		})
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping hook test in short mode")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands are POSIX shell")
+	}
+
+	// Commands run in order from the directory, with the run's details in the environment
+	dir := t.TempDir()
+	hooks := HooksConfig{PostSelect: []string{
+		`printf '%s|%s|%s|%s|%s' "$ORCHESTRATOR_HOOK" "$ORCHESTRATOR_RUN_ID" "$ORCHESTRATOR_WINNER" "$ORCHESTRATOR_SCORE" "${ORCHESTRATOR_BRANCH-unset}" > env.txt`,
+		`pwd > pwd.txt`,
+	}}
+	env := HookEnv{RunID: "run-1", Repo: dir, Winner: "claude", Score: 7, Worktree: dir}
+	require.NoError(t, hooks.Run(context.Background(), HookPostSelect, dir, env))
+	written, err := os.ReadFile(filepath.Join(dir, "env.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "post_select|run-1|claude|7|unset", string(written))
+	assert.FileExists(t, filepath.Join(dir, "pwd.txt"))
+
+	// Other points' commands don't run
+	require.NoError(t, hooks.Run(context.Background(), HookPreRun, dir, env))
+
+	// The first failing command stops the rest, and its output explains why
+	hooks = HooksConfig{PreRun: []string{"echo missing dependency >&2; exit 3", "touch ran.txt"}}
+	err = hooks.Run(context.Background(), HookPreRun, dir, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre_run hook")
+	assert.Contains(t, err.Error(), "missing dependency")
+	assert.NoFileExists(t, filepath.Join(dir, "ran.txt"))
+
+	// Commands running out of time are stopped
+	hooks = HooksConfig{PreEvaluate: []string{"sleep 30"}, TimeoutSeconds: 1}
+	err = hooks.Run(context.Background(), HookPreEvaluate, dir, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
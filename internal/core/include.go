@@ -0,0 +1,245 @@
+package core
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadNode parses a configuration file and merges in the files it includes
+// Included files are merged first so the including file's settings take precedence
+func loadNode(path string, format ConfigFormat, visiting map[string]bool) (*yaml.Node, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving config path: %w", err)
+	}
+	if visiting[absPath] {
+		return nil, fmt.Errorf("config file %s includes itself", path)
+	}
+	visiting[absPath] = true
+	defer delete(visiting, absPath)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	if format == FormatAuto {
+		format = DetectFormat(path)
+	}
+
+	root, err := parseNode(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	includes, err := includePaths(root, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	if len(includes) == 0 {
+		return root, nil
+	}
+
+	var merged *yaml.Node
+	for _, include := range includes {
+		node, err := loadNode(include, FormatAuto, visiting)
+		if err != nil {
+			return nil, err
+		}
+
+		// Nested includes have already been resolved
+		node = withoutKey(documentRoot(node), "include")
+		if merged == nil {
+			merged = node
+			continue
+		}
+		merged = mergeNodes(merged, node)
+	}
+
+	return mergeNodes(merged, documentRoot(root)), nil
+}
+
+// includePaths returns the files listed under a node's "include" key
+// Paths are relative to the including file and may contain glob patterns
+func includePaths(root *yaml.Node, dir string) ([]string, error) {
+	include := mappingValue(documentRoot(root), "include")
+	if include == nil {
+		return nil, nil
+	}
+
+	var patterns []string
+	switch include.Kind {
+	case yaml.ScalarNode:
+		patterns = []string{include.Value}
+	case yaml.SequenceNode:
+		for _, item := range include.Content {
+			patterns = append(patterns, item.Value)
+		}
+	default:
+		return nil, &ConfigError{Field: "include", Line: include.Line, Column: include.Column, Message: "include must be a path or a list of paths"}
+	}
+
+	var paths []string
+	for _, pattern := range patterns {
+		pattern, undefined := expandEnv(pattern)
+		for _, name := range undefined {
+			slog.Warn("config include references an undefined environment variable", "variable", name)
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("included config file %s does not exist", pattern)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+
+	return paths, nil
+}
+
+// resolveTemplates merges each agent's "extends" template into the agent's definition
+// Templates may extend other templates; the agent's own settings take precedence
+func resolveTemplates(root *yaml.Node) error {
+	top := documentRoot(root)
+	agents := mappingValue(top, "agents")
+	if agents == nil || agents.Kind != yaml.SequenceNode {
+		return nil
+	}
+	templates := mappingValue(top, "agent_templates")
+
+	for i, agent := range agents.Content {
+		resolved, err := extendAgent(agent, templates, nil)
+		if err != nil {
+			return err
+		}
+		agents.Content[i] = resolved
+	}
+
+	return nil
+}
+
+// extendAgent returns an agent or template node merged over the template it extends
+func extendAgent(node, templates *yaml.Node, chain []string) (*yaml.Node, error) {
+	extends := mappingValue(node, "extends")
+	if extends == nil {
+		return node, nil
+	}
+	name := extends.Value
+
+	for _, seen := range chain {
+		if seen == name {
+			return nil, &ConfigError{
+				Field:   "agent_templates." + name,
+				Line:    extends.Line,
+				Column:  extends.Column,
+				Message: fmt.Sprintf("agent template cycle: %s -> %s", strings.Join(chain, " -> "), name),
+			}
+		}
+	}
+
+	var template *yaml.Node
+	if templates != nil {
+		template = mappingValue(templates, name)
+	}
+	if template == nil {
+		return nil, &ConfigError{
+			Line:       extends.Line,
+			Column:     extends.Column,
+			Message:    fmt.Sprintf("unknown agent template '%s'", name),
+			Suggestion: suggest(name, mappingKeys(templates)),
+		}
+	}
+
+	base, err := extendAgent(template, templates, append(chain, name))
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeNodes(base, node), nil
+}
+
+// mergeNodes deep-merges two mapping nodes, with values from override taking precedence
+// Agent lists are concatenated so included files can each contribute agents
+func mergeNodes(base, override *yaml.Node) *yaml.Node {
+	base, override = documentRoot(base), documentRoot(override)
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return copyNode(override)
+	}
+
+	merged := copyNode(base)
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+
+		existing := -1
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				existing = j + 1
+				break
+			}
+		}
+
+		switch {
+		case existing < 0:
+			merged.Content = append(merged.Content, copyNode(key), copyNode(value))
+		case key.Value == "agents" && value.Kind == yaml.SequenceNode && merged.Content[existing].Kind == yaml.SequenceNode:
+			merged.Content[existing].Content = append(merged.Content[existing].Content, copyNode(value).Content...)
+		default:
+			merged.Content[existing] = mergeNodes(merged.Content[existing], value)
+		}
+	}
+
+	return merged
+}
+
+// withoutKey returns a copy of a mapping node with a key removed
+func withoutKey(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return copyNode(node)
+	}
+
+	result := *node
+	result.Content = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			continue
+		}
+		result.Content = append(result.Content, copyNode(node.Content[i]), copyNode(node.Content[i+1]))
+	}
+	return &result
+}
+
+// copyNode deep-copies a node so shared templates aren't modified through merged agents
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	if node.Content != nil {
+		copied.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			copied.Content[i] = copyNode(child)
+		}
+	}
+	return &copied
+}
+
+// mappingKeys returns the keys of a mapping node
+func mappingKeys(node *yaml.Node) []string {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	keys := make([]string, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keys = append(keys, node.Content[i].Value)
+	}
+	return keys
+}
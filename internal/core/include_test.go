@@ -0,0 +1,172 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestLoadConfig_Includes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `include:
+  - base.yaml
+  - agents/*.yaml
+timeout_seconds: 900
+mutation:
+  max_mutants: 3
+agents:
+  - id: "local"
+    type: "cli"
+`,
+		"base.yaml": `working_dir: "/tmp/test-dir"
+test_command: "go test ./..."
+timeout_seconds: 300
+mutation:
+  enabled: true
+  max_mutants: 10
+`,
+		"agents/a.yaml": `agents:
+  - id: "amp"
+    type: "cli"
+`,
+		"agents/b.json": `{"agents": [{"id": "ignored-by-glob", "type": "cli"}]}`,
+		"agents/c.yaml": `include: ../shared/codex.toml
+`,
+		"shared/codex.toml": `[[agents]]
+id = "codex"
+type = "cli"
+`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+
+	// Settings from included files are merged beneath the including file
+	assert.Equal(t, "/tmp/test-dir", cfg.WorkingDir)
+	assert.Equal(t, "go test ./...", cfg.TestCommand)
+	assert.Equal(t, 900, cfg.TimeoutSeconds)
+	assert.Equal(t, MutationConfig{Enabled: true, MaxMutants: 3}, cfg.Mutation)
+
+	// Agents from every file are combined in include order
+	ids := make([]string, len(cfg.Agents))
+	for i, agent := range cfg.Agents {
+		ids[i] = agent.ID
+	}
+	assert.Equal(t, []string{"amp", "codex", "local"}, ids)
+}
+
+func TestLoadConfig_IncludeErrors(t *testing.T) {
+	// Missing files are reported
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": "include: missing.yaml\n",
+	})
+	_, err := Load(filepath.Join(dir, "config.yaml"))
+	assert.ErrorContains(t, err, "does not exist")
+
+	// Include cycles are detected
+	dir = writeConfigFiles(t, map[string]string{
+		"a.yaml": "include: b.yaml\n",
+		"b.yaml": "include: a.yaml\n",
+	})
+	_, err = Load(filepath.Join(dir, "a.yaml"))
+	assert.ErrorContains(t, err, "includes itself")
+}
+
+func TestLoadConfig_AgentTemplates(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `working_dir: "/tmp/test-dir"
+agent_templates:
+  claude-base:
+    type: "cli"
+    timeout_seconds: 600
+    config:
+      command: "claude"
+      args: ["--print"]
+      env:
+        CLAUDE_LOG: "debug"
+  claude-sonnet:
+    extends: "claude-base"
+    config:
+      model: "sonnet"
+agents:
+  - id: "claude-1"
+    extends: "claude-sonnet"
+  - id: "claude-2"
+    extends: "claude-sonnet"
+    timeout_seconds: 120
+    config:
+      args: ["--print", "--verbose"]
+      env:
+        EXTRA: "1"
+`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	require.Len(t, cfg.Agents, 2)
+
+	// Template settings are inherited through the chain
+	first := cfg.Agents[0]
+	assert.Equal(t, "cli", first.Type)
+	assert.Equal(t, "claude-sonnet", first.Extends)
+	assert.Equal(t, 600, first.TimeoutSeconds)
+	assert.Equal(t, "claude", first.Config["command"])
+	assert.Equal(t, "sonnet", first.Config["model"])
+	assert.Equal(t, []interface{}{"--print"}, first.Config["args"])
+
+	// Agent settings take precedence, and nested maps are merged
+	second := cfg.Agents[1]
+	assert.Equal(t, 120, second.TimeoutSeconds)
+	assert.Equal(t, []interface{}{"--print", "--verbose"}, second.Config["args"])
+	assert.Equal(t, map[string]interface{}{"CLAUDE_LOG": "debug", "EXTRA": "1"}, second.Config["env"])
+	assert.Equal(t, "sonnet", second.Config["model"])
+}
+
+func TestLoadConfig_AgentTemplateErrors(t *testing.T) {
+	// Unknown templates get a suggestion
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `working_dir: "/tmp/test-dir"
+agent_templates:
+  claude-base:
+    type: "cli"
+agents:
+  - id: "claude"
+    extends: "claude-bse"
+`,
+	})
+	_, err := Load(filepath.Join(dir, "config.yaml"))
+	require.Error(t, err)
+	assert.Equal(t, "line 7, column 14: unknown agent template 'claude-bse' (did you mean 'claude-base'?)", err.Error())
+
+	// Template cycles are detected
+	dir = writeConfigFiles(t, map[string]string{
+		"config.yaml": `working_dir: "/tmp/test-dir"
+agent_templates:
+  a:
+    extends: "b"
+  b:
+    extends: "a"
+agents:
+  - id: "claude"
+    extends: "a"
+`,
+	})
+	_, err = Load(filepath.Join(dir, "config.yaml"))
+	var configErr *ConfigError
+	require.True(t, errors.As(err, &configErr))
+	assert.Contains(t, configErr.Message, "agent template cycle: a -> b -> a")
+}
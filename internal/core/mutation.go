@@ -0,0 +1,287 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// DefaultMaxMutants caps how many mutants are evaluated per patch
+const DefaultMaxMutants = 10
+
+// MutationPenalty is the maximum score penalty applied to a patch whose mutants all survive
+const MutationPenalty = 30
+
+// MutationResult summarizes a mutation-testing pass over a patch
+type MutationResult struct {
+	// Total is the number of mutants that were evaluated
+	Total int `json:"total"`
+
+	// Killed is the number of mutants detected by a failing test run
+	Killed int `json:"killed"`
+
+	// Survived lists the mutants that the test suite failed to detect
+	Survived []Mutant `json:"survived,omitempty"`
+
+	// Error is why mutation testing stopped before evaluating every mutant (empty if it didn't)
+	Error string `json:"error,omitempty"`
+}
+
+// KillRatio returns the fraction of mutants detected by the tests
+// A result with no mutants is treated as fully constrained
+func (mr *MutationResult) KillRatio() float64 {
+	if mr.Total == 0 {
+		return 1
+	}
+	return float64(mr.Killed) / float64(mr.Total)
+}
+
+// Mutant describes a single perturbation of a line added by a patch
+type Mutant struct {
+	// FilePath is the file relative to the worktree root
+	FilePath string `json:"file_path"`
+
+	// Line is the 1-based line number in the patched file
+	Line int `json:"line"`
+
+	// Original is the unmodified line content
+	Original string `json:"original"`
+
+	// Mutated is the perturbed line content
+	Mutated string `json:"mutated"`
+}
+
+// mutationOperators are simple source perturbations, tried in order
+// Only the first operator that matches a line is used so each line yields one mutant. Operators match whole
+// tokens, so "true" isn't found in isTrue, nor "<=" in "<<="
+var mutationOperators = []struct {
+	from string
+	to   string
+}{
+	{"===", "!=="},
+	{"!==", "==="},
+	{"==", "!="},
+	{"!=", "=="},
+	{"<=", ">"},
+	{">=", "<"},
+	{" < ", " >= "},
+	{" > ", " <= "},
+	{"&&", "||"},
+	{"||", "&&"},
+	{"true", "false"},
+	{"false", "true"},
+	{" + ", " - "},
+	{" - ", " + "},
+}
+
+// Match the new-file range in a hunk header: "@@ -1,7 +3,9 @@"
+var hunkNewRangeRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// MutationTester perturbs lines introduced by a patch and re-runs tests to see whether they notice
+type MutationTester struct {
+	// testRunner runs tests against each mutant
+	testRunner *TestRunner
+
+	// maxMutants caps the number of mutants evaluated per patch
+	maxMutants int
+
+	// maxLineBytes is how much of each diff line is held while generating mutants (0 for the default)
+	maxLineBytes int
+}
+
+// NewMutationTester creates a new mutation tester
+func NewMutationTester(testRunner *TestRunner, maxMutants int) *MutationTester {
+	if maxMutants <= 0 {
+		maxMutants = DefaultMaxMutants
+	}
+
+	return &MutationTester{
+		testRunner: testRunner,
+		maxMutants: maxMutants,
+	}
+}
+
+// Run generates mutants from the diff and evaluates each one in the worktree
+// The worktree is restored to the patched state after every mutant
+func (mt *MutationTester) Run(ctx context.Context, worktreePath, diff string) (*MutationResult, error) {
+	mutants := generateMutants(diff, mt.maxMutants, mt.maxLineBytes)
+	result := &MutationResult{}
+
+	for _, mutant := range mutants {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		killed, err := mt.evaluateMutant(ctx, worktreePath, mutant)
+		if err != nil {
+			return result, fmt.Errorf("failed to evaluate mutant in %s:%d: %w", mutant.FilePath, mutant.Line, err)
+		}
+
+		result.Total++
+		if killed {
+			result.Killed++
+		} else {
+			result.Survived = append(result.Survived, mutant)
+		}
+	}
+
+	return result, nil
+}
+
+// evaluateMutant applies a single mutant, runs the tests, and restores the file
+func (mt *MutationTester) evaluateMutant(ctx context.Context, worktreePath string, mutant Mutant) (bool, error) {
+	path := filepath.Join(worktreePath, mutant.FilePath)
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Lines are compared without carriage returns, which a file with CRLF line endings keeps on every line
+	lines := strings.Split(string(original), "\n")
+	if mutant.Line < 1 || mutant.Line > len(lines) || strings.TrimSuffix(lines[mutant.Line-1], "\r") != strings.TrimSuffix(mutant.Original, "\r") {
+		return false, fmt.Errorf("line does not match patch contents")
+	}
+	mutated := strings.TrimSuffix(mutant.Mutated, "\r")
+	if strings.HasSuffix(lines[mutant.Line-1], "\r") {
+		mutated += "\r"
+	}
+	lines[mutant.Line-1] = mutated
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), info.Mode()); err != nil {
+		return false, fmt.Errorf("failed to write mutant: %w", err)
+	}
+
+	// Always restore the patched contents, even if the test run fails, since a mutant left behind would be applied
+	// with the patch
+	testResults, runErr := mt.testRunner.Run(ctx, worktreePath)
+	if err := os.WriteFile(path, original, info.Mode()); err != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", mutant.FilePath, err)
+	}
+	if runErr != nil {
+		return false, runErr
+	}
+
+	return !testResults.Success, nil
+}
+
+// GenerateMutants builds up to max mutants from the lines added by a diff
+func GenerateMutants(diff string, max int) []Mutant {
+	return generateMutants(diff, max, gitutil.DefaultMaxDiffLineBytes)
+}
+
+// generateMutants builds up to max mutants from a diff, holding at most maxLineBytes of any line
+func generateMutants(diff string, max int, maxLineBytes int) []Mutant {
+	var mutants []Mutant
+	var currentFile string
+	newLine := 0
+
+	scanner := gitutil.NewDiffScanner(strings.NewReader(diff), maxLineBytes)
+	for scanner.Scan() {
+		line := scanner.Line()
+
+		if strings.HasPrefix(line, "+++ ") && !scanner.Truncated() {
+			currentFile = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			if currentFile == "/dev/null" {
+				currentFile = ""
+			}
+			continue
+		}
+
+		if matches := hunkNewRangeRegex.FindStringSubmatch(line); matches != nil {
+			newLine, _ = strconv.Atoi(matches[1])
+			continue
+		}
+
+		if currentFile == "" || newLine == 0 {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, gitutil.AddedLinePrefix):
+			// Only the start of a line too long to hold is known, so it isn't mutated
+			content := line[1:]
+			if mutated, ok := mutateLine(content); ok && len(mutants) < max && !scanner.Truncated() {
+				mutants = append(mutants, Mutant{
+					FilePath: currentFile,
+					Line:     newLine,
+					Original: content,
+					Mutated:  mutated,
+				})
+			}
+			newLine++
+		case strings.HasPrefix(line, gitutil.RemovedLinePrefix):
+			// Removed lines don't exist in the patched file
+		case strings.HasPrefix(line, "\\"):
+			// "No newline at end of file" marker
+		default:
+			newLine++
+		}
+	}
+
+	return mutants
+}
+
+// mutateLine applies the first matching operator to a line of source code
+// Comment lines are left alone since perturbing them can't change behavior
+func mutateLine(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") {
+		return "", false
+	}
+
+	for _, op := range mutationOperators {
+		if i := tokenIndex(line, op.from); i >= 0 {
+			return line[:i] + op.to + line[i+len(op.from):], true
+		}
+	}
+
+	return "", false
+}
+
+// tokenIndex returns the index of the first occurrence of token in line that isn't part of a longer identifier or
+// operator, or -1 if there is none
+func tokenIndex(line, token string) int {
+	// A token is bounded by characters of a different kind: a word by non-word characters, an operator by
+	// non-operator characters. Operators such as " + " carry their own spacing, so are bounded already
+	partOf := func(c byte) bool { return strings.IndexByte("=!<>&|+-*/%^", c) >= 0 }
+	if isWordChar(token[0]) {
+		partOf = isWordChar
+	}
+	for offset := 0; ; {
+		i := strings.Index(line[offset:], token)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		end := i + len(token)
+		if (i == 0 || !partOf(line[i-1]) || !partOf(token[0])) && (end == len(line) || !partOf(line[end]) || !partOf(token[len(token)-1])) {
+			return i
+		}
+		offset = i + 1
+	}
+}
+
+// isWordChar reports whether c can be part of an identifier or keyword
+func isWordChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// mutationPenalty converts a mutation result into a score penalty
+func mutationPenalty(result *MutationResult) int {
+	if result == nil || result.Total == 0 {
+		return 0
+	}
+	return int(float64(MutationPenalty) * (1 - result.KillRatio()))
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateMutants(t *testing.T) {
+	diff := `diff --git a/pkg/buggy.go b/pkg/buggy.go
+index 1234567..89abcde 100644
+--- a/pkg/buggy.go
++++ b/pkg/buggy.go
+@@ -1,5 +1,10 @@
+ package pkg
+
++import "errors"
++
+ func Divide(a, b int) (int, error) {
+-	// Bug: Missing check for division by zero
++	// Guard against division by zero
++	if b == 0 {
++		return 0, errors.New("division by zero")
++	}
+ 	return a / b, nil
+ }
+`
+
+	mutants := GenerateMutants(diff, 10)
+	require.Len(t, mutants, 1, "Only the comparison line should be mutated")
+	assert.Equal(t, "pkg/buggy.go", mutants[0].FilePath)
+	assert.Equal(t, 7, mutants[0].Line)
+	assert.Equal(t, "\tif b == 0 {", mutants[0].Original)
+	assert.Equal(t, "\tif b != 0 {", mutants[0].Mutated)
+
+	// Respect the mutant cap
+	assert.Empty(t, GenerateMutants(diff, 0))
+
+	// A line too long to hold, such as generated code, isn't mutated but still counts
+	long := strings.Replace(diff, "+import \"errors\"\n", "+var table = \""+strings.Repeat("x == 0 ", 20000)+"\"\n", 1)
+	mutants = GenerateMutants(long, 10)
+	require.Len(t, mutants, 1)
+	assert.Equal(t, 7, mutants[0].Line)
+}
+
+func TestMutateLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+		ok       bool
+	}{
+		{name: "equality", line: "if a == b {", expected: "if a != b {", ok: true},
+		{name: "less or equal", line: "for i <= n {", expected: "for i > n {", ok: true},
+		{name: "logical and", line: "ok := a && b", expected: "ok := a || b", ok: true},
+		{name: "boolean", line: "return true", expected: "return false", ok: true},
+		{name: "arithmetic", line: "x := a + b", expected: "x := a - b", ok: true},
+		{name: "strict equality", line: "if (a === b) {", expected: "if (a !== b) {", ok: true},
+		{name: "boolean in identifier", line: "if isTrue(x) || y {", expected: "if isTrue(x) && y {", ok: true},
+		{name: "later whole word", line: "v := untrue || true", expected: "v := untrue && true", ok: true},
+		{name: "boolean after identifier", line: "trueCount := true", expected: "trueCount := false", ok: true},
+		{name: "shift assignment", line: "x <<= 2", ok: false},
+		{name: "identifiers only", line: "return isTrue(falsey)", ok: false},
+		{name: "comment", line: "// a == b", ok: false},
+		{name: "no operator", line: "return nil", ok: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mutated, ok := mutateLine(tc.line)
+			assert.Equal(t, tc.ok, ok)
+			if tc.ok {
+				assert.Equal(t, tc.expected, mutated)
+			}
+		})
+	}
+}
+
+func TestMutationPenalty(t *testing.T) {
+	assert.Equal(t, 0, mutationPenalty(nil))
+	assert.Equal(t, 0, mutationPenalty(&MutationResult{}))
+	assert.Equal(t, 0, mutationPenalty(&MutationResult{Total: 4, Killed: 4}))
+	assert.Equal(t, MutationPenalty/2, mutationPenalty(&MutationResult{Total: 4, Killed: 2}))
+	assert.Equal(t, MutationPenalty, mutationPenalty(&MutationResult{Total: 4, Killed: 0}))
+}
+
+func TestMutationTester_CRLF(t *testing.T) {
+	dir := t.TempDir()
+	original := "package main\r\n\r\nfunc same(a, b int) bool {\r\n\treturn a == b\r\n}\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(original), 0644))
+
+	// The tests fail, killing the mutant, only if it keeps the file's line endings
+	tester := NewMutationTester(NewTestRunner(`! grep -q "a != b$(printf '\r')$" main.go`, 5*time.Second), 5)
+	diff := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -4 +4 @@\n-\treturn a\r\n+\treturn a == b\r\n"
+
+	result, err := tester.Run(context.Background(), dir, diff)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Total)
+	assert.Equal(t, 1, result.Killed)
+
+	restored, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, original, string(restored))
+}
+
+func TestMutationTester_RestoreFailure(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nvar ok = a == b\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "break.sh"), []byte("rm main.go && mkdir main.go\n"), 0644))
+
+	// The tests replace the file with a directory, so it can't be restored
+	tester := NewMutationTester(NewTestRunner("sh break.sh", 5*time.Second), 5)
+	diff := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -3 +3 @@\n-var ok = a\n+var ok = a == b\n"
+
+	_, err := tester.Run(context.Background(), dir, diff)
+	assert.ErrorContains(t, err, "failed to restore main.go")
+}
+
+func TestMutationTester_Run(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping mutation test in short mode")
+	}
+
+	// Create a test repository and apply the good fix
+	baseRepoDir := t.TempDir()
+	createTestProjectWithFailingTest(t, baseRepoDir)
+
+	patches, err := createTestPatches(t, baseRepoDir)
+	require.NoError(t, err)
+	patch := patches["good-agent"]
+
+	testRunner := NewTestRunner("go test ./...", 30*time.Second)
+	tester := NewMutationTester(testRunner, 5)
+
+	result, err := tester.Run(context.Background(), patch.WorktreePath, patch.Diff)
+	require.NoError(t, err)
+
+	// The zero check is exercised by the existing test, so the mutant should be killed
+	assert.Equal(t, 1, result.Total)
+	assert.Equal(t, 1, result.Killed)
+	assert.Empty(t, result.Survived)
+
+	// The worktree should be restored to the patched state
+	diffAfter, err := runGitCommand(patch.WorktreePath, "diff")
+	require.NoError(t, err)
+	assert.Equal(t, patch.Diff, diffAfter)
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PatchAgentType is the adapter type of agents that submit an existing patch file instead of working on the task,
+// so human-written or previously generated fixes compete with agents under the same tests and scoring
+const PatchAgentType = "patch"
+
+// patchAgentPrefix starts the IDs of the agents added for patch files given to a run
+const patchAgentPrefix = "patch-"
+
+// IsPatchAgent reports whether an agent submits an existing patch file
+// Such an agent makes one attempt, since the file never changes, and can't revise its patch or write tests
+func (c *Config) IsPatchAgent(agentID string) bool {
+	for _, agent := range c.Agents {
+		if agent.ID == agentID {
+			return agent.Type == PatchAgentType
+		}
+	}
+	return false
+}
+
+// runsOnce reports whether an agent runs once under its own ID, without samples or prompt variants
+func (c *Config) runsOnce(agent AgentConfig) bool {
+	return agent.Type == PatchAgentType || c.namedByRole(agent.ID)
+}
+
+// WithPatchFiles returns a copy of the configuration with an agent submitting each patch file, named by PatchAgentID
+func (c *Config) WithPatchFiles(files []string) (*Config, error) {
+	copied := *c
+	copied.Agents = append([]AgentConfig(nil), c.Agents...)
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err == nil {
+			_, err = os.Stat(abs)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("patch file %s: %w", file, err)
+		}
+
+		id := PatchAgentID(file)
+		for _, agent := range copied.Agents {
+			if agent.ID == id {
+				return nil, fmt.Errorf("patch file %s would be agent '%s', which is already configured", file, id)
+			}
+		}
+		copied.Agents = append(copied.Agents, AgentConfig{ID: id, Type: PatchAgentType, Config: map[string]interface{}{"file": abs}})
+	}
+	return &copied, nil
+}
+
+// PatchAgentID names the agent submitting a patch file after the file, e.g. patch-fix for fix.patch
+func PatchAgentID(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	return patchAgentPrefix + strings.Map(func(r rune) rune {
+		if strings.ContainsRune(promptVariantSeparator+sampleSeparator+" \t", r) {
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+// validatePatchAgent checks a patch agent names its patch file
+func validatePatchAgent(field string, agent AgentConfig) error {
+	if file, _ := agent.Config["file"].(string); file == "" {
+		return fieldError(field+".config.file", "patch agent '%s' is missing config.file", agent.ID)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithPatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "human fix.patch")
+	require.NoError(t, os.WriteFile(file, []byte("diff\n"), 0644))
+
+	cfg := &Config{Samples: 2, Agents: []AgentConfig{{ID: "claude", Type: "claude"}}}
+	withPatches, err := cfg.WithPatchFiles([]string{file})
+	require.NoError(t, err)
+	require.Len(t, withPatches.Agents, 2)
+	assert.Len(t, cfg.Agents, 1, "The original configuration is unchanged")
+
+	agent := withPatches.Agents[1]
+	assert.Equal(t, "patch-human-fix", agent.ID)
+	assert.Equal(t, PatchAgentType, agent.Type)
+	assert.Equal(t, file, agent.Config["file"])
+	assert.True(t, withPatches.IsPatchAgent("patch-human-fix"))
+	assert.False(t, withPatches.IsPatchAgent("claude"))
+
+	// Patch agents make one attempt with the task as it is, since their patch never changes
+	sampled, err := withPatches.ExpandSamples(0)
+	require.NoError(t, err)
+	var ids []string
+	for _, agent := range sampled.Agents {
+		ids = append(ids, agent.ID)
+	}
+	assert.Equal(t, []string{"claude#1", "claude#2", "patch-human-fix"}, ids)
+	varied, err := withPatches.ExpandPromptVariants(2)
+	require.NoError(t, err)
+	assert.Equal(t, "patch-human-fix", varied.Agents[len(varied.Agents)-1].ID)
+
+	_, err = withPatches.WithPatchFiles([]string{file})
+	assert.ErrorContains(t, err, "would be agent 'patch-human-fix', which is already configured")
+	_, err = cfg.WithPatchFiles([]string{filepath.Join(dir, "missing.patch")})
+	assert.ErrorContains(t, err, "patch file")
+}
+
+func TestPatchAgentID(t *testing.T) {
+	assert.Equal(t, "patch-fix", PatchAgentID("fixes/fix.patch"))
+	assert.Equal(t, "patch-claude-2", PatchAgentID("claude#2.diff"))
+	assert.Equal(t, "patch-claude-terse", PatchAgentID("claude@terse.patch"))
+}
+
+func TestValidatePatchAgents(t *testing.T) {
+	patchAgent := AgentConfig{ID: "human", Type: PatchAgentType, Config: map[string]interface{}{"file": "fix.patch"}}
+	agents := []AgentConfig{{ID: "claude", Type: "claude"}, patchAgent}
+
+	tests := []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{name: "valid", cfg: &Config{Agents: agents}},
+		{name: "missing file", cfg: &Config{Agents: []AgentConfig{{ID: "human", Type: PatchAgentType}}}, want: "patch agent 'human' is missing config.file"},
+		{name: "in a pipeline", cfg: &Config{Agents: agents, Pipelines: []PipelineConfig{{Fixer: "human", Reviewer: "claude"}}}, want: "pipeline fixer 'human' is a patch agent"},
+		{name: "test author", cfg: &Config{Agents: agents, TDD: TDDConfig{TestAuthor: "human"}}, want: "tdd.test_author 'human' is a patch agent"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.WorkingDir = t.TempDir()
+			err := validateConfig(tc.cfg)
+			if tc.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// Actions taken on a patch that changes files the path policy doesn't permit
+const (
+	// PathsStrip reverts the changes to those files and evaluates the rest of the patch, which is the default
+	PathsStrip = "strip"
+
+	// PathsDisqualify reverts the whole patch, so the agent is ranked as having produced nothing
+	PathsDisqualify = "disqualify"
+)
+
+// PathPolicy limits the files agents may change, such as keeping them away from secrets, infrastructure,
+// or other services in a monorepo. It is enforced on each agent's worktree before its patch is evaluated
+type PathPolicy struct {
+	// Allow lists glob patterns for the only files patches may change (empty permits every file not denied)
+	Allow []string `yaml:"allow,omitempty"`
+
+	// Deny lists glob patterns for files patches may not change, e.g. ".env*", "infra/", or "services/billing/**"
+	Deny []string `yaml:"deny,omitempty"`
+
+	// OnViolation is strip or disqualify (defaults to strip)
+	OnViolation string `yaml:"on_violation,omitempty"`
+
+	// scope is the subtree the run is confined to, set with Config.SetScope; files outside it aren't permitted
+	scope string
+}
+
+// Enabled reports whether the policy restricts any files
+func (p PathPolicy) Enabled() bool {
+	return len(p.Allow) > 0 || len(p.Deny) > 0 || p.scope != ""
+}
+
+// Action returns what is done to a patch that breaks the policy
+func (p PathPolicy) Action() string {
+	if p.OnViolation == "" {
+		return PathsStrip
+	}
+	return p.OnViolation
+}
+
+// Permits reports whether patches may change the file at the given path
+func (p PathPolicy) Permits(file string) bool {
+	if !InScope(file, p.scope) || gitutil.MatchesAnyPattern(file, p.Deny) {
+		return false
+	}
+	return len(p.Allow) == 0 || gitutil.MatchesAnyPattern(file, p.Allow)
+}
+
+// Violations returns the files a diff changes that the policy doesn't permit, in diff order
+// A rename breaks the policy if either of its paths does
+func (p PathPolicy) Violations(diff string) []string {
+	if !p.Enabled() {
+		return nil
+	}
+	var violations []string
+	for _, file := range gitutil.SplitDiff(diff) {
+		for _, changed := range filePaths(file) {
+			if !p.Permits(changed) {
+				violations = append(violations, changed)
+			}
+		}
+	}
+	return violations
+}
+
+// Enforce reverts the changes diff makes in the worktree to files the policy doesn't permit, or every change
+// if it disqualifies such patches. It returns the files that broke the policy, and the caller re-reads the diff
+// base is the commit the worktree started from
+func (p PathPolicy) Enforce(worktreePath, base, diff string) ([]string, error) {
+	violations := p.Violations(diff)
+	if len(violations) == 0 {
+		return nil, nil
+	}
+
+	var revert []string
+	for _, file := range gitutil.SplitDiff(diff) {
+		paths := filePaths(file)
+		broken := p.Action() == PathsDisqualify
+		for _, changed := range paths {
+			broken = broken || !p.Permits(changed)
+		}
+		// Both sides of a rename are reverted, so the old file isn't left deleted
+		if broken {
+			revert = append(revert, paths...)
+		}
+	}
+	if err := gitutil.RevertPaths(worktreePath, base, revert); err != nil {
+		return nil, fmt.Errorf("failed to revert changes the path policy doesn't permit: %w", err)
+	}
+	return violations, nil
+}
+
+// ViolationMessage describes the files a patch changed that the policy doesn't permit
+func ViolationMessage(violations []string) string {
+	return "changed files outside the path policy: " + strings.Join(violations, ", ")
+}
+
+// filePaths returns the paths a file patch touches, once each
+func filePaths(file gitutil.FilePatch) []string {
+	if file.OldPath == "" || file.OldPath == file.Path {
+		return []string{file.Path}
+	}
+	return []string{file.OldPath, file.Path}
+}
+
+// validate checks the action and patterns of the policy
+func (p PathPolicy) validate() error {
+	switch p.OnViolation {
+	case "", PathsStrip, PathsDisqualify:
+	default:
+		err := fieldError("paths.on_violation", "paths.on_violation must be strip or disqualify, not '%s'", p.OnViolation)
+		err.Suggestion = suggest(p.OnViolation, []string{PathsStrip, PathsDisqualify})
+		return err
+	}
+	for _, list := range []struct {
+		field    string
+		patterns []string
+	}{{"paths.allow", p.Allow}, {"paths.deny", p.Deny}} {
+		for i, pattern := range list.patterns {
+			if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+				return fieldError(fmt.Sprintf("%s[%d]", list.field, i), "%s[%d] must be a glob pattern, not '%s'", list.field, i, pattern)
+			}
+		}
+	}
+	return nil
+}
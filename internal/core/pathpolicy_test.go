@@ -0,0 +1,49 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const pathPolicyDiff = `diff --git a/services/api/handler.go b/services/api/handler.go
+index 1111111..2222222 100644
+--- a/services/api/handler.go
++++ b/services/api/handler.go
+@@ -1 +1 @@
+-package old
++package api
+diff --git a/.env.production b/.env.production
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/.env.production
+@@ -0,0 +1 @@
++API_KEY=changed
+diff --git a/services/api/util.go b/services/billing/util.go
+similarity index 100%
+rename from services/api/util.go
+rename to services/billing/util.go
+`
+
+func TestPathPolicyViolations(t *testing.T) {
+	assert.Empty(t, PathPolicy{}.Violations(pathPolicyDiff), "An empty policy permits everything")
+
+	deny := PathPolicy{Deny: []string{".env*", "services/billing/"}}
+	assert.True(t, deny.Permits("services/api/handler.go"))
+	assert.False(t, deny.Permits("config/.env"), "Patterns without a slash match the base name anywhere")
+	assert.Equal(t, []string{".env.production", "services/billing/util.go"}, deny.Violations(pathPolicyDiff))
+
+	// Files outside the allowed paths break the policy, and a rename breaks it if either side does
+	allow := PathPolicy{Allow: []string{"services/api/"}}
+	assert.Equal(t, []string{".env.production", "services/billing/util.go"}, allow.Violations(pathPolicyDiff))
+
+	both := PathPolicy{Allow: []string{"services/"}, Deny: []string{"services/api/util.go"}}
+	assert.Equal(t, []string{".env.production", "services/api/util.go"}, both.Violations(pathPolicyDiff))
+}
+
+func TestPathPolicyAction(t *testing.T) {
+	assert.Equal(t, PathsStrip, PathPolicy{Deny: []string{"infra/"}}.Action())
+	assert.Equal(t, PathsDisqualify, PathPolicy{Deny: []string{"infra/"}, OnViolation: PathsDisqualify}.Action())
+	assert.Equal(t, "changed files outside the path policy: a.go, b.go", ViolationMessage([]string{"a.go", "b.go"}))
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// MaxReviewBytes is the most of a fixer's transcript, and of a reviewer's feedback, that a prompt includes
+// The end is kept, since that's where agents conclude
+const MaxReviewBytes = 32 * 1024
+
+// ReviewApproved is what a reviewer says, on a line of its own, when a patch needs no revision
+const ReviewApproved = "APPROVED"
+
+// PipelineConfig has one agent's patch reviewed by another before it is judged
+// The fixer works on the task as usual; the reviewer gets its diff and transcript and writes a review, which the
+// fixer revises its patch with. Only the fixer's final patch enters arbitration: a reviewer is never a candidate
+type PipelineConfig struct {
+	// Fixer is the ID of the agent whose patch is reviewed
+	Fixer string `yaml:"fixer"`
+
+	// Reviewer is the ID of the agent reviewing it
+	Reviewer string `yaml:"reviewer"`
+
+	// Rounds is how many times the patch is reviewed and revised (0 for once)
+	// A reviewer approving the patch ends the pipeline early
+	Rounds int `yaml:"rounds,omitempty"`
+}
+
+// ReviewRounds returns how many times the pipeline's patch is reviewed at most
+func (p PipelineConfig) ReviewRounds() int {
+	return max(p.Rounds, 1)
+}
+
+// validatePipelines checks that each pipeline names two configured agents, and that no agent is in two pipelines
+func validatePipelines(pipelines []PipelineConfig, agents []AgentConfig) error {
+	types := make(map[string]string, len(agents))
+	for _, agent := range agents {
+		types[agent.ID] = agent.Type
+	}
+
+	used := make(map[string]bool)
+	for i, pipeline := range pipelines {
+		field := fmt.Sprintf("pipelines[%d]", i)
+		for _, role := range []struct{ name, id string }{{"fixer", pipeline.Fixer}, {"reviewer", pipeline.Reviewer}} {
+			agentType, configured := types[role.id]
+			switch {
+			case role.id == "":
+				return fieldError(field+"."+role.name, "pipeline at index %d is missing its %s", i, role.name)
+			case !configured:
+				return fieldError(field+"."+role.name, "pipeline %s '%s' is not a configured agent", role.name, role.id)
+			case agentType == PatchAgentType:
+				return fieldError(field+"."+role.name, "pipeline %s '%s' is a patch agent, which only submits its patch file", role.name, role.id)
+			case used[role.id]:
+				return fieldError(field+"."+role.name, "agent '%s' is in more than one pipeline, or both roles of one", role.id)
+			}
+			used[role.id] = true
+		}
+		if pipeline.Rounds < 0 {
+			return fieldError(field+".rounds", "pipeline rounds must not be negative")
+		}
+	}
+	return nil
+}
+
+// ActivePipelines returns the pipelines both of whose agents are among those running
+func (c *Config) ActivePipelines() []PipelineConfig {
+	running := make(map[string]bool, len(c.Agents))
+	for _, agent := range c.Agents {
+		running[agent.ID] = true
+	}
+
+	var active []PipelineConfig
+	for _, pipeline := range c.Pipelines {
+		if running[pipeline.Fixer] && running[pipeline.Reviewer] {
+			active = append(active, pipeline)
+		}
+	}
+	return active
+}
+
+// AwaitsReview reports whether an agent is the fixer of an active pipeline, whose patch is reviewed and may be
+// revised before it is judged
+func (c *Config) AwaitsReview(agentID string) bool {
+	for _, pipeline := range c.ActivePipelines() {
+		if pipeline.Fixer == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// namedByRole reports whether a pipeline or the test author setting names an agent, which then runs once under
+// its own ID
+func (c *Config) namedByRole(agentID string) bool {
+	return c.inPipeline(agentID) || agentID == c.TDD.TestAuthor
+}
+
+// inPipeline reports whether an agent is a fixer or reviewer of a pipeline
+func (c *Config) inPipeline(agentID string) bool {
+	for _, pipeline := range c.Pipelines {
+		if pipeline.Fixer == agentID || pipeline.Reviewer == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// ReviewPrompt asks a reviewer to review a fixer's patch, which is applied in the reviewer's worktree
+func ReviewPrompt(prompt, fixerID, diff string, fixerEvents []*protocol.Event) string {
+	var sb strings.Builder
+	sb.WriteString("Review another agent's changes for this task. They are applied in your working tree. ")
+	sb.WriteString("Don't change any files: write a review pointing out bugs, missed cases, and anything that ")
+	sb.WriteString("doesn't do what the task asks, with how to fix it. If the changes need no revision, end your ")
+	sb.WriteString(fmt.Sprintf("review with %s on a line of its own.\n", ReviewApproved))
+	sb.WriteString(fmt.Sprintf("\nThe task:\n\n%s\n", strings.TrimRight(prompt, "\n")))
+	sb.WriteString(fmt.Sprintf("\nThe changes:\n```diff\n%s\n```\n", strings.TrimRight(diff, "\n")))
+	transcript := lastBytes(TranscriptMarkdown(fixerID, fixerEvents), MaxReviewBytes)
+	sb.WriteString(fmt.Sprintf("\nHow the agent worked on them:\n\n%s\n", strings.TrimRight(transcript, "\n")))
+	return sb.String()
+}
+
+// RevisionPrompt asks a fixer to revise its patch, which is still in its worktree, with a reviewer's review
+func RevisionPrompt(prompt, review, diff string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimRight(prompt, "\n"))
+	sb.WriteString("\n\nA reviewer has reviewed your changes for this task. They are still in your working tree; ")
+	sb.WriteString("revise them to address the review.\n")
+	sb.WriteString(fmt.Sprintf("\nThe review:\n\n%s\n", strings.TrimRight(review, "\n")))
+	sb.WriteString(fmt.Sprintf("\nYour previous changes:\n```diff\n%s\n```\n", strings.TrimRight(diff, "\n")))
+	return sb.String()
+}
+
+// ReviewFeedback collects a reviewer's latest review from its events: what it wrote as it thought since it was last
+// prompted. It reports whether the reviewer approved the patch as it is
+func ReviewFeedback(events []*protocol.Event) (string, bool) {
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Type == protocol.EventTypePrompt {
+			events = events[i+1:]
+			break
+		}
+	}
+
+	var parts []string
+	for _, event := range events {
+		if event.Type != protocol.EventTypeThinking {
+			continue
+		}
+		if payload, err := event.UnmarshalThinkingPayload(); err == nil && strings.TrimSpace(payload.Content) != "" {
+			parts = append(parts, strings.TrimSpace(payload.Content))
+		}
+	}
+	review := lastBytes(strings.Join(parts, "\n\n"), MaxReviewBytes)
+
+	approved := false
+	for _, line := range strings.Split(review, "\n") {
+		if strings.TrimSpace(line) == ReviewApproved {
+			approved = true
+		}
+	}
+	return review, approved
+}
+
+// lastBytes keeps about the last n bytes of text, starting at a line, and says what was left out
+func lastBytes(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	kept := text[len(text)-n:]
+	if i := strings.IndexByte(kept, '\n'); i >= 0 {
+		kept = kept[i+1:]
+	}
+	return fmt.Sprintf("[%d earlier bytes left out]\n%s", len(text)-len(kept), kept)
+}
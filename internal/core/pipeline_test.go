@@ -0,0 +1,94 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePipelines(t *testing.T) {
+	agents := []AgentConfig{{ID: "claude"}, {ID: "codex"}, {ID: "amp"}}
+
+	tests := []struct {
+		name      string
+		pipelines []PipelineConfig
+		field     string
+	}{
+		{"valid", []PipelineConfig{{Fixer: "claude", Reviewer: "codex", Rounds: 2}}, ""},
+		{"missing reviewer", []PipelineConfig{{Fixer: "claude"}}, "pipelines[0].reviewer"},
+		{"unknown fixer", []PipelineConfig{{Fixer: "gemini", Reviewer: "codex"}}, "pipelines[0].fixer"},
+		{"reviewing itself", []PipelineConfig{{Fixer: "claude", Reviewer: "claude"}}, "pipelines[0].reviewer"},
+		{"shared reviewer", []PipelineConfig{{Fixer: "claude", Reviewer: "codex"}, {Fixer: "amp", Reviewer: "codex"}}, "pipelines[1].reviewer"},
+		{"negative rounds", []PipelineConfig{{Fixer: "claude", Reviewer: "codex", Rounds: -1}}, "pipelines[0].rounds"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePipelines(tc.pipelines, agents)
+			if tc.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var configErr *ConfigError
+			require.ErrorAs(t, err, &configErr)
+			assert.Equal(t, tc.field, configErr.Field)
+		})
+	}
+
+	// Pipelines whose agents aren't running are left out, and pipeline agents make one attempt
+	cfg := &Config{Agents: agents, Samples: 2, Pipelines: []PipelineConfig{{Fixer: "claude", Reviewer: "codex"}, {Fixer: "amp", Reviewer: "gemini"}}}
+	assert.Equal(t, []PipelineConfig{{Fixer: "claude", Reviewer: "codex"}}, cfg.ActivePipelines())
+	expanded, err := cfg.ExpandSamples(0)
+	require.NoError(t, err)
+	ids := make([]string, len(expanded.Agents))
+	for i, agent := range expanded.Agents {
+		ids[i] = agent.ID
+	}
+	assert.Equal(t, []string{"claude", "codex", "amp"}, ids)
+}
+
+func TestReviewPrompts(t *testing.T) {
+	event := func(eventType protocol.EventType, payload interface{}) *protocol.Event {
+		e, err := protocol.NewEvent(eventType, "codex", 1).WithPayload(payload)
+		require.NoError(t, err)
+		return e
+	}
+	diff := "diff --git a/f.go b/f.go\n-return 1\n+return 3\n"
+
+	fixerEvents := []*protocol.Event{event(protocol.EventTypeAction, protocol.ActionPayload{ActionType: "edit", FilePath: "f.go"})}
+	review := ReviewPrompt("Fix F", "claude", diff, fixerEvents)
+	assert.Contains(t, review, "The task:\n\nFix F\n")
+	assert.Contains(t, review, "```diff\n"+strings.TrimRight(diff, "\n")+"\n```")
+	assert.Contains(t, review, "# Transcript of claude")
+	assert.Contains(t, review, ReviewApproved)
+
+	// Only what the reviewer wrote since its latest prompt is its review
+	events := []*protocol.Event{
+		event(protocol.EventTypePrompt, protocol.PromptPayload{Prompt: "Review the first patch"}),
+		event(protocol.EventTypeThinking, protocol.ThinkingPayload{Content: "An earlier review"}),
+		event(protocol.EventTypePrompt, protocol.PromptPayload{Prompt: "Review the revised patch"}),
+		event(protocol.EventTypeThinking, protocol.ThinkingPayload{Content: "F returns 3, but the test wants 2."}),
+		event(protocol.EventTypeError, protocol.ErrorPayload{Message: "Failed to parse output"}),
+		event(protocol.EventTypeThinking, protocol.ThinkingPayload{Content: "Return 2 instead."}),
+	}
+	feedback, approved := ReviewFeedback(events)
+	assert.Equal(t, "F returns 3, but the test wants 2.\n\nReturn 2 instead.", feedback)
+	assert.False(t, approved)
+
+	revision := RevisionPrompt("Fix F", feedback, diff)
+	assert.True(t, strings.HasPrefix(revision, "Fix F\n\nA reviewer has reviewed your changes"))
+	assert.Contains(t, revision, "The review:\n\n"+feedback+"\n")
+
+	_, approved = ReviewFeedback(append(events, event(protocol.EventTypeThinking, protocol.ThinkingPayload{Content: "Looks right.\nAPPROVED"})))
+	assert.True(t, approved)
+
+	// Long transcripts and reviews keep their end
+	long := strings.Repeat("earlier line\n", MaxReviewBytes/10) + "the conclusion"
+	kept := lastBytes(long, MaxReviewBytes)
+	assert.LessOrEqual(t, len(kept), MaxReviewBytes+64)
+	assert.True(t, strings.HasPrefix(kept, "["))
+	assert.True(t, strings.HasSuffix(kept, "the conclusion"))
+}
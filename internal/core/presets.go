@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Presets are built-in configurations for common stacks, selected with "preset: <name>"
+// Each sets the test command, how its output is read, files kept out of diff stats and scoring, and limits
+// that suit the stack's builds. A preset is merged beneath the configuration, so anything set there wins
+var Presets = map[string]string{
+	"go": `
+test_command: "go test ./..."
+test_parser: go
+diff_ignore: ["go.sum", "vendor/"]
+`,
+	"node": `
+test_command: "npx jest --ci"
+test_parser: jest
+timeout_seconds: 600
+diff_ignore: ["package-lock.json", "yarn.lock", "pnpm-lock.yaml", "node_modules/", "dist/", "coverage/"]
+limits:
+  max_disk_mb: 4096
+`,
+	"python": `
+test_command: "pytest"
+test_parser: pytest
+timeout_seconds: 600
+diff_ignore: ["poetry.lock", "uv.lock", "Pipfile.lock", "__pycache__/", "*.pyc", ".pytest_cache/", ".venv/"]
+limits:
+  max_disk_mb: 2048
+`,
+	"rust": `
+test_command: "cargo test"
+test_parser: cargo
+timeout_seconds: 1200
+diff_ignore: ["Cargo.lock", "target/"]
+limits:
+  max_disk_mb: 8192
+`,
+}
+
+// PresetNames returns the names of the built-in presets, sorted
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset merges the preset a configuration names beneath it
+func applyPreset(root *yaml.Node) (*yaml.Node, error) {
+	preset := mappingValue(documentRoot(root), "preset")
+	if preset == nil {
+		return root, nil
+	}
+
+	text, ok := Presets[preset.Value]
+	if !ok {
+		return nil, &ConfigError{
+			Field:      "preset",
+			Line:       preset.Line,
+			Column:     preset.Column,
+			Message:    fmt.Sprintf("unknown preset '%s', built-in presets are: %s", preset.Value, strings.Join(PresetNames(), ", ")),
+			Suggestion: suggest(preset.Value, PresetNames()),
+		}
+	}
+	base, err := parseNode([]byte(text), FormatYAML)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing preset %s: %w", preset.Value, err)
+	}
+	return mergeNodes(base, root), nil
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_Preset(t *testing.T) {
+	// Presets come from an included file too, and the config's own settings win
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `include: [base.yaml]
+working_dir: "/tmp/test-dir"
+test_command: "npm test"
+limits:
+  max_tokens: 1000
+agents:
+  - id: "claude"
+    type: "cli"
+`,
+		"base.yaml": `preset: node
+`,
+	})
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "node", cfg.Preset)
+	assert.Equal(t, "npm test", cfg.TestCommand)
+	assert.Equal(t, TestParserJest, cfg.TestParser)
+	assert.Equal(t, 600, cfg.TimeoutSeconds)
+	assert.Contains(t, cfg.DiffIgnore, "package-lock.json")
+	assert.Equal(t, int64(4096), cfg.Limits.MaxDiskMB)
+	assert.Equal(t, 1000, cfg.Limits.MaxTokens)
+
+	// Every preset makes a valid configuration
+	for _, name := range PresetNames() {
+		dir := writeConfigFiles(t, map[string]string{
+			"config.yaml": "preset: " + name + "\nworking_dir: /tmp/test-dir\nagents:\n  - id: claude\n    type: cli\n",
+		})
+		cfg, err := Load(filepath.Join(dir, "config.yaml"))
+		require.NoError(t, err, name)
+		assert.NotEmpty(t, cfg.TestCommand, name)
+		assert.Contains(t, TestParsers, cfg.TestParser, name)
+	}
+
+	dir = writeConfigFiles(t, map[string]string{
+		"config.yaml": "preset: pyton\nworking_dir: /tmp/test-dir\nagents:\n  - id: claude\n    type: cli\n",
+	})
+	_, err = Load(filepath.Join(dir, "config.yaml"))
+	var configErr *ConfigError
+	require.ErrorAs(t, err, &configErr)
+	assert.Equal(t, "preset", configErr.Field)
+	assert.Equal(t, 1, configErr.Line)
+	assert.Equal(t, "python", configErr.Suggestion)
+}
@@ -0,0 +1,331 @@
+package core
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+)
+
+// EncryptedPrompt stands in for the prompt in run files that aren't encrypted, such as the report and checkpoint,
+// when prompts are encrypted at rest
+const EncryptedPrompt = "[ENCRYPTED]"
+
+// encryptedPrefix starts each line of an encrypted file, followed by the version of its format
+const encryptedPrefix = "orchestrator-encrypted:"
+
+// An encrypted file starts with a header holding the base64 of the salt its key is derived with and a random file ID.
+// Each line after it is a record holding the base64 of its nonce and ciphertext, sealed with the file ID and its
+// sequence number, so records can't be moved between files, dropped, or reordered. The last record is an empty one
+// ending the file, so a file cut short is told apart from a finished one. Records are sealed one at a time, so files
+// such as transcripts can be appended to as they are written
+const (
+	encryptedHeader = encryptedPrefix + "v2:file:"
+	encryptedRecord = encryptedPrefix + "v2:"
+	encryptedEnd    = encryptedPrefix + "v2:end:"
+)
+
+// Keys are derived from the encryption key with PBKDF2-HMAC-SHA256, salted per cipher
+const (
+	kdfIterations = 600000
+	saltSize      = 16
+	fileIDSize    = 16
+
+	// maxCachedKeys is how many derived keys a cipher keeps, besides the one it writes with, so a long-running
+	// server reading files from many runs doesn't keep them all
+	maxCachedKeys = 16
+)
+
+// ErrEncrypted is returned when reading an encrypted file without the encryption key
+var ErrEncrypted = errors.New("file is encrypted; set privacy.encryption_key to the key it was written with")
+
+// ErrUnfinished is returned, with what the file holds so far, when reading an encrypted file that has no end record
+var ErrUnfinished = errors.New("encrypted file is unfinished; it is still being written, or was cut short by a crash")
+
+// PrivacyConfig controls what of a run's prompts and transcripts, which may hold proprietary context, is stored
+type PrivacyConfig struct {
+	// Scrub lists regular expressions whose matches are replaced with [REDACTED] in everything a run stores,
+	// the same as secrets, e.g. "(?i)project falcon" or "ACME-[0-9]+"
+	Scrub []string `yaml:"scrub,omitempty"`
+
+	// EncryptionKey encrypts the prompt and transcripts of each run at rest; it must be a secret:// reference,
+	// so the key isn't stored alongside what it encrypts in the run's config snapshot
+	EncryptionKey string `yaml:"encryption_key,omitempty"`
+}
+
+// Encrypted reports whether prompts and transcripts are encrypted at rest
+func (p PrivacyConfig) Encrypted() bool {
+	return p.EncryptionKey != ""
+}
+
+// validate checks the scrub patterns compile and the encryption key was given as a secret reference
+// secrets are the resolved secret values of the configuration
+func (p PrivacyConfig) validate(secrets []string) error {
+	for i, pattern := range p.Scrub {
+		if _, err := regexp.Compile(pattern); err != nil || pattern == "" {
+			return fieldError(fmt.Sprintf("privacy.scrub[%d]", i), "privacy.scrub[%d] must be a regular expression, not '%s'", i, pattern)
+		}
+	}
+	if p.Encrypted() && !slices.Contains(secrets, p.EncryptionKey) {
+		return fieldError("privacy.encryption_key", "privacy.encryption_key must be a secret reference such as %senv:NAME", SecretScheme)
+	}
+	return nil
+}
+
+// scrubbers compiles the scrub patterns, which validate has checked
+func (p PrivacyConfig) scrubbers() []*regexp.Regexp {
+	var scrubbers []*regexp.Regexp
+	for _, pattern := range p.Scrub {
+		scrubbers = append(scrubbers, regexp.MustCompile(pattern))
+	}
+	return scrubbers
+}
+
+// Cipher encrypts and decrypts run files with AES-256-GCM
+type Cipher struct {
+	key string
+
+	mutex sync.Mutex
+
+	// salt is what the keys of the files the cipher writes are derived with, chosen when the first one is written
+	salt []byte
+
+	// aeads holds the AES-256-GCM of the key derived with each salt, since deriving one is deliberately slow
+	aeads map[string]cipher.AEAD
+
+	// cached lists the salts in aeads, least recently used first
+	cached []string
+}
+
+// NewCipher returns a cipher whose keys are derived from the given encryption key
+func NewCipher(key string) *Cipher {
+	return &Cipher{key: key, aeads: make(map[string]cipher.AEAD)}
+}
+
+// Cipher returns the cipher for the configured encryption key, or nil if prompts and transcripts aren't encrypted
+// The cipher made when the configuration was loaded is reused, so its derived keys are too
+func (c *Config) Cipher() *Cipher {
+	if !c.Privacy.Encrypted() {
+		return nil
+	}
+	if c.cipher != nil && c.cipher.key == c.Privacy.EncryptionKey {
+		return c.cipher
+	}
+	return NewCipher(c.Privacy.EncryptionKey)
+}
+
+// StoredPrompt returns the prompt as it is stored in run files that aren't encrypted
+func (c *Config) StoredPrompt(prompt string) string {
+	if c.Privacy.Encrypted() && prompt != "" {
+		return EncryptedPrompt
+	}
+	return prompt
+}
+
+// aead returns the AES-256-GCM of the key derived with salt
+func (c *Cipher) aead(salt []byte) cipher.AEAD {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if aead, ok := c.aeads[string(salt)]; ok {
+		c.cache(salt, aead)
+		return aead
+	}
+	// A 32-byte key always makes a valid AES-256 block cipher
+	block, _ := aes.NewCipher(pbkdf2SHA256([]byte(c.key), salt, kdfIterations))
+	aead, _ := cipher.NewGCM(block)
+	c.cache(salt, aead)
+	return aead
+}
+
+// cache keeps the AES-256-GCM of salt as the most recently used, evicting the least recently used key past
+// maxCachedKeys other than the one the cipher writes with
+// The caller holds the mutex
+func (c *Cipher) cache(salt []byte, aead cipher.AEAD) {
+	c.cached = slices.DeleteFunc(c.cached, func(cached string) bool { return cached == string(salt) })
+	c.cached = append(c.cached, string(salt))
+	c.aeads[string(salt)] = aead
+	for i := 0; len(c.aeads) > maxCachedKeys+1 && i < len(c.cached); {
+		if c.cached[i] == string(c.salt) {
+			i++
+			continue
+		}
+		delete(c.aeads, c.cached[i])
+		c.cached = slices.Delete(c.cached, i, i+1)
+	}
+}
+
+// NewSealer starts an encrypted file, returning the sealer of its records and the header line it begins with
+func (c *Cipher) NewSealer() (*Sealer, []byte, error) {
+	c.mutex.Lock()
+	if c.salt == nil {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			c.mutex.Unlock()
+			return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		c.salt = salt
+	}
+	salt := c.salt
+	c.mutex.Unlock()
+
+	fileID := make([]byte, fileIDSize)
+	if _, err := rand.Read(fileID); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate file ID: %w", err)
+	}
+	header := encryptedHeader + base64.StdEncoding.EncodeToString(append(append([]byte(nil), salt...), fileID...)) + "\n"
+	return &Sealer{aead: c.aead(salt), fileID: fileID}, []byte(header), nil
+}
+
+// Encrypt returns data encrypted as a whole file: its header, one record, and the record ending it
+func (c *Cipher) Encrypt(data []byte) ([]byte, error) {
+	sealer, header, err := c.NewSealer()
+	if err != nil {
+		return nil, err
+	}
+	record, err := sealer.Seal(data)
+	if err != nil {
+		return nil, err
+	}
+	end, err := sealer.End()
+	if err != nil {
+		return nil, err
+	}
+	return append(append(header, record...), end...), nil
+}
+
+// Decrypt returns the plaintext of an encrypted file, or data itself if it isn't encrypted
+// A file without its end record returns what it holds so far with ErrUnfinished. A nil cipher can only read files
+// that aren't encrypted
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	if c == nil {
+		return nil, ErrEncrypted
+	}
+	// Every line ends in a newline, so a last line without one was cut short by a crash while it was written
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	lines := bytes.Split(data, []byte("\n"))
+	lines = lines[:len(lines)-1]
+
+	corrupt := errors.New("encrypted file is corrupt")
+	if len(lines) == 0 {
+		return nil, ErrUnfinished
+	}
+	header, ok := bytes.CutPrefix(lines[0], []byte(encryptedHeader))
+	decoded, err := base64.StdEncoding.DecodeString(string(header))
+	if !ok || err != nil || len(decoded) != saltSize+fileIDSize {
+		return nil, corrupt
+	}
+	salt, fileID := decoded[:saltSize], decoded[saltSize:]
+	aead := c.aead(salt)
+
+	var plaintext []byte
+	for i, line := range lines[1:] {
+		// Base64 has no colons, so an end record never looks like another record
+		payload, end := bytes.CutPrefix(line, []byte(encryptedEnd))
+		if !end {
+			if payload, ok = bytes.CutPrefix(line, []byte(encryptedRecord)); !ok {
+				return nil, corrupt
+			}
+		}
+		sealed, err := base64.StdEncoding.DecodeString(string(payload))
+		if err != nil || len(sealed) < aead.NonceSize() {
+			return nil, corrupt
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if plaintext, err = aead.Open(plaintext, nonce, ciphertext, recordData(fileID, uint64(i), end)); err != nil {
+			return nil, errors.New("failed to decrypt file; it was written with a different encryption key, or is corrupt")
+		}
+		if end {
+			if i != len(lines)-2 {
+				return nil, corrupt
+			}
+			return plaintext, nil
+		}
+	}
+	return plaintext, ErrUnfinished
+}
+
+// Sealer encrypts the records of one file in order, binding each to the file and its place in it
+type Sealer struct {
+	aead   cipher.AEAD
+	fileID []byte
+
+	// seq is the sequence number of the next record
+	seq uint64
+}
+
+// Seal returns the next record of the file, holding data, as a line of text
+func (s *Sealer) Seal(data []byte) ([]byte, error) {
+	return s.seal(encryptedRecord, data, false)
+}
+
+// End returns the record ending the file, after which nothing is sealed
+func (s *Sealer) End() ([]byte, error) {
+	return s.seal(encryptedEnd, nil, true)
+}
+
+// seal encrypts a record under a fresh nonce
+func (s *Sealer) seal(prefix string, data []byte, end bool) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, data, recordData(s.fileID, s.seq, end))
+	s.seq++
+	return []byte(prefix + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// recordData is the additional data a record is sealed with: its file's ID, its sequence number, and whether it
+// ends the file
+func recordData(fileID []byte, seq uint64, end bool) []byte {
+	data := binary.BigEndian.AppendUint64(append([]byte(nil), fileID...), seq)
+	if end {
+		return append(data, 1)
+	}
+	return append(data, 0)
+}
+
+// pbkdf2SHA256 derives a 32-byte key from a password with PBKDF2-HMAC-SHA256 (RFC 8018), which takes only one block
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, password)
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// IsEncrypted reports whether the content of a file was written by Cipher.Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedPrefix))
+}
+
+// readRunFile reads a run file, decrypting it if it is encrypted
+func readRunFile(path string, c *Cipher) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decrypt(data)
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipher(t *testing.T) {
+	c := NewCipher("correct horse")
+	sealed, err := c.Encrypt([]byte("Fix the Falcon login bug\n"))
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(sealed))
+	assert.NotContains(t, string(sealed), "Falcon")
+
+	again, err := c.Encrypt([]byte("Fix the Falcon login bug\n"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "Each encryption uses a fresh nonce")
+
+	plain, err := c.Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "Fix the Falcon login bug\n", string(plain))
+
+	// Files that aren't encrypted read as they are, with or without a key
+	plain, err = c.Decrypt([]byte("plain text\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "plain text\n", string(plain))
+	plain, err = (*Cipher)(nil).Decrypt([]byte("plain text\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "plain text\n", string(plain))
+
+	// Encrypted files need the key they were written with
+	_, err = (*Cipher)(nil).Decrypt(sealed)
+	assert.ErrorIs(t, err, ErrEncrypted)
+	_, err = NewCipher("wrong key").Decrypt(sealed)
+	assert.Error(t, err)
+	_, err = c.Decrypt(append(sealed[:len(sealed)-8:len(sealed)-8], []byte("AAAAAAA\n")...))
+	assert.Error(t, err, "Tampered files are rejected")
+
+	// Another cipher with the same key reads the file, though it derives its keys with its own salt
+	plain, err = NewCipher("correct horse").Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "Fix the Falcon login bug\n", string(plain))
+}
+
+func TestCipherRecords(t *testing.T) {
+	c := NewCipher("correct horse")
+	seal := func() [][]byte {
+		sealer, header, err := c.NewSealer()
+		require.NoError(t, err)
+		lines := [][]byte{header}
+		for _, record := range []string{"one\n", "two\n", "three\n"} {
+			line, err := sealer.Seal([]byte(record))
+			require.NoError(t, err)
+			lines = append(lines, line)
+		}
+		end, err := sealer.End()
+		require.NoError(t, err)
+		return append(lines, end)
+	}
+	lines, other := seal(), seal()
+	file := func(lines ...[]byte) []byte {
+		return bytes.Join(lines, nil)
+	}
+
+	plain, err := c.Decrypt(file(lines...))
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\nthree\n", string(plain))
+
+	// Records that are dropped, reordered, or taken from another file don't decrypt
+	_, err = c.Decrypt(file(lines[0], lines[1], lines[3], lines[4]))
+	assert.Error(t, err, "A dropped record is detected")
+	_, err = c.Decrypt(file(lines[0], lines[2], lines[1], lines[3], lines[4]))
+	assert.Error(t, err, "Reordered records are detected")
+	_, err = c.Decrypt(file(lines[0], lines[1], other[2], lines[3], lines[4]))
+	assert.Error(t, err, "A record from another file is detected")
+	_, err = c.Decrypt(file(lines[0], lines[1], lines[4], lines[2]))
+	assert.Error(t, err, "Records after the end are detected")
+
+	// A file cut short reads as far as it goes, but is unfinished
+	plain, err = c.Decrypt(file(lines[0], lines[1], lines[2]))
+	assert.ErrorIs(t, err, ErrUnfinished)
+	assert.Equal(t, "one\ntwo\n", string(plain))
+	plain, err = c.Decrypt(file(lines[:4]...))
+	assert.ErrorIs(t, err, ErrUnfinished)
+	assert.Equal(t, "one\ntwo\nthree\n", string(plain))
+}
+
+func TestCipherKeyCache(t *testing.T) {
+	c := NewCipher("correct horse")
+	c.salt = []byte("write salt")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Keys are cached as they are used, so what a server reads doesn't pile up, and the write key is never evicted
+	c.cache(c.salt, nil)
+	for i := range maxCachedKeys + 5 {
+		c.cache([]byte(fmt.Sprintf("salt %d", i)), nil)
+	}
+	assert.Len(t, c.aeads, maxCachedKeys+1)
+	assert.Contains(t, c.aeads, "write salt")
+	assert.NotContains(t, c.aeads, "salt 4")
+	assert.Contains(t, c.aeads, "salt 5")
+
+	// Using a key again keeps it
+	c.cache([]byte("salt 5"), nil)
+	c.cache([]byte("another salt"), nil)
+	assert.Contains(t, c.aeads, "salt 5")
+	assert.NotContains(t, c.aeads, "salt 6")
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// RFC 7914's test vector for PBKDF2-HMAC-SHA256
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1)
+	assert.Equal(t, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc", hex.EncodeToString(key))
+}
+
+func TestRunWriterPrivacy(t *testing.T) {
+	t.Setenv("ORCH_TEST_ARTIFACTS_KEY", "artifacts-key")
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`working_dir: "/tmp/test-dir"
+privacy:
+  scrub: ["(?i)project falcon"]
+  encryption_key: "secret://env:ORCH_TEST_ARTIFACTS_KEY"
+agents:
+  - id: codex
+    type: cli
+`), 0644))
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.True(t, cfg.HasSecrets())
+	assert.Equal(t, "Ship [REDACTED] today", cfg.Redact("Ship Project Falcon today"))
+
+	runDir := filepath.Join(t.TempDir(), "20240102-030405-abcdef")
+	w, err := NewRunWriter(runDir, cfg)
+	require.NoError(t, err)
+
+	task := Task{ID: "fix", Prompt: "Fix the login bug in Project Falcon"}
+	thinking, err := protocol.NewEvent(protocol.EventTypeThinking, "codex", 1).WithPayload(protocol.ThinkingPayload{Content: "The login handler is wrong"})
+	require.NoError(t, err)
+	patches := map[string]*PatchDetails{"codex": {Events: []*protocol.Event{thinking}}}
+	require.NoError(t, w.WritePrompt(task))
+	require.NoError(t, w.WriteTranscript("codex", patches["codex"].Events))
+	require.NoError(t, w.WriteTimeline(patches))
+	require.NoError(t, w.WriteReport(&TaskResult{Task: task, RunID: "20240102-030405-abcdef", Candidates: []*PatchResult{{AgentID: "codex"}}}))
+	c := NewCheckpointer(w, "20240102-030405-abcdef", "", task, "")
+	require.NotNil(t, c)
+
+	// Nothing stored holds the prompt or transcript in the clear
+	require.NoError(t, filepath.Walk(runDir, func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		if !info.IsDir() {
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "login", path)
+		}
+		return nil
+	}))
+
+	report, err := ReadReport(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, EncryptedPrompt, report.Task.Prompt)
+	checkpoint, err := ReadCheckpoint(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, EncryptedPrompt, checkpoint.Task.Prompt)
+
+	var timeline Timeline
+	data, err := os.ReadFile(filepath.Join(runDir, TimelineFile))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &timeline))
+	assert.NotEmpty(t, timeline.TraceEvents, "The timeline keeps its states without their text")
+
+	// The key decrypts the prompt and transcript, which were scrubbed before they were encrypted
+	prompt, err := readRunFile(filepath.Join(runDir, PromptFile), cfg.Cipher())
+	require.NoError(t, err)
+	assert.Equal(t, "Fix the login bug in [REDACTED]\n", string(prompt))
+	events, err := ReadTranscript(TranscriptPath(runDir, "codex"), cfg.Cipher())
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, thinking.Payload, events[0].Payload)
+	_, err = ReadTranscript(TranscriptPath(runDir, "codex"), nil)
+	assert.ErrorIs(t, err, ErrEncrypted)
+
+	// Run pages, which are stored in the clear, leave the prompt and transcripts out
+	page, err := LoadRunPage(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, EncryptedPrompt, page.Prompt)
+	require.Len(t, page.Agents, 1)
+	assert.Empty(t, page.Agents[0].Timeline)
+	assert.False(t, strings.Contains(page.Markdown(), "login"))
+}
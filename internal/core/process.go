@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the rate in Hz at which Linux reports CPU time in /proc (USER_HZ)
+const clockTicks = 100
+
+// ProcessUsage is what a process and its descendants are using
+type ProcessUsage struct {
+	// MemoryBytes is the resident set size of every process in the tree
+	MemoryBytes int64
+
+	// CPUTime is the user and system CPU time of the tree, including children that have exited
+	CPUTime time.Duration
+}
+
+// processInfo is one entry of the system's process table
+type processInfo struct {
+	pid      int
+	ppid     int
+	rssBytes int64
+	cpuTime  time.Duration
+}
+
+// SampleProcessTrees measures the process tree rooted at each of pids with one read of the process table
+// Processes that are no longer running are left out of the result
+func SampleProcessTrees(pids []int) (map[int]ProcessUsage, error) {
+	procs, err := listProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	return processTreeUsage(procs, pids), nil
+}
+
+// processTreeUsage sums the usage of each root process and its descendants
+func processTreeUsage(procs []processInfo, roots []int) map[int]ProcessUsage {
+	byPID := make(map[int]processInfo, len(procs))
+	children := make(map[int][]int)
+	for _, proc := range procs {
+		byPID[proc.pid] = proc
+		children[proc.ppid] = append(children[proc.ppid], proc.pid)
+	}
+
+	usage := make(map[int]ProcessUsage, len(roots))
+	for _, root := range roots {
+		if _, running := byPID[root]; !running {
+			continue
+		}
+		var total ProcessUsage
+		seen := make(map[int]bool)
+		queue := []int{root}
+		for len(queue) > 0 {
+			pid := queue[0]
+			queue = queue[1:]
+			if seen[pid] {
+				continue
+			}
+			seen[pid] = true
+
+			proc := byPID[pid]
+			total.MemoryBytes += proc.rssBytes
+			total.CPUTime += proc.cpuTime
+			queue = append(queue, children[pid]...)
+		}
+		usage[root] = total
+	}
+	return usage
+}
+
+// parseProcStat parses a Linux /proc/<pid>/stat line
+// CPU time includes the children the process has waited for, so it doesn't drop when a child exits
+func parseProcStat(line string, pageSize int64) (processInfo, error) {
+	// The command name is in parentheses and may itself contain spaces or parentheses
+	open, end := strings.IndexByte(line, '('), strings.LastIndexByte(line, ')')
+	if open < 0 || end < open {
+		return processInfo{}, fmt.Errorf("malformed stat line")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line[:open]))
+	if err != nil {
+		return processInfo{}, fmt.Errorf("malformed pid: %w", err)
+	}
+
+	// Fields after the name start at field 3 (state); ppid is field 4, utime through cstime 14-17, and rss 24
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 22 {
+		return processInfo{}, fmt.Errorf("stat line has %d fields, want at least 24", len(fields)+2)
+	}
+	numbers := make(map[int]int64)
+	for _, field := range []int{4, 14, 15, 16, 17, 24} {
+		value, err := strconv.ParseInt(fields[field-3], 10, 64)
+		if err != nil {
+			return processInfo{}, fmt.Errorf("malformed field %d: %w", field, err)
+		}
+		numbers[field] = value
+	}
+
+	ticks := numbers[14] + numbers[15] + numbers[16] + numbers[17]
+	return processInfo{
+		pid:      pid,
+		ppid:     int(numbers[4]),
+		rssBytes: numbers[24] * pageSize,
+		cpuTime:  time.Duration(ticks) * time.Second / clockTicks,
+	}, nil
+}
+
+// parsePS parses the output of "ps -A -o pid=,ppid=,rss=,time=", where rss is in kilobytes
+func parsePS(output string) ([]processInfo, error) {
+	var procs []processInfo
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("malformed ps line %q", scanner.Text())
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		rss, err3 := strconv.ParseInt(fields[2], 10, 64)
+		cpuTime, err4 := parsePSTime(fields[3])
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return nil, fmt.Errorf("malformed ps line %q", scanner.Text())
+		}
+		procs = append(procs, processInfo{pid: pid, ppid: ppid, rssBytes: rss * 1024, cpuTime: cpuTime})
+	}
+	return procs, scanner.Err()
+}
+
+// parsePSTime parses a CPU time as ps prints it: [[dd-]hh:]mm:ss with optional fractional seconds
+func parsePSTime(value string) (time.Duration, error) {
+	var days int64
+	if dash := strings.IndexByte(value, '-'); dash >= 0 {
+		d, err := strconv.ParseInt(value[:dash], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		days, value = d, value[dash+1:]
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("malformed time %q", value)
+	}
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, err
+	}
+	total := time.Duration(days)*24*time.Hour + time.Duration(seconds*float64(time.Second))
+	units := []time.Duration{time.Minute, time.Hour}
+	for i, part := range parts[:len(parts)-1] {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += time.Duration(n) * units[len(parts)-2-i]
+	}
+	return total, nil
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// listProcesses reads the process table from /proc
+// Processes that exit while it is read are skipped
+func listProcesses() ([]processInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int64(os.Getpagesize())
+	var procs []processInfo
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		if proc, err := parseProcStat(string(stat), pageSize); err == nil {
+			procs = append(procs, proc)
+		}
+	}
+	return procs, nil
+}
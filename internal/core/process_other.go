@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+
+package core
+
+import (
+	"os/exec"
+)
+
+// listProcesses reads the process table with ps, which macOS and the BSDs provide
+func listProcesses() ([]processInfo, error) {
+	output, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,rss=,time=").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parsePS(string(output))
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStat(t *testing.T) {
+	// The command name can hold spaces and parentheses
+	line := "4242 (go (test) x) S 4200 4242 4200 0 -1 4194560 100 0 0 0 150 50 20 30 20 0 3 0 1000 123456 256 18446744073709551615\n"
+	proc, err := parseProcStat(line, 4096)
+	require.NoError(t, err)
+	assert.Equal(t, 4242, proc.pid)
+	assert.Equal(t, 4200, proc.ppid)
+	assert.Equal(t, int64(256*4096), proc.rssBytes)
+	assert.Equal(t, 2500*time.Millisecond, proc.cpuTime, "utime, stime, cutime, and cstime are summed")
+
+	_, err = parseProcStat("4242 (truncated) S 1", 4096)
+	assert.Error(t, err)
+}
+
+func TestParsePS(t *testing.T) {
+	procs, err := parsePS("    1     0  1024   0:01.50\n  200     1  2048  01:02:03\n  300   200   512 2-00:00:00\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, []processInfo{
+		{pid: 1, ppid: 0, rssBytes: 1024 * 1024, cpuTime: 1500 * time.Millisecond},
+		{pid: 200, ppid: 1, rssBytes: 2048 * 1024, cpuTime: time.Hour + 2*time.Minute + 3*time.Second},
+		{pid: 300, ppid: 200, rssBytes: 512 * 1024, cpuTime: 48 * time.Hour},
+	}, procs)
+
+	_, err = parsePS("1 0 1024\n")
+	assert.Error(t, err)
+}
+
+func TestProcessTreeUsage(t *testing.T) {
+	procs := []processInfo{
+		{pid: 1, ppid: 0, rssBytes: 1000, cpuTime: time.Hour},
+		{pid: 10, ppid: 1, rssBytes: 100, cpuTime: time.Second},
+		{pid: 11, ppid: 10, rssBytes: 20, cpuTime: 2 * time.Second},
+		{pid: 12, ppid: 11, rssBytes: 3, cpuTime: 3 * time.Second},
+		{pid: 20, ppid: 1, rssBytes: 500, cpuTime: time.Minute},
+	}
+	usage := processTreeUsage(procs, []int{10, 20, 99})
+	assert.Equal(t, map[int]ProcessUsage{
+		10: {MemoryBytes: 123, CPUTime: 6 * time.Second},
+		20: {MemoryBytes: 500, CPUTime: time.Minute},
+	}, usage, "Descendants are included and processes no longer running are left out")
+}
@@ -0,0 +1,77 @@
+//go:build windows
+
+package core
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// processQueryLimitedInformation is the access right reading a process's times and memory needs
+const processQueryLimitedInformation = 0x1000
+
+// procGetProcessMemoryInfo reads a process's memory counters, which syscall doesn't wrap
+var procGetProcessMemoryInfo = syscall.NewLazyDLL("kernel32.dll").NewProc("K32GetProcessMemoryInfo")
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS
+type processMemoryCounters struct {
+	Cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// listProcesses reads the process table from a Toolhelp snapshot
+// Processes the orchestrator may not open are listed without their memory and CPU time, so their trees stay whole
+func listProcesses() ([]processInfo, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var procs []processInfo
+	entry := syscall.ProcessEntry32{Size: uint32(unsafe.Sizeof(syscall.ProcessEntry32{}))}
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		proc := processInfo{pid: int(entry.ProcessID), ppid: int(entry.ParentProcessID)}
+		proc.rssBytes, proc.cpuTime = processUsage(entry.ProcessID)
+		procs = append(procs, proc)
+	}
+	if err != syscall.ERROR_NO_MORE_FILES {
+		return nil, err
+	}
+	return procs, nil
+}
+
+// processUsage returns a process's working set and CPU time, or zeroes if it can't be opened
+func processUsage(pid uint32) (int64, time.Duration) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return 0, 0
+	}
+	defer syscall.CloseHandle(handle)
+
+	var rss int64
+	counters := processMemoryCounters{Cb: uint32(unsafe.Sizeof(processMemoryCounters{}))}
+	if ok, _, _ := procGetProcessMemoryInfo.Call(uintptr(handle), uintptr(unsafe.Pointer(&counters)), uintptr(counters.Cb)); ok != 0 {
+		rss = int64(counters.WorkingSetSize)
+	}
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return rss, 0
+	}
+	return rss, filetimeDuration(kernel) + filetimeDuration(user)
+}
+
+// filetimeDuration converts a FILETIME holding an interval, in 100-nanosecond units, to a duration
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a named variation of the configuration selected at run time
+// Only the settings present in the profile replace the base configuration
+type Profile struct {
+	// Agents lists the IDs of the agents to run (all agents when empty)
+	Agents []string `yaml:"agents"`
+
+	// TestCommand overrides the command used to run tests
+	TestCommand string `yaml:"test_command"`
+
+	// TimeoutSeconds overrides the maximum time to wait for agent responses
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+
+	// Samples overrides the number of attempts each agent makes
+	Samples int `yaml:"samples"`
+
+	// Scoring overrides individual scoring weights
+	Scoring ScoringWeights `yaml:"scoring"`
+
+	// Mutation overrides the mutation-testing settings
+	Mutation MutationConfig `yaml:"mutation"`
+
+	// node keeps the parsed profile so only the settings it contains are applied
+	node *yaml.Node
+}
+
+// UnmarshalYAML decodes a profile and keeps its node for partial overrides
+func (p *Profile) UnmarshalYAML(node *yaml.Node) error {
+	type plain Profile
+	if err := node.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	p.node = node
+	return nil
+}
+
+// ProfileNames returns the names of all configured profiles in sorted order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile overlays a named profile onto the configuration and revalidates it
+func (c *Config) ApplyProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		err := fieldError("", "profile '%s' is not defined", name)
+		err.Suggestion = suggest(name, c.ProfileNames())
+		return err
+	}
+
+	// Decode the profile's settings, except the agent selection, over the base configuration
+	if profile.node != nil {
+		overlay := *profile.node
+		overlay.Content = nil
+		for i := 0; i+1 < len(profile.node.Content); i += 2 {
+			if profile.node.Content[i].Value == "agents" {
+				continue
+			}
+			overlay.Content = append(overlay.Content, profile.node.Content[i], profile.node.Content[i+1])
+		}
+		if err := overlay.Decode(c); err != nil {
+			return fmt.Errorf("error applying profile '%s': %w", name, err)
+		}
+	}
+
+	// Narrow the agent set
+	if len(profile.Agents) > 0 {
+		agents := make(map[string]AgentConfig, len(c.Agents))
+		ids := make([]string, 0, len(c.Agents))
+		for _, agent := range c.Agents {
+			agents[agent.ID] = agent
+			ids = append(ids, agent.ID)
+		}
+
+		selected := make([]AgentConfig, 0, len(profile.Agents))
+		for i, id := range profile.Agents {
+			agent, ok := agents[id]
+			if !ok {
+				err := fieldError(fmt.Sprintf("profiles.%s.agents[%d]", name, i), "profile '%s' references unknown agent '%s'", name, id)
+				err.Suggestion = suggest(id, ids)
+				if profile.node != nil {
+					if target := locate(profile.node, fmt.Sprintf("agents[%d]", i)); target != nil {
+						err.Line, err.Column = target.Line, target.Column
+					}
+				}
+				return err
+			}
+			selected = append(selected, agent)
+		}
+		c.Agents = selected
+	}
+
+	c.ActiveProfile = name
+	return validateConfig(c)
+}
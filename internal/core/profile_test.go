@@ -0,0 +1,93 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const profileConfig = `working_dir: "/tmp/test-dir"
+test_command: "go test ./..."
+timeout_seconds: 600
+scoring:
+  failed_test: 20
+agents:
+  - id: "claude"
+    type: "cli"
+  - id: "amp"
+    type: "cli"
+  - id: "codex"
+    type: "cli"
+profiles:
+  quick:
+    agents: ["claude"]
+    timeout_seconds: 120
+    test_command: "go test -short ./..."
+  thorough:
+    mutation:
+      enabled: true
+    scoring:
+      passed_test: 10
+  broken:
+    agents: ["claud"]
+`
+
+func loadProfileConfig(t *testing.T) *Config {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(profileConfig), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestLoadConfig_ScoringDefaults(t *testing.T) {
+	cfg := loadProfileConfig(t)
+
+	// Only the configured weight changes
+	expected := DefaultScoringWeights
+	expected.FailedTest = 20
+	assert.Equal(t, expected, cfg.Scoring)
+	assert.Equal(t, []string{"broken", "quick", "thorough"}, cfg.ProfileNames())
+}
+
+func TestApplyProfile(t *testing.T) {
+	// Agent selection and simple overrides
+	cfg := loadProfileConfig(t)
+	require.NoError(t, cfg.ApplyProfile("quick"))
+
+	assert.Equal(t, "quick", cfg.ActiveProfile)
+	require.Len(t, cfg.Agents, 1)
+	assert.Equal(t, "claude", cfg.Agents[0].ID)
+	assert.Equal(t, 120, cfg.TimeoutSeconds)
+	assert.Equal(t, "go test -short ./...", cfg.TestCommand)
+	assert.Equal(t, 20, cfg.Scoring.FailedTest, "Settings not in the profile should be kept")
+
+	// Partial nested overrides keep the other fields
+	cfg = loadProfileConfig(t)
+	require.NoError(t, cfg.ApplyProfile("thorough"))
+
+	assert.Len(t, cfg.Agents, 3, "All agents should run when the profile doesn't select any")
+	assert.Equal(t, 600, cfg.TimeoutSeconds)
+	assert.True(t, cfg.Mutation.Enabled)
+	assert.Equal(t, 10, cfg.Scoring.PassedTest)
+	assert.Equal(t, 20, cfg.Scoring.FailedTest)
+	assert.Equal(t, DefaultScoringWeights.Improvement, cfg.Scoring.Improvement)
+}
+
+func TestApplyProfile_Errors(t *testing.T) {
+	cfg := loadProfileConfig(t)
+
+	// Unknown profile names get a suggestion
+	err := cfg.ApplyProfile("quik")
+	require.Error(t, err)
+	assert.Equal(t, "profile 'quik' is not defined (did you mean 'quick'?)", err.Error())
+
+	// Unknown agent references are located in the file
+	err = cfg.ApplyProfile("broken")
+	require.Error(t, err)
+	assert.Equal(t, "line 24, column 14: profile 'broken' references unknown agent 'claud' (did you mean 'claude'?)", err.Error())
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// PromptData is the context a prompt template is rendered with
+type PromptData struct {
+	// Prompt is the task prompt as given
+	Prompt string
+
+	// Task is the task being run, with its ID, labels, and base ref
+	Task Task
+
+	// RunID identifies the run
+	RunID string
+
+	// Language is the repository's primary language, detected from its build files (empty if unknown)
+	Language string
+
+	// TestCommand is the command that validates patches
+	TestCommand string
+
+	// Scope is the subtree of the repository the run is confined to (empty for the whole repository)
+	Scope string
+
+	// TestsPassing is true if the tests pass before any agent has made changes
+	TestsPassing bool
+
+	// FailingTests names the tests that fail before any agent has made changes
+	FailingTests []string
+
+	// TestOutput is the output of the test command before any agent has made changes
+	TestOutput string
+
+	// Branch is the branch checked out in the repository (empty for a detached HEAD)
+	Branch string
+
+	// ChangedFiles lists the files changed on the branch since it diverged from the default branch
+	ChangedFiles []string
+
+	// ContextFiles lists the files gathered as relevant to the task, per the context settings
+	ContextFiles []string
+
+	// RepoMap summarizes the repository's files and Go declarations when the context settings ask for it
+	// A template decides where it goes; without one it precedes the prompt
+	RepoMap string
+}
+
+// promptFuncs are the functions available to prompt templates besides the text/template builtins
+var promptFuncs = template.FuncMap{
+	"join": func(items []string, sep string) string {
+		return strings.Join(items, sep)
+	},
+	// tail keeps the last n lines of text, since test failures are reported at the end of the output
+	"tail": func(n int, text string) string {
+		return tailLines(text, n)
+	},
+}
+
+// ParsePromptTemplate parses a prompt template written in Go text/template syntax
+func ParsePromptTemplate(text string) (*template.Template, error) {
+	return template.New("prompt").Funcs(promptFuncs).Option("missingkey=error").Parse(text)
+}
+
+// RenderPrompt renders a prompt template with the run's context
+func RenderPrompt(text string, data PromptData) (string, error) {
+	tmpl, err := ParsePromptTemplate(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	data := PromptData{
+		Prompt:       "Fix the parser",
+		Task:         Task{ID: "parser", Labels: []string{"bug"}},
+		Language:     "go",
+		TestCommand:  "go test ./...",
+		FailingTests: []string{"TestParse", "TestLex"},
+		TestOutput:   "line 1\nline 2\nline 3\n",
+		Branch:       "feature",
+		ChangedFiles: []string{"parser.go", "lexer.go"},
+	}
+
+	prompt, err := RenderPrompt(`{{.Prompt}} ({{.Task.ID}}, {{.Language}})
+{{if not .TestsPassing}}Failing: {{join .FailingTests ", "}}
+{{tail 2 .TestOutput}}
+{{end}}Changed on {{.Branch}}:{{range .ChangedFiles}} {{.}}{{end}}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "Fix the parser (parser, go)\nFailing: TestParse, TestLex\nline 2\nline 3\nChanged on feature: parser.go lexer.go", prompt)
+
+	_, err = RenderPrompt("{{.Prompt", data)
+	assert.ErrorContains(t, err, "invalid prompt template")
+
+	_, err = RenderPrompt("{{.Missing}}", data)
+	assert.ErrorContains(t, err, "failed to render prompt template")
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// promptVariantSeparator separates an agent's ID from the name of the prompt variant it was given
+const promptVariantSeparator = "@"
+
+// PromptVariant is one phrasing of the task, given to every agent alongside the other variants
+// Phrasing often changes the outcome more than the agent does, so each variant's patches compete with the others'
+type PromptVariant struct {
+	// Name identifies the variant in agent IDs, e.g. claude@tests-first
+	Name string `yaml:"name"`
+
+	// Template rewrites the task prompt, as a Go text/template rendered with PromptData; the prompt template
+	// then wraps the result as it would the task prompt (empty for the built-in variant of the same name)
+	Template string `yaml:"template,omitempty"`
+}
+
+// BuiltinPromptVariants are the variants a run uses when it asks for variants and none are configured, in the
+// order they are picked; the first is the task prompt as given
+var BuiltinPromptVariants = []PromptVariant{
+	{Name: "original", Template: "{{.Prompt}}"},
+	{Name: "tests-first", Template: "{{.Prompt}}\n\nBefore changing any code, write or find a test that reproduces the problem and check that it fails. Then make it pass."},
+	{Name: "root-cause", Template: "{{.Prompt}}\n\nFind the root cause before changing anything: trace the problem back to where it starts and fix it there, not where it shows."},
+	{Name: "minimal", Template: "{{.Prompt}}\n\nMake the smallest change that does this. Don't refactor, rename, or reformat code the task doesn't need changed."},
+	{Name: "plan-first", Template: "Read the code involved and write down a short plan before making any change, then carry the plan out.\n\nTask: {{.Prompt}}"},
+}
+
+// builtinPromptVariant returns the built-in variant with a name
+func builtinPromptVariant(name string) (PromptVariant, bool) {
+	for _, variant := range BuiltinPromptVariants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return PromptVariant{}, false
+}
+
+// Render rewrites the task prompt with the variant's template
+func (v PromptVariant) Render(data PromptData) (string, error) {
+	text := v.Template
+	if text == "" {
+		builtin, _ := builtinPromptVariant(v.Name)
+		text = builtin.Template
+	}
+	rendered, err := RenderPrompt(text, data)
+	if err != nil {
+		return "", fmt.Errorf("prompt variant %s: %w", v.Name, err)
+	}
+	return rendered, nil
+}
+
+// validatePromptVariants checks that variants have distinct names that fit in agent IDs, and templates that parse
+func validatePromptVariants(variants []PromptVariant) error {
+	seen := make(map[string]bool, len(variants))
+	names := make([]string, 0, len(BuiltinPromptVariants))
+	for _, variant := range BuiltinPromptVariants {
+		names = append(names, variant.Name)
+	}
+
+	for i, variant := range variants {
+		field := fmt.Sprintf("prompt_variants[%d]", i)
+		switch {
+		case variant.Name == "":
+			return fieldError(field+".name", "prompt variant at index %d is missing name", i)
+		case strings.ContainsAny(variant.Name, promptVariantSeparator+sampleSeparator+"/\\ \t"):
+			return fieldError(field+".name", "prompt variant name '%s' must not contain '%s', '%s', slashes, or spaces", variant.Name, promptVariantSeparator, sampleSeparator)
+		case seen[variant.Name]:
+			return fieldError(field+".name", "prompt variant '%s' is defined more than once", variant.Name)
+		}
+		seen[variant.Name] = true
+
+		if variant.Template == "" {
+			if _, ok := builtinPromptVariant(variant.Name); !ok {
+				err := fieldError(field+".template", "prompt variant '%s' has no template and is not a built-in variant (%s)", variant.Name, strings.Join(names, ", "))
+				err.Suggestion = suggest(variant.Name, names)
+				return err
+			}
+			continue
+		}
+		if _, err := ParsePromptTemplate(variant.Template); err != nil {
+			return fieldError(field+".template", "prompt variant '%s' has an invalid template: %v", variant.Name, err)
+		}
+	}
+	return nil
+}
+
+// PromptVariantID names an agent given a prompt variant, e.g. claude@tests-first
+func PromptVariantID(agentID, variant string) string {
+	return agentID + promptVariantSeparator + variant
+}
+
+// PromptVariantOf returns the name of the prompt variant an agent, or one of its samples, was given ("" for none)
+func PromptVariantOf(id string) string {
+	id = stripSample(id)
+	if i := strings.LastIndex(id, promptVariantSeparator); i > 0 {
+		return id[i+1:]
+	}
+	return ""
+}
+
+// SelectPromptVariants returns the prompt variants a run uses: the configured ones, or the built-in ones if n asks
+// for variants and none are configured, keeping the first n when n is positive
+func (c *Config) SelectPromptVariants(n int) []PromptVariant {
+	variants := c.PromptVariants
+	if n > 0 && len(variants) == 0 {
+		variants = BuiltinPromptVariants
+	}
+	if n > 0 && n < len(variants) {
+		variants = variants[:n]
+	}
+	return variants
+}
+
+// ExpandPromptVariants returns a copy of the configuration in which every agent is replaced by one agent per prompt
+// variant the run uses, each with the same settings and the variant's name in its ID
+// n selects the variants as for SelectPromptVariants. The copy keeps only the selected variants
+// Agents in a pipeline, and the test author, are given the task prompt as it is, since the configuration names them;
+// patch agents don't read a prompt at all
+// Agents already named for a selected variant are kept as they are, so expanding the copy again changes nothing
+func (c *Config) ExpandPromptVariants(n int) (*Config, error) {
+	variants := c.SelectPromptVariants(n)
+	expanded := *c
+	expanded.PromptVariants = variants
+	if len(variants) == 0 {
+		return &expanded, nil
+	}
+
+	selected := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		selected[variant.Name] = true
+	}
+	expanded.Agents = make([]AgentConfig, 0, len(c.Agents)*len(variants))
+	for _, agent := range c.Agents {
+		if c.runsOnce(agent) || selected[PromptVariantOf(agent.ID)] {
+			expanded.Agents = append(expanded.Agents, agent)
+			continue
+		}
+		if strings.Contains(agent.ID, promptVariantSeparator) {
+			return nil, fmt.Errorf("agent ID '%s' contains '%s', which names prompt variants", agent.ID, promptVariantSeparator)
+		}
+		for _, variant := range variants {
+			copied := agent
+			copied.ID = PromptVariantID(agent.ID, variant.Name)
+			expanded.Agents = append(expanded.Agents, copied)
+		}
+	}
+	return &expanded, nil
+}
+
+// FormatPromptVariants lists each prompt variant's best patch among ranked, best first, marking the variant that won
+func FormatPromptVariants(ranked []*PatchResult) string {
+	var sb strings.Builder
+
+	sb.WriteString("=== Prompt Variants ===\n")
+	seen := make(map[string]bool)
+	for i, result := range ranked {
+		variant := PromptVariantOf(result.AgentID)
+		if variant == "" || seen[variant] {
+			continue
+		}
+		seen[variant] = true
+
+		won := ""
+		if i == 0 {
+			won = "  (won)"
+		}
+		sb.WriteString(fmt.Sprintf("%-20s best score %4d from %s%s\n", variant, result.Score, result.AgentID, won))
+	}
+
+	return sb.String()
+}
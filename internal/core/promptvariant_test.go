@@ -0,0 +1,120 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandPromptVariants(t *testing.T) {
+	cfg := &Config{
+		Samples: 2,
+		Agents: []AgentConfig{
+			{ID: "claude", Type: "claude", TestCommand: "make test"},
+			{ID: "codex", Type: "codex"},
+			{ID: "reviewer", Type: "amp"},
+		},
+		Pipelines:      []PipelineConfig{{Fixer: "codex", Reviewer: "reviewer"}},
+		PromptVariants: []PromptVariant{{Name: "tests-first"}, {Name: "terse", Template: "{{.Prompt}}. Be brief."}},
+	}
+
+	ids := func(cfg *Config) []string {
+		var ids []string
+		for _, agent := range cfg.Agents {
+			ids = append(ids, agent.ID)
+		}
+		return ids
+	}
+
+	// Every agent outside a pipeline runs once per configured variant, and then once per sample
+	expanded, err := cfg.ExpandPromptVariants(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude@tests-first", "claude@terse", "codex", "reviewer"}, ids(expanded))
+	assert.Equal(t, "make test", expanded.Agents[1].TestCommand, "Variants keep the agent's settings")
+	assert.Len(t, cfg.Agents, 3, "The original configuration is unchanged")
+
+	again, err := expanded.ExpandPromptVariants(0)
+	require.NoError(t, err)
+	assert.Equal(t, ids(expanded), ids(again), "Expanding again changes nothing")
+
+	sampled, err := expanded.ExpandSamples(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude@tests-first#1", "claude@tests-first#2", "claude@terse#1", "claude@terse#2", "codex", "reviewer"}, ids(sampled))
+
+	// A count keeps the first configured variants
+	expanded, err = cfg.ExpandPromptVariants(1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude@tests-first", "codex", "reviewer"}, ids(expanded))
+	assert.Equal(t, []PromptVariant{{Name: "tests-first"}}, expanded.PromptVariants)
+
+	// Without configured variants, a count picks built-in ones and no count leaves agents alone
+	cfg.PromptVariants = nil
+	expanded, err = cfg.ExpandPromptVariants(2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude@original", "claude@tests-first", "codex", "reviewer"}, ids(expanded))
+	expanded, err = cfg.ExpandPromptVariants(0)
+	require.NoError(t, err)
+	assert.Equal(t, ids(cfg), ids(expanded))
+
+	cfg.Agents = append(cfg.Agents, AgentConfig{ID: "me@work", Type: "cli"})
+	_, err = cfg.ExpandPromptVariants(2)
+	assert.ErrorContains(t, err, "agent ID 'me@work' contains '@'")
+}
+
+func TestPromptVariantOf(t *testing.T) {
+	assert.Equal(t, "tests-first", PromptVariantOf(PromptVariantID("claude", "tests-first")))
+	assert.Equal(t, "tests-first", PromptVariantOf("claude@tests-first#2"))
+	assert.Equal(t, "", PromptVariantOf("claude#2"))
+	assert.Equal(t, "claude", SampleOf("claude@tests-first#2"), "Variants count toward the agent they belong to")
+	assert.Equal(t, "team/codex", SampleOf("team/codex@minimal"))
+}
+
+func TestPromptVariantRender(t *testing.T) {
+	data := PromptData{Prompt: "Fix the bug", FailingTests: []string{"TestParse"}}
+
+	rendered, err := PromptVariant{Name: "minimal"}.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, "Fix the bug\n\nMake the smallest change that does this. Don't refactor, rename, or reformat code the task doesn't need changed.", rendered, "A variant without a template is the built-in one")
+
+	rendered, err = PromptVariant{Name: "failing", Template: "{{.Prompt}}; {{join .FailingTests \", \"}} fails"}.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, "Fix the bug; TestParse fails", rendered)
+}
+
+func TestValidatePromptVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []PromptVariant
+		want     string
+	}{
+		{name: "built-in and custom", variants: []PromptVariant{{Name: "original"}, {Name: "terse", Template: "{{.Prompt}}"}}},
+		{name: "missing name", variants: []PromptVariant{{Template: "{{.Prompt}}"}}, want: "prompt variant at index 0 is missing name"},
+		{name: "separator in name", variants: []PromptVariant{{Name: "a@b", Template: "{{.Prompt}}"}}, want: "must not contain"},
+		{name: "duplicate", variants: []PromptVariant{{Name: "minimal"}, {Name: "minimal"}}, want: "prompt variant 'minimal' is defined more than once"},
+		{name: "unknown built-in", variants: []PromptVariant{{Name: "minimall"}}, want: "prompt variant 'minimall' has no template and is not a built-in variant"},
+		{name: "invalid template", variants: []PromptVariant{{Name: "broken", Template: "{{.Prompt"}}, want: "prompt variant 'broken' has an invalid template"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePromptVariants(tc.variants)
+			if tc.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestFormatPromptVariants(t *testing.T) {
+	ranked := []*PatchResult{
+		{AgentID: "codex@minimal", Score: 150},
+		{AgentID: "claude@minimal", Score: 120},
+		{AgentID: "claude@original", Score: 90},
+		{AgentID: "reviewed", Score: 80},
+	}
+	assert.Equal(t, "=== Prompt Variants ===\n"+
+		"minimal              best score  150 from codex@minimal  (won)\n"+
+		"original             best score   90 from claude@original\n", FormatPromptVariants(ranked))
+}
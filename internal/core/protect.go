@@ -0,0 +1,83 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// ProtectedActions describes the actions an agent reported on files it must not touch: its worktree's .git, and,
+// outside its worktree, the protected directories, such as the repository and the orchestrator's working and
+// artifacts directories. Each is described as e.g. "attempted edit of .git/hooks/pre-commit"
+// Relative paths in events are taken relative to the worktree
+func ProtectedActions(events []*protocol.Event, worktreePath string, protectedDirs []string) []string {
+	worktree := absPath(worktreePath)
+	dirs := make([]string, 0, len(protectedDirs))
+	for _, dir := range protectedDirs {
+		if dir != "" {
+			dirs = append(dirs, absPath(dir))
+		}
+	}
+
+	var actions []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if event.Type != protocol.EventTypeAction {
+			continue
+		}
+		var payload protocol.ActionPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil || payload.FilePath == "" {
+			continue
+		}
+
+		path := payload.FilePath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(worktree, path)
+		}
+		path = filepath.Clean(path)
+
+		display, protected := "", false
+		if rel, ok := within(worktree, path); ok {
+			display = rel
+			protected = rel == ".git" || strings.HasPrefix(rel, ".git/")
+		} else {
+			display = path
+			for _, dir := range dirs {
+				if _, ok := within(dir, path); ok {
+					protected = true
+					break
+				}
+			}
+		}
+		if !protected {
+			continue
+		}
+
+		action := fmt.Sprintf("attempted %s of %s", payload.ActionType, display)
+		if !seen[action] {
+			seen[action] = true
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// within returns path relative to dir, with forward slashes, if it is dir or inside it
+func within(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// absPath returns path made absolute, or path itself if that fails
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
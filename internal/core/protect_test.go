@@ -0,0 +1,49 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+func TestProtectedActions(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	workingDir := filepath.Join(root, "work")
+	worktree := filepath.Join(workingDir, "claude")
+
+	action := func(actionType, file string) *protocol.Event {
+		e, err := protocol.NewEvent(protocol.EventTypeAction, "claude", 0).WithPayload(protocol.ActionPayload{ActionType: actionType, FilePath: file})
+		require.NoError(t, err)
+		return e
+	}
+	thinking, err := protocol.NewEvent(protocol.EventTypeThinking, "claude", 0).WithPayload(protocol.ThinkingPayload{Content: "editing .git/config"})
+	require.NoError(t, err)
+
+	events := []*protocol.Event{
+		action("edit", "main.go"),
+		action("create", ".git/hooks/pre-commit"),
+		action("create", ".git/hooks/pre-commit"),
+		action("edit", filepath.Join(worktree, ".git")),
+		action("edit", filepath.Join(worktree, ".github", "workflows", "ci.yml")),
+		action("edit", filepath.Join(repo, "main.go")),
+		action("delete", filepath.Join(workingDir, "gemini", "main.go")),
+		action("edit", filepath.Join(root, "elsewhere.txt")),
+		action("edit", ""),
+		thinking,
+	}
+
+	actions := ProtectedActions(events, worktree, []string{repo, workingDir, ""})
+	assert.Equal(t, []string{
+		"attempted create of .git/hooks/pre-commit",
+		"attempted edit of .git",
+		"attempted edit of " + filepath.Join(repo, "main.go"),
+		"attempted delete of " + filepath.Join(workingDir, "gemini", "main.go"),
+	}, actions)
+
+	assert.Empty(t, ProtectedActions(events[:1], worktree, []string{repo}))
+}
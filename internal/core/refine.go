@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultRefineOutputLines is how many of the last lines of test output a follow-up prompt includes by default
+const DefaultRefineOutputLines = 100
+
+// RefineConfig gives agents more attempts while the best patch still leaves tests failing
+// Each round sends every agent whose patch fails the test output and its own diff, and collects revised patches
+type RefineConfig struct {
+	// MaxRounds is the most follow-up rounds a run makes (0 turns refinement off)
+	MaxRounds int `yaml:"max_rounds,omitempty"`
+
+	// OutputLines is how many of the last lines of test output each follow-up prompt includes
+	// (0 for DefaultRefineOutputLines)
+	OutputLines int `yaml:"output_lines,omitempty"`
+}
+
+// validate checks the round and line counts
+func (r RefineConfig) validate() error {
+	if r.MaxRounds < 0 {
+		return fieldError("refine.max_rounds", "refine.max_rounds must not be negative")
+	}
+	if r.OutputLines < 0 {
+		return fieldError("refine.output_lines", "refine.output_lines must not be negative")
+	}
+	return nil
+}
+
+// NeedsRefinement reports whether the best patch was tested and still leaves tests failing
+func NeedsRefinement(best *PatchResult) bool {
+	return best != nil && best.TestResults != nil && !best.TestResults.Success
+}
+
+// Refinable reports whether an agent's patch is worth another attempt: its agent finished on its own
+// and its tests ran, but some fail
+func Refinable(result *PatchResult) bool {
+	return result.Failure == "" && result.Termination == "" && strings.TrimSpace(result.Diff) != "" &&
+		result.TestResults != nil && !result.TestResults.Success
+}
+
+// RefinementPrompt returns the follow-up prompt asking an agent to revise its patch
+// It repeats the task, then gives the failing tests, the end of their output, and the agent's previous diff,
+// which is still in its worktree
+func (r RefineConfig) RefinementPrompt(prompt string, result *PatchResult) string {
+	lines := r.OutputLines
+	if lines == 0 {
+		lines = DefaultRefineOutputLines
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimRight(prompt, "\n"))
+	sb.WriteString("\n\nYour previous changes for this task leave tests failing. They are still in your working tree; ")
+	sb.WriteString("revise them so every test passes.\n")
+	if failing := FailingTests(result.TestResults.Output); len(failing) > 0 {
+		sb.WriteString(fmt.Sprintf("\nFailing tests: %s\n", strings.Join(failing, ", ")))
+	}
+	if output := strings.TrimSpace(tailLines(result.TestResults.Output, lines)); output != "" {
+		sb.WriteString(fmt.Sprintf("\nEnd of the test output:\n```\n%s\n```\n", output))
+	}
+	sb.WriteString(fmt.Sprintf("\nYour previous changes:\n```diff\n%s\n```\n", strings.TrimRight(result.Diff, "\n")))
+	return sb.String()
+}
+
+// tailLines keeps the last n lines of text
+func tailLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
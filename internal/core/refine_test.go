@@ -0,0 +1,54 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefineConfig_RefinementPrompt(t *testing.T) {
+	result := &PatchResult{
+		AgentID: "claude",
+		Diff:    "diff --git a/f.go b/f.go\n-return 1\n+return 3\n",
+		TestResults: &TestResult{
+			Output: "=== RUN   TestF\n--- FAIL: TestF (0.00s)\n    f_test.go:3: want 2\nFAIL\n",
+		},
+	}
+	assert.True(t, NeedsRefinement(result))
+	assert.True(t, Refinable(result))
+
+	prompt := RefineConfig{OutputLines: 3}.RefinementPrompt("Fix F\n", result)
+	assert.True(t, strings.HasPrefix(prompt, "Fix F\n\nYour previous changes"), "The follow-up repeats the task first")
+	assert.Contains(t, prompt, "Failing tests: TestF\n")
+	assert.Contains(t, prompt, "```\n--- FAIL: TestF (0.00s)\n    f_test.go:3: want 2\nFAIL\n```")
+	assert.NotContains(t, prompt, "=== RUN", "Only the end of the test output is included")
+	assert.Contains(t, prompt, "```diff\n"+strings.TrimRight(result.Diff, "\n")+"\n```")
+
+	// Patches whose tests pass, or whose agents didn't finish, aren't refined
+	passing := &PatchResult{Diff: result.Diff, TestResults: &TestResult{Success: true}}
+	assert.False(t, NeedsRefinement(passing))
+	assert.False(t, Refinable(passing))
+	assert.False(t, NeedsRefinement(&PatchResult{Reason: "No changes made"}))
+	assert.False(t, Refinable(&PatchResult{Diff: result.Diff, TestResults: result.TestResults, Termination: "cost limit exceeded"}))
+	assert.False(t, Refinable(&PatchResult{Diff: result.Diff, TestResults: result.TestResults, Failure: FailureRateLimited}))
+
+	assert.Error(t, RefineConfig{MaxRounds: -1}.validate())
+	assert.Error(t, RefineConfig{OutputLines: -1}.validate())
+	assert.NoError(t, RefineConfig{MaxRounds: 2}.validate())
+}
+
+func TestAgentUsage_Add(t *testing.T) {
+	first := AgentUsage{Tokens: 100, CostUSD: 0.5, Duration: time.Minute, IdleTime: 20 * time.Second, PeakMemoryBytes: 300, Warnings: []string{"cost at 80%"}}
+	second := AgentUsage{Tokens: 50, CostUSD: 0.25, Duration: 30 * time.Second, IdleTime: 10 * time.Second, PeakMemoryBytes: 400, CPUTime: time.Second}
+
+	total := first.Add(second)
+	assert.Equal(t, 150, total.Tokens)
+	assert.InDelta(t, 0.75, total.CostUSD, 1e-9)
+	assert.Equal(t, 90*time.Second, total.Duration)
+	assert.Equal(t, 20*time.Second, total.IdleTime)
+	assert.Equal(t, int64(400), total.PeakMemoryBytes)
+	assert.Equal(t, time.Second, total.CPUTime)
+	assert.Equal(t, []string{"cost at 80%"}, total.Warnings)
+}
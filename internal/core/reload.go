@@ -0,0 +1,111 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigWatcher keeps the latest valid configuration for a long-running process
+// Each reload replaces the whole Config, so callers that took a snapshot with Current
+// keep using it unchanged; only work started after the reload sees the new settings
+type ConfigWatcher struct {
+	path   string
+	format ConfigFormat
+
+	current atomic.Pointer[Config]
+
+	// mutex serializes reloads and guards the file state below
+	mutex    sync.Mutex
+	modTime  time.Time
+	size     int64
+	validate func(*Config) error
+}
+
+// NewConfigWatcher loads a configuration file and prepares it for reloading
+func NewConfigWatcher(path string, format ConfigFormat) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{
+		path:   path,
+		format: format,
+	}
+
+	if _, err := w.Reload(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// SetValidator adds a check that a reloaded configuration must pass before it replaces the current one
+// This is used for checks outside the core package, such as registered adapter types
+func (w *ConfigWatcher) SetValidator(validate func(*Config) error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.validate = validate
+}
+
+// Current returns the most recently loaded valid configuration
+// The returned Config must be treated as read-only since other callers share it
+func (w *ConfigWatcher) Current() *Config {
+	return w.current.Load()
+}
+
+// Reload reads the configuration file again if it has changed since the last load
+// It reports whether a new configuration was installed; when the file is invalid
+// the previous configuration stays in effect and the error is returned
+func (w *ConfigWatcher) Reload() (bool, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	// Included files are only reread when the main file changes
+	if w.current.Load() != nil && info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false, nil
+	}
+
+	cfg, err := LoadWithFormat(w.path, w.format)
+	if err == nil && w.validate != nil {
+		err = w.validate(cfg)
+	}
+
+	// Remember the file state even on failure so a broken file is reported once, not on every check
+	w.modTime, w.size = info.ModTime(), info.Size()
+	if err != nil {
+		return false, err
+	}
+
+	w.current.Store(cfg)
+	return true, nil
+}
+
+// Watch checks the configuration file for changes until the context is cancelled
+// onReload is called after each reload attempt with the new configuration or the error that kept the old one
+func (w *ConfigWatcher) Watch(ctx context.Context, checkInterval time.Duration, onReload func(*Config, error)) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := w.Reload()
+			if onReload == nil {
+				continue
+			}
+			if err != nil {
+				onReload(nil, err)
+			} else if reloaded {
+				onReload(w.Current(), nil)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reloadConfig = `working_dir: "/tmp/test-dir"
+test_command: "go test ./..."
+limits:
+  max_tokens: %d
+scoring:
+  failed_test: 20
+agents:
+  - id: "claude"
+    type: "cli"
+`
+
+// writeReloadConfig rewrites the config file and bumps its modification time so the change is always detected
+func writeReloadConfig(t *testing.T, path, data string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestConfigWatcher_Reload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	start := time.Now().Add(-time.Hour)
+	writeReloadConfig(t, configPath, fmt.Sprintf(reloadConfig, 1000), start)
+
+	watcher, err := NewConfigWatcher(configPath, FormatAuto)
+	require.NoError(t, err)
+	original := watcher.Current()
+	assert.Equal(t, 1000, original.Limits.MaxTokens)
+
+	// Nothing changed, so nothing is reloaded
+	reloaded, err := watcher.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+	assert.Same(t, original, watcher.Current())
+
+	// Agents, limits, and scoring weights are replaced together
+	writeReloadConfig(t, configPath, fmt.Sprintf(reloadConfig, 2000)+"  - id: \"amp\"\n    type: \"cli\"\n", start.Add(time.Minute))
+	reloaded, err = watcher.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	updated := watcher.Current()
+	assert.Equal(t, 2000, updated.Limits.MaxTokens)
+	assert.Len(t, updated.Agents, 2)
+	assert.Equal(t, 20, updated.Scoring.FailedTest)
+
+	// A snapshot taken before the reload is left untouched
+	assert.Equal(t, 1000, original.Limits.MaxTokens)
+	assert.Len(t, original.Agents, 1)
+
+	// An invalid file keeps the previous configuration
+	writeReloadConfig(t, configPath, "agents: []\n", start.Add(2*time.Minute))
+	reloaded, err = watcher.Reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	assert.Same(t, updated, watcher.Current())
+
+	// The broken file is reported once rather than on every check
+	reloaded, err = watcher.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+}
+
+func TestConfigWatcher_Validator(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	start := time.Now().Add(-time.Hour)
+	writeReloadConfig(t, configPath, fmt.Sprintf(reloadConfig, 1000), start)
+
+	watcher, err := NewConfigWatcher(configPath, FormatAuto)
+	require.NoError(t, err)
+
+	watcher.SetValidator(func(cfg *Config) error {
+		if cfg.Limits.MaxTokens > 5000 {
+			return errors.New("token limit too high")
+		}
+		return nil
+	})
+
+	writeReloadConfig(t, configPath, fmt.Sprintf(reloadConfig, 9000), start.Add(time.Minute))
+	_, err = watcher.Reload()
+	assert.EqualError(t, err, "token limit too high")
+	assert.Equal(t, 1000, watcher.Current().Limits.MaxTokens)
+}
+
+func TestConfigWatcher_Watch(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	start := time.Now().Add(-time.Hour)
+	writeReloadConfig(t, configPath, fmt.Sprintf(reloadConfig, 1000), start)
+
+	watcher, err := NewConfigWatcher(configPath, FormatAuto)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloads := make(chan *Config, 1)
+	go watcher.Watch(ctx, 10*time.Millisecond, func(cfg *Config, err error) {
+		if err != nil {
+			return
+		}
+		select {
+		case reloads <- cfg:
+		default:
+		}
+	})
+
+	writeReloadConfig(t, configPath, fmt.Sprintf(reloadConfig, 3000), start.Add(time.Minute))
+
+	select {
+	case cfg := <-reloads:
+		assert.Equal(t, 3000, cfg.Limits.MaxTokens)
+	case <-time.After(2 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// DefaultRepoMapBytes caps the size of a repository map, about 4000 tokens
+const DefaultRepoMapBytes = 16 * 1024
+
+// maxMapDeclarations is how many declarations of a Go file the map lists before eliding the rest
+const maxMapDeclarations = 12
+
+// RepoMap summarizes a checkout for agents that would otherwise explore it file by file:
+// every tracked file with its size, grouped by directory, with the package and exported
+// declarations of Go files. Files past maxBytes are counted rather than listed, and only those inside
+// scope are mapped (every file with an empty scope).
+func RepoMap(repo, scope string, maxBytes int) (string, error) {
+	tracked, err := gitutil.TrackedFiles(repo)
+	if err != nil {
+		return "", err
+	}
+	tracked = ScopedFiles(tracked, scope)
+	if maxBytes <= 0 {
+		maxBytes = DefaultRepoMapBytes
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Repository map (tracked files with their sizes, and the exported declarations of Go files):\n")
+
+	// Directories are labelled with the package of their Go source, wherever it is listed
+	fset := token.NewFileSet()
+	packages := make(map[string]string)
+	for _, file := range tracked {
+		if dir := path.Dir(file); packages[dir] == "" {
+			packages[dir] = goPackageName(fset, repo, file)
+		}
+	}
+
+	dir := ""
+	for i, file := range tracked {
+		var entry strings.Builder
+		if fileDir := path.Dir(file); fileDir != dir || i == 0 {
+			dir = fileDir
+			entry.WriteString("\n" + dir + "/")
+			if pkg := packages[dir]; pkg != "" {
+				fmt.Fprintf(&entry, " (package %s)", pkg)
+			}
+			entry.WriteString("\n")
+		}
+
+		fmt.Fprintf(&entry, "  %s", path.Base(file))
+		if info, err := os.Stat(filepath.Join(repo, file)); err == nil {
+			fmt.Fprintf(&entry, "  %s", formatSize(info.Size()))
+		}
+		if decls := goDeclarations(fset, repo, file); len(decls) > 0 {
+			fmt.Fprintf(&entry, "  %s", strings.Join(decls, ", "))
+		}
+		entry.WriteString("\n")
+
+		if sb.Len()+entry.Len() > maxBytes {
+			fmt.Fprintf(&sb, "\n... %d more files\n", len(tracked)-i)
+			break
+		}
+		sb.WriteString(entry.String())
+	}
+	return sb.String(), nil
+}
+
+// goPackageName returns the package a Go file belongs to, or "" if it isn't Go source
+func goPackageName(fset *token.FileSet, repo, file string) string {
+	if !isGoSource(file) {
+		return ""
+	}
+	parsed, err := parser.ParseFile(fset, filepath.Join(repo, file), nil, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+	return parsed.Name.Name
+}
+
+// goDeclarations lists the exported types and functions of a Go file, such as "type Config" or "func (*Config) Validate"
+func goDeclarations(fset *token.FileSet, repo, file string) []string {
+	if !isGoSource(file) {
+		return nil
+	}
+	parsed, err := parser.ParseFile(fset, filepath.Join(repo, file), nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	var decls []string
+	for _, decl := range parsed.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				if name := spec.(*ast.TypeSpec).Name; name.IsExported() {
+					decls = append(decls, "type "+name.Name)
+				}
+			}
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				decls = append(decls, fmt.Sprintf("func (%s) %s", receiverType(decl.Recv.List[0].Type), decl.Name.Name))
+			} else {
+				decls = append(decls, "func "+decl.Name.Name)
+			}
+		}
+	}
+
+	if len(decls) > maxMapDeclarations {
+		decls = append(decls[:maxMapDeclarations], fmt.Sprintf("and %d more", len(decls)-maxMapDeclarations))
+	}
+	return decls
+}
+
+// receiverType names a method's receiver type without its type parameters, e.g. "*Config"
+func receiverType(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + receiverType(expr.X)
+	case *ast.IndexExpr:
+		return receiverType(expr.X)
+	case *ast.IndexListExpr:
+		return receiverType(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return "?"
+}
+
+// isGoSource reports whether a file is Go source worth summarizing; tests are left out
+func isGoSource(file string) bool {
+	return strings.HasSuffix(file, ".go") && !strings.HasSuffix(file, "_test.go")
+}
+
+// formatSize formats a file size for the map, e.g. "512 B" or "12.3 KB"
+func formatSize(size int64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	}
+}
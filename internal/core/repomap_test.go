@@ -0,0 +1,69 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoMap(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping repository map test in short mode")
+	}
+
+	repo := t.TempDir()
+	files := map[string]string{
+		"README.md": "# App\n",
+		"internal/store/store.go": `package store
+
+type Store struct{}
+
+type item[T any] struct{ value T }
+
+func New() *Store { return &Store{} }
+
+func (s *Store) Get(key string) string { return "" }
+
+func (i *item[T]) Value() T { return i.value }
+
+func helper() {}
+`,
+		"internal/store/store_test.go": "package store\n\nfunc TestGet() {}\n",
+		"untracked.go":                 "package main\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(repo, name), []byte(content), 0644))
+	}
+	for _, args := range [][]string{{"init"}, {"add", "README.md", "internal"}} {
+		output, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	repoMap, err := RepoMap(repo, "", 0)
+	require.NoError(t, err)
+	assert.Contains(t, repoMap, "\n./\n  README.md  6 B\n")
+	assert.Contains(t, repoMap, "\ninternal/store/ (package store)\n")
+	assert.Contains(t, repoMap, "  store.go  ")
+	assert.Contains(t, repoMap, "type Store, func New, func (*Store) Get, func (*item) Value\n")
+	assert.Contains(t, repoMap, "  store_test.go  33 B\n")
+	assert.NotContains(t, repoMap, "untracked.go")
+	assert.NotContains(t, repoMap, "helper")
+
+	// A small budget lists what fits and counts the rest
+	repoMap, err = RepoMap(repo, "", 120)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(repoMap, "\n... 2 more files\n"), repoMap)
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "12.5 KB", formatSize(12800))
+	assert.Equal(t, "3.0 MB", formatSize(3*1024*1024))
+}
@@ -0,0 +1,319 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// Kinds of review note
+const (
+	// ReviewNoteRisky marks a change a reviewer should look at closely, such as to a migration or security code
+	ReviewNoteRisky = "risky"
+
+	// ReviewNoteUntested marks changed lines no test checks
+	ReviewNoteUntested = "untested"
+
+	// ReviewNoteTODO marks a TODO, FIXME, or similar the agent left in the code
+	ReviewNoteTODO = "todo"
+)
+
+// ReviewNote points a human reviewer at part of the winning patch
+type ReviewNote struct {
+	// Kind is one of the ReviewNote* constants
+	Kind string `json:"kind"`
+
+	// File is the changed file, relative to the repository root
+	File string `json:"file"`
+
+	// Line is the line in the patched file the note is about (0 for the whole file)
+	Line int `json:"line,omitempty"`
+
+	// Message says what to look at
+	Message string `json:"message"`
+}
+
+// String formats the note on one line, e.g. "risky pkg/db.go:12: drops or truncates a table"
+func (n ReviewNote) String() string {
+	if n.Line > 0 {
+		return fmt.Sprintf("%s %s:%d: %s", n.Kind, n.File, n.Line, n.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", n.Kind, n.File, n.Message)
+}
+
+// ReviewNotesMarkdown lists review notes as Markdown, one bullet each
+func ReviewNotesMarkdown(notes []ReviewNote) string {
+	var sb strings.Builder
+	for _, n := range notes {
+		where := n.File
+		if n.Line > 0 {
+			where = fmt.Sprintf("%s:%d", n.File, n.Line)
+		}
+		fmt.Fprintf(&sb, "- **%s** `%s`: %s\n", n.Kind, where, n.Message)
+	}
+	return sb.String()
+}
+
+// riskyPaths flags files whose changes deserve a closer look wherever they are made
+var riskyPaths = []struct {
+	pattern *regexp.Regexp
+	message string
+}{
+	{regexp.MustCompile(`(?i)(^|/)(migrations?|migrate)/`), "changes a database migration"},
+	{regexp.MustCompile(`(?i)(^|[/_.-])(auth|security|crypto|permission|password|secret|credential|session)`), "changes security-sensitive code"},
+	{regexp.MustCompile(`(^|/)(\.github/workflows/|\.gitlab-ci\.yml$|Jenkinsfile$|Dockerfile$|Makefile$)`), "changes the build or CI configuration"},
+	{regexp.MustCompile(`(^|/)(go\.mod|package\.json|requirements[^/]*\.txt|pyproject\.toml|Cargo\.toml|Gemfile)$`), "changes dependencies"},
+}
+
+// riskyLines flags added lines whose effects are easy to miss in review
+var riskyLines = []struct {
+	pattern *regexp.Regexp
+	message string
+}{
+	{regexp.MustCompile(`(?i)\b(DROP|TRUNCATE)\s+TABLE\b`), "drops or truncates a table"},
+	{regexp.MustCompile(`os\.RemoveAll|shutil\.rmtree|rm -rf`), "deletes files recursively"},
+	{regexp.MustCompile(`exec\.Command|subprocess\.|os\.system\(|child_process|Command::new`), "runs an external command"},
+	{regexp.MustCompile(`\beval\(`), "evaluates code at run time"},
+	{regexp.MustCompile(`InsecureSkipVerify|verify\s*=\s*False|rejectUnauthorized:\s*false`), "turns off TLS verification"},
+	{regexp.MustCompile(`"unsafe"|\bunsafe\s*\{`), "uses unsafe code"},
+	{regexp.MustCompile(`nolint|type:\s*ignore|eslint-disable|@ts-ignore|#\[allow\(`), "silences a linter or type checker"},
+}
+
+// skippedTestPattern matches an added line that skips a test
+var skippedTestPattern = regexp.MustCompile(`t\.Skip|@pytest\.mark\.skip|\b(it|describe|test)\.skip\(|\bxit\(|#\[ignore\]`)
+
+// assertionPattern matches a line that checks something in a test
+var assertionPattern = regexp.MustCompile(`\b(assert|require|expect)\w*[.(]|t\.(Error|Errorf|Fatal|Fatalf)\(|assert_eq!|\.to(Be|Equal)\(`)
+
+// todoPattern matches a marker of unfinished work
+var todoPattern = regexp.MustCompile(`\b(TODO|FIXME|XXX|HACK)\b`)
+
+// codeExtensions are the files whose changed lines are expected to be tested
+var codeExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".rs": true,
+	".java": true, ".kt": true, ".rb": true, ".php": true, ".cs": true, ".c": true, ".cc": true, ".cpp": true, ".swift": true,
+}
+
+// maxReviewNoteText is how much of a line a note quotes
+const maxReviewNoteText = 80
+
+// ReviewNotes points a human reviewer at the parts of a patch that need the closest look: risky changes, changed
+// lines no test checks, and TODOs the agent left. Lines count as untested when mutation testing found their mutants
+// survive, or, without mutation testing, when there is no test next to their file in the patch or its worktree
+func ReviewNotes(patch *PatchResult) []ReviewNote {
+	if patch == nil || strings.TrimSpace(patch.Diff) == "" {
+		return nil
+	}
+
+	files := gitutil.SplitDiff(patch.Diff)
+	var notes []ReviewNote
+	var changedTests []string
+	for _, file := range files {
+		if isTestFile(file.Path) {
+			changedTests = append(changedTests, file.Path)
+		}
+	}
+
+	for _, file := range files {
+		if strings.Contains(file.Header, "\ndeleted file mode") {
+			notes = append(notes, ReviewNote{Kind: ReviewNoteRisky, File: file.Path, Message: "deletes the file"})
+			continue
+		}
+		for _, risky := range riskyPaths {
+			if risky.pattern.MatchString(file.Path) {
+				notes = append(notes, ReviewNote{Kind: ReviewNoteRisky, File: file.Path, Message: risky.message})
+				break
+			}
+		}
+		notes = append(notes, lineNotes(file)...)
+
+		if patch.Mutation == nil && codeExtensions[path.Ext(file.Path)] && !isTestFile(file.Path) &&
+			!testedBy(file.Path, changedTests) && !testedBy(file.Path, testsBeside(patch.WorktreePath, file.Path)) {
+			if ranges := addedLines(file); len(ranges) > 0 {
+				notes = append(notes, ReviewNote{Kind: ReviewNoteUntested, File: file.Path, Line: ranges[0].Start,
+					Message: fmt.Sprintf("%s changed with no test next to this file", describeRanges(ranges))})
+			}
+		}
+	}
+
+	// Mutants that survived show exactly which added lines the tests don't check
+	if patch.Mutation != nil {
+		for _, mutant := range patch.Mutation.Survived {
+			notes = append(notes, ReviewNote{Kind: ReviewNoteUntested, File: mutant.FilePath, Line: mutant.Line,
+				Message: fmt.Sprintf("tests still pass when `%s` becomes `%s`", quoteLine(mutant.Original), quoteLine(mutant.Mutated))})
+		}
+	}
+
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].File != notes[j].File {
+			return notes[i].File < notes[j].File
+		}
+		return notes[i].Line < notes[j].Line
+	})
+	return notes
+}
+
+// lineNotes notes the risky lines and TODOs a file's changes add, and test assertions they remove
+func lineNotes(file gitutil.FilePatch) []ReviewNote {
+	var notes []ReviewNote
+	test := isTestFile(file.Path)
+	removedAssertions, firstRemoval := 0, 0
+	seen := make(map[string]bool)
+	note := func(kind string, line int, message string) {
+		if !seen[kind+message] {
+			seen[kind+message] = true
+			notes = append(notes, ReviewNote{Kind: kind, File: file.Path, Line: line, Message: message})
+		}
+	}
+
+	forEachLine(file, func(prefix byte, text string, line int) {
+		switch prefix {
+		case '+':
+			if todoPattern.MatchString(text) {
+				notes = append(notes, ReviewNote{Kind: ReviewNoteTODO, File: file.Path, Line: line, Message: "leaves `" + quoteLine(text) + "`"})
+			}
+			if test {
+				if skippedTestPattern.MatchString(text) {
+					note(ReviewNoteRisky, line, "skips a test")
+				}
+				return
+			}
+			for _, risky := range riskyLines {
+				if risky.pattern.MatchString(text) {
+					note(ReviewNoteRisky, line, risky.message)
+				}
+			}
+		case '-':
+			if test && assertionPattern.MatchString(text) {
+				if removedAssertions == 0 {
+					firstRemoval = line
+				}
+				removedAssertions++
+			}
+		}
+	})
+
+	if removedAssertions > 0 {
+		message := "removes a test assertion"
+		if removedAssertions > 1 {
+			message = fmt.Sprintf("removes %d test assertions", removedAssertions)
+		}
+		notes = append(notes, ReviewNote{Kind: ReviewNoteRisky, File: file.Path, Line: firstRemoval, Message: message})
+	}
+	return notes
+}
+
+// forEachLine calls fn with each added, removed, and context line of a file's hunks and its line in the patched
+// file; a removed line gets the line it was removed before
+func forEachLine(file gitutil.FilePatch, fn func(prefix byte, text string, line int)) {
+	ranges := file.ChangedLines()
+	for i, hunk := range file.Hunks {
+		if i >= len(ranges) {
+			break
+		}
+		line := ranges[i].Start
+		for _, text := range strings.Split(strings.TrimSuffix(hunk, "\n"), "\n")[1:] {
+			if text == "" || text[0] == '\\' {
+				continue
+			}
+			fn(text[0], text[1:], line)
+			if text[0] != '-' {
+				line++
+			}
+		}
+	}
+}
+
+// addedLines returns the spans of lines a file's changes add
+func addedLines(file gitutil.FilePatch) []gitutil.LineRange {
+	var ranges []gitutil.LineRange
+	forEachLine(file, func(prefix byte, text string, line int) {
+		if prefix != '+' || strings.TrimSpace(text) == "" {
+			return
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].End >= line-1 {
+			ranges[n-1].End = line
+			return
+		}
+		ranges = append(ranges, gitutil.LineRange{Start: line, End: line})
+	})
+	return ranges
+}
+
+// describeRanges lists spans of lines, e.g. "lines 3-5 and 9"
+func describeRanges(ranges []gitutil.LineRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = fmt.Sprint(r.Start)
+		if r.End > r.Start {
+			parts[i] = fmt.Sprintf("%d-%d", r.Start, r.End)
+		}
+	}
+	if len(parts) == 1 && ranges[0].End == ranges[0].Start {
+		return "line " + parts[0]
+	}
+	if len(parts) == 1 {
+		return "lines " + parts[0]
+	}
+	return "lines " + strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+// isTestFile reports whether a file holds tests, by the naming conventions of common languages
+func isTestFile(file string) bool {
+	base := path.Base(file)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	return strings.HasSuffix(stem, "_test") || strings.HasPrefix(stem, "test_") || strings.HasSuffix(stem, ".test") ||
+		strings.HasSuffix(stem, ".spec") || strings.HasSuffix(stem, "Test") || strings.HasSuffix(stem, "Tests") ||
+		strings.Contains("/"+path.Dir(file)+"/", "/tests/") || strings.Contains("/"+path.Dir(file)+"/", "/__tests__/")
+}
+
+// testedBy reports whether one of the changed test files is for a file: Go tests in its package, or tests
+// named after it
+func testedBy(file string, tests []string) bool {
+	stem := strings.TrimSuffix(path.Base(file), path.Ext(file))
+	for _, test := range tests {
+		if path.Ext(file) == ".go" && path.Ext(test) == ".go" && path.Dir(test) == path.Dir(file) {
+			return true
+		}
+		if strings.Contains(strings.ToLower(path.Base(test)), strings.ToLower(stem)) {
+			return true
+		}
+	}
+	return false
+}
+
+// testsBeside lists the test files in a file's directory of a worktree, and in its tests directories
+func testsBeside(worktreePath, file string) []string {
+	if worktreePath == "" {
+		return nil
+	}
+	var tests []string
+	dir := path.Dir(file)
+	for _, testDir := range []string{dir, path.Join(dir, "tests"), path.Join(dir, "__tests__")} {
+		entries, err := os.ReadDir(filepath.Join(worktreePath, filepath.FromSlash(testDir)))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if test := path.Join(testDir, entry.Name()); !entry.IsDir() && isTestFile(test) {
+				tests = append(tests, test)
+			}
+		}
+	}
+	return tests
+}
+
+// quoteLine trims a line of code for quoting in a note, without backticks that would end the quote
+func quoteLine(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "`", "'")
+	if runes := []rune(text); len(runes) > maxReviewNoteText {
+		text = string(runes[:maxReviewNoteText-1]) + "…"
+	}
+	return text
+}
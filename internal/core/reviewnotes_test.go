@@ -0,0 +1,110 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReviewNotes(t *testing.T) {
+	diff := `diff --git a/db/migrations/002_drop.sql b/db/migrations/002_drop.sql
+new file mode 100644
+--- /dev/null
++++ b/db/migrations/002_drop.sql
+@@ -0,0 +1 @@
++DROP TABLE sessions;
+diff --git a/pkg/cache.go b/pkg/cache.go
+--- a/pkg/cache.go
++++ b/pkg/cache.go
+@@ -10,3 +10,5 @@ func Get() {
+ 	a := 1
+-	b := 2
++	b := 3
++	// TODO: handle eviction
++	os.RemoveAll(dir)
+ 	c := 4
+@@ -40,2 +42,3 @@ func Put() {
+ 	x := 1
++	y := 2
+ 	z := 3
+diff --git a/pkg/old.go b/pkg/old.go
+deleted file mode 100644
+--- a/pkg/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package pkg
+-func Old() {}
+diff --git a/web/app.test.js b/web/app.test.js
+--- a/web/app.test.js
++++ b/web/app.test.js
+@@ -5,4 +5,3 @@ describe("app", () => {
+-  expect(render()).toBe("ok")
+-  expect(count()).toBe(1)
++  it.skip("renders", () => {})
+   done()
+`
+
+	notes := ReviewNotes(&PatchResult{Diff: diff})
+	assert.Equal(t, []ReviewNote{
+		{Kind: ReviewNoteRisky, File: "db/migrations/002_drop.sql", Message: "changes a database migration"},
+		{Kind: ReviewNoteRisky, File: "db/migrations/002_drop.sql", Line: 1, Message: "drops or truncates a table"},
+		{Kind: ReviewNoteUntested, File: "pkg/cache.go", Line: 11, Message: "lines 11-13 and 43 changed with no test next to this file"},
+		{Kind: ReviewNoteTODO, File: "pkg/cache.go", Line: 12, Message: "leaves `// TODO: handle eviction`"},
+		{Kind: ReviewNoteRisky, File: "pkg/cache.go", Line: 13, Message: "deletes files recursively"},
+		{Kind: ReviewNoteRisky, File: "pkg/old.go", Message: "deletes the file"},
+		{Kind: ReviewNoteRisky, File: "web/app.test.js", Line: 5, Message: "skips a test"},
+		{Kind: ReviewNoteRisky, File: "web/app.test.js", Line: 5, Message: "removes 2 test assertions"},
+	}, notes)
+	assert.Equal(t, "risky db/migrations/002_drop.sql:1: drops or truncates a table", notes[1].String())
+	assert.Contains(t, ReviewNotesMarkdown(notes[:1]), "- **risky** `db/migrations/002_drop.sql`: changes a database migration\n")
+
+	// Changing a test next to the code counts as testing it
+	tested := diff + `diff --git a/pkg/cache_test.go b/pkg/cache_test.go
+--- a/pkg/cache_test.go
++++ b/pkg/cache_test.go
+@@ -1,1 +1,2 @@
+ package pkg
++func TestGet(t *testing.T) {}
+`
+	for _, note := range ReviewNotes(&PatchResult{Diff: tested}) {
+		assert.NotEqual(t, ReviewNoteUntested, note.Kind, note.String())
+	}
+
+	// So does a test next to it in the worktree
+	worktree := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(worktree, "pkg"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(worktree, "pkg", "cache_test.go"), []byte("package pkg\n"), 0644))
+	for _, note := range ReviewNotes(&PatchResult{Diff: diff, WorktreePath: worktree}) {
+		assert.NotEqual(t, ReviewNoteUntested, note.Kind, note.String())
+	}
+
+	// With mutation testing, surviving mutants say exactly which lines go untested
+	mutation := &MutationResult{Total: 2, Killed: 1, Survived: []Mutant{{FilePath: "pkg/cache.go", Line: 11, Original: "b := 3", Mutated: "b := 4"}}}
+	var untested []ReviewNote
+	for _, note := range ReviewNotes(&PatchResult{Diff: diff, Mutation: mutation}) {
+		if note.Kind == ReviewNoteUntested {
+			untested = append(untested, note)
+		}
+	}
+	assert.Equal(t, []ReviewNote{{Kind: ReviewNoteUntested, File: "pkg/cache.go", Line: 11, Message: "tests still pass when `b := 3` becomes `b := 4`"}}, untested)
+
+	assert.Empty(t, ReviewNotes(&PatchResult{}))
+	assert.Empty(t, ReviewNotes(nil))
+}
+
+func TestIsTestFile(t *testing.T) {
+	for file, want := range map[string]bool{
+		"pkg/cache_test.go":       true,
+		"tests/test_cache.py":     true,
+		"web/app.test.ts":         true,
+		"web/__tests__/render.js": true,
+		"src/CacheTest.java":      true,
+		"pkg/cache.go":            false,
+		"src/latest.py":           false,
+	} {
+		assert.Equal(t, want, isTestFile(file), file)
+	}
+}
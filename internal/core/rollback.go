@@ -0,0 +1,67 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AppliedFile holds, as JSON, the state a repository was in before a run's patch was applied to it or committed to a
+// branch, so the rollback command can undo it
+const AppliedFile = "applied.json"
+
+// ApplyRecord is what applying a run's patch changed in a repository
+type ApplyRecord struct {
+	// Repo is the repository the patch was applied to, or whose branch it was committed to
+	Repo string `json:"repo"`
+
+	// Agent is the agent whose patch was applied
+	Agent string `json:"agent,omitempty"`
+
+	// Head is the commit the repository was at, and Before and After the working tree IDs of the repository's state,
+	// before and after the patch was applied (all empty if the patch was only committed)
+	Head   string `json:"head,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+
+	// Branch is the branch the patch was committed to, at BranchCommit (empty if it wasn't committed)
+	Branch       string `json:"branch,omitempty"`
+	BranchCommit string `json:"branch_commit,omitempty"`
+
+	AppliedAt    time.Time  `json:"applied_at"`
+	RolledBackAt *time.Time `json:"rolled_back_at,omitempty"`
+}
+
+// Applied reports whether the patch was applied to the repository's working tree
+func (r *ApplyRecord) Applied() bool {
+	return r.After != ""
+}
+
+// WriteApplyRecord writes what applying a patch changed to a run directory
+func WriteApplyRecord(runDir string, record *ApplyRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode apply record: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, AppliedFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", AppliedFile, err)
+	}
+	return nil
+}
+
+// ReadApplyRecord loads the record written to a run directory by WriteApplyRecord
+// The error wraps os.ErrNotExist if the run's patch was never applied or committed
+func ReadApplyRecord(runDir string) (*ApplyRecord, error) {
+	data, err := os.ReadFile(filepath.Join(runDir, AppliedFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read apply record: %w", err)
+	}
+
+	var record ApplyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse apply record: %w", err)
+	}
+	return &record, nil
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NewRunID generates a short identifier for an orchestrator run
+// It combines a timestamp for sorting with random bytes for uniqueness
+func NewRunID() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to nanoseconds if the random source is unavailable
+		return fmt.Sprintf("%s-%06x", time.Now().UTC().Format("20060102-150405"), time.Now().UnixNano()&0xffffff)
+	}
+
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(b))
+}
+
+// runIDTime returns when a run started, if id has the form NewRunID gives it
+func runIDTime(id string) (time.Time, bool) {
+	stamp, suffix, ok := strings.Cut(id, "-")
+	if !ok {
+		return time.Time{}, false
+	}
+	clock, random, ok := strings.Cut(suffix, "-")
+	if !ok || len(random) != 6 {
+		return time.Time{}, false
+	}
+	if _, err := hex.DecodeString(random); err != nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("20060102-150405", stamp+"-"+clock)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,400 @@
+package core
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// Rendered reports written to a run directory alongside report.json
+const (
+	// ReportHTMLFile is a standalone page for viewing the run in a browser
+	ReportHTMLFile = "report.html"
+
+	// ReportMarkdownFile is the same report as Markdown, e.g. for pasting into a pull request
+	ReportMarkdownFile = "report.md"
+)
+
+// testSnippetLines is how many lines from the end of each test log a rendered report shows
+const testSnippetLines = 30
+
+//go:embed runpage.html
+var runPageTemplate string
+
+// RunPage is what a rendered report shows about a run, loaded from its directory
+type RunPage struct {
+	// Report is the run's ranking of patches
+	Report *RunReport
+
+	// Prompt is the prompt the agents were given
+	Prompt string
+
+	// Agents holds each evaluated agent in ranking order
+	Agents []AgentPage
+}
+
+// AgentPage is what a rendered report shows about one agent
+type AgentPage struct {
+	ReportCandidate
+
+	// Rank is the agent's position in the ranking, starting at 1
+	Rank int
+
+	// Best marks the agent whose patch was selected
+	Best bool
+
+	// Diff is the agent's exported patch (empty if it changed nothing)
+	Diff string
+
+	// Timeline lists what the agent did, from its transcript
+	Timeline []TimelineEntry
+
+	// TestOutput is the end of the agent's test log
+	TestOutput string
+}
+
+// TimelineEntry is one event from an agent's transcript
+type TimelineEntry struct {
+	// Offset is the time since the agent was given the prompt
+	Offset time.Duration
+
+	// Type is the kind of event
+	Type protocol.EventType
+
+	// Text describes the event
+	Text string
+}
+
+// LoadRunPage gathers a run's report, prompt, patches, transcripts, and test logs from its directory
+// Only the report is required; anything else missing is left out of the page. Pages are stored in
+// the run directory too, so encrypted prompts and transcripts are left out rather than decrypted
+func LoadRunPage(runDir string) (*RunPage, error) {
+	report, err := ReadReport(runDir)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &RunPage{Report: report}
+	if data, err := os.ReadFile(filepath.Join(runDir, PromptFile)); err == nil {
+		page.Prompt = strings.TrimRight(string(data), "\n")
+		if IsEncrypted(data) {
+			page.Prompt = EncryptedPrompt
+		}
+	}
+
+	patches, _, _ := ReadPatches(runDir)
+	for i, candidate := range report.Candidates {
+		name := safeFileName(candidate.AgentID)
+		agent := AgentPage{
+			ReportCandidate: candidate,
+			Rank:            i + 1,
+			Best:            candidate.AgentID == report.Best,
+			Diff:            patches[name],
+		}
+		agent.Timeline, _ = readTimeline(TranscriptPath(runDir, candidate.AgentID))
+		if data, err := os.ReadFile(filepath.Join(runDir, TestLogsDir, name+".log")); err == nil {
+			agent.TestOutput = lastLines(string(data), testSnippetLines)
+		}
+		page.Agents = append(page.Agents, agent)
+	}
+
+	return page, nil
+}
+
+// readTimeline loads an agent's transcript as a timeline, timed from its first event
+func readTimeline(path string) ([]TimelineEntry, error) {
+	events, err := ReadTranscript(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeline []TimelineEntry
+	for _, event := range events {
+		timeline = append(timeline, TimelineEntry{
+			Offset: event.Timestamp.Sub(events[0].Timestamp).Round(time.Second),
+			Type:   event.Type,
+			Text:   timelineText(event),
+		})
+	}
+	return timeline, nil
+}
+
+// timelineText describes an event in a line of a timeline
+func timelineText(event *protocol.Event) string {
+	switch event.Type {
+	case protocol.EventTypePrompt:
+		if payload, err := event.UnmarshalPromptPayload(); err == nil && len(payload.ContextFiles) > 0 {
+			return fmt.Sprintf("given the prompt with %d context files", len(payload.ContextFiles))
+		}
+		return "given the prompt"
+	case protocol.EventTypeThinking:
+		if payload, err := event.UnmarshalThinkingPayload(); err == nil {
+			return strings.TrimSpace(payload.Content)
+		}
+	case protocol.EventTypeAction:
+		if payload, err := event.UnmarshalActionPayload(); err == nil {
+			return strings.TrimSpace(payload.ActionType + " " + payload.FilePath)
+		}
+	case protocol.EventTypeError:
+		if payload, err := event.UnmarshalErrorPayload(); err == nil {
+			return strings.TrimSpace(payload.Message)
+		}
+	case protocol.EventTypeComplete:
+		return "completed"
+	case protocol.EventTypeWatchdog:
+		var payload struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err == nil {
+			return payload.Message
+		}
+	}
+	return string(event.Payload)
+}
+
+// lastLines returns at most n lines from the end of text
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Status summarizes how the agent's run ended, e.g. "best" or "stopped: idle limit exceeded"
+func (a AgentPage) Status() string {
+	var status []string
+	if a.Best {
+		status = append(status, "best")
+	}
+	if a.Partial {
+		status = append(status, "partial")
+	}
+	if a.Terminated != "" {
+		status = append(status, "stopped: "+a.Terminated)
+	} else if a.Failure != "" {
+		status = append(status, "failed: "+string(a.Failure))
+	}
+	if len(a.PathViolations) > 0 && a.Failure != FailureDeniedPaths {
+		status = append(status, "denied paths stripped")
+	}
+	if len(a.ProtectedChanges) > 0 {
+		status = append(status, "touched protected files")
+	}
+	return strings.Join(status, ", ")
+}
+
+// Duration returns how long the agent ran
+func (a AgentPage) Duration() time.Duration {
+	return time.Duration(a.DurationSeconds * float64(time.Second)).Round(time.Second)
+}
+
+// Span returns the longest time any agent ran, which the timelines on the page are drawn against
+func (p *RunPage) Span() time.Duration {
+	var span time.Duration
+	for _, agent := range p.Agents {
+		if agent.Duration() > span {
+			span = agent.Duration()
+		}
+		if n := len(agent.Timeline); n > 0 && agent.Timeline[n-1].Offset > span {
+			span = agent.Timeline[n-1].Offset
+		}
+	}
+	return span
+}
+
+// Markdown renders the report as Markdown
+func (p *RunPage) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Run %s\n\n", p.Report.RunID)
+	if p.Report.Best != "" {
+		fmt.Fprintf(&sb, "Best patch: **%s**\n\n", p.Report.Best)
+	} else {
+		sb.WriteString("No patch was selected.\n\n")
+	}
+	if p.Prompt != "" {
+		sb.WriteString("## Prompt\n\n")
+		sb.WriteString(fence(p.Prompt, ""))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("## Scores\n\n")
+	sb.WriteString(p.ScoresMarkdown())
+	if len(p.Report.ReviewNotes) > 0 {
+		sb.WriteString("\n## Review notes\n\n")
+		sb.WriteString(ReviewNotesMarkdown(p.Report.ReviewNotes))
+	}
+
+	for _, agent := range p.Agents {
+		fmt.Fprintf(&sb, "\n## %s\n\n", agent.AgentID)
+		fmt.Fprintf(&sb, "%s (score %d)\n", agent.Reason, agent.Score)
+		if len(agent.PathViolations) > 0 {
+			fmt.Fprintf(&sb, "\nReverted changes outside the path policy: `%s`\n", strings.Join(agent.PathViolations, "`, `"))
+		}
+		if len(agent.ProtectedChanges) > 0 {
+			fmt.Fprintf(&sb, "\nProtected files: %s\n", strings.Join(agent.ProtectedChanges, "; "))
+		}
+		if len(agent.Breakdown) > 0 {
+			sb.WriteString("\n")
+		}
+		for _, component := range agent.Breakdown {
+			fmt.Fprintf(&sb, "- %+d %s\n", component.Points, component.Factor)
+		}
+
+		if len(agent.Timeline) > 0 {
+			sb.WriteString("\n### Timeline\n\n")
+			for _, entry := range agent.Timeline {
+				fmt.Fprintf(&sb, "- `+%v` **%s** %s\n", entry.Offset, entry.Type, firstTimelineLine(entry.Text))
+			}
+		}
+		if agent.Diff != "" {
+			sb.WriteString("\n### Diff\n\n")
+			sb.WriteString(fence(agent.Diff, "diff"))
+		}
+		if agent.TestOutput != "" {
+			sb.WriteString("\n### Test output\n\n")
+			sb.WriteString(fence(agent.TestOutput, ""))
+		}
+	}
+
+	return sb.String()
+}
+
+// ScoresMarkdown renders the ranking of the agents as a Markdown table
+func (p *RunPage) ScoresMarkdown() string {
+	var sb strings.Builder
+	sb.WriteString("| Rank | Agent | Score | Tests | Files | Lines | Tokens | Cost | Time | Status |\n")
+	sb.WriteString("|---:|---|---:|---:|---:|---:|---:|---:|---:|---|\n")
+	for _, agent := range p.Agents {
+		fmt.Fprintf(&sb, "| %d | %s | %d | %d/%d | %d | +%d -%d | %d | $%.2f | %v | %s |\n",
+			agent.Rank, markdownCell(agent.AgentID), agent.Score, agent.TestsPassed, agent.TestsTotal, agent.FilesChanged,
+			agent.LinesAdded, agent.LinesRemoved, agent.Tokens, agent.CostUSD, agent.Duration(), markdownCell(agent.Status()))
+	}
+	return sb.String()
+}
+
+// ScoresText renders the ranking of the agents as a fixed-width table, for places that don't render Markdown tables,
+// such as chat messages
+func (p *RunPage) ScoresText() string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tAgent\tScore\tTests\tLines\tStatus")
+	for _, agent := range p.Agents {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d/%d\t+%d -%d\t%s\n",
+			agent.Rank, agent.AgentID, agent.Score, agent.TestsPassed, agent.TestsTotal, agent.LinesAdded, agent.LinesRemoved, agent.Status())
+	}
+	w.Flush()
+
+	// Padding after the last column is only noise
+	lines := strings.Split(sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HTML renders the report as a standalone HTML page
+func (p *RunPage) HTML() (string, error) {
+	tmpl, err := template.New("run").Funcs(template.FuncMap{
+		"diffLines": diffLines,
+		"firstLine": firstTimelineLine,
+		"percent":   percentOf,
+	}).Parse(runPageTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse report template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, p); err != nil {
+		return "", fmt.Errorf("failed to render report: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// DiffLine is one line of a diff, classified for highlighting
+type DiffLine struct {
+	// Class is "add", "remove", "hunk", "file", or "" for context
+	Class string
+
+	// Text is the line itself
+	Text string
+}
+
+// diffLines splits a diff into lines classified for highlighting
+func diffLines(diff string) []DiffLine {
+	var lines []DiffLine
+	for _, text := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		line := DiffLine{Text: text}
+		switch {
+		case strings.HasPrefix(text, "diff --git"), strings.HasPrefix(text, "+++ "), strings.HasPrefix(text, "--- "):
+			line.Class = "file"
+		case strings.HasPrefix(text, "@@"):
+			line.Class = "hunk"
+		case strings.HasPrefix(text, "+"):
+			line.Class = "add"
+		case strings.HasPrefix(text, "-"):
+			line.Class = "remove"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// percentOf returns how far through span a duration is, as a percentage for positioning on a timeline
+func percentOf(d, span time.Duration) string {
+	if span <= 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.1f", min(100, 100*d.Seconds()/span.Seconds()))
+}
+
+// firstTimelineLine shortens a timeline entry to its first line
+func firstTimelineLine(text string) string {
+	line, rest, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if strings.TrimSpace(rest) != "" {
+		line += " …"
+	}
+	return line
+}
+
+// fence wraps text in a Markdown code block long enough not to be closed by the text itself
+func fence(text, language string) string {
+	marker := "```"
+	for strings.Contains(text, marker) {
+		marker += "`"
+	}
+	return marker + language + "\n" + strings.TrimRight(text, "\n") + "\n" + marker + "\n"
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+// RenderRunPages writes report.html and report.md to a run directory from what the run left in it
+func RenderRunPages(runDir string) error {
+	page, err := LoadRunPage(runDir)
+	if err != nil {
+		return err
+	}
+	html, err := page.HTML()
+	if err != nil {
+		return err
+	}
+
+	for name, content := range map[string]string{ReportHTMLFile: html, ReportMarkdownFile: page.Markdown()} {
+		if err := os.WriteFile(filepath.Join(runDir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
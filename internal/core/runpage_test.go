@@ -0,0 +1,99 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderRunPages(t *testing.T) {
+	runDir := t.TempDir()
+	w, err := NewRunWriter(runDir, &Config{})
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := func(eventType protocol.EventType, offset time.Duration, payload interface{}) *protocol.Event {
+		e, err := protocol.NewEvent(eventType, "team/claude", 0).WithPayload(payload)
+		require.NoError(t, err)
+		e.Timestamp = start.Add(offset)
+		return e
+	}
+	require.NoError(t, w.WriteTranscript("team/claude", []*protocol.Event{
+		event(protocol.EventTypePrompt, 0, protocol.PromptPayload{Prompt: "Fix the bug"}),
+		event(protocol.EventTypeThinking, 2*time.Second, protocol.ThinkingPayload{Content: "Reading <main.go>\nthen fixing it"}),
+		event(protocol.EventTypeAction, 5*time.Second, protocol.ActionPayload{ActionType: "edit", FilePath: "main.go"}),
+	}))
+
+	diff := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-return 1\n+return 2\n"
+	best := &PatchResult{
+		AgentID:     "team/claude",
+		Diff:        diff,
+		DiffStats:   gitutil.DiffStats{FilesChanged: 1, LinesAdded: 1, LinesRemoved: 1},
+		Score:       150,
+		Reason:      "Tests now passing",
+		Breakdown:   []ScoreComponent{{Factor: "all tests pass", Points: 150}},
+		TestResults: &TestResult{Success: true, TotalTests: 1, PassedTests: 1, Output: "ok  \texample\n"},
+		Usage:       AgentUsage{Tokens: 1200, CostUSD: 0.5, Duration: 10 * time.Second},
+
+		PathViolations: []string{".env"},
+	}
+	stopped := &PatchResult{AgentID: "codex", Reason: "No changes made", Termination: "idle limit exceeded: no activity for 2m0s",
+		ProtectedChanges: []string{"restored .git/hooks/pre-commit"}}
+	task := Task{Prompt: "Fix the bug"}
+	require.NoError(t, w.WritePrompt(task))
+	require.NoError(t, w.WriteTestLog("team/claude", best.TestResults))
+	_, err = ExportPatches(runDir, map[string]*PatchDetails{"team/claude": {Diff: diff}}, best)
+	require.NoError(t, err)
+	notes := []ReviewNote{{Kind: ReviewNoteUntested, File: "main.go", Line: 1, Message: "line 1 changed with no test next to this file"}}
+	require.NoError(t, w.WriteReport(&TaskResult{Task: task, RunID: "20240102-030405-abcdef", Best: best, Candidates: []*PatchResult{best, stopped}, ReviewNotes: notes}))
+
+	require.NoError(t, RenderRunPages(runDir))
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(runDir, name))
+		require.NoError(t, err, name)
+		return string(data)
+	}
+
+	markdown := read(ReportMarkdownFile)
+	assert.Contains(t, markdown, "# Run 20240102-030405-abcdef\n\nBest patch: **team/claude**\n")
+	assert.Contains(t, markdown, "```\nFix the bug\n```\n")
+	assert.Contains(t, markdown, "| 1 | team/claude | 150 | 1/1 | 1 | +1 -1 | 1200 | $0.50 | 10s | best, denied paths stripped |\n")
+	assert.Contains(t, markdown, "| 2 | codex | 0 | 0/0 | 0 | +0 -0 | 0 | $0.00 | 0s | stopped: idle limit exceeded: no activity for 2m0s, touched protected files |\n")
+	assert.Contains(t, markdown, "## Review notes\n\n- **untested** `main.go:1`: line 1 changed with no test next to this file\n")
+	assert.Contains(t, markdown, "- +150 all tests pass\n")
+	assert.Contains(t, markdown, "Reverted changes outside the path policy: `.env`\n")
+	assert.Contains(t, markdown, "Protected files: restored .git/hooks/pre-commit\n")
+	assert.Contains(t, markdown, "- `+2s` **thinking** Reading <main.go> …\n")
+	assert.Contains(t, markdown, "- `+5s` **action** edit main.go\n")
+	assert.Contains(t, markdown, "```diff\n"+diff+"```\n")
+	assert.Contains(t, markdown, "ok  \texample")
+
+	html := read(ReportHTMLFile)
+	assert.Contains(t, html, "<title>Run 20240102-030405-abcdef</title>")
+	assert.Contains(t, html, `<span class="add">&#43;return 2</span>`)
+	assert.Contains(t, html, `<span class="remove">-return 1</span>`)
+	assert.Contains(t, html, "Reading &lt;main.go&gt; …", "Transcript text is escaped")
+	assert.Contains(t, html, `style="left: 50.0%"`, "Events are placed on the timeline relative to the longest agent")
+	assert.Contains(t, html, `<td class="stopped">stopped: idle limit exceeded`)
+	assert.Contains(t, html, "<td><code>main.go:1</code></td>")
+
+	page, err := LoadRunPage(runDir)
+	require.NoError(t, err)
+	assert.Equal(t, "#  Agent        Score  Tests  Lines  Status\n"+
+		"1  team/claude  150    1/1    +1 -1  best, denied paths stripped\n"+
+		"2  codex        0      0/0    +0 -0  stopped: idle limit exceeded: no activity for 2m0s, touched protected files\n", page.ScoresText())
+
+	// Pages can't be rendered without a report
+	assert.Error(t, RenderRunPages(t.TempDir()))
+}
+
+func TestFence(t *testing.T) {
+	assert.Equal(t, "```go\nx := 1\n```\n", fence("x := 1\n", "go"))
+	assert.Equal(t, "````\n```\ncode\n```\n````\n", fence("```\ncode\n```", ""))
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sampleSeparator separates an agent's ID from the number of one of its samples
+const sampleSeparator = "#"
+
+// SampleID names one of an agent's samples, e.g. claude#2
+func SampleID(agentID string, n int) string {
+	return agentID + sampleSeparator + strconv.Itoa(n)
+}
+
+// SampleOf returns the ID of the agent a sample or prompt variant belongs to, or the ID itself if it is neither
+func SampleOf(id string) string {
+	id = stripSample(id)
+	if i := strings.LastIndex(id, promptVariantSeparator); i > 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// stripSample removes the sample number from an ID, if it has one
+func stripSample(id string) string {
+	if i := strings.LastIndex(id, sampleSeparator); i > 0 {
+		if _, err := strconv.Atoi(id[i+1:]); err == nil {
+			return id[:i]
+		}
+	}
+	return id
+}
+
+// ExpandSamples returns a copy of the configuration in which every agent making several attempts
+// is replaced by one agent per attempt, each with the same settings and its own sample ID
+// samples overrides the configured global count when positive; an agent's own count takes precedence
+// Agents in a pipeline, and the test author, make one attempt, since the configuration names them, as do patch agents
+// The copy has no sample counts left, so expanding it again changes nothing
+func (c *Config) ExpandSamples(samples int) (*Config, error) {
+	if samples <= 0 {
+		samples = c.Samples
+	}
+
+	expanded := *c
+	expanded.Samples = 0
+	expanded.Agents = make([]AgentConfig, 0, len(c.Agents))
+	seen := make(map[string]bool, len(c.Agents))
+	for _, agent := range c.Agents {
+		count := samples
+		if agent.Samples > 0 {
+			count = agent.Samples
+		}
+		if c.runsOnce(agent) {
+			count = 1
+		}
+		agent.Samples = 0
+
+		ids := []string{agent.ID}
+		if count > 1 {
+			ids = make([]string, count)
+			for n := range ids {
+				ids[n] = SampleID(agent.ID, n+1)
+			}
+		}
+
+		for _, id := range ids {
+			if seen[id] {
+				return nil, fmt.Errorf("agent ID '%s' is used more than once after expanding samples", id)
+			}
+			seen[id] = true
+
+			sample := agent
+			sample.ID = id
+			expanded.Agents = append(expanded.Agents, sample)
+		}
+	}
+	return &expanded, nil
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandSamples(t *testing.T) {
+	cfg := &Config{
+		Samples: 2,
+		Agents: []AgentConfig{
+			{ID: "claude", Type: "claude", TestCommand: "make test"},
+			{ID: "codex", Type: "codex", Samples: 3},
+			{ID: "amp", Type: "amp", Samples: 1},
+		},
+	}
+
+	ids := func(cfg *Config) []string {
+		var ids []string
+		for _, agent := range cfg.Agents {
+			ids = append(ids, agent.ID)
+		}
+		return ids
+	}
+
+	expanded, err := cfg.ExpandSamples(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude#1", "claude#2", "codex#1", "codex#2", "codex#3", "amp"}, ids(expanded))
+	assert.Equal(t, "make test", expanded.Agents[1].TestCommand, "Samples keep the agent's settings")
+	assert.Len(t, cfg.Agents, 3, "The original configuration is unchanged")
+
+	// Expanding again changes nothing
+	again, err := expanded.ExpandSamples(0)
+	require.NoError(t, err)
+	assert.Equal(t, ids(expanded), ids(again))
+
+	// The flag overrides the global count, but agents' own counts still win
+	expanded, err = cfg.ExpandSamples(1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude", "codex#1", "codex#2", "codex#3", "amp"}, ids(expanded))
+
+	// Samples may not collide with other agents
+	cfg.Agents = append(cfg.Agents, AgentConfig{ID: "claude#2", Type: "cli", Samples: 1})
+	_, err = cfg.ExpandSamples(0)
+	assert.ErrorContains(t, err, "agent ID 'claude#2' is used more than once after expanding samples")
+}
+
+func TestSampleOf(t *testing.T) {
+	assert.Equal(t, "claude", SampleOf(SampleID("claude", 2)))
+	assert.Equal(t, "team/codex", SampleOf("team/codex#10"))
+	assert.Equal(t, "claude", SampleOf("claude"))
+	assert.Equal(t, "c#sharp", SampleOf("c#sharp"), "Only a trailing number marks a sample")
+}
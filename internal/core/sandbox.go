@@ -0,0 +1,186 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/brettsmith212/orchestrator/internal/sandbox"
+)
+
+// SandboxConfig runs agents and tests in containers that see only their worktree, for prompts that can't be trusted
+// The containers have a read-only root filesystem, no capabilities, and the seccomp and AppArmor profiles applied
+type SandboxConfig struct {
+	// Image provides the agent CLIs and the test toolchain, e.g. ghcr.io/org/orchestrator-sandbox (empty disables the sandbox)
+	Image string `yaml:"image"`
+
+	// Runtime is the container CLI: docker or podman (defaults to docker)
+	Runtime string `yaml:"runtime,omitempty"`
+
+	// SeccompProfile is the path of a seccomp profile (defaults to the runtime's own)
+	SeccompProfile string `yaml:"seccomp_profile,omitempty"`
+
+	// AppArmorProfile is a loaded AppArmor profile (defaults to the runtime's own)
+	AppArmorProfile string `yaml:"apparmor_profile,omitempty"`
+
+	// Env names host environment variables passed into agent containers, such as OPENAI_API_KEY
+	// Test containers get none of them
+	Env []string `yaml:"env,omitempty"`
+
+	// TestNetwork gives test containers network access, which tests that download dependencies need
+	// By default tests run with no network, so code an agent wrote can't send anything anywhere
+	TestNetwork bool `yaml:"test_network,omitempty"`
+}
+
+// Network policies of an agent's sandbox
+const (
+	// NetworkUnrestricted lets an agent reach any host, which is the default
+	NetworkUnrestricted = "unrestricted"
+
+	// NetworkAllowlist lets an agent reach only the hosts in its allowlist, such as its model API
+	NetworkAllowlist = "allowlist"
+
+	// NetworkNone gives an agent no network, for agents whose model runs in the image
+	NetworkNone = "none"
+)
+
+// NetworkPolicy is the network an agent's sandbox can reach, so an agent that writes code can call its model API
+// but can't send the repository anywhere else
+type NetworkPolicy struct {
+	// Mode is unrestricted, allowlist, or none (defaults to allowlist when Allow is set, and unrestricted otherwise)
+	Mode string `yaml:"mode,omitempty"`
+
+	// Allow lists the hosts reachable in allowlist mode, e.g. api.anthropic.com or *.openai.com for any subdomain
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+// hostPattern matches an allowlisted host name, optionally starting with a wildcard label
+var hostPattern = regexp.MustCompile(`^(\*\.)?[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// ModeName returns the policy's mode with its default applied
+func (n NetworkPolicy) ModeName() string {
+	switch {
+	case n.Mode != "":
+		return n.Mode
+	case len(n.Allow) > 0:
+		return NetworkAllowlist
+	default:
+		return NetworkUnrestricted
+	}
+}
+
+// Restricted reports whether the policy limits the agent's network, which only the sandbox can enforce
+func (n NetworkPolicy) Restricted() bool {
+	return n.ModeName() != NetworkUnrestricted
+}
+
+// validate checks the mode and the allowlisted hosts of the policy at field
+func (n NetworkPolicy) validate(field string) error {
+	modes := []string{NetworkUnrestricted, NetworkAllowlist, NetworkNone}
+	mode := n.ModeName()
+	switch mode {
+	case NetworkUnrestricted, NetworkNone:
+		if len(n.Allow) > 0 {
+			return fieldError(field+".allow", "%s.allow only applies to the allowlist mode, not %s", field, mode)
+		}
+	case NetworkAllowlist:
+		if len(n.Allow) == 0 {
+			return fieldError(field+".allow", "%s.allow must list at least one host for the allowlist mode", field)
+		}
+	default:
+		err := fieldError(field+".mode", "%s.mode must be unrestricted, allowlist, or none, not '%s'", field, mode)
+		err.Suggestion = suggest(mode, modes)
+		return err
+	}
+	for i, host := range n.Allow {
+		if !hostPattern.MatchString(host) {
+			return fieldError(fmt.Sprintf("%s.allow[%d]", field, i), "%s.allow[%d] must be a host name such as api.openai.com or *.openai.com, not '%s'", field, i, host)
+		}
+	}
+	return nil
+}
+
+// envNamePattern matches a valid environment variable name
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Enabled reports whether agents and tests run in containers
+func (s SandboxConfig) Enabled() bool {
+	return s.Image != ""
+}
+
+// RuntimeName returns the container CLI that runs the containers
+func (s SandboxConfig) RuntimeName() string {
+	if s.Runtime == "" {
+		return "docker"
+	}
+	return s.Runtime
+}
+
+// AgentContainer describes the containers an agent runs in, which reach the network its policy allows
+// memoryBytes is the agent's memory limit, which the runtime enforces (0 for none)
+func (s SandboxConfig) AgentContainer(policy NetworkPolicy, memoryBytes int64) *sandbox.Container {
+	if !s.Enabled() {
+		return nil
+	}
+	network := sandbox.NetworkBridge
+	switch policy.ModeName() {
+	case NetworkNone:
+		network = sandbox.NetworkNone
+	case NetworkAllowlist:
+		network = sandbox.NetworkAllowlist
+	}
+	return &sandbox.Container{
+		Runtime:         s.RuntimeName(),
+		Image:           s.Image,
+		Network:         network,
+		Allow:           policy.Allow,
+		SeccompProfile:  s.SeccompProfile,
+		AppArmorProfile: s.AppArmorProfile,
+		Env:             s.Env,
+		MemoryBytes:     memoryBytes,
+	}
+}
+
+// TestContainer describes the containers tests run in, which have no network unless TestNetwork is set
+func (s SandboxConfig) TestContainer() *sandbox.Container {
+	if !s.Enabled() {
+		return nil
+	}
+	network := sandbox.NetworkNone
+	if s.TestNetwork {
+		network = sandbox.NetworkBridge
+	}
+	return &sandbox.Container{
+		Runtime:         s.RuntimeName(),
+		Image:           s.Image,
+		Network:         network,
+		SeccompProfile:  s.SeccompProfile,
+		AppArmorProfile: s.AppArmorProfile,
+	}
+}
+
+// Check reports whether the container runtime can be found with lookPath, so a sandboxed run fails
+// before anything runs outside the sandbox
+func (s SandboxConfig) Check(lookPath func(string) (string, error)) error {
+	if !s.Enabled() {
+		return nil
+	}
+	if _, err := lookPath(s.RuntimeName()); err != nil {
+		return fmt.Errorf("the sandbox needs %s, which was not found: %w", s.RuntimeName(), err)
+	}
+	return nil
+}
+
+// validate checks the runtime and the names of the passed environment variables
+func (s SandboxConfig) validate() error {
+	if s.Runtime != "" && s.Runtime != "docker" && s.Runtime != "podman" {
+		err := fieldError("sandbox.runtime", "sandbox.runtime must be docker or podman, not '%s'", s.Runtime)
+		err.Suggestion = suggest(s.Runtime, []string{"docker", "podman"})
+		return err
+	}
+	for i, name := range s.Env {
+		if !envNamePattern.MatchString(name) {
+			return fieldError(fmt.Sprintf("sandbox.env[%d]", i), "sandbox.env[%d] must be an environment variable name, not '%s'", i, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// KnownAgents lists the agent CLIs that can be discovered on PATH
+var KnownAgents = []string{"aider", "amp", "claude", "codex", "gemini"}
+
+// knownAgentArgs holds the arguments that put a known agent CLI into non-interactive mode
+// The prompt is passed after these arguments; agents without an entry take the prompt alone.
+// These agents run inside their worktree rather than taking its path as a flag
+var knownAgentArgs = map[string][]string{
+	"aider":  {"--yes-always", "--no-auto-commits", "--message"},
+	"gemini": {"--yolo", "--prompt"},
+}
+
+// Project describes what was discovered about a repository when scaffolding a config
+type Project struct {
+	// Language is the primary language detected from build files (empty if unknown)
+	Language string
+
+	// TestCommand is the suggested command for running the repository's tests
+	TestCommand string
+}
+
+// makeTestTargetRegex matches a "test" target in a Makefile
+var makeTestTargetRegex = regexp.MustCompile(`(?m)^test\s*:`)
+
+// DetectProject inspects a repository's build files to find its language and test tooling
+// A Makefile test target is preferred since it is the project's own entry point for tests
+func DetectProject(repoPath string) Project {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(repoPath, name))
+		return err == nil
+	}
+
+	var project Project
+	switch {
+	case exists("go.mod"):
+		project = Project{Language: "go", TestCommand: "go test ./..."}
+	case exists("Cargo.toml"):
+		project = Project{Language: "rust", TestCommand: "cargo test"}
+	case exists("package.json"):
+		project = Project{Language: "javascript", TestCommand: nodeTestCommand(repoPath, exists)}
+	case exists("pyproject.toml"), exists("setup.py"), exists("requirements.txt"):
+		project = Project{Language: "python", TestCommand: "pytest"}
+	case exists("pom.xml"):
+		project = Project{Language: "java", TestCommand: "mvn test"}
+	case exists("gradlew"):
+		project = Project{Language: "java", TestCommand: "./gradlew test"}
+	case exists("build.gradle"), exists("build.gradle.kts"):
+		project = Project{Language: "java", TestCommand: "gradle test"}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(repoPath, "Makefile")); err == nil && makeTestTargetRegex.Match(data) {
+		project.TestCommand = "make test"
+	}
+
+	return project
+}
+
+// nodeTestCommand picks the command used to run a Node project's tests
+func nodeTestCommand(repoPath string, exists func(string) bool) string {
+	var pkg struct {
+		Scripts         map[string]string `json:"scripts"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	data, err := os.ReadFile(filepath.Join(repoPath, "package.json"))
+	if err == nil {
+		_ = json.Unmarshal(data, &pkg)
+	}
+
+	// npm's placeholder test script always fails, so look for a test framework instead
+	if script, ok := pkg.Scripts["test"]; !ok || strings.Contains(script, "no test specified") {
+		if _, ok := pkg.DevDependencies["vitest"]; ok {
+			return "npx vitest run"
+		}
+		if _, ok := pkg.DevDependencies["jest"]; ok {
+			return "npx jest"
+		}
+	}
+
+	switch {
+	case exists("pnpm-lock.yaml"):
+		return "pnpm test"
+	case exists("yarn.lock"):
+		return "yarn test"
+	default:
+		return "npm test"
+	}
+}
+
+// DiscoverAgents returns the known agent CLIs that lookPath can find
+func DiscoverAgents(lookPath func(string) (string, error)) []string {
+	var found []string
+	for _, name := range KnownAgents {
+		if _, err := lookPath(name); err == nil {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// ScaffoldConfig renders a starter YAML configuration for a project and its discovered agents
+// When no agents were found a placeholder agent is written so the config is still valid
+func ScaffoldConfig(project Project, agents []string, workingDir string) string {
+	var sb strings.Builder
+
+	sb.WriteString("# Orchestrator configuration generated by `orchestrator init`\n\n")
+	sb.WriteString("# Directory for creating temporary git worktrees\n")
+	sb.WriteString(fmt.Sprintf("working_dir: %q\n\n", workingDir))
+
+	testCommand := project.TestCommand
+	switch {
+	case testCommand == "":
+		sb.WriteString("# Command to run tests (no test tooling was detected; update this)\n")
+		testCommand = "make test"
+	case project.Language != "":
+		sb.WriteString(fmt.Sprintf("# Command to run tests (detected from the %s project)\n", project.Language))
+	default:
+		sb.WriteString("# Command to run tests\n")
+	}
+	sb.WriteString(fmt.Sprintf("test_command: %q\n\n", testCommand))
+
+	sb.WriteString("# Maximum time to wait for agent responses (in seconds)\n")
+	sb.WriteString("timeout_seconds: 300\n\n")
+
+	sb.WriteString("# AI coding agents to run in parallel\n")
+	sb.WriteString("agents:\n")
+	if len(agents) == 0 {
+		sb.WriteString("  # No known agent CLIs were found on PATH; point this at your agent\n")
+		sb.WriteString("  - id: \"my-agent\"\n")
+		sb.WriteString("    type: \"cli\"\n")
+		sb.WriteString("    config:\n")
+		sb.WriteString("      command: \"/path/to/agent\"\n")
+		sb.WriteString("      args: []\n")
+	}
+	for _, agent := range agents {
+		sb.WriteString(fmt.Sprintf("  - id: %q\n", agent))
+		sb.WriteString("    type: \"cli\"\n")
+		sb.WriteString("    config:\n")
+		sb.WriteString(fmt.Sprintf("      command: %q\n", agent))
+		if args := knownAgentArgs[agent]; len(args) > 0 {
+			quoted := make([]string, len(args))
+			for i, arg := range args {
+				quoted[i] = fmt.Sprintf("%q", arg)
+			}
+			sb.WriteString(fmt.Sprintf("      args: [%s]\n", strings.Join(quoted, ", ")))
+			sb.WriteString("      worktree_flag: \"\"\n")
+		}
+	}
+
+	return sb.String()
+}
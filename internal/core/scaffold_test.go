@@ -0,0 +1,117 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectProject(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected Project
+	}{
+		{
+			name:     "go module",
+			files:    map[string]string{"go.mod": "module example.com/x\n"},
+			expected: Project{Language: "go", TestCommand: "go test ./..."},
+		},
+		{
+			name:     "rust crate",
+			files:    map[string]string{"Cargo.toml": "[package]\n"},
+			expected: Project{Language: "rust", TestCommand: "cargo test"},
+		},
+		{
+			name: "node with yarn",
+			files: map[string]string{
+				"package.json": `{"scripts": {"test": "jest"}}`,
+				"yarn.lock":    "",
+			},
+			expected: Project{Language: "javascript", TestCommand: "yarn test"},
+		},
+		{
+			name:     "node with placeholder test script",
+			files:    map[string]string{"package.json": `{"scripts": {"test": "echo \"Error: no test specified\" && exit 1"}, "devDependencies": {"vitest": "^1.0.0"}}`},
+			expected: Project{Language: "javascript", TestCommand: "npx vitest run"},
+		},
+		{
+			name:     "python",
+			files:    map[string]string{"pyproject.toml": "[project]\n"},
+			expected: Project{Language: "python", TestCommand: "pytest"},
+		},
+		{
+			name: "makefile test target wins",
+			files: map[string]string{
+				"go.mod":   "module example.com/x\n",
+				"Makefile": ".PHONY: test\n\ntest:\n\tgo test -race ./...\n",
+			},
+			expected: Project{Language: "go", TestCommand: "make test"},
+		},
+		{
+			name:     "nothing detected",
+			files:    map[string]string{"README.md": "# x\n"},
+			expected: Project{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+			}
+			assert.Equal(t, tc.expected, DetectProject(dir))
+		})
+	}
+}
+
+func TestDiscoverAgents(t *testing.T) {
+	lookPath := func(name string) (string, error) {
+		if name == "claude" || name == "codex" {
+			return "/usr/local/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	assert.Equal(t, []string{"claude", "codex"}, DiscoverAgents(lookPath))
+}
+
+func TestScaffoldConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		project Project
+		agents  []string
+	}{
+		{name: "discovered agents", project: Project{Language: "go", TestCommand: "go test ./..."}, agents: []string{"aider", "amp", "claude"}},
+		{name: "no agents or tests", project: Project{}, agents: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The generated config must load and validate
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(configPath, []byte(ScaffoldConfig(tc.project, tc.agents, "/tmp/worktrees")), 0644))
+
+			cfg, err := Load(configPath)
+			require.NoError(t, err)
+			assert.Equal(t, "/tmp/worktrees", cfg.WorkingDir)
+			assert.NotEmpty(t, cfg.TestCommand)
+
+			if len(tc.agents) == 0 {
+				require.Len(t, cfg.Agents, 1, "A placeholder agent should be written")
+				return
+			}
+			require.Len(t, cfg.Agents, len(tc.agents))
+			for i, agent := range tc.agents {
+				assert.Equal(t, agent, cfg.Agents[i].ID)
+				// Scaffolded agents run the same way as agents discovered at run time
+				assert.Equal(t, DiscoveredAgentConfigs([]string{agent})[0].Config, cfg.Agents[i].Config)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// normalizeScope cleans a subtree path given relative to the repository root, such as "pkg/service-a/"
+// The root itself, "." or "", scopes nothing
+func normalizeScope(scope string) (string, error) {
+	scope = strings.TrimSpace(strings.ReplaceAll(scope, "\\", "/"))
+	if scope == "" {
+		return "", nil
+	}
+	if path.IsAbs(scope) {
+		return "", fieldError("scope", "scope must be a path relative to the repository root, not '%s'", scope)
+	}
+	scope = path.Clean(scope)
+	if scope == ".." || strings.HasPrefix(scope, "../") {
+		return "", fieldError("scope", "scope must be inside the repository, not '%s'", scope)
+	}
+	if scope == "." {
+		return "", nil
+	}
+	return scope, nil
+}
+
+// InScope reports whether a file, relative to the repository root, is inside the scope (every file is when there is none)
+func InScope(file, scope string) bool {
+	return scope == "" || file == scope || strings.HasPrefix(file, scope+"/")
+}
+
+// ScopedFiles returns the files inside the scope, keeping their order
+func ScopedFiles(files []string, scope string) []string {
+	if scope == "" {
+		return files
+	}
+	var scoped []string
+	for _, file := range files {
+		if InScope(file, scope) {
+			scoped = append(scoped, file)
+		}
+	}
+	return scoped
+}
+
+// SetScope confines the run to a subtree of the repository: changes outside it are treated as breaking the path
+// policy, and tests run from it. An empty scope covers the whole repository
+func (c *Config) SetScope(scope string) error {
+	scope, err := normalizeScope(scope)
+	if err != nil {
+		return err
+	}
+	c.Scope = scope
+	c.Paths.scope = scope
+	return nil
+}
+
+// CheckScope checks that the scope is a directory of the checkout at repo
+func CheckScope(repo, scope string) error {
+	if scope == "" {
+		return nil
+	}
+	info, err := os.Stat(filepath.Join(repo, filepath.FromSlash(scope)))
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("scope %s is not a directory of the repository", scope)
+	}
+	return nil
+}
+
+// ScopePrompt tells agents which subtree they are confined to, for inclusion at the end of a prompt
+func ScopePrompt(scope string) string {
+	if scope == "" {
+		return ""
+	}
+	return "\nWork only in " + scope + "/: changes outside it are reverted, and only its tests are run.\n"
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_SetScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  string
+		valid bool
+	}{
+		{"services/api", "services/api", true},
+		{"./services/api/", "services/api", true},
+		{"services\\api", "services/api", true},
+		{".", "", true},
+		{"", "", true},
+		{"/services/api", "", false},
+		{"../other", "", false},
+		{"services/../..", "", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.scope, func(t *testing.T) {
+			cfg := &Config{}
+			err := cfg.SetScope(tc.scope)
+			if !tc.valid {
+				var configErr *ConfigError
+				require.ErrorAs(t, err, &configErr)
+				assert.Equal(t, "scope", configErr.Field)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, cfg.Scope)
+		})
+	}
+
+	// Changes outside the scope break the path policy, on top of its own patterns
+	cfg := &Config{Paths: PathPolicy{Deny: []string{".env*"}}}
+	require.NoError(t, cfg.SetScope("services/api"))
+	assert.True(t, cfg.Paths.Enabled())
+	assert.True(t, cfg.Paths.Permits("services/api/handler.go"))
+	assert.False(t, cfg.Paths.Permits("services/apiserver/main.go"), "Scopes are directories, not name prefixes")
+	assert.Equal(t, []string{".env.production", "services/billing/util.go"}, cfg.Paths.Violations(pathPolicyDiff))
+
+	assert.Equal(t, []string{"services/api/a.go", "services/api/b/c.go"},
+		ScopedFiles([]string{"go.mod", "services/api/a.go", "services/billing/a.go", "services/api/b/c.go"}, "services/api"))
+	assert.Contains(t, ScopePrompt("services/api"), "Work only in services/api/")
+	assert.Empty(t, ScopePrompt(""))
+}
+
+func TestTestRunner_Dir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test that runs a command in short mode")
+	}
+
+	repo := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "services", "api"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "services", "api", "handler.go"), []byte("package api\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "go.mod"), []byte("module example\n"), 0o644))
+
+	require.NoError(t, CheckScope(repo, "services/api"))
+	assert.Error(t, CheckScope(repo, "services/billing"))
+	assert.Error(t, CheckScope(repo, "go.mod"))
+
+	// Tests run from the scope, so they only see its files
+	runner := NewTestRunner("ls", 0)
+	runner.Dir = "services/api"
+	result, err := runner.Run(context.Background(), repo)
+	require.NoError(t, err)
+	assert.Contains(t, result.Output, "handler.go")
+	assert.NotContains(t, result.Output, "go.mod")
+}
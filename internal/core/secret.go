@@ -0,0 +1,158 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretScheme prefixes config values that reference a secret instead of containing it
+// Supported forms are secret://env:NAME, secret://file:path, and secret://keychain:service[/account]
+const SecretScheme = "secret://"
+
+// RedactedSecret replaces secret values in text that would otherwise be persisted
+const RedactedSecret = "[REDACTED]"
+
+// lookupKeychain reads a password from the OS keychain
+// It is a variable so tests can substitute a fake keychain
+var lookupKeychain = func(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		args := []string{"find-generic-password", "-s", service, "-w"}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+		cmd = exec.Command("security", args...)
+	case "linux":
+		args := []string{"lookup", "service", service}
+		if account != "" {
+			args = append(args, "account", account)
+		}
+		cmd = exec.Command("secret-tool", args...)
+	default:
+		return "", fmt.Errorf("keychain secrets are not supported on %s", runtime.GOOS)
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("keychain lookup failed: %w", err)
+	}
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// ResolveSecret returns the value referenced by a secret:// reference
+// Relative file paths are resolved against baseDir and "~/" against the home directory
+func ResolveSecret(ref, baseDir string) (string, error) {
+	if !strings.HasPrefix(ref, SecretScheme) {
+		return "", fmt.Errorf("'%s' is not a secret reference", ref)
+	}
+
+	source, name, ok := strings.Cut(strings.TrimPrefix(ref, SecretScheme), ":")
+	if !ok || name == "" {
+		return "", fmt.Errorf("secret reference must have the form %senv:NAME, %sfile:path, or %skeychain:service", SecretScheme, SecretScheme, SecretScheme)
+	}
+
+	var value string
+	switch source {
+	case "env":
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		value = envValue
+	case "file":
+		path := name
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve home directory: %w", err)
+			}
+			path = filepath.Join(home, rest)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	case "keychain":
+		service, account, _ := strings.Cut(name, "/")
+		keychainValue, err := lookupKeychain(service, account)
+		if err != nil {
+			return "", err
+		}
+		value = keychainValue
+	default:
+		return "", fmt.Errorf("unknown secret source '%s', must be 'env', 'file', or 'keychain'", source)
+	}
+
+	if value == "" {
+		return "", errors.New("secret is empty")
+	}
+	return value, nil
+}
+
+// resolveSecrets replaces every secret reference in a node tree with its value
+// It returns the resolved values so they can be redacted from run artifacts
+func resolveSecrets(node *yaml.Node, baseDir string) ([]string, error) {
+	var secrets []string
+	var errs ConfigErrors
+
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode && strings.HasPrefix(node.Value, SecretScheme) {
+			value, err := ResolveSecret(node.Value, baseDir)
+			if err != nil {
+				errs = append(errs, &ConfigError{
+					Line:    node.Line,
+					Column:  node.Column,
+					Message: fmt.Sprintf("cannot resolve %s: %v", node.Value, err),
+				})
+				return
+			}
+			node.Value = value
+			node.Tag = "!!str"
+			secrets = append(secrets, value)
+			return
+		}
+
+		for i, child := range node.Content {
+			// Leave mapping keys alone
+			if node.Kind == yaml.MappingNode && i%2 == 0 {
+				continue
+			}
+			walk(child)
+		}
+	}
+	walk(node)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return secrets, nil
+}
+
+// Redact replaces every resolved secret value, and every match of a privacy.scrub pattern, in text with a placeholder
+func (c *Config) Redact(text string) string {
+	for _, secret := range c.secrets {
+		text = strings.ReplaceAll(text, secret, RedactedSecret)
+	}
+	for _, scrubber := range c.scrubbers {
+		text = scrubber.ReplaceAllLiteralString(text, RedactedSecret)
+	}
+	return text
+}
+
+// HasSecrets reports whether Redact has anything to remove: resolved secret references or privacy.scrub patterns
+func (c *Config) HasSecrets() bool {
+	return len(c.secrets) > 0 || len(c.scrubbers) > 0
+}
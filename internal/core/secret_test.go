@@ -0,0 +1,99 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("ORCH_TEST_API_KEY", "sk-from-env")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api-key"), []byte("sk-from-file\n"), 0600))
+
+	// Substitute a fake keychain
+	original := lookupKeychain
+	defer func() { lookupKeychain = original }()
+	lookupKeychain = func(service, account string) (string, error) {
+		if service == "orchestrator" && account == "openai" {
+			return "sk-from-keychain", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	tests := []struct {
+		ref      string
+		expected string
+		wantErr  bool
+	}{
+		{ref: "secret://env:ORCH_TEST_API_KEY", expected: "sk-from-env"},
+		{ref: "secret://file:api-key", expected: "sk-from-file"},
+		{ref: "secret://file:" + filepath.Join(dir, "api-key"), expected: "sk-from-file"},
+		{ref: "secret://keychain:orchestrator/openai", expected: "sk-from-keychain"},
+		{ref: "secret://env:ORCH_TEST_UNSET", wantErr: true},
+		{ref: "secret://file:missing", wantErr: true},
+		{ref: "secret://keychain:other", wantErr: true},
+		{ref: "secret://vault:path", wantErr: true},
+		{ref: "secret://ORCH_TEST_API_KEY", wantErr: true},
+		{ref: "plain-value", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.ref, func(t *testing.T) {
+			value, err := ResolveSecret(tc.ref, dir)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+func TestLoadConfig_Secrets(t *testing.T) {
+	t.Setenv("ORCH_TEST_API_KEY", "sk-from-env")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("tok-from-file\n"), 0600))
+
+	configPath := filepath.Join(dir, "config.yaml")
+	configData := `working_dir: "/tmp/test-dir"
+agents:
+  - id: "codex"
+    type: "http"
+    config:
+      api_key: "secret://env:ORCH_TEST_API_KEY"
+      token: secret://file:token
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	assert.Equal(t, "sk-from-env", cfg.Agents[0].Config["api_key"])
+	assert.Equal(t, "tok-from-file", cfg.Agents[0].Config["token"])
+
+	// Resolved values can be redacted from text that gets persisted
+	assert.True(t, cfg.HasSecrets())
+	assert.Equal(t, "+key := \"[REDACTED]\"", cfg.Redact("+key := \"sk-from-env\""))
+
+	// Unresolvable references are reported with their location
+	configData = `working_dir: "/tmp/test-dir"
+agents:
+  - id: "codex"
+    type: "http"
+    config:
+      api_key: "secret://env:ORCH_TEST_UNSET"
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0644))
+
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 6, column 16: cannot resolve secret://env:ORCH_TEST_UNSET")
+}
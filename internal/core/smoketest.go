@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// DefaultSmokeTestPrompt is the task every agent is given by the smoke test unless another is configured
+const DefaultSmokeTestPrompt = "Append the line \"<!-- orchestrator smoke test -->\" to README.md, creating the file if it doesn't exist. Make no other changes."
+
+// DefaultSmokeTestTimeout is how long each agent has to finish the smoke test unless another time is configured
+const DefaultSmokeTestTimeout = time.Minute
+
+// SmokeTestConfig gives every agent a trivial task before a run, and leaves out of the run the agents that fail it
+// An agent with bad credentials, a broken install, or output the orchestrator can't read is then found in seconds,
+// rather than once the run has waited on it
+type SmokeTestConfig struct {
+	// Enabled turns on the smoke test
+	Enabled bool `yaml:"enabled"`
+
+	// Prompt is the task every agent is given (empty for DefaultSmokeTestPrompt)
+	Prompt string `yaml:"prompt,omitempty"`
+
+	// TimeoutSeconds is how long each agent has to finish the task (0 for DefaultSmokeTestTimeout)
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+}
+
+// validate checks the timeout
+func (s SmokeTestConfig) validate() error {
+	if s.TimeoutSeconds < 0 {
+		return fieldError("smoke_test.timeout_seconds", "smoke_test.timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+// Task returns the prompt every agent is given
+func (s SmokeTestConfig) Task() string {
+	if strings.TrimSpace(s.Prompt) == "" {
+		return DefaultSmokeTestPrompt
+	}
+	return s.Prompt
+}
+
+// Timeout returns how long each agent has to finish the task
+func (s SmokeTestConfig) Timeout() time.Duration {
+	if s.TimeoutSeconds == 0 {
+		return DefaultSmokeTestTimeout
+	}
+	return time.Duration(s.TimeoutSeconds) * time.Second
+}
+
+// SmokeTestFailure explains why an agent failed the smoke test, or returns "" if it passed
+// An agent passes when it started, finished in time without an error, emitted events the orchestrator could read,
+// and changed a file. startErr, termination, and diff are as for ClassifyFailure
+func SmokeTestFailure(startErr error, events []*protocol.Event, termination, diff string) string {
+	kind, message := ClassifyFailure(startErr, events, termination, diff)
+	if kind != "" && kind != FailureNoDiff {
+		return fmt.Sprintf("%s: %s", kind, message)
+	}
+
+	// The CLI adapter reports each line it couldn't read as an event
+	unreadable, readable := "", false
+	for _, event := range events {
+		payload, err := event.UnmarshalErrorPayload()
+		if err == nil && payload.Code == "parse_error" {
+			if unreadable == "" {
+				unreadable = payload.Message
+			}
+			continue
+		}
+		readable = true
+	}
+	switch {
+	case !readable && unreadable != "":
+		return "unreadable-output: " + unreadable
+	case !readable:
+		return "no-events: it emitted no events, so its output format may not match its adapter"
+	case kind == FailureNoDiff:
+		return fmt.Sprintf("%s: it finished without changing any file", FailureNoDiff)
+	}
+	return ""
+}
+
+// FormatSmokeTest lists whether each agent, in order, passed the smoke test, with why the others failed
+func FormatSmokeTest(agentIDs []string, failures map[string]string) string {
+	var sb strings.Builder
+
+	sb.WriteString("=== Smoke Test ===\n")
+	for _, id := range agentIDs {
+		if failure, failed := failures[id]; failed {
+			sb.WriteString(fmt.Sprintf("%-20s failed, left out of the run: %s\n", id, failure))
+		} else {
+			sb.WriteString(fmt.Sprintf("%-20s passed\n", id))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmokeTestConfig(t *testing.T) {
+	assert.Equal(t, DefaultSmokeTestPrompt, SmokeTestConfig{}.Task())
+	assert.Equal(t, DefaultSmokeTestTimeout, SmokeTestConfig{}.Timeout())
+
+	smoke := SmokeTestConfig{Prompt: "Add a comment to main.go", TimeoutSeconds: 20}
+	assert.Equal(t, "Add a comment to main.go", smoke.Task())
+	assert.Equal(t, 20*time.Second, smoke.Timeout())
+	assert.Error(t, SmokeTestConfig{TimeoutSeconds: -1}.validate())
+}
+
+func TestSmokeTestFailure(t *testing.T) {
+	errorEvent := func(message, code string) *protocol.Event {
+		event, err := protocol.NewEvent(protocol.EventTypeError, "agent", 1).WithPayload(protocol.ErrorPayload{Message: message, Code: code})
+		require.NoError(t, err)
+		return event
+	}
+	complete := protocol.NewEvent(protocol.EventTypeComplete, "agent", 2)
+	diff := "--- a/README.md\n+++ b/README.md\n@@ -1 +1,2 @@\n # Project\n+<!-- orchestrator smoke test -->\n"
+
+	assert.Empty(t, SmokeTestFailure(nil, []*protocol.Event{complete}, "", diff))
+	assert.Empty(t, SmokeTestFailure(nil, []*protocol.Event{errorEvent("Failed to parse output: banner", "parse_error"), complete}, "", diff),
+		"Lines around the events are fine")
+
+	assert.Equal(t, "binary-missing: exec: \"agent\": executable file not found in $PATH",
+		SmokeTestFailure(&exec.Error{Name: "agent", Err: exec.ErrNotFound}, nil, "", ""))
+	assert.Equal(t, "auth-failure: Invalid API key",
+		SmokeTestFailure(nil, []*protocol.Event{errorEvent("Invalid API key", "")}, "", ""))
+	assert.Equal(t, "timed-out: time limit exceeded: didn't finish within 1m0s",
+		SmokeTestFailure(nil, nil, "time limit exceeded: didn't finish within 1m0s", ""))
+	assert.Equal(t, "crashed: boom", SmokeTestFailure(errors.New("boom"), nil, "", ""))
+	assert.Equal(t, "unreadable-output: Failed to parse output: invalid character 'H'",
+		SmokeTestFailure(nil, []*protocol.Event{errorEvent("Failed to parse output: invalid character 'H'", "parse_error")}, "", diff))
+	assert.Contains(t, SmokeTestFailure(nil, nil, "", diff), "no-events:")
+	assert.Equal(t, "produced-no-diff: it finished without changing any file", SmokeTestFailure(nil, []*protocol.Event{complete}, "", ""))
+}
+
+func TestFormatSmokeTest(t *testing.T) {
+	report := FormatSmokeTest([]string{"claude", "codex"}, map[string]string{"codex": "auth-failure: Invalid API key"})
+	assert.Equal(t, "=== Smoke Test ===\n"+
+		"claude               passed\n"+
+		"codex                failed, left out of the run: auth-failure: Invalid API key\n", report)
+}
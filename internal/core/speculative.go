@@ -0,0 +1,60 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpeculativeConfig evaluates each patch as soon as its agent finishes, rather than once every agent has,
+// and stops the agents still running once a patch is good enough, saving the time and cost of the rest
+type SpeculativeConfig struct {
+	// Enabled turns on speculative evaluation
+	Enabled bool `yaml:"enabled"`
+
+	// MinScore is the least a good enough patch scores (0 for no minimum beyond passing every test)
+	MinScore int `yaml:"min_score,omitempty"`
+
+	// MaxChangedLines is the most lines, added and removed, a good enough patch changes (0 for any number)
+	MaxChangedLines int `yaml:"max_changed_lines,omitempty"`
+}
+
+// validate checks the thresholds can be met
+func (s SpeculativeConfig) validate() error {
+	if s.MaxChangedLines < 0 {
+		return fieldError("speculative.max_changed_lines", "speculative.max_changed_lines must not be negative")
+	}
+	return nil
+}
+
+// GoodEnough reports whether an evaluated patch is good enough to stop the other agents, and if not, why not
+// A good enough patch passes every test, scores at least MinScore, and changes at most MaxChangedLines lines,
+// and its agent finished on its own, within the path policy
+func (s SpeculativeConfig) GoodEnough(result *PatchResult) (bool, string) {
+	switch {
+	case result.Failure != "" || result.Termination != "":
+		return false, "its agent didn't finish"
+	case len(result.PathViolations) > 0 || len(result.ProtectedChanges) > 0:
+		return false, "it broke the path policy"
+	case result.TestResults == nil || !result.TestResults.Success:
+		return false, "its tests don't all pass"
+	case s.MinScore != 0 && result.Score < s.MinScore:
+		return false, fmt.Sprintf("it scored %d, below %d", result.Score, s.MinScore)
+	}
+	if changed := result.DiffStats.LinesAdded + result.DiffStats.LinesRemoved; s.MaxChangedLines > 0 && changed > s.MaxChangedLines {
+		return false, fmt.Sprintf("it changes %d lines, more than %d", changed, s.MaxChangedLines)
+	}
+	return true, ""
+}
+
+// StoppedEarly is the termination reason of agents stopped because another agent's patch was good enough
+func StoppedEarly(winner string) string {
+	return fmt.Sprintf("%s%s's patch was good enough", stoppedEarlyPrefix, winner)
+}
+
+// IsStoppedEarly reports whether a termination reason is StoppedEarly's
+func IsStoppedEarly(termination string) bool {
+	return strings.HasPrefix(termination, stoppedEarlyPrefix)
+}
+
+// stoppedEarlyPrefix starts every StoppedEarly reason
+const stoppedEarlyPrefix = "stopped early: "
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpeculativeConfig_GoodEnough(t *testing.T) {
+	passing := func(change func(*PatchResult)) *PatchResult {
+		result := &PatchResult{
+			AgentID:     "claude",
+			Diff:        "diff",
+			DiffStats:   gitutil.DiffStats{LinesAdded: 3, LinesRemoved: 2},
+			TestResults: &TestResult{Success: true},
+			Score:       40,
+		}
+		if change != nil {
+			change(result)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		config SpeculativeConfig
+		result *PatchResult
+		good   bool
+	}{
+		{"passing tests", SpeculativeConfig{}, passing(nil), true},
+		{"within thresholds", SpeculativeConfig{MinScore: 40, MaxChangedLines: 5}, passing(nil), true},
+		{"failing tests", SpeculativeConfig{}, passing(func(r *PatchResult) { r.TestResults.Success = false }), false},
+		{"not tested", SpeculativeConfig{}, passing(func(r *PatchResult) { r.TestResults = nil }), false},
+		{"low score", SpeculativeConfig{MinScore: 41}, passing(nil), false},
+		{"large diff", SpeculativeConfig{MaxChangedLines: 4}, passing(nil), false},
+		{"terminated", SpeculativeConfig{}, passing(func(r *PatchResult) { r.Termination = "cost limit exceeded" }), false},
+		{"failed", SpeculativeConfig{}, passing(func(r *PatchResult) { r.Failure = FailureCrashed }), false},
+		{"path violations", SpeculativeConfig{}, passing(func(r *PatchResult) { r.PathViolations = []string{"go.mod"} }), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			good, why := tc.config.GoodEnough(tc.result)
+			assert.Equal(t, tc.good, good)
+			assert.Equal(t, tc.good, why == "", "Only patches that aren't good enough say why: %q", why)
+		})
+	}
+
+	assert.Error(t, SpeculativeConfig{MaxChangedLines: -1}.validate())
+	assert.NoError(t, SpeculativeConfig{Enabled: true, MinScore: -5}.validate(), "Scores can be negative")
+}
+
+func TestRankPatches_Speculative(t *testing.T) {
+	arbitrator := NewArbitrator(NewTestRunner("false", 0), t.TempDir())
+
+	// Patches evaluated as their agent finished aren't evaluated again, and those of agents stopped early rank last
+	winner := &PatchResult{AgentID: "codex", Diff: "diff", TestResults: &TestResult{Success: true}, Score: 5}
+	stopped := &PatchDetails{
+		Diff:        "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n",
+		Termination: StoppedEarly("codex"),
+	}
+	stopped.Result = arbitrator.SkipEvaluation("claude", stopped, "stopped early")
+	assert.True(t, IsStoppedEarly(stopped.Result.Termination))
+	assert.Equal(t, 1, stopped.Result.DiffStats.LinesAdded)
+	assert.Nil(t, stopped.Result.TestResults)
+
+	var evaluated []string
+	arbitrator.SetEvaluatedHook(func(result *PatchResult) { evaluated = append(evaluated, result.AgentID) })
+	ranked, err := arbitrator.RankPatches(context.Background(), map[string]*PatchDetails{
+		"codex":  {Diff: "diff", Result: winner},
+		"claude": stopped,
+		"amp":    {Diff: "", Termination: "idle limit exceeded"},
+	})
+	require.NoError(t, err)
+	require.Len(t, ranked, 3)
+	assert.Same(t, winner, ranked[0])
+	assert.Equal(t, "amp", ranked[1].AgentID)
+	assert.Equal(t, "claude", ranked[2].AgentID)
+	assert.Equal(t, []string{"amp"}, evaluated)
+}
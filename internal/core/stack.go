@@ -0,0 +1,46 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StackConfig stacks several patches into a run's result when the best one alone leaves tests failing, as it may on
+// a task list or a prompt with several parts that different agents each got right
+// Patches are applied on top of the best one in rank order, and each is kept only if it applies cleanly and the
+// tests, run again after it is applied, improve
+type StackConfig struct {
+	// MaxPatches is the most patches stacked into the result, the best one included (0 or 1 turns stacking off)
+	MaxPatches int `yaml:"max_patches,omitempty"`
+}
+
+// validate checks the patch count
+func (s StackConfig) validate() error {
+	if s.MaxPatches < 0 {
+		return fieldError("stack.max_patches", "stack.max_patches must not be negative")
+	}
+	return nil
+}
+
+// Stackable reports whether a patch may be stacked on the best one: its agent finished on its own within the path
+// policy, it changes something, and its tests ran
+func Stackable(result *PatchResult) bool {
+	return result.Failure == "" && result.Termination == "" && strings.TrimSpace(result.Diff) != "" && result.TestResults != nil
+}
+
+// StackImproves reports whether the tests after stacking a patch improved on those before: fewer fail, and no fewer pass
+func StackImproves(before, after *TestResult) bool {
+	return before != nil && after != nil && after.FailedTests < before.FailedTests && after.PassedTests >= before.PassedTests
+}
+
+// StackedResult returns the best patch with the patches of the stacked agents applied on top of it, as evaluated,
+// keeping how the best patch's agent ran
+func StackedResult(best, evaluated *PatchResult, stacked []string) *PatchResult {
+	result := *best
+	result.WorktreePath, result.Diff, result.DiffStats = evaluated.WorktreePath, evaluated.Diff, evaluated.DiffStats
+	result.TestResults, result.Mutation = evaluated.TestResults, evaluated.Mutation
+	result.Score, result.Breakdown = evaluated.Score, evaluated.Breakdown
+	result.Reason = fmt.Sprintf("%s; stacked with %s", evaluated.Reason, strings.Join(stacked, ", "))
+	result.Stacked = stacked
+	return &result
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackImproves(t *testing.T) {
+	before := &TestResult{PassedTests: 3, FailedTests: 2}
+	assert.True(t, StackImproves(before, &TestResult{PassedTests: 4, FailedTests: 1}))
+	assert.False(t, StackImproves(before, &TestResult{PassedTests: 3, FailedTests: 2}), "Nothing was fixed")
+	assert.False(t, StackImproves(before, &TestResult{PassedTests: 2, FailedTests: 1}), "A passing test broke")
+	assert.False(t, StackImproves(before, nil), "The tests didn't run")
+}
+
+func TestStackable(t *testing.T) {
+	tested := &TestResult{FailedTests: 1}
+	assert.True(t, Stackable(&PatchResult{Diff: "diff", TestResults: tested}))
+	assert.False(t, Stackable(&PatchResult{Diff: " ", TestResults: tested}), "No changes")
+	assert.False(t, Stackable(&PatchResult{Diff: "diff"}), "Not tested")
+	assert.False(t, Stackable(&PatchResult{Diff: "diff", TestResults: tested, Termination: "time limit exceeded"}))
+	assert.False(t, Stackable(&PatchResult{Diff: "diff", TestResults: tested, Failure: FailureDeniedPaths}))
+}
+
+func TestStackedResult(t *testing.T) {
+	best := &PatchResult{AgentID: "claude", Diff: "a", Score: 50, Reason: "1 test fails", Usage: AgentUsage{Tokens: 100}, Refinements: 1}
+	evaluated := &PatchResult{AgentID: "claude", Diff: "a+b", Score: 120, Reason: "All tests pass", TestResults: &TestResult{Success: true}}
+
+	stacked := StackedResult(best, evaluated, []string{"codex"})
+	assert.Equal(t, "claude", stacked.AgentID)
+	assert.Equal(t, "a+b", stacked.Diff)
+	assert.Equal(t, 120, stacked.Score)
+	assert.Equal(t, "All tests pass; stacked with codex", stacked.Reason)
+	assert.Equal(t, 100, stacked.Usage.Tokens, "The best agent's usage is kept")
+	assert.Equal(t, 1, stacked.Refinements)
+	assert.Equal(t, []string{"codex"}, stacked.Stacked)
+	assert.Empty(t, best.Stacked, "The best patch is unchanged")
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatsFilter selects the runs agent statistics are gathered from; unset fields match every run
+type StatsFilter struct {
+	// Since skips runs that started before it
+	Since time.Time
+
+	// Repo keeps runs whose recorded repository contains it, e.g. "org/repo" or an absolute path
+	Repo string
+
+	// Labels keeps runs whose task has any of them
+	Labels []string
+}
+
+// matches reports whether a run passes the filter
+func (f StatsFilter) matches(report *RunReport, started time.Time) bool {
+	if !f.Since.IsZero() && started.Before(f.Since) {
+		return false
+	}
+	if f.Repo != "" && !strings.Contains(report.Repo, f.Repo) {
+		return false
+	}
+	if len(f.Labels) == 0 {
+		return true
+	}
+	for _, label := range f.Labels {
+		for _, taskLabel := range report.Task.Labels {
+			if label == taskLabel {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Periods agent statistics can be grouped by, to show how agents change over time
+const (
+	StatsPeriodWeek  = "week"
+	StatsPeriodMonth = "month"
+)
+
+// AgentStats summarizes how an agent did over a set of runs
+type AgentStats struct {
+	// AgentID is the agent; samples count toward the agent they belong to
+	AgentID string
+
+	// Period is the week (e.g. 2024-W05) or month (e.g. 2024-02) the runs started in, or "" for all of them
+	Period string
+
+	// Runs is how many times the agent ran
+	Runs int
+
+	// Wins is how many of those runs selected the agent's patch, not counting runs where it changed nothing
+	Wins int
+
+	// Solved is how many of the agent's patches changed code and left every test passing
+	Solved int
+
+	// Totals the averages are taken from
+	TotalScore    int
+	TotalCostUSD  float64
+	TotalDuration time.Duration
+}
+
+// WinRate returns the fraction of the agent's runs it won
+func (s AgentStats) WinRate() float64 {
+	return ratio(float64(s.Wins), s.Runs)
+}
+
+// AvgScore returns the agent's average patch score
+func (s AgentStats) AvgScore() float64 {
+	return ratio(float64(s.TotalScore), s.Runs)
+}
+
+// AvgCostUSD returns what the agent spent on an average run
+func (s AgentStats) AvgCostUSD() float64 {
+	return ratio(s.TotalCostUSD, s.Runs)
+}
+
+// AvgDuration returns how long an average run of the agent took
+func (s AgentStats) AvgDuration() time.Duration {
+	return time.Duration(ratio(float64(s.TotalDuration), s.Runs))
+}
+
+// ratio divides a total by a count, returning 0 for no count
+func ratio(total float64, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// LoadAgentStats gathers each agent's statistics from the reports of the runs in an artifacts directory
+// period groups them by StatsPeriodWeek or StatsPeriodMonth ("" for one row per agent). It returns the
+// statistics as a leaderboard, best win rate first within each period, and how many runs they cover
+func LoadAgentStats(artifactsDir string, filter StatsFilter, period string) ([]AgentStats, int, error) {
+	if period != "" && period != StatsPeriodWeek && period != StatsPeriodMonth {
+		return nil, 0, fmt.Errorf("invalid period '%s', must be '%s' or '%s'", period, StatsPeriodWeek, StatsPeriodMonth)
+	}
+
+	runs, err := ListRuns(artifactsDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	type key struct{ period, agentID string }
+	stats := make(map[key]*AgentStats)
+	counted := 0
+	for _, run := range runs {
+		runDir := filepath.Join(artifactsDir, run)
+		report, err := ReadReport(runDir)
+		if err != nil {
+			continue
+		}
+		started := runTime(runDir)
+		if !filter.matches(report, started) {
+			continue
+		}
+		counted++
+
+		for _, candidate := range report.Candidates {
+			k := key{periodOf(started, period), SampleOf(candidate.AgentID)}
+			s := stats[k]
+			if s == nil {
+				s = &AgentStats{AgentID: k.agentID, Period: k.period}
+				stats[k] = s
+			}
+			s.Runs++
+			changed := candidate.FilesChanged > 0
+			if candidate.AgentID == report.Best && changed {
+				s.Wins++
+			}
+			if changed && candidate.TestsTotal > 0 && candidate.TestsFailed == 0 {
+				s.Solved++
+			}
+			s.TotalScore += candidate.Score
+			s.TotalCostUSD += candidate.CostUSD
+			s.TotalDuration += time.Duration(candidate.DurationSeconds * float64(time.Second))
+		}
+	}
+
+	leaderboard := make([]AgentStats, 0, len(stats))
+	for _, s := range stats {
+		leaderboard = append(leaderboard, *s)
+	}
+	sort.Slice(leaderboard, func(i, j int) bool {
+		a, b := leaderboard[i], leaderboard[j]
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.WinRate() != b.WinRate() {
+			return a.WinRate() > b.WinRate()
+		}
+		if a.AvgScore() != b.AvgScore() {
+			return a.AvgScore() > b.AvgScore()
+		}
+		return a.AgentID < b.AgentID
+	})
+	return leaderboard, counted, nil
+}
+
+// periodOf names the week or month a time falls in
+func periodOf(t time.Time, period string) string {
+	switch period {
+	case StatsPeriodWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case StatsPeriodMonth:
+		return t.Format("2006-01")
+	}
+	return ""
+}
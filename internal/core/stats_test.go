@@ -0,0 +1,89 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAgentStats(t *testing.T) {
+	artifactsDir := t.TempDir()
+	writeRun := func(runID, repo string, labels []string, best string, candidates ...*PatchResult) {
+		w, err := NewRunWriter(filepath.Join(artifactsDir, runID), &Config{})
+		require.NoError(t, err)
+		result := &TaskResult{RunID: runID, Repo: repo, Task: Task{Labels: labels}, Candidates: candidates}
+		for _, candidate := range candidates {
+			if candidate.AgentID == best {
+				result.Best = candidate
+			}
+		}
+		require.NoError(t, w.WriteReport(result))
+	}
+	passing := func(agentID string, score int, cost float64) *PatchResult {
+		return &PatchResult{
+			AgentID:     agentID,
+			Score:       score,
+			DiffStats:   gitutil.DiffStats{FilesChanged: 1},
+			TestResults: &TestResult{Success: true, TotalTests: 2, PassedTests: 2},
+			Usage:       AgentUsage{CostUSD: cost, Duration: time.Minute},
+		}
+	}
+	unchanged := func(agentID string) *PatchResult {
+		return &PatchResult{AgentID: agentID, Usage: AgentUsage{CostUSD: 0.1, Duration: 3 * time.Minute}}
+	}
+
+	writeRun("20240105-000000-aaaaaa", "/src/api", []string{"bug"}, "claude", passing("claude", 150, 1), unchanged("codex"))
+	writeRun("20240210-000000-bbbbbb", "/src/api", []string{"feature"}, "codex#2", passing("claude", 100, 3), passing("codex#1", 90, 0.5), passing("codex#2", 160, 0.5))
+	writeRun("20240215-000000-cccccc", "https://github.com/org/web.git", []string{"bug"}, "claude", unchanged("claude"), unchanged("codex"))
+
+	leaderboard, runs, err := LoadAgentStats(artifactsDir, StatsFilter{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, runs)
+	require.Len(t, leaderboard, 2)
+	claude, codex := leaderboard[0], leaderboard[1]
+	assert.Equal(t, "claude", claude.AgentID, "Winning the most runs ranks first")
+	assert.Equal(t, 3, claude.Runs)
+	assert.Equal(t, 1, claude.Wins, "A selected patch that changed nothing isn't a win")
+	assert.Equal(t, 2, claude.Solved)
+	assert.InDelta(t, 1.0/3, claude.WinRate(), 0.001)
+	assert.InDelta(t, 250.0/3, claude.AvgScore(), 0.001)
+	assert.InDelta(t, 4.1/3, claude.AvgCostUSD(), 0.001)
+	assert.Equal(t, 5*time.Minute/3, claude.AvgDuration())
+	assert.Equal(t, "codex", codex.AgentID, "Samples count toward their agent")
+	assert.Equal(t, 4, codex.Runs)
+	assert.Equal(t, 1, codex.Wins)
+
+	// Runs are filtered by repository, labels, and age
+	leaderboard, runs, err = LoadAgentStats(artifactsDir, StatsFilter{Repo: "org/web"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, 0, leaderboard[0].Wins)
+	_, runs, err = LoadAgentStats(artifactsDir, StatsFilter{Labels: []string{"feature", "docs"}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, runs)
+	_, runs, err = LoadAgentStats(artifactsDir, StatsFilter{Since: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Labels: []string{"bug"}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, runs)
+
+	// Grouping by month shows each agent's statistics over time
+	leaderboard, _, err = LoadAgentStats(artifactsDir, StatsFilter{}, StatsPeriodMonth)
+	require.NoError(t, err)
+	require.Len(t, leaderboard, 4)
+	assert.Equal(t, []string{"2024-01", "2024-01", "2024-02", "2024-02"}, []string{leaderboard[0].Period, leaderboard[1].Period, leaderboard[2].Period, leaderboard[3].Period})
+	assert.Equal(t, "claude", leaderboard[0].AgentID)
+	assert.Equal(t, "codex", leaderboard[2].AgentID)
+	leaderboard, _, err = LoadAgentStats(artifactsDir, StatsFilter{}, StatsPeriodWeek)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-W01", leaderboard[0].Period)
+
+	_, _, err = LoadAgentStats(artifactsDir, StatsFilter{}, "year")
+	assert.Error(t, err)
+	leaderboard, runs, err = LoadAgentStats(filepath.Join(artifactsDir, "missing"), StatsFilter{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, runs)
+	assert.Empty(t, leaderboard)
+}
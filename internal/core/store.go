@@ -0,0 +1,245 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ObjectsDir is the content-addressed store inside an artifacts directory
+// Patches and test logs are kept there once, named by their SHA-256, and hard-linked
+// into the runs that produced them, so run directories hold plain files while identical content,
+// such as the winning patch and the agent's own, takes space once
+const ObjectsDir = ".objects"
+
+// RetentionConfig limits how much run history an artifacts directory keeps
+// Runs past a limit are deleted, oldest first, when a run finishes and by `orchestrator clean --runs`
+type RetentionConfig struct {
+	// MaxAgeDays deletes runs older than this many days (0 keeps runs of any age)
+	MaxAgeDays int `yaml:"max_age_days"`
+
+	// MaxSizeMB deletes the oldest runs until the artifacts directory is at most this size (0 for no limit)
+	MaxSizeMB int64 `yaml:"max_size_mb"`
+
+	// KeepRuns is how many of the most recent runs are kept whatever their age or size (defaults to 1)
+	KeepRuns int `yaml:"keep_runs"`
+}
+
+// Enabled reports whether any retention limit is set
+func (r RetentionConfig) Enabled() bool {
+	return r.MaxAgeDays > 0 || r.MaxSizeMB > 0
+}
+
+// validate checks that the retention limits aren't negative
+func (r RetentionConfig) validate() error {
+	if r.MaxAgeDays < 0 || r.MaxSizeMB < 0 || r.KeepRuns < 0 {
+		return fieldError("artifact_retention", "artifact_retention limits must not be negative")
+	}
+	return nil
+}
+
+// storeRunFile writes a file relative to a run directory through the store of the artifacts directory holding the run
+// Where hard links aren't supported the file is written directly, so the run is complete either way
+func storeRunFile(runDir, name string, content []byte) error {
+	path := filepath.Join(runDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(name), err)
+	}
+
+	// Never write through an existing file, which may be linked into other runs
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace %s: %w", name, err)
+	}
+
+	if useObjectStore {
+		if object, err := putObject(filepath.Join(filepath.Dir(runDir), ObjectsDir), content); err == nil {
+			if err := os.Link(object, path); err == nil {
+				return nil
+			}
+		}
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// putObject adds content to a store, unless it is already there, and returns its path
+// Objects are written to a temporary file and renamed into place, so a reader never sees one half-written
+func putObject(storeDir string, content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	name := hex.EncodeToString(sum[:])
+	path := filepath.Join(storeDir, name[:2], name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	// Objects are shared between runs, so they are read-only
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// PruneResult describes what PruneRuns deleted
+type PruneResult struct {
+	// Runs are the IDs of the deleted runs, oldest first
+	Runs []string
+
+	// Objects is how many stored objects no run used any more and were deleted
+	Objects int
+
+	// Size is the size of the artifacts directory afterwards, in bytes
+	Size int64
+}
+
+// PruneRuns deletes the runs in an artifacts directory that are past the retention limits, oldest first,
+// then deletes the stored objects no remaining run links to
+// Runs without a report, which may still be in progress, are only deleted for their age
+// Only directories named like run IDs are runs, so other files sharing the directory are left alone
+func PruneRuns(artifactsDir string, retention RetentionConfig, now time.Time) (*PruneResult, error) {
+	listed, err := ListRuns(artifactsDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &PruneResult{}, nil
+		}
+		return nil, err
+	}
+	var runs []string
+	for _, runID := range listed {
+		if _, ok := runIDTime(runID); ok {
+			runs = append(runs, runID)
+		}
+	}
+
+	result := &PruneResult{}
+	keep := max(retention.KeepRuns, 1)
+	maxSize := retention.MaxSizeMB * 1024 * 1024
+	for i := len(runs) - 1; i >= keep; i-- {
+		runDir := filepath.Join(artifactsDir, runs[i])
+		expired := retention.MaxAgeDays > 0 && now.Sub(runTime(runDir)) > time.Duration(retention.MaxAgeDays)*24*time.Hour
+		if !expired {
+			if maxSize <= 0 {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(runDir, ReportFile)); err != nil {
+				continue
+			}
+			size, err := artifactsSize(artifactsDir)
+			if err != nil {
+				return result, err
+			}
+			if size <= maxSize {
+				break
+			}
+		}
+
+		if err := os.RemoveAll(runDir); err != nil {
+			return result, fmt.Errorf("failed to delete run %s: %w", runs[i], err)
+		}
+		result.Runs = append(result.Runs, runs[i])
+
+		// Deleting a run only frees the space of objects no other run shares
+		objects, err := collectObjects(artifactsDir)
+		result.Objects += objects
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.Size, err = artifactsSize(artifactsDir)
+	return result, err
+}
+
+// runTime returns when a run started, from the timestamp its ID begins with, or its directory's modification time
+func runTime(runDir string) time.Time {
+	if t, ok := runIDTime(filepath.Base(runDir)); ok {
+		return t
+	}
+	if info, err := os.Stat(runDir); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// artifactsSize returns the space an artifacts directory takes, counting each stored object once
+func artifactsSize(artifactsDir string) (int64, error) {
+	var size int64
+	objectsDir := filepath.Join(artifactsDir, ObjectsDir)
+	err := filepath.WalkDir(artifactsDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		// Run files linked to an object are counted with the object
+		if links, ok := linkCount(info); !ok || links <= 1 || strings.HasPrefix(path, objectsDir+string(filepath.Separator)) {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure artifacts directory: %w", err)
+	}
+	return size, nil
+}
+
+// collectObjects deletes the stored objects that no run links to any more and returns how many it deleted
+// Objects being added by a run in progress are linked as soon as they are stored, and a run that finds its
+// object collected writes the file directly, so collecting while runs are in progress loses nothing
+func collectObjects(artifactsDir string) (int, error) {
+	objectsDir := filepath.Join(artifactsDir, ObjectsDir)
+	collected := 0
+	err := filepath.WalkDir(objectsDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if links, ok := linkCount(info); ok && links <= 1 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			collected++
+		}
+		return nil
+	})
+	if err != nil {
+		return collected, fmt.Errorf("failed to collect unused objects: %w", err)
+	}
+	return collected, nil
+}
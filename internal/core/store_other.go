@@ -0,0 +1,14 @@
+//go:build !unix
+
+package core
+
+import "os"
+
+// useObjectStore is unset where link counts aren't available, since objects could never be collected
+// Run files are written directly instead
+const useObjectStore = false
+
+// linkCount can't tell how many names a file has on this platform, so unused objects are never collected
+func linkCount(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreRunFile(t *testing.T) {
+	if !useObjectStore {
+		t.Skip("run files are written directly on this platform")
+	}
+	artifactsDir := t.TempDir()
+	first, second := filepath.Join(artifactsDir, "20240101-000000-aaaaaa"), filepath.Join(artifactsDir, "20240102-000000-bbbbbb")
+	log := []byte("PASS\nok  \texample\n")
+	require.NoError(t, storeRunFile(first, "tests/baseline.log", log))
+	require.NoError(t, storeRunFile(second, "tests/baseline.log", log))
+
+	// Identical content is stored once and linked into both runs
+	firstInfo, err := os.Stat(filepath.Join(first, "tests", "baseline.log"))
+	require.NoError(t, err)
+	secondInfo, err := os.Stat(filepath.Join(second, "tests", "baseline.log"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(firstInfo, secondInfo))
+	objects, err := filepath.Glob(filepath.Join(artifactsDir, ObjectsDir, "*", "*"))
+	require.NoError(t, err)
+	assert.Len(t, objects, 1)
+
+	// Rewriting a file in one run leaves the other untouched
+	require.NoError(t, storeRunFile(second, "tests/baseline.log", []byte("FAIL\n")))
+	data, err := os.ReadFile(filepath.Join(first, "tests", "baseline.log"))
+	require.NoError(t, err)
+	assert.Equal(t, log, data)
+
+	// The store isn't a run
+	runs, err := ListRuns(artifactsDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20240102-000000-bbbbbb", "20240101-000000-aaaaaa"}, runs)
+}
+
+func TestPruneRuns(t *testing.T) {
+	artifactsDir := t.TempDir()
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	shared := strings.Repeat("baseline\n", 10000)
+	writeRun := func(runID string, report bool, unique string) {
+		runDir := filepath.Join(artifactsDir, runID)
+		require.NoError(t, storeRunFile(runDir, "tests/baseline.log", []byte(shared)))
+		require.NoError(t, storeRunFile(runDir, "claude.patch", []byte(unique)))
+		if report {
+			require.NoError(t, os.WriteFile(filepath.Join(runDir, ReportFile), []byte("{}\n"), 0644))
+		}
+	}
+	writeRun("20240101-000000-aaaaaa", true, strings.Repeat("a", 400*1024))
+	writeRun("20240110-000000-bbbbbb", false, strings.Repeat("b", 400*1024))
+	writeRun("20240220-000000-cccccc", true, strings.Repeat("c", 400*1024))
+	writeRun("20240225-000000-dddddd", true, strings.Repeat("d", 400*1024))
+	writeRun("20240229-000000-eeeeee", true, strings.Repeat("e", 400*1024))
+	// A shared artifacts directory can hold directories that aren't runs
+	unrelated := filepath.Join(artifactsDir, "backups")
+	require.NoError(t, os.MkdirAll(unrelated, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(unrelated, "data.bin"), []byte("backup\n"), 0644))
+	require.NoError(t, os.Chtimes(unrelated, now.AddDate(-1, 0, 0), now.AddDate(-1, 0, 0)))
+	remaining := func() []string {
+		runs, err := ListRuns(artifactsDir)
+		require.NoError(t, err)
+		assert.Equal(t, "backups", runs[0])
+		return runs[1:]
+	}
+
+	// Nothing is past the limits
+	pruned, err := PruneRuns(artifactsDir, RetentionConfig{MaxAgeDays: 90, MaxSizeMB: 10}, now)
+	require.NoError(t, err)
+	assert.Empty(t, pruned.Runs)
+	assert.Len(t, remaining(), 5)
+
+	// Old runs are deleted whether or not they finished, and their unshared objects with them
+	pruned, err = PruneRuns(artifactsDir, RetentionConfig{MaxAgeDays: 30}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20240101-000000-aaaaaa", "20240110-000000-bbbbbb"}, pruned.Runs)
+	if useObjectStore {
+		assert.Equal(t, 2, pruned.Objects, "The shared baseline log is still in use")
+	}
+	assert.Len(t, remaining(), 3)
+
+	// The oldest runs are deleted until the rest fit, always keeping the most recent
+	pruned, err = PruneRuns(artifactsDir, RetentionConfig{MaxSizeMB: 1}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20240220-000000-cccccc"}, pruned.Runs)
+	assert.LessOrEqual(t, pruned.Size, int64(1024*1024))
+	pruned, err = PruneRuns(artifactsDir, RetentionConfig{MaxSizeMB: 1, MaxAgeDays: 1, KeepRuns: 2}, now)
+	require.NoError(t, err)
+	assert.Empty(t, pruned.Runs)
+	assert.Equal(t, []string{"20240229-000000-eeeeee", "20240225-000000-dddddd"}, remaining())
+	assert.FileExists(t, filepath.Join(unrelated, "data.bin"))
+
+	// An artifacts directory that doesn't exist yet has nothing to prune
+	pruned, err = PruneRuns(filepath.Join(artifactsDir, "missing"), RetentionConfig{MaxAgeDays: 1}, now)
+	require.NoError(t, err)
+	assert.Empty(t, pruned.Runs)
+}
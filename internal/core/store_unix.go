@@ -0,0 +1,19 @@
+//go:build unix
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// useObjectStore is set where link counts show which stored objects runs still use
+const useObjectStore = true
+
+// linkCount returns how many names a file has, so the store can tell which objects runs still use
+func linkCount(info os.FileInfo) (uint64, bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink), true
+	}
+	return 0, false
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Task is one unit of work for the agents, as listed in a batch task file
+type Task struct {
+	// ID names the task in reports (defaults to task-<n> by position)
+	ID string `yaml:"id" json:"id"`
+
+	// Prompt is the task description given to every agent
+	Prompt string `yaml:"prompt" json:"prompt"`
+
+	// BaseRef is the git ref agents start from (defaults to HEAD)
+	BaseRef string `yaml:"base_ref" json:"base_ref,omitempty"`
+
+	// Repo is a remote repository to clone for the task, instead of the run's --repo or --repo-url
+	Repo string `yaml:"repo" json:"repo,omitempty"`
+
+	// Labels group tasks in the batch summary
+	Labels []string `yaml:"labels" json:"labels,omitempty"`
+}
+
+// LoadTasks reads a task file
+// YAML files hold a list of tasks or a mapping with a "tasks" list; .jsonl files hold one JSON task per line
+func LoadTasks(path string) ([]Task, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading task file: %w", err)
+	}
+
+	var tasks []Task
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		tasks, err = parseTaskLines(data)
+	} else {
+		tasks, err = parseTaskList(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing task file %s: %w", path, err)
+	}
+
+	if err := validateTasks(tasks); err != nil {
+		return nil, fmt.Errorf("invalid task file %s: %w", path, err)
+	}
+	return tasks, nil
+}
+
+// parseTaskList parses a YAML list of tasks, optionally nested under a "tasks" key
+func parseTaskList(data []byte) ([]Task, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	node := documentRoot(&root)
+	if node.Kind == yaml.MappingNode {
+		node = mappingValue(node, "tasks")
+		if node == nil {
+			return nil, fmt.Errorf("expected a list of tasks or a 'tasks' key")
+		}
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: expected a list of tasks", node.Line)
+	}
+
+	tasks := make([]Task, 0, len(node.Content))
+	for _, item := range node.Content {
+		task, err := decodeTask(item)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// parseTaskLines parses one JSON task per line, skipping blank lines
+func parseTaskLines(data []byte) ([]Task, error) {
+	var tasks []Task
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		// JSON is valid YAML, so each line decodes with the same field names and strictness
+		var node yaml.Node
+		if err := yaml.Unmarshal(line, &node); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		task, err := decodeTask(documentRoot(&node))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// decodeTask decodes a single task, rejecting unknown fields
+func decodeTask(node *yaml.Node) (Task, error) {
+	var task Task
+
+	// A bare string is shorthand for a task with only a prompt
+	if node.Kind == yaml.ScalarNode {
+		task.Prompt = node.Value
+		return task, nil
+	}
+
+	if errs := checkUnknownFields(node, reflect.TypeOf(task)); len(errs) > 0 {
+		return task, errs
+	}
+	if err := node.Decode(&task); err != nil {
+		return task, err
+	}
+	return task, nil
+}
+
+// validateTasks checks that every task has a prompt and assigns IDs to unnamed tasks
+func validateTasks(tasks []Task) error {
+	if len(tasks) == 0 {
+		return fmt.Errorf("no tasks found")
+	}
+
+	seen := make(map[string]bool, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		if task.ID == "" {
+			task.ID = fmt.Sprintf("task-%d", i+1)
+		}
+		if seen[task.ID] {
+			return fmt.Errorf("duplicate task ID '%s'", task.ID)
+		}
+		seen[task.ID] = true
+
+		if strings.TrimSpace(task.Prompt) == "" {
+			return fmt.Errorf("task '%s' has no prompt", task.ID)
+		}
+	}
+	return nil
+}
+
+// TaskResult is the outcome of running one task
+type TaskResult struct {
+	// Task is the task that was run
+	Task Task
+
+	// RunID identifies the run's artifacts
+	RunID string
+
+	// Repo is the repository the task ran against: its URL when it was cloned, or else its absolute path
+	Repo string
+
+	// Best is the winning patch (nil if the run failed)
+	Best *PatchResult
+
+	// Candidates are every evaluated patch from best to worst
+	Candidates []*PatchResult
+
+	// Branch is the branch the winning patch was committed to, if any
+	Branch string
+
+	// ReviewNotes point a human reviewer at the parts of the winning patch that need the closest look
+	ReviewNotes []ReviewNote
+
+	// TestAuthor is the agent that wrote failing tests before the others started, and Tests is its patch, which
+	// every candidate applies on top of (both empty without TDD)
+	TestAuthor string
+	Tests      string
+
+	// Duration is how long the task took
+	Duration time.Duration
+
+	// Err is set if the run failed
+	Err error
+}
+
+// Solved reports whether the winning patch changed code and leaves every test passing
+func (r *TaskResult) Solved() bool {
+	return r.Err == nil && r.Best != nil && strings.TrimSpace(r.Best.Diff) != "" &&
+		r.Best.TestResults != nil && r.Best.TestResults.Success
+}
+
+// status summarizes a task outcome in one word
+func (r *TaskResult) status() string {
+	switch {
+	case r.Err != nil:
+		return "error"
+	case r.Solved():
+		return "solved"
+	default:
+		return "unsolved"
+	}
+}
+
+// FormatBatchReport renders a per-task table followed by an aggregate summary
+func FormatBatchReport(results []*TaskResult) string {
+	var sb strings.Builder
+
+	sb.WriteString("=== Batch Results ===\n")
+	for _, result := range results {
+		sb.WriteString(fmt.Sprintf("%-20s %-8s", result.Task.ID, result.status()))
+		switch {
+		case result.Err != nil:
+			sb.WriteString(fmt.Sprintf(" %v", result.Err))
+		case result.Best != nil:
+			sb.WriteString(fmt.Sprintf(" winner %s (score %d)", result.Best.AgentID, result.Best.Score))
+			if result.Best.TestResults != nil {
+				sb.WriteString(fmt.Sprintf(", tests %d/%d", result.Best.TestResults.PassedTests, result.Best.TestResults.TotalTests))
+			}
+		}
+		sb.WriteString(fmt.Sprintf(" [%s]", result.Duration.Round(time.Second)))
+		if result.RunID != "" {
+			sb.WriteString(fmt.Sprintf(" run %s", result.RunID))
+		}
+		sb.WriteString("\n")
+	}
+
+	solved, failed := 0, 0
+	var total time.Duration
+	wins := make(map[string]int)
+	labelTotals := make(map[string]int)
+	labelSolved := make(map[string]int)
+	for _, result := range results {
+		total += result.Duration
+		if result.Err != nil {
+			failed++
+		}
+		if result.Solved() {
+			solved++
+			wins[result.Best.AgentID]++
+		}
+		for _, label := range result.Task.Labels {
+			labelTotals[label]++
+			if result.Solved() {
+				labelSolved[label]++
+			}
+		}
+	}
+
+	sb.WriteString("\n=== Summary ===\n")
+	sb.WriteString(fmt.Sprintf("Tasks: %d, solved: %d, unsolved: %d, errors: %d\n", len(results), solved, len(results)-solved-failed, failed))
+	sb.WriteString(fmt.Sprintf("Total time: %s\n", total.Round(time.Second)))
+
+	if len(wins) > 0 {
+		agents := make([]string, 0, len(wins))
+		for agent := range wins {
+			agents = append(agents, agent)
+		}
+		sort.Slice(agents, func(i, j int) bool {
+			if wins[agents[i]] != wins[agents[j]] {
+				return wins[agents[i]] > wins[agents[j]]
+			}
+			return agents[i] < agents[j]
+		})
+		sb.WriteString("Wins by agent:\n")
+		for _, agent := range agents {
+			sb.WriteString(fmt.Sprintf("  %s: %d\n", agent, wins[agent]))
+		}
+	}
+
+	if len(labelTotals) > 0 {
+		labels := make([]string, 0, len(labelTotals))
+		for label := range labelTotals {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		sb.WriteString("Solved by label:\n")
+		for _, label := range labels {
+			sb.WriteString(fmt.Sprintf("  %s: %d/%d\n", label, labelSolved[label], labelTotals[label]))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTasks(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+		return path
+	}
+
+	expected := []Task{
+		{ID: "nil-map", Prompt: "Fix the nil map panic", BaseRef: "v1.2.0", Labels: []string{"bug"}},
+		{ID: "task-2", Prompt: "Add a --json flag"},
+	}
+
+	t.Run("yaml list", func(t *testing.T) {
+		tasks, err := LoadTasks(write("tasks.yaml", `
+- id: nil-map
+  prompt: Fix the nil map panic
+  base_ref: v1.2.0
+  labels: [bug]
+- Add a --json flag
+`))
+		require.NoError(t, err)
+		assert.Equal(t, expected, tasks)
+	})
+
+	t.Run("yaml tasks key", func(t *testing.T) {
+		tasks, err := LoadTasks(write("nested.yml", `
+tasks:
+  - id: nil-map
+    prompt: Fix the nil map panic
+    base_ref: v1.2.0
+    labels: [bug]
+  - prompt: Add a --json flag
+`))
+		require.NoError(t, err)
+		assert.Equal(t, expected, tasks)
+	})
+
+	t.Run("jsonl", func(t *testing.T) {
+		tasks, err := LoadTasks(write("tasks.jsonl", `{"id": "nil-map", "prompt": "Fix the nil map panic", "base_ref": "v1.2.0", "labels": ["bug"]}
+
+{"prompt": "Add a --json flag"}
+`))
+		require.NoError(t, err)
+		assert.Equal(t, expected, tasks)
+	})
+
+	invalid := []struct {
+		name string
+		file string
+		data string
+		want string
+	}{
+		{name: "unknown field", file: "typo.jsonl", data: `{"promt": "Fix it"}`, want: "did you mean 'prompt'?"},
+		{name: "missing prompt", file: "empty.yaml", data: "- id: blank\n", want: "task 'blank' has no prompt"},
+		{name: "duplicate id", file: "dup.yaml", data: "- {id: a, prompt: x}\n- {id: a, prompt: y}\n", want: "duplicate task ID 'a'"},
+		{name: "no tasks", file: "none.yaml", data: "tasks: []\n", want: "no tasks found"},
+		{name: "bad json line", file: "bad.jsonl", data: "{\"prompt\": \"ok\"}\n{\"prompt\": \n", want: "line 2"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadTasks(write(tc.file, tc.data))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.want)
+		})
+	}
+}
+
+func TestFormatBatchReport(t *testing.T) {
+	passing := &TestResult{Success: true, TotalTests: 4, PassedTests: 4}
+	failing := &TestResult{Success: false, TotalTests: 4, PassedTests: 3, FailedTests: 1}
+
+	results := []*TaskResult{
+		{Task: Task{ID: "a", Labels: []string{"bug"}}, RunID: "run-a", Duration: 2 * time.Second,
+			Best: &PatchResult{AgentID: "claude", Diff: "+fix", Score: 80, TestResults: passing}},
+		{Task: Task{ID: "b", Labels: []string{"bug", "cli"}}, Duration: time.Second,
+			Best: &PatchResult{AgentID: "amp", Diff: "+try", Score: 10, TestResults: failing}},
+		{Task: Task{ID: "c"}, Err: errors.New("baseline tests failed")},
+	}
+
+	assert.True(t, results[0].Solved())
+	assert.False(t, results[1].Solved(), "Failing tests leave a task unsolved")
+	assert.False(t, (&TaskResult{Best: &PatchResult{TestResults: passing}}).Solved(), "An empty patch solves nothing")
+
+	report := FormatBatchReport(results)
+	assert.Contains(t, report, "solved   winner claude (score 80), tests 4/4 [2s] run run-a")
+	assert.Contains(t, report, "unsolved winner amp (score 10), tests 3/4")
+	assert.Contains(t, report, "error    baseline tests failed")
+	assert.Contains(t, report, "Tasks: 3, solved: 1, unsolved: 1, errors: 1")
+	assert.Contains(t, report, "Wins by agent:\n  claude: 1\n")
+	assert.Contains(t, report, "Solved by label:\n  bug: 1/2\n  cli: 0/1\n")
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// DefaultTestAuthorPrompt asks the test author for failing tests unless another prompt is configured
+const DefaultTestAuthorPrompt = `Write tests for this task, and nothing else. Other agents will then change the code to make your tests pass, so don't change any code other than tests.
+
+The tests should check what the task asks for, and fail until it is done.{{if .TestCommand}} Run them with ` + "`{{.TestCommand}}`" + ` and check they fail for that reason, not because they don't build.{{end}}
+
+Task: {{.Prompt}}`
+
+// TestsCommitMessage is the commit message of the test author's tests, which every other agent starts from
+const TestsCommitMessage = "orchestrator: failing tests for the task"
+
+// TDDConfig has a test author agent write failing tests for the task before the other agents start
+// The tests are committed to every other agent's worktree, where agents may not change them, and the agents compete
+// to make them pass, judged by the new tests along with the existing suite
+type TDDConfig struct {
+	// TestAuthor is the agent that writes the tests ("" for no test-writing phase); it doesn't compete to fix the task
+	TestAuthor string `yaml:"test_author,omitempty"`
+
+	// Prompt asks the test author for the tests, as a Go text/template rendered with PromptData
+	// (empty for DefaultTestAuthorPrompt)
+	Prompt string `yaml:"prompt,omitempty"`
+}
+
+// Enabled reports whether runs start with a test-writing phase
+func (t TDDConfig) Enabled() bool {
+	return t.TestAuthor != ""
+}
+
+// TestAuthorPrompt renders the prompt the test author is given
+func (t TDDConfig) TestAuthorPrompt(data PromptData) (string, error) {
+	text := t.Prompt
+	if strings.TrimSpace(text) == "" {
+		text = DefaultTestAuthorPrompt
+	}
+	rendered, err := RenderPrompt(text, data)
+	if err != nil {
+		return "", fmt.Errorf("test author prompt: %w", err)
+	}
+	return rendered, nil
+}
+
+// validateTDD checks the test author is a configured agent outside any pipeline, and leaves another to fix the task
+func validateTDD(cfg *Config) error {
+	author := cfg.TDD.TestAuthor
+	if author != "" {
+		ids := make([]string, 0, len(cfg.Agents))
+		for _, agent := range cfg.Agents {
+			ids = append(ids, agent.ID)
+		}
+		switch {
+		case !slices.Contains(ids, author):
+			err := fieldError("tdd.test_author", "tdd.test_author '%s' is not a configured agent", author)
+			err.Suggestion = suggest(author, ids)
+			return err
+		case cfg.inPipeline(author):
+			return fieldError("tdd.test_author", "tdd.test_author '%s' is in a pipeline", author)
+		case cfg.IsPatchAgent(author):
+			return fieldError("tdd.test_author", "tdd.test_author '%s' is a patch agent, which only submits its patch file", author)
+		case len(ids) < 2:
+			return fieldError("tdd.test_author", "tdd.test_author '%s' is the only agent, leaving none to make its tests pass", author)
+		}
+	}
+	if cfg.TDD.Prompt != "" {
+		if _, err := ParsePromptTemplate(cfg.TDD.Prompt); err != nil {
+			return fieldError("tdd.prompt", "tdd.prompt is an invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+// WithTestAuthor returns a copy of the configuration whose runs start with the agent writing failing tests
+func (c *Config) WithTestAuthor(agentID string) (*Config, error) {
+	copied := *c
+	copied.TDD.TestAuthor = agentID
+	if err := validateTDD(&copied); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// WithoutTestAuthor returns a copy of the configuration without the test author among its agents, and the test
+// author's configuration
+func (c *Config) WithoutTestAuthor() (*Config, AgentConfig) {
+	copied := *c
+	copied.Agents = make([]AgentConfig, 0, len(c.Agents))
+	var author AgentConfig
+	for _, agent := range c.Agents {
+		if agent.ID == c.TDD.TestAuthor {
+			author = agent
+			continue
+		}
+		copied.Agents = append(copied.Agents, agent)
+	}
+	return &copied, author
+}
+
+// ProtectTests returns a copy of the configuration whose path policy also denies changes to the files the test
+// author's diff changed, so agents make its tests pass rather than change them
+func (c *Config) ProtectTests(testsDiff string) *Config {
+	copied := *c
+	copied.Paths.Deny = append([]string(nil), c.Paths.Deny...)
+	for _, file := range TestFiles(testsDiff) {
+		copied.Paths.Deny = append(copied.Paths.Deny, escapePattern(file))
+	}
+	return &copied
+}
+
+// TestFiles returns the files the test author's diff changed, in diff order
+func TestFiles(testsDiff string) []string {
+	var files []string
+	for _, file := range gitutil.SplitDiff(testsDiff) {
+		files = append(files, filePaths(file)...)
+	}
+	return files
+}
+
+// escapePattern quotes the glob metacharacters in a file path, so the pattern matches only that file
+func escapePattern(file string) string {
+	var sb strings.Builder
+	for _, r := range file {
+		if strings.ContainsRune(`*?[\`, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTDD(t *testing.T) {
+	agents := []AgentConfig{{ID: "claude", Type: "claude"}, {ID: "codex", Type: "codex"}, {ID: "amp", Type: "amp"}}
+	tests := []struct {
+		name   string
+		tdd    TDDConfig
+		agents []AgentConfig
+		want   string
+	}{
+		{name: "off"},
+		{name: "test author", tdd: TDDConfig{TestAuthor: "claude", Prompt: "Write tests for {{.Prompt}}"}},
+		{name: "unknown agent", tdd: TDDConfig{TestAuthor: "claud"}, want: "tdd.test_author 'claud' is not a configured agent"},
+		{name: "in a pipeline", tdd: TDDConfig{TestAuthor: "codex"}, want: "tdd.test_author 'codex' is in a pipeline"},
+		{name: "only agent", tdd: TDDConfig{TestAuthor: "claude"}, agents: agents[:1], want: "leaving none to make its tests pass"},
+		{name: "invalid prompt", tdd: TDDConfig{Prompt: "{{.Prompt"}, want: "tdd.prompt is an invalid template"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{Agents: agents, Pipelines: []PipelineConfig{{Fixer: "codex", Reviewer: "amp"}}, TDD: tc.tdd}
+			if tc.agents != nil {
+				cfg.Agents, cfg.Pipelines = tc.agents, nil
+			}
+			err := validateTDD(cfg)
+			if tc.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestTestAuthor(t *testing.T) {
+	cfg := &Config{
+		Samples:        2,
+		Agents:         []AgentConfig{{ID: "claude", Type: "claude"}, {ID: "codex", Type: "codex"}},
+		Paths:          PathPolicy{Deny: []string{".env"}},
+		PromptVariants: []PromptVariant{{Name: "minimal"}},
+	}
+	_, err := cfg.WithTestAuthor("gemini")
+	assert.ErrorContains(t, err, "tdd.test_author 'gemini' is not a configured agent")
+
+	withAuthor, err := cfg.WithTestAuthor("claude")
+	require.NoError(t, err)
+	assert.Empty(t, cfg.TDD.TestAuthor, "The original configuration is unchanged")
+
+	// The test author runs once under its own ID
+	expanded, err := withAuthor.ExpandPromptVariants(0)
+	require.NoError(t, err)
+	expanded, err = expanded.ExpandSamples(0)
+	require.NoError(t, err)
+	var ids []string
+	for _, agent := range expanded.Agents {
+		ids = append(ids, agent.ID)
+	}
+	assert.Equal(t, []string{"claude", "codex@minimal#1", "codex@minimal#2"}, ids)
+
+	fixers, author := expanded.WithoutTestAuthor()
+	assert.Equal(t, "claude", author.ID)
+	assert.Len(t, fixers.Agents, 2)
+
+	// Agents may not change the files the test author wrote
+	diff := "diff --git a/parse_test.go b/parse_test.go\nnew file mode 100644\n--- /dev/null\n+++ b/parse_test.go\n@@ -0,0 +1 @@\n+package parse\n" +
+		"diff --git a/odd[1]_test.go b/odd[1]_test.go\nnew file mode 100644\n--- /dev/null\n+++ b/odd[1]_test.go\n@@ -0,0 +1 @@\n+package parse\n"
+	assert.Equal(t, []string{"parse_test.go", "odd[1]_test.go"}, TestFiles(diff))
+	protected := fixers.ProtectTests(diff)
+	assert.False(t, protected.Paths.Permits("parse_test.go"))
+	assert.False(t, protected.Paths.Permits("odd[1]_test.go"))
+	assert.True(t, protected.Paths.Permits("odd1_test.go"), "File names are matched literally")
+	assert.True(t, protected.Paths.Permits("parse.go"))
+	assert.Equal(t, []string{".env"}, fixers.Paths.Deny, "The original policy is unchanged")
+}
+
+func TestTestAuthorPrompt(t *testing.T) {
+	prompt, err := TDDConfig{}.TestAuthorPrompt(PromptData{Prompt: "Parse dates", TestCommand: "go test ./..."})
+	require.NoError(t, err)
+	assert.Contains(t, prompt, "Write tests for this task, and nothing else.")
+	assert.Contains(t, prompt, "Run them with `go test ./...`")
+	assert.True(t, strings.HasSuffix(prompt, "\n\nTask: Parse dates"))
+
+	prompt, err = TDDConfig{Prompt: "Test {{.Prompt}}"}.TestAuthorPrompt(PromptData{Prompt: "Parse dates"})
+	require.NoError(t, err)
+	assert.Equal(t, "Test Parse dates", prompt)
+}
@@ -6,9 +6,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
+	"github.com/brettsmith212/orchestrator/internal/sandbox"
 )
 
 // TestResult contains the results of running tests
@@ -38,6 +46,27 @@ type TestResult struct {
 	Error string `json:"error,omitempty"`
 }
 
+// Test output formats a test runner reads counts from
+const (
+	// TestParserGo reads go test's package summaries and go test -json events, which is the default
+	TestParserGo = "go"
+
+	// TestParserJest reads Jest's "Tests:" summary line
+	TestParserJest = "jest"
+
+	// TestParserPytest reads pytest's closing summary line
+	TestParserPytest = "pytest"
+
+	// TestParserCargo reads the "test result:" line cargo test prints for each test binary
+	TestParserCargo = "cargo"
+)
+
+// TestParsers lists the test output formats
+var TestParsers = []string{TestParserGo, TestParserJest, TestParserPytest, TestParserCargo}
+
+// TestShellDefault selects the platform's shell for test commands: cmd on Windows and sh elsewhere
+const TestShellDefault = "default"
+
 // TestRunner runs tests for a repository
 type TestRunner struct {
 	// TestCommand is the command to run tests, e.g. "go test ./..."
@@ -45,6 +74,25 @@ type TestRunner struct {
 
 	// Timeout is the maximum time to wait for tests to complete
 	Timeout time.Duration
+
+	// Sandbox runs the tests in a container that sees only the worktree (nil runs them directly)
+	Sandbox *sandbox.Container
+
+	// Dir is the slash-separated subdirectory of the worktree the tests run from (empty for its root)
+	Dir string
+
+	// Shell runs the test command through sh, cmd, or powershell, so it can use their syntax
+	// (empty runs its first word as the program, with the rest as arguments)
+	Shell string
+
+	// Parser is the format test counts are read from, one of TestParsers (empty for go)
+	Parser string
+
+	// Runner runs the test command (nil runs it as a process)
+	Runner CommandRunner
+
+	// Clock times the tests (nil for the wall clock)
+	Clock Clock
 }
 
 // NewTestRunner creates a new test runner
@@ -78,8 +126,27 @@ func (tr *TestRunner) Run(ctx context.Context, worktreePath string) (*TestResult
 		return nil, errors.New("empty test command")
 	}
 
-	cmd := exec.CommandContext(ctx, cmdParts[0], cmdParts[1:]...)
-	cmd.Dir = worktreePath
+	command, args := cmdParts[0], cmdParts[1:]
+	if tr.Shell != "" {
+		command, args = procutil.ShellArgs(tr.Shell, tr.TestCommand)
+	}
+	var cmd *exec.Cmd
+	switch {
+	case tr.Sandbox != nil:
+		name := sandbox.NewName("tests")
+		command, args = tr.Sandbox.CommandIn(name, worktreePath, tr.Dir, command, args)
+		defer func() {
+			if err := tr.Sandbox.Remove(name); err != nil {
+				slog.Warn("failed to remove test container", "error", err)
+			}
+		}()
+		cmd = exec.CommandContext(ctx, command, args...)
+	case tr.Shell != "":
+		cmd = procutil.ShellCommand(ctx, tr.Shell, tr.TestCommand)
+	default:
+		cmd = exec.CommandContext(ctx, command, args...)
+	}
+	cmd.Dir = filepath.Join(worktreePath, filepath.FromSlash(tr.Dir))
 
 	// Capture stdout and stderr
 	var stdout, stderr bytes.Buffer
@@ -87,13 +154,14 @@ func (tr *TestRunner) Run(ctx context.Context, worktreePath string) (*TestResult
 	cmd.Stderr = &stderr
 
 	// Track start time
-	startTime := time.Now()
+	clock := tr.clock()
+	startTime := clock.Now()
 
-	// Run the tests
-	err := cmd.Run()
+	// Run the tests in a group of their own, so a timeout also stops the test binaries they started
+	err := tr.runner().Run(cmd)
 
 	// Calculate duration
-	duration := time.Since(startTime)
+	duration := clock.Now().Sub(startTime)
 
 	// Combine stdout and stderr
 	output := stdout.String() + stderr.String()
@@ -104,13 +172,30 @@ func (tr *TestRunner) Run(ctx context.Context, worktreePath string) (*TestResult
 	}
 
 	// Parse results
-	result := parseTestResults(output, duration, err)
+	result := parseTestResults(output, duration, err, tr.Parser)
+	audit.Record(ctx, audit.TestsExecuted, "command", tr.TestCommand, "dir", worktreePath, "success", strconv.FormatBool(result.Success), "duration", duration.Round(time.Millisecond).String())
 
 	return result, nil
 }
 
-// parseTestResults analyzes test output to determine how many tests passed/failed
-func parseTestResults(output string, duration time.Duration, runErr error) *TestResult {
+// runner returns what runs the test command
+func (tr *TestRunner) runner() CommandRunner {
+	if tr.Runner == nil {
+		return ProcessRunner{}
+	}
+	return tr.Runner
+}
+
+// clock returns what times the tests
+func (tr *TestRunner) clock() Clock {
+	if tr.Clock == nil {
+		return SystemClock{}
+	}
+	return tr.Clock
+}
+
+// parseTestResults analyzes test output in the parser's format to determine how many tests passed/failed
+func parseTestResults(output string, duration time.Duration, runErr error, parser string) *TestResult {
 	result := &TestResult{
 		Success:  runErr == nil,
 		Duration: duration,
@@ -122,8 +207,17 @@ func parseTestResults(output string, duration time.Duration, runErr error) *Test
 		result.Error = runErr.Error()
 	}
 
+	switch parser {
+	case TestParserJest:
+		countSummary(result, jestSummaryRegex, output, false)
+	case TestParserPytest:
+		countSummary(result, pytestSummaryRegex, output, false)
+	case TestParserCargo:
+		countSummary(result, cargoSummaryRegex, output, true)
+	}
+
 	// Try to parse "go test" output format
-	if lines := strings.Split(output, "\n"); len(lines) > 0 {
+	if lines := strings.Split(output, "\n"); (parser == "" || parser == TestParserGo) && len(lines) > 0 {
 		for _, line := range lines {
 			// Look for the test summary line, e.g. "ok  \tpackage/path\t0.015s"
 			if strings.HasPrefix(line, "ok\t") || strings.HasPrefix(line, "FAIL\t") {
@@ -169,6 +263,104 @@ func parseTestResults(output string, duration time.Duration, runErr error) *Test
 	return result
 }
 
+// Summary lines of other test tools, whose counts countSummary reads
+var (
+	// jestSummaryRegex matches "Tests:       1 failed, 2 skipped, 5 passed, 8 total"
+	jestSummaryRegex = regexp.MustCompile(`(?m)^Tests:\s+(.*)$`)
+
+	// pytestSummaryRegex matches "===== 1 failed, 5 passed, 2 skipped in 0.12s =====", with or without the rules
+	pytestSummaryRegex = regexp.MustCompile(`(?m)^=*\s*((?:\d+ \w+,? ?)+) in [\d.]+s`)
+
+	// cargoSummaryRegex matches "test result: FAILED. 5 passed; 1 failed; 0 ignored; 0 measured; 0 filtered out"
+	cargoSummaryRegex = regexp.MustCompile(`(?m)^test result: \w+\. (.*)$`)
+
+	// summaryCountRegex matches each count of a summary, like "5 passed"
+	summaryCountRegex = regexp.MustCompile(`(\d+) (\w+)`)
+)
+
+// countSummary sets a result's counts from the summary lines pattern matches: only the last one,
+// or with sum, every one, as cargo prints a summary for each test binary
+func countSummary(result *TestResult, pattern *regexp.Regexp, output string, sum bool) {
+	summaries := pattern.FindAllStringSubmatch(output, -1)
+	if len(summaries) == 0 {
+		return
+	}
+	if !sum {
+		summaries = summaries[len(summaries)-1:]
+	}
+
+	for _, summary := range summaries {
+		for _, count := range summaryCountRegex.FindAllStringSubmatch(summary[1], -1) {
+			n, _ := strconv.Atoi(count[1])
+			switch count[2] {
+			case "passed", "xpassed":
+				result.PassedTests += n
+			case "failed", "error", "errors":
+				result.FailedTests += n
+			case "skipped", "ignored", "todo", "xfailed":
+				result.SkippedTests += n
+			default:
+				// Totals, warnings, and tests filtered out or deselected aren't counted
+				continue
+			}
+			result.TotalTests += n
+		}
+	}
+}
+
+// cargoFailureRegex matches the line cargo test prints for a failing test, "test tests::parses ... FAILED"
+var cargoFailureRegex = regexp.MustCompile(`^test (\S+) \.\.\. FAILED$`)
+
+// FailingTests returns the names of the tests reported as failing in test output, in the order they appear
+// It understands the "--- FAIL: TestName" lines of go test and the events of go test -json, as well as the
+// failures Jest ("● Suite › test"), pytest ("FAILED path::test"), and cargo test report
+func FailingTests(output string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(trimmed, "--- FAIL: "); ok {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				add(fields[0])
+			}
+			continue
+		}
+
+		if strings.Contains(line, "\"Test\":") {
+			var event struct {
+				Action string
+				Test   string
+			}
+			if json.Unmarshal([]byte(line), &event) == nil && event.Action == "fail" {
+				add(event.Test)
+			}
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(trimmed, "FAILED "); ok {
+			name, _, _ := strings.Cut(rest, " - ")
+			add(strings.TrimSpace(name))
+			continue
+		}
+		if match := cargoFailureRegex.FindStringSubmatch(trimmed); match != nil {
+			add(match[1])
+			continue
+		}
+		// Jest also heads console output and suites that didn't load with a bullet
+		if rest, ok := strings.CutPrefix(trimmed, "● "); ok && rest != "Console" && rest != "Test suite failed to run" {
+			add(rest)
+		}
+	}
+	return names
+}
+
 // FormatResults returns a human-readable summary of test results
 func FormatResults(result *TestResult) string {
 	var status string
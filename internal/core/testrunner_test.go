@@ -2,11 +2,15 @@ package core
 
 import (
 	"context"
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/brettsmith212/orchestrator/internal/procutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -49,6 +53,71 @@ func TestTestRunner(t *testing.T) {
 	assert.Contains(t, result.Output, "FAIL", "Output should indicate failure")
 }
 
+func TestTestRunnerCommandRunner(t *testing.T) {
+	// Neither a process nor the wall clock is needed to run tests
+	clock := NewManualClock(time.Now())
+	var ran []string
+	testRunner := NewTestRunner("go test ./...", time.Minute)
+	testRunner.Dir = "pkg"
+	testRunner.Clock = clock
+	testRunner.Runner = CommandRunnerFunc(func(cmd *exec.Cmd) error {
+		ran = append(ran, strings.Join(cmd.Args, " "), cmd.Dir)
+		clock.Advance(2 * time.Second)
+		_, err := cmd.Stdout.Write([]byte("ok\texample/a\t0.1s\nFAIL\texample/b\t0.2s\n"))
+		return err
+	})
+
+	result, err := testRunner.Run(context.Background(), "repo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go test ./...", filepath.Join("repo", "pkg")}, ran)
+	assert.False(t, result.Success)
+	assert.Equal(t, 2, result.TotalTests)
+	assert.Equal(t, 1, result.FailedTests)
+	assert.Equal(t, 2*time.Second, result.Duration)
+
+	// A command that can't run fails the tests with its error
+	testRunner.Runner = CommandRunnerFunc(func(*exec.Cmd) error { return errors.New("no such program") })
+	result, err = testRunner.Run(context.Background(), "repo")
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "no such program", result.Error)
+}
+
+func TestTestRunnerSandbox(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test runner test in short mode")
+	}
+
+	// A fake runtime records how it was invoked and reports a passing package
+	dir := t.TempDir()
+	log := filepath.Join(dir, "invocations")
+	runtime := filepath.Join(dir, "docker")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\n[ \"$1\" = run ] && printf 'ok\\texample\\t0.1s\\n'\nexit 0\n"
+	require.NoError(t, os.WriteFile(runtime, []byte(script), 0755))
+
+	sandboxCfg := SandboxConfig{Image: "sandbox:latest", Runtime: "podman", Env: []string{"HOME"}}
+	testRunner := NewTestRunner("go test ./...", 30*time.Second)
+	testRunner.Sandbox = sandboxCfg.TestContainer()
+	testRunner.Sandbox.Runtime = runtime
+
+	worktree := t.TempDir()
+	result, err := testRunner.Run(context.Background(), worktree)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, 1, result.PassedTests)
+
+	// Tests run without network or the agents' environment, and their container is removed afterwards
+	invocations, err := os.ReadFile(log)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(invocations)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "--network none")
+	assert.Contains(t, lines[0], "--volume "+worktree+":/workspace")
+	assert.NotContains(t, lines[0], "--env HOME ")
+	assert.True(t, strings.HasSuffix(lines[0], "sandbox:latest go test ./..."), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "rm --force orchestrator-tests-"), lines[1])
+}
+
 func TestTestRunnerTimeout(t *testing.T) {
 	// Skip if running in short mode
 	if testing.Short() {
@@ -101,6 +170,56 @@ func TestFormatResults(t *testing.T) {
 	assert.Contains(t, failingStr, "2 failed")
 }
 
+func TestFailingTests(t *testing.T) {
+	output := `=== RUN   TestParse
+--- FAIL: TestParse (0.00s)
+    --- FAIL: TestParse/empty (0.00s)
+--- PASS: TestLex (0.00s)
+--- FAIL: TestParse (0.00s)
+{"Action":"fail","Package":"example","Test":"TestJSON"}
+{"Action":"fail","Package":"example"}
+FAIL
+`
+	assert.Equal(t, []string{"TestParse", "TestParse/empty", "TestJSON"}, FailingTests(output))
+	assert.Empty(t, FailingTests("ok  \texample\t0.01s\n"))
+
+	// Jest, pytest, and cargo test name their failures differently
+	jest := "  ● Console\n\n  ● parser › handles empty input\n\n    expect(received).toBe(expected)\n"
+	assert.Equal(t, []string{"parser › handles empty input"}, FailingTests(jest))
+	pytest := "FAILED tests/test_parser.py::test_empty - AssertionError: assert 1 == 2\n"
+	assert.Equal(t, []string{"tests/test_parser.py::test_empty"}, FailingTests(pytest))
+	cargo := "test tests::parses ... ok\ntest tests::empty ... FAILED\n"
+	assert.Equal(t, []string{"tests::empty"}, FailingTests(cargo))
+}
+
+func TestParseTestResults_Parsers(t *testing.T) {
+	tests := []struct {
+		parser                         string
+		output                         string
+		total, passed, failed, skipped int
+	}{
+		{TestParserJest, "PASS src/a.test.js\nFAIL src/b.test.js\nTest Suites: 1 failed, 1 passed, 2 total\nTests:       1 failed, 2 skipped, 5 passed, 8 total\n", 8, 5, 1, 2},
+		{TestParserPytest, "collected 8 items\n\n========= 1 failed, 5 passed, 2 skipped, 1 warning in 0.12s =========\n", 8, 5, 1, 2},
+		{TestParserPytest, "1 error, 3 passed in 0.50s\n", 4, 3, 1, 0},
+		{TestParserCargo, "test result: ok. 3 passed; 0 failed; 1 ignored; 0 measured; 0 filtered out\ntest result: FAILED. 2 passed; 1 failed; 0 ignored; 0 measured; 0 filtered out\n", 7, 5, 1, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.parser, func(t *testing.T) {
+			result := parseTestResults(tc.output, time.Second, nil, tc.parser)
+			assert.Equal(t, tc.total, result.TotalTests)
+			assert.Equal(t, tc.passed, result.PassedTests)
+			assert.Equal(t, tc.failed, result.FailedTests)
+			assert.Equal(t, tc.skipped, result.SkippedTests)
+			assert.Equal(t, tc.failed == 0, result.Success)
+		})
+	}
+
+	// Go's summaries aren't read as another tool's
+	result := parseTestResults("ok  \texample/a\t0.01s\n", time.Second, nil, TestParserJest)
+	assert.Equal(t, 1, result.TotalTests, "Passing output without a summary counts as one passing test")
+	assert.True(t, result.Success)
+}
+
 func TestCompareResults(t *testing.T) {
 	// Define test cases
 	tests := []struct {
@@ -269,4 +388,18 @@ func TestSlow(t *testing.T) {
 `
 	err = os.WriteFile(testFile, []byte(testContent), 0644)
 	require.NoError(t, err)
-}
\ No newline at end of file
+}
+func TestTestRunnerShell(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test that runs a shell in short mode")
+	}
+
+	// Shell syntax only works through a shell
+	runner := NewTestRunner("echo building && exit 3", 30*time.Second)
+	runner.Shell = procutil.DefaultShell()
+	result, err := runner.Run(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Output, "building")
+	assert.NotContains(t, result.Output, "&&")
+}
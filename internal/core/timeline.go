@@ -0,0 +1,149 @@
+package core
+
+import (
+	"sort"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// TimelineFile holds when each agent was thinking, acting, and idle, in the Chrome trace event format
+// It opens in Perfetto (ui.perfetto.dev) or chrome://tracing, with one row per agent
+const TimelineFile = "timeline.json"
+
+// TimelineIdleAfter is how long after an event an agent still counts as busy with it
+// The rest of a longer silence is shown as idle
+const TimelineIdleAfter = 30 * time.Second
+
+// TraceEvent is one entry of the Chrome trace event format
+type TraceEvent struct {
+	// Name is the state or event shown, e.g. "thinking"
+	Name string `json:"name"`
+
+	// Phase is "X" for a state with a duration, "i" for an instant, and "M" for row names
+	Phase string `json:"ph"`
+
+	// Timestamp and Duration are in microseconds; timestamps count from the run's first event
+	Timestamp int64 `json:"ts"`
+	Duration  int64 `json:"dur,omitempty"`
+
+	// PID and TID place the entry in a row; each agent has its own TID
+	PID int `json:"pid"`
+	TID int `json:"tid"`
+
+	// Scope is "t" for instants that belong to their row
+	Scope string `json:"s,omitempty"`
+
+	// Args are shown when the entry is selected
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// Timeline is the content of a timeline file
+type Timeline struct {
+	TraceEvents     []TraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+// BuildTimeline lays out each agent's events as states on a shared clock
+// An agent is in the state of its latest event until the next one: thinking, acting, or failing
+// Silences longer than TimelineIdleAfter end in an idle state
+func BuildTimeline(patches map[string]*PatchDetails) Timeline {
+	return buildTimeline(patches, func(agentID string) []*protocol.Event { return patches[agentID].Events })
+}
+
+// buildTimeline lays out the events of each agent given by eventsOf, which is called once per agent to find where
+// the run started and again to lay it out, so the events of only one agent need be in memory at a time
+func buildTimeline(patches map[string]*PatchDetails, eventsOf func(agentID string) []*protocol.Event) Timeline {
+	agentIDs := make([]string, 0, len(patches))
+	var origin time.Time
+	for agentID := range patches {
+		agentEvents := eventsOf(agentID)
+		if len(agentEvents) == 0 {
+			continue
+		}
+		agentIDs = append(agentIDs, agentID)
+		if first := agentEvents[0].Timestamp; origin.IsZero() || first.Before(origin) {
+			origin = first
+		}
+	}
+	sort.Strings(agentIDs)
+
+	timeline := Timeline{TraceEvents: []TraceEvent{}, DisplayTimeUnit: "ms"}
+	micros := func(t time.Time) int64 { return t.Sub(origin).Microseconds() }
+	for i, agentID := range agentIDs {
+		tid := i + 1
+		patch := patches[agentID]
+		events := eventsOf(agentID)
+		timeline.TraceEvents = append(timeline.TraceEvents,
+			TraceEvent{Name: "thread_name", Phase: "M", PID: 1, TID: tid, Args: map[string]interface{}{"name": agentID}},
+			TraceEvent{Name: "thread_sort_index", Phase: "M", PID: 1, TID: tid, Args: map[string]interface{}{"sort_index": tid}},
+		)
+
+		// The agent ran until its last event, or for as long as the watchdog saw it running
+		end := events[len(events)-1].Timestamp
+		if stopped := events[0].Timestamp.Add(patch.Usage.Duration); stopped.After(end) {
+			end = stopped
+		}
+
+		var states []TraceEvent
+		addState := func(name string, from, to time.Time) {
+			if !to.After(from) {
+				return
+			}
+			// Consecutive events in the same state make one longer state
+			if n := len(states); n > 0 && states[n-1].Name == name && states[n-1].Timestamp+states[n-1].Duration == micros(from) {
+				states[n-1].Duration += to.Sub(from).Microseconds()
+				return
+			}
+			states = append(states, TraceEvent{Name: name, Phase: "X", Timestamp: micros(from), Duration: to.Sub(from).Microseconds(), PID: 1, TID: tid})
+		}
+
+		for j, event := range events {
+			next := end
+			if j+1 < len(events) {
+				next = events[j+1].Timestamp
+			}
+			if state := timelineState(event.Type); state != "" {
+				busyUntil := next
+				if limit := event.Timestamp.Add(TimelineIdleAfter); limit.Before(busyUntil) {
+					busyUntil = limit
+				}
+				addState(state, event.Timestamp, busyUntil)
+				addState("idle", busyUntil, next)
+			}
+
+			timeline.TraceEvents = append(timeline.TraceEvents, TraceEvent{
+				Name: string(event.Type), Phase: "i", Scope: "t", Timestamp: micros(event.Timestamp), PID: 1, TID: tid,
+				Args: map[string]interface{}{"detail": firstTimelineLine(timelineText(event))},
+			})
+		}
+		timeline.TraceEvents = append(timeline.TraceEvents, states...)
+
+		if patch.Termination != "" {
+			timeline.TraceEvents = append(timeline.TraceEvents, TraceEvent{
+				Name: "stopped", Phase: "i", Scope: "t", Timestamp: micros(end), PID: 1, TID: tid,
+				Args: map[string]interface{}{"reason": patch.Termination},
+			})
+		}
+	}
+
+	return timeline
+}
+
+// timelineState names the state an agent is in after an event ("" once it has finished)
+func timelineState(eventType protocol.EventType) string {
+	switch eventType {
+	case protocol.EventTypePrompt:
+		return "starting"
+	case protocol.EventTypeThinking:
+		return "thinking"
+	case protocol.EventTypeAction:
+		return "acting"
+	case protocol.EventTypeError:
+		return "error"
+	case protocol.EventTypeComplete:
+		return ""
+	default:
+		return "working"
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := func(agentID string, eventType protocol.EventType, offset time.Duration) *protocol.Event {
+		e := protocol.NewEvent(eventType, agentID, 0)
+		e.Timestamp = start.Add(offset)
+		return e
+	}
+
+	timeline := BuildTimeline(map[string]*PatchDetails{
+		"codex": {
+			Events: []*protocol.Event{
+				event("codex", protocol.EventTypePrompt, time.Second),
+				event("codex", protocol.EventTypeThinking, 3*time.Second),
+			},
+			Usage:       AgentUsage{Duration: 2 * time.Minute},
+			Termination: "idle limit exceeded: no activity for 1m58s",
+		},
+		"claude": {
+			Events: []*protocol.Event{
+				event("claude", protocol.EventTypePrompt, 0),
+				event("claude", protocol.EventTypeThinking, 2*time.Second),
+				event("claude", protocol.EventTypeThinking, 4*time.Second),
+				event("claude", protocol.EventTypeAction, 10*time.Second),
+				event("claude", protocol.EventTypeComplete, 12*time.Second),
+			},
+		},
+		"silent": {},
+	})
+	assert.Equal(t, "ms", timeline.DisplayTimeUnit)
+
+	states := func(tid int) []TraceEvent {
+		var found []TraceEvent
+		for _, e := range timeline.TraceEvents {
+			if e.TID == tid && e.Phase == "X" {
+				found = append(found, TraceEvent{Name: e.Name, Timestamp: e.Timestamp, Duration: e.Duration})
+			}
+		}
+		return found
+	}
+	second := time.Second.Microseconds()
+
+	// Agents are rows sorted by ID, skipping those without events; consecutive thoughts are one state
+	require.Equal(t, TraceEvent{Name: "thread_name", Phase: "M", PID: 1, TID: 1, Args: map[string]interface{}{"name": "claude"}}, timeline.TraceEvents[0])
+	assert.Equal(t, []TraceEvent{
+		{Name: "starting", Timestamp: 0, Duration: 2 * second},
+		{Name: "thinking", Timestamp: 2 * second, Duration: 8 * second},
+		{Name: "acting", Timestamp: 10 * second, Duration: 2 * second},
+	}, states(1))
+
+	// A long silence turns idle, up to when the watchdog stopped the agent
+	assert.Equal(t, []TraceEvent{
+		{Name: "starting", Timestamp: 1 * second, Duration: 2 * second},
+		{Name: "thinking", Timestamp: 3 * second, Duration: 30 * second},
+		{Name: "idle", Timestamp: 33 * second, Duration: 88 * second},
+	}, states(2))
+	last := timeline.TraceEvents[len(timeline.TraceEvents)-1]
+	assert.Equal(t, "stopped", last.Name)
+	assert.Equal(t, 121*second, last.Timestamp)
+	assert.Equal(t, "idle limit exceeded: no activity for 1m58s", last.Args["reason"])
+
+	for _, e := range timeline.TraceEvents {
+		assert.NotEqual(t, 3, e.TID, "Agents without events have no row")
+	}
+}
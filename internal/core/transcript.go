@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// TranscriptPath returns where a run directory keeps an agent's transcript
+func TranscriptPath(runDir, agentID string) string {
+	return filepath.Join(runDir, TranscriptsDir, safeFileName(agentID)+".jsonl")
+}
+
+// ReadTranscript loads the events saved in a transcript file, decrypting it with c if it is encrypted
+// Lines that aren't events, such as one cut short when an agent was killed, are skipped. An encrypted transcript that
+// wasn't finished, because it is still being written or was cut short, returns its events with ErrUnfinished
+func ReadTranscript(path string, c *Cipher) ([]*protocol.Event, error) {
+	data, err := readRunFile(path, c)
+	unfinished := errors.Is(err, ErrUnfinished)
+	if err != nil && !unfinished {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+
+	var events []*protocol.Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event protocol.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, &event)
+	}
+	if unfinished && scanner.Err() == nil {
+		return events, fmt.Errorf("failed to read transcript: %w", ErrUnfinished)
+	}
+	return events, scanner.Err()
+}
+
+// TranscriptMarkdown renders an agent's events as Markdown for reading what it did
+// Thinking is quoted, actions show their diff or the content they wrote, and errors and
+// watchdog warnings are called out; each event is timed from the first
+func TranscriptMarkdown(agentID string, events []*protocol.Event) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Transcript of %s\n", agentID)
+	if len(events) == 0 {
+		sb.WriteString("\nNo events were recorded.\n")
+		return sb.String()
+	}
+
+	start := events[0].Timestamp
+	ran := events[len(events)-1].Timestamp.Sub(start).Round(time.Second)
+	fmt.Fprintf(&sb, "\nStarted %s, %d events over %v\n", start.UTC().Format("2006-01-02 15:04:05 UTC"), len(events), ran)
+
+	for _, event := range events {
+		offset := event.Timestamp.Sub(start).Round(time.Second)
+		fmt.Fprintf(&sb, "\n## `+%v` %s\n", offset, transcriptHeading(event))
+		if body := transcriptBody(event); body != "" {
+			sb.WriteString("\n" + body)
+		}
+	}
+	return sb.String()
+}
+
+// transcriptHeading names an event in its heading, e.g. "Action: edit `main.go`"
+func transcriptHeading(event *protocol.Event) string {
+	switch event.Type {
+	case protocol.EventTypePrompt:
+		return "Prompt"
+	case protocol.EventTypeThinking:
+		return "Thinking"
+	case protocol.EventTypeAction:
+		if payload, err := event.UnmarshalActionPayload(); err == nil {
+			heading := "Action: " + payload.ActionType
+			if payload.FilePath != "" {
+				heading += " `" + payload.FilePath + "`"
+			}
+			return heading
+		}
+		return "Action"
+	case protocol.EventTypeError:
+		if payload, err := event.UnmarshalErrorPayload(); err == nil && payload.Code != "" {
+			return "Error `" + payload.Code + "`"
+		}
+		return "Error"
+	case protocol.EventTypeComplete:
+		return "Completed"
+	case protocol.EventTypeWatchdog:
+		return "Watchdog warning"
+	case protocol.EventTypeCancel:
+		return "Cancelled"
+	}
+	return string(event.Type)
+}
+
+// transcriptBody renders what an event says, ending with a newline (empty if it says nothing)
+func transcriptBody(event *protocol.Event) string {
+	switch event.Type {
+	case protocol.EventTypePrompt:
+		payload, err := event.UnmarshalPromptPayload()
+		if err != nil {
+			break
+		}
+		body := fence(payload.Prompt, "")
+		if len(payload.ContextFiles) > 0 {
+			body += "\nContext files: `" + strings.Join(payload.ContextFiles, "`, `") + "`\n"
+		}
+		return body
+	case protocol.EventTypeThinking:
+		if payload, err := event.UnmarshalThinkingPayload(); err == nil {
+			return quote(payload.Content)
+		}
+	case protocol.EventTypeAction:
+		payload, err := event.UnmarshalActionPayload()
+		if err != nil {
+			break
+		}
+		switch {
+		case payload.Diff != "":
+			return fence(payload.Diff, "diff")
+		case payload.Content != "":
+			return fence(payload.Content, strings.TrimPrefix(filepath.Ext(payload.FilePath), "."))
+		}
+		return ""
+	case protocol.EventTypeError:
+		if payload, err := event.UnmarshalErrorPayload(); err == nil {
+			return quote(payload.Message)
+		}
+	case protocol.EventTypeWatchdog:
+		var payload struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err == nil && payload.Message != "" {
+			return quote(payload.Message)
+		}
+	}
+
+	if len(event.Payload) == 0 || string(event.Payload) == "null" || string(event.Payload) == "{}" {
+		return ""
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, event.Payload, "", "  "); err != nil {
+		return fence(string(event.Payload), "")
+	}
+	return fence(indented.String(), "json")
+}
+
+// quote renders text as a Markdown block quote
+func quote(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscriptMarkdown(t *testing.T) {
+	runDir := t.TempDir()
+	w, err := NewRunWriter(runDir, &Config{})
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := func(eventType protocol.EventType, offset time.Duration, payload interface{}) *protocol.Event {
+		e, err := protocol.NewEvent(eventType, "team/claude", 0).WithPayload(payload)
+		require.NoError(t, err)
+		e.Timestamp = start.Add(offset)
+		return e
+	}
+	diff := "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-return 1\n+return 2\n"
+	require.NoError(t, w.WriteTranscript("team/claude", []*protocol.Event{
+		event(protocol.EventTypePrompt, 0, protocol.PromptPayload{Prompt: "Fix the bug", ContextFiles: []string{"main.go"}}),
+		event(protocol.EventTypeThinking, 2*time.Second, protocol.ThinkingPayload{Content: "Reading main.go\n\nthen fixing it"}),
+		event(protocol.EventTypeAction, 5*time.Second, protocol.ActionPayload{ActionType: "edit", FilePath: "main.go", Diff: diff}),
+		event(protocol.EventTypeAction, 6*time.Second, protocol.ActionPayload{ActionType: "create", FilePath: "util.go", Content: "package main\n"}),
+		event(protocol.EventTypeError, 7*time.Second, protocol.ErrorPayload{Message: "build failed", Code: "E42"}),
+		event(protocol.EventTypeWatchdog, 8*time.Second, map[string]interface{}{"message": "80% of the token limit used"}),
+		event(protocol.EventTypeComplete, 10*time.Second, nil),
+	}))
+
+	// A line cut short when the agent was killed doesn't stop the rest from being read
+	path := TranscriptPath(runDir, "team/claude")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"type":"thinking","payl`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	events, err := ReadTranscript(path, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 7)
+
+	markdown := TranscriptMarkdown("team/claude", events)
+	assert.Contains(t, markdown, "# Transcript of team/claude\n\nStarted 2024-01-02 03:04:05 UTC, 7 events over 10s\n")
+	assert.Contains(t, markdown, "## `+0s` Prompt\n\n```\nFix the bug\n```\n\nContext files: `main.go`\n")
+	assert.Contains(t, markdown, "## `+2s` Thinking\n\n> Reading main.go\n>\n> then fixing it\n")
+	assert.Contains(t, markdown, "## `+5s` Action: edit `main.go`\n\n```diff\n"+diff+"```\n")
+	assert.Contains(t, markdown, "## `+6s` Action: create `util.go`\n\n```go\npackage main\n```\n")
+	assert.Contains(t, markdown, "## `+7s` Error `E42`\n\n> build failed\n")
+	assert.Contains(t, markdown, "## `+8s` Watchdog warning\n\n> 80% of the token limit used\n")
+	assert.Contains(t, markdown, "## `+10s` Completed\n")
+
+	assert.Equal(t, "# Transcript of codex\n\nNo events were recorded.\n", TranscriptMarkdown("codex", nil))
+	_, err = ReadTranscript(TranscriptPath(runDir, "codex"), nil)
+	assert.Error(t, err)
+}
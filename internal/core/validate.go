@@ -0,0 +1,254 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigError describes a single problem in a configuration file
+type ConfigError struct {
+	// Field is the path of the offending field, e.g. "agents[1].type" (empty if not field-specific)
+	Field string
+
+	// Line and Column locate the problem in the file (0 when the location is unknown)
+	Line   int
+	Column int
+
+	// Message describes the problem
+	Message string
+
+	// Suggestion is a likely intended value or field name (empty if there is none)
+	Suggestion string
+}
+
+// Error formats the problem with its location and suggestion
+func (e *ConfigError) Error() string {
+	var sb strings.Builder
+
+	if e.Line > 0 {
+		sb.WriteString(fmt.Sprintf("line %d, column %d: ", e.Line, e.Column))
+	}
+	sb.WriteString(e.Message)
+	if e.Suggestion != "" {
+		sb.WriteString(fmt.Sprintf(" (did you mean '%s'?)", e.Suggestion))
+	}
+
+	return sb.String()
+}
+
+// ConfigErrors collects every problem found in a configuration file
+type ConfigErrors []*ConfigError
+
+// Error lists each problem on its own line
+func (errs ConfigErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// fieldError creates a ConfigError for a specific field
+func fieldError(field, format string, args ...interface{}) *ConfigError {
+	return &ConfigError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// checkUnknownFields reports mapping keys that don't correspond to a field of the target type
+func checkUnknownFields(node *yaml.Node, target reflect.Type) ConfigErrors {
+	var errs ConfigErrors
+	walkUnknownFields(documentRoot(node), target, "", &errs)
+	return errs
+}
+
+// walkUnknownFields recursively compares a node tree against the yaml tags of a type
+func walkUnknownFields(node *yaml.Node, target reflect.Type, path string, errs *ConfigErrors) {
+	for target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	switch {
+	case target.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(target)
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			// Merge keys pull in fields from another mapping of the same type
+			if key.Tag == "!!merge" || key.Value == "<<" {
+				walkUnknownFields(value, target, path, errs)
+				continue
+			}
+
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				message := fmt.Sprintf("unknown field '%s'", key.Value)
+				if path != "" {
+					message = fmt.Sprintf("unknown field '%s' in %s", key.Value, path)
+				}
+				*errs = append(*errs, &ConfigError{
+					Field:      joinPath(path, key.Value),
+					Line:       key.Line,
+					Column:     key.Column,
+					Message:    message,
+					Suggestion: suggest(key.Value, names),
+				})
+				continue
+			}
+			walkUnknownFields(value, fieldType, joinPath(path, key.Value), errs)
+		}
+	case target.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkUnknownFields(node.Content[i+1], target.Elem(), joinPath(path, node.Content[i].Value), errs)
+		}
+	case target.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			walkUnknownFields(item, target.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+// yamlFields maps the yaml names of a struct's fields to their types
+func yamlFields(target reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, target.NumField())
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// locateErrors fills in the line and column of errors from the node tree
+func locateErrors(node *yaml.Node, errs ConfigErrors) {
+	for _, err := range errs {
+		if err.Line > 0 || err.Field == "" {
+			continue
+		}
+		if target := locate(documentRoot(node), err.Field); target != nil {
+			err.Line, err.Column = target.Line, target.Column
+		}
+	}
+}
+
+// locate finds the value node for a field path such as "agents[1].type"
+// It returns nil if the field isn't present in the file
+func locate(node *yaml.Node, path string) *yaml.Node {
+	for _, part := range strings.Split(path, ".") {
+		name, indexes := part, []int(nil)
+		if open := strings.Index(part, "["); open >= 0 {
+			name = part[:open]
+			for _, index := range strings.Split(strings.Trim(part[open:], "[]"), "][") {
+				i, err := strconv.Atoi(index)
+				if err != nil {
+					return nil
+				}
+				indexes = append(indexes, i)
+			}
+		}
+
+		if name != "" {
+			node = mappingValue(node, name)
+			if node == nil {
+				return nil
+			}
+		}
+
+		for _, i := range indexes {
+			if node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[i]
+		}
+	}
+	return node
+}
+
+// mappingValue returns the value node for a key of a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// documentRoot unwraps a document node to its top-level content
+func documentRoot(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		return node.Content[0]
+	}
+	return node
+}
+
+// joinPath appends a field name to a dotted path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// suggest returns the candidate closest to a misspelled value, or "" if none is close enough
+func suggest(value string, candidates []string) string {
+	best, bestDistance := "", -1
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(value), candidate)
+		if bestDistance < 0 || distance < bestDistance || (distance == bestDistance && candidate < best) {
+			best, bestDistance = candidate, distance
+		}
+	}
+
+	// Only suggest names that are a plausible typo
+	maxDistance := len(value) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	if bestDistance < 0 || bestDistance > maxDistance {
+		return ""
+	}
+	return best
+}
+
+// editDistance computes the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
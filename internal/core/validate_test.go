@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_UnknownFields(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	configData := `working_dir: "/tmp/test-dir"
+timeout_second: 600
+agents:
+  - id: "test-agent"
+    type: "cli"
+    test_comand: "go test ./..."
+    config:
+      anything: "goes"
+mutation:
+  enabeld: true
+`
+
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0644))
+
+	_, err := Load(configPath)
+	require.Error(t, err)
+
+	// Every unknown field is reported with its location and a suggestion
+	var configErrs ConfigErrors
+	require.True(t, errors.As(err, &configErrs), "Unknown fields should be reported as ConfigErrors")
+	require.Len(t, configErrs, 3, "Adapter-specific config should not be checked")
+
+	assert.Equal(t, "line 2, column 1: unknown field 'timeout_second' (did you mean 'timeout_seconds'?)", configErrs[0].Error())
+	assert.Equal(t, "agents[0].test_comand", configErrs[1].Field)
+	assert.Equal(t, 6, configErrs[1].Line)
+	assert.Equal(t, 5, configErrs[1].Column)
+	assert.Equal(t, "test_command", configErrs[1].Suggestion)
+	assert.Equal(t, "mutation.enabeld", configErrs[2].Field)
+	assert.Equal(t, "enabled", configErrs[2].Suggestion)
+}
+
+func TestLoadConfig_ValidationLocation(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	configData := `working_dir: "/tmp/test-dir"
+worktree_backend: "worktre"
+agents:
+  - id: "test-agent"
+    type: "cli"
+`
+
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0644))
+
+	_, err := Load(configPath)
+	require.Error(t, err)
+	assert.Equal(t, "line 2, column 19: worktree_backend 'worktre' is invalid, must be 'auto', 'worktree', or 'clone' (did you mean 'worktree'?)", err.Error())
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"timeout_seconds", "test_command", "working_dir"}
+
+	assert.Equal(t, "timeout_seconds", suggest("timeout_secs", candidates))
+	assert.Equal(t, "working_dir", suggest("WORKING_DIR", candidates), "Suggestions should ignore case")
+	assert.Equal(t, "", suggest("prompt", candidates), "Unrelated names should not get a suggestion")
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("cli", "cli"))
+	assert.Equal(t, 1, editDistance("clii", "cli"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+	assert.Equal(t, 4, editDistance("", "http"))
+}
@@ -2,7 +2,10 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/fs"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -10,18 +13,81 @@ import (
 )
 
 // ResourceLimits defines the maximum resources an agent can use
+// A zero limit is not enforced
 type ResourceLimits struct {
 	// MaxTokens is the maximum number of tokens an agent can consume
 	MaxTokens int
 
+	// MaxCost is the maximum amount in US dollars an agent can spend
+	MaxCost float64
+
 	// MaxDuration is the maximum time an agent can run
 	MaxDuration time.Duration
+
+	// MaxIdle is the maximum time an agent can go without emitting an event
+	MaxIdle time.Duration
+
+	// MaxDiskBytes is the maximum size an agent's worktree can grow to (0 for unlimited)
+	MaxDiskBytes int64
+
+	// MaxMemoryBytes is the most resident memory an agent's process tree can use (0 for unlimited)
+	MaxMemoryBytes int64
+
+	// MaxCPUTime is the most CPU time an agent's process tree can use (0 for unlimited)
+	MaxCPUTime time.Duration
+
+	// MaxRunCost is the most all agents together can spend in US dollars
+	// Only the watchdog's global limits use it; once it is reached every running agent is stopped
+	MaxRunCost float64
+
+	// MaxRunTokens is the most tokens all agents together can use
+	// Only the watchdog's global limits use it; once it is reached every running agent is stopped
+	MaxRunTokens int
+
+	// WarnAt holds the increasing fractions of each limit at which an agent is warned
+	// nil uses DefaultWarnAt; an empty list disables warnings
+	WarnAt []float64
+
+	// CheckInterval is how often limits are checked (0 for DefaultCheckInterval)
+	// Only the watchdog's global limits use it
+	CheckInterval time.Duration
+
+	// CancelGrace is how long agents are given to wrap up once the run is interrupted (0 for DefaultCancelGrace)
+	// Only the global limits use it
+	CancelGrace time.Duration
+}
+
+// WarningThresholds returns the fractions of each limit at which agents are warned
+func (l ResourceLimits) WarningThresholds() []float64 {
+	if l.WarnAt == nil {
+		return DefaultWarnAt
+	}
+	return l.WarnAt
+}
+
+// DefaultWarnAt is the fraction of a limit at which agents are warned when no thresholds are configured
+var DefaultWarnAt = []float64{0.8}
+
+// DefaultCheckInterval is how often the watchdog checks limits when no interval is configured
+const DefaultCheckInterval = 5 * time.Second
+
+// DefaultCancelGrace is how long agents are given to wrap up once the run is interrupted when no period is configured
+const DefaultCancelGrace = 10 * time.Second
+
+// CancelGracePeriod returns how long agents are given to wrap up once the run is interrupted
+func (l ResourceLimits) CancelGracePeriod() time.Duration {
+	if l.CancelGrace <= 0 {
+		return DefaultCancelGrace
+	}
+	return l.CancelGrace
 }
 
 // DefaultLimits provides sensible defaults for resource limits
+// A hung agent would otherwise hold up the run until its time limit, so silence is limited too
 var DefaultLimits = ResourceLimits{
 	MaxTokens:   10000, // 10K tokens by default
 	MaxDuration: 5 * time.Minute,
+	MaxIdle:     2 * time.Minute,
 }
 
 // TokenCounter tracks token usage for a specific agent
@@ -35,11 +101,41 @@ type TokenCounter struct {
 	// OutputTokens counts tokens generated by the agent
 	OutputTokens int
 
+	// CostUSD is the amount in US dollars the agent has reported spending
+	CostUSD float64
+
 	// StartTime records when monitoring began
 	StartTime time.Time
 
 	// LastActivity records the last time we received an event
 	LastActivity time.Time
+
+	// LongestIdle is the longest time the agent went without emitting an event, up to its last event
+	LongestIdle time.Duration
+
+	// WorktreePath is the agent's worktree, used to measure disk usage
+	WorktreePath string
+
+	// DiskBytes is the most recently measured size of the agent's worktree
+	DiskBytes int64
+
+	// Pid is the agent's process, used to measure the memory and CPU time of its process tree (0 if unknown)
+	Pid int
+
+	// MemoryBytes is the most recently measured resident memory of the agent's process tree
+	MemoryBytes int64
+
+	// PeakMemoryBytes is the most resident memory the agent's process tree has been measured using
+	PeakMemoryBytes int64
+
+	// CPUTime is the CPU time the agent's process tree has used
+	CPUTime time.Duration
+
+	// Warnings holds the watchdog warnings the agent was sent, in order
+	Warnings []string
+
+	// clock measures the agent's running and idle time (nil for the wall clock)
+	clock Clock
 }
 
 // TotalTokens returns the sum of input and output tokens
@@ -49,41 +145,232 @@ func (tc *TokenCounter) TotalTokens() int {
 
 // Duration returns how long the agent has been running
 func (tc *TokenCounter) Duration() time.Duration {
-	return time.Since(tc.StartTime)
+	return tc.now().Sub(tc.StartTime)
 }
 
 // TimeSinceLastActivity returns time since the last activity
 func (tc *TokenCounter) TimeSinceLastActivity() time.Duration {
-	return time.Since(tc.LastActivity)
+	return tc.now().Sub(tc.LastActivity)
+}
+
+// now returns the current time on the counter's clock
+func (tc *TokenCounter) now() time.Time {
+	if tc.clock == nil {
+		return time.Now()
+	}
+	return tc.clock.Now()
+}
+
+// MaxIdle returns the longest time the agent has gone without emitting an event, including its current silence
+func (tc *TokenCounter) MaxIdle() time.Duration {
+	if idle := tc.TimeSinceLastActivity(); idle > tc.LongestIdle {
+		return idle
+	}
+	return tc.LongestIdle
+}
+
+// AgentUsage is what an agent consumed over a run, as measured by the watchdog
+type AgentUsage struct {
+	// Tokens is the total of input and output tokens
+	Tokens int
+
+	// CostUSD is the amount in US dollars the agent reported spending
+	CostUSD float64
+
+	// Duration is how long the agent ran
+	Duration time.Duration
+
+	// IdleTime is the longest the agent went without emitting an event
+	IdleTime time.Duration
+
+	// PeakMemoryBytes is the most resident memory the agent's process tree was measured using (0 if not measured)
+	PeakMemoryBytes int64
+
+	// CPUTime is the CPU time the agent's process tree used (0 if not measured)
+	CPUTime time.Duration
+
+	// Warnings holds the watchdog warnings the agent was sent as it approached its limits
+	Warnings []string
+}
+
+// Add returns the usage of two stretches of an agent's work together, such as its rounds of refinement
+// Amounts add up, while the longest idle stretch and the peak memory are the larger of the two
+func (u AgentUsage) Add(other AgentUsage) AgentUsage {
+	return AgentUsage{
+		Tokens:          u.Tokens + other.Tokens,
+		CostUSD:         u.CostUSD + other.CostUSD,
+		Duration:        u.Duration + other.Duration,
+		IdleTime:        max(u.IdleTime, other.IdleTime),
+		PeakMemoryBytes: max(u.PeakMemoryBytes, other.PeakMemoryBytes),
+		CPUTime:         u.CPUTime + other.CPUTime,
+		Warnings:        append(append([]string(nil), u.Warnings...), other.Warnings...),
+	}
+}
+
+// Usage snapshots the counter's totals
+func (tc *TokenCounter) Usage() AgentUsage {
+	return AgentUsage{
+		Tokens:          tc.TotalTokens(),
+		CostUSD:         tc.CostUSD,
+		Duration:        tc.Duration(),
+		IdleTime:        tc.MaxIdle(),
+		PeakMemoryBytes: tc.PeakMemoryBytes,
+		CPUTime:         tc.CPUTime,
+		Warnings:        append([]string(nil), tc.Warnings...),
+	}
 }
 
 // Watchdog monitors agent resource usage and enforces limits
 type Watchdog struct {
-	mutex    sync.Mutex
-	limits   ResourceLimits
-	counters map[string]*TokenCounter
-	warnings map[string]bool // Tracks if we've sent a warning for an agent
+	mutex       sync.Mutex
+	clock       Clock
+	limits      ResourceLimits
+	agentLimits map[string]ResourceLimits // Per-agent overrides of the global limits
+	counters    map[string]*TokenCounter
+	warnings    map[string]int    // How many warning thresholds each agent has been warned at
+	nudged      map[string]int    // How many warning thresholds each agent's current silence has been warned at
+	terminated  map[string]string // Why agents were terminated, keeping their usage for the results
+	spent       float64           // What agents no longer monitored spent, counted toward the run budget
+	spentTokens int               // Tokens agents no longer monitored used, counted toward the run token budget
 }
 
 // NewWatchdog creates a new resource usage watchdog
 func NewWatchdog(limits ResourceLimits) *Watchdog {
 	return &Watchdog{
-		limits:   limits,
-		counters: make(map[string]*TokenCounter),
-		warnings: make(map[string]bool),
+		clock:       SystemClock{},
+		limits:      limits,
+		agentLimits: make(map[string]ResourceLimits),
+		counters:    make(map[string]*TokenCounter),
+		warnings:    make(map[string]int),
+		nudged:      make(map[string]int),
+		terminated:  make(map[string]string),
 	}
 }
 
+// SetClock replaces the wall clock the watchdog measures agents' running and idle time and times its checks with
+// It must be called before any agent is monitored or checks start
+func (w *Watchdog) SetClock(clock Clock) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.clock = clock
+}
+
+// SetAgentLimits overrides the global resource limits for a single agent
+func (w *Watchdog) SetAgentLimits(agentID string, limits ResourceLimits) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.agentLimits[agentID] = limits
+}
+
+// limitsFor returns the effective limits for an agent
+// The caller must hold the mutex
+func (w *Watchdog) limitsFor(agentID string) ResourceLimits {
+	if limits, ok := w.agentLimits[agentID]; ok {
+		return limits
+	}
+	return w.limits
+}
+
 // MonitorAgent starts tracking resource usage for an agent
 func (w *Watchdog) MonitorAgent(agentID string) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
+	now := w.clock.Now()
 	w.counters[agentID] = &TokenCounter{
 		AgentID:      agentID,
-		StartTime:    time.Now(),
-		LastActivity: time.Now(),
+		StartTime:    now,
+		LastActivity: now,
+		clock:        w.clock,
+	}
+}
+
+// SetWorktree records the worktree path for an agent so its disk usage can be monitored
+func (w *Watchdog) SetWorktree(agentID, worktreePath string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if counter, exists := w.counters[agentID]; exists {
+		counter.WorktreePath = worktreePath
+	}
+}
+
+// UpdateDiskUsage measures the worktree size of every monitored agent
+// Directory walks happen outside the lock so event tracking isn't blocked
+func (w *Watchdog) UpdateDiskUsage() {
+	w.mutex.Lock()
+	paths := make(map[string]string, len(w.counters))
+	for agentID, counter := range w.counters {
+		// Only agents with a disk quota need to be measured
+		if counter.WorktreePath != "" && w.limitsFor(agentID).MaxDiskBytes > 0 {
+			paths[agentID] = counter.WorktreePath
+		}
+	}
+	w.mutex.Unlock()
+
+	for agentID, path := range paths {
+		size := dirSize(path)
+
+		w.mutex.Lock()
+		if counter, exists := w.counters[agentID]; exists {
+			counter.DiskBytes = size
+		}
+		w.mutex.Unlock()
+	}
+}
+
+// SetProcess records an agent's process so the memory and CPU time of its process tree can be monitored
+func (w *Watchdog) SetProcess(agentID string, pid int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if counter, exists := w.counters[agentID]; exists {
+		counter.Pid = pid
+	}
+}
+
+// UpdateProcessUsage measures the memory and CPU time of every monitored agent's process tree
+// The process table is read outside the lock so event tracking isn't blocked
+func (w *Watchdog) UpdateProcessUsage() error {
+	w.mutex.Lock()
+	pids := make(map[string]int, len(w.counters))
+	var roots []int
+	for agentID, counter := range w.counters {
+		if counter.Pid > 0 {
+			pids[agentID] = counter.Pid
+			roots = append(roots, counter.Pid)
+		}
+	}
+	w.mutex.Unlock()
+
+	if len(roots) == 0 {
+		return nil
+	}
+	usage, err := SampleProcessTrees(roots)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for agentID, pid := range pids {
+		sample, running := usage[pid]
+		counter, exists := w.counters[agentID]
+		if !running || !exists {
+			continue
+		}
+		counter.MemoryBytes = sample.MemoryBytes
+		if sample.MemoryBytes > counter.PeakMemoryBytes {
+			counter.PeakMemoryBytes = sample.MemoryBytes
+		}
+		// CPU time only grows, even if a descendant exits before its parent collects it
+		if sample.CPUTime > counter.CPUTime {
+			counter.CPUTime = sample.CPUTime
+		}
 	}
+	return nil
 }
 
 // TrackEvent processes an agent event to update resource usage
@@ -99,107 +386,312 @@ func (w *Watchdog) TrackEvent(event *protocol.Event) {
 	counter, exists := w.counters[event.AgentID]
 	if !exists {
 		// Start monitoring this agent if we weren't already
+		now := w.clock.Now()
 		counter = &TokenCounter{
 			AgentID:      event.AgentID,
-			StartTime:    time.Now(),
-			LastActivity: time.Now(),
+			StartTime:    now,
+			LastActivity: now,
+			clock:        w.clock,
 		}
 		w.counters[event.AgentID] = counter
 	}
 
-	// Update last activity time
-	counter.LastActivity = time.Now()
-
-	// Extract token usage from event if available
-	tokenCount := extractTokenCount(event)
-	if tokenCount > 0 {
-		// Assume it's output tokens for now (could be refined based on event type)
-		counter.OutputTokens += tokenCount
+	// Update last activity time; a stall that ends can be warned about again when the next one starts
+	if idle := counter.TimeSinceLastActivity(); idle > counter.LongestIdle {
+		counter.LongestIdle = idle
+	}
+	counter.LastActivity = w.clock.Now()
+	delete(w.nudged, event.AgentID)
+
+	// Track reported token usage
+	input, output := extractTokenUsage(event)
+	counter.InputTokens += input
+	counter.OutputTokens += output
+
+	// Track reported spend
+	if cost, cumulative := extractCost(event); cumulative {
+		if cost > counter.CostUSD {
+			counter.CostUSD = cost
+		}
+	} else {
+		counter.CostUSD += cost
 	}
 }
 
 // CheckLimits checks if any agent has exceeded its resource limits
-// It returns the IDs of agents that should be terminated
+// It returns the IDs of agents that should be terminated; agents already terminated are left out
 func (w *Watchdog) CheckLimits() []string {
+	var agentsToStop []string
+	for agentID := range w.violations() {
+		agentsToStop = append(agentsToStop, agentID)
+	}
+	return agentsToStop
+}
+
+// violations returns why each agent that has exceeded its resource limits should be terminated
+func (w *Watchdog) violations() map[string]string {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	var agentsToStop []string
+	// Once a run budget is spent, every agent still running is stopped
+	overBudget := w.runBudgetExceeded()
 
+	violations := make(map[string]string)
 	for agentID, counter := range w.counters {
-		// Check token limit
-		if counter.TotalTokens() > w.limits.MaxTokens {
-			agentsToStop = append(agentsToStop, agentID)
+		if _, done := w.terminated[agentID]; done {
 			continue
 		}
+		if reason := exceededLimit(counter, w.limitsFor(agentID)); reason != "" {
+			violations[agentID] = reason
+		} else if overBudget != "" {
+			violations[agentID] = overBudget
+		}
+	}
+	return violations
+}
 
-		// Check duration limit
-		if counter.Duration() > w.limits.MaxDuration {
-			agentsToStop = append(agentsToStop, agentID)
-			continue
+// RunBudgetExceeded describes the run budget all agents together have used up ("" if none)
+// Agents shouldn't be started once it is
+func (w *Watchdog) RunBudgetExceeded() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.runBudgetExceeded()
+}
+
+// runBudgetExceeded describes the first run budget used up ("" if none)
+// The caller must hold the mutex
+func (w *Watchdog) runBudgetExceeded() string {
+	if budget := w.limits.MaxRunCost; budget > 0 {
+		if spent := w.runCost(); spent >= budget {
+			return fmt.Sprintf("run budget exceeded: $%.2f/$%.2f spent by all agents", spent, budget)
+		}
+	}
+	if budget := w.limits.MaxRunTokens; budget > 0 {
+		if used := w.runTokens(); used >= budget {
+			return fmt.Sprintf("run token budget exceeded: %d/%d tokens used by all agents", used, budget)
 		}
 	}
+	return ""
+}
 
-	return agentsToStop
+// RunTokens returns the tokens every agent has used so far, including agents no longer monitored
+func (w *Watchdog) RunTokens() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.runTokens()
+}
+
+// runTokens totals the tokens of every agent
+// The caller must hold the mutex
+func (w *Watchdog) runTokens() int {
+	total := w.spentTokens
+	for _, counter := range w.counters {
+		total += counter.TotalTokens()
+	}
+	return total
+}
+
+// RunCost returns what every agent has spent so far, including agents no longer monitored
+func (w *Watchdog) RunCost() float64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.runCost()
+}
+
+// runCost totals the spend of every agent
+// The caller must hold the mutex
+func (w *Watchdog) runCost() float64 {
+	total := w.spent
+	for _, counter := range w.counters {
+		total += counter.CostUSD
+	}
+	return total
+}
+
+// exceededLimit describes the first limit a counter has exceeded ("" if none)
+func exceededLimit(counter *TokenCounter, limits ResourceLimits) string {
+	switch {
+	case limits.MaxTokens > 0 && counter.TotalTokens() > limits.MaxTokens:
+		return fmt.Sprintf("token limit exceeded: %d/%d tokens used", counter.TotalTokens(), limits.MaxTokens)
+	case limits.MaxCost > 0 && counter.CostUSD > limits.MaxCost:
+		return fmt.Sprintf("cost limit exceeded: $%.2f/$%.2f spent", counter.CostUSD, limits.MaxCost)
+	case limits.MaxDuration > 0 && counter.Duration() > limits.MaxDuration:
+		return fmt.Sprintf("time limit exceeded: ran longer than %v", limits.MaxDuration)
+	case limits.MaxIdle > 0 && counter.TimeSinceLastActivity() > limits.MaxIdle:
+		return fmt.Sprintf("idle limit exceeded: no activity for %v", counter.TimeSinceLastActivity().Round(time.Second))
+	case limits.MaxDiskBytes > 0 && counter.DiskBytes > limits.MaxDiskBytes:
+		return fmt.Sprintf("disk quota exceeded: %d/%d bytes used", counter.DiskBytes, limits.MaxDiskBytes)
+	case limits.MaxMemoryBytes > 0 && counter.MemoryBytes > limits.MaxMemoryBytes:
+		return fmt.Sprintf("memory limit exceeded: %s/%s resident", formatSize(counter.MemoryBytes), formatSize(limits.MaxMemoryBytes))
+	case limits.MaxCPUTime > 0 && counter.CPUTime > limits.MaxCPUTime:
+		return fmt.Sprintf("CPU time limit exceeded: %v/%v used", counter.CPUTime.Round(time.Second), limits.MaxCPUTime)
+	}
+	return ""
+}
+
+// TerminationReason returns why the watchdog terminated an agent ("" if it didn't)
+func (w *Watchdog) TerminationReason(agentID string) string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.terminated[agentID]
 }
 
 // GetWarningEvents generates warning events for agents approaching limits
+// Warnings escalate: an agent is warned once at each threshold, about the limit it is closest to reaching
 func (w *Watchdog) GetWarningEvents() []*protocol.Event {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
 	var warnings []*protocol.Event
-	warningThreshold := 0.8 // 80% of limit
-
 	for agentID, counter := range w.counters {
-		// Skip agents we've already warned
-		if w.warnings[agentID] {
+		if _, done := w.terminated[agentID]; done {
 			continue
 		}
-
-		// Check token limit threshold
-		tokenThreshold := int(float64(w.limits.MaxTokens) * warningThreshold)
-		if counter.TotalTokens() > tokenThreshold {
-			// Create warning event
-			event := protocol.NewEvent(protocol.EventTypeWatchdog, "", 0)
-
-			payload := map[string]interface{}{
-				"target_agent_id": agentID,
-				"message":        fmt.Sprintf("Approaching token limit: %d/%d tokens used", counter.TotalTokens(), w.limits.MaxTokens),
-				"resource":       "tokens",
-				"current":        counter.TotalTokens(),
-				"limit":          w.limits.MaxTokens,
+		limits := w.limitsFor(agentID)
+		thresholds := limits.WarningThresholds()
+
+		// Nudge silent agents before the idle limit stops them; each stall is warned about afresh
+		// An agent already past the limit is about to be terminated instead
+		if idle := counter.TimeSinceLastActivity(); limits.MaxIdle > 0 && idle <= limits.MaxIdle {
+			level := thresholdsCrossed(thresholds, idle.Seconds()/limits.MaxIdle.Seconds())
+			if level > w.nudged[agentID] {
+				message := fmt.Sprintf("No activity for %v; stopping after %v without activity", idle.Round(time.Second), limits.MaxIdle)
+				warnings = append(warnings, warningEvent(agentID, "idle", message, idle.Seconds(), limits.MaxIdle.Seconds(), thresholds[level-1]))
+				counter.Warnings = append(counter.Warnings, message)
+				w.nudged[agentID] = level
 			}
-
-			event, _ = event.WithPayload(payload)
-			warnings = append(warnings, event)
-			w.warnings[agentID] = true
-			continue
 		}
 
-		// Check time limit threshold
-		timeThreshold := time.Duration(float64(w.limits.MaxDuration) * warningThreshold)
-		if counter.Duration() > timeThreshold {
-			// Create warning event
-			event := protocol.NewEvent(protocol.EventTypeWatchdog, "", 0)
-
-			payload := map[string]interface{}{
-				"target_agent_id": agentID,
-				"message":        fmt.Sprintf("Approaching time limit: %v/%v elapsed", counter.Duration().Round(time.Second), w.limits.MaxDuration),
-				"resource":       "time",
-				"current":        counter.Duration().Seconds(),
-				"limit":          w.limits.MaxDuration.Seconds(),
+		// Find the limit the agent is closest to reaching
+		var closest *limitUsage
+		for _, usage := range usageOfLimits(counter, limits) {
+			if closest == nil || usage.fraction > closest.fraction {
+				closest = &usage
 			}
-
-			event, _ = event.WithPayload(payload)
-			warnings = append(warnings, event)
-			w.warnings[agentID] = true
+		}
+		if closest == nil {
+			continue
+		}
+		if level := thresholdsCrossed(thresholds, closest.fraction); level > w.warnings[agentID] {
+			warnings = append(warnings, warningEvent(agentID, closest.resource, closest.message, closest.current, closest.limit, thresholds[level-1]))
+			counter.Warnings = append(counter.Warnings, closest.message)
+			w.warnings[agentID] = level
 		}
 	}
 
 	return warnings
 }
 
+// limitUsage is how much of one limit an agent has used
+type limitUsage struct {
+	resource string
+	current  interface{}
+	limit    interface{}
+	fraction float64
+	message  string
+}
+
+// usageOfLimits lists how much of each enforced limit, other than idle time, a counter has used
+func usageOfLimits(counter *TokenCounter, limits ResourceLimits) []limitUsage {
+	var usage []limitUsage
+	if limits.MaxTokens > 0 {
+		usage = append(usage, limitUsage{
+			resource: "tokens",
+			current:  counter.TotalTokens(),
+			limit:    limits.MaxTokens,
+			fraction: float64(counter.TotalTokens()) / float64(limits.MaxTokens),
+			message:  fmt.Sprintf("Approaching token limit: %d/%d tokens used", counter.TotalTokens(), limits.MaxTokens),
+		})
+	}
+	if limits.MaxCost > 0 {
+		usage = append(usage, limitUsage{
+			resource: "cost",
+			current:  counter.CostUSD,
+			limit:    limits.MaxCost,
+			fraction: counter.CostUSD / limits.MaxCost,
+			message:  fmt.Sprintf("Approaching cost limit: $%.2f/$%.2f spent", counter.CostUSD, limits.MaxCost),
+		})
+	}
+	if limits.MaxDuration > 0 {
+		usage = append(usage, limitUsage{
+			resource: "time",
+			current:  counter.Duration().Seconds(),
+			limit:    limits.MaxDuration.Seconds(),
+			fraction: counter.Duration().Seconds() / limits.MaxDuration.Seconds(),
+			message:  fmt.Sprintf("Approaching time limit: %v/%v elapsed", counter.Duration().Round(time.Second), limits.MaxDuration),
+		})
+	}
+	if limits.MaxDiskBytes > 0 {
+		usage = append(usage, limitUsage{
+			resource: "disk",
+			current:  counter.DiskBytes,
+			limit:    limits.MaxDiskBytes,
+			fraction: float64(counter.DiskBytes) / float64(limits.MaxDiskBytes),
+			message:  fmt.Sprintf("Approaching disk quota: %d/%d bytes used", counter.DiskBytes, limits.MaxDiskBytes),
+		})
+	}
+	if limits.MaxMemoryBytes > 0 {
+		usage = append(usage, limitUsage{
+			resource: "memory",
+			current:  counter.MemoryBytes,
+			limit:    limits.MaxMemoryBytes,
+			fraction: float64(counter.MemoryBytes) / float64(limits.MaxMemoryBytes),
+			message:  fmt.Sprintf("Approaching memory limit: %s/%s resident", formatSize(counter.MemoryBytes), formatSize(limits.MaxMemoryBytes)),
+		})
+	}
+	if limits.MaxCPUTime > 0 {
+		usage = append(usage, limitUsage{
+			resource: "cpu",
+			current:  counter.CPUTime.Seconds(),
+			limit:    limits.MaxCPUTime.Seconds(),
+			fraction: counter.CPUTime.Seconds() / limits.MaxCPUTime.Seconds(),
+			message:  fmt.Sprintf("Approaching CPU time limit: %v/%v used", counter.CPUTime.Round(time.Second), limits.MaxCPUTime),
+		})
+	}
+	return usage
+}
+
+// thresholdsCrossed counts how many of the increasing thresholds a fraction of a limit has passed
+func thresholdsCrossed(thresholds []float64, fraction float64) int {
+	level := 0
+	for level < len(thresholds) && fraction > thresholds[level] {
+		level++
+	}
+	return level
+}
+
+// warningEvent creates a watchdog warning about one of an agent's limits
+// threshold is the fraction of the limit whose crossing triggered the warning
+func warningEvent(agentID, resource, message string, current, limit interface{}, threshold float64) *protocol.Event {
+	event := protocol.NewEvent(protocol.EventTypeWatchdog, "", 0)
+	payload := map[string]interface{}{
+		"target_agent_id": agentID,
+		"message":         message,
+		"resource":        resource,
+		"current":         current,
+		"limit":           limit,
+		"threshold":       threshold,
+	}
+	event, _ = event.WithPayload(payload)
+	return event
+}
+
+// WatchdogWarning returns the agent a watchdog warning is about and its message
+func WatchdogWarning(event *protocol.Event) (agentID, message string, ok bool) {
+	var payload struct {
+		TargetAgentID string `json:"target_agent_id"`
+		Message       string `json:"message"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil || payload.TargetAgentID == "" {
+		return "", "", false
+	}
+	return payload.TargetAgentID, payload.Message, true
+}
+
 // GetUsage returns the current resource usage for all agents
 func (w *Watchdog) GetUsage() map[string]*TokenCounter {
 	w.mutex.Lock()
@@ -209,6 +701,7 @@ func (w *Watchdog) GetUsage() map[string]*TokenCounter {
 	result := make(map[string]*TokenCounter, len(w.counters))
 	for id, counter := range w.counters {
 		copied := *counter // Make a copy of the counter
+		copied.Warnings = append([]string(nil), counter.Warnings...)
 		result[id] = &copied
 	}
 
@@ -220,19 +713,36 @@ func (w *Watchdog) StopMonitoring(agentID string) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
+	if counter, exists := w.counters[agentID]; exists {
+		w.spent += counter.CostUSD
+		w.spentTokens += counter.TotalTokens()
+	}
 	delete(w.counters, agentID)
 	delete(w.warnings, agentID)
+	delete(w.nudged, agentID)
+	delete(w.terminated, agentID)
 }
 
 // RunPeriodicCheck starts a goroutine that periodically checks resource limits
 // It sends warnings and termination signals via the provided channels
+// A checkInterval of 0 checks every DefaultCheckInterval
 func (w *Watchdog) RunPeriodicCheck(ctx context.Context, checkInterval time.Duration, warningCh chan<- *protocol.Event, terminateCh chan<- string) {
-	ticker := time.NewTicker(checkInterval)
+	if checkInterval <= 0 {
+		checkInterval = DefaultCheckInterval
+	}
+	w.mutex.Lock()
+	ticker := w.clock.NewTicker(checkInterval)
+	w.mutex.Unlock()
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
+			// Refresh disk, memory, and CPU usage before evaluating limits
+			// Process usage can't be measured on every platform; limits on it then go unenforced
+			w.UpdateDiskUsage()
+			_ = w.UpdateProcessUsage()
+
 			// Check for warnings first
 			warnings := w.GetWarningEvents()
 			for _, event := range warnings {
@@ -244,16 +754,16 @@ func (w *Watchdog) RunPeriodicCheck(ctx context.Context, checkInterval time.Dura
 				}
 			}
 
-			// Then check for terminations
-			agentsToStop := w.CheckLimits()
-			for _, agentID := range agentsToStop {
+			// Then check for terminations, recording why before the agent is signalled
+			// The terminated agent's usage is kept until it stops being monitored
+			for agentID, reason := range w.violations() {
+				w.setTerminated(agentID, reason)
 				select {
 				case terminateCh <- agentID:
 					// Successfully sent termination signal
-					// Stop monitoring this agent
-					w.StopMonitoring(agentID)
 				default:
-					// Channel full or closed, skip termination
+					// Channel full or closed, retry on the next check
+					w.setTerminated(agentID, "")
 				}
 			}
 		case <-ctx.Done():
@@ -262,50 +772,89 @@ func (w *Watchdog) RunPeriodicCheck(ctx context.Context, checkInterval time.Dura
 	}
 }
 
-// extractTokenCount attempts to extract token usage from an event
-func extractTokenCount(event *protocol.Event) int {
-	// For Claude events, check the Claude-specific payload structure
-	if event.AgentID == "claude" {
-		// Claude event format example (hypothetical):
-		// {"token_count": 123, ... }
-		return extractClaudeTokenCount(event)
+// setTerminated records why an agent was terminated, or forgets it if reason is empty
+func (w *Watchdog) setTerminated(agentID, reason string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if reason == "" {
+		delete(w.terminated, agentID)
+		return
 	}
+	w.terminated[agentID] = reason
+}
+
+// dirSize returns the total size in bytes of regular files under a directory
+// Files that disappear during the walk are ignored
+func dirSize(root string) int64 {
+	var size int64
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
 
-	// For Amp events, check the Amp-specific payload structure
-	if event.AgentID == "amp" {
-		// Amp event format example (hypothetical):
-		// {"usage": {"total_tokens": 456}, ... }
-		return extractAmpTokenCount(event)
+// extractTokenUsage attempts to extract the input and output tokens an event reports using
+// Payloads may report a "usage" object, in the Anthropic form ("input_tokens", "output_tokens") or the OpenAI form
+// ("prompt_tokens", "completion_tokens"), with "total_tokens" counted as output when it is all there is, or a bare
+// "token_count" of output tokens. Counts are incremental, like "cost_usd"
+func extractTokenUsage(event *protocol.Event) (input, output int) {
+	if len(event.Payload) == 0 {
+		return 0, 0
 	}
 
-	// For Codex events, check the Codex-specific payload structure
-	if event.AgentID == "codex" {
-		// Codex event format example (hypothetical):
-		// {"usage": {"completion_tokens": 789}, ... }
-		return extractCodexTokenCount(event)
+	var payload struct {
+		TokenCount int `json:"token_count"`
+		Usage      struct {
+			InputTokens      int `json:"input_tokens"`
+			OutputTokens     int `json:"output_tokens"`
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return 0, 0
 	}
 
-	// Default case: no token count available
-	return 0
+	usage := payload.Usage
+	input = usage.InputTokens + usage.PromptTokens
+	output = usage.OutputTokens + usage.CompletionTokens
+	if input == 0 && output == 0 {
+		output = usage.TotalTokens
+	}
+	output += payload.TokenCount
+	return max(input, 0), max(output, 0)
 }
 
-// extractClaudeTokenCount parses Claude-specific event format
-func extractClaudeTokenCount(event *protocol.Event) int {
-	// This implementation depends on the actual structure of Claude events
-	// For now, we just return a placeholder
-	return 0
-}
+// extractCost attempts to extract reported spend in US dollars from an event
+// Payloads may report either an incremental "cost_usd" or a running "total_cost_usd"
+func extractCost(event *protocol.Event) (cost float64, cumulative bool) {
+	if len(event.Payload) == 0 {
+		return 0, false
+	}
 
-// extractAmpTokenCount parses Amp-specific event format
-func extractAmpTokenCount(event *protocol.Event) int {
-	// This implementation depends on the actual structure of Amp events
-	// For now, we just return a placeholder
-	return 0
-}
+	var payload struct {
+		CostUSD      *float64 `json:"cost_usd"`
+		TotalCostUSD *float64 `json:"total_cost_usd"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return 0, false
+	}
 
-// extractCodexTokenCount parses Codex-specific event format
-func extractCodexTokenCount(event *protocol.Event) int {
-	// This implementation depends on the actual structure of Codex events
-	// For now, we just return a placeholder
-	return 0
-}
\ No newline at end of file
+	if payload.TotalCostUSD != nil {
+		return *payload.TotalCostUSD, true
+	}
+	if payload.CostUSD != nil {
+		return *payload.CostUSD, false
+	}
+	return 0, false
+}
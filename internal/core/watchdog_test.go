@@ -2,6 +2,9 @@ package core
 
 import (
 	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -46,9 +49,18 @@ func TestWatchdog_TrackEvent(t *testing.T) {
 	// Verify agent is automatically monitored
 	usage := watchdog.GetUsage()
 	require.Contains(t, usage, "test-agent", "Agent should be monitored")
+	assert.Equal(t, 50, usage["test-agent"].OutputTokens)
 
-	// Token count won't increase yet since we're using a mock event format
-	// This is expected since the real token extraction is agent-specific
+	// Reported usage adds up, whatever the agent is called
+	usageEvent, err := protocol.NewEvent(protocol.EventTypeComplete, "claude#2", 2).WithPayload(map[string]interface{}{
+		"usage": map[string]int{"input_tokens": 700, "output_tokens": 300},
+	})
+	require.NoError(t, err)
+	watchdog.TrackEvent(usageEvent)
+	watchdog.TrackEvent(usageEvent)
+	assert.Equal(t, 1400, watchdog.GetUsage()["claude#2"].InputTokens)
+	assert.Equal(t, 2000, watchdog.GetUsage()["claude#2"].TotalTokens())
+	assert.Equal(t, []string{"claude#2"}, watchdog.CheckLimits(), "Reported tokens count toward max_tokens")
 }
 
 func TestWatchdog_CheckLimits(t *testing.T) {
@@ -56,6 +68,8 @@ func TestWatchdog_CheckLimits(t *testing.T) {
 		MaxTokens:   100,
 		MaxDuration: 50 * time.Millisecond, // Short duration for testing
 	})
+	clock := NewManualClock(time.Now())
+	watchdog.SetClock(clock)
 
 	// Add an agent
 	watchdog.MonitorAgent("test-agent")
@@ -73,8 +87,8 @@ func TestWatchdog_CheckLimits(t *testing.T) {
 	// Add another agent that will exceed time limit
 	watchdog.MonitorAgent("time-agent")
 
-	// Wait for time limit to exceed
-	time.Sleep(100 * time.Millisecond)
+	// Let the time limit pass
+	clock.Advance(100 * time.Millisecond)
 
 	// Check limits again
 	agentsToStop = watchdog.CheckLimits()
@@ -88,6 +102,8 @@ func TestWatchdog_GetWarningEvents(t *testing.T) {
 		MaxTokens:   100,
 		MaxDuration: 50 * time.Millisecond, // Short duration for testing
 	})
+	clock := NewManualClock(time.Now())
+	watchdog.SetClock(clock)
 
 	// Add an agent with token count near warning threshold (80%)
 	watchdog.MonitorAgent("token-agent")
@@ -107,8 +123,8 @@ func TestWatchdog_GetWarningEvents(t *testing.T) {
 	// Add another agent that will exceed time warning threshold
 	watchdog.MonitorAgent("time-agent")
 
-	// Wait for time warning threshold to exceed
-	time.Sleep(40 * time.Millisecond) // 80% of 50ms
+	// Pass the time warning threshold
+	clock.Advance(45 * time.Millisecond) // Past 80% of 50ms
 
 	// Get warnings again
 	warnings = watchdog.GetWarningEvents()
@@ -119,16 +135,77 @@ func TestWatchdog_GetWarningEvents(t *testing.T) {
 	watchdog.StopMonitoring("time-agent")
 }
 
-func TestWatchdog_RunPeriodicCheck(t *testing.T) {
-	// Skip in short mode
-	if testing.Short() {
-		t.Skip("Skipping periodic check test in short mode")
+func TestWatchdog_EscalatingWarnings(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{MaxTokens: 100, MaxCost: 1.00, WarnAt: []float64{0.5, 0.8, 0.95}})
+	watchdog.MonitorAgent("agent")
+	use := func(tokens int, cost float64) {
+		watchdog.mutex.Lock()
+		watchdog.counters["agent"].OutputTokens = tokens
+		watchdog.counters["agent"].CostUSD = cost
+		watchdog.mutex.Unlock()
 	}
+	threshold := func(event *protocol.Event) (resource string, threshold float64) {
+		var payload struct {
+			Resource  string  `json:"resource"`
+			Threshold float64 `json:"threshold"`
+		}
+		require.NoError(t, json.Unmarshal(event.Payload, &payload))
+		return payload.Resource, payload.Threshold
+	}
+
+	use(40, 0.10)
+	assert.Empty(t, watchdog.GetWarningEvents(), "No warning below the first threshold")
+
+	// Each threshold is warned about once, for the limit closest to being reached
+	use(60, 0.10)
+	warnings := watchdog.GetWarningEvents()
+	require.Len(t, warnings, 1)
+	resource, at := threshold(warnings[0])
+	assert.Equal(t, "tokens", resource)
+	assert.Equal(t, 0.5, at)
+	use(70, 0.55)
+	assert.Empty(t, watchdog.GetWarningEvents(), "Another limit at the same threshold isn't warned about again")
+
+	use(70, 0.85)
+	warnings = watchdog.GetWarningEvents()
+	require.Len(t, warnings, 1)
+	resource, at = threshold(warnings[0])
+	assert.Equal(t, "cost", resource)
+	assert.Equal(t, 0.8, at)
 
+	// Skipping a threshold warns once, at the highest one crossed
+	use(99, 0.85)
+	warnings = watchdog.GetWarningEvents()
+	require.Len(t, warnings, 1)
+	resource, at = threshold(warnings[0])
+	assert.Equal(t, "tokens", resource)
+	assert.Equal(t, 0.95, at)
+	assert.Empty(t, watchdog.GetWarningEvents())
+
+	// The warnings sent are kept with the agent's usage
+	assert.Equal(t, []string{
+		"Approaching token limit: 60/100 tokens used",
+		"Approaching cost limit: $0.85/$1.00 spent",
+		"Approaching token limit: 99/100 tokens used",
+	}, watchdog.GetUsage()["agent"].Usage().Warnings)
+
+	// An empty list of thresholds disables warnings
+	quiet := NewWatchdog(ResourceLimits{MaxTokens: 100, MaxIdle: time.Minute, WarnAt: []float64{}})
+	quiet.MonitorAgent("agent")
+	quiet.mutex.Lock()
+	quiet.counters["agent"].OutputTokens = 99
+	quiet.counters["agent"].LastActivity = time.Now().Add(-59 * time.Second)
+	quiet.mutex.Unlock()
+	assert.Empty(t, quiet.GetWarningEvents())
+}
+
+func TestWatchdog_RunPeriodicCheck(t *testing.T) {
 	watchdog := NewWatchdog(ResourceLimits{
 		MaxTokens:   100,
 		MaxDuration: 200 * time.Millisecond, // Short duration for testing
 	})
+	clock := NewManualClock(time.Now())
+	watchdog.SetClock(clock)
 
 	// Add an agent with token count above limit
 	watchdog.MonitorAgent("token-agent")
@@ -137,48 +214,226 @@ func TestWatchdog_RunPeriodicCheck(t *testing.T) {
 	watchdog.mutex.Unlock()
 
 	// Set up channels
-	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	warningCh := make(chan *protocol.Event, 10)
 	terminateCh := make(chan string, 10)
 
 	// Start periodic check
 	go watchdog.RunPeriodicCheck(ctx, 50*time.Millisecond, warningCh, terminateCh)
+	clock.WaitForTickers(1)
 
-	// Wait for termination signal
-	select {
-	case agentID := <-terminateCh:
-		assert.Equal(t, "token-agent", agentID, "Correct agent should be terminated")
-	case <-time.After(300 * time.Millisecond):
-		t.Fatal("Timed out waiting for termination signal")
-	}
+	// The first check terminates the agent over its token limit
+	clock.Advance(50 * time.Millisecond)
+	assert.Equal(t, "token-agent", receive(t, terminateCh), "Correct agent should be terminated")
 
-	// Add a time-limit agent and wait for termination
+	// Add a time-limit agent, which is terminated by the first check after its time is up
 	watchdog.MonitorAgent("time-agent")
+	clock.Advance(150 * time.Millisecond)
+	assert.Empty(t, terminateCh)
+	clock.Advance(100 * time.Millisecond)
+	assert.Equal(t, "time-agent", receive(t, terminateCh), "Correct agent should be terminated")
+}
 
-	// Should get terminated due to time limit
+// receive returns the next agent sent on ch, failing the test if none is sent soon
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
 	select {
-	case agentID := <-terminateCh:
-		assert.Equal(t, "time-agent", agentID, "Correct agent should be terminated")
-	case <-time.After(300 * time.Millisecond):
+	case agentID := <-ch:
+		return agentID
+	case <-time.After(5 * time.Second):
 		t.Fatal("Timed out waiting for termination signal")
+		return ""
 	}
 }
 
-func TestExtractTokenCount(t *testing.T) {
-	// Create test events for different agent types
-	events := []*protocol.Event{
-		protocol.NewEvent(protocol.EventTypeAction, "claude", 1),
-		protocol.NewEvent(protocol.EventTypeAction, "amp", 1),
-		protocol.NewEvent(protocol.EventTypeAction, "codex", 1),
-		protocol.NewEvent(protocol.EventTypeAction, "unknown-agent", 1),
+func TestWatchdog_DiskQuota(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{
+		MaxTokens:    1000,
+		MaxDuration:  5 * time.Minute,
+		MaxDiskBytes: 1000,
+	})
+
+	// Give the agent a worktree with some content
+	worktreePath := t.TempDir()
+	watchdog.MonitorAgent("disk-agent")
+	watchdog.SetWorktree("disk-agent", worktreePath)
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "small.txt"), make([]byte, 500), 0644))
+
+	// Below the warning threshold nothing happens
+	watchdog.UpdateDiskUsage()
+	assert.Equal(t, int64(500), watchdog.GetUsage()["disk-agent"].DiskBytes, "Disk usage should be measured")
+	assert.Empty(t, watchdog.GetWarningEvents(), "No warning below threshold")
+	assert.Empty(t, watchdog.CheckLimits(), "No termination below quota")
+
+	// Crossing the warning threshold generates a warning
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "medium.txt"), make([]byte, 350), 0644))
+	watchdog.UpdateDiskUsage()
+	warnings := watchdog.GetWarningEvents()
+	require.Len(t, warnings, 1, "One warning should be generated")
+	assert.Contains(t, string(warnings[0].Payload), `"resource":"disk"`)
+	assert.Empty(t, watchdog.CheckLimits(), "No termination below quota")
+
+	// Exceeding the quota terminates the agent
+	require.NoError(t, os.MkdirAll(filepath.Join(worktreePath, "nested"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "nested", "large.txt"), make([]byte, 500), 0644))
+	watchdog.UpdateDiskUsage()
+	assert.Equal(t, []string{"disk-agent"}, watchdog.CheckLimits(), "Agent over quota should be terminated")
+}
+
+func TestWatchdog_ProcessLimits(t *testing.T) {
+	// The test process stands in for an agent
+	watchdog := NewWatchdog(ResourceLimits{MaxMemoryBytes: 1024, MaxCPUTime: time.Hour})
+	watchdog.MonitorAgent("process-agent")
+	watchdog.MonitorAgent("remote-agent")
+	watchdog.SetProcess("process-agent", os.Getpid())
+	if err := watchdog.UpdateProcessUsage(); err != nil {
+		t.Skipf("process usage can't be measured here: %v", err)
+	}
+
+	usage := watchdog.GetUsage()["process-agent"]
+	assert.Greater(t, usage.MemoryBytes, int64(1024), "Resident memory should be measured")
+	assert.Equal(t, usage.MemoryBytes, usage.PeakMemoryBytes)
+	assert.Zero(t, watchdog.GetUsage()["remote-agent"].MemoryBytes, "Agents without a process aren't measured")
+
+	violations := watchdog.violations()
+	require.Len(t, violations, 1, "Only the agent over its memory limit is terminated")
+	assert.Contains(t, violations["process-agent"], "memory limit exceeded")
+
+	// CPU time is checked the same way
+	watchdog.SetAgentLimits("process-agent", ResourceLimits{MaxCPUTime: time.Nanosecond})
+	assert.Contains(t, watchdog.violations()["process-agent"], "CPU time limit exceeded")
+}
+
+func TestWatchdog_AgentLimits(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{
+		MaxTokens:   100,
+		MaxDuration: 5 * time.Minute,
+	})
+
+	// One agent gets a larger token budget than the global limit
+	watchdog.SetAgentLimits("big-agent", ResourceLimits{
+		MaxTokens:   1000,
+		MaxDuration: 5 * time.Minute,
+	})
+	watchdog.MonitorAgent("big-agent")
+	watchdog.MonitorAgent("small-agent")
+
+	watchdog.mutex.Lock()
+	watchdog.counters["big-agent"].OutputTokens = 500
+	watchdog.counters["small-agent"].OutputTokens = 500
+	watchdog.mutex.Unlock()
+
+	// Only the agent using the global limit is over budget
+	assert.Equal(t, []string{"small-agent"}, watchdog.CheckLimits())
+
+	// Only the agent using the global limit is warned
+	warnings := watchdog.GetWarningEvents()
+	require.Len(t, warnings, 1)
+	assert.Contains(t, string(warnings[0].Payload), `"target_agent_id":"small-agent"`)
+}
+
+func TestWatchdog_IdleNudge(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{MaxTokens: 100, MaxIdle: time.Minute})
+	watchdog.MonitorAgent("quiet")
+	stall := func(d time.Duration) {
+		watchdog.mutex.Lock()
+		watchdog.counters["quiet"].LastActivity = time.Now().Add(-d)
+		watchdog.mutex.Unlock()
+	}
+
+	// An agent that already got a token warning is still nudged when it goes quiet
+	watchdog.mutex.Lock()
+	watchdog.counters["quiet"].OutputTokens = 90
+	watchdog.mutex.Unlock()
+	require.Len(t, watchdog.GetWarningEvents(), 1)
+
+	stall(30 * time.Second)
+	assert.Empty(t, watchdog.GetWarningEvents(), "No nudge early in a stall")
+
+	stall(50 * time.Second)
+	warnings := watchdog.GetWarningEvents()
+	require.Len(t, warnings, 1)
+	assert.Contains(t, string(warnings[0].Payload), `"resource":"idle"`)
+	assert.Contains(t, string(warnings[0].Payload), "stopping after 1m0s without activity")
+	assert.Empty(t, watchdog.GetWarningEvents(), "A stall is only nudged once")
+	assert.Empty(t, watchdog.CheckLimits(), "Nudged agents keep running until the idle limit")
+
+	// Activity ends the stall, so the next one is nudged again
+	watchdog.TrackEvent(protocol.NewEvent(protocol.EventTypeThinking, "quiet", 2))
+	stall(50 * time.Second)
+	assert.Len(t, watchdog.GetWarningEvents(), 1)
+
+	// Silence past the limit terminates the agent
+	stall(2 * time.Minute)
+	assert.Equal(t, []string{"quiet"}, watchdog.CheckLimits())
+}
+
+func TestWatchdog_CostAndIdle(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{
+		MaxCost: 1.00,
+		MaxIdle: time.Minute,
+	})
+
+	costEvent := func(agentID, key string, cost float64) *protocol.Event {
+		event, err := protocol.NewEvent(protocol.EventTypeAction, agentID, 1).WithPayload(map[string]interface{}{key: cost})
+		require.NoError(t, err)
+		return event
 	}
 
-	// Test that all extractors are called but return 0 for now
-	// (since we have placeholder implementations)
-	for _, event := range events {
-		tokenCount := extractTokenCount(event)
-		assert.Equal(t, 0, tokenCount, "Token count should be 0 for placeholder extractor")
+	// Incremental costs add up
+	watchdog.TrackEvent(costEvent("spender", "cost_usd", 0.60))
+	watchdog.TrackEvent(costEvent("spender", "cost_usd", 0.50))
+	assert.InDelta(t, 1.10, watchdog.GetUsage()["spender"].CostUSD, 0.0001)
+
+	// Cumulative costs replace the running total
+	watchdog.TrackEvent(costEvent("reporter", "total_cost_usd", 0.40))
+	watchdog.TrackEvent(costEvent("reporter", "total_cost_usd", 0.50))
+	assert.InDelta(t, 0.50, watchdog.GetUsage()["reporter"].CostUSD, 0.0001)
+
+	// An agent that has gone quiet for too long is over its limits
+	watchdog.MonitorAgent("idler")
+	watchdog.mutex.Lock()
+	watchdog.counters["idler"].LastActivity = time.Now().Add(-2 * time.Minute)
+	watchdog.mutex.Unlock()
+
+	assert.ElementsMatch(t, []string{"spender", "idler"}, watchdog.CheckLimits())
+
+	// Zero limits are not enforced
+	unlimited := NewWatchdog(ResourceLimits{})
+	unlimited.TrackEvent(costEvent("spender", "cost_usd", 100))
+	unlimited.mutex.Lock()
+	unlimited.counters["spender"].OutputTokens = 1000000
+	unlimited.counters["spender"].StartTime = time.Now().Add(-24 * time.Hour)
+	unlimited.counters["spender"].LastActivity = time.Now().Add(-24 * time.Hour)
+	unlimited.mutex.Unlock()
+	assert.Empty(t, unlimited.CheckLimits())
+	assert.Empty(t, unlimited.GetWarningEvents())
+}
+
+func TestExtractTokenUsage(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		input, output int
+	}{
+		{name: "no payload"},
+		{name: "no usage", payload: `{"content": "thinking"}`},
+		{name: "anthropic usage", payload: `{"usage": {"input_tokens": 120, "output_tokens": 30}}`, input: 120, output: 30},
+		{name: "openai usage", payload: `{"usage": {"prompt_tokens": 80, "completion_tokens": 20, "total_tokens": 100}}`, input: 80, output: 20},
+		{name: "total only", payload: `{"usage": {"total_tokens": 64}}`, output: 64},
+		{name: "token count", payload: `{"token_count": 50}`, output: 50},
+		{name: "usage of another shape", payload: `{"usage": "unknown"}`},
+		{name: "negative counts", payload: `{"usage": {"input_tokens": -5}}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			event := protocol.NewEvent(protocol.EventTypeComplete, "agent", 1)
+			event.Payload = json.RawMessage(tc.payload)
+			input, output := extractTokenUsage(event)
+			assert.Equal(t, tc.input, input)
+			assert.Equal(t, tc.output, output)
+		})
 	}
 }
 
@@ -204,4 +459,127 @@ func TestTokenCounter_Helpers(t *testing.T) {
 	lastActivity := counter.TimeSinceLastActivity()
 	assert.Greater(t, lastActivity, 20*time.Second, "LastActivity should be approximately 30 seconds")
 	assert.Less(t, lastActivity, 40*time.Second, "LastActivity should be approximately 30 seconds")
-}
\ No newline at end of file
+}
+func TestWatchdog_TerminationReason(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{MaxTokens: 100, MaxCost: 1.0})
+	clock := NewManualClock(time.Now())
+	watchdog.SetClock(clock)
+	watchdog.MonitorAgent("token-agent")
+	watchdog.MonitorAgent("cost-agent")
+	watchdog.mutex.Lock()
+	watchdog.counters["token-agent"].OutputTokens = 150
+	watchdog.counters["cost-agent"].CostUSD = 1.25
+	watchdog.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	terminateCh := make(chan string, 10)
+	go watchdog.RunPeriodicCheck(ctx, 20*time.Millisecond, make(chan *protocol.Event, 10), terminateCh)
+	clock.WaitForTickers(1)
+
+	clock.Advance(20 * time.Millisecond)
+	terminated := []string{receive(t, terminateCh), receive(t, terminateCh)}
+	assert.ElementsMatch(t, []string{"token-agent", "cost-agent"}, terminated)
+
+	// Each agent is signalled once, and keeps its usage and the reason until it stops being monitored
+	clock.Advance(60 * time.Millisecond)
+	assert.Empty(t, terminateCh)
+	assert.Empty(t, watchdog.CheckLimits())
+	assert.Equal(t, "token limit exceeded: 150/100 tokens used", watchdog.TerminationReason("token-agent"))
+	assert.Equal(t, "cost limit exceeded: $1.25/$1.00 spent", watchdog.TerminationReason("cost-agent"))
+	assert.Equal(t, 150, watchdog.GetUsage()["token-agent"].TotalTokens())
+
+	watchdog.StopMonitoring("token-agent")
+	assert.Empty(t, watchdog.TerminationReason("token-agent"))
+}
+
+func TestWatchdog_RunBudget(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{MaxCost: 5.0, MaxRunCost: 2.0})
+	watchdog.MonitorAgent("finished")
+	watchdog.MonitorAgent("spender")
+	watchdog.MonitorAgent("saver")
+	watchdog.mutex.Lock()
+	watchdog.counters["finished"].CostUSD = 0.75
+	watchdog.counters["spender"].CostUSD = 1.0
+	watchdog.mutex.Unlock()
+	assert.Empty(t, watchdog.CheckLimits(), "No termination below the budget")
+
+	// Agents that finished still count toward the budget
+	watchdog.StopMonitoring("finished")
+	watchdog.mutex.Lock()
+	watchdog.counters["spender"].CostUSD = 1.25
+	watchdog.mutex.Unlock()
+	assert.InDelta(t, 2.0, watchdog.RunCost(), 0.0001)
+
+	violations := watchdog.violations()
+	assert.Equal(t, map[string]string{
+		"spender": "run budget exceeded: $2.00/$2.00 spent by all agents",
+		"saver":   "run budget exceeded: $2.00/$2.00 spent by all agents",
+	}, violations)
+}
+
+func TestWatchdog_RunTokenBudget(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{MaxTokens: 1000, MaxRunTokens: 1000})
+	usageEvent := func(agentID string, usage map[string]int) *protocol.Event {
+		event, err := protocol.NewEvent(protocol.EventTypeComplete, agentID, 1).WithPayload(map[string]interface{}{"usage": usage})
+		require.NoError(t, err)
+		return event
+	}
+	watchdog.TrackEvent(usageEvent("finished", map[string]int{"output_tokens": 400}))
+	watchdog.TrackEvent(usageEvent("reader", map[string]int{"input_tokens": 300}))
+	watchdog.MonitorAgent("writer")
+	assert.Empty(t, watchdog.RunBudgetExceeded())
+	assert.Empty(t, watchdog.CheckLimits(), "No termination below the budget")
+
+	// Agents that finished still count toward the budget
+	watchdog.StopMonitoring("finished")
+	watchdog.TrackEvent(usageEvent("writer", map[string]int{"prompt_tokens": 200, "completion_tokens": 100}))
+	assert.Equal(t, 1000, watchdog.RunTokens())
+
+	reason := "run token budget exceeded: 1000/1000 tokens used by all agents"
+	assert.Equal(t, reason, watchdog.RunBudgetExceeded())
+	assert.Equal(t, map[string]string{"reader": reason, "writer": reason}, watchdog.violations())
+}
+
+func TestWatchdog_UsageMetrics(t *testing.T) {
+	watchdog := NewWatchdog(ResourceLimits{})
+	watchdog.MonitorAgent("agent")
+
+	// The longest silence between events is remembered after activity resumes
+	watchdog.mutex.Lock()
+	watchdog.counters["agent"].LastActivity = time.Now().Add(-time.Minute)
+	watchdog.counters["agent"].PeakMemoryBytes = 64 << 20
+	watchdog.counters["agent"].CPUTime = 3 * time.Second
+	watchdog.mutex.Unlock()
+	watchdog.TrackEvent(protocol.NewEvent(protocol.EventTypeThinking, "agent", 1))
+
+	usage := watchdog.GetUsage()["agent"].Usage()
+	assert.InDelta(t, time.Minute.Seconds(), usage.IdleTime.Seconds(), 1)
+	assert.Equal(t, int64(64<<20), usage.PeakMemoryBytes)
+	assert.Equal(t, 3*time.Second, usage.CPUTime)
+	assert.Empty(t, usage.Warnings)
+
+	// A longer current silence counts too
+	watchdog.mutex.Lock()
+	watchdog.counters["agent"].LastActivity = time.Now().Add(-2 * time.Minute)
+	watchdog.mutex.Unlock()
+	assert.InDelta(t, (2 * time.Minute).Seconds(), watchdog.GetUsage()["agent"].MaxIdle().Seconds(), 1)
+}
+
+func TestWatchdogWarning(t *testing.T) {
+	warning, err := protocol.NewEvent(protocol.EventTypeWatchdog, "", 0).WithPayload(map[string]interface{}{
+		"target_agent_id": "claude",
+		"message":         "Approaching token limit: 900/1000 tokens used",
+	})
+	require.NoError(t, err)
+
+	agentID, message, ok := WatchdogWarning(warning)
+	assert.True(t, ok)
+	assert.Equal(t, "claude", agentID)
+	assert.Equal(t, "Approaching token limit: 900/1000 tokens used", message)
+
+	action, err := protocol.NewEvent(protocol.EventTypeAction, "amp", 1).WithPayload(protocol.ActionPayload{ActionType: "edit"})
+	require.NoError(t, err)
+	_, _, ok = WatchdogWarning(action)
+	assert.False(t, ok)
+}
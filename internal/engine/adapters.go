@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/adapter/amp"
+	"github.com/brettsmith212/orchestrator/internal/adapter/claude"
+	"github.com/brettsmith212/orchestrator/internal/adapter/cli"
+	"github.com/brettsmith212/orchestrator/internal/adapter/codex"
+	"github.com/brettsmith212/orchestrator/internal/adapter/patch"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
+)
+
+// RegisterAdapters registers every available adapter type with the registry
+func RegisterAdapters(registry *adapter.Registry) {
+	// Register CLI adapters
+	registry.Register("cli", adapter.Factory(func(config adapter.Config) (adapter.Adapter, error) {
+		adpt, err := newCLIAdapter(config)
+		if err != nil {
+			return nil, err
+		}
+
+		// Agents that accept files alongside the prompt name the flag that passes each one
+		if flag, ok := config.AdapterConfig["context_flag"].(string); ok {
+			if cliAdapter, ok := adpt.(*cli.Adapter); ok {
+				cliAdapter.SetContextFlag(flag)
+			}
+		}
+
+		// Agents that read orchestrator events, such as watchdog warnings, get them on stdin
+		if enabled, ok := config.AdapterConfig["stdin_events"].(bool); ok {
+			if cliAdapter, ok := adpt.(*cli.Adapter); ok {
+				cliAdapter.SetStdinEvents(enabled)
+			}
+		}
+
+		// Chatty agents can be given a larger event buffer, or a policy for the events that overflow it
+		if cliAdapter, ok := adpt.(*cli.Adapter); ok {
+			if err := configureEventBuffer(cliAdapter, config.AdapterConfig); err != nil {
+				return nil, fmt.Errorf("agent %s: %w", config.ID, err)
+			}
+		}
+		return adpt, nil
+	}))
+
+	// Register specific CLI adapter types
+	amp.RegisterAdapter(registry)
+	codex.RegisterAdapter(registry)
+	claude.RegisterAdapter(registry)
+
+	// Register the adapter of agents that submit an existing patch file
+	patch.RegisterAdapter(registry)
+
+	// TODO: Register HTTP adapters when implemented
+}
+
+// configureEventBuffer applies an agent's event_buffer and event_overflow settings, keeping the defaults for those unset
+func configureEventBuffer(cliAdapter *cli.Adapter, config map[string]interface{}) error {
+	size, overflow := cli.DefaultEventBuffer, cli.DefaultOverflow
+	switch value := config["event_buffer"].(type) {
+	case nil:
+	case int:
+		size = value
+	case int64:
+		size = int(value)
+	case float64:
+		size = int(value)
+	default:
+		return fmt.Errorf("event_buffer must be a number, not '%v'", value)
+	}
+	if value, ok := config["event_overflow"]; ok {
+		if overflow, ok = value.(string); !ok {
+			return fmt.Errorf("event_overflow must be a string, not '%v'", value)
+		}
+	}
+	return cliAdapter.SetEventBuffer(size, overflow)
+}
+
+// newCLIAdapter creates the adapter for a cli agent, using a built-in adapter for known agents
+func newCLIAdapter(config adapter.Config) (adapter.Adapter, error) {
+	// Samples of an agent are created the same way as the agent itself
+	id := core.SampleOf(config.ID)
+	// Built-in agents' binaries are looked up on PATH, then where installers commonly put them on this platform
+	switch {
+	case id == "amp" || config.AdapterConfig["command"] == "amp":
+		config.AdapterConfig["binary_path"] = procutil.FindBinary("amp")
+		return amp.New(config.ID, config.AdapterConfig)
+
+	case id == "codex" || config.AdapterConfig["command"] == "codex":
+		config.AdapterConfig["binary_path"] = procutil.FindBinary("codex")
+		return codex.New(config.ID, config.AdapterConfig)
+
+	case id == "claude" || config.AdapterConfig["command"] == "claude":
+		config.AdapterConfig["binary_path"] = procutil.FindBinary("claude")
+		return claude.New(config.ID, config.AdapterConfig)
+
+	default:
+		// Generic CLI adapter for other command-line tools
+		command, _ := config.AdapterConfig["command"].(string)
+		if command == "" {
+			return nil, fmt.Errorf("missing command for generic CLI adapter")
+		}
+
+		// Extract arguments
+		var cliArgs []string
+		if args, ok := config.AdapterConfig["args"].([]interface{}); ok {
+			for _, arg := range args {
+				if strArg, ok := arg.(string); ok {
+					cliArgs = append(cliArgs, strArg)
+				}
+			}
+		}
+
+		cliAdapter := cli.New(config.ID, command, cliArgs)
+		if flag, ok := config.AdapterConfig["worktree_flag"].(string); ok {
+			cliAdapter.SetWorktreeFlag(flag)
+		}
+		return cliAdapter, nil
+	}
+}
+
+// createAdapters creates the adapters of the configured agents that keep selects, sandboxed as configured
+func createAdapters(registry *adapter.Registry, cfg *core.Config, limitsByAgent map[string]core.ResourceLimits, keep func(id string) bool) (map[string]adapter.Adapter, error) {
+	adapters, err := registry.CreateFromConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create adapters: %w", err)
+	}
+	for id := range adapters {
+		if !keep(id) {
+			delete(adapters, id)
+		}
+	}
+	sandboxAgents(cfg, adapters, limitsByAgent)
+	return adapters, nil
+}
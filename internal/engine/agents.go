@@ -0,0 +1,844 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/brettsmith212/orchestrator/internal/trace"
+)
+
+// LevelTrace is below debug and logs every agent event
+const LevelTrace = slog.LevelDebug - 4
+
+// runAgents starts all agents and collects their patches
+// Agent lifecycle messages are logged to logger with an agent field, and opts' progress is told what the agents are doing
+// limitsByAgent holds each agent's effective limits; limits are the global ones, which carry the run budget
+// Each agent's progress is saved to checkpoint, and its patch as soon as it finishes
+// In speculative mode each patch is evaluated with arbitrator as its agent finishes (never without an arbitrator)
+// Agents in followUps continue their earlier work in its worktree with the follow-up's prompt instead of their own
+func runAgents(ctx context.Context, logger *slog.Logger, opts Options, checkpoint *core.Checkpointer, artifacts *core.RunWriter, arbitrator *core.Arbitrator, adapters map[string]adapter.Adapter, limitsByAgent map[string]core.ResourceLimits, limits core.ResourceLimits, cfg *core.Config, worktreeManager *gitutil.WorktreeManager, baseRef string, prompts agentPrompts, contextFiles []string, followUps map[string]followUp) (map[string]*core.PatchDetails, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	patchDetails := make(map[string]*core.PatchDetails)
+	cancels := make(map[string]context.CancelFunc)                // Stops each running agent, guarded by mu
+	metadataByAgent := make(map[string]*gitutil.MetadataSnapshot) // Each running agent's git metadata, guarded by mu
+	snapshots := make(map[string]string)                          // Worktree states captured before terminations, guarded by mu
+	stoppedEarly := make(map[string]string)                       // Why agents were stopped once a patch was good enough, guarded by mu
+	var winner string                                             // The agent whose patch was good enough, guarded by mu
+	speculative := opts.Speculative || cfg.Speculative.Enabled
+	progress := opts.progress()
+	_, plain := progress.(NoProgress)
+
+	// Create watchdog
+	watchdog := core.NewWatchdog(limits)
+	watchdog.SetClock(opts.clock())
+
+	// Create channels for watchdog communications
+	// Each check can warn an agent about a limit and about its silence
+	warningCh := make(chan *protocol.Event, 2*len(adapters))
+	terminateCh := make(chan string, len(adapters))
+
+	// Start watchdog in background
+	watchdogCtx, watchdogCancel := context.WithCancel(ctx)
+	defer watchdogCancel()
+	go watchdog.RunPeriodicCheck(watchdogCtx, limits.CheckInterval, warningCh, terminateCh)
+
+	progress.Start(watchdog.GetUsage)
+	defer progress.Stop()
+
+	// captureWork records an agent's worktree before it is killed, so a write cut short doesn't spoil its work
+	// The agent is still running, so git runs only once its metadata is restored, and ignores what it plants since
+	captureWork := func(agentID string) {
+		mu.Lock()
+		metadata := metadataByAgent[agentID]
+		mu.Unlock()
+		if metadata == nil {
+			return
+		}
+		snapshot, err := metadata.WorkingTreeID()
+		if err != nil {
+			logger.Warn("failed to capture work before termination", "agent", agentID, "error", err)
+			return
+		}
+		mu.Lock()
+		snapshots[agentID] = snapshot
+		mu.Unlock()
+	}
+
+	// Handle watchdog warnings
+	go func() {
+		for {
+			select {
+			case warning, ok := <-warningCh:
+				if !ok {
+					return // Channel closed
+				}
+
+				// Log the warning
+				agentID, message, ok := core.WatchdogWarning(warning)
+				if !ok {
+					logger.Warn("watchdog warning", "payload", string(warning.Payload))
+					continue
+				}
+				logger.Warn("watchdog warning", "agent", agentID, "message", message)
+				if !plain {
+					progress.SetSnippet(agentID, "warning: "+message)
+				}
+
+				// Forward the warning so a cooperative agent can wrap up before it is stopped
+				if messenger, ok := adapters[agentID].(adapter.Messenger); ok {
+					if delivered, err := messenger.SendEvent(warning); err != nil {
+						logger.Warn("failed to deliver watchdog warning", "agent", agentID, "error", err)
+					} else if delivered {
+						logger.Debug("delivered watchdog warning", "agent", agentID)
+					}
+				}
+
+			case agentID, ok := <-terminateCh:
+				if !ok {
+					return // Channel closed
+				}
+
+				// Log the termination
+				reason := watchdog.TerminationReason(agentID)
+				logger.Warn("terminating agent", "agent", agentID, "reason", reason)
+				audit.Record(ctx, audit.AgentKilled, "agent", agentID, "reason", reason)
+
+				progress.SetStatus(agentID, AgentStopped)
+				progress.SetSnippet(agentID, reason)
+
+				// Capture the worktree before the agent is killed
+				captureWork(agentID)
+				mu.Lock()
+				cancel := cancels[agentID]
+				mu.Unlock()
+
+				// Cancel the agent's context so its events stop being collected, and shut it down
+				if cancel != nil {
+					cancel()
+				}
+				if adapter, exists := adapters[agentID]; exists {
+					_ = adapter.Shutdown() // Ignore error, we're terminating anyway
+				}
+
+			case <-watchdogCtx.Done():
+				return // Context cancelled
+			}
+		}
+	}()
+
+	// Create every agent's worktree at once before starting any, so agents start together rather than each
+	// waiting its turn at checkout; agents following up on their earlier work continue in its worktree
+	agentIDs := make([]string, 0, len(adapters))
+	for agentID := range adapters {
+		if _, ok := followUps[agentID]; !ok {
+			agentIDs = append(agentIDs, agentID)
+		}
+		progress.SetStatus(agentID, AgentStarting)
+	}
+	checkoutStarted := time.Now()
+	agentWorktrees, worktreeErrors := worktreeManager.CreateWorktrees(agentIDs, baseRef)
+	logger.Debug("created worktrees", "count", len(agentWorktrees), "failed", len(worktreeErrors), "duration", time.Since(checkoutStarted).Round(time.Millisecond))
+
+	for _, agentID := range agentOrder(cfg, adapters) {
+		wg.Add(1)
+		go func(id string, adpt adapter.Adapter) {
+			defer wg.Done()
+			agentLogger := logger.With("agent", id)
+			_, span := trace.Start(ctx, "agent")
+			span.SetAttribute("agent.id", id)
+			defer span.Finish()
+
+			// Don't launch agents once the run's shared budget is spent
+			if reason := watchdog.RunBudgetExceeded(); reason != "" {
+				agentLogger.Warn("not starting agent", "reason", reason)
+				span.Fail(reason)
+				progress.SetStatus(id, AgentStopped)
+				progress.SetSnippet(id, reason)
+				return
+			}
+
+			// The agent's worktree was created with the others, unless it follows up on its earlier work
+			agentPrompt := prompts.of(id)
+			followUp, following := followUps[id]
+			worktreePath, err := agentWorktrees[id], worktreeErrors[id]
+			if following {
+				agentPrompt, worktreePath = followUp.prompt, followUp.worktreePath
+			}
+			if err != nil {
+				agentLogger.Error("failed to create worktree", "error", err)
+				span.SetError(err)
+				progress.SetStatus(id, AgentFailed)
+				return
+			}
+			if !following {
+				audit.Record(ctx, audit.WorktreeCreated, "agent", id, "path", worktreePath, "base_ref", baseRef)
+				if err := agentHooks(ctx, agentLogger, cfg, core.HookPostWorktreeCreate, HookEnv(worktreeManager, artifacts, baseRef), id, worktreePath); err != nil {
+					agentLogger.Error("failed to set up worktree", "error", err)
+					span.SetError(err)
+					progress.SetStatus(id, AgentFailed)
+					return
+				}
+			}
+
+			// Record the git metadata the agent must not change, to undo any change once it finishes
+			metadata, err := gitutil.SnapshotMetadata(worktreePath)
+			if err != nil {
+				agentLogger.Error("failed to snapshot git metadata", "error", err)
+				span.SetError(err)
+				progress.SetStatus(id, AgentFailed)
+				return
+			}
+
+			// Warn about LFS content that agents and tests won't see
+			if missing, err := gitutil.MissingLFSObjects(worktreePath); err == nil && len(missing) > 0 {
+				agentLogger.Warn("worktree is missing LFS objects", "count", len(missing), "example", missing[0])
+			}
+
+			// Apply any per-type and per-agent overrides of the global limits
+			// The agent outlives the run's cancellation, which asks it to stop and gives it a grace period to do so
+			agentLimits := limitsByAgent[id]
+			detached := context.WithoutCancel(ctx)
+			agentCtx, agentCancel := context.WithCancel(detached)
+			if agentLimits.MaxDuration > 0 {
+				agentCtx, agentCancel = context.WithTimeout(detached, agentLimits.MaxDuration)
+			}
+			defer agentCancel()
+			mu.Lock()
+			cancels[id] = agentCancel
+			metadataByAgent[id] = metadata
+			mu.Unlock()
+
+			// Start monitoring this agent
+			watchdog.SetAgentLimits(id, agentLimits)
+			watchdog.MonitorAgent(id)
+			watchdog.SetWorktree(id, worktreePath)
+			base, _ := worktreeManager.BaseCommit(worktreePath)
+			checkpoint.AgentStarted(id, worktreePath, base)
+
+			// Start the agent
+			agentLogger.Debug("created worktree", "path", worktreePath)
+			agentLogger.Debug("resource limits", "max_tokens", agentLimits.MaxTokens, "max_cost_usd", agentLimits.MaxCost, "max_duration", agentLimits.MaxDuration, "max_idle", agentLimits.MaxIdle, "max_disk_bytes", agentLimits.MaxDiskBytes, "max_memory_bytes", agentLimits.MaxMemoryBytes, "max_cpu_time", agentLimits.MaxCPUTime)
+			agentLogger.Info("starting agent")
+
+			// Offer the context files to agents that can take them
+			if receiver, ok := adpt.(adapter.ContextReceiver); ok && len(contextFiles) > 0 {
+				received := receiver.SetContextFiles(contextFiles)
+				agentLogger.Debug("context files", "count", len(contextFiles), "received", received)
+			}
+
+			// Events are written to the agent's transcript as they arrive, starting with what it was asked to do
+			// A follow-up's events are added to the transcript of the agent's earlier work
+			openEventLog := artifacts.OpenEventLog
+			if following {
+				openEventLog = artifacts.ContinueEventLog
+			}
+			eventLog, err := openEventLog(id)
+			if err != nil {
+				LogArtifactError(agentLogger, err)
+				eventLog = core.NewEventSummary()
+			}
+			promptEvent, _ := protocol.NewEvent(protocol.EventTypePrompt, id, 0).WithPayload(protocol.PromptPayload{Prompt: agentPrompt, ContextFiles: contextFiles})
+			eventLog.TrackEvent(promptEvent)
+
+			// An interrupted run starts no more agents
+			var eventCh <-chan *protocol.Event
+			if err = ctx.Err(); err == nil {
+				eventCh, err = adpt.Start(agentCtx, worktreePath, agentPrompt)
+			}
+			if err != nil {
+				LogArtifactError(agentLogger, eventLog.Close())
+				failure, _ := core.ClassifyFailure(err, nil, "", "")
+				agentLogger.Error("failed to start agent", "error", err, "failure", failure)
+				span.SetError(err)
+				span.SetAttribute("agent.failure", string(failure))
+				progress.SetStatus(id, AgentFailed)
+				watchdog.StopMonitoring(id)
+
+				// Keep the agent in the report, so the failure counts toward its history
+				details := &core.PatchDetails{WorktreePath: worktreePath, Failure: failure, FailureMessage: err.Error()}
+				mu.Lock()
+				patchDetails[id] = details
+				mu.Unlock()
+				checkpoint.AgentFinished(id, details)
+				return
+			}
+			progress.SetStatus(id, AgentRunning)
+
+			// Measure the memory and CPU time of agents that run as local processes
+			started := []string{"agent", id, "worktree", worktreePath}
+			if reporter, ok := adpt.(adapter.ProcessReporter); ok {
+				watchdog.SetProcess(id, reporter.Pid())
+				started = append(started, "pid", strconv.Itoa(reporter.Pid()))
+			}
+			audit.Record(ctx, audit.AgentStarted, started...)
+
+			// Process events as they arrive, keeping only the notable ones in memory
+			received := eventSinkFunc(func(*protocol.Event) { checkpoint.EventReceived(id) })
+			sinks := []eventSink{watchdog, progress, received, eventLog}
+			if opts.OnEvent != nil {
+				sinks = append(sinks, eventSinkFunc(opts.OnEvent))
+			}
+			// Once the run is interrupted the agent is asked to stop, then killed if it outlasts its grace period
+			agentDone := make(chan struct{})
+			stopInterrupt := context.AfterFunc(ctx, func() {
+				if interruptAgent(agentLogger, adpt, id, limits.CancelGracePeriod(), agentDone) {
+					audit.Record(ctx, audit.AgentKilled, "agent", id, "reason", "run interrupted")
+					progress.SetStatus(id, AgentStopped)
+					progress.SetSnippet(id, "interrupted")
+					captureWork(id)
+					agentCancel()
+					_ = adpt.Shutdown() // Ignore error, we're stopping it anyway
+				}
+			})
+			streamEvents(agentCtx, agentLogger, eventCh, sinks...)
+			close(agentDone)
+			stopInterrupt()
+			LogArtifactError(agentLogger, eventLog.Close())
+			events := eventLog.Events()
+
+			// Report whether the agent's events outpaced the run, and what its buffer did about it
+			if reporter, ok := adpt.(adapter.EventStatsReporter); ok {
+				stats := reporter.EventStats()
+				span.SetAttribute("agent.event_buffer_peak", stats.Peak)
+				span.SetAttribute("agent.events_dropped", stats.Dropped)
+				span.SetAttribute("agent.events_coalesced", stats.Coalesced)
+				span.SetAttribute("agent.event_blocked_ms", stats.Blocked.Milliseconds())
+				if stats.Dropped > 0 || stats.Coalesced > 0 || stats.Blocked > 0 {
+					agentLogger.Warn("agent's events outpaced the run", "buffer", stats.Buffer, "peak", stats.Peak, "dropped", stats.Dropped, "coalesced", stats.Coalesced, "blocked", stats.Blocked.Round(time.Millisecond))
+				}
+			}
+
+			// Agents stopped by the watchdog or their timeout keep the reason with their patch
+			termination := watchdog.TerminationReason(id)
+			if termination == "" && agentCtx.Err() == context.DeadlineExceeded {
+				termination = fmt.Sprintf("time limit exceeded: ran longer than %v", agentLimits.MaxDuration)
+				agentLogger.Warn("agent timed out", "timeout", agentLimits.MaxDuration)
+				audit.Record(ctx, audit.AgentKilled, "agent", id, "reason", termination)
+				progress.SetStatus(id, AgentStopped)
+				progress.SetSnippet(id, "timed out")
+			}
+
+			// Cleanup
+			if err := adpt.Shutdown(); err != nil {
+				agentLogger.Error("failed to shut down agent", "error", err)
+			}
+
+			// Changes to git metadata are undone before git next runs in the worktree, which would run planted hooks
+			protected, err := protectMetadata(ctx, cfg, worktreeManager, metadata, id, worktreePath, events)
+			if err != nil {
+				agentLogger.Error("failed to restore git metadata", "error", err)
+				span.SetError(err)
+				progress.SetStatus(id, AgentFailed)
+				return
+			}
+			if len(protected) > 0 {
+				agentLogger.Warn("agent touched protected files", "changes", protected)
+			}
+
+			// A terminated agent's work is evaluated as it was when the watchdog stopped it
+			mu.Lock()
+			snapshot := snapshots[id]
+			mu.Unlock()
+			if snapshot != "" {
+				if current, err := gitutil.WorkingTreeID(worktreePath); err == nil && current != snapshot {
+					if err := gitutil.RestoreWorkingTree(worktreePath, snapshot); err != nil {
+						agentLogger.Warn("failed to restore work captured before termination", "error", err)
+					} else {
+						agentLogger.Debug("restored work captured before termination")
+					}
+				}
+			}
+
+			// Get the diff
+			diff, err := worktreeManager.GetDiff(worktreePath)
+			if err != nil {
+				agentLogger.Error("failed to get diff", "error", err)
+				span.SetError(err)
+				progress.SetStatus(id, AgentFailed)
+				return
+			}
+
+			// Changes to files the path policy doesn't permit are reverted before anything sees the patch
+			violations, err := enforcePaths(ctx, cfg.Paths, worktreeManager, id, worktreePath, diff)
+			if err != nil {
+				agentLogger.Error("failed to enforce path policy", "error", err)
+				span.SetError(err)
+				progress.SetStatus(id, AgentFailed)
+				return
+			}
+			if len(violations) > 0 {
+				agentLogger.Warn("patch changed files outside the path policy", "files", violations, "action", cfg.Paths.Action())
+				if diff, err = worktreeManager.GetDiff(worktreePath); err != nil {
+					agentLogger.Error("failed to get diff", "error", err)
+					span.SetError(err)
+					progress.SetStatus(id, AgentFailed)
+					return
+				}
+			}
+
+			// Store patch details
+			// An agent stopped because another's patch was good enough didn't fail, and its patch isn't evaluated
+			usage := watchdog.GetUsage()[id]
+			mu.Lock()
+			if reason := stoppedEarly[id]; reason != "" && termination == "" {
+				termination = reason
+			}
+			var failure core.FailureKind
+			var failureMessage string
+			if !core.IsStoppedEarly(termination) {
+				failure, failureMessage = core.ClassifyFailure(nil, events, termination, diff)
+			}
+			if len(violations) > 0 && cfg.Paths.Action() == core.PathsDisqualify {
+				failure, failureMessage = core.FailureDeniedPaths, core.ViolationMessage(violations)
+			}
+			patchDetails[id] = &core.PatchDetails{
+				WorktreePath:     worktreePath,
+				Diff:             diff,
+				Events:           events,
+				EventCount:       eventLog.Count(),
+				Termination:      termination,
+				Failure:          failure,
+				FailureMessage:   failureMessage,
+				PathViolations:   violations,
+				ProtectedChanges: protected,
+			}
+			if usage != nil {
+				patchDetails[id].Usage = usage.Usage()
+			}
+			details := patchDetails[id]
+			if core.IsStoppedEarly(termination) {
+				details.Result = arbitrator.SkipEvaluation(id, details, "stopped early")
+			}
+			decided := winner != ""
+			mu.Unlock()
+			checkpoint.AgentFinished(id, details)
+
+			// Stop monitoring this agent, keeping its final usage on screen
+			progress.SetUsage(id, usage)
+			if termination == "" {
+				progress.SetStatus(id, AgentDone)
+			}
+			watchdog.StopMonitoring(id)
+
+			// The patch is evaluated now, while the other agents still run, unless a review may yet revise it
+			// In speculative mode one good enough stops the agents still running
+			if arbitrator != nil && !opts.Deterministic && !cfg.AwaitsReview(id) && details.Result == nil && !decided && ctx.Err() == nil {
+				result, err := arbitrator.EvaluateFinished(ctx, id, details)
+				if err != nil {
+					agentLogger.Warn("failed to evaluate patch", "error", err)
+				} else {
+					var good bool
+					var why string
+					if speculative {
+						good, why = cfg.Speculative.GoodEnough(result)
+					}
+					var stopping []string
+					mu.Lock()
+					details.Result = result
+					if good && winner == "" {
+						winner = id
+						for other, cancel := range cancels {
+							if _, finished := patchDetails[other]; !finished {
+								stoppedEarly[other] = core.StoppedEarly(id)
+								stopping = append(stopping, other)
+								cancel()
+							}
+						}
+					}
+					mu.Unlock()
+
+					if speculative && !good {
+						agentLogger.Debug("patch isn't good enough to stop the other agents", "score", result.Score, "reason", why)
+					} else if len(stopping) > 0 {
+						sort.Strings(stopping)
+						agentLogger.Info("patch is good enough, stopping the other agents", "score", result.Score, "stopping", stopping)
+						for _, other := range stopping {
+							audit.Record(ctx, audit.AgentKilled, "agent", other, "reason", core.StoppedEarly(id))
+							progress.SetStatus(other, AgentStopped)
+							progress.SetSnippet(other, "stopped early")
+							_ = adapters[other].Shutdown() // Ignore error, we're stopping it anyway
+						}
+					}
+				}
+			}
+
+			// Agents the watchdog or their timeout stopped show as failed in the trace
+			span.SetAttribute("agent.events", eventLog.Count())
+			span.SetAttribute("agent.diff_bytes", len(diff))
+			if usage != nil {
+				span.SetAttribute("agent.tokens", usage.TotalTokens())
+				span.SetAttribute("agent.cost_usd", usage.CostUSD)
+			}
+			if failure != "" {
+				span.SetAttribute("agent.failure", string(failure))
+			}
+			span.Fail(termination)
+
+			finished := []interface{}{"events", eventLog.Count(), "diff_bytes", len(diff)}
+			if usage != nil {
+				finished = append(finished, "tokens", usage.TotalTokens(), "duration", usage.Duration().Round(time.Second))
+			}
+			if termination != "" {
+				finished = append(finished, "terminated", termination)
+			}
+			if failure != "" {
+				finished = append(finished, "failure", failure)
+			}
+			agentLogger.Info("agent finished", finished...)
+		}(agentID, adapters[agentID])
+
+		// Deterministic runs finish each agent before starting the next
+		if opts.Deterministic {
+			wg.Wait()
+		}
+	}
+
+	// Wait for all agents to complete
+	wg.Wait()
+	return patchDetails, nil
+}
+
+// interruptAgent asks an agent to stop once the run is interrupted, with a cancel event, and waits up to grace for it
+// to finish, which done reports. It reports whether the agent is still running and must be killed
+// Agents that don't receive events can't be asked, so they are killed at once
+func interruptAgent(logger *slog.Logger, adpt adapter.Adapter, id string, grace time.Duration, done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return false
+	default:
+	}
+	messenger, ok := adpt.(adapter.Messenger)
+	if !ok {
+		return true
+	}
+	event, err := protocol.NewEvent(protocol.EventTypeCancel, "", 0).WithPayload(protocol.CancelPayload{TargetAgentID: id, Reason: "run interrupted", GraceSeconds: grace.Seconds()})
+	if err != nil {
+		return true
+	}
+	delivered, err := messenger.SendEvent(event)
+	if err != nil {
+		logger.Warn("failed to deliver cancel event", "error", err)
+	}
+	if !delivered || err != nil {
+		return true
+	}
+
+	logger.Info("asked agent to stop", "grace", grace)
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return false
+	case <-timer.C:
+		logger.Warn("agent didn't stop within its grace period, killing it", "grace", grace)
+		return true
+	}
+}
+
+// agentOrder returns the IDs of the adapters in the order their agents are configured
+func agentOrder(cfg *core.Config, adapters map[string]adapter.Adapter) []string {
+	ids := make([]string, 0, len(adapters))
+	for _, agentCfg := range cfg.Agents {
+		if _, ok := adapters[agentCfg.ID]; ok {
+			ids = append(ids, agentCfg.ID)
+		}
+	}
+	return ids
+}
+
+// refinePatches runs follow-up rounds while the best patch leaves tests failing, up to opts' or refine.max_rounds
+// Each round starts the agents whose patches fail again in their worktrees, prompted with the failures and their
+// diff, then ranks their revised patches with the rest. Agents keep their own limits each round, while the run's
+// budget is shared by every round. It returns the final ranking
+func refinePatches(ctx context.Context, logger *slog.Logger, opts Options, checkpoint *core.Checkpointer, artifacts *core.RunWriter, arbitrator *core.Arbitrator, registry *adapter.Registry, cfg *core.Config, limitsByAgent map[string]core.ResourceLimits, limits core.ResourceLimits, worktreeManager *gitutil.WorktreeManager, baseRef string, prompts agentPrompts, contextFiles []string, patchDetails map[string]*core.PatchDetails, ranked []*core.PatchResult) ([]*core.PatchResult, error) {
+	rounds := cfg.Refine.MaxRounds
+	if opts.RefineRounds > 0 {
+		rounds = opts.RefineRounds
+	}
+
+	for round := 1; round <= rounds && core.NeedsRefinement(ranked[0]); round++ {
+		// Patches keep their results, so only the revised ones are tested again
+		followUps := make(map[string]followUp)
+		for _, result := range ranked {
+			patchDetails[result.AgentID].Result = result
+			if core.Refinable(result) && !cfg.IsPatchAgent(result.AgentID) {
+				followUps[result.AgentID] = followUp{worktreePath: result.WorktreePath, prompt: cfg.Refine.RefinementPrompt(prompts.of(result.AgentID), result)}
+			}
+		}
+		if len(followUps) == 0 {
+			logger.Info("no patches to refine")
+			break
+		}
+
+		// Each round may only spend what the earlier ones left of the run's budget
+		roundLimits, ok := remainingLimits(limits, patchDetails)
+		if !ok {
+			logger.Warn("not refining patches", "reason", "run budget spent")
+			break
+		}
+		adapters, err := createAdapters(registry, cfg, limitsByAgent, func(id string) bool { _, ok := followUps[id]; return ok })
+		if err != nil {
+			return nil, err
+		}
+
+		roundCtx, span := trace.Start(ctx, "refinement")
+		span.SetAttribute("round", round)
+		span.SetAttribute("agents", len(followUps))
+		logger.Info("refining patches", "round", round, "agents", len(followUps), "best_agent", ranked[0].AgentID, "tests_failed", ranked[0].TestResults.FailedTests)
+		checkpoint.SetStage(core.StageAgents)
+		revised, err := runAgents(roundCtx, logger, opts, checkpoint, artifacts, arbitrator, adapters, limitsByAgent, roundLimits, cfg, worktreeManager, baseRef, prompts, contextFiles, followUps)
+		if err != nil {
+			span.SetError(err)
+			span.Finish()
+			return nil, fmt.Errorf("error refining patches: %w", err)
+		}
+
+		// A revised patch replaces the agent's earlier one, and its usage adds to the earlier rounds'
+		for id, details := range revised {
+			details.Follow(patchDetails[id])
+			details.Refinements++
+			if details.Result != nil {
+				details.Result.Usage, details.Result.Refinements = details.Usage, details.Refinements
+			}
+			patchDetails[id] = details
+		}
+
+		checkpoint.SetStage(core.StageEvaluating)
+		ranked, err = arbitrator.RankPatches(roundCtx, patchDetails)
+		span.SetError(err)
+		span.Finish()
+		if err != nil {
+			return nil, fmt.Errorf("failed to select best patch: %w", err)
+		}
+		logger.Info("refined patches", "round", round, "best_agent", ranked[0].AgentID, "score", ranked[0].Score)
+	}
+	return ranked, nil
+}
+
+// reviewPatches runs the active pipelines: each fixer's patch is reviewed by its reviewer, then revised with the
+// review, for the pipeline's rounds or until the reviewer approves it
+// A reviewer works in a worktree of its own with the patch applied, and is given the patch and the fixer's transcript;
+// what it writes is its review. Revised patches replace the fixers' earlier ones in patchDetails, and the reviews'
+// usage adds to theirs, so each pipeline enters arbitration as its fixer's patch alone
+func reviewPatches(ctx context.Context, logger *slog.Logger, opts Options, checkpoint *core.Checkpointer, artifacts *core.RunWriter, registry *adapter.Registry, cfg *core.Config, limitsByAgent map[string]core.ResourceLimits, limits core.ResourceLimits, worktreeManager *gitutil.WorktreeManager, baseRef string, prompts agentPrompts, contextFiles []string, patchDetails map[string]*core.PatchDetails) error {
+	pipelines := cfg.ActivePipelines()
+	settled := make(map[string]bool) // Fixers whose patches need no more review: approved, or not reviewable
+
+	for round := 1; ; round++ {
+		// Patches their fixer finished with changes are reviewed, until their review settles them
+		reviews := make(map[string]followUp)
+		fixers := make(map[string]string) // Each reviewer's fixer
+		for _, pipeline := range pipelines {
+			details := patchDetails[pipeline.Fixer]
+			if round > pipeline.ReviewRounds() || settled[pipeline.Fixer] || details == nil ||
+				details.Failure != "" || details.Termination != "" || strings.TrimSpace(details.Diff) == "" {
+				continue
+			}
+			worktreePath, err := worktreeManager.CreateWorktree(pipeline.Reviewer, baseRef)
+			if err == nil {
+				err = agentHooks(ctx, logger.With("agent", pipeline.Reviewer), cfg, core.HookPostWorktreeCreate, HookEnv(worktreeManager, artifacts, baseRef), pipeline.Reviewer, worktreePath)
+			}
+			if err == nil {
+				err = gitutil.ApplyPatch(worktreePath, details.Diff)
+			}
+			if err != nil {
+				logger.Warn("failed to set up review", "agent", pipeline.Fixer, "reviewer", pipeline.Reviewer, "error", err)
+				continue
+			}
+			events, err := core.ReadTranscript(core.TranscriptPath(artifacts.Dir(), pipeline.Fixer), cfg.Cipher())
+			if err != nil {
+				events = details.Events
+			}
+			reviews[pipeline.Reviewer] = followUp{worktreePath: worktreePath, prompt: core.ReviewPrompt(prompts.of(pipeline.Fixer), pipeline.Fixer, details.Diff, events)}
+			fixers[pipeline.Reviewer] = pipeline.Fixer
+			details.Reviewer = pipeline.Reviewer
+		}
+		if len(reviews) == 0 {
+			return nil
+		}
+
+		roundCtx, span := trace.Start(ctx, "review")
+		span.SetAttribute("round", round)
+		span.SetAttribute("pipelines", len(reviews))
+		revised, err := reviewRound(roundCtx, logger, opts, checkpoint, artifacts, registry, cfg, limitsByAgent, limits, worktreeManager, baseRef, prompts, contextFiles, patchDetails, reviews, fixers, settled)
+		span.SetError(err)
+		span.Finish()
+		if err != nil || !revised {
+			return err
+		}
+	}
+}
+
+// reviewRound runs one round of reviews and the revisions they call for, reporting whether any patch was revised
+func reviewRound(ctx context.Context, logger *slog.Logger, opts Options, checkpoint *core.Checkpointer, artifacts *core.RunWriter, registry *adapter.Registry, cfg *core.Config, limitsByAgent map[string]core.ResourceLimits, limits core.ResourceLimits, worktreeManager *gitutil.WorktreeManager, baseRef string, prompts agentPrompts, contextFiles []string, patchDetails map[string]*core.PatchDetails, reviews map[string]followUp, fixers map[string]string, settled map[string]bool) (bool, error) {
+	// Reviewers never become candidates: their patches are the fixers', and aren't saved or evaluated
+	roundLimits, ok := remainingLimits(limits, patchDetails)
+	if !ok {
+		logger.Warn("not reviewing patches", "reason", "run budget spent")
+		return false, nil
+	}
+	adapters, err := createAdapters(registry, cfg, limitsByAgent, func(id string) bool { _, ok := reviews[id]; return ok })
+	if err != nil {
+		return false, err
+	}
+	logger.Info("reviewing patches", "count", len(reviews))
+	reviewed, err := runAgents(ctx, logger, opts, nil, artifacts, nil, adapters, limitsByAgent, roundLimits, cfg, worktreeManager, baseRef, prompts, contextFiles, reviews)
+	if err != nil {
+		return false, fmt.Errorf("error reviewing patches: %w", err)
+	}
+	if !opts.KeepWorktrees {
+		for _, review := range reviews {
+			_ = worktreeManager.RemoveWorktree(review.worktreePath)
+		}
+	}
+
+	// Each review that asks for changes goes to its fixer, with its patch
+	revisions := make(map[string]followUp)
+	for reviewerID, review := range reviewed {
+		fixerID := fixers[reviewerID]
+		details := patchDetails[fixerID]
+		details.Usage = details.Usage.Add(review.Usage)
+		events, err := core.ReadTranscript(core.TranscriptPath(artifacts.Dir(), reviewerID), cfg.Cipher())
+		if err != nil {
+			events = review.Events
+		}
+		feedback, approves := core.ReviewFeedback(events)
+		switch {
+		case review.Failure != "" || review.Termination != "":
+			logger.Warn("review failed", "agent", fixerID, "reviewer", reviewerID, "failure", review.Failure, "terminated", review.Termination)
+			settled[fixerID] = true
+		case approves:
+			logger.Info("patch approved", "agent", fixerID, "reviewer", reviewerID)
+			settled[fixerID] = true
+		case feedback == "":
+			logger.Warn("reviewer wrote no review", "agent", fixerID, "reviewer", reviewerID)
+			settled[fixerID] = true
+		default:
+			revisions[fixerID] = followUp{worktreePath: details.WorktreePath, prompt: core.RevisionPrompt(prompts.of(fixerID), feedback, details.Diff)}
+		}
+	}
+	if len(revisions) == 0 {
+		return false, nil
+	}
+
+	// A revised patch replaces the fixer's earlier one
+	roundLimits, ok = remainingLimits(limits, patchDetails)
+	if !ok {
+		logger.Warn("not revising patches", "reason", "run budget spent")
+		return false, nil
+	}
+	adapters, err = createAdapters(registry, cfg, limitsByAgent, func(id string) bool { _, ok := revisions[id]; return ok })
+	if err != nil {
+		return false, err
+	}
+	logger.Info("revising patches after review", "count", len(revisions))
+	revised, err := runAgents(ctx, logger, opts, checkpoint, artifacts, nil, adapters, limitsByAgent, roundLimits, cfg, worktreeManager, baseRef, prompts, contextFiles, revisions)
+	if err != nil {
+		return false, fmt.Errorf("error revising patches: %w", err)
+	}
+	for id, details := range revised {
+		details.Follow(patchDetails[id])
+		details.Revisions++
+		patchDetails[id] = details
+	}
+	return len(revised) > 0, nil
+}
+
+// remainingLimits returns the global limits with the run's budget reduced by what the agents have spent so far,
+// for agents started again on their earlier work; it reports false once the budget is spent
+func remainingLimits(limits core.ResourceLimits, patchDetails map[string]*core.PatchDetails) (core.ResourceLimits, bool) {
+	var spent core.AgentUsage
+	for _, details := range patchDetails {
+		spent = spent.Add(details.Usage)
+	}
+	remaining := limits
+	if limits.MaxRunCost > 0 {
+		remaining.MaxRunCost -= spent.CostUSD
+		if remaining.MaxRunCost <= 0 {
+			return remaining, false
+		}
+	}
+	if limits.MaxRunTokens > 0 {
+		remaining.MaxRunTokens -= spent.Tokens
+		if remaining.MaxRunTokens <= 0 {
+			return remaining, false
+		}
+	}
+	return remaining, true
+}
+
+// agentPrompts holds the prompt agents are given, and the prompts of the prompt variants given to some agents instead
+type agentPrompts struct {
+	prompt   string
+	variants map[string]string
+}
+
+// of returns the prompt an agent is given
+func (p agentPrompts) of(agentID string) string {
+	if prompt, ok := p.variants[core.PromptVariantOf(agentID)]; ok {
+		return prompt
+	}
+	return p.prompt
+}
+
+// followUp continues an agent's earlier work: the agent is started again in its worktree with a new prompt
+type followUp struct {
+	worktreePath string
+	prompt       string
+}
+
+// eventSink takes an agent's events as they arrive
+type eventSink interface {
+	TrackEvent(event *protocol.Event)
+}
+
+// eventSinkFunc adapts a function to an eventSink
+type eventSinkFunc func(event *protocol.Event)
+
+// TrackEvent calls the function with the event
+func (f eventSinkFunc) TrackEvent(event *protocol.Event) {
+	f(event)
+}
+
+// streamEvents passes each event from the channel to the sinks as it arrives, until the channel is closed or the
+// context is cancelled, and returns how many events there were
+// Nothing is kept here, so a long-running agent's events take no more memory than its sinks keep
+// Each event is logged at trace level (-vv) to the agent's logger
+func streamEvents(ctx context.Context, logger *slog.Logger, eventCh <-chan *protocol.Event, sinks ...eventSink) int {
+	count := 0
+
+	for {
+		select {
+		case event, ok := <-eventCh:
+			if !ok {
+				// Channel closed, all events received
+				return count
+			}
+
+			// Only process valid events
+			if event != nil {
+				count++
+				for _, sink := range sinks {
+					sink.TrackEvent(event)
+				}
+				logger.Log(ctx, LevelTrace, "received event", "type", event.Type, "detail", event.Snippet())
+			}
+
+		case <-ctx.Done():
+			// Context cancelled, stop with what we have
+			return count
+		}
+	}
+}
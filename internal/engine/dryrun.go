@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// worktreePlaceholder stands in for an agent's worktree path, which is only chosen at run time
+const worktreePlaceholder = "<worktree>"
+
+// dryRun prints what a run would execute without starting agents or running tests
+// It still resolves the configuration, probes agent binaries, and checks that a worktree can be created
+func dryRun(cfg *core.Config, registry *adapter.Registry, runID string, task core.Task, opts Options) error {
+	out := opts.output()
+	fmt.Fprintln(out, "Dry run: no agents or tests will be started")
+	fmt.Fprintln(out)
+
+	abs, err := filepath.Abs(opts.repo())
+	if err != nil {
+		return fmt.Errorf("failed to resolve repository path: %w", err)
+	}
+
+	fmt.Fprintf(out, "Configuration: %s", opts.ConfigPath)
+	if cfg.ActiveProfile != "" {
+		fmt.Fprintf(out, " (profile %s)", cfg.ActiveProfile)
+	}
+	fmt.Fprintln(out)
+
+	// Remote repositories are not cloned, so there is nothing to create a worktree from yet
+	if opts.RepoURL != "" {
+		abs = gitutil.CachedClonePath(cfg.WorkingDir, opts.RepoURL)
+		fmt.Fprintf(out, "Repository:    %s (would clone %s, depth %d, filter %q)\n", abs, opts.RepoURL, opts.Clone.Depth, opts.Clone.Filter)
+	} else {
+		fmt.Fprintf(out, "Repository:    %s\n", abs)
+		if err := probeWorktree(out, cfg, abs, runID, task.BaseRef); err != nil {
+			return err
+		}
+	}
+
+	if task.BaseRef != "" {
+		fmt.Fprintf(out, "Base:          %s\n", task.BaseRef)
+	} else if opts.IncludeDirty {
+		fmt.Fprintln(out, "Base:          uncommitted changes (snapshotted when the run starts)")
+	} else if head, err := gitutil.RunGitCommand(abs, "rev-parse", "--short", "HEAD").Output(); err == nil {
+		fmt.Fprintf(out, "Base:          HEAD (%s)\n", strings.TrimSpace(string(head)))
+	}
+	if cfg.Scope != "" {
+		fmt.Fprintf(out, "Scope:         %s (changes elsewhere are reverted, and tests run from it)\n", cfg.Scope)
+	}
+
+	text, err := loadPromptTemplate(cfg, opts.PromptTemplate)
+	if err != nil {
+		return err
+	}
+	if text != "" {
+		fmt.Fprintln(out, "Prompt:        wrapped in the prompt template once the baseline tests have run")
+	}
+	if cfg.TDD.Enabled() {
+		fmt.Fprintf(out, "Tests:         written first by %s, which the other agents start from and make pass\n", cfg.TDD.TestAuthor)
+	}
+	if len(cfg.PromptVariants) > 0 {
+		names := make([]string, 0, len(cfg.PromptVariants))
+		for _, variant := range cfg.PromptVariants {
+			names = append(names, variant.Name)
+		}
+		fmt.Fprintf(out, "Variants:      %s (every agent runs once with each phrasing of the prompt)\n", strings.Join(names, ", "))
+	}
+	if cfg.Context.Enabled() {
+		fmt.Fprintln(out, "Context:       files gathered once the baseline tests have run")
+	}
+	if cfg.Context.RepoMap {
+		fmt.Fprintln(out, "Repo map:      built once the baseline tests have run")
+	}
+
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	fmt.Fprintf(out, "Test command:  %s (timeout %s)\n", cfg.TestCommand, timeout)
+	if opts.Mutation || cfg.Mutation.Enabled {
+		fmt.Fprintf(out, "Mutation:      enabled (max %d mutants)\n", cfg.Mutation.MaxMutants)
+	}
+
+	adapters, err := registry.CreateFromConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create adapters: %w", err)
+	}
+
+	limits := ResourceLimits(cfg, opts.Limits)
+	limitsByAgent := make(map[string]core.ResourceLimits, len(cfg.Agents))
+	for _, agentCfg := range cfg.Agents {
+		limitsByAgent[agentCfg.ID] = cfg.AgentLimits(agentCfg, limits)
+	}
+	sandboxAgents(cfg, adapters, limitsByAgent)
+	if cfg.Sandbox.Enabled() {
+		fmt.Fprintf(out, "Sandbox:       agents and tests run in %s containers of %s\n", cfg.Sandbox.RuntimeName(), cfg.Sandbox.Image)
+	}
+	checkInterval := limits.CheckInterval
+	if checkInterval <= 0 {
+		checkInterval = core.DefaultCheckInterval
+	}
+	fmt.Fprintf(out, "Watchdog:      checks limits every %s; on Ctrl-C agents get %s to wrap up\n", checkInterval, limits.CancelGracePeriod())
+	if opts.SmokeTest || cfg.SmokeTest.Enabled {
+		fmt.Fprintf(out, "Smoke test:    every agent first gets %q within %s\n", cfg.SmokeTest.Task(), cfg.SmokeTest.Timeout())
+	}
+	var budgets []string
+	if limits.MaxRunCost > 0 {
+		budgets = append(budgets, fmt.Sprintf("$%.2f", limits.MaxRunCost))
+	}
+	if limits.MaxRunTokens > 0 {
+		budgets = append(budgets, fmt.Sprintf("%d tokens", limits.MaxRunTokens))
+	}
+	if len(budgets) > 0 {
+		fmt.Fprintf(out, "Run budget:    %s for all agents together\n", strings.Join(budgets, " and "))
+	}
+	missing := 0
+	fmt.Fprintf(out, "\nAgents (%d):\n", len(cfg.Agents))
+	for _, agentCfg := range cfg.Agents {
+		fmt.Fprintf(out, "  %s (%s)\n", agentCfg.ID, agentCfg.Type)
+
+		if describer, ok := adapters[agentCfg.ID].(adapter.Describer); ok {
+			program, args := describer.Command(worktreePlaceholder, task.Prompt)
+			fmt.Fprintf(out, "    Command: %s\n", shellJoin(append([]string{program}, args...)))
+			if path, err := exec.LookPath(program); err == nil {
+				fmt.Fprintf(out, "    Binary:  %s\n", path)
+			} else {
+				fmt.Fprintf(out, "    Binary:  %s not found\n", program)
+				missing++
+			}
+		}
+
+		fmt.Fprintf(out, "    Limits:  %s\n", formatLimits(cfg.AgentLimits(agentCfg, limits)))
+		if agentCfg.TestCommand != "" {
+			fmt.Fprintf(out, "    Tests:   %s\n", agentCfg.TestCommand)
+		}
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprint(out, core.FormatEstimate(EstimateRun(cfg, opts)))
+
+	fmt.Fprintln(out, "\nAfter selection:")
+	fmt.Fprintf(out, "  Export patches to %s\n", filepath.Join(cfg.ArtifactsDir, runID))
+	if opts.Commit {
+		branch := opts.Branch
+		if branch == "" {
+			branch = core.BranchName(cfg.BranchPattern, task.Prompt, runID, "{agent}")
+		}
+		fmt.Fprintf(out, "  Commit the winning patch to branch %s\n", branch)
+	}
+	if opts.Apply {
+		fmt.Fprintf(out, "  Apply the winning patch to %s\n", abs)
+	}
+
+	if missing > 0 {
+		return fmt.Errorf("%d agent binaries were not found", missing)
+	}
+	return nil
+}
+
+// probeWorktree creates and immediately removes a worktree to check that agents will get one
+func probeWorktree(out io.Writer, cfg *core.Config, repo, runID, baseRef string) error {
+	worktreeManager, err := gitutil.NewWorktreeManagerWithBackend(repo, cfg.WorkingDir, gitutil.Backend(cfg.WorktreeBackend))
+	if err != nil {
+		return fmt.Errorf("failed to create worktree manager: %w", err)
+	}
+	defer worktreeManager.Cleanup()
+	worktreeManager.SetRunID(runID)
+
+	worktreePath, err := worktreeManager.CreateWorktree("dry-run", baseRef)
+	if err != nil {
+		return fmt.Errorf("failed to create worktree: %w", err)
+	}
+	if err := worktreeManager.RemoveWorktree(worktreePath); err != nil {
+		return fmt.Errorf("failed to remove worktree: %w", err)
+	}
+
+	fmt.Fprintf(out, "Worktrees:     %s (%s backend, creation checked)\n", cfg.WorkingDir, worktreeManager.Backend())
+	return nil
+}
+
+// formatLimits describes the resource limits an agent runs under
+func formatLimits(limits core.ResourceLimits) string {
+	describe := func(enabled bool, value string) string {
+		if !enabled {
+			return "unlimited"
+		}
+		return value
+	}
+
+	parts := []string{
+		"timeout " + describe(limits.MaxDuration > 0, limits.MaxDuration.String()),
+		"tokens " + describe(limits.MaxTokens > 0, fmt.Sprintf("%d", limits.MaxTokens)),
+		"cost " + describe(limits.MaxCost > 0, fmt.Sprintf("$%.2f", limits.MaxCost)),
+		"idle " + describe(limits.MaxIdle > 0, limits.MaxIdle.String()),
+		"disk " + describe(limits.MaxDiskBytes > 0, fmt.Sprintf("%d MB", limits.MaxDiskBytes/(1024*1024))),
+		"memory " + describe(limits.MaxMemoryBytes > 0, fmt.Sprintf("%d MB", limits.MaxMemoryBytes/(1024*1024))),
+		"CPU " + describe(limits.MaxCPUTime > 0, limits.MaxCPUTime.String()),
+		"warnings " + formatThresholds(limits.WarningThresholds()),
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatThresholds lists warning thresholds as percentages, e.g. "at 50%/80%/95%"
+func formatThresholds(thresholds []float64) string {
+	if len(thresholds) == 0 {
+		return "off"
+	}
+	percents := make([]string, len(thresholds))
+	for i, threshold := range thresholds {
+		// Rounded to hundredths of a percent, so 0.57 doesn't print as 56.99999999999999%
+		percents[i] = strconv.FormatFloat(math.Round(threshold*1e4)/100, 'f', -1, 64) + "%"
+	}
+	return "at " + strings.Join(percents, "/")
+}
+
+// shellJoin renders a command line, quoting arguments a shell would split or expand
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == worktreePlaceholder || (arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`!*?[](){}<>|&;#~")) {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
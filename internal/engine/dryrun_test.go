@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellJoin(t *testing.T) {
+	assert.Equal(t, "agent --json -w <worktree> 'Fix the bug'", shellJoin([]string{"agent", "--json", "-w", worktreePlaceholder, "Fix the bug"}))
+	assert.Equal(t, `agent 'it'\''s' '' '$HOME'`, shellJoin([]string{"agent", "it's", "", "$HOME"}))
+}
+
+func TestFormatLimits(t *testing.T) {
+	assert.Equal(t,
+		"timeout 5m0s, tokens 1000, cost $1.50, idle 30s, disk 100 MB, memory 512 MB, CPU 2m0s, warnings at 50%/80%/95%",
+		formatLimits(core.ResourceLimits{
+			MaxDuration:    5 * time.Minute,
+			MaxTokens:      1000,
+			MaxCost:        1.5,
+			MaxIdle:        30 * time.Second,
+			MaxDiskBytes:   100 * 1024 * 1024,
+			MaxMemoryBytes: 512 * 1024 * 1024,
+			MaxCPUTime:     2 * time.Minute,
+			WarnAt:         []float64{0.5, 0.8, 0.95},
+		}))
+	assert.Equal(t,
+		"timeout unlimited, tokens unlimited, cost unlimited, idle unlimited, disk unlimited, memory unlimited, CPU unlimited, warnings at 80%",
+		formatLimits(core.ResourceLimits{}))
+	assert.Contains(t, formatLimits(core.ResourceLimits{WarnAt: []float64{}}), "warnings off")
+}
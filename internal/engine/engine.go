@@ -0,0 +1,1019 @@
+// Package engine runs a task end to end: it starts the agents in worktrees of their own, watches them, evaluates
+// their patches, and selects, exports, and optionally applies the best one. The run command and embedding programs,
+// through pkg/orchestrator, share it, each turning their own inputs into Options
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/adapter/cli"
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/brettsmith212/orchestrator/internal/trace"
+)
+
+// Options are the choices a run makes beyond its configuration; the zero value runs in the current directory,
+// printing nothing, and leaves the repository as it was
+type Options struct {
+	// Repo is the repository to work on ("" for the current directory)
+	Repo string
+
+	// RepoURL is a remote repository to clone into the working directory instead of using Repo, with Clone's depth
+	// and filter; a task naming its own repository is cloned instead
+	RepoURL string
+	Clone   gitutil.CloneOptions
+
+	// Limits override the configured global agent limits
+	Limits core.LimitsConfig
+
+	// Samples is how many independent attempts each agent makes, overriding the configured global count when positive
+	Samples int
+
+	// PromptVariants is how many prompt variants every agent runs once each with, the first of the configured
+	// variants or else of the built-in ones (0 for every configured variant)
+	PromptVariants int
+
+	// Mutation and Speculative turn on mutation testing and speculative evaluation whatever the configuration says
+	Mutation    bool
+	Speculative bool
+
+	// RefineRounds is how many follow-up rounds agents get while the best patch fails tests (0 for the configured number)
+	RefineRounds int
+
+	// Stack is the most patches stacked into the result while the best one leaves tests failing
+	// (0 for the configured number)
+	Stack int
+
+	// PromptTemplate is a file holding a template that replaces the configured prompt template
+	PromptTemplate string
+
+	// IncludeDirty starts agents from the repository's uncommitted changes instead of HEAD
+	IncludeDirty bool
+
+	// Accept lists the files or file#hunk specs of the winning patch to keep, re-validated with tests
+	Accept []string
+
+	// Commit commits the winning patch onto Branch ("" for the configured branch_pattern), and Apply applies it to
+	// the repository
+	Commit bool
+	Branch string
+	Apply  bool
+
+	// KeepWorktrees keeps every agent's worktree after the run for inspection
+	KeepWorktrees bool
+
+	// SmokeTest gives every agent a trivial task before the run, leaving out the agents that fail it, whatever the
+	// configuration says
+	SmokeTest bool
+
+	// TestAuthor is the agent that writes failing tests for the others to make pass, replacing the configured one
+	// ("" for the configuration's choice)
+	TestAuthor string
+
+	// PatchFiles are existing patches, such as human-written fixes, judged alongside the agents' patches, each
+	// submitted by an agent of its own
+	PatchFiles []string
+
+	// Deterministic runs agents one at a time in configuration order, with no speculative evaluation to stop them
+	// early, so a run's logs, events, and artifacts come out in the same order every time
+	Deterministic bool
+
+	// Clock times agents and tests (nil for the wall clock), and Runner runs test commands (nil to run them as
+	// processes)
+	Clock  core.Clock
+	Runner core.CommandRunner
+
+	// DryRun prints what the run would execute, described as run with the configuration at ConfigPath, instead of
+	// starting agents or running tests
+	DryRun     bool
+	ConfigPath string
+
+	// SharedWorkingDir is set when other runs share the working directory, as in batch and serve; such runs don't
+	// recover orphaned worktrees, which would reclaim each other's, so that is done once before any starts
+	SharedWorkingDir bool
+
+	// Output receives the run's results as text (nil for none), Verbose adding a description of the winning patch
+	// and Ranking every patch's score, for progress displays that replace the log
+	Output  io.Writer
+	Verbose bool
+	Ranking bool
+
+	// Logger receives the run's log messages (nil for the default logger)
+	Logger *slog.Logger
+
+	// Progress is told what the agents are doing (nil for nothing)
+	Progress Progress
+
+	// OnEvent is called with every event an agent emits, from the agent's goroutine as the event arrives (nil for none)
+	OnEvent func(event *protocol.Event)
+}
+
+// repo returns the repository to work on when it isn't cloned
+func (o Options) repo() string {
+	if o.Repo == "" {
+		return "."
+	}
+	return o.Repo
+}
+
+// output returns where the run's results are printed
+func (o Options) output() io.Writer {
+	if o.Output == nil {
+		return io.Discard
+	}
+	return o.Output
+}
+
+// logger returns the logger of the run's messages
+func (o Options) logger() *slog.Logger {
+	if o.Logger == nil {
+		return slog.Default()
+	}
+	return o.Logger
+}
+
+// clock returns what times agents and tests
+func (o Options) clock() core.Clock {
+	if o.Clock == nil {
+		return core.SystemClock{}
+	}
+	return o.Clock
+}
+
+// progress returns what is told about the agents' progress
+func (o Options) progress() Progress {
+	if o.Progress == nil {
+		return NoProgress{}
+	}
+	return o.Progress
+}
+
+// Repository identifies the repository a task's run works on in its records: its URL when it is cloned, or else
+// its absolute path
+func (o Options) Repository(task core.Task) string {
+	if task.Repo != "" {
+		return task.Repo
+	}
+	if o.RepoURL != "" {
+		return o.RepoURL
+	}
+	repo, _ := filepath.Abs(o.repo())
+	return repo
+}
+
+// AgentIDs returns the IDs of the agents a run of the configuration starts, one per prompt variant and sample
+// samples and promptVariants are as in Options
+func AgentIDs(cfg *core.Config, samples, promptVariants int) []string {
+	if expanded, err := expandAgents(cfg, samples, promptVariants); err == nil {
+		cfg = expanded
+	}
+
+	ids := make([]string, 0, len(cfg.Agents))
+	for _, agent := range cfg.Agents {
+		ids = append(ids, agent.ID)
+	}
+	return ids
+}
+
+// expandAgents returns a copy of the configuration with one agent for each prompt variant and sample an agent runs
+func expandAgents(cfg *core.Config, samples, promptVariants int) (*core.Config, error) {
+	cfg, err := cfg.ExpandPromptVariants(promptVariants)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.ExpandSamples(samples)
+}
+
+// Run has the agents work on a task and selects, exports, and optionally applies the best patch
+// runID identifies the run in branch names and artifacts, and opts holds the choices made beyond the configuration
+// The run is traced when tracing is configured; dry runs do no work worth tracing
+func Run(ctx context.Context, cfg *core.Config, task core.Task, runID string, opts Options) (*core.TaskResult, error) {
+	var tracer *trace.Tracer
+	if !opts.DryRun {
+		tracer = newTracer(cfg)
+		ctx = audit.WithRun(ctx, NewAuditLog(cfg), runID)
+	}
+	ctx, span := tracer.Start(ctx, "run")
+	span.SetAttribute("run.id", runID)
+	if task.ID != "" {
+		span.SetAttribute("task.id", task.ID)
+	}
+	audit.Record(ctx, audit.RunStarted, "task", task.ID, "prompt", cfg.StoredPrompt(task.Prompt), "repo", opts.Repository(task), "agents", strings.Join(AgentIDs(cfg, opts.Samples, opts.PromptVariants), ","))
+
+	result, err := orchestrate(ctx, cfg, task, runID, opts)
+	span.SetError(err)
+	if result != nil && result.Best != nil {
+		span.SetAttribute("run.solved", result.Solved())
+		span.SetAttribute("run.best_agent", result.Best.AgentID)
+		audit.Record(ctx, audit.RunFinished, "best", result.Best.AgentID, "score", strconv.Itoa(result.Best.Score), "solved", strconv.FormatBool(result.Solved()))
+	} else if err != nil {
+		audit.Record(ctx, audit.RunFinished, "error", err.Error())
+	}
+	span.Finish()
+	exportTrace(ctx, opts.logger(), cfg, runID, tracer)
+	if !opts.DryRun {
+		pruneRuns(opts.logger(), cfg)
+	}
+
+	return result, err
+}
+
+// pruneRuns deletes the runs past the configured retention limits, now that another run has been added
+// A run that can't be pruned is logged, since the run itself succeeded
+func pruneRuns(logger *slog.Logger, cfg *core.Config) {
+	if !cfg.ArtifactRetention.Enabled() {
+		return
+	}
+	pruned, err := core.PruneRuns(cfg.ArtifactsDir, cfg.ArtifactRetention, time.Now())
+	if err != nil {
+		logger.Warn("failed to prune old runs", "dir", cfg.ArtifactsDir, "error", err)
+		return
+	}
+	if len(pruned.Runs) > 0 {
+		logger.Info("pruned old runs", "runs", len(pruned.Runs), "objects", pruned.Objects, "size_mb", pruned.Size/(1024*1024))
+	}
+}
+
+// NewAuditLog returns the audit log configured for runs, or nil if there is none
+func NewAuditLog(cfg *core.Config) *audit.Log {
+	if cfg.AuditLog == "" {
+		return nil
+	}
+	return audit.New(cfg.AuditLog, cfg.Redact)
+}
+
+// orchestrate does the work of run
+func orchestrate(ctx context.Context, cfg *core.Config, task core.Task, runID string, opts Options) (*core.TaskResult, error) {
+	prompt := task.Prompt
+	out := opts.output()
+	logger := opts.logger().With("run", runID)
+	if task.ID != "" && task.ID != runID {
+		logger = logger.With("task", task.ID)
+	}
+
+	// Setup adapter registry and check agent types before doing any expensive work
+	registry := adapter.NewRegistry()
+	RegisterAdapters(registry)
+	if err := registry.Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	// A sandboxed run never falls back to running agents or tests on the host
+	if err := cfg.Sandbox.Check(exec.LookPath); err != nil {
+		return nil, err
+	}
+
+	// A test author given for the run replaces the configured one
+	if opts.TestAuthor != "" {
+		withAuthor, err := cfg.WithTestAuthor(opts.TestAuthor)
+		if err != nil {
+			return nil, err
+		}
+		cfg = withAuthor
+	}
+
+	// Patch files given for the run compete as agents of their own
+	if len(opts.PatchFiles) > 0 {
+		withPatches, err := cfg.WithPatchFiles(opts.PatchFiles)
+		if err != nil {
+			return nil, err
+		}
+		cfg = withPatches
+	}
+
+	// Agents run once per prompt variant and sample, and each one's patch is judged on its own
+	cfg, err := expandAgents(cfg, opts.Samples, opts.PromptVariants)
+	if err != nil {
+		return nil, err
+	}
+
+	// A broken template would only surface after the baseline tests, so check it up front
+	if _, err := loadPromptTemplate(cfg, opts.PromptTemplate); err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return nil, dryRun(cfg, registry, runID, task, opts)
+	}
+
+	// Resolve absolute path to repository
+	abs, err := filepath.Abs(opts.repo())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve repository path: %w", err)
+	}
+
+	// Work from a lightweight clone for remote repositories, fetching only what worktrees need
+	// A task naming its own repository, such as one from a webhook, is cloned instead of the run's
+	baseRef := task.BaseRef
+	cloneURL := opts.RepoURL
+	if task.Repo != "" {
+		cloneURL = task.Repo
+	}
+	if cloneURL != "" {
+		if opts.Apply {
+			return nil, fmt.Errorf("--apply cannot be used with a cloned repository, use --commit instead")
+		}
+		abs = gitutil.CachedClonePath(cfg.WorkingDir, cloneURL)
+		logger.Info("cloning repository", "url", cloneURL, "path", abs)
+		if err := gitutil.CloneOrUpdate(cloneURL, abs, opts.Clone); err != nil {
+			return nil, err
+		}
+
+		// The clone only has its default branch; refs it can't fetch by name, like HEAD~1, are left to git to resolve
+		if baseRef != "" {
+			if commit, err := gitutil.FetchRef(abs, baseRef, opts.Clone); err != nil {
+				logger.Debug("base ref not fetched", "ref", baseRef, "error", err)
+			} else {
+				baseRef = commit
+			}
+		}
+	}
+
+	// Snapshot uncommitted changes so agents start from what the user actually has
+	if opts.IncludeDirty && baseRef != "" {
+		return nil, fmt.Errorf("--include-dirty cannot be combined with a base ref")
+	}
+	if opts.IncludeDirty {
+		baseRef, err = gitutil.SnapshotWorkingTree(abs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot working tree: %w", err)
+		}
+		logger.Debug("snapshotted uncommitted changes", "ref", baseRef)
+	}
+
+	// Applying requires a clean repository, so check before spending time on agents
+	if opts.Apply && !opts.IncludeDirty {
+		clean, err := gitutil.IsClean(abs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check repository status: %w", err)
+		}
+		if !clean {
+			return nil, fmt.Errorf("cannot apply patch: %w", gitutil.ErrDirtyRepo)
+		}
+	}
+
+	// Everything the run produces is kept under one directory named after the run ID
+	artifacts, err := core.NewRunWriter(filepath.Join(cfg.ArtifactsDir, runID), cfg)
+	if err != nil {
+		return nil, err
+	}
+	LogArtifactError(logger, artifacts.WriteConfig())
+	LogArtifactError(logger, artifacts.WritePrompt(task))
+
+	// Setup git worktree manager
+	worktreeManager, err := gitutil.NewWorktreeManagerWithBackend(abs, cfg.WorkingDir, gitutil.Backend(cfg.WorktreeBackend))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create worktree manager: %w", err)
+	}
+	defer releaseWorktrees(out, logger, worktreeManager, opts.KeepWorktrees)
+	worktreeManager.SetRunID(runID)
+	worktreeManager.SetLFSPull(cfg.LFSPull)
+	worktreeManager.SetMaxDiffBytes(cfg.DiffLimits.MaxBytes)
+
+	// Worktrees of LFS repositories only get pointer files unless LFS objects are pulled
+	if !cfg.LFSPull && gitutil.UsesLFS(abs) {
+		logger.Warn("repository uses Git LFS; set lfs_pull: true if agents need LFS content")
+	}
+
+	// Reclaim worktrees left behind by a previous run that crashed
+	// Runs of a batch or server share the working directory, so they are recovered once before any starts
+	if !opts.SharedWorkingDir {
+		RecoverOrphans(logger, worktreeManager)
+	}
+
+	limits := ResourceLimits(cfg, opts.Limits)
+	limitsByAgent := make(map[string]core.ResourceLimits, len(cfg.Agents))
+	for _, agentCfg := range cfg.Agents {
+		limitsByAgent[agentCfg.ID] = cfg.AgentLimits(agentCfg, limits)
+	}
+
+	// In TDD mode the test author writes failing tests first; the other agents start from them, and may not change them
+	taskBase := baseRef
+	var testAuthor string
+	var tests *core.PatchDetails
+	if cfg.TDD.Enabled() {
+		testAuthor = cfg.TDD.TestAuthor
+		if baseRef, tests, err = writeFailingTests(ctx, logger, opts, artifacts, registry, cfg, limitsByAgent, limits, worktreeManager, abs, baseRef, task, runID); err != nil {
+			return nil, err
+		}
+		var ok bool
+		if limits, ok = remainingLimits(limits, map[string]*core.PatchDetails{testAuthor: tests}); !ok {
+			return nil, fmt.Errorf("test author %s spent the run's budget", testAuthor)
+		}
+		cfg, _ = cfg.WithoutTestAuthor()
+		cfg = cfg.ProtectTests(tests.Diff)
+		fmt.Fprintf(out, "\n%s wrote failing tests in %s\n", testAuthor, strings.Join(core.TestFiles(tests.Diff), ", "))
+	}
+
+	// Checkpoint the run as it goes, so a crash doesn't lose the agents' work
+	checkpoint := core.NewCheckpointer(artifacts, runID, opts.Repository(task), task, baseRef)
+
+	// Tests without a patch run on the base ref, which is the repository itself unless a task names another
+	baselinePath := abs
+	if baseRef != "" && (!opts.IncludeDirty || tests != nil) {
+		baselinePath, err = worktreeManager.CreateWorktree("baseline", baseRef)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check out base ref %s: %w", baseRef, err)
+		}
+		audit.Record(ctx, audit.WorktreeCreated, "agent", "baseline", "path", baselinePath, "base_ref", baseRef)
+	}
+
+	// Tests run from the scope, so it has to exist at the base ref
+	if err := core.CheckScope(baselinePath, cfg.Scope); err != nil {
+		return nil, err
+	}
+
+	// Hooks set up the checkout the baseline tests run in, and each patch's worktree before its tests
+	hooks := HookEnv(worktreeManager, artifacts, baseRef)
+	if err := RunHooks(ctx, logger, cfg, core.HookPreRun, baselinePath, hooks); err != nil {
+		return nil, err
+	}
+
+	// Setup arbitrator
+	arbitrator := NewArbitrator(cfg, baselinePath, opts.Mutation)
+	arbitrator.SetClock(opts.clock())
+	if opts.Runner != nil {
+		arbitrator.SetCommandRunner(opts.Runner)
+	}
+	PrepareEvaluations(arbitrator, logger, cfg, hooks)
+
+	// Run baseline tests
+	logger.Info("running baseline tests")
+	baselineCtx, baselineSpan := trace.Start(ctx, "baseline tests")
+	if err := arbitrator.SetBaselineTestResults(baselineCtx); err != nil {
+		baselineSpan.SetError(err)
+		baselineSpan.Finish()
+		return nil, fmt.Errorf("failed to run baseline tests: %w", err)
+	}
+	if baseline := arbitrator.BaselineTestResults(); baseline != nil {
+		logger.Debug("baseline tests finished", "passed", baseline.PassedTests, "failed", baseline.FailedTests, "total", baseline.TotalTests)
+		baselineSpan.SetAttribute("tests.passed", baseline.PassedTests)
+		baselineSpan.SetAttribute("tests.failed", baseline.FailedTests)
+		baselineSpan.SetAttribute("tests.total", baseline.TotalTests)
+	}
+	baselineSpan.Finish()
+	LogArtifactError(logger, artifacts.WriteTestLog(core.BaselineTestLog, arbitrator.BaselineTestResults()))
+	if baseline := arbitrator.BaselineTestResults(); tests != nil && baseline != nil && baseline.Success {
+		logger.Warn("the test author's tests already pass", "agent", testAuthor)
+	}
+
+	// Gather the files relevant to the task; agents can still work without them
+	contextFiles, err := core.GatherContextFiles(baselinePath, cfg.Scope, cfg.Context, arbitrator.BaselineTestResults())
+	if err != nil {
+		logger.Warn("failed to gather context files", "error", err)
+	}
+	if len(contextFiles) > 0 {
+		logger.Debug("gathered context files", "count", len(contextFiles), "files", contextFiles)
+	}
+
+	// Map the repository for agents that would otherwise explore it blindly
+	var repoMap string
+	if cfg.Context.RepoMap {
+		if repoMap, err = core.RepoMap(baselinePath, cfg.Scope, 0); err != nil {
+			logger.Warn("failed to build repository map", "error", err)
+		}
+	}
+
+	// Wrap the prompt in the template now that the baseline tests have shown what is failing
+	// Branch names and commit messages still come from the task prompt
+	prompts, err := renderPrompts(cfg, opts.PromptTemplate, task, runID, baselinePath, arbitrator.BaselineTestResults(), contextFiles, repoMap)
+	if err != nil {
+		return nil, err
+	}
+	agentPrompt := prompts.prompt
+	if agentPrompt != prompt {
+		LogArtifactError(logger, artifacts.WritePrompt(core.Task{Prompt: agentPrompt}))
+	}
+
+	// Create adapters based on configuration; pipeline reviewers only start once there is a patch to review
+	reviewers := make(map[string]bool)
+	for _, pipeline := range cfg.ActivePipelines() {
+		reviewers[pipeline.Reviewer] = true
+	}
+	adapters, err := createAdapters(registry, cfg, limitsByAgent, func(id string) bool { return !reviewers[id] })
+	if err != nil {
+		return nil, err
+	}
+
+	// Agents that can't do a trivial task are left out before the run waits on them
+	if opts.SmokeTest || cfg.SmokeTest.Enabled {
+		if err := excludeFailingAgents(ctx, logger, opts, registry, cfg, limitsByAgent, adapters, worktreeManager, baseRef); err != nil {
+			return nil, err
+		}
+	}
+
+	// Start agents
+	logger.Info("starting agents", "count", len(adapters), "prompt", cfg.StoredPrompt(agentPrompt), "prompt_variants", len(cfg.PromptVariants))
+	checkpoint.SetStage(core.StageAgents)
+	arbitrator.SetEvaluatedHook(checkpoint.Evaluated)
+	patchDetails, err := runAgents(ctx, logger, opts, checkpoint, artifacts, arbitrator, adapters, limitsByAgent, limits, cfg, worktreeManager, baseRef, prompts, contextFiles, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error running agents: %w", err)
+	}
+
+	// Patches made in pipelines are reviewed, and revised with the reviews, before any is judged
+	if err := reviewPatches(ctx, logger, opts, checkpoint, artifacts, registry, cfg, limitsByAgent, limits, worktreeManager, baseRef, prompts, contextFiles, patchDetails); err != nil {
+		return nil, err
+	}
+
+	// Select best patch
+	logger.Info("evaluating patches")
+	checkpoint.SetStage(core.StageEvaluating)
+	arbitrationCtx, arbitrationSpan := trace.Start(ctx, "arbitration")
+	arbitrationSpan.SetAttribute("patches", len(patchDetails))
+	ranked, err := arbitrator.RankPatches(arbitrationCtx, patchDetails)
+	arbitrationSpan.SetError(err)
+	if err == nil {
+		arbitrationSpan.SetAttribute("best_agent", ranked[0].AgentID)
+	}
+	arbitrationSpan.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("failed to select best patch: %w", err)
+	}
+
+	// While the best patch leaves tests failing, agents get the failures and their diff for another attempt
+	ranked, err = refinePatches(ctx, logger, opts, checkpoint, artifacts, arbitrator, registry, cfg, limitsByAgent, limits, worktreeManager, baseRef, prompts, contextFiles, patchDetails, ranked)
+	if err != nil {
+		return nil, err
+	}
+	bestPatch := ranked[0]
+	LogArtifactError(logger, artifacts.WriteTimeline(patchDetails))
+	for _, candidate := range ranked {
+		logger.Debug("scored patch", "agent", candidate.AgentID, "score", candidate.Score, "reason", candidate.Reason)
+		LogArtifactError(logger, artifacts.WriteTestLog(candidate.AgentID, candidate.TestResults))
+	}
+	if opts.Ranking {
+		fmt.Fprintln(out)
+		fmt.Fprint(out, core.FormatRanking(ranked))
+	}
+	if len(cfg.PromptVariants) > 0 {
+		logger.Info("prompt variant won", "variant", core.PromptVariantOf(bestPatch.AgentID), "agent", bestPatch.AgentID)
+		fmt.Fprintln(out)
+		fmt.Fprint(out, core.FormatPromptVariants(ranked))
+	}
+
+	// Other patches that apply on top of the best one, and fix tests it leaves failing, are stacked onto it
+	maxStacked := cfg.Stack.MaxPatches
+	if opts.Stack > 0 {
+		maxStacked = opts.Stack
+	}
+	if maxStacked > 1 && core.NeedsRefinement(bestPatch) {
+		logger.Info("stacking patches", "max_patches", maxStacked, "best_agent", bestPatch.AgentID)
+		if bestPatch, err = stackPatches(ctx, logger, arbitrator, worktreeManager, baseRef, ranked, maxStacked); err != nil {
+			return nil, fmt.Errorf("failed to stack patches: %w", err)
+		}
+		LogArtifactError(logger, artifacts.WriteTestLog("stacked", bestPatch.TestResults))
+	}
+
+	// Display results
+	fmt.Fprintln(out, "\n=== Best Patch Selected ===")
+	fmt.Fprintln(out, core.FormatPatchResult(bestPatch))
+	if opts.Verbose {
+		fmt.Fprintln(out, gitutil.DescribePatch(bestPatch.Diff))
+	}
+	if spend := core.FormatSpend(ranked, limits); spend != "" {
+		fmt.Fprintln(out, "=== Usage ===")
+		fmt.Fprintln(out, spend)
+	}
+
+	// Keep only the accepted parts of the patch, re-validating them with tests
+	if len(opts.Accept) > 0 {
+		bestPatch, err = acceptSubset(ctx, arbitrator, worktreeManager, baseRef, bestPatch, opts.Accept)
+		if err != nil {
+			return nil, fmt.Errorf("failed to accept partial patch: %w", err)
+		}
+		fmt.Fprintln(out, "\n=== Accepted Partial Patch ===")
+		fmt.Fprintln(out, core.FormatPatchResult(bestPatch))
+		LogArtifactError(logger, artifacts.WriteTestLog("accepted", bestPatch.TestResults))
+	}
+
+	// Point the human reviewer at what needs the closest look
+	reviewNotes := core.ReviewNotes(bestPatch)
+	if len(reviewNotes) > 0 {
+		fmt.Fprintln(out, "=== Review Notes ===")
+		for _, note := range reviewNotes {
+			fmt.Fprintln(out, note)
+		}
+	}
+
+	// Export candidate and winning patches for manual use or later re-evaluation
+	// The test author's patch is exported with the others, since best.patch applies on top of it
+	candidates := patchDetails
+	if tests != nil {
+		candidates = maps.Clone(patchDetails)
+		candidates[testAuthor] = tests
+	}
+	exportedPatches, exportedBest := RedactPatches(logger, cfg, candidates, bestPatch)
+	if _, err := core.ExportPatches(artifacts.Dir(), exportedPatches, exportedBest); err != nil {
+		logger.Error("failed to export patches", "error", err)
+	}
+
+	// Hand the selected patch on to post_select hooks; the selection stands even if they fail
+	hooks.Winner, hooks.Score, hooks.Worktree = bestPatch.AgentID, bestPatch.Score, bestPatch.WorktreePath
+	if exported := filepath.Join(artifacts.Dir(), core.BestPatchFile); fileExists(exported) {
+		hooks.Patch = exported
+	}
+	if err := RunHooks(ctx, logger, cfg, core.HookPostSelect, bestPatch.WorktreePath, hooks); err != nil {
+		logger.Warn("hooks failed", "hook", core.HookPostSelect, "error", err)
+	}
+
+	// What applying and committing change is recorded, so the rollback command can undo it
+	record := &core.ApplyRecord{Repo: abs, Agent: bestPatch.AgentID, AppliedAt: time.Now()}
+	var recordErr error
+
+	// Commit the patch onto a new branch if requested
+	var branch string
+	if opts.Commit {
+		branch = opts.Branch
+		if branch == "" {
+			branch = core.BranchName(cfg.BranchPattern, prompt, runID, bestPatch.AgentID)
+		}
+		if err := gitutil.CommitToBranch(bestPatch.WorktreePath, branch, core.CommitMessage(prompt, bestPatch)); err != nil {
+			return nil, fmt.Errorf("failed to commit patch from %s: %w", bestPatch.AgentID, err)
+		}
+		audit.Record(ctx, audit.BranchCommitted, "agent", bestPatch.AgentID, "branch", branch, "repo", abs)
+		record.Branch = branch
+		record.BranchCommit, recordErr = gitutil.ResolveCommit(bestPatch.WorktreePath, "HEAD")
+		fmt.Fprintf(out, "Committed patch from %s to branch %s\n", bestPatch.AgentID, branch)
+	}
+
+	// Apply the patch to the main repository if requested
+	if opts.Apply {
+		// The test author's tests come along with the patch that makes them pass
+		diff := bestPatch.Diff
+		if tests != nil {
+			diff = tests.Diff + diff
+		}
+		applyPatch := func() error { return gitutil.ApplyPatch(abs, diff) }
+		if opts.IncludeDirty {
+			applyPatch = func() error { return gitutil.ApplyPatchToSnapshot(abs, taskBase, diff) }
+		}
+		var head, before string
+		head, err = gitutil.ResolveCommit(abs, "HEAD")
+		if err == nil {
+			before, err = gitutil.WorkingTreeID(abs)
+		}
+		if err != nil {
+			recordErr = errors.Join(recordErr, err)
+		}
+		if err := applyPatch(); err != nil {
+			return nil, fmt.Errorf("failed to apply patch from %s: %w", bestPatch.AgentID, err)
+		}
+		record.Head, record.Before = head, before
+		if after, err := gitutil.WorkingTreeID(abs); err != nil {
+			recordErr = errors.Join(recordErr, err)
+		} else {
+			record.After = after
+		}
+		audit.Record(ctx, audit.PatchApplied, "agent", bestPatch.AgentID, "repo", abs, "files", strconv.Itoa(bestPatch.DiffStats.FilesChanged))
+		fmt.Fprintf(out, "Applied patch from %s to %s\n", bestPatch.AgentID, abs)
+	}
+	if opts.Apply || opts.Commit {
+		if recordErr != nil {
+			logger.Warn("failed to record the repository's state; the run can't be rolled back", "error", recordErr)
+		} else {
+			LogArtifactError(logger, core.WriteApplyRecord(artifacts.Dir(), record))
+		}
+		hooks.Branch = branch
+		if err := RunHooks(ctx, logger, cfg, core.HookPostApply, abs, hooks); err != nil {
+			logger.Warn("hooks failed", "hook", core.HookPostApply, "error", err)
+		}
+	}
+
+	result := &core.TaskResult{Task: task, RunID: runID, Repo: opts.Repository(task), Best: bestPatch, Candidates: ranked, Branch: branch, ReviewNotes: reviewNotes}
+	if tests != nil {
+		result.TestAuthor, result.Tests = testAuthor, tests.Diff
+	}
+	LogArtifactError(logger, artifacts.WriteReport(result))
+	LogArtifactError(logger, core.RenderRunPages(artifacts.Dir()))
+	checkpoint.SetStage(core.StageFinished)
+	fmt.Fprintf(out, "\nRun %s outputs written to %s\n", runID, artifacts.Dir())
+
+	return result, nil
+}
+
+// loadPromptTemplate returns the prompt template read from path, or else the configured one, or "" if there is none
+func loadPromptTemplate(cfg *core.Config, path string) (string, error) {
+	if path == "" {
+		return cfg.PromptTemplate, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt template: %w", err)
+	}
+	if _, err := core.ParsePromptTemplate(string(data)); err != nil {
+		return "", fmt.Errorf("invalid prompt template %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+// renderPrompts wraps the task prompt in the prompt template, and so the prompt of every prompt variant the run uses
+// after the variant rewrites the task prompt; without a template a prompt is only preceded by the repository map, if
+// there is one. The context files, when they go in the prompt, and the scope follow each prompt
+// templatePath is a prompt template file replacing the configured template, and repo is the checkout the baseline
+// tests ran in
+func renderPrompts(cfg *core.Config, templatePath string, task core.Task, runID, repo string, baseline *core.TestResult, contextFiles []string, repoMap string) (agentPrompts, error) {
+	text, err := loadPromptTemplate(cfg, templatePath)
+	if err != nil {
+		return agentPrompts{}, err
+	}
+
+	var data core.PromptData
+	if text != "" || len(cfg.PromptVariants) > 0 {
+		data = promptData(cfg, task, runID, repo, baseline, contextFiles, repoMap)
+	}
+	wrap := func(prompt string) (string, error) {
+		switch {
+		case text != "":
+			data := data
+			data.Prompt = prompt
+			if prompt, err = core.RenderPrompt(text, data); err != nil {
+				return "", err
+			}
+		case repoMap != "":
+			prompt = repoMap + "\n" + prompt
+		}
+		if cfg.Context.InPrompt {
+			prompt += core.ContextFilesPrompt(contextFiles)
+		}
+		return prompt + core.ScopePrompt(cfg.Scope), nil
+	}
+
+	prompts := agentPrompts{variants: make(map[string]string, len(cfg.PromptVariants))}
+	if prompts.prompt, err = wrap(task.Prompt); err != nil {
+		return agentPrompts{}, err
+	}
+	for _, variant := range cfg.PromptVariants {
+		rewritten, err := variant.Render(data)
+		if err != nil {
+			return agentPrompts{}, err
+		}
+		if prompts.variants[variant.Name], err = wrap(rewritten); err != nil {
+			return agentPrompts{}, err
+		}
+	}
+	return prompts, nil
+}
+
+// promptData gathers the context prompt templates are rendered with
+func promptData(cfg *core.Config, task core.Task, runID, repo string, baseline *core.TestResult, contextFiles []string, repoMap string) core.PromptData {
+	data := core.PromptData{
+		Prompt:       task.Prompt,
+		Task:         task,
+		RunID:        runID,
+		Language:     core.DetectProject(filepath.Join(repo, filepath.FromSlash(cfg.Scope))).Language,
+		Scope:        cfg.Scope,
+		TestCommand:  cfg.TestCommand,
+		ContextFiles: contextFiles,
+		RepoMap:      repoMap,
+	}
+	if baseline != nil {
+		data.TestsPassing = baseline.Success
+		data.FailingTests = core.FailingTests(baseline.Output)
+		data.TestOutput = baseline.Output
+	}
+
+	// Branch context is best effort, since a repository may have no default branch to compare with
+	if branch, err := gitutil.CurrentBranch(repo); err == nil {
+		data.Branch = branch
+	}
+	if base, err := gitutil.DefaultBranch(repo); err == nil {
+		if files, err := gitutil.ChangedFiles(repo, base); err == nil {
+			data.ChangedFiles = files
+		}
+	}
+	return data
+}
+
+// LogArtifactError reports a run output that could not be written; the run itself carries on
+func LogArtifactError(logger *slog.Logger, err error) {
+	if err != nil {
+		logger.Error("failed to write run artifacts", "error", err)
+	}
+}
+
+// releaseWorktrees removes a run's worktrees, or keeps them and prints where they are to out
+func releaseWorktrees(out io.Writer, logger *slog.Logger, worktreeManager *gitutil.WorktreeManager, keep bool) {
+	if !keep {
+		worktreeManager.Cleanup()
+		return
+	}
+
+	retained, err := worktreeManager.Retain()
+	if err != nil {
+		logger.Error("failed to retain worktrees", "error", err)
+	}
+	if len(retained) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "\n=== Retained Worktrees ===")
+	for _, path := range retained {
+		fmt.Fprintln(out, path)
+	}
+	fmt.Fprintln(out, "Remove them with: orchestrator clean")
+}
+
+// RecoverOrphans removes worktrees left behind by a previous run that crashed
+func RecoverOrphans(logger *slog.Logger, worktreeManager *gitutil.WorktreeManager) {
+	reclaimed, err := worktreeManager.RecoverOrphans()
+	if err != nil {
+		logger.Error("failed to recover orphaned worktrees", "error", err)
+	}
+	for _, path := range reclaimed {
+		logger.Info("reclaimed orphaned worktree", "path", path)
+	}
+}
+
+// NewArbitrator creates an arbitrator that scores patches against a repository with the configured tests and weights
+// Mutation testing runs when it is configured or mutation is set
+func NewArbitrator(cfg *core.Config, repo string, mutation bool) *core.Arbitrator {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	arbitrator := core.NewArbitrator(NewTestRunner(cfg, cfg.TestCommand, timeout), repo)
+	arbitrator.SetIgnorePatterns(cfg.DiffIgnore)
+	arbitrator.SetMaxDiffLineBytes(cfg.DiffLimits.MaxLineBytes)
+	arbitrator.SetScoringWeights(cfg.Scoring)
+	if mutation || cfg.Mutation.Enabled {
+		arbitrator.EnableMutationTesting(cfg.Mutation.MaxMutants)
+	}
+
+	// Agents may validate their patches with their own test command
+	for _, agentCfg := range cfg.Agents {
+		if agentCfg.TestCommand != "" {
+			arbitrator.SetAgentTestRunner(agentCfg.ID, NewTestRunner(cfg, agentCfg.TestCommand, timeout))
+		}
+	}
+
+	return arbitrator
+}
+
+// NewTestRunner creates a test runner for a command, which runs in the sandbox if one is configured
+func NewTestRunner(cfg *core.Config, command string, timeout time.Duration) *core.TestRunner {
+	runner := core.NewTestRunner(command, timeout)
+	runner.Sandbox = cfg.Sandbox.TestContainer()
+	runner.Dir = cfg.Scope
+	runner.Parser = cfg.TestParser
+
+	// Sandboxed tests run in a Linux image whatever the host is
+	runner.Shell = cfg.TestShell
+	if runner.Shell == core.TestShellDefault {
+		runner.Shell = procutil.DefaultShell()
+		if runner.Sandbox != nil {
+			runner.Shell = procutil.ShellSh
+		}
+	}
+	return runner
+}
+
+// sandboxAgents runs each agent in a container if the sandbox is configured, limited to the agent's memory limit
+// and to the hosts its network policy allows
+func sandboxAgents(cfg *core.Config, adapters map[string]adapter.Adapter, limitsByAgent map[string]core.ResourceLimits) {
+	if !cfg.Sandbox.Enabled() {
+		return
+	}
+	policies := make(map[string]core.NetworkPolicy, len(cfg.Agents))
+	for _, agentCfg := range cfg.Agents {
+		policies[agentCfg.ID] = agentCfg.Network
+	}
+	for id, adpt := range adapters {
+		if cliAdapter, ok := adpt.(*cli.Adapter); ok {
+			cliAdapter.SetSandbox(cfg.Sandbox.AgentContainer(policies[id], limitsByAgent[id].MaxMemoryBytes))
+		}
+	}
+}
+
+// enforcePaths reverts the changes in an agent's worktree that the path policy doesn't permit, recording them in
+// the audit log, and returns the files that broke the policy
+func enforcePaths(ctx context.Context, paths core.PathPolicy, worktreeManager *gitutil.WorktreeManager, agentID, worktreePath, diff string) ([]string, error) {
+	if !paths.Enabled() {
+		return nil, nil
+	}
+	base, ok := worktreeManager.BaseCommit(worktreePath)
+	if !ok {
+		return nil, fmt.Errorf("the base commit of %s is unknown", worktreePath)
+	}
+	violations, err := paths.Enforce(worktreePath, base, diff)
+	if err != nil || len(violations) == 0 {
+		return nil, err
+	}
+	audit.Record(ctx, audit.PathsReverted, "agent", agentID, "files", strings.Join(violations, ","), "action", paths.Action())
+	return violations, nil
+}
+
+// protectMetadata undoes the changes an agent made to its worktree's git metadata and reports them, with the actions
+// it reported on that metadata and on the repository and the orchestrator's own files, recording them in the audit log
+func protectMetadata(ctx context.Context, cfg *core.Config, worktreeManager *gitutil.WorktreeManager, metadata *gitutil.MetadataSnapshot, agentID, worktreePath string, events []*protocol.Event) ([]string, error) {
+	restored, err := metadata.Restore()
+	if err != nil {
+		return nil, err
+	}
+	var protected []string
+	for _, path := range restored {
+		protected = append(protected, "restored "+path)
+	}
+	if len(restored) > 0 {
+		audit.Record(ctx, audit.MetadataRestored, "agent", agentID, "files", strings.Join(restored, ","))
+	}
+	protectedDirs := []string{worktreeManager.RepoPath(), worktreeManager.WorkingDir(), cfg.ArtifactsDir}
+	return append(protected, core.ProtectedActions(events, worktreePath, protectedDirs)...), nil
+}
+
+// RedactPatches returns copies of the patches with configured secret values and scrubbed text removed
+// so API keys an agent wrote into the code never end up in run artifacts
+func RedactPatches(logger *slog.Logger, cfg *core.Config, patches map[string]*core.PatchDetails, best *core.PatchResult) (map[string]*core.PatchDetails, *core.PatchResult) {
+	if !cfg.HasSecrets() {
+		return patches, best
+	}
+
+	redacted := make(map[string]*core.PatchDetails, len(patches))
+	for agentID, patch := range patches {
+		copied := *patch
+		copied.Diff = cfg.Redact(patch.Diff)
+		if copied.Diff != patch.Diff {
+			logger.Warn("patch contains a configured secret or scrubbed text; it was redacted from the exported patch", "agent", agentID)
+		}
+		redacted[agentID] = &copied
+	}
+
+	if best == nil {
+		return redacted, nil
+	}
+	copiedBest := *best
+	copiedBest.Diff = cfg.Redact(best.Diff)
+	return redacted, &copiedBest
+}
+
+// acceptSubset reduces a patch to the accepted files or file#hunk specs and re-runs tests on the result
+func acceptSubset(ctx context.Context, arbitrator *core.Arbitrator, worktreeManager *gitutil.WorktreeManager, baseRef string, patch *core.PatchResult, accept []string) (*core.PatchResult, error) {
+	reduced, err := gitutil.SelectPatch(patch.Diff, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the reduced patch to a fresh worktree so it's tested in isolation
+	worktreePath, err := worktreeManager.CreateWorktree(patch.AgentID+"-accepted", baseRef)
+	if err == nil {
+		audit.Record(ctx, audit.WorktreeCreated, "agent", patch.AgentID+"-accepted", "path", worktreePath, "base_ref", baseRef)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := gitutil.ApplyPatch(worktreePath, reduced); err != nil {
+		return nil, err
+	}
+
+	result, err := arbitrator.EvaluatePatch(ctx, patch.AgentID, worktreePath, reduced, patch.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't silently accept a subset that breaks what the full patch fixed
+	if patch.TestResults != nil && patch.TestResults.Success {
+		if result.TestResults == nil {
+			return nil, fmt.Errorf("accepted changes could not be tested: %s", result.Reason)
+		}
+		if !result.TestResults.Success {
+			return nil, fmt.Errorf("tests fail without the excluded changes: %s", core.FormatResults(result.TestResults))
+		}
+	}
+
+	return result, nil
+}
+
+// ResourceLimits returns the global agent limits from the config, overridden by the limits set in overrides
+func ResourceLimits(cfg *core.Config, overrides core.LimitsConfig) core.ResourceLimits {
+	return overrides.Apply(cfg.ResourceLimits())
+}
+
+// EstimateRun estimates one run of the configuration from the agents' previous runs and their limits
+func EstimateRun(cfg *core.Config, opts Options) core.RunEstimate {
+	if expanded, err := expandAgents(cfg, opts.Samples, opts.PromptVariants); err == nil {
+		cfg = expanded
+	}
+
+	history, err := core.LoadUsageHistory(cfg.ArtifactsDir)
+	if err != nil {
+		opts.logger().Warn("failed to load run history for the estimate", "error", err)
+	}
+	return core.EstimateRun(cfg, ResourceLimits(cfg, opts.Limits), history)
+}
+
+// fileExists reports whether a regular file exists at path
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
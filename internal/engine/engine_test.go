@@ -0,0 +1,572 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/adapter/cli"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRun provides basic validation of a run, with tests that are only pretended to run
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	repo := newRepo(t)
+	complete := `echo '{"type":"complete"}'`
+	cfg := testConfig(t,
+		core.AgentConfig{ID: "fixer", Type: "cli", Config: shellAgent("echo fixed > fixed.txt; " + complete)},
+		core.AgentConfig{ID: "idler", Type: "cli", Config: shellAgent(complete)},
+	)
+	var tested []string
+	var mu sync.Mutex
+	runner := fixedTests(func(dir string) {
+		mu.Lock()
+		defer mu.Unlock()
+		tested = append(tested, dir)
+	})
+
+	var started []string
+	opts := Options{
+		Repo:          repo,
+		Deterministic: true,
+		Clock:         core.NewManualClock(time.Now()),
+		Runner:        runner,
+		OnEvent: func(event *protocol.Event) {
+			if event.Type == protocol.EventTypeComplete {
+				started = append(started, event.AgentID)
+			}
+		},
+	}
+	result, err := Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	require.NotNil(t, result.Best)
+	assert.Equal(t, "fixer", result.Best.AgentID)
+	assert.True(t, result.Solved())
+	assert.Zero(t, result.Best.TestResults.Duration)
+	assert.Equal(t, []string{"fixer", "idler"}, started, "Agents run one at a time in configuration order")
+	assert.Len(t, tested, 2, "The baseline and the only patch are tested")
+}
+
+// TestRunSmokeTest checks agents that fail the smoke test are left out of the run
+func TestRunSmokeTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	complete := `echo '{"type":"complete"}'`
+	cfg := testConfig(t,
+		core.AgentConfig{ID: "fixer", Type: "cli", Config: shellAgent("echo fixed > fixed.txt; echo smoke >> README.md; " + complete)},
+		core.AgentConfig{ID: "chatty", Type: "cli", Config: shellAgent("echo Hello; echo smoke >> README.md")},
+		core.AgentConfig{ID: "missing", Type: "cli", Config: map[string]interface{}{"command": "no-such-agent-binary", "worktree_flag": ""}},
+	)
+	cfg.SmokeTest = core.SmokeTestConfig{Enabled: true, TimeoutSeconds: 30}
+
+	var output strings.Builder
+	var ran []string
+	opts := Options{
+		Repo:          newRepo(t),
+		Deterministic: true,
+		Runner:        fixedTests(func(string) {}),
+		Output:        &output,
+		OnEvent: func(event *protocol.Event) {
+			if event.Type == protocol.EventTypeComplete {
+				ran = append(ran, event.AgentID)
+			}
+		},
+	}
+	result, err := Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "fixer", result.Best.AgentID)
+	assert.Len(t, result.Candidates, 1, "Agents that failed the smoke test don't run")
+	assert.Equal(t, []string{"fixer"}, ran)
+	assert.Contains(t, output.String(), "fixer                passed\n")
+	assert.Contains(t, output.String(), "chatty               failed, left out of the run: unreadable-output: ")
+	assert.Contains(t, output.String(), "missing              failed, left out of the run: binary-missing: ")
+
+	// A run with no agent left fails
+	cfg.Agents = cfg.Agents[1:]
+	_, err = Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	assert.EqualError(t, err, "every agent failed the smoke test")
+}
+
+func TestRunPromptVariants(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	// The agent only fixes the bug when asked for the smallest change; sh gives it the prompt as $0
+	cfg := testConfig(t, core.AgentConfig{ID: "fixer", Type: "cli", Config: shellAgent(`case "$0" in *"smallest change"*) echo fixed > fixed.txt;; *) echo tried > tried.txt;; esac; echo '{"type":"complete"}'`)})
+	cfg.PromptVariants = []core.PromptVariant{{Name: "original"}, {Name: "minimal"}}
+
+	var output strings.Builder
+	opts := Options{Repo: newRepo(t), Deterministic: true, Runner: fixedTests(func(string) {}), Output: &output}
+	result, err := Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "fixer@minimal", result.Best.AgentID)
+	require.Len(t, result.Candidates, 2)
+	assert.Contains(t, output.String(), "Prompt variant: minimal\n")
+	assert.Contains(t, output.String(), "minimal              best score")
+
+	report, err := core.ReadReport(filepath.Join(cfg.ArtifactsDir, result.RunID))
+	require.NoError(t, err)
+	assert.Equal(t, "minimal", report.BestPromptVariant)
+}
+
+// TestRunTDD checks the test author's tests are committed for the other agents, who make them pass without changing them
+func TestRunTDD(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	complete := `echo '{"type":"complete"}'`
+	cfg := testConfig(t,
+		core.AgentConfig{ID: "author", Type: "cli", Config: shellAgent("echo expected > spec.txt; " + complete)},
+		core.AgentConfig{ID: "fixer", Type: "cli", Config: shellAgent("test -f spec.txt && echo fixed > fixed.txt; echo weakened > spec.txt; " + complete)},
+		core.AgentConfig{ID: "idler", Type: "cli", Config: shellAgent(complete)},
+	)
+	cfg.TDD.TestAuthor = "author"
+
+	// The tests only exist once the author writes them, and only pass once they are unchanged and the fix is made
+	var baselineFailed bool
+	runner := core.CommandRunnerFunc(func(cmd *exec.Cmd) error {
+		spec, _ := os.ReadFile(filepath.Join(cmd.Dir, "spec.txt"))
+		if string(spec) == "expected\n" && fileExists(filepath.Join(cmd.Dir, "fixed.txt")) {
+			_, err := fmt.Fprintln(cmd.Stdout, "ok\texample\t0.1s")
+			return err
+		}
+		if len(spec) > 0 && !fileExists(filepath.Join(cmd.Dir, "fixed.txt")) {
+			baselineFailed = true
+		}
+		_, _ = fmt.Fprintln(cmd.Stdout, "FAIL\texample\t0.1s")
+		return errors.New("exit status 1")
+	})
+
+	// The tests are committed, which needs an identity
+	repo := newRepo(t)
+	for _, args := range [][]string{{"config", "user.name", "test"}, {"config", "user.email", "test@example.com"}} {
+		require.NoError(t, exec.Command("git", append([]string{"-C", repo}, args...)...).Run())
+	}
+	var output strings.Builder
+	opts := Options{Repo: repo, Deterministic: true, Runner: runner, Output: &output, Apply: true}
+	result, err := Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	assert.True(t, baselineFailed, "The baseline tests include the author's failing tests")
+	assert.Equal(t, "fixer", result.Best.AgentID)
+	assert.True(t, result.Solved())
+	assert.Len(t, result.Candidates, 2, "The test author doesn't compete")
+	assert.NotContains(t, result.Best.Diff, "spec.txt", "Changes to the author's tests are reverted")
+	assert.Equal(t, []string{"spec.txt"}, result.Best.PathViolations)
+	assert.Contains(t, output.String(), "author wrote failing tests in spec.txt\n")
+
+	// Applying the patch brings the tests along
+	for file, want := range map[string]string{"spec.txt": "expected\n", "fixed.txt": "fixed\n"} {
+		content, err := os.ReadFile(filepath.Join(repo, file))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content))
+	}
+
+	report, err := core.ReadReport(filepath.Join(cfg.ArtifactsDir, result.RunID))
+	require.NoError(t, err)
+	assert.Equal(t, "author", report.TestAuthor)
+	assert.Equal(t, []string{"spec.txt"}, report.TestFiles)
+	assert.FileExists(t, filepath.Join(cfg.ArtifactsDir, result.RunID, "author.patch"))
+
+	// Rolling back what the run applied takes the tests away too
+	record, err := core.ReadApplyRecord(filepath.Join(cfg.ArtifactsDir, result.RunID))
+	require.NoError(t, err)
+	assert.Equal(t, "fixer", record.Agent)
+	require.True(t, record.Applied())
+	require.NoError(t, gitutil.RollBack(repo, record.Before))
+	assert.NoFileExists(t, filepath.Join(repo, "spec.txt"))
+	assert.NoFileExists(t, filepath.Join(repo, "fixed.txt"))
+
+	// A test author given for the run must be a configured agent
+	opts.TestAuthor = "writer"
+	_, err = Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	assert.ErrorContains(t, err, "tdd.test_author 'writer' is not a configured agent")
+}
+
+// TestRunInterrupted checks that interrupting a run asks agents to stop, and keeps the work of those killed once their
+// grace period is over
+func TestRunInterrupted(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	working := `echo '{"type":"thinking","payload":{"content":"working"}}'; `
+	cooperative := shellAgent(working + `read line; case "$line" in *'"cancel"'*) echo saved > fixed.txt;; esac; echo '{"type":"complete"}'`)
+	cooperative["stdin_events"] = true
+	stubborn := shellAgent(working + `echo partial > fixed.txt; sleep 30`)
+	stubborn["stdin_events"] = true
+	cfg := testConfig(t,
+		core.AgentConfig{ID: "cooperative", Type: "cli", Config: cooperative},
+		core.AgentConfig{ID: "stubborn", Type: "cli", Config: stubborn},
+	)
+	cfg.Limits.CancelGraceSeconds = 1
+
+	// The run is interrupted once both agents are at work
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	busy := make(map[string]bool)
+	opts := Options{
+		Repo:   newRepo(t),
+		Runner: fixedTests(func(string) {}),
+		Output: io.Discard,
+		OnEvent: func(event *protocol.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			if event.Type == protocol.EventTypeThinking {
+				busy[event.AgentID] = true
+			}
+			if len(busy) == 2 {
+				cancel()
+			}
+		},
+	}
+	started := time.Now()
+	result, err := Run(ctx, cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(started), 20*time.Second, "The stubborn agent is killed after its grace period")
+
+	candidates := make(map[string]*core.PatchResult)
+	for _, candidate := range result.Candidates {
+		candidates[candidate.AgentID] = candidate
+	}
+	require.Len(t, candidates, 2)
+	assert.Contains(t, candidates["cooperative"].Diff, "+saved", "The cooperative agent wrapped up when asked")
+	assert.Empty(t, candidates["cooperative"].Failure)
+	assert.Contains(t, candidates["stubborn"].Diff, "+partial", "The killed agent's work is kept")
+}
+
+// TestRunPatchFiles checks a patch file competes with the agents, under the same tests
+func TestRunPatchFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	cfg := testConfig(t,
+		core.AgentConfig{ID: "guesser", Type: "cli", Config: shellAgent(`echo attempt > attempt.txt; echo '{"type":"complete"}'`)},
+	)
+	cfg.Samples = 2
+	cfg.Scoring = core.DefaultScoringWeights
+	file := filepath.Join(t.TempDir(), "human.patch")
+	require.NoError(t, os.WriteFile(file, []byte("diff --git a/fixed.txt b/fixed.txt\nnew file mode 100644\n--- /dev/null\n+++ b/fixed.txt\n@@ -0,0 +1 @@\n+fixed\n"), 0644))
+
+	opts := Options{Repo: newRepo(t), Deterministic: true, Runner: fixedTests(func(string) {}), Output: io.Discard, PatchFiles: []string{file}}
+	result, err := Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "patch-human", result.Best.AgentID)
+	assert.True(t, result.Solved())
+	assert.Len(t, result.Candidates, 3, "The patch file is applied once, not once per sample")
+
+	opts.PatchFiles = []string{filepath.Join(t.TempDir(), "missing.patch")}
+	_, err = Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), opts)
+	assert.ErrorContains(t, err, "missing.patch")
+}
+
+// TestRunStack checks patches fixing different parts of a task are stacked, leaving out one that conflicts
+func TestRunStack(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	complete := `echo '{"type":"complete"}'`
+	cfg := testConfig(t,
+		core.AgentConfig{ID: "conflicting", Type: "cli", Config: shellAgent("echo mine > part1.txt; " + complete)},
+		core.AgentConfig{ID: "first", Type: "cli", Config: shellAgent("echo fixed > part1.txt; " + complete)},
+		core.AgentConfig{ID: "second", Type: "cli", Config: shellAgent("echo fixed > part2.txt; " + complete)},
+	)
+
+	// Each part of the task has a package whose tests pass once the part's file exists
+	runner := core.CommandRunnerFunc(func(cmd *exec.Cmd) error {
+		failed := false
+		for _, part := range []string{"part1", "part2"} {
+			status := "ok  "
+			if !fileExists(filepath.Join(cmd.Dir, part+".txt")) {
+				status, failed = "FAIL", true
+			}
+			fmt.Fprintf(cmd.Stdout, "%s\texample/%s\t0.1s\n", status, part)
+		}
+		if failed {
+			return errors.New("exit status 1")
+		}
+		return nil
+	})
+
+	var output strings.Builder
+	opts := Options{Repo: newRepo(t), Deterministic: true, Runner: runner, Output: &output, Stack: 3}
+	result, err := Run(context.Background(), cfg, core.Task{Prompt: "Fix both parts"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "conflicting", result.Best.AgentID, "Tied patches rank by agent ID")
+	assert.Equal(t, []string{"second"}, result.Best.Stacked, "The patch conflicting with the best one is left out")
+	assert.True(t, result.Solved())
+	assert.Contains(t, result.Best.Diff, "part1.txt")
+	assert.Contains(t, result.Best.Diff, "part2.txt")
+	assert.Contains(t, output.String(), "Stacked: second\n")
+
+	report, err := core.ReadReport(filepath.Join(cfg.ArtifactsDir, result.RunID))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second"}, report.Stacked)
+	assert.Len(t, report.Candidates, 3)
+
+	// Without stacking the best patch stands alone
+	opts.Stack = 0
+	result, err = Run(context.Background(), cfg, core.Task{Prompt: "Fix both parts"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	assert.Empty(t, result.Best.Stacked)
+	assert.False(t, result.Solved())
+}
+
+// TestRunStackSkipsFailedEvaluation checks a patch whose stack can't be evaluated is left out, and stacking goes on
+func TestRunStackSkipsFailedEvaluation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	// Each large patch's diff is within the limit, but both stacked together are over it, so their diff can't be read
+	complete := `echo '{"type":"complete"}'`
+	filler := `seq 600 > filler-$0.txt; `
+	cfg := testConfig(t,
+		core.AgentConfig{ID: "first", Type: "cli", Config: shellAgent(strings.ReplaceAll(filler, "$0", "first") + "echo fixed > part1.txt; " + complete)},
+		core.AgentConfig{ID: "large", Type: "cli", Config: shellAgent(strings.ReplaceAll(filler, "$0", "large") + "echo fixed > part2.txt; " + complete)},
+		core.AgentConfig{ID: "small", Type: "cli", Config: shellAgent("echo fixed > part2.txt; " + complete)},
+	)
+	cfg.DiffLimits.MaxBytes = 4000
+
+	runner := core.CommandRunnerFunc(func(cmd *exec.Cmd) error {
+		failed := false
+		for _, part := range []string{"part1", "part2"} {
+			status := "ok  "
+			if !fileExists(filepath.Join(cmd.Dir, part+".txt")) {
+				status, failed = "FAIL", true
+			}
+			fmt.Fprintf(cmd.Stdout, "%s\texample/%s\t0.1s\n", status, part)
+		}
+		if failed {
+			return errors.New("exit status 1")
+		}
+		return nil
+	})
+
+	opts := Options{Repo: newRepo(t), Deterministic: true, Runner: runner, Output: io.Discard, Stack: 3}
+	result, err := Run(context.Background(), cfg, core.Task{Prompt: "Fix both parts"}, core.NewRunID(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "first", result.Best.AgentID)
+	assert.Equal(t, []string{"small"}, result.Best.Stacked, "The patch whose stack failed to evaluate is left out")
+	assert.True(t, result.Solved())
+	assert.NotContains(t, result.Best.Diff, "filler-large.txt")
+}
+
+// TestRunEvaluatesAsAgentsFinish checks a patch is tested as soon as its agent finishes, while the others still run
+func TestRunEvaluatesAsAgentsFinish(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping run test that uses git in short mode")
+	}
+
+	// The slow agent waits for the fast agent's patch to be tested, and notes whether it was
+	mark := filepath.Join(t.TempDir(), "tested")
+	complete := `echo '{"type":"complete"}'`
+	cfg := testConfig(t,
+		core.AgentConfig{ID: "fast", Type: "cli", Config: shellAgent("echo fixed > fixed.txt; " + complete)},
+		core.AgentConfig{ID: "slow", Type: "cli", Config: shellAgent(fmt.Sprintf(`for i in $(seq 100); do [ -f %[1]s ] && break; sleep 0.1; done; [ -f %[1]s ] && echo seen > seen.txt; %[2]s`, mark, complete))},
+	)
+	runner := fixedTests(func(dir string) {
+		if fileExists(filepath.Join(dir, "fixed.txt")) {
+			_ = os.WriteFile(mark, nil, 0644)
+		}
+	})
+
+	result, err := Run(context.Background(), cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), Options{Repo: newRepo(t), Runner: runner, Output: io.Discard})
+	require.NoError(t, err)
+	assert.Equal(t, "fast", result.Best.AgentID)
+	require.Len(t, result.Candidates, 2)
+	for _, candidate := range result.Candidates {
+		if candidate.AgentID == "slow" {
+			assert.Contains(t, candidate.Diff, "seen.txt", "The fast agent's patch is tested before the slow agent finishes")
+		}
+	}
+}
+
+// newRepo returns a git repository with one empty commit
+func newRepo(t *testing.T) string {
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	return repo
+}
+
+// testConfig returns a configuration of agents with worktrees and artifacts in temporary directories
+func testConfig(t *testing.T, agents ...core.AgentConfig) *core.Config {
+	return &core.Config{
+		WorkingDir:     filepath.Join(t.TempDir(), "worktrees"),
+		ArtifactsDir:   filepath.Join(t.TempDir(), "runs"),
+		TestCommand:    "go test ./...",
+		TimeoutSeconds: 30,
+		Agents:         agents,
+	}
+}
+
+// shellAgent returns the configuration of a CLI agent that runs script in its worktree
+func shellAgent(script string) map[string]interface{} {
+	return map[string]interface{}{"command": "sh", "args": []interface{}{"-c", script}, "worktree_flag": ""}
+}
+
+// fixedTests returns a runner of tests that pass once fixed.txt exists and take no time, telling tested where they ran
+func fixedTests(tested func(dir string)) core.CommandRunner {
+	return core.CommandRunnerFunc(func(cmd *exec.Cmd) error {
+		tested(cmd.Dir)
+		if fileExists(filepath.Join(cmd.Dir, "fixed.txt")) {
+			_, err := fmt.Fprintln(cmd.Stdout, "ok\texample\t0.1s")
+			return err
+		}
+		_, _ = fmt.Fprintln(cmd.Stdout, "FAIL\texample\t0.1s")
+		return errors.New("exit status 1")
+	})
+}
+
+// TestRegisterAdapters checks that adapters are registered correctly
+func TestRegisterAdapters(t *testing.T) {
+	registry := adapter.NewRegistry()
+	RegisterAdapters(registry)
+
+	// Check registered types
+	types := registry.RegisteredTypes()
+	require.Contains(t, types, "cli", "CLI adapter type should be registered")
+	require.Contains(t, types, "amp", "AMP adapter type should be registered")
+	require.Contains(t, types, "codex", "Codex adapter type should be registered")
+	require.Contains(t, types, "claude", "Claude adapter type should be registered")
+
+	// Create a test configuration for a generic CLI adapter only
+	cfg := adapter.Config{
+		ID:   "generic",
+		Type: "cli",
+		AdapterConfig: map[string]interface{}{
+			"command": "echo", // Use echo as it's likely to exist in any test environment
+			"args":    []interface{}{"test"},
+		},
+	}
+
+	// Test creating a generic adapter
+	adpt, err := registry.Create(cfg)
+	require.NoError(t, err, "Failed to create adapter: %s", cfg.ID)
+	require.NotNil(t, adpt, "Adapter should not be nil: %s", cfg.ID)
+
+	// Clean up - make sure we call shutdown
+	err = adpt.Shutdown()
+	require.NoError(t, err, "Failed to shutdown adapter: %s", cfg.ID)
+}
+
+// TestStreamEvents tests events from a channel reach every sink
+func TestStreamEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	// Create event channel with some test events
+	eventCh := make(chan *protocol.Event, 3)
+	eventCh <- protocol.NewEvent(protocol.EventTypeThinking, "test-agent", 1)
+	eventCh <- protocol.NewEvent(protocol.EventTypeAction, "test-agent", 2)
+	eventCh <- protocol.NewEvent(protocol.EventTypeComplete, "test-agent", 3)
+	close(eventCh)
+
+	// Stream events to a sink that keeps them and one that counts them
+	var events []*protocol.Event
+	keep := eventSinkFunc(func(event *protocol.Event) { events = append(events, event) })
+	summary := core.NewEventSummary()
+	count := streamEvents(ctx, slog.Default(), eventCh, keep, summary)
+
+	// Check results
+	assert.Equal(t, 3, count, "Should stream all events")
+	assert.Equal(t, 3, summary.Count(), "Every sink should see every event")
+	assert.Len(t, events, 3, "Should stream all events")
+	assert.Equal(t, protocol.EventTypeThinking, events[0].Type)
+	assert.Equal(t, protocol.EventTypeAction, events[1].Type)
+	assert.Equal(t, protocol.EventTypeComplete, events[2].Type)
+}
+
+// TestStreamEventsWithCancel tests that streaming events stops on context cancellation
+func TestStreamEventsWithCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+
+	// Create event channel that won't be closed
+	eventCh := make(chan *protocol.Event, 3) // Buffered channel to prevent blocking
+
+	// Send a couple of events
+	eventCh <- protocol.NewEvent(protocol.EventTypeThinking, "test-agent", 1)
+	eventCh <- protocol.NewEvent(protocol.EventTypeAction, "test-agent", 2)
+
+	// Cancel in a goroutine after a short delay
+	go func() {
+		time.Sleep(50 * time.Millisecond) // Shorter delay
+		cancel()
+	}()
+
+	// Stream events (should return when context is cancelled)
+	count := streamEvents(ctx, slog.Default(), eventCh)
+
+	// Check results
+	assert.Equal(t, 2, count, "Should stream events until cancellation")
+
+	// Explicitly close the channel to clean up
+	close(eventCh)
+}
+
+// TestRunWithInvalidConfig tests error handling for invalid configuration
+func TestRunWithInvalidConfig(t *testing.T) {
+	// Create an invalid configuration with non-existent directory
+	tempDir := filepath.Join(os.TempDir(), "non-existent-directory-"+time.Now().Format("20060102150405"))
+	cfg := &core.Config{
+		WorkingDir:     tempDir,
+		ArtifactsDir:   t.TempDir(),
+		TestCommand:    "echo 'All tests passed'",
+		TimeoutSeconds: 1, // Short timeout
+		Agents:         []core.AgentConfig{},
+	}
+
+	// Create a context with short timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	// Run should return an error (no agents configured)
+	_, err := Run(ctx, cfg, core.Task{Prompt: "Fix the bug"}, core.NewRunID(), Options{})
+	assert.Error(t, err, "Run should return an error with invalid configuration")
+}
+
+// TestConfigureEventBuffer tests an agent's event buffer settings are applied and checked
+func TestConfigureEventBuffer(t *testing.T) {
+	cliAdapter := cli.New("chatty", "chatty-agent", nil)
+	require.NoError(t, configureEventBuffer(cliAdapter, map[string]interface{}{}))
+	assert.Equal(t, cli.DefaultEventBuffer, cliAdapter.EventStats().Buffer)
+
+	require.NoError(t, configureEventBuffer(cliAdapter, map[string]interface{}{"event_buffer": 1024, "event_overflow": "drop"}))
+	assert.Equal(t, 1024, cliAdapter.EventStats().Buffer)
+
+	assert.Error(t, configureEventBuffer(cliAdapter, map[string]interface{}{"event_buffer": 0}))
+	assert.Error(t, configureEventBuffer(cliAdapter, map[string]interface{}{"event_buffer": "lots"}))
+	assert.Error(t, configureEventBuffer(cliAdapter, map[string]interface{}{"event_overflow": "discard"}))
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// HookEnv returns what every hook of a run is told: the run, its repository and base ref, and its artifacts
+func HookEnv(worktreeManager *gitutil.WorktreeManager, artifacts *core.RunWriter, baseRef string) core.HookEnv {
+	return core.HookEnv{RunID: worktreeManager.RunID(), Repo: worktreeManager.RepoPath(), BaseRef: baseRef, Artifacts: artifacts.Dir()}
+}
+
+// RunHooks runs the commands configured for a point in a run from dir, if there are any
+func RunHooks(ctx context.Context, logger *slog.Logger, cfg *core.Config, hook, dir string, env core.HookEnv) error {
+	if len(cfg.Hooks.Commands(hook)) == 0 {
+		return nil
+	}
+	logger.Info("running hooks", "hook", hook, "dir", dir)
+	return cfg.Hooks.Run(ctx, hook, dir, env)
+}
+
+// agentHooks runs the commands configured for a point in a run from an agent's worktree
+func agentHooks(ctx context.Context, logger *slog.Logger, cfg *core.Config, hook string, env core.HookEnv, agentID, worktreePath string) error {
+	env.Agent, env.Worktree = agentID, worktreePath
+	return RunHooks(ctx, logger, cfg, hook, worktreePath, env)
+}
+
+// PrepareEvaluations has the arbitrator run the pre_evaluate hooks in each patch's worktree before testing it
+func PrepareEvaluations(arbitrator *core.Arbitrator, logger *slog.Logger, cfg *core.Config, env core.HookEnv) {
+	arbitrator.SetPreEvaluateHook(func(ctx context.Context, agentID, worktreePath string) error {
+		return agentHooks(ctx, logger.With("agent", agentID), cfg, core.HookPreEvaluate, env, agentID, worktreePath)
+	})
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// Agent states reported during a run
+const (
+	AgentPending  = "pending"
+	AgentStarting = "starting"
+	AgentRunning  = "running"
+	AgentDone     = "done"
+	AgentFailed   = "failed"
+	AgentStopped  = "stopped"
+)
+
+// Progress is told what agents are doing during a run
+// Implementations must be safe for concurrent use since every agent reports from its own goroutine
+type Progress interface {
+	// Start is called before agents start; usage reports token usage of agents still running
+	Start(usage func() map[string]*core.TokenCounter)
+
+	// Stop is called once every agent has finished
+	Stop()
+
+	// SetStatus records an agent's state, one of the Agent* constants
+	SetStatus(agentID, status string)
+
+	// SetSnippet replaces the description of what an agent is doing
+	SetSnippet(agentID, snippet string)
+
+	// SetUsage records an agent's final token usage and spend
+	SetUsage(agentID string, counter *core.TokenCounter)
+
+	// TrackEvent records an event emitted by an agent
+	TrackEvent(event *protocol.Event)
+}
+
+// NoProgress ignores progress, leaving the log messages of the run in charge
+type NoProgress struct{}
+
+func (NoProgress) Start(func() map[string]*core.TokenCounter) {}
+func (NoProgress) Stop()                                      {}
+func (NoProgress) SetStatus(string, string)                   {}
+func (NoProgress) SetSnippet(string, string)                  {}
+func (NoProgress) SetUsage(string, *core.TokenCounter)        {}
+func (NoProgress) TrackEvent(*protocol.Event)                 {}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// excludeFailingAgents smoke tests the agents of adapters and removes the ones that fail from adapters, printing
+// how each did to opts' output; it fails if no agent passes
+// The smoke test runs on adapters of its own, so the run's adapters start fresh
+func excludeFailingAgents(ctx context.Context, logger *slog.Logger, opts Options, registry *adapter.Registry, cfg *core.Config, limitsByAgent map[string]core.ResourceLimits, adapters map[string]adapter.Adapter, worktreeManager *gitutil.WorktreeManager, baseRef string) error {
+	// Patch agents only apply their patch files, so there is nothing to check
+	checks, err := createAdapters(registry, cfg, limitsByAgent, func(id string) bool {
+		_, ok := adapters[id]
+		return ok && !cfg.IsPatchAgent(id)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("smoke testing agents", "count", len(checks), "timeout", cfg.SmokeTest.Timeout())
+	failures := smokeTest(ctx, logger, cfg.SmokeTest, checks, worktreeManager, baseRef)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fmt.Fprintln(opts.output())
+	fmt.Fprint(opts.output(), core.FormatSmokeTest(agentOrder(cfg, checks), failures))
+
+	progress := opts.progress()
+	for id, failure := range failures {
+		logger.Warn("leaving out agent that failed the smoke test", "agent", id, "reason", failure)
+		progress.SetStatus(id, AgentFailed)
+		progress.SetSnippet(id, "failed the smoke test")
+		delete(adapters, id)
+	}
+	if len(adapters) == 0 {
+		return errors.New("every agent failed the smoke test")
+	}
+	return nil
+}
+
+// smokeTest gives every agent the smoke test's task at once, each in a worktree of its own that is removed
+// afterwards, and returns why each agent that failed did
+func smokeTest(ctx context.Context, logger *slog.Logger, smoke core.SmokeTestConfig, adapters map[string]adapter.Adapter, worktreeManager *gitutil.WorktreeManager, baseRef string) map[string]string {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failures := make(map[string]string)
+
+	for id, adpt := range adapters {
+		wg.Add(1)
+		go func(id string, adpt adapter.Adapter) {
+			defer wg.Done()
+			if failure := smokeTestAgent(ctx, logger.With("agent", id), smoke, id, adpt, worktreeManager, baseRef); failure != "" {
+				mu.Lock()
+				failures[id] = failure
+				mu.Unlock()
+			}
+		}(id, adpt)
+	}
+
+	wg.Wait()
+	return failures
+}
+
+// smokeTestAgent gives one agent the smoke test's task and returns why it failed, or "" if it passed
+func smokeTestAgent(ctx context.Context, logger *slog.Logger, smoke core.SmokeTestConfig, id string, adpt adapter.Adapter, worktreeManager *gitutil.WorktreeManager, baseRef string) string {
+	worktreePath, err := worktreeManager.CreateWorktree(id+"-smoke", baseRef)
+	if err != nil {
+		return fmt.Sprintf("failed to create its worktree: %v", err)
+	}
+	defer func() {
+		if err := worktreeManager.RemoveWorktree(worktreePath); err != nil {
+			logger.Warn("failed to remove smoke test worktree", "path", worktreePath, "error", err)
+		}
+	}()
+
+	smokeCtx, cancel := context.WithTimeout(ctx, smoke.Timeout())
+	defer cancel()
+	eventCh, err := adpt.Start(smokeCtx, worktreePath, smoke.Task())
+	if err != nil {
+		return core.SmokeTestFailure(err, nil, "", "")
+	}
+
+	var events []*protocol.Event
+	streamEvents(smokeCtx, logger, eventCh, eventSinkFunc(func(event *protocol.Event) {
+		events = append(events, event)
+	}))
+	if err := adpt.Shutdown(); err != nil {
+		logger.Error("failed to shut down agent", "error", err)
+	}
+
+	termination := ""
+	if smokeCtx.Err() == context.DeadlineExceeded {
+		termination = fmt.Sprintf("time limit exceeded: didn't finish within %v", smoke.Timeout())
+	}
+	diff, err := worktreeManager.GetDiff(worktreePath)
+	if err != nil {
+		return fmt.Sprintf("failed to read its changes: %v", err)
+	}
+	return core.SmokeTestFailure(nil, events, termination, diff)
+}
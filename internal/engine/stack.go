@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/brettsmith212/orchestrator/internal/audit"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// stackPatches applies the best of the ranked patches to a worktree of its own, then each other patch in rank order
+// on top of it, running the tests after each. A patch is kept only if it applies cleanly and the tests improve, and
+// stacking stops once maxPatches are kept or no test fails. A patch whose stack can't be evaluated is logged and left
+// out. It returns the best patch with the kept ones stacked on it
+func stackPatches(ctx context.Context, logger *slog.Logger, arbitrator *core.Arbitrator, worktreeManager *gitutil.WorktreeManager, baseRef string, ranked []*core.PatchResult, maxPatches int) (*core.PatchResult, error) {
+	best := ranked[0]
+	worktreePath, err := worktreeManager.CreateWorktree(best.AgentID+"-stacked", baseRef)
+	if err != nil {
+		return nil, err
+	}
+	audit.Record(ctx, audit.WorktreeCreated, "agent", best.AgentID+"-stacked", "path", worktreePath, "base_ref", baseRef)
+	if err := gitutil.ApplyPatch(worktreePath, best.Diff); err != nil {
+		return nil, fmt.Errorf("failed to apply the best patch: %w", err)
+	}
+
+	stacked := best
+	for _, candidate := range ranked[1:] {
+		if len(stacked.Stacked)+1 >= maxPatches || !core.NeedsRefinement(stacked) {
+			break
+		}
+		if !core.Stackable(candidate) {
+			continue
+		}
+
+		// A patch that conflicts with the stack, or doesn't help it, is left out
+		before, err := gitutil.WorkingTreeID(worktreePath)
+		if err != nil {
+			return nil, err
+		}
+		if err := gitutil.ApplyPatchOnTop(worktreePath, candidate.Diff); err != nil {
+			logger.Info("not stacking patch", "agent", candidate.AgentID, "reason", err)
+			continue
+		}
+		evaluated, err := evaluateStack(ctx, arbitrator, worktreeManager, worktreePath, best)
+		improves := false
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil:
+			logger.Warn("not stacking patch", "agent", candidate.AgentID, "reason", "failed to evaluate the stack", "error", err)
+		case !core.StackImproves(stacked.TestResults, evaluated.TestResults):
+			logger.Info("not stacking patch", "agent", candidate.AgentID, "reason", "the tests don't improve")
+		default:
+			improves = true
+		}
+		if !improves {
+			if err := gitutil.RestoreWorkingTree(worktreePath, before); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		stacked = core.StackedResult(best, evaluated, append(append([]string(nil), stacked.Stacked...), candidate.AgentID))
+		logger.Info("stacked patch", "agent", candidate.AgentID, "tests_failed", evaluated.TestResults.FailedTests, "score", evaluated.Score)
+	}
+	return stacked, nil
+}
+
+// evaluateStack scores the patches stacked in a worktree as the best patch's
+func evaluateStack(ctx context.Context, arbitrator *core.Arbitrator, worktreeManager *gitutil.WorktreeManager, worktreePath string, best *core.PatchResult) (*core.PatchResult, error) {
+	diff, err := worktreeManager.GetDiff(worktreePath)
+	if err != nil {
+		return nil, err
+	}
+	return arbitrator.EvaluatePatch(ctx, best.AgentID, worktreePath, diff, best.Events)
+}
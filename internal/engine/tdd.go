@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/brettsmith212/orchestrator/internal/adapter"
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+)
+
+// writeFailingTests has the test author write failing tests for the task in a worktree at baseRef, and commits them
+// on top of baseRef in repo. It returns the commit the other agents start from, and the test author's patch
+func writeFailingTests(ctx context.Context, logger *slog.Logger, opts Options, artifacts *core.RunWriter, registry *adapter.Registry, cfg *core.Config, limitsByAgent map[string]core.ResourceLimits, limits core.ResourceLimits, worktreeManager *gitutil.WorktreeManager, repo, baseRef string, task core.Task, runID string) (string, *core.PatchDetails, error) {
+	author := cfg.TDD.TestAuthor
+	prompt, err := cfg.TDD.TestAuthorPrompt(promptData(cfg, task, runID, repo, nil, nil, ""))
+	if err != nil {
+		return "", nil, err
+	}
+	adapters, err := createAdapters(registry, cfg, limitsByAgent, func(id string) bool { return id == author })
+	if err != nil {
+		return "", nil, err
+	}
+
+	logger.Info("writing failing tests", "agent", author)
+	authored, err := runAgents(ctx, logger, opts, nil, artifacts, nil, adapters, limitsByAgent, limits, cfg, worktreeManager, baseRef, agentPrompts{prompt: prompt}, nil, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("error writing tests: %w", err)
+	}
+	tests := authored[author]
+	switch {
+	case tests == nil:
+		return "", nil, fmt.Errorf("test author %s didn't run", author)
+	case tests.Failure != "":
+		return "", nil, fmt.Errorf("test author %s failed to write tests: %s: %s", author, tests.Failure, tests.FailureMessage)
+	case tests.Termination != "":
+		return "", nil, fmt.Errorf("test author %s was stopped before it wrote its tests: %s", author, tests.Termination)
+	case strings.TrimSpace(tests.Diff) == "":
+		return "", nil, fmt.Errorf("test author %s wrote no tests", author)
+	}
+
+	commit, err := gitutil.CommitPatch(repo, baseRef, tests.Diff, core.TestsCommitMessage)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to commit the tests %s wrote: %w", author, err)
+	}
+	logger.Info("wrote failing tests", "agent", author, "files", core.TestFiles(tests.Diff), "commit", commit)
+	return commit, tests, nil
+}
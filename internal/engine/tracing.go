@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/trace"
+)
+
+// tracingEndpoint returns the collector runs are traced to, or "" if tracing is off
+// The standard OTEL_EXPORTER_OTLP_ENDPOINT variable enables tracing when the configuration doesn't
+func tracingEndpoint(cfg *core.Config) string {
+	if cfg.Tracing.Endpoint != "" {
+		return cfg.Tracing.Endpoint
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+}
+
+// newTracer returns a tracer for a run, or nil if tracing is off
+func newTracer(cfg *core.Config) *trace.Tracer {
+	if tracingEndpoint(cfg) == "" {
+		return nil
+	}
+
+	serviceName := cfg.Tracing.ServiceName
+	if serviceName == "" {
+		serviceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	if serviceName == "" {
+		serviceName = "orchestrator"
+	}
+	return trace.NewTracer(serviceName)
+}
+
+// exportTrace sends a run's trace to the collector, logging rather than failing if it can't be sent
+// It still runs after Ctrl-C, since the trace of an interrupted run shows where the time went
+func exportTrace(ctx context.Context, logger *slog.Logger, cfg *core.Config, runID string, tracer *trace.Tracer) {
+	if tracer == nil {
+		return
+	}
+	if err := tracer.Export(context.WithoutCancel(ctx), tracingEndpoint(cfg), cfg.Tracing.Headers); err != nil {
+		logger.Warn("failed to export trace", "run", runID, "error", err)
+		return
+	}
+	logger.Debug("exported trace", "run", runID, "trace_id", tracer.TraceID())
+}
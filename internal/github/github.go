@@ -0,0 +1,338 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHost is the host of github.com issue URLs
+const DefaultHost = "github.com"
+
+// commentsPerPage is how many comments are requested per page, the API maximum
+const commentsPerPage = 100
+
+// IssueRef identifies an issue or pull request
+type IssueRef struct {
+	// Host is the GitHub host, github.com or a GitHub Enterprise server
+	Host string
+
+	// Owner and Repo name the repository
+	Owner string
+	Repo  string
+
+	// Number is the issue or pull request number
+	Number int
+}
+
+// String returns the reference in owner/repo#number form
+func (r IssueRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+}
+
+// issueURLPattern matches the path of an issue or pull request URL
+var issueURLPattern = regexp.MustCompile(`^/([^/]+)/([^/]+)/(?:issues|pull)/(\d+)/?$`)
+
+// shortRefPattern matches owner/repo#number
+var shortRefPattern = regexp.MustCompile(`^([^/\s]+)/([^/#\s]+)#(\d+)$`)
+
+// ParseIssueRef parses an issue or pull request URL, such as https://github.com/org/repo/issues/123,
+// or the short form org/repo#123
+func ParseIssueRef(s string) (IssueRef, error) {
+	s = strings.TrimSpace(s)
+	if m := shortRefPattern.FindStringSubmatch(s); m != nil {
+		number, _ := strconv.Atoi(m[3])
+		return IssueRef{Host: DefaultHost, Owner: m[1], Repo: m[2], Number: number}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return IssueRef{}, fmt.Errorf("invalid issue %q: expected a URL like https://github.com/org/repo/issues/123 or org/repo#123", s)
+	}
+	m := issueURLPattern.FindStringSubmatch(u.Path)
+	if m == nil {
+		return IssueRef{}, fmt.Errorf("invalid issue URL %q: expected a path like /org/repo/issues/123 or /org/repo/pull/123", s)
+	}
+	number, err := strconv.Atoi(m[3])
+	if err != nil || number <= 0 {
+		return IssueRef{}, fmt.Errorf("invalid issue number in %q", s)
+	}
+	return IssueRef{Host: u.Host, Owner: m[1], Repo: m[2], Number: number}, nil
+}
+
+// Issue is an issue or pull request with its discussion
+type Issue struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+	User    User   `json:"user"`
+
+	// PullRequest is set when the issue is a pull request
+	PullRequest *struct{} `json:"pull_request,omitempty"`
+
+	// Comments are the comments on the issue, oldest first
+	Comments []Comment `json:"-"`
+}
+
+// IsPullRequest reports whether the issue is a pull request
+func (i *Issue) IsPullRequest() bool {
+	return i.PullRequest != nil
+}
+
+// Comment is a comment on an issue or pull request
+type Comment struct {
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+	User    User   `json:"user"`
+
+	// AuthorAssociation is the author's relationship to the repository, e.g. OWNER, COLLABORATOR or NONE
+	AuthorAssociation string `json:"author_association"`
+}
+
+// User is the author of an issue or comment
+type User struct {
+	Login string `json:"login"`
+}
+
+// TokenFromEnv returns the API token from GITHUB_TOKEN or GH_TOKEN, or "" if neither is set
+func TokenFromEnv() string {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GH_TOKEN")
+}
+
+// Client calls the GitHub REST API
+type Client struct {
+	// BaseURL is the API root, e.g. https://api.github.com
+	BaseURL string
+
+	// Token authenticates requests; public repositories can be read without one
+	Token string
+
+	// HTTP sends the requests
+	HTTP *http.Client
+}
+
+// NewClient creates a client for the API of the given host
+// github.com uses api.github.com; other hosts are treated as GitHub Enterprise servers
+func NewClient(host, token string) *Client {
+	baseURL := "https://api.github.com"
+	if host != "" && host != DefaultHost {
+		baseURL = "https://" + host + "/api/v3"
+	}
+	return &Client{BaseURL: baseURL, Token: token, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Issue fetches an issue or pull request and all of its comments
+func (c *Client) Issue(ctx context.Context, ref IssueRef) (*Issue, error) {
+	var issue Issue
+	if err := c.do(ctx, http.MethodGet, c.issuePath(ref), nil, &issue); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+
+	for page := 1; ; page++ {
+		var comments []Comment
+		path := fmt.Sprintf("%s/comments?per_page=%d&page=%d", c.issuePath(ref), commentsPerPage, page)
+		if err := c.do(ctx, http.MethodGet, path, nil, &comments); err != nil {
+			return nil, fmt.Errorf("failed to fetch comments on %s: %w", ref, err)
+		}
+		issue.Comments = append(issue.Comments, comments...)
+		if len(comments) < commentsPerPage {
+			break
+		}
+	}
+
+	return &issue, nil
+}
+
+// CreateComment posts a comment on an issue or pull request and returns its URL
+func (c *Client) CreateComment(ctx context.Context, ref IssueRef, body string) (string, error) {
+	if c.Token == "" {
+		return "", errors.New("commenting requires a token in GITHUB_TOKEN or GH_TOKEN")
+	}
+
+	var comment Comment
+	if err := c.do(ctx, http.MethodPost, c.issuePath(ref)+"/comments", map[string]string{"body": body}, &comment); err != nil {
+		return "", fmt.Errorf("failed to comment on %s: %w", ref, err)
+	}
+	return comment.HTMLURL, nil
+}
+
+// ReviewComment is a comment on a line of a pull request's changes
+type ReviewComment struct {
+	// Path is the file, relative to the repository root
+	Path string `json:"path"`
+
+	// Line is the line of the changed file the comment is on
+	Line int `json:"line"`
+
+	// Side is RIGHT for a line of the changed file
+	Side string `json:"side"`
+
+	// Body is the comment's Markdown
+	Body string `json:"body"`
+}
+
+// CreateReview posts a review that only comments, with comments on lines of the pull request's changes, and
+// returns its URL. GitHub rejects the whole review if any comment is on a line the pull request doesn't change
+func (c *Client) CreateReview(ctx context.Context, ref IssueRef, body string, comments []ReviewComment) (string, error) {
+	if c.Token == "" {
+		return "", errors.New("reviewing requires a token in GITHUB_TOKEN or GH_TOKEN")
+	}
+
+	review := struct {
+		Body     string          `json:"body"`
+		Event    string          `json:"event"`
+		Comments []ReviewComment `json:"comments,omitempty"`
+	}{Body: body, Event: "COMMENT", Comments: comments}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	path := fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews", url.PathEscape(ref.Owner), url.PathEscape(ref.Repo), ref.Number)
+	if err := c.do(ctx, http.MethodPost, path, review, &created); err != nil {
+		return "", fmt.Errorf("failed to review %s: %w", ref, err)
+	}
+	return created.HTMLURL, nil
+}
+
+// Branch is a branch of a repository, such as the head of a pull request
+type Branch struct {
+	// Ref is the branch name
+	Ref string
+
+	// CloneURL is the repository's HTTPS clone URL
+	CloneURL string
+
+	// SHA is the commit the branch points to
+	SHA string
+}
+
+// PullRequestHead fetches the branch a pull request proposes to merge, which may be in a fork
+func (c *Client) PullRequestHead(ctx context.Context, ref IssueRef) (*Branch, error) {
+	var pull struct {
+		Head struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo *struct {
+				CloneURL string `json:"clone_url"`
+			} `json:"repo"`
+		} `json:"head"`
+	}
+	path := fmt.Sprintf("/repos/%s/%s/pulls/%d", url.PathEscape(ref.Owner), url.PathEscape(ref.Repo), ref.Number)
+	if err := c.do(ctx, http.MethodGet, path, nil, &pull); err != nil {
+		return nil, fmt.Errorf("failed to fetch pull request %s: %w", ref, err)
+	}
+	if pull.Head.Repo == nil {
+		return nil, fmt.Errorf("the repository of pull request %s no longer exists", ref)
+	}
+	return &Branch{Ref: pull.Head.Ref, CloneURL: pull.Head.Repo.CloneURL, SHA: pull.Head.SHA}, nil
+}
+
+// Commit status states
+const (
+	StatusPending = "pending"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	StatusError   = "error"
+)
+
+// maxStatusDescription is the longest description GitHub accepts on a commit status
+const maxStatusDescription = 140
+
+// CommitStatus is a status shown beside a commit, and on pull requests whose head it is
+type CommitStatus struct {
+	// State is one of the Status* constants
+	State string `json:"state"`
+
+	// TargetURL is linked from the status, e.g. to a report
+	TargetURL string `json:"target_url,omitempty"`
+
+	// Description is a one-line summary, shortened to what GitHub accepts
+	Description string `json:"description"`
+
+	// Context names the status; a later status with the same context replaces it
+	Context string `json:"context"`
+}
+
+// CreateStatus sets a status on a commit of a repository
+func (c *Client) CreateStatus(ctx context.Context, owner, repo, sha string, status CommitStatus) error {
+	if c.Token == "" {
+		return errors.New("setting a commit status requires a token in GITHUB_TOKEN or GH_TOKEN")
+	}
+
+	if runes := []rune(status.Description); len(runes) > maxStatusDescription {
+		status.Description = string(runes[:maxStatusDescription-1]) + "…"
+	}
+	path := fmt.Sprintf("/repos/%s/%s/statuses/%s", url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(sha))
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, path, status, &created); err != nil {
+		return fmt.Errorf("failed to set status of %s/%s@%s: %w", owner, repo, sha, err)
+	}
+	return nil
+}
+
+// issuePath returns the API path of an issue
+func (c *Client) issuePath(ref IssueRef) string {
+	return fmt.Sprintf("/repos/%s/%s/issues/%d", url.PathEscape(ref.Owner), url.PathEscape(ref.Repo), ref.Number)
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Error responses carry a message explaining what went wrong
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("GitHub API returned %s: %s", resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("GitHub API returned %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse GitHub API response: %w", err)
+	}
+	return nil
+}
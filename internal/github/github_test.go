@@ -0,0 +1,170 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIssueRef(t *testing.T) {
+	tests := []struct {
+		input string
+		want  IssueRef
+	}{
+		{"https://github.com/org/repo/issues/123", IssueRef{Host: "github.com", Owner: "org", Repo: "repo", Number: 123}},
+		{"https://github.com/org/repo/pull/45/", IssueRef{Host: "github.com", Owner: "org", Repo: "repo", Number: 45}},
+		{"https://github.example.com/team/app/issues/7", IssueRef{Host: "github.example.com", Owner: "team", Repo: "app", Number: 7}},
+		{"org/repo.go#9", IssueRef{Host: "github.com", Owner: "org", Repo: "repo.go", Number: 9}},
+	}
+	for _, tc := range tests {
+		ref, err := ParseIssueRef(tc.input)
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, tc.want, ref, tc.input)
+	}
+
+	for _, input := range []string{"", "123", "https://github.com/org/repo", "https://github.com/org/repo/issues/abc", "https://github.com/org/repo/issues/0"} {
+		_, err := ParseIssueRef(input)
+		assert.Error(t, err, input)
+	}
+
+	assert.Equal(t, "org/repo#123", IssueRef{Owner: "org", Repo: "repo", Number: 123}.String())
+}
+
+func TestNewClient(t *testing.T) {
+	assert.Equal(t, "https://api.github.com", NewClient("github.com", "").BaseURL)
+	assert.Equal(t, "https://github.example.com/api/v3", NewClient("github.example.com", "").BaseURL)
+}
+
+func TestClient(t *testing.T) {
+	var posted map[string]string
+	var status CommitStatus
+	var authorization string
+	var review struct {
+		Body     string          `json:"body"`
+		Event    string          `json:"event"`
+		Comments []ReviewComment `json:"comments"`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/org/repo/issues/123", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 123, "title": "Crash on empty input", "body": "Steps to reproduce", "html_url": "https://github.com/org/repo/issues/123", "user": {"login": "alice"}}`)
+	})
+	mux.HandleFunc("GET /repos/org/repo/issues/123/comments", func(w http.ResponseWriter, r *http.Request) {
+		// The first page is full, so the client asks for a second
+		count := commentsPerPage
+		if r.URL.Query().Get("page") == "2" {
+			count = 1
+		}
+		comments := make([]Comment, count)
+		for i := range comments {
+			comments[i] = Comment{Body: fmt.Sprintf("comment %s-%d", r.URL.Query().Get("page"), i), User: User{Login: "bob"}}
+		}
+		_ = json.NewEncoder(w).Encode(comments)
+	})
+	mux.HandleFunc("POST /repos/org/repo/issues/123/comments", func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&posted)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"html_url": "https://github.com/org/repo/issues/123#issuecomment-1"}`)
+	})
+	mux.HandleFunc("POST /repos/org/repo/statuses/abc123", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&status)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+	mux.HandleFunc("GET /repos/org/repo/pulls/124", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"head": {"ref": "fix-crash", "sha": "abc123", "repo": {"clone_url": "https://github.com/alice/repo.git"}}}`)
+	})
+	mux.HandleFunc("POST /repos/org/repo/pulls/124/reviews", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&review)
+		fmt.Fprint(w, `{"id": 1, "html_url": "https://github.com/org/repo/pull/124#pullrequestreview-1"}`)
+	})
+	mux.HandleFunc("GET /repos/org/repo/pulls/125", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"head": {"ref": "gone", "repo": null}}`)
+	})
+	mux.HandleFunc("GET /repos/org/repo/issues/404", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient("github.com", "")
+	client.BaseURL = server.URL
+	ref := IssueRef{Host: "github.com", Owner: "org", Repo: "repo", Number: 123}
+
+	issue, err := client.Issue(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "Crash on empty input", issue.Title)
+	assert.Equal(t, "alice", issue.User.Login)
+	assert.False(t, issue.IsPullRequest())
+	require.Len(t, issue.Comments, commentsPerPage+1)
+	assert.Equal(t, "comment 2-0", issue.Comments[commentsPerPage].Body)
+
+	// Commenting needs a token
+	_, err = client.CreateComment(context.Background(), ref, "Fixed")
+	assert.ErrorContains(t, err, "GITHUB_TOKEN")
+
+	client.Token = "ghp_test"
+	url, err := client.CreateComment(context.Background(), ref, "Fixed")
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/org/repo/issues/123#issuecomment-1", url)
+	assert.Equal(t, "Bearer ghp_test", authorization)
+	assert.Equal(t, map[string]string{"body": "Fixed"}, posted)
+
+	// Pull requests from forks are worked on in the fork
+	head, err := client.PullRequestHead(context.Background(), IssueRef{Owner: "org", Repo: "repo", Number: 124})
+	require.NoError(t, err)
+	assert.Equal(t, &Branch{Ref: "fix-crash", CloneURL: "https://github.com/alice/repo.git", SHA: "abc123"}, head)
+	_, err = client.PullRequestHead(context.Background(), IssueRef{Owner: "org", Repo: "repo", Number: 125})
+	assert.ErrorContains(t, err, "no longer exists")
+
+	// Reviews only comment, on lines of the changed files
+	comments := []ReviewComment{{Path: "db.go", Line: 12, Side: "RIGHT", Body: "drops a table"}}
+	url, err = client.CreateReview(context.Background(), IssueRef{Owner: "org", Repo: "repo", Number: 124}, "Review notes", comments)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/org/repo/pull/124#pullrequestreview-1", url)
+	assert.Equal(t, "COMMENT", review.Event)
+	assert.Equal(t, "Review notes", review.Body)
+	assert.Equal(t, comments, review.Comments)
+
+	// Long descriptions are shortened to what GitHub accepts
+	err = client.CreateStatus(context.Background(), "org", "repo", "abc123", CommitStatus{State: StatusSuccess, Description: strings.Repeat("x", 200), Context: "orchestrator"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusSuccess, status.State)
+	assert.Equal(t, "orchestrator", status.Context)
+	assert.Len(t, []rune(status.Description), maxStatusDescription)
+
+	_, err = client.Issue(context.Background(), IssueRef{Owner: "org", Repo: "repo", Number: 404})
+	assert.ErrorContains(t, err, "404 Not Found: Not Found")
+}
+
+func TestPrompt(t *testing.T) {
+	ref := IssueRef{Owner: "org", Repo: "repo", Number: 123}
+	issue := &Issue{
+		Title:    " Crash on empty input ",
+		Body:     "Running with no input panics.",
+		HTMLURL:  "https://github.com/org/repo/issues/123",
+		User:     User{Login: "alice"},
+		Comments: []Comment{{Body: "Happens on main too.\n", User: User{Login: "bob"}}},
+	}
+
+	prompt := Prompt(ref, issue)
+	assert.True(t, strings.HasPrefix(prompt, "Fix org/repo#123: Crash on empty input\n\n"), prompt)
+	assert.Contains(t, prompt, "GitHub issue org/repo#123 (https://github.com/org/repo/issues/123)")
+	assert.Contains(t, prompt, "Description by @alice:\n\nRunning with no input panics.\n")
+	assert.Contains(t, prompt, "\n@bob:\nHappens on main too.\n")
+
+	issue.PullRequest = &struct{}{}
+	issue.Comments = nil
+	prompt = Prompt(ref, issue)
+	assert.True(t, strings.HasPrefix(prompt, "Address org/repo#123: Crash on empty input\n\n"), prompt)
+	assert.Contains(t, prompt, "GitHub pull request org/repo#123")
+	assert.NotContains(t, prompt, "Comments")
+}
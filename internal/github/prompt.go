@@ -0,0 +1,38 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Prompt builds a task prompt from an issue or pull request and its discussion
+// The first line names the issue, so commit messages made from the prompt link back to it
+func Prompt(ref IssueRef, issue *Issue) string {
+	var sb strings.Builder
+	kind := "issue"
+	if issue.IsPullRequest() {
+		kind = "pull request"
+		fmt.Fprintf(&sb, "Address %s: %s\n\n", ref, strings.TrimSpace(issue.Title))
+	} else {
+		fmt.Fprintf(&sb, "Fix %s: %s\n\n", ref, strings.TrimSpace(issue.Title))
+	}
+
+	fmt.Fprintf(&sb, "Make the changes requested in GitHub %s %s", kind, ref)
+	if issue.HTMLURL != "" {
+		fmt.Fprintf(&sb, " (%s)", issue.HTMLURL)
+	}
+	sb.WriteString(". Its description and discussion follow.\n")
+
+	if body := strings.TrimSpace(issue.Body); body != "" {
+		fmt.Fprintf(&sb, "\nDescription by @%s:\n\n%s\n", issue.User.Login, body)
+	}
+
+	if len(issue.Comments) > 0 {
+		sb.WriteString("\nComments, oldest first:\n")
+		for _, comment := range issue.Comments {
+			fmt.Fprintf(&sb, "\n@%s:\n%s\n", comment.User.Login, strings.TrimSpace(comment.Body))
+		}
+	}
+
+	return sb.String()
+}
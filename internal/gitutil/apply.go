@@ -0,0 +1,114 @@
+package gitutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrDirtyRepo is returned when a patch can't be applied because the repository has uncommitted changes
+var ErrDirtyRepo = errors.New("repository has uncommitted changes")
+
+// IsClean reports whether the repository has no staged, unstaged, or untracked changes
+func IsClean(repoPath string) (bool, error) {
+	cmd := exec.Command("git", "-C", repoPath, "status", "--porcelain")
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to get repository status: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)) == "", nil
+}
+
+// ApplyPatch applies a diff to the working tree of the repository
+// The repository must be clean; if applying fails the working tree is rolled back to HEAD
+func ApplyPatch(repoPath, diff string) error {
+	if strings.TrimSpace(diff) == "" {
+		return errors.New("empty patch")
+	}
+
+	// A "Binary files differ" summary carries no content and can never be applied
+	if hasBinarySummary(diff) {
+		return errors.New("patch contains binary changes without binary data (generate it with git diff --binary)")
+	}
+
+	// Refuse to touch a repository with local changes we might clobber on rollback
+	clean, err := IsClean(repoPath)
+	if err != nil {
+		return err
+	}
+	if !clean {
+		return ErrDirtyRepo
+	}
+
+	// Make sure the patch applies before modifying anything
+	if err := runGitApply(repoPath, diff, "--check"); err != nil {
+		return fmt.Errorf("patch does not apply cleanly: %w", err)
+	}
+
+	if err := runGitApply(repoPath, diff); err != nil {
+		if rollbackErr := rollback(repoPath); rollbackErr != nil {
+			return fmt.Errorf("failed to apply patch: %w (rollback failed: %v)", err, rollbackErr)
+		}
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+
+	return nil
+}
+
+// ApplyPatchOnTop applies a diff to a working tree that may already have changes, such as other patches
+// git apply is atomic, so a patch that doesn't apply cleanly leaves the working tree as it was
+func ApplyPatchOnTop(repoPath, diff string) error {
+	if strings.TrimSpace(diff) == "" {
+		return errors.New("empty patch")
+	}
+	if hasBinarySummary(diff) {
+		return errors.New("patch contains binary changes without binary data (generate it with git diff --binary)")
+	}
+	if err := runGitApply(repoPath, diff); err != nil {
+		return fmt.Errorf("patch does not apply cleanly: %w", err)
+	}
+	return nil
+}
+
+// runGitApply pipes a diff into git apply with the given extra arguments
+// --binary is always passed so binary patches round-trip on older git versions
+func runGitApply(repoPath, diff string, args ...string) error {
+	gitArgs := append([]string{"-C", repoPath, "apply", "--binary"}, args...)
+	cmd := exec.Command("git", gitArgs...)
+	cmd.Stdin = strings.NewReader(diff)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w - %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// hasBinarySummary reports whether a diff elides binary content
+func hasBinarySummary(diff string) bool {
+	for _, line := range strings.Split(diff, "\n") {
+		if binaryFilesRegex.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// rollback restores the working tree to HEAD and removes untracked files
+func rollback(repoPath string) error {
+	if output, err := exec.Command("git", "-C", repoPath, "reset", "--hard", "HEAD").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to reset repository: %w - %s", err, output)
+	}
+
+	if output, err := exec.Command("git", "-C", repoPath, "clean", "-fd").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clean repository: %w - %s", err, output)
+	}
+
+	return nil
+}
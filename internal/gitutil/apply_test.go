@@ -0,0 +1,109 @@
+package gitutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPatch(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping apply test in short mode")
+	}
+
+	// Create a repository and a worktree with a change
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create worktree")
+	makeTestChange(t, worktreePath)
+
+	diff, err := wm.GetDiff(worktreePath)
+	require.NoError(t, err, "Failed to get diff")
+
+	// Apply the diff to the original repository
+	require.NoError(t, ApplyPatch(repoDir, diff), "Failed to apply patch")
+
+	content, err := os.ReadFile(filepath.Join(repoDir, "test-file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Updated content\n", string(content), "Patch should be applied")
+
+	// The repository is now dirty, so a second apply should be refused
+	err = ApplyPatch(repoDir, diff)
+	assert.ErrorIs(t, err, ErrDirtyRepo, "Should refuse to apply to a dirty repository")
+}
+
+func TestApplyPatchBinary(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping apply test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create worktree")
+
+	// Replace the tracked text file with binary content
+	binaryContent := []byte{0x89, 'P', 'N', 'G', 0x00, 0x01, 0x02, 0xff}
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "test-file.txt"), binaryContent, 0644))
+
+	diff, err := wm.GetDiff(worktreePath)
+	require.NoError(t, err, "Failed to get diff")
+	assert.Equal(t, 1, GetDiffStats(diff).BinaryFiles, "Diff should report the binary change")
+
+	// The binary patch should round-trip into the original repository
+	require.NoError(t, ApplyPatch(repoDir, diff), "Failed to apply binary patch")
+
+	content, err := os.ReadFile(filepath.Join(repoDir, "test-file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, binaryContent, content, "Binary content should be applied")
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping apply test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	// Empty patch
+	require.Error(t, ApplyPatch(repoDir, ""), "Should error with empty patch")
+
+	// Patch that doesn't match the repository contents
+	badDiff := `diff --git a/test-file.txt b/test-file.txt
+--- a/test-file.txt
++++ b/test-file.txt
+@@ -1 +1 @@
+-Something else
++Updated content
+`
+	require.Error(t, ApplyPatch(repoDir, badDiff), "Should error with non-applying patch")
+
+	// Binary summaries without content can't be applied
+	summaryDiff := `diff --git a/test-file.txt b/test-file.txt
+Binary files a/test-file.txt and b/test-file.txt differ
+`
+	require.Error(t, ApplyPatch(repoDir, summaryDiff), "Should error with binary summary patch")
+
+	// Repository should be left untouched
+	clean, err := IsClean(repoDir)
+	require.NoError(t, err)
+	assert.True(t, clean, "Repository should still be clean")
+}
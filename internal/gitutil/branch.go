@@ -0,0 +1,119 @@
+package gitutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CommitToBranch creates a new branch at the worktree's HEAD and commits all of its changes
+// Untracked files are included so new files created by an agent are part of the commit
+func CommitToBranch(worktreePath, branch, message string) error {
+	if branch == "" {
+		return errors.New("branch name is required")
+	}
+
+	// Validate the branch name before touching the worktree
+	if output, err := exec.Command("git", "check-ref-format", "--branch", branch).CombinedOutput(); err != nil {
+		return fmt.Errorf("invalid branch name %q: %w - %s", branch, err, output)
+	}
+
+	commands := [][]string{
+		{"checkout", "-b", branch},
+		{"add", "-A"},
+		{"commit", "-m", message},
+	}
+
+	// Clones keep their own refs, so the branch must be pushed back to the original repository
+	if isClone(worktreePath) {
+		commands = append(commands, []string{"push", "--quiet", "origin", "HEAD:refs/heads/" + branch})
+	}
+
+	for _, args := range commands {
+		cmd := exec.Command("git", append([]string{"-C", worktreePath}, args...)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %s failed: %w - %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return nil
+}
+
+// ResolveCommit returns the commit a ref points at
+func ResolveCommit(repoPath, ref string) (string, error) {
+	output, err := exec.Command("git", "-C", repoPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// DeleteBranch deletes a branch if it still points at commit, so work committed to it since is never lost
+func DeleteBranch(repoPath, branch, commit string) error {
+	cmd := exec.Command("git", "-C", repoPath, "update-ref", "-d", "refs/heads/"+branch, commit)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to delete branch %s: %w - %s", branch, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// isClone reports whether a checkout is a standalone clone rather than a linked worktree
+// Linked worktrees have a .git file while clones have a .git directory
+func isClone(path string) bool {
+	info, err := os.Stat(filepath.Join(path, ".git"))
+	return err == nil && info.IsDir()
+}
+
+// CurrentBranch returns the name of the branch checked out in the repository, or "" for a detached HEAD
+func CurrentBranch(repoPath string) (string, error) {
+	output, err := exec.Command("git", "-C", repoPath, "symbolic-ref", "--quiet", "--short", "HEAD").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get current branch: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// DefaultBranch returns the branch work is merged into: origin's default branch if known, otherwise main or master
+func DefaultBranch(repoPath string) (string, error) {
+	if output, err := exec.Command("git", "-C", repoPath, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD").Output(); err == nil {
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	for _, name := range []string{"main", "master"} {
+		if exec.Command("git", "-C", repoPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+name).Run() == nil {
+			return name, nil
+		}
+	}
+	return "", errors.New("no default branch found (origin/HEAD, main, or master)")
+}
+
+// ChangedFiles lists the files changed since the working tree diverged from base, including uncommitted changes
+// Untracked files are not included
+func ChangedFiles(repoPath, base string) ([]string, error) {
+	output, err := exec.Command("git", "-C", repoPath, "merge-base", base, "HEAD").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merge base with %s: %w", base, err)
+	}
+	mergeBase := strings.TrimSpace(string(output))
+
+	output, err = exec.Command("git", "-C", repoPath, "diff", "--name-only", mergeBase).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed files: %w", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,102 @@
+package gitutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitToBranch(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping branch test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create worktree")
+	makeTestChange(t, worktreePath)
+
+	// Invalid branch names are rejected
+	require.Error(t, CommitToBranch(worktreePath, "bad..name", "message"))
+
+	// Commit the change onto a new branch
+	require.NoError(t, CommitToBranch(worktreePath, "orchestrator/test-branch", "Update test file"))
+
+	// The branch should be visible from the original repository
+	output, err := exec.Command("git", "-C", repoDir, "log", "-1", "--format=%s", "orchestrator/test-branch").Output()
+	require.NoError(t, err, "Branch should exist in the original repository")
+	assert.Equal(t, "Update test file", strings.TrimSpace(string(output)))
+}
+
+func TestDeleteBranch(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping branch test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+	head, err := ResolveCommit(repoDir, "HEAD")
+	require.NoError(t, err)
+	require.NoError(t, exec.Command("git", "-C", repoDir, "branch", "orchestrator/fix").Run())
+
+	// A branch that moved on is left alone
+	assert.Error(t, DeleteBranch(repoDir, "orchestrator/fix", strings.Repeat("0", len(head)-1)+"1"))
+	require.NoError(t, DeleteBranch(repoDir, "orchestrator/fix", head))
+	_, err = ResolveCommit(repoDir, "refs/heads/orchestrator/fix")
+	assert.Error(t, err)
+}
+
+func TestChangedFiles(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping branch test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	base, err := DefaultBranch(repoDir)
+	require.NoError(t, err)
+	current, err := CurrentBranch(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, base, current, "A new repository is on its default branch")
+
+	git := func(args ...string) {
+		output, err := exec.Command("git", append([]string{"-C", repoDir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	// Commit one file on a feature branch and leave another change uncommitted
+	git("checkout", "-b", "feature")
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "new-file.txt"), []byte("New\n"), 0644))
+	git("add", "new-file.txt")
+	git("commit", "-m", "Add new file")
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "test-file.txt"), []byte("Changed\n"), 0644))
+
+	current, err = CurrentBranch(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, "feature", current)
+
+	files, err := ChangedFiles(repoDir, base)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-file.txt", "test-file.txt"}, files)
+
+	// A detached HEAD has no branch
+	git("checkout", "--quiet", "--detach")
+	current, err = CurrentBranch(repoDir)
+	require.NoError(t, err)
+	assert.Empty(t, current)
+}
@@ -0,0 +1,143 @@
+package gitutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CloneOptions controls how a remote repository is cloned for orchestration
+type CloneOptions struct {
+	// Depth limits history to the given number of commits (0 for full history)
+	Depth int
+
+	// Filter is a partial clone filter such as "blob:none" (empty for a full clone)
+	// Missing objects are fetched on demand when worktrees check them out
+	Filter string
+
+	// Ref is the branch or tag to check out (empty for the remote's default branch)
+	Ref string
+}
+
+// CachedClonePath returns a stable location for the clone of a URL inside the working directory
+// so repeated runs against the same remote reuse previously fetched objects
+func CachedClonePath(workingDir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(workingDir, "base-"+hex.EncodeToString(sum[:])[:12])
+}
+
+// CloneOrUpdate makes a lightweight local copy of a remote repository at dest
+// If dest already holds a clone, only the requested ref is fetched and checked out
+func CloneOrUpdate(url, dest string, opts CloneOptions) error {
+	if _, err := os.Stat(filepath.Join(dest, ".git")); err == nil {
+		return updateClone(dest, opts)
+	}
+
+	args := []string{"clone", "--quiet"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.Filter != "" {
+		args = append(args, "--filter="+opts.Filter)
+	}
+	if opts.Ref != "" {
+		if err := ValidateRef(opts.Ref); err != nil {
+			return err
+		}
+		args = append(args, "--branch", opts.Ref)
+	}
+	args = append(args, "--end-of-options", url, dest)
+
+	if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		os.RemoveAll(dest)
+		return fmt.Errorf("failed to clone %s: %w - %s", url, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// updateClone fetches the latest state of the ref into an existing clone and checks it out
+func updateClone(dest string, opts CloneOptions) error {
+	ref := opts.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := ValidateRef(ref); err != nil {
+		return err
+	}
+
+	args := []string{"-C", dest, "fetch", "--quiet"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.Filter != "" {
+		args = append(args, "--filter="+opts.Filter)
+	}
+	args = append(args, "--end-of-options", "origin", ref)
+
+	if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to fetch %s: %w - %s", ref, err, strings.TrimSpace(string(output)))
+	}
+
+	cmd := exec.Command("git", "-C", dest, "checkout", "--quiet", "--force", "--detach", "FETCH_HEAD")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to check out %s: %w - %s", ref, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// FetchRef fetches a branch, tag, or commit from the origin of a clone and returns the commit it names
+// A lightweight clone only has the ref it was cloned at, so other refs are fetched when a task starts from them
+func FetchRef(repoPath, ref string, opts CloneOptions) (string, error) {
+	if err := ValidateRef(ref); err != nil {
+		return "", err
+	}
+
+	args := []string{"-C", repoPath, "fetch", "--quiet"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.Filter != "" {
+		args = append(args, "--filter="+opts.Filter)
+	}
+	args = append(args, "--end-of-options", "origin", ref)
+	if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w - %s", ref, err, strings.TrimSpace(string(output)))
+	}
+
+	output, err := exec.Command("git", "-C", repoPath, "rev-parse", "--verify", "FETCH_HEAD^{commit}").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ValidateRef checks a ref is a branch, tag, or commit name that git can't mistake for an option
+// Revision expressions such as HEAD~1 aren't ref names, so they are rejected too
+func ValidateRef(ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid ref %q: must not start with '-'", ref)
+	}
+	if err := exec.Command("git", "check-ref-format", "--allow-onelevel", ref).Run(); err != nil {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	return nil
+}
+
+// IsShallow reports whether a repository has truncated history
+func IsShallow(repoPath string) bool {
+	output, err := exec.Command("git", "-C", repoPath, "rev-parse", "--is-shallow-repository").Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// IsPartial reports whether a repository is a partial clone that fetches objects on demand
+func IsPartial(repoPath string) bool {
+	output, err := exec.Command("git", "-C", repoPath, "config", "--get", "remote.origin.promisor").Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
@@ -0,0 +1,76 @@
+package gitutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneOrUpdate(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping clone test in short mode")
+	}
+
+	// Create a source repository with two commits
+	sourceDir := t.TempDir()
+	initTestRepo(t, sourceDir)
+	makeTestChange(t, sourceDir)
+	require.NoError(t, exec.Command("git", "-C", sourceDir, "commit", "-am", "Second commit").Run())
+
+	// file:// URLs make git honour --depth and --filter for local repositories
+	url := "file://" + sourceDir
+	dest := CachedClonePath(t.TempDir(), url)
+	assert.Equal(t, dest, CachedClonePath(filepath.Dir(dest), url), "Clone path should be stable")
+
+	require.NoError(t, CloneOrUpdate(url, dest, CloneOptions{Depth: 1, Filter: "blob:none"}))
+	assert.True(t, IsShallow(dest), "Clone should be shallow")
+	assert.True(t, IsPartial(dest), "Clone should be partial")
+	assert.False(t, IsShallow(sourceDir), "Source should not be shallow")
+
+	content, err := os.ReadFile(filepath.Join(dest, "test-file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Updated content\n", string(content))
+
+	// Worktrees of the clone fetch what they need
+	wm, err := NewWorktreeManager(dest, t.TempDir())
+	require.NoError(t, err)
+	defer wm.Cleanup()
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create worktree from shallow clone")
+	verifyDirectory(t, worktreePath)
+
+	// A second call updates the existing clone instead of re-cloning
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "test-file.txt"), []byte("Third\n"), 0644))
+	require.NoError(t, exec.Command("git", "-C", sourceDir, "commit", "-am", "Third commit").Run())
+	require.NoError(t, CloneOrUpdate(url, dest, CloneOptions{Depth: 1, Filter: "blob:none"}))
+
+	content, err = os.ReadFile(filepath.Join(dest, "test-file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Third\n", string(content))
+
+	// Branches the shallow clone didn't fetch are fetched by name
+	require.NoError(t, exec.Command("git", "-C", sourceDir, "branch", "feature", "HEAD~1").Run())
+	expected, err := exec.Command("git", "-C", sourceDir, "rev-parse", "feature").Output()
+	require.NoError(t, err)
+	commit, err := FetchRef(dest, "feature", CloneOptions{Depth: 1, Filter: "blob:none"})
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(expected)), commit)
+	_, err = FetchRef(dest, "no-such-branch", CloneOptions{Depth: 1})
+	assert.Error(t, err)
+
+	// A ref is never taken as an option of git fetch
+	pwned := filepath.Join(t.TempDir(), "pwned")
+	_, err = FetchRef(dest, "--upload-pack=touch "+pwned, CloneOptions{})
+	assert.ErrorContains(t, err, "invalid ref")
+	assert.NoFileExists(t, pwned)
+	_, err = FetchRef(dest, "main..evil", CloneOptions{})
+	assert.ErrorContains(t, err, "invalid ref")
+	assert.Error(t, CloneOrUpdate(url, dest, CloneOptions{Ref: "--upload-pack=touch " + pwned}))
+	assert.NoFileExists(t, pwned)
+}
@@ -1,7 +1,7 @@
 package gitutil
 
 import (
-	"bufio"
+	"io"
 	"regexp"
 	"strings"
 )
@@ -19,6 +19,14 @@ type DiffStats struct {
 
 	// HasConflicts indicates if the diff contains merge conflicts
 	HasConflicts bool
+
+	// RenamedFiles is the number of files that were renamed or moved
+	// Renames count towards FilesChanged, but only edits made alongside the move count as lines
+	RenamedFiles int
+
+	// BinaryFiles is the number of changed files with binary content
+	// Binary files count towards FilesChanged but not towards added/removed lines
+	BinaryFiles int
 }
 
 // Constants for diff parsing
@@ -27,6 +35,9 @@ const (
 	RemovedLinePrefix = "-"
 	HunkHeaderPrefix  = "@@"
 	NoNewlineMarker   = "\\ No newline at end of file"
+	BinaryPatchMarker = "GIT binary patch"
+	RenameFromPrefix  = "rename from "
+	RenameToPrefix    = "rename to "
 )
 
 // Regular expressions for diff parsing
@@ -40,6 +51,9 @@ var (
 	// Match timestamp lines that might vary between otherwise identical diffs
 	timestampRegex = regexp.MustCompile(`^(\+\+\+|---) .*\s+\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}`)
 
+	// Match the summary git prints for binary changes without --binary: "Binary files a/x and b/x differ"
+	binaryFilesRegex = regexp.MustCompile(`^Binary files .+ and .+ differ$`)
+
 	// Match index lines that contain SHA hashes 
 	indexLineRegex = regexp.MustCompile(`^index [0-9a-f]+\.\.[0-9a-f]+`)
 )
@@ -48,10 +62,25 @@ var (
 // It removes timestamps, index hashes, and other variable elements
 func NormalizeDiff(diff string) string {
 	var normalized strings.Builder
-	scanner := bufio.NewScanner(strings.NewReader(diff))
+	// Neither reading a string nor writing a builder fails
+	_ = WriteNormalizedDiff(&normalized, strings.NewReader(diff), DefaultMaxDiffLineBytes)
+	return normalized.String()
+}
+
+// WriteNormalizedDiff normalizes a diff read from r as NormalizeDiff does, writing it to w as it goes
+// At most maxLineBytes of any line is held in memory; longer lines are copied through unchanged
+func WriteNormalizedDiff(w io.Writer, r io.Reader, maxLineBytes int) error {
+	scanner := NewDiffScanner(r, maxLineBytes)
+	out := lineWriter{w: w}
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := scanner.Line()
+
+		// Lines this long are content, kept as they are
+		if scanner.Truncated() {
+			out.writeLong(line, scanner)
+			continue
+		}
 
 		// Skip timestamp lines
 		if timestampRegex.MatchString(line) {
@@ -68,42 +97,70 @@ func NormalizeDiff(diff string) string {
 			matches := fileHeaderRegex.FindStringSubmatch(line)
 			if len(matches) >= 3 && matches[1] == matches[2] {
 				filePath := matches[1]
-				normalized.WriteString("diff --git a/" + filePath + " b/" + filePath + "\n")
+				out.writeLine("diff --git a/" + filePath + " b/" + filePath)
 				continue
 			}
 		}
 
 		// Keep the line as is
-		normalized.WriteString(line + "\n")
+		out.writeLine(line)
 	}
 
-	return normalized.String()
+	if out.err != nil {
+		return out.err
+	}
+	return scanner.Err()
 }
 
 // GetDiffStats calculates statistics for a diff
 func GetDiffStats(diff string) DiffStats {
-	stats := DiffStats{}
-
 	// Exit early if diff is empty
 	if diff == "" {
-		return stats
+		return DiffStats{}
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(diff))
+	// Reading a string never fails
+	stats, _ := ReadDiffStats(strings.NewReader(diff), DefaultMaxDiffLineBytes)
+	return stats
+}
+
+// ReadDiffStats calculates statistics for a diff read from r, holding at most maxLineBytes of any line in memory
+// Lines are classified by how they start, so longer lines, such as a minified file's, count like any other
+func ReadDiffStats(r io.Reader, maxLineBytes int) (DiffStats, error) {
+	stats := DiffStats{}
+	scanner := NewDiffScanner(r, maxLineBytes)
 	inFile := false
+	inBinary := false
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := scanner.Line()
 
 		// Check for new file in diff
-		if fileHeaderRegex.MatchString(line) {
+		if !scanner.Truncated() && fileHeaderRegex.MatchString(line) {
 			stats.FilesChanged++
 			inFile = true
+			inBinary = false
+			continue
+		}
+
+		// Rename headers appear before any hunks when diffing with rename detection
+		if inFile && strings.HasPrefix(line, RenameFromPrefix) {
+			stats.RenamedFiles++
+			continue
+		}
+		if inFile && strings.HasPrefix(line, RenameToPrefix) {
+			continue
+		}
+
+		// Binary content is reported separately and never counted as lines
+		if inFile && !inBinary && (line == BinaryPatchMarker || binaryFilesRegex.MatchString(line)) {
+			stats.BinaryFiles++
+			inBinary = true
 			continue
 		}
 
 		// Count added and removed lines
-		if inFile {
+		if inFile && !inBinary {
 			if strings.HasPrefix(line, AddedLinePrefix) && !strings.HasPrefix(line, "+++") {
 				stats.LinesAdded++
 			} else if strings.HasPrefix(line, RemovedLinePrefix) && !strings.HasPrefix(line, "---") {
@@ -119,40 +176,73 @@ func GetDiffStats(diff string) DiffStats {
 		}
 	}
 
-	return stats
+	return stats, scanner.Err()
 }
 
 // RemoveContextLines reduces a diff to just the changed lines, removing context lines
 func RemoveContextLines(diff string) string {
 	var result strings.Builder
-	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner := NewDiffScanner(strings.NewReader(diff), DefaultMaxDiffLineBytes)
+	out := lineWriter{w: &result}
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := scanner.Line()
+
+		// Lines this long are content: keep those that changed
+		if scanner.Truncated() {
+			if strings.HasPrefix(line, AddedLinePrefix) || strings.HasPrefix(line, RemovedLinePrefix) {
+				out.writeLong(line, scanner)
+			}
+			continue
+		}
 
 		// Keep file headers and hunk headers
 		if fileHeaderRegex.MatchString(line) || 
 		   hunkHeaderRegex.MatchString(line) || 
 		   strings.HasPrefix(line, "+++") || 
 		   strings.HasPrefix(line, "---") {
-			result.WriteString(line + "\n")
+			out.writeLine(line)
 			continue
 		}
 
 		// Keep added and removed lines
 		if strings.HasPrefix(line, AddedLinePrefix) || strings.HasPrefix(line, RemovedLinePrefix) {
-			result.WriteString(line + "\n")
+			out.writeLine(line)
 		}
 
 		// Keep "No newline" markers
 		if strings.Contains(line, NoNewlineMarker) {
-			result.WriteString(line + "\n")
+			out.writeLine(line)
 		}
 	}
 
 	return result.String()
 }
 
+// lineWriter writes lines, keeping the first error so a run of writes can be checked once
+type lineWriter struct {
+	w   io.Writer
+	err error
+}
+
+// writeLine writes a line and its newline
+func (lw *lineWriter) writeLine(line string) {
+	if lw.err == nil {
+		_, lw.err = io.WriteString(lw.w, line+"\n")
+	}
+}
+
+// writeLong writes a truncated line: its start, the rest streamed from the scanner, and its newline
+func (lw *lineWriter) writeLong(start string, scanner *DiffScanner) {
+	if lw.err == nil {
+		_, lw.err = io.WriteString(lw.w, start)
+	}
+	if lw.err == nil {
+		lw.err = scanner.WriteRest(lw.w)
+	}
+	lw.writeLine("")
+}
+
 // CompareDiffs compares two normalized diffs for similarity
 // Returns true if diffs are functionally equivalent
 func CompareDiffs(diff1, diff2 string) bool {
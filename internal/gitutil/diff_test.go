@@ -1,9 +1,11 @@
 package gitutil
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Sample diffs for testing
@@ -45,6 +47,44 @@ index ffffeeeee..0000fffff 100644
  line 3
 `
 
+	sampleBinaryDiff = `diff --git a/image.png b/image.png
+index 1234567..89abcde 100644
+GIT binary patch
+literal 4
+LcmZ?wbhEPxo0
++not a real added line
+
+literal 0
+HcmV?d00001
+
+diff --git a/fixture.bin b/fixture.bin
+Binary files a/fixture.bin and b/fixture.bin differ
+diff --git a/file.txt b/file.txt
+--- a/file.txt
++++ b/file.txt
+@@ -1,2 +1,2 @@
+ line 1
+-line 2
++line 2 modified
+`
+
+	sampleRenameDiff = `diff --git a/old/name.go b/new/name.go
+similarity index 100%
+rename from old/name.go
+rename to new/name.go
+diff --git a/pkg/a.go b/pkg/b.go
+similarity index 90%
+rename from pkg/a.go
+rename to pkg/b.go
+index 1234567..89abcde 100644
+--- a/pkg/a.go
++++ b/pkg/b.go
+@@ -1,2 +1,2 @@
+-package a
++package b
+ func F() {}
+`
+
 	sampleConflictDiff = `diff --git a/file.txt b/file.txt
 --- a/file.txt
 +++ b/file.txt
@@ -98,6 +138,20 @@ func TestGetDiffStats(t *testing.T) {
 	assert.Equal(t, 1, statsConflict.LinesRemoved)
 	assert.True(t, statsConflict.HasConflicts)
 
+	// Test diff with binary files
+	statsBinary := GetDiffStats(sampleBinaryDiff)
+	assert.Equal(t, 3, statsBinary.FilesChanged)
+	assert.Equal(t, 2, statsBinary.BinaryFiles)
+	assert.Equal(t, 1, statsBinary.LinesAdded, "Binary patch data should not count as added lines")
+	assert.Equal(t, 1, statsBinary.LinesRemoved)
+
+	// Test diff with renames
+	statsRename := GetDiffStats(sampleRenameDiff)
+	assert.Equal(t, 2, statsRename.FilesChanged)
+	assert.Equal(t, 2, statsRename.RenamedFiles)
+	assert.Equal(t, 1, statsRename.LinesAdded, "Only edits alongside a rename should count")
+	assert.Equal(t, 1, statsRename.LinesRemoved)
+
 	// Test empty diff
 	statsEmpty := GetDiffStats("")
 	assert.Equal(t, 0, statsEmpty.FilesChanged)
@@ -106,6 +160,69 @@ func TestGetDiffStats(t *testing.T) {
 	assert.False(t, statsEmpty.HasConflicts)
 }
 
+func TestLargeDiffs(t *testing.T) {
+	// A minified file adds one multi-megabyte line between ordinary ones
+	minified := "+" + strings.Repeat("var a=1;", 512*1024)
+	diff := "diff --git a/app.min.js b/app.min.js\n" +
+		"index abcdef1234..fedcba4321 100644\n" +
+		"--- a/app.min.js\n+++ b/app.min.js\n@@ -1,2 +1,2 @@\n" +
+		"-old\r\n" + minified + "\n unchanged\n" +
+		"diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-return 1\n+return 2\n"
+
+	// Every line is counted, however long
+	stats := GetDiffStats(diff)
+	assert.Equal(t, 2, stats.FilesChanged)
+	assert.Equal(t, 2, stats.LinesAdded)
+	assert.Equal(t, 2, stats.LinesRemoved)
+	stats, err := ReadDiffStats(strings.NewReader(diff), 1024)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.LinesAdded, "Lines longer than the limit still count")
+
+	// Long lines pass through normalization whole
+	normalized := NormalizeDiff(diff)
+	assert.Contains(t, normalized, "\n"+minified+"\n unchanged\n")
+	assert.Contains(t, normalized, "\n-old\n")
+	assert.NotContains(t, normalized, "abcdef1234")
+	assert.Contains(t, normalized, "+return 2\n")
+	var streamed strings.Builder
+	require.NoError(t, WriteNormalizedDiff(&streamed, strings.NewReader(diff), 1024))
+	assert.Equal(t, normalized, streamed.String(), "The limit only changes what is held in memory")
+
+	reduced := RemoveContextLines(diff)
+	assert.Contains(t, reduced, "\n"+minified+"\n")
+	assert.NotContains(t, reduced, "unchanged")
+	assert.True(t, CompareDiffs(diff, strings.Replace(diff, "abcdef1234", "1234abcdef", 1)))
+}
+
+func TestDiffScanner(t *testing.T) {
+	scanner := NewDiffScanner(strings.NewReader("short\n"+strings.Repeat("x", 100)+"\nnext\r\nlast"), 16)
+
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "short", scanner.Line())
+	assert.False(t, scanner.Truncated())
+
+	// A long line returns its start, and the rest on request
+	require.True(t, scanner.Scan())
+	assert.Equal(t, strings.Repeat("x", 16), scanner.Line())
+	assert.True(t, scanner.Truncated())
+	var rest strings.Builder
+	require.NoError(t, scanner.WriteRest(&rest))
+	assert.Equal(t, strings.Repeat("x", 84), rest.String())
+
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "next", scanner.Line())
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "last", scanner.Line(), "The last line needn't end in a newline")
+	assert.False(t, scanner.Scan())
+	assert.NoError(t, scanner.Err())
+
+	// The rest of a long line is skipped if it isn't asked for
+	scanner = NewDiffScanner(strings.NewReader(strings.Repeat("y", 100)+"\nafter\n"), 16)
+	require.True(t, scanner.Scan())
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "after", scanner.Line())
+}
+
 func TestRemoveContextLines(t *testing.T) {
 	// Remove context lines from a diff
 	reduced := RemoveContextLines(sampleDiff1)
@@ -0,0 +1,138 @@
+package gitutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// DefaultMaxDiffLineBytes is how much of each diff line a DiffScanner holds in memory by default
+// Headers and change markers are at the start of a line, so nothing parsing needs is lost past it
+const DefaultMaxDiffLineBytes = 64 * 1024
+
+// DefaultMaxDiffBytes is the largest diff DiffWorktree reads by default
+const DefaultMaxDiffBytes = 100 << 20
+
+// ErrDiffTooLarge is returned for a diff larger than the limit it is read with
+var ErrDiffTooLarge = errors.New("diff is too large")
+
+// readDiff runs a command printing a diff and returns its output, stopping the command once the output passes
+// maxBytes (0 or less for DefaultMaxDiffBytes)
+func readDiff(cmd *exec.Cmd, maxBytes int64) (string, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxDiffBytes
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to get diff: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to get diff: %w", err)
+	}
+
+	var diff strings.Builder
+	n, err := io.Copy(&diff, io.LimitReader(stdout, maxBytes+1))
+	if err == nil && n > maxBytes {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return "", fmt.Errorf("%w: more than %d bytes", ErrDiffTooLarge, maxBytes)
+	}
+	if waitErr := cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get diff: %w - %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return diff.String(), nil
+}
+
+// DiffScanner reads a diff line by line, holding at most a fixed number of bytes of any line
+// Unlike bufio.Scanner it doesn't stop at a line that's too long, such as a minified or generated file's:
+// it returns the line's start, and passes the rest through to WriteRest or skips it
+type DiffScanner struct {
+	reader *bufio.Reader
+	line   string
+	long   bool
+	err    error
+}
+
+// NewDiffScanner returns a scanner reading a diff from r, holding at most maxLineBytes of each line
+// A maxLineBytes of 0 or less uses DefaultMaxDiffLineBytes
+func NewDiffScanner(r io.Reader, maxLineBytes int) *DiffScanner {
+	if maxLineBytes <= 0 {
+		maxLineBytes = DefaultMaxDiffLineBytes
+	}
+	return &DiffScanner{reader: bufio.NewReaderSize(r, maxLineBytes)}
+}
+
+// Scan advances to the next line, skipping whatever WriteRest didn't copy of the current one
+// It returns false at the end of the diff or on a read error
+func (s *DiffScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.long {
+		if s.err = s.WriteRest(io.Discard); s.err != nil {
+			return false
+		}
+	}
+
+	chunk, err := s.reader.ReadSlice('\n')
+	switch {
+	case errors.Is(err, bufio.ErrBufferFull):
+		s.line, s.long = string(chunk), true
+		return true
+	case err == io.EOF && len(chunk) == 0:
+		return false
+	case err != nil && err != io.EOF:
+		s.err = err
+		return false
+	}
+	s.line, s.long = string(trimLineEnd(chunk)), false
+	return true
+}
+
+// Line returns the current line without its line ending, or its start if Truncated
+func (s *DiffScanner) Line() string {
+	return s.line
+}
+
+// Truncated reports whether the current line is longer than the scanner holds
+func (s *DiffScanner) Truncated() bool {
+	return s.long
+}
+
+// WriteRest copies the rest of a truncated line to w, without its line ending, a buffer at a time
+func (s *DiffScanner) WriteRest(w io.Writer) error {
+	for s.long {
+		chunk, err := s.reader.ReadSlice('\n')
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) && err != io.EOF {
+			return err
+		}
+		s.long = errors.Is(err, bufio.ErrBufferFull)
+		if !s.long {
+			chunk = trimLineEnd(chunk)
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Err returns the first error reading the diff
+func (s *DiffScanner) Err() error {
+	return s.err
+}
+
+// trimLineEnd drops a line's trailing newline or carriage return and newline, as bufio.ScanLines does
+func trimLineEnd(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
@@ -0,0 +1,59 @@
+package gitutil
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// TrackedFiles lists the files tracked in the repository's index, relative to its root
+func TrackedFiles(repoPath string) ([]string, error) {
+	output, err := exec.Command("git", "-C", repoPath, "ls-files", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tracked files: %w", err)
+	}
+	return splitNames(string(output), "\x00"), nil
+}
+
+// RecentFiles lists the files changed by the latest commits, most recently changed first
+// Files that no longer exist at HEAD are left out
+func RecentFiles(repoPath string, commits int) ([]string, error) {
+	if commits <= 0 {
+		return nil, nil
+	}
+
+	output, err := exec.Command("git", "-C", repoPath, "log", fmt.Sprintf("-%d", commits), "--name-only", "--format=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recently changed files: %w", err)
+	}
+
+	tracked, err := TrackedFiles(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(tracked))
+	for _, file := range tracked {
+		exists[file] = true
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, file := range splitNames(string(output), "\n") {
+		if exists[file] && !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// splitNames splits git output into file names, dropping empty entries
+func splitNames(output, sep string) []string {
+	var names []string
+	for _, name := range strings.Split(output, sep) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
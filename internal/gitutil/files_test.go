@@ -0,0 +1,49 @@
+package gitutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentFiles(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping files test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	commit := func(message string, write map[string]string, remove ...string) {
+		for name, content := range write {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(repoDir, name)), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644))
+		}
+		for _, name := range remove {
+			require.NoError(t, os.Remove(filepath.Join(repoDir, name)))
+		}
+		output, err := exec.Command("git", "-C", repoDir, "add", "-A").CombinedOutput()
+		require.NoError(t, err, string(output))
+		output, err = exec.Command("git", "-C", repoDir, "commit", "-m", message).CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	commit("Add parser", map[string]string{"pkg/parser.go": "package pkg\n", "old.txt": "old\n"})
+	commit("Remove old file", map[string]string{"pkg/lexer.go": "package pkg\n"}, "old.txt")
+
+	tracked, err := TrackedFiles(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pkg/lexer.go", "pkg/parser.go", "test-file.txt"}, tracked)
+
+	files, err := RecentFiles(repoDir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pkg/lexer.go", "pkg/parser.go"}, files, "Deleted files are left out")
+
+	files, err = RecentFiles(repoDir, 0)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,76 @@
+package gitutil
+
+import (
+	"path"
+	"strings"
+)
+
+// FilterDiff removes the sections of a diff whose file paths match any of the ignore patterns
+// Patterns use path.Match syntax and are matched against both the full path and the base name
+// A pattern ending in "/" or "/**" matches everything under that directory
+func FilterDiff(diff string, patterns []string) string {
+	if len(patterns) == 0 || diff == "" {
+		return diff
+	}
+
+	var result strings.Builder
+	skipping := false
+
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if matches := fileHeaderRegex.FindStringSubmatch(strings.TrimSuffix(line, "\n")); matches != nil {
+			// A file is ignored only if both sides of a rename are ignored
+			skipping = MatchesAnyPattern(matches[1], patterns) && MatchesAnyPattern(matches[2], patterns)
+		}
+
+		if !skipping {
+			result.WriteString(line)
+		}
+	}
+
+	return result.String()
+}
+
+// MatchesAnyPattern reports whether a file path matches any of the given glob patterns
+func MatchesAnyPattern(filePath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if MatchesPattern(filePath, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesPattern reports whether a file path matches a single glob pattern
+func MatchesPattern(filePath, pattern string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	if pattern == "" {
+		return false
+	}
+
+	// Directory patterns match anything beneath the directory at any depth
+	if strings.HasSuffix(pattern, "/**") || strings.HasSuffix(pattern, "/") {
+		dir := strings.TrimSuffix(strings.TrimSuffix(pattern, "**"), "/")
+		for current := path.Dir(filePath); current != "." && current != "/"; current = path.Dir(current) {
+			if ok, _ := path.Match(dir, current); ok {
+				return true
+			}
+			if ok, _ := path.Match(dir, path.Base(current)); ok && !strings.Contains(dir, "/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ok, _ := path.Match(pattern, filePath); ok {
+		return true
+	}
+
+	// Patterns without a slash match the base name anywhere in the tree
+	if !strings.Contains(pattern, "/") {
+		if ok, _ := path.Match(pattern, path.Base(filePath)); ok {
+			return true
+		}
+	}
+
+	return false
+}
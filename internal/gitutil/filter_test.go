@@ -0,0 +1,61 @@
+package gitutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		pattern  string
+		expected bool
+	}{
+		{name: "exact file", path: "go.sum", pattern: "go.sum", expected: true},
+		{name: "base name anywhere", path: "web/package-lock.json", pattern: "package-lock.json", expected: true},
+		{name: "extension glob", path: "api/service.pb.go", pattern: "*.pb.go", expected: true},
+		{name: "directory prefix", path: "vendor/github.com/pkg/errors/errors.go", pattern: "vendor/", expected: true},
+		{name: "nested directory", path: "web/node_modules/left-pad/index.js", pattern: "node_modules/**", expected: true},
+		{name: "full path glob", path: "gen/models.go", pattern: "gen/*.go", expected: true},
+		{name: "full path glob other dir", path: "src/models.go", pattern: "gen/*.go", expected: false},
+		{name: "non matching", path: "main.go", pattern: "*.pb.go", expected: false},
+		{name: "directory name only as file", path: "vendor.go", pattern: "vendor/", expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, MatchesPattern(tc.path, tc.pattern))
+		})
+	}
+}
+
+func TestFilterDiff(t *testing.T) {
+	diff := `diff --git a/go.sum b/go.sum
+--- a/go.sum
++++ b/go.sum
+@@ -1 +1,2 @@
+ example.com/a v1.0.0
++example.com/b v1.0.0
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-package old
++package main
+`
+
+	// Without patterns the diff is unchanged
+	assert.Equal(t, diff, FilterDiff(diff, nil))
+
+	// Ignored files are removed from stats
+	filtered := FilterDiff(diff, []string{"go.sum"})
+	assert.NotContains(t, filtered, "go.sum")
+	assert.Contains(t, filtered, "main.go")
+
+	stats := GetDiffStats(filtered)
+	assert.Equal(t, 1, stats.FilesChanged)
+	assert.Equal(t, 1, stats.LinesAdded)
+	assert.Equal(t, 1, stats.LinesRemoved)
+}
@@ -0,0 +1,96 @@
+package gitutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// lfsPointerPrefix is how every Git LFS pointer file begins
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1"
+
+// LFSFiles returns the tracked files in a checkout that are managed by Git LFS
+// It relies only on .gitattributes, so it works even when git-lfs isn't installed
+func LFSFiles(path string) ([]string, error) {
+	output, err := exec.Command("git", "-C", path, "ls-files", "-z", ":(attr:filter=lfs)").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list LFS files: %w", err)
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// UsesLFS reports whether the repository tracks any files with Git LFS
+func UsesLFS(repoPath string) bool {
+	files, err := LFSFiles(repoPath)
+	return err == nil && len(files) > 0
+}
+
+// LFSAvailable reports whether the git-lfs extension is installed
+func LFSAvailable() bool {
+	return exec.Command("git", "lfs", "version").Run() == nil
+}
+
+// PullLFS installs the LFS hooks for a checkout and downloads its LFS objects
+func PullLFS(worktreePath string) error {
+	if !LFSAvailable() {
+		return fmt.Errorf("git-lfs is not installed")
+	}
+
+	for _, args := range [][]string{
+		{"lfs", "install", "--local"},
+		{"lfs", "pull"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", worktreePath}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %w - %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return nil
+}
+
+// MissingLFSObjects returns the LFS-managed files in a checkout that still contain pointer text
+// instead of their real content
+func MissingLFSObjects(worktreePath string) ([]string, error) {
+	files, err := LFSFiles(worktreePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, file := range files {
+		if isLFSPointer(filepath.Join(worktreePath, file)) {
+			missing = append(missing, file)
+		}
+	}
+
+	return missing, nil
+}
+
+// isLFSPointer reports whether a file contains an LFS pointer rather than real content
+func isLFSPointer(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, len(lfsPointerPrefix))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+
+	return bytes.Equal(header, []byte(lfsPointerPrefix))
+}
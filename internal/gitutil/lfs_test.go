@@ -0,0 +1,52 @@
+package gitutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingLFSObjects(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping LFS test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+	assert.False(t, UsesLFS(repoDir), "Repository without LFS attributes should not use LFS")
+
+	// Commit an LFS pointer file and a real file matched by the LFS pattern
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n"
+	files := map[string]string{
+		".gitattributes": "*.bin filter=lfs diff=lfs merge=lfs -text\n",
+		"pointer.bin":    pointer,
+		"present.bin":    "real binary content",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644))
+	}
+
+	// Disable any globally configured LFS filter so the files are committed verbatim
+	for _, args := range [][]string{
+		{"-c", "filter.lfs.clean=", "-c", "filter.lfs.smudge=", "-c", "filter.lfs.required=false", "add", "."},
+		{"commit", "-m", "Add LFS files"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		require.NoError(t, cmd.Run(), "git %v failed", args)
+	}
+
+	assert.True(t, UsesLFS(repoDir), "Repository with LFS attributes should use LFS")
+
+	lfsFiles, err := LFSFiles(repoDir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"pointer.bin", "present.bin"}, lfsFiles)
+
+	missing, err := MissingLFSObjects(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pointer.bin"}, missing, "Only the pointer file should be reported missing")
+}
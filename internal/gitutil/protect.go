@@ -0,0 +1,249 @@
+package gitutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// protectedGitPaths are the files and directories of a git directory that decide what git runs: its config,
+// which can name commands such as core.fsmonitor or filter drivers, its hooks, and its info files
+var protectedGitPaths = []string{"config", "config.worktree", "hooks", "info"}
+
+// MetadataSnapshot records the git metadata of a worktree that agents must not change, so changes can be undone
+// The orchestrator runs git in a worktree after its agent finishes, which would run any hook or configured
+// command the agent planted, on the host and outside any sandbox
+type MetadataSnapshot struct {
+	worktreePath string
+	gitDir       string
+	commonDir    string
+
+	// mu serializes restores, which can happen while the agent runs, and restored keeps what they undid
+	mu       sync.Mutex
+	restored []string
+
+	// roots are the protected files and directories; entries holds what was under them
+	roots   []string
+	entries map[string]metadataEntry
+}
+
+// metadataEntry is the state of one protected file, directory, or symbolic link
+type metadataEntry struct {
+	mode fs.FileMode
+	data []byte
+}
+
+// SnapshotMetadata records the protected git metadata of a worktree: the .git file or directory linking it to its
+// repository, and the config, hooks, and info of its git directory and of the repository's common one
+func SnapshotMetadata(worktreePath string) (*MetadataSnapshot, error) {
+	gitDir, err := gitPath(worktreePath, "--absolute-git-dir")
+	if err != nil {
+		return nil, err
+	}
+	commonDir, err := gitPath(worktreePath, "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(worktreePath, commonDir)
+	}
+
+	snapshot := &MetadataSnapshot{worktreePath: worktreePath, gitDir: filepath.Clean(gitDir), commonDir: filepath.Clean(commonDir), entries: make(map[string]metadataEntry)}
+	// A linked worktree's .git is a file naming its git directory; a clone's is the git directory itself
+	if info, err := os.Lstat(filepath.Join(worktreePath, ".git")); err == nil && !info.IsDir() {
+		snapshot.roots = append(snapshot.roots, filepath.Join(worktreePath, ".git"))
+	}
+	for _, dir := range []string{snapshot.commonDir, filepath.Clean(gitDir)} {
+		for _, name := range protectedGitPaths {
+			root := filepath.Join(dir, name)
+			if !slices.Contains(snapshot.roots, root) {
+				snapshot.roots = append(snapshot.roots, root)
+			}
+		}
+	}
+
+	entries, err := snapshot.scan()
+	if err != nil {
+		return nil, err
+	}
+	snapshot.entries = entries
+	return snapshot, nil
+}
+
+// Restore undoes any change made to the protected metadata since the snapshot, and returns what was changed,
+// as paths relative to the worktree such as .git/hooks/pre-commit, including changes earlier restores undid
+func (s *MetadataSnapshot) Restore() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	// Entries that were added or changed are removed, deepest first, and then what was there is put back
+	var added []string
+	for path, entry := range current {
+		original, ok := s.entries[path]
+		if !ok {
+			added = append(added, path)
+			changed = append(changed, path)
+		} else if !original.equal(entry) {
+			changed = append(changed, path)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(added)))
+	var errs []error
+	for _, path := range added {
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var restore []string
+	for path, entry := range s.entries {
+		if now, ok := current[path]; !ok || !entry.equal(now) {
+			restore = append(restore, path)
+			if !ok {
+				changed = append(changed, path)
+			}
+		}
+	}
+	sort.Strings(restore)
+	for _, path := range restore {
+		if err := s.entries[path].write(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("failed to restore git metadata: %w", err)
+	}
+
+	display := slices.Clone(s.restored)
+	for _, path := range changed {
+		if name := s.display(path); !slices.Contains(display, name) {
+			display = append(display, name)
+		}
+	}
+	sort.Strings(display)
+	s.restored = display
+	return slices.Clone(display), nil
+}
+
+// WorkingTreeID returns the worktree's WorkingTreeID while its agent may still be running, such as just before it
+// is killed: the protected metadata is restored first, and git runs on the git directory recorded in the snapshot
+// with fsmonitor and hooks turned off, so nothing the agent planted since runs either
+func (s *MetadataSnapshot) WorkingTreeID() (string, error) {
+	if _, err := s.Restore(); err != nil {
+		return "", err
+	}
+	return snapshotTree(s.worktreePath, &pinnedGit{
+		env:  []string{"GIT_DIR=" + s.gitDir, "GIT_WORK_TREE=" + s.worktreePath},
+		args: []string{"-c", "core.fsmonitor=false", "-c", "core.hooksPath=" + os.DevNull},
+	})
+}
+
+// pinnedGit is what is added to git commands so they ignore a worktree's .git and the commands its config can name
+type pinnedGit struct {
+	env  []string
+	args []string
+}
+
+// scan reads the current state of everything under the protected roots
+func (s *MetadataSnapshot) scan() (map[string]metadataEntry, error) {
+	entries := make(map[string]metadataEntry)
+	for _, root := range s.roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entry := metadataEntry{mode: info.Mode()}
+			switch {
+			case info.Mode()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				entry.data = []byte(target)
+			case info.Mode().IsRegular():
+				if entry.data, err = os.ReadFile(path); err != nil {
+					return err
+				}
+			}
+			entries[path] = entry
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read git metadata: %w", err)
+		}
+	}
+	return entries, nil
+}
+
+// display names a protected path relative to the worktree, through its .git even when the git directory is elsewhere
+func (s *MetadataSnapshot) display(path string) string {
+	if rel, err := filepath.Rel(s.commonDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(filepath.Join(".git", rel))
+	}
+	if rel, err := filepath.Rel(s.worktreePath, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// equal reports whether two states of a path are the same
+func (e metadataEntry) equal(other metadataEntry) bool {
+	if e.mode.IsDir() && other.mode.IsDir() {
+		return true
+	}
+	return e.mode == other.mode && bytes.Equal(e.data, other.data)
+}
+
+// write puts an entry back at path, replacing whatever is there
+func (e metadataEntry) write(path string) error {
+	if e.mode.IsDir() {
+		if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+		return os.MkdirAll(path, e.mode.Perm())
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if e.mode&fs.ModeSymlink != 0 {
+		return os.Symlink(string(e.data), path)
+	}
+	if err := os.WriteFile(path, e.data, e.mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chmod(path, e.mode.Perm())
+}
+
+// gitPath returns a path git reports for a worktree with rev-parse
+func gitPath(worktreePath, flag string) (string, error) {
+	output, err := RunGitCommand(worktreePath, "rev-parse", flag).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the git directory of %s: %w", worktreePath, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
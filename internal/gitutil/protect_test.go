@@ -0,0 +1,154 @@
+package gitutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataSnapshotRestore(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping metadata test in short mode")
+	}
+
+	for _, backend := range []Backend{BackendWorktree, BackendClone} {
+		t.Run(string(backend), func(t *testing.T) {
+			repoDir := t.TempDir()
+			initTestRepo(t, repoDir)
+
+			wm, err := NewWorktreeManagerWithBackend(repoDir, t.TempDir(), backend)
+			require.NoError(t, err, "Failed to create worktree manager")
+			defer wm.Cleanup()
+
+			worktreePath, err := wm.CreateWorktree("test-agent", "")
+			require.NoError(t, err, "Failed to create worktree")
+
+			snapshot, err := SnapshotMetadata(worktreePath)
+			require.NoError(t, err, "Failed to snapshot metadata")
+			commonDir, err := gitPath(worktreePath, "--git-common-dir")
+			require.NoError(t, err)
+			if !filepath.IsAbs(commonDir) {
+				commonDir = filepath.Join(worktreePath, commonDir)
+			}
+			config, err := os.ReadFile(filepath.Join(commonDir, "config"))
+			require.NoError(t, err)
+
+			// Nothing changed, so nothing is restored
+			restored, err := snapshot.Restore()
+			require.NoError(t, err)
+			assert.Empty(t, restored)
+
+			// Plant a hook, rewrite the config, and remove the info directory
+			hook := filepath.Join(commonDir, "hooks", "pre-commit")
+			require.NoError(t, os.MkdirAll(filepath.Dir(hook), 0755))
+			require.NoError(t, os.WriteFile(hook, []byte("#!/bin/sh\ntouch pwned\n"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(commonDir, "config"), []byte("[core]\n\tfsmonitor = touch pwned\n"), 0644))
+			require.NoError(t, os.RemoveAll(filepath.Join(commonDir, "info")))
+			makeTestChange(t, worktreePath)
+
+			restored, err = snapshot.Restore()
+			require.NoError(t, err, "Failed to restore metadata")
+			assert.Contains(t, restored, ".git/hooks/pre-commit")
+			assert.Contains(t, restored, ".git/config")
+			assert.Contains(t, restored, ".git/info/exclude")
+
+			_, err = os.Stat(hook)
+			assert.True(t, os.IsNotExist(err), "Planted hook should be removed")
+			restoredConfig, err := os.ReadFile(filepath.Join(commonDir, "config"))
+			require.NoError(t, err)
+			assert.Equal(t, string(config), string(restoredConfig), "Config should be restored")
+			_, err = os.Stat(filepath.Join(commonDir, "info", "exclude"))
+			assert.NoError(t, err, "Info files should be restored")
+
+			// The agent's own changes are kept, and git works again
+			diff, err := wm.GetDiff(worktreePath)
+			require.NoError(t, err, "Failed to get diff")
+			assert.Contains(t, diff, "+Updated content")
+			_, err = os.Stat(filepath.Join(worktreePath, "pwned"))
+			assert.True(t, os.IsNotExist(err), "Planted commands should not run")
+		})
+	}
+}
+
+func TestMetadataSnapshotWorkingTreeID(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping metadata test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create worktree")
+	snapshot, err := SnapshotMetadata(worktreePath)
+	require.NoError(t, err, "Failed to snapshot metadata")
+	commonDir, err := gitPath(worktreePath, "--git-common-dir")
+	require.NoError(t, err)
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(worktreePath, commonDir)
+	}
+
+	// The agent is still running when its work is captured, with a command planted in the config
+	pwned := filepath.Join(t.TempDir(), "pwned")
+	config, err := os.ReadFile(filepath.Join(commonDir, "config"))
+	require.NoError(t, err)
+	planted := string(config) + "[core]\n\tfsmonitor = touch " + pwned + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(commonDir, "config"), []byte(planted), 0644))
+	makeTestChange(t, worktreePath)
+
+	tree, err := snapshot.WorkingTreeID()
+	require.NoError(t, err, "Failed to capture the working tree")
+	_, err = os.Stat(pwned)
+	assert.True(t, os.IsNotExist(err), "Planted commands should not run")
+	current, err := WorkingTreeID(worktreePath)
+	require.NoError(t, err)
+	assert.Equal(t, current, tree, "The agent's changes should be captured")
+
+	// What the capture restored is still reported once the agent finishes
+	restored, err := snapshot.Restore()
+	require.NoError(t, err)
+	assert.Equal(t, []string{".git/config"}, restored)
+}
+
+func TestMetadataSnapshotRestoreGitFile(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping metadata test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create worktree")
+
+	snapshot, err := SnapshotMetadata(worktreePath)
+	require.NoError(t, err, "Failed to snapshot metadata")
+
+	// Pointing a linked worktree's .git at another repository is undone
+	gitFile := filepath.Join(worktreePath, ".git")
+	original, err := os.ReadFile(gitFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(gitFile, []byte("gitdir: /tmp/elsewhere\n"), 0644))
+
+	restored, err := snapshot.Restore()
+	require.NoError(t, err, "Failed to restore metadata")
+	assert.Equal(t, []string{".git"}, restored)
+
+	current, err := os.ReadFile(gitFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(current))
+}
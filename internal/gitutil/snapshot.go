@@ -0,0 +1,196 @@
+package gitutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SnapshotMessage is the commit message used for working tree snapshots
+const SnapshotMessage = "orchestrator: snapshot of uncommitted changes"
+
+// ErrSnapshotMismatch is returned when the working tree changed after a snapshot was taken
+var ErrSnapshotMismatch = errors.New("working tree no longer matches the snapshot")
+
+// SnapshotWorkingTree records the repository's current state, including staged, unstaged,
+// and untracked (but not ignored) files, as a commit on top of HEAD
+// The user's index and working tree are left untouched; the returned commit is not on any branch
+func SnapshotWorkingTree(repoPath string) (string, error) {
+	tree, err := snapshotTree(repoPath, nil)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := exec.Command("git", "-C", repoPath, "commit-tree", tree, "-p", "HEAD", "-m", SnapshotMessage).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot commit: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CommitPatch records a diff applied to base ("" for HEAD) as a commit on top of it
+// The repository's index, working tree, and branches are left untouched; the returned commit is not on any branch
+func CommitPatch(repoPath, base, diff, message string) (string, error) {
+	if base == "" {
+		base = "HEAD"
+	}
+
+	tempDir, err := os.MkdirTemp("", "orchestrator-index-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tempDir, "index"))
+	for _, args := range [][]string{
+		{"read-tree", base},
+		{"apply", "--cached", "--binary"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
+		cmd.Env = env
+		if args[0] == "apply" {
+			cmd.Stdin = strings.NewReader(diff)
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("git %s failed: %w - %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	cmd := exec.Command("git", "-C", repoPath, "write-tree")
+	cmd.Env = env
+	tree, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to write patch tree: %w", err)
+	}
+
+	output, err := exec.Command("git", "-C", repoPath, "commit-tree", strings.TrimSpace(string(tree)), "-p", base, "-m", message).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to create patch commit: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ApplyPatchToSnapshot applies a diff produced against a snapshot to the repository's working tree
+// It refuses to run if the working tree changed since the snapshot, and relies on git apply
+// being atomic so the user's uncommitted changes are never reset
+func ApplyPatchToSnapshot(repoPath, snapshot, diff string) error {
+	if strings.TrimSpace(diff) == "" {
+		return errors.New("empty patch")
+	}
+
+	if hasBinarySummary(diff) {
+		return errors.New("patch contains binary changes without binary data (generate it with git diff --binary)")
+	}
+
+	current, err := snapshotTree(repoPath, nil)
+	if err != nil {
+		return err
+	}
+
+	output, err := exec.Command("git", "-C", repoPath, "rev-parse", snapshot+"^{tree}").Output()
+	if err != nil {
+		return fmt.Errorf("failed to resolve snapshot %s: %w", snapshot, err)
+	}
+	if strings.TrimSpace(string(output)) != current {
+		return ErrSnapshotMismatch
+	}
+
+	if err := runGitApply(repoPath, diff); err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+
+	return nil
+}
+
+// WorkingTreeID returns the tree hash of the repository's current state, including uncommitted
+// and untracked (but not ignored) files, without creating a commit
+// Two states with the same content have the same ID, which makes it cheap to detect changes
+func WorkingTreeID(repoPath string) (string, error) {
+	return snapshotTree(repoPath, nil)
+}
+
+// RestoreWorkingTree resets a working tree to a state recorded by WorkingTreeID
+// Files changed or created since then are reverted or removed; ignored files are left alone
+func RestoreWorkingTree(repoPath, tree string) error {
+	for _, args := range [][]string{
+		{"read-tree", "--reset", "-u", tree},
+		{"clean", "-fd"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %w - %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// RollBack returns a repository's working tree to a state recorded by WorkingTreeID, such as the one before a patch
+// was applied; every change from HEAD is left unstaged, and files HEAD doesn't have untracked
+func RollBack(repoPath, tree string) error {
+	if err := RestoreWorkingTree(repoPath, tree); err != nil {
+		return err
+	}
+	if output, err := exec.Command("git", "-C", repoPath, "reset", "--quiet").CombinedOutput(); err != nil {
+		return fmt.Errorf("git reset failed: %w - %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// RevertPaths resets files in a working tree to their content at base, removing those base doesn't have
+// Other changes are left alone, so a patch can be stripped of the files it wasn't allowed to change
+// The files must be known to git, as they are once DiffWorktree has listed them
+func RevertPaths(repoPath, base string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := append([]string{"-C", repoPath, "restore", "--source", base, "--staged", "--worktree", "--"}, paths...)
+	cmd := exec.Command("git", args...)
+	// Paths are file names, not patterns
+	cmd.Env = append(os.Environ(), "GIT_LITERAL_PATHSPECS=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git restore failed: %w - %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// snapshotTree writes the working tree state to a tree object using a temporary index
+// pinned, if set, adds to the environment and arguments of every git command it runs
+func snapshotTree(repoPath string, pinned *pinnedGit) (string, error) {
+	tempDir, err := os.MkdirTemp("", "orchestrator-index-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tempDir, "index"))
+	leading := []string{"-C", repoPath}
+	if pinned != nil {
+		env = append(env, pinned.env...)
+		leading = append(leading, pinned.args...)
+	}
+
+	for _, args := range [][]string{
+		{"read-tree", "HEAD"},
+		{"add", "-A"},
+	} {
+		cmd := exec.Command("git", append(slices.Clone(leading), args...)...)
+		cmd.Env = env
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("git %s failed: %w - %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	cmd := exec.Command("git", append(leading, "write-tree")...)
+	cmd.Env = env
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to write snapshot tree: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,238 @@
+package gitutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotWorkingTree(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping snapshot test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	// Leave uncommitted and untracked changes in the repository
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "test-file.txt"), []byte("Dirty content\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "new-file.txt"), []byte("Untracked\n"), 0644))
+
+	snapshot, err := SnapshotWorkingTree(repoDir)
+	require.NoError(t, err, "Failed to snapshot working tree")
+
+	// The user's index should be untouched
+	output, err := exec.Command("git", "-C", repoDir, "status", "--porcelain").Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(output), " M test-file.txt", "Modified file should stay unstaged")
+	assert.Contains(t, string(output), "?? new-file.txt", "New file should stay untracked")
+
+	// A worktree created from the snapshot sees the dirty state
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+
+	worktreePath, err := wm.CreateWorktree("test-agent", snapshot)
+	require.NoError(t, err, "Failed to create worktree from snapshot")
+
+	content, err := os.ReadFile(filepath.Join(worktreePath, "test-file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Dirty content\n", string(content))
+	_, err = os.Stat(filepath.Join(worktreePath, "new-file.txt"))
+	require.NoError(t, err, "Untracked file should be in the snapshot")
+
+	// Patches made against the snapshot apply on top of the dirty state
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "test-file.txt"), []byte("Fixed content\n"), 0644))
+	diff, err := wm.GetDiff(worktreePath)
+	require.NoError(t, err)
+
+	require.NoError(t, ApplyPatchToSnapshot(repoDir, snapshot, diff), "Failed to apply patch to snapshot")
+	content, err = os.ReadFile(filepath.Join(repoDir, "test-file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Fixed content\n", string(content))
+
+	// Once the working tree has moved on, applying is refused
+	err = ApplyPatchToSnapshot(repoDir, snapshot, diff)
+	assert.ErrorIs(t, err, ErrSnapshotMismatch)
+}
+
+func TestCommitPatch(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping snapshot test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err)
+	defer wm.Cleanup()
+
+	// A patch made in a worktree becomes a commit on top of HEAD
+	worktreePath, err := wm.CreateWorktree("author", "")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "new_test.txt"), []byte("Failing test\n"), 0644))
+	diff, err := wm.GetDiff(worktreePath)
+	require.NoError(t, err)
+
+	commit, err := CommitPatch(repoDir, "", diff, "Add tests")
+	require.NoError(t, err)
+
+	// The repository itself is untouched
+	clean, err := IsClean(repoDir)
+	require.NoError(t, err)
+	assert.True(t, clean)
+
+	// A worktree created from the commit has the patch, and diffs against the commit leave it out
+	worktreePath, err = wm.CreateWorktree("fixer", commit)
+	require.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(worktreePath, "new_test.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Failing test\n", string(content))
+	diff, err = wm.GetDiff(worktreePath)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+
+	_, err = CommitPatch(repoDir, "", "not a patch", "Add tests")
+	assert.Error(t, err)
+}
+
+func TestWorkingTreeID(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping snapshot test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	clean, err := WorkingTreeID(repoDir)
+	require.NoError(t, err)
+
+	again, err := WorkingTreeID(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, clean, again, "An unchanged repository keeps its ID")
+
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "new-file.txt"), []byte("Untracked\n"), 0644))
+	dirty, err := WorkingTreeID(repoDir)
+	require.NoError(t, err)
+	assert.NotEqual(t, clean, dirty, "Untracked files change the ID")
+
+	// Reverting the change restores the original ID
+	require.NoError(t, os.Remove(filepath.Join(repoDir, "new-file.txt")))
+	reverted, err := WorkingTreeID(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, clean, reverted)
+}
+
+func TestRestoreWorkingTree(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping snapshot test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, ".gitignore"), []byte("*.log\n"), 0644))
+
+	// Record a state with a modified file and a new one
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "test-file.txt"), []byte("Halfway\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "kept.txt"), []byte("Kept\n"), 0644))
+	snapshot, err := WorkingTreeID(repoDir)
+	require.NoError(t, err)
+
+	// Later changes are undone, while ignored files stay
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "test-file.txt"), []byte("Half-writ"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(repoDir, "kept.txt")))
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "later"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "later", "new.txt"), []byte("Later\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "agent.log"), []byte("Log\n"), 0644))
+
+	require.NoError(t, RestoreWorkingTree(repoDir, snapshot))
+	restored, err := WorkingTreeID(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, restored)
+
+	content, err := os.ReadFile(filepath.Join(repoDir, "test-file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Halfway\n", string(content))
+	assert.FileExists(t, filepath.Join(repoDir, "kept.txt"))
+	assert.NoDirExists(t, filepath.Join(repoDir, "later"))
+	assert.FileExists(t, filepath.Join(repoDir, "agent.log"), "Ignored files are left alone")
+}
+
+func TestRollBack(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping snapshot test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	// Uncommitted work from before a patch is applied survives rolling the patch back, unstaged
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "test-file.txt"), []byte("Mine\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "notes.txt"), []byte("Notes\n"), 0644))
+	before, err := WorkingTreeID(repoDir)
+	require.NoError(t, err)
+	snapshot, err := SnapshotWorkingTree(repoDir)
+	require.NoError(t, err)
+
+	require.NoError(t, ApplyPatchToSnapshot(repoDir, snapshot, "diff --git a/patched.txt b/patched.txt\nnew file mode 100644\n--- /dev/null\n+++ b/patched.txt\n@@ -0,0 +1 @@\n+Patched\n"))
+	require.FileExists(t, filepath.Join(repoDir, "patched.txt"))
+
+	require.NoError(t, RollBack(repoDir, before))
+	assert.NoFileExists(t, filepath.Join(repoDir, "patched.txt"))
+	after, err := WorkingTreeID(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	status, err := exec.Command("git", "-C", repoDir, "status", "--porcelain").Output()
+	require.NoError(t, err)
+	assert.Equal(t, " M test-file.txt\n?? notes.txt\n", string(status))
+}
+
+func TestRevertPaths(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping snapshot test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+	worktreePath, err := wm.CreateWorktree("test-agent", "HEAD")
+	require.NoError(t, err)
+	base, _ := wm.BaseCommit(worktreePath)
+
+	// The agent changes a tracked file, commits a new one, and leaves another untracked
+	makeTestChange(t, worktreePath)
+	require.NoError(t, os.MkdirAll(filepath.Join(worktreePath, "secrets"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "secrets", "key.pem"), []byte("key\n"), 0644))
+	for _, args := range [][]string{{"add", "secrets"}, {"commit", "-m", "Add key"}} {
+		require.NoError(t, RunGitCommand(worktreePath, args...).Run())
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "notes [draft].txt"), []byte("notes\n"), 0644))
+	diff, err := wm.GetDiff(worktreePath)
+	require.NoError(t, err)
+	require.Len(t, SplitDiff(diff), 3)
+
+	require.NoError(t, RevertPaths(worktreePath, base, []string{"secrets/key.pem", "notes [draft].txt"}))
+
+	diff, err = wm.GetDiff(worktreePath)
+	require.NoError(t, err)
+	patches := SplitDiff(diff)
+	require.Len(t, patches, 1, "Only the permitted change is left")
+	assert.Equal(t, "test-file.txt", patches[0].Path)
+	assert.NoFileExists(t, filepath.Join(worktreePath, "secrets", "key.pem"))
+	assert.NoFileExists(t, filepath.Join(worktreePath, "notes [draft].txt"))
+
+	assert.NoError(t, RevertPaths(worktreePath, base, nil))
+}
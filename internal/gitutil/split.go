@@ -0,0 +1,189 @@
+package gitutil
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FilePatch is the portion of a diff that touches a single file
+type FilePatch struct {
+	// Path is the file path after the change
+	Path string
+
+	// OldPath is the file path before the change, which differs from Path for renames
+	OldPath string
+
+	// Header contains the "diff --git" line and extended headers up to the first hunk
+	Header string
+
+	// Hunks contains each "@@" hunk including its header line
+	Hunks []string
+}
+
+// String reassembles the file patch
+func (fp FilePatch) String() string {
+	return fp.Header + strings.Join(fp.Hunks, "")
+}
+
+// LineRange is a span of lines in a file, numbered from 1 and inclusive
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// ChangedLines returns the lines each hunk covers in the file after the change
+// A hunk that only deletes lines covers the line before the deletion
+func (fp FilePatch) ChangedLines() []LineRange {
+	var ranges []LineRange
+	for _, hunk := range fp.Hunks {
+		matches := hunkNewRangeRegex.FindStringSubmatch(hunk)
+		if matches == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(matches[1])
+		count := 1
+		if matches[2] != "" {
+			count, _ = strconv.Atoi(matches[2])
+		}
+		start = max(start, 1)
+		ranges = append(ranges, LineRange{Start: start, End: start + max(count, 1) - 1})
+	}
+	return ranges
+}
+
+// hunkNewRangeRegex captures the start and line count of the new side of a hunk header
+var hunkNewRangeRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// SplitDiff splits a diff into per-file patches, preserving their order
+// Anything before the first file header is discarded
+func SplitDiff(diff string) []FilePatch {
+	var patches []FilePatch
+	var current *FilePatch
+	inHunk := false
+
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		trimmed := strings.TrimSuffix(line, "\n")
+
+		if matches := fileHeaderRegex.FindStringSubmatch(trimmed); matches != nil {
+			patches = append(patches, FilePatch{Path: matches[2], OldPath: matches[1], Header: line})
+			current = &patches[len(patches)-1]
+			inHunk = false
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, HunkHeaderPrefix) {
+			current.Hunks = append(current.Hunks, line)
+			inHunk = true
+			continue
+		}
+
+		if inHunk {
+			current.Hunks[len(current.Hunks)-1] += line
+		} else {
+			current.Header += line
+		}
+	}
+
+	return patches
+}
+
+// SelectPatch builds a diff containing only the accepted files or hunks
+// Each spec is either a file path ("pkg/a.go") selecting the whole file,
+// or a path with a 1-based hunk number ("pkg/a.go#2") selecting a single hunk
+func SelectPatch(diff string, specs []string) (string, error) {
+	patches := SplitDiff(diff)
+
+	type selection struct {
+		whole bool
+		hunks map[int]bool
+	}
+	selected := make(map[string]*selection)
+
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		path, hunk := spec, 0
+		if idx := strings.LastIndex(spec, "#"); idx >= 0 {
+			n, err := strconv.Atoi(spec[idx+1:])
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("invalid hunk number in %q", spec)
+			}
+			path, hunk = spec[:idx], n
+		}
+
+		if selected[path] == nil {
+			selected[path] = &selection{hunks: make(map[int]bool)}
+		}
+		if hunk == 0 {
+			selected[path].whole = true
+		} else {
+			selected[path].hunks[hunk] = true
+		}
+	}
+
+	var result strings.Builder
+	found := make(map[string]bool)
+
+	for _, patch := range patches {
+		sel, ok := selected[patch.Path]
+		if !ok {
+			continue
+		}
+		found[patch.Path] = true
+
+		if sel.whole {
+			result.WriteString(patch.String())
+			continue
+		}
+
+		for n := range sel.hunks {
+			if n > len(patch.Hunks) {
+				return "", fmt.Errorf("%s has %d hunks, cannot select hunk %d", patch.Path, len(patch.Hunks), n)
+			}
+		}
+
+		result.WriteString(patch.Header)
+		for i, hunk := range patch.Hunks {
+			if sel.hunks[i+1] {
+				result.WriteString(hunk)
+			}
+		}
+	}
+
+	for path := range selected {
+		if !found[path] {
+			return "", fmt.Errorf("file %s is not part of the patch", path)
+		}
+	}
+
+	return result.String(), nil
+}
+
+// DescribePatch lists the files and hunks in a diff using the spec syntax accepted by SelectPatch
+func DescribePatch(diff string) string {
+	var sb strings.Builder
+
+	for _, patch := range SplitDiff(diff) {
+		stats := GetDiffStats(patch.String())
+		sb.WriteString(fmt.Sprintf("%s (+%d -%d)\n", patch.Path, stats.LinesAdded, stats.LinesRemoved))
+
+		for i, hunk := range patch.Hunks {
+			header := strings.SplitN(hunk, "\n", 2)[0]
+			sb.WriteString(fmt.Sprintf("  %s#%d %s\n", patch.Path, i+1, header))
+		}
+	}
+
+	return sb.String()
+}
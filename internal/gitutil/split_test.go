@@ -0,0 +1,83 @@
+package gitutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleMultiFileDiff = `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@
+ package a
+-var x = 1
++var x = 2
+ 
+@@ -10,3 +10,3 @@
+ func F() {
+-	return
++	panic("debug")
+ }
+diff --git a/b.go b/b.go
+index 3333333..4444444 100644
+--- a/b.go
++++ b/b.go
+@@ -1 +1 @@
+-package old
++package b
+`
+
+func TestSplitDiff(t *testing.T) {
+	patches := SplitDiff(sampleMultiFileDiff)
+	require.Len(t, patches, 2)
+
+	assert.Equal(t, "a.go", patches[0].Path)
+	assert.Equal(t, "a.go", patches[0].OldPath)
+	assert.Len(t, patches[0].Hunks, 2)
+	assert.Contains(t, patches[0].Header, "+++ b/a.go")
+	assert.Contains(t, patches[0].Hunks[1], `panic("debug")`)
+
+	assert.Equal(t, "b.go", patches[1].Path)
+	assert.Len(t, patches[1].Hunks, 1)
+
+	// Reassembling every file yields the original diff
+	assert.Equal(t, sampleMultiFileDiff, patches[0].String()+patches[1].String())
+
+	assert.Equal(t, []LineRange{{Start: 1, End: 3}, {Start: 10, End: 12}}, patches[0].ChangedLines())
+	assert.Equal(t, []LineRange{{Start: 1, End: 1}}, patches[1].ChangedLines())
+	deletion := FilePatch{Path: "c.go", Hunks: []string{"@@ -4,2 +3,0 @@\n-a\n-b\n"}}
+	assert.Equal(t, []LineRange{{Start: 3, End: 3}}, deletion.ChangedLines())
+}
+
+func TestSelectPatch(t *testing.T) {
+	// Select a whole file
+	selected, err := SelectPatch(sampleMultiFileDiff, []string{"b.go"})
+	require.NoError(t, err)
+	assert.NotContains(t, selected, "a.go")
+	assert.Contains(t, selected, "+package b")
+
+	// Select a single hunk
+	selected, err = SelectPatch(sampleMultiFileDiff, []string{"a.go#1"})
+	require.NoError(t, err)
+	assert.Contains(t, selected, "+var x = 2")
+	assert.NotContains(t, selected, "panic")
+	assert.NotContains(t, selected, "b.go")
+
+	// Invalid specs are rejected
+	_, err = SelectPatch(sampleMultiFileDiff, []string{"missing.go"})
+	assert.Error(t, err)
+	_, err = SelectPatch(sampleMultiFileDiff, []string{"a.go#3"})
+	assert.Error(t, err)
+	_, err = SelectPatch(sampleMultiFileDiff, []string{"a.go#x"})
+	assert.Error(t, err)
+}
+
+func TestDescribePatch(t *testing.T) {
+	description := DescribePatch(sampleMultiFileDiff)
+	assert.Contains(t, description, "a.go (+2 -2)")
+	assert.Contains(t, description, "a.go#2 @@ -10,3 +10,3 @@")
+	assert.Contains(t, description, "b.go#1")
+}
@@ -1,12 +1,39 @@
 package gitutil
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/brettsmith212/orchestrator/internal/procutil"
+)
+
+// retainedSuffix names the marker file kept next to a retained worktree, so orphan recovery leaves it alone
+const retainedSuffix = ".keep"
+
+// ownerSuffix names the marker file kept next to a worktree, holding the ID and host of the process that created it
+// Orphan recovery leaves worktrees alone while that process runs, since it may be another run using them
+const ownerSuffix = ".owner"
+
+// Backend selects how isolated agent checkouts are created
+type Backend string
+
+// Supported checkout backends
+const (
+	// BackendAuto uses git worktrees when available and falls back to clones otherwise
+	BackendAuto Backend = "auto"
+
+	// BackendWorktree uses `git worktree add`
+	BackendWorktree Backend = "worktree"
+
+	// BackendClone uses `git clone --shared`, for environments where worktrees don't work
+	BackendClone Backend = "clone"
 )
 
 // WorktreeManager manages git worktrees for a repository
@@ -14,15 +41,43 @@ type WorktreeManager struct {
 	// repoPath is the path to the original git repository
 	repoPath string
 
+	// backend is the resolved checkout backend (never BackendAuto)
+	backend Backend
+
 	// workingDir is the directory where temporary worktrees will be created
 	workingDir string
 
+	// lfsPull downloads Git LFS objects into each new worktree
+	lfsPull bool
+
+	// maxDiffBytes is the largest diff GetDiff reads (0 for DefaultMaxDiffBytes)
+	maxDiffBytes int64
+
+	// runID scopes worktree names to a single orchestrator run (optional)
+	runID string
+
+	// mutex protects concurrent access to createdWorktrees
+	mutex sync.Mutex
+
+	// registerMutex serializes adding worktrees to the repository's shared worktree metadata
+	// Checkouts, which fill each worktree's own index, run in parallel
+	registerMutex sync.Mutex
+
 	// createdWorktrees keeps track of created worktree paths for cleanup
 	createdWorktrees []string
+
+	// baseCommits maps each worktree path to the commit it was created from
+	baseCommits map[string]string
 }
 
 // NewWorktreeManager creates a new worktree manager for a git repository
+// It uses git worktrees when supported and falls back to shared clones otherwise
 func NewWorktreeManager(repoPath, workingDir string) (*WorktreeManager, error) {
+	return NewWorktreeManagerWithBackend(repoPath, workingDir, BackendAuto)
+}
+
+// NewWorktreeManagerWithBackend creates a new worktree manager using the given checkout backend
+func NewWorktreeManagerWithBackend(repoPath, workingDir string, backend Backend) (*WorktreeManager, error) {
 	// Check if repoPath is a valid git repository
 	if err := validateGitRepo(repoPath); err != nil {
 		return nil, fmt.Errorf("invalid git repository: %w", err)
@@ -33,53 +88,231 @@ func NewWorktreeManager(repoPath, workingDir string) (*WorktreeManager, error) {
 		return nil, fmt.Errorf("failed to create working directory: %w", err)
 	}
 
+	switch backend {
+	case "", BackendAuto:
+		backend = BackendWorktree
+		if !worktreesSupported(repoPath) {
+			backend = BackendClone
+		}
+	case BackendWorktree, BackendClone:
+	default:
+		return nil, fmt.Errorf("unknown worktree backend %q, must be 'auto', 'worktree', or 'clone'", backend)
+	}
+
 	return &WorktreeManager{
 		repoPath:         repoPath,
-		workingDir:      workingDir,
+		backend:          backend,
+		workingDir:       workingDir,
 		createdWorktrees: []string{},
+		baseCommits:      make(map[string]string),
 	}, nil
 }
 
+// Backend returns the checkout backend in use
+func (wm *WorktreeManager) Backend() Backend {
+	return wm.backend
+}
+
+// RepoPath returns the repository worktrees are created from
+func (wm *WorktreeManager) RepoPath() string {
+	return wm.repoPath
+}
+
+// WorkingDir returns the directory worktrees are created in
+func (wm *WorktreeManager) WorkingDir() string {
+	return wm.workingDir
+}
+
+// SetRunID includes the given run ID in the names of worktrees created afterwards
+// so concurrent runs sharing a working directory never collide
+func (wm *WorktreeManager) SetRunID(runID string) {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	wm.runID = runID
+}
+
+// RunID returns the run ID included in the names of new worktrees (empty if none is)
+func (wm *WorktreeManager) RunID() string {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	return wm.runID
+}
+
+// SetLFSPull controls whether Git LFS objects are pulled into each new worktree
+func (wm *WorktreeManager) SetLFSPull(enabled bool) {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	wm.lfsPull = enabled
+}
+
+// SetMaxDiffBytes limits how much of a worktree's diff GetDiff reads; a larger diff is an error wrapping
+// ErrDiffTooLarge (0 or less for DefaultMaxDiffBytes)
+func (wm *WorktreeManager) SetMaxDiffBytes(maxBytes int64) {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	wm.maxDiffBytes = maxBytes
+}
+
 // CreateWorktree creates a new worktree for the repository
 // The worktree will be based on the given ref (branch, tag, or commit hash)
 // If ref is empty, it will use the current HEAD
+// It is safe to call concurrently
 func (wm *WorktreeManager) CreateWorktree(agentID string, ref string) (string, error) {
 	// Generate a unique worktree path
-	worktreePath := filepath.Join(wm.workingDir, fmt.Sprintf("worktree-%s-%s", agentID, randomString(8)))
+	suffix, err := randomString(8)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate worktree name: %w", err)
+	}
+
+	wm.mutex.Lock()
+	name := fmt.Sprintf("worktree-%s-%s", agentID, suffix)
+	if wm.runID != "" {
+		name = fmt.Sprintf("worktree-%s-%s-%s", wm.runID, agentID, suffix)
+	}
+	wm.mutex.Unlock()
+
+	worktreePath := filepath.Join(wm.workingDir, name)
+
+	// Claim the worktree before it exists, so no other process's orphan recovery can take it for one
+	if err := writeOwner(worktreePath); err != nil {
+		return "", err
+	}
+	created := false
+	defer func() {
+		if !created {
+			_ = os.Remove(worktreePath + ownerSuffix)
+		}
+	}()
 
 	// Use HEAD if ref is empty
+	// The ref may be a revision expression such as HEAD~1, which git resolves, but never an option
 	if ref == "" {
 		ref = "HEAD"
 	}
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid ref %q: must not start with '-'", ref)
+	}
 
 	// Create the worktree
-	cmd := exec.Command("git", "-C", wm.repoPath, "worktree", "add", worktreePath, ref)
-	output, err := cmd.CombinedOutput()
+	if wm.backend == BackendClone {
+		if err := wm.createClone(worktreePath, ref); err != nil {
+			return "", err
+		}
+	} else {
+		wm.registerMutex.Lock()
+		cmd := exec.Command("git", "-C", wm.repoPath, "worktree", "add", "--no-checkout", "--end-of-options", worktreePath, ref)
+		output, err := cmd.CombinedOutput()
+		wm.registerMutex.Unlock()
+		if err != nil {
+			return "", fmt.Errorf("failed to create worktree: %w - %s", err, output)
+		}
+
+		cmd = exec.Command("git", "-C", worktreePath, "reset", "--hard", "--quiet")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			wm.registerMutex.Lock()
+			_ = exec.Command("git", "-C", wm.repoPath, "worktree", "remove", "--force", worktreePath).Run()
+			wm.registerMutex.Unlock()
+			return "", fmt.Errorf("failed to check out %s in worktree: %w - %s", ref, err, output)
+		}
+	}
+
+	// Remember the starting commit so diffs include anything the agent commits itself
+	base, err := exec.Command("git", "-C", worktreePath, "rev-parse", "HEAD").Output()
 	if err != nil {
-		return "", fmt.Errorf("failed to create worktree: %w - %s", err, output)
+		return "", fmt.Errorf("failed to resolve worktree base commit: %w", err)
 	}
 
 	// Add to the list of created worktrees
+	created = true
+	wm.mutex.Lock()
 	wm.createdWorktrees = append(wm.createdWorktrees, worktreePath)
+	wm.baseCommits[worktreePath] = strings.TrimSpace(string(base))
+	lfsPull := wm.lfsPull
+	wm.mutex.Unlock()
+
+	// Replace LFS pointer files with real content so builds work
+	if lfsPull && UsesLFS(worktreePath) {
+		if err := PullLFS(worktreePath); err != nil {
+			_ = wm.RemoveWorktree(worktreePath)
+			return "", fmt.Errorf("failed to pull LFS objects: %w", err)
+		}
+	}
 
 	return worktreePath, nil
 }
 
+// CreateWorktrees creates a worktree for each agent at once, all based on the same ref
+// It returns the path of each agent's worktree, and the errors of those that couldn't be created
+func (wm *WorktreeManager) CreateWorktrees(agentIDs []string, ref string) (map[string]string, map[string]error) {
+	paths := make(map[string]string)
+	errs := make(map[string]error)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, agentID := range agentIDs {
+		wg.Add(1)
+		go func(agentID string) {
+			defer wg.Done()
+			path, err := wm.CreateWorktree(agentID, ref)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs[agentID] = err
+			} else {
+				paths[agentID] = path
+			}
+		}(agentID)
+	}
+	wg.Wait()
+
+	return paths, errs
+}
+
+// BaseCommit returns the commit a worktree was created from
+func (wm *WorktreeManager) BaseCommit(worktreePath string) (string, bool) {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	base, ok := wm.baseCommits[worktreePath]
+	return base, ok
+}
+
 // GetDiff returns the diff for changes made in the worktree
+// The diff is taken against the worktree's base commit, so it covers commits made by the agent
+// as well as staged, unstaged, and new untracked files
 func (wm *WorktreeManager) GetDiff(worktreePath string) (string, error) {
 	// Check if worktree exists
 	if !wm.isValidWorktree(worktreePath) {
 		return "", errors.New("invalid worktree path")
 	}
 
-	// Get the diff
-	cmd := exec.Command("git", "-C", worktreePath, "diff")
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("failed to get diff: %w", err)
+	base, _ := wm.BaseCommit(worktreePath)
+	wm.mutex.Lock()
+	maxBytes := wm.maxDiffBytes
+	wm.mutex.Unlock()
+	return DiffWorktree(worktreePath, base, maxBytes)
+}
+
+// DiffWorktree returns the changes made in a worktree since its base commit, as GetDiff does
+// It works on any worktree, such as one left behind by a run that crashed, given the commit it started from
+// The diff is read from git as it is produced, and git is stopped once it passes maxBytes (0 or less for
+// DefaultMaxDiffBytes), so an oversized diff is never held in memory
+func DiffWorktree(worktreePath, base string, maxBytes int64) (string, error) {
+	// Mark untracked files as intent-to-add so they show up as new files
+	cmd := exec.Command("git", "-C", worktreePath, "add", "--all", "--intent-to-add")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to track new files: %w - %s", err, output)
 	}
 
-	return string(output), nil
+	// Get the diff, including binary content so the patch can be re-applied
+	// and with rename detection so moved files don't count as full rewrites
+	cmd = exec.Command("git", "-C", worktreePath, "diff", "--binary", "-M", base)
+	return readDiff(cmd, maxBytes)
 }
 
 // RemoveWorktree removes a previously created worktree
@@ -90,19 +323,29 @@ func (wm *WorktreeManager) RemoveWorktree(worktreePath string) error {
 	}
 
 	// Remove the worktree
-	cmd := exec.Command("git", "-C", wm.repoPath, "worktree", "remove", "--force", worktreePath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to remove worktree: %w - %s", err, output)
+	if wm.backend == BackendClone {
+		if err := os.RemoveAll(worktreePath); err != nil {
+			return fmt.Errorf("failed to remove worktree: %w", err)
+		}
+	} else {
+		cmd := exec.Command("git", "-C", wm.repoPath, "worktree", "remove", "--force", worktreePath)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to remove worktree: %w - %s", err, output)
+		}
 	}
+	_ = os.Remove(worktreePath + ownerSuffix)
 
 	// Remove from the list of created worktrees
+	wm.mutex.Lock()
+	delete(wm.baseCommits, worktreePath)
 	for i, path := range wm.createdWorktrees {
 		if path == worktreePath {
 			wm.createdWorktrees = append(wm.createdWorktrees[:i], wm.createdWorktrees[i+1:]...)
 			break
 		}
 	}
+	wm.mutex.Unlock()
 
 	return nil
 }
@@ -112,8 +355,10 @@ func (wm *WorktreeManager) Cleanup() error {
 	var errors []string
 
 	// Copy the list to avoid issues with removal changing the slice
+	wm.mutex.Lock()
 	worktrees := make([]string, len(wm.createdWorktrees))
 	copy(worktrees, wm.createdWorktrees)
+	wm.mutex.Unlock()
 
 	// Remove each worktree
 	for _, worktreePath := range worktrees {
@@ -130,8 +375,311 @@ func (wm *WorktreeManager) Cleanup() error {
 	return nil
 }
 
+// Retain keeps all worktrees created by this manager on disk for later inspection
+// They are marked so later runs don't reclaim them as orphans, and Cleanup no longer removes them
+// It returns the retained paths
+func (wm *WorktreeManager) Retain() ([]string, error) {
+	wm.mutex.Lock()
+	worktrees := wm.createdWorktrees
+	wm.createdWorktrees = []string{}
+	wm.baseCommits = make(map[string]string)
+	wm.mutex.Unlock()
+
+	var errors []string
+	for _, worktreePath := range worktrees {
+		if err := os.WriteFile(worktreePath+retainedSuffix, nil, 0644); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if len(errors) > 0 {
+		return worktrees, fmt.Errorf("failed to mark all worktrees as retained: %s", strings.Join(errors, "; "))
+	}
+
+	return worktrees, nil
+}
+
+// RetainedWorktrees lists the worktrees in the working directory that a previous run retained
+func (wm *WorktreeManager) RetainedWorktrees() ([]string, error) {
+	entries, err := os.ReadDir(wm.workingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read working directory: %w", err)
+	}
+
+	var retained []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), retainedSuffix)
+		if !ok || !strings.HasPrefix(name, "worktree-") {
+			continue
+		}
+
+		// Markers whose worktree was removed by hand are ignored
+		worktreePath := filepath.Join(wm.workingDir, name)
+		if info, err := os.Stat(worktreePath); err == nil && info.IsDir() {
+			retained = append(retained, worktreePath)
+		}
+	}
+
+	return retained, nil
+}
+
+// RemoveRetained removes the worktrees retained by previous runs, along with their markers
+// It returns the paths that were removed
+func (wm *WorktreeManager) RemoveRetained() ([]string, error) {
+	retained, err := wm.RetainedWorktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	registered, err := wm.registered()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var errors []string
+
+	for _, worktreePath := range retained {
+		if err := wm.removeUntracked(worktreePath, registered); err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+		removed = append(removed, worktreePath)
+	}
+
+	// Drop markers left without a worktree, including those whose worktree was just removed
+	markers, _ := filepath.Glob(filepath.Join(wm.workingDir, "worktree-*"+retainedSuffix))
+	for _, marker := range markers {
+		if _, err := os.Stat(strings.TrimSuffix(marker, retainedSuffix)); os.IsNotExist(err) {
+			_ = os.Remove(marker)
+		}
+	}
+
+	if err := wm.prune(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if len(errors) > 0 {
+		return removed, fmt.Errorf("failed to remove all retained worktrees: %s", strings.Join(errors, "; "))
+	}
+
+	return removed, nil
+}
+
+// RecoverOrphans removes worktrees left behind in the working directory by a previous run
+// that exited without cleaning up, and prunes git's stale worktree metadata
+// Worktrees retained for inspection are not orphans and are kept, as are those of processes still running
+// It returns the paths that were reclaimed
+func (wm *WorktreeManager) RecoverOrphans() ([]string, error) {
+	// Drop metadata for worktrees whose directories are already gone
+	if err := wm.prune(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(wm.workingDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read working directory: %w", err)
+	}
+
+	registered, err := wm.registered()
+	if err != nil {
+		return nil, err
+	}
+
+	var reclaimed []string
+	var errors []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "worktree-") {
+			continue
+		}
+
+		worktreePath := filepath.Join(wm.workingDir, entry.Name())
+		if wm.isTracked(worktreePath) {
+			continue
+		}
+		if _, err := os.Stat(worktreePath + retainedSuffix); err == nil {
+			continue
+		}
+		if ownerRunning(worktreePath) {
+			continue
+		}
+
+		if err := wm.removeUntracked(worktreePath, registered); err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+		_ = os.Remove(worktreePath + ownerSuffix)
+
+		reclaimed = append(reclaimed, worktreePath)
+	}
+
+	// Drop owner markers left without a worktree by processes that have exited
+	markers, _ := filepath.Glob(filepath.Join(wm.workingDir, "worktree-*"+ownerSuffix))
+	for _, marker := range markers {
+		worktreePath := strings.TrimSuffix(marker, ownerSuffix)
+		if _, err := os.Stat(worktreePath); os.IsNotExist(err) && !ownerRunning(worktreePath) {
+			_ = os.Remove(marker)
+		}
+	}
+
+	// Prune again to drop metadata for anything removed above
+	if err := wm.prune(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if len(errors) > 0 {
+		return reclaimed, fmt.Errorf("failed to recover all orphaned worktrees: %s", strings.Join(errors, "; "))
+	}
+
+	return reclaimed, nil
+}
+
 // Helper functions
 
+// createClone creates a checkout of ref at worktreePath using a shared clone
+// The clone borrows objects from the original repository, so any commit there
+// (including unreferenced snapshot commits) can be checked out
+func (wm *WorktreeManager) createClone(worktreePath, ref string) error {
+	// Resolve the ref in the original repository since branch names differ in the clone
+	output, err := exec.Command("git", "-C", wm.repoPath, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}").Output()
+	if err != nil {
+		return fmt.Errorf("failed to create worktree: unknown ref %s: %w", ref, err)
+	}
+	commit := strings.TrimSpace(string(output))
+
+	cmd := exec.Command("git", "clone", "--shared", "--no-checkout", "--quiet", wm.repoPath, worktreePath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create clone: %w - %s", err, output)
+	}
+
+	// Clones don't inherit repository-local config, so carry over the committer identity
+	for _, key := range []string{"user.name", "user.email"} {
+		if value, err := exec.Command("git", "-C", wm.repoPath, "config", key).Output(); err == nil {
+			_ = exec.Command("git", "-C", worktreePath, "config", key, strings.TrimSpace(string(value))).Run()
+		}
+	}
+
+	cmd = exec.Command("git", "-C", worktreePath, "checkout", "--quiet", "--detach", commit)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(worktreePath)
+		return fmt.Errorf("failed to check out %s in clone: %w - %s", ref, err, output)
+	}
+
+	return nil
+}
+
+// writeOwner marks a worktree as this process's
+func writeOwner(worktreePath string) error {
+	host, _ := os.Hostname()
+	if err := os.WriteFile(worktreePath+ownerSuffix, []byte(fmt.Sprintf("%d %s\n", os.Getpid(), host)), 0644); err != nil {
+		return fmt.Errorf("failed to mark worktree owner: %w", err)
+	}
+	return nil
+}
+
+// ownerRunning reports whether the process that created a worktree may still be using it
+// Worktrees without an owner were left half-created, or by versions that didn't mark them; processes on another
+// host, sharing the working directory, can't be checked and are assumed to run
+func ownerRunning(worktreePath string) bool {
+	data, err := os.ReadFile(worktreePath + ownerSuffix)
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return false
+	}
+	if host, _ := os.Hostname(); len(fields) > 1 && fields[1] != host {
+		return true
+	}
+	return procutil.Running(pid)
+}
+
+// removeUntracked removes a checkout this manager didn't create
+// registered holds the canonical paths of the worktrees git knows about
+func (wm *WorktreeManager) removeUntracked(worktreePath string, registered map[string]bool) error {
+	// Prefer git's own removal for worktrees it still knows about
+	if registered[canonicalPath(worktreePath)] {
+		cmd := exec.Command("git", "-C", wm.repoPath, "worktree", "remove", "--force", worktreePath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v - %s", worktreePath, err, output)
+		}
+		return nil
+	}
+
+	if err := os.RemoveAll(worktreePath); err != nil {
+		return fmt.Errorf("%s: %v", worktreePath, err)
+	}
+	return nil
+}
+
+// prune drops git's metadata for worktrees whose directories are gone
+func (wm *WorktreeManager) prune() error {
+	if wm.backend != BackendWorktree {
+		return nil
+	}
+	if output, err := exec.Command("git", "-C", wm.repoPath, "worktree", "prune").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to prune worktrees: %w - %s", err, output)
+	}
+	return nil
+}
+
+// registered returns the canonical paths of the worktrees git knows about, which is none for clones
+func (wm *WorktreeManager) registered() (map[string]bool, error) {
+	if wm.backend != BackendWorktree {
+		return make(map[string]bool), nil
+	}
+	return wm.registeredWorktrees()
+}
+
+// worktreesSupported reports whether git worktree commands work for the repository
+func worktreesSupported(repoPath string) bool {
+	return exec.Command("git", "-C", repoPath, "worktree", "list").Run() == nil
+}
+
+// registeredWorktrees returns the canonical paths of all worktrees git knows about for the repository
+func (wm *WorktreeManager) registeredWorktrees() (map[string]bool, error) {
+	output, err := exec.Command("git", "-C", wm.repoPath, "worktree", "list", "--porcelain").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	registered := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		if path, ok := strings.CutPrefix(line, "worktree "); ok {
+			registered[canonicalPath(path)] = true
+		}
+	}
+
+	return registered, nil
+}
+
+// isTracked reports whether the path was created by this manager
+func (wm *WorktreeManager) isTracked(worktreePath string) bool {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	for _, path := range wm.createdWorktrees {
+		if path == worktreePath {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalPath resolves symlinks so paths reported by git compare equal to ours
+func canonicalPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
 // validateGitRepo checks if the given path is a valid git repository
 func validateGitRepo(repoPath string) error {
 	// Check if the directory exists
@@ -169,31 +717,30 @@ func validateGitRepo(repoPath string) error {
 // isValidWorktree checks if the given path is a valid worktree created by this manager
 func (wm *WorktreeManager) isValidWorktree(worktreePath string) bool {
 	// Check if the path is in our list of created worktrees
-	for _, path := range wm.createdWorktrees {
-		if path == worktreePath {
-			// Check if it still exists and is a valid git worktree
-			cmd := exec.Command("git", "-C", worktreePath, "status")
-			if err := cmd.Run(); err == nil {
-				return true
-			}
-			break
-		}
+	if !wm.isTracked(worktreePath) {
+		return false
 	}
 
-	return false
+	// Check if it still exists and is a valid git worktree
+	cmd := exec.Command("git", "-C", worktreePath, "status")
+	return cmd.Run() == nil
 }
 
-// randomString generates a random string of the given length
-func randomString(length int) string {
+// randomString generates a cryptographically random string of the given length
+func randomString(length int) (string, error) {
 	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
 	b := make([]byte, length)
 
-	// Use a simple method for testing, in production a crypto random source would be better
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// The slight modulo bias is irrelevant for naming purposes
 	for i := range b {
-		b[i] = charset[i%len(charset)]
+		b[i] = charset[int(b[i])%len(charset)]
 	}
 
-	return string(b)
+	return string(b), nil
 }
 
 // RunGitCommand creates an exec.Cmd to run a git command in the given directory
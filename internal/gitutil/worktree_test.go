@@ -1,9 +1,12 @@
 package gitutil
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -101,6 +104,8 @@ func TestWorktreeManagerErrors(t *testing.T) {
 	// Test invalid ref
 	_, err = wm.CreateWorktree("test-agent", "non-existent-branch")
 	require.Error(t, err, "Should error with non-existent ref")
+	_, err = wm.CreateWorktree("test-agent", "--orphan")
+	require.ErrorContains(t, err, "invalid ref", "Refs are never taken as options")
 
 	// Test getting diff from invalid worktree path
 	_, err = wm.GetDiff("/invalid/path")
@@ -111,6 +116,331 @@ func TestWorktreeManagerErrors(t *testing.T) {
 	require.Error(t, err, "Should error with invalid worktree path")
 }
 
+func TestWorktreeManagerDiffIncludesCommits(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping worktree test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create worktree")
+
+	base, ok := wm.BaseCommit(worktreePath)
+	require.True(t, ok, "Base commit should be recorded")
+	assert.NotEmpty(t, base)
+
+	// The agent commits a new file, stages a rename, and leaves a new untracked file
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "committed.txt"), []byte("Committed by agent\n"), 0644))
+	for _, args := range [][]string{
+		{"add", "committed.txt"},
+		{"commit", "-m", "Agent commit"},
+		{"mv", "test-file.txt", "renamed.txt"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", worktreePath}, args...)...)
+		require.NoError(t, cmd.Run(), "git %v failed", args)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "new-file.txt"), []byte("Brand new\n"), 0644))
+
+	diff, err := wm.GetDiff(worktreePath)
+	require.NoError(t, err, "Failed to get diff")
+
+	// All three kinds of change should be in the diff
+	assert.Contains(t, diff, "+Committed by agent", "Committed changes should be included")
+	assert.Contains(t, diff, "rename to renamed.txt", "Staged renames should be included")
+	assert.Contains(t, diff, "+Brand new", "Untracked files should be included")
+
+	stats := GetDiffStats(diff)
+	assert.Equal(t, 3, stats.FilesChanged)
+	assert.Equal(t, 1, stats.RenamedFiles)
+
+	// The diff applies cleanly to the original repository
+	require.NoError(t, ApplyPatch(repoDir, diff))
+}
+
+func TestWorktreeManagerDiffLimit(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping worktree test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	defer wm.Cleanup()
+
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create worktree")
+	require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "big.txt"), []byte(strings.Repeat("line\n", 1000)), 0644))
+
+	// The diff is well within the default limit
+	diff, err := wm.GetDiff(worktreePath)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "+line")
+
+	// A limit below the diff's size fails it rather than returning part of it
+	wm.SetMaxDiffBytes(1024)
+	diff, err = wm.GetDiff(worktreePath)
+	assert.ErrorIs(t, err, ErrDiffTooLarge)
+	assert.Empty(t, diff)
+}
+
+func TestWorktreeManagerConcurrentCreate(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping worktree test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManager(repoDir, t.TempDir())
+	require.NoError(t, err, "Failed to create worktree manager")
+	wm.SetRunID("run-123")
+
+	// Create several worktrees for the same agent ID at once
+	const count = 4
+	paths := make([]string, count)
+	errs := make([]error, count)
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = wm.CreateWorktree("same-agent", "")
+		}(i)
+	}
+	wg.Wait()
+
+	// Every worktree should get its own run-scoped path
+	seen := make(map[string]bool)
+	for i := 0; i < count; i++ {
+		require.NoError(t, errs[i], "Failed to create worktree %d", i)
+		assert.Contains(t, filepath.Base(paths[i]), "worktree-run-123-same-agent-")
+		assert.False(t, seen[paths[i]], "Worktree paths should be unique")
+		seen[paths[i]] = true
+		verifyDirectory(t, paths[i])
+	}
+
+	require.NoError(t, wm.Cleanup(), "Failed to clean up worktrees")
+}
+
+func TestWorktreeManagerCreateWorktrees(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping worktree test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	for _, backend := range []Backend{BackendWorktree, BackendClone} {
+		wm, err := NewWorktreeManagerWithBackend(repoDir, t.TempDir(), backend)
+		require.NoError(t, err, "Failed to create worktree manager")
+
+		// Every agent gets its own checked-out worktree
+		agentIDs := []string{"agent1", "agent2", "agent3", "agent4", "agent5", "agent6"}
+		paths, errs := wm.CreateWorktrees(agentIDs, "")
+		require.Empty(t, errs, "Failed to create worktrees with the %s backend", backend)
+		require.Len(t, paths, len(agentIDs))
+		seen := make(map[string]bool)
+		for _, agentID := range agentIDs {
+			path := paths[agentID]
+			assert.False(t, seen[path], "Worktree paths should be unique")
+			seen[path] = true
+			content, err := os.ReadFile(filepath.Join(path, "test-file.txt"))
+			require.NoError(t, err, "Worktree should be checked out")
+			assert.Equal(t, "Initial content\n", string(content))
+			_, ok := wm.BaseCommit(path)
+			assert.True(t, ok, "Base commit should be recorded")
+			diff, err := wm.GetDiff(path)
+			require.NoError(t, err)
+			assert.Empty(t, diff, "A fresh worktree has no changes")
+		}
+
+		// Agents whose worktree can't be created get an error each
+		paths, errs = wm.CreateWorktrees([]string{"agent7", "agent8"}, "non-existent-branch")
+		assert.Empty(t, paths)
+		assert.Len(t, errs, 2)
+
+		require.NoError(t, wm.Cleanup(), "Failed to clean up worktrees")
+	}
+}
+
+func TestWorktreeManagerCloneBackend(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping worktree test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	wm, err := NewWorktreeManagerWithBackend(repoDir, t.TempDir(), BackendClone)
+	require.NoError(t, err, "Failed to create worktree manager")
+	assert.Equal(t, BackendClone, wm.Backend())
+
+	// Create a checkout and make a change
+	worktreePath, err := wm.CreateWorktree("test-agent", "")
+	require.NoError(t, err, "Failed to create clone")
+	verifyDirectory(t, filepath.Join(worktreePath, ".git"))
+	makeTestChange(t, worktreePath)
+
+	diff, err := wm.GetDiff(worktreePath)
+	require.NoError(t, err, "Failed to get diff")
+	assert.Contains(t, diff, "+Updated content")
+
+	// Branches committed in a clone are pushed back to the original repository
+	require.NoError(t, CommitToBranch(worktreePath, "orchestrator/clone-branch", "Update from clone"))
+	require.NoError(t, exec.Command("git", "-C", repoDir, "rev-parse", "--verify", "orchestrator/clone-branch").Run(),
+		"Branch should exist in the original repository")
+
+	// Unknown refs are rejected
+	_, err = wm.CreateWorktree("test-agent", "non-existent-branch")
+	require.Error(t, err, "Should error with non-existent ref")
+
+	// Removal deletes the clone
+	require.NoError(t, wm.RemoveWorktree(worktreePath))
+	_, err = os.Stat(worktreePath)
+	require.Error(t, err, "Clone should be removed")
+
+	// Unknown backends are rejected
+	_, err = NewWorktreeManagerWithBackend(repoDir, t.TempDir(), Backend("rsync"))
+	require.Error(t, err, "Should error with unknown backend")
+}
+
+func TestWorktreeManagerRecoverOrphans(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping worktree test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	worktreeDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	// Simulate a crashed run that left a registered worktree behind
+	crashed, err := NewWorktreeManager(repoDir, worktreeDir)
+	require.NoError(t, err, "Failed to create worktree manager")
+	orphanPath, err := crashed.CreateWorktree("orphan", "")
+	require.NoError(t, err, "Failed to create worktree")
+	exited := exec.Command("git", "--version")
+	require.NoError(t, exited.Run())
+	host, _ := os.Hostname()
+	require.NoError(t, os.WriteFile(orphanPath+ownerSuffix, []byte(fmt.Sprintf("%d %s\n", exited.Process.Pid, host)), 0644))
+
+	// A run still going in another process keeps its worktree, as does one on another host
+	running, err := NewWorktreeManager(repoDir, worktreeDir)
+	require.NoError(t, err, "Failed to create worktree manager")
+	runningPath, err := running.CreateWorktree("running", "")
+	require.NoError(t, err, "Failed to create worktree")
+	remotePath := filepath.Join(worktreeDir, "worktree-remote")
+	require.NoError(t, os.MkdirAll(remotePath, 0755))
+	require.NoError(t, os.WriteFile(remotePath+ownerSuffix, []byte(fmt.Sprintf("%d elsewhere.example\n", exited.Process.Pid)), 0644))
+
+	// And a leftover directory git no longer knows about
+	strayPath := filepath.Join(worktreeDir, "worktree-stray")
+	require.NoError(t, os.MkdirAll(strayPath, 0755))
+
+	// Unrelated directories are left alone
+	otherPath := filepath.Join(worktreeDir, "keep-me")
+	require.NoError(t, os.MkdirAll(otherPath, 0755))
+
+	// A new manager should reclaim both orphans
+	wm, err := NewWorktreeManager(repoDir, worktreeDir)
+	require.NoError(t, err, "Failed to create worktree manager")
+
+	// Worktrees created by this manager must survive recovery
+	ownPath, err := wm.CreateWorktree("own", "")
+	require.NoError(t, err, "Failed to create worktree")
+
+	reclaimed, err := wm.RecoverOrphans()
+	require.NoError(t, err, "Failed to recover orphans")
+	assert.ElementsMatch(t, []string{orphanPath, strayPath}, reclaimed)
+
+	_, err = os.Stat(orphanPath)
+	assert.Error(t, err, "Orphaned worktree should be removed")
+	_, err = os.Stat(strayPath)
+	assert.Error(t, err, "Stray directory should be removed")
+	verifyDirectory(t, otherPath)
+	verifyDirectory(t, ownPath)
+	verifyDirectory(t, runningPath)
+	verifyDirectory(t, remotePath)
+	_, err = os.Stat(orphanPath + ownerSuffix)
+	assert.Error(t, err, "Orphan's owner marker should be removed")
+
+	// Git should no longer list the orphan
+	output, err := exec.Command("git", "-C", repoDir, "worktree", "list").Output()
+	require.NoError(t, err)
+	assert.NotContains(t, string(output), "worktree-orphan")
+
+	require.NoError(t, wm.Cleanup())
+	require.NoError(t, running.Cleanup())
+}
+
+func TestWorktreeManagerRetain(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping worktree test in short mode")
+	}
+
+	repoDir := t.TempDir()
+	worktreeDir := t.TempDir()
+	initTestRepo(t, repoDir)
+
+	// Retain the worktree of a finished run with its changes
+	finished, err := NewWorktreeManager(repoDir, worktreeDir)
+	require.NoError(t, err, "Failed to create worktree manager")
+	keptPath, err := finished.CreateWorktree("kept", "")
+	require.NoError(t, err, "Failed to create worktree")
+	makeTestChange(t, keptPath)
+
+	retained, err := finished.Retain()
+	require.NoError(t, err, "Failed to retain worktrees")
+	assert.Equal(t, []string{keptPath}, retained)
+	require.NoError(t, finished.Cleanup())
+	verifyDirectory(t, keptPath)
+
+	// Later runs don't treat retained worktrees as orphans
+	wm, err := NewWorktreeManager(repoDir, worktreeDir)
+	require.NoError(t, err, "Failed to create worktree manager")
+	reclaimed, err := wm.RecoverOrphans()
+	require.NoError(t, err, "Failed to recover orphans")
+	assert.Empty(t, reclaimed)
+	verifyDirectory(t, keptPath)
+
+	listed, err := wm.RetainedWorktrees()
+	require.NoError(t, err, "Failed to list retained worktrees")
+	assert.Equal(t, []string{keptPath}, listed)
+
+	// Removing them deletes the worktree, its marker, and git's record of it
+	removed, err := wm.RemoveRetained()
+	require.NoError(t, err, "Failed to remove retained worktrees")
+	assert.Equal(t, []string{keptPath}, removed)
+
+	_, err = os.Stat(keptPath)
+	assert.Error(t, err, "Retained worktree should be removed")
+	_, err = os.Stat(keptPath + retainedSuffix)
+	assert.Error(t, err, "Marker should be removed")
+
+	output, err := exec.Command("git", "-C", repoDir, "worktree", "list").Output()
+	require.NoError(t, err)
+	assert.NotContains(t, string(output), "worktree-kept")
+
+	listed, err = wm.RetainedWorktrees()
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+}
+
 // Helper functions
 
 // initTestRepo initializes a git repository with a test file
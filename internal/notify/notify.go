@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/procutil"
+)
+
+// timeout bounds each notification so a slow webhook or command can't hold up the exit
+const timeout = 30 * time.Second
+
+// Notification describes the outcome of a finished run
+type Notification struct {
+	// Title is a short heading, e.g. "Orchestrator run solved"
+	Title string
+
+	// Summary is the one-line outcome of the run
+	Summary string
+
+	// ReportPath is where the run's report was written (empty if there is none)
+	ReportPath string
+
+	// RunID identifies the run (empty for a batch)
+	RunID string
+
+	// Success is false if the run failed or left its task unsolved
+	Success bool
+}
+
+// Body is the text of the notification: the summary followed by the report path
+func (n Notification) Body() string {
+	if n.ReportPath == "" {
+		return n.Summary
+	}
+	return n.Summary + "\nReport: " + n.ReportPath
+}
+
+// runCommand runs external programs; it is a variable so tests can observe desktop notifications
+var runCommand = func(ctx context.Context, name string, args []string, env []string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Send delivers a notification through every configured channel
+// A failing channel doesn't stop the others; their errors are joined
+func Send(ctx context.Context, cfg core.NotifyConfig, n Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var errs []error
+	if cfg.Desktop {
+		if err := desktop(ctx, n); err != nil {
+			errs = append(errs, fmt.Errorf("desktop notification: %w", err))
+		}
+	}
+	if cfg.Webhook != "" {
+		if err := post(ctx, cfg.Webhook, n.Title, n.Body()); err != nil {
+			errs = append(errs, fmt.Errorf("webhook notification: %w", err))
+		}
+	}
+	if cfg.Command != "" {
+		if err := command(ctx, cfg.Command, n); err != nil {
+			errs = append(errs, fmt.Errorf("notification command: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// desktop shows a notification with the platform's own tool
+func desktop(ctx context.Context, n Notification) error {
+	switch runtime.GOOS {
+	case "linux":
+		return runCommand(ctx, "notify-send", []string{"--app-name=orchestrator", n.Title, n.Body()}, nil)
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(n.Body()), appleScriptString(n.Title))
+		return runCommand(ctx, "osascript", []string{"-e", script}, nil)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+}
+
+// appleScriptString quotes text as an AppleScript string literal
+func appleScriptString(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
+
+// PostMessage posts a message with a bold title to a Slack or Discord incoming webhook
+// The text may use the Markdown both understand, such as code blocks
+func PostMessage(ctx context.Context, webhookURL, title, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return post(ctx, webhookURL, title, text)
+}
+
+// post sends a message to a Slack or Discord incoming webhook
+// Discord expects the message in "content" and Slack in "text"
+func post(ctx context.Context, webhookURL, title, text string) error {
+	payload := map[string]string{"text": fmt.Sprintf("*%s*\n%s", title, text)}
+	if u, err := url.Parse(webhookURL); err == nil && isDiscord(u.Hostname()) {
+		payload = map[string]string{"content": fmt.Sprintf("**%s**\n%s", title, text)}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL holds the webhook's credentials, so it is left out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// isDiscord reports whether a webhook host belongs to Discord
+func isDiscord(host string) bool {
+	return host == "discord.com" || host == "discordapp.com" || strings.HasSuffix(host, ".discord.com")
+}
+
+// command runs a shell command, through the platform's shell, with the outcome in its environment
+func command(ctx context.Context, shellCommand string, n Notification) error {
+	status := "success"
+	if !n.Success {
+		status = "failure"
+	}
+	env := []string{
+		"ORCHESTRATOR_STATUS=" + status,
+		"ORCHESTRATOR_TITLE=" + n.Title,
+		"ORCHESTRATOR_SUMMARY=" + n.Summary,
+		"ORCHESTRATOR_REPORT=" + n.ReportPath,
+		"ORCHESTRATOR_RUN_ID=" + n.RunID,
+	}
+	program, args := procutil.ShellArgs(procutil.DefaultShell(), shellCommand)
+	return runCommand(ctx, program, args, env)
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNotification = Notification{
+	Title:      "Orchestrator run solved",
+	Summary:    "Run 20240102-030405-abcdef solved by claude, scoring 170 (Tests now passing)",
+	ReportPath: "/tmp/runs/20240102-030405-abcdef/report.json",
+	RunID:      "20240102-030405-abcdef",
+	Success:    true,
+}
+
+func TestSendWebhook(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	require.NoError(t, Send(context.Background(), core.NotifyConfig{Webhook: server.URL}, testNotification))
+	assert.Equal(t, map[string]string{
+		"text": "*Orchestrator run solved*\nRun 20240102-030405-abcdef solved by claude, scoring 170 (Tests now passing)\nReport: /tmp/runs/20240102-030405-abcdef/report.json",
+	}, payload)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	err := Send(context.Background(), core.NotifyConfig{Webhook: failing.URL + "/T000/B000/secret"}, testNotification)
+	assert.ErrorContains(t, err, "403 Forbidden: invalid_token")
+	assert.NotContains(t, err.Error(), "secret")
+
+	assert.True(t, isDiscord("discord.com"))
+	assert.True(t, isDiscord("canary.discord.com"))
+	assert.False(t, isDiscord("hooks.slack.com"))
+}
+
+func TestSendCommand(t *testing.T) {
+	// Skip if running in short mode
+	if testing.Short() {
+		t.Skip("Skipping notification command test in short mode")
+	}
+
+	output := filepath.Join(t.TempDir(), "notification.txt")
+	cfg := core.NotifyConfig{Command: `printf '%s|%s|%s' "$ORCHESTRATOR_STATUS" "$ORCHESTRATOR_RUN_ID" "$ORCHESTRATOR_REPORT" > ` + output}
+	require.NoError(t, Send(context.Background(), cfg, testNotification))
+
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "success|20240102-030405-abcdef|/tmp/runs/20240102-030405-abcdef/report.json", string(data))
+
+	err = Send(context.Background(), core.NotifyConfig{Command: "echo broken >&2; exit 3"}, testNotification)
+	assert.ErrorContains(t, err, "broken")
+}
+
+func TestSendDesktop(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("Desktop notifications are not supported on " + runtime.GOOS)
+	}
+
+	var name string
+	var args []string
+	original := runCommand
+	runCommand = func(ctx context.Context, n string, a []string, env []string) error {
+		name, args = n, a
+		return nil
+	}
+	defer func() { runCommand = original }()
+
+	require.NoError(t, Send(context.Background(), core.NotifyConfig{Desktop: true}, testNotification))
+	switch runtime.GOOS {
+	case "linux":
+		assert.Equal(t, "notify-send", name)
+		assert.Equal(t, []string{"--app-name=orchestrator", testNotification.Title, testNotification.Body()}, args)
+	case "darwin":
+		assert.Equal(t, "osascript", name)
+		assert.True(t, strings.HasPrefix(args[1], `display notification "Run `), args[1])
+	}
+}
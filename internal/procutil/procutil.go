@@ -0,0 +1,196 @@
+// Package procutil runs external programs the same way on every platform: in a process group that can be killed
+// as a whole, through the platform's shells, and found where their installers put them
+package procutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Shells commands can be run through
+const (
+	// ShellSh is the POSIX shell, the default everywhere but Windows
+	ShellSh = "sh"
+
+	// ShellCmd is the Windows command interpreter, the default on Windows
+	ShellCmd = "cmd"
+
+	// ShellPowerShell is PowerShell: powershell on Windows and pwsh elsewhere
+	ShellPowerShell = "powershell"
+)
+
+// Shells lists the shells commands can be run through
+var Shells = []string{ShellSh, ShellCmd, ShellPowerShell}
+
+// Group is a started command together with every process it starts
+// On POSIX systems the command leads a process group of its own; on Windows it is assigned to a Job Object
+type Group struct {
+	cmd *exec.Cmd
+
+	mu   sync.Mutex
+	done bool
+	group
+}
+
+// Start starts cmd in a group of its own, so that killing the group stops whatever the command started too
+// A command made with exec.CommandContext kills the whole group when its context is done
+func Start(cmd *exec.Cmd) (*Group, error) {
+	g := &Group{cmd: cmd}
+	if err := g.prepare(cmd); err != nil {
+		return nil, err
+	}
+	if cmd.Cancel != nil {
+		cmd.Cancel = g.Kill
+	}
+	if err := cmd.Start(); err != nil {
+		g.release()
+		return nil, err
+	}
+	g.attach(cmd.Process)
+	return g, nil
+}
+
+// Kill stops every process in the group
+// It returns an error wrapping os.ErrProcessDone once the command has been waited for
+func (g *Group) Kill() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done {
+		return os.ErrProcessDone
+	}
+	return g.kill(g.cmd.Process)
+}
+
+// Wait waits for the command to exit, then stops anything it left running in its group, so background processes
+// it started don't outlive it
+func (g *Group) Wait() error {
+	err := g.cmd.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.done {
+		g.done = true
+		if killErr := g.kill(g.cmd.Process); killErr != nil && !errors.Is(killErr, os.ErrProcessDone) {
+			err = errors.Join(err, killErr)
+		}
+		g.release()
+	}
+	return err
+}
+
+// Running reports whether a process with the ID exists, as far as the platform can tell
+func Running(pid int) bool {
+	return pid > 0 && running(pid)
+}
+
+// DefaultShell returns the platform's shell: cmd on Windows and sh elsewhere
+func DefaultShell() string {
+	if runtime.GOOS == "windows" {
+		return ShellCmd
+	}
+	return ShellSh
+}
+
+// ShellArgs returns the program and arguments that run command through shell
+func ShellArgs(shell, command string) (string, []string) {
+	switch shell {
+	case ShellCmd:
+		return "cmd", []string{"/d", "/s", "/c", command}
+	case ShellPowerShell:
+		program := "pwsh"
+		if runtime.GOOS == "windows" {
+			program = "powershell"
+		}
+		return program, []string{"-NoProfile", "-NonInteractive", "-Command", command}
+	default:
+		return "sh", []string{"-c", command}
+	}
+}
+
+// ShellCommand returns the command that runs command through shell once started, killed when ctx is done
+// cmd gets the command line as written, since it doesn't understand the quoting other programs are given
+func ShellCommand(ctx context.Context, shell, command string) *exec.Cmd {
+	program, args := ShellArgs(shell, command)
+	cmd := exec.CommandContext(ctx, program, args...)
+	if shell == ShellCmd {
+		setCommandLine(cmd, `cmd /d /s /c "`+command+`"`)
+	}
+	return cmd
+}
+
+// LookPath finds a program on PATH, then in the places its installers commonly put it outside PATH
+func LookPath(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err == nil {
+		return path, nil
+	}
+	for _, candidate := range commonLocations(name) {
+		if info, statErr := os.Stat(candidate); statErr == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", err
+}
+
+// FindBinary returns where LookPath finds a program, or just its name, to be resolved when it is run
+func FindBinary(name string) string {
+	if path, err := LookPath(name); err == nil {
+		return path
+	}
+	return name
+}
+
+// commonLocations returns the paths a program may be installed at outside PATH on this platform:
+// Homebrew and user-local directories on POSIX systems, and npm's and per-user program directories on Windows
+func commonLocations(name string) []string {
+	home, _ := os.UserHomeDir()
+	var dirs []string
+	switch runtime.GOOS {
+	case "windows":
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			dirs = append(dirs, filepath.Join(appData, "npm"))
+		}
+		if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+			dirs = append(dirs, filepath.Join(localAppData, "Programs", name))
+		}
+	case "darwin":
+		dirs = append(dirs, "/opt/homebrew/bin", "/usr/local/bin")
+	default:
+		dirs = append(dirs, "/usr/local/bin", "/home/linuxbrew/.linuxbrew/bin")
+	}
+	if home != "" {
+		dirs = append(dirs, filepath.Join(home, ".local", "bin"), filepath.Join(home, ".npm-global", "bin"))
+	}
+
+	var candidates []string
+	for _, dir := range dirs {
+		for _, ext := range executableExtensions() {
+			candidates = append(candidates, filepath.Join(dir, name+ext))
+		}
+	}
+	return candidates
+}
+
+// executableExtensions returns the extensions a program's file may have: those in PATHEXT on Windows, and none elsewhere
+func executableExtensions() []string {
+	if runtime.GOOS != "windows" {
+		return []string{""}
+	}
+	pathext := os.Getenv("PATHEXT")
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd"
+	}
+	var exts []string
+	for _, ext := range strings.Split(strings.ToLower(pathext), ";") {
+		if ext != "" {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
@@ -0,0 +1,38 @@
+//go:build !unix && !windows
+
+package procutil
+
+import (
+	"os"
+	"os/exec"
+)
+
+// group can only reach the command itself on platforms without process groups or jobs
+type group struct{}
+
+// prepare has nothing to set up
+func (g *group) prepare(cmd *exec.Cmd) error {
+	return nil
+}
+
+// attach has nothing to do
+func (g *group) attach(process *os.Process) {}
+
+// kill kills the command's own process
+func (g *group) kill(process *os.Process) error {
+	if process == nil {
+		return os.ErrProcessDone
+	}
+	return process.Kill()
+}
+
+// release has nothing to free
+func (g *group) release() {}
+
+// setCommandLine has no effect, since programs get their arguments as given
+func setCommandLine(cmd *exec.Cmd, line string) {}
+
+// running can't tell whether a process exists, so it assumes it does
+func running(pid int) bool {
+	return true
+}
@@ -0,0 +1,120 @@
+package procutil
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperProcess is run by the other tests as a program that starts a child and outlives it
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv("PROCUTIL_HELPER") {
+	case "parent":
+		child := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+		child.Env = append(os.Environ(), "PROCUTIL_HELPER=child")
+		child.Stdout = os.Stdout
+		if err := child.Start(); err != nil {
+			os.Exit(1)
+		}
+		fmt.Println("started")
+		time.Sleep(time.Minute)
+	case "child":
+		time.Sleep(time.Minute)
+	default:
+		return
+	}
+	os.Exit(0)
+}
+
+func TestStart_KillsGroup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test that starts processes in short mode")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "PROCUTIL_HELPER=parent")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+
+	group, err := Start(cmd)
+	require.NoError(t, err)
+	reader := bufio.NewReader(stdout)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "started\n", line)
+
+	// The child shares the parent's stdout, so the output only ends once both are gone
+	cancel()
+	drained := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, reader)
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the child outlived its cancelled parent")
+	}
+	assert.Error(t, group.Wait())
+	assert.ErrorIs(t, group.Kill(), os.ErrProcessDone, "A group that was waited for has nothing left to kill")
+}
+
+func TestShellCommand(t *testing.T) {
+	program, args := ShellArgs(ShellSh, "go test ./... && echo done")
+	assert.Equal(t, "sh", program)
+	assert.Equal(t, []string{"-c", "go test ./... && echo done"}, args)
+
+	program, args = ShellArgs(ShellCmd, "go test ./...")
+	assert.Equal(t, "cmd", program)
+	assert.Equal(t, []string{"/d", "/s", "/c", "go test ./..."}, args)
+
+	program, args = ShellArgs(ShellPowerShell, "Invoke-Pester")
+	assert.Contains(t, []string{"powershell", "pwsh"}, program)
+	assert.Equal(t, []string{"-NoProfile", "-NonInteractive", "-Command", "Invoke-Pester"}, args)
+
+	if testing.Short() {
+		return
+	}
+	// The platform's own shell runs commands with its syntax
+	output, err := ShellCommand(context.Background(), DefaultShell(), "echo one && echo two").Output()
+	require.NoError(t, err)
+	assert.Regexp(t, `one\s*\r?\ntwo`, string(output))
+}
+
+func TestLookPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("PATH", t.TempDir())
+
+	name := "orchestrator-test-agent"
+	_, err := LookPath(name)
+	assert.Error(t, err)
+	assert.Equal(t, name, FindBinary(name), "Programs that aren't found are left for the system to resolve")
+
+	// Programs installed in a user-local directory outside PATH are found, with their extension on Windows
+	file := name
+	if runtime.GOOS == "windows" {
+		file += ".exe"
+	}
+	bin := filepath.Join(home, ".local", "bin")
+	require.NoError(t, os.MkdirAll(bin, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, file), []byte("#!/bin/sh\n"), 0o755))
+
+	path, err := LookPath(name)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(bin, file), path)
+	assert.Equal(t, path, FindBinary(name))
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package procutil
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// group is the process group a command leads, whose ID is the command's PID
+type group struct{}
+
+// prepare has the command start a process group of its own
+func (g *group) prepare(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	return nil
+}
+
+// attach has nothing to do, since the command's children join its process group as they start
+func (g *group) attach(process *os.Process) {}
+
+// kill sends SIGKILL to every process in the group
+func (g *group) kill(process *os.Process) error {
+	if process == nil {
+		return os.ErrProcessDone
+	}
+	if err := syscall.Kill(-process.Pid, syscall.SIGKILL); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
+
+// release has nothing to free
+func (g *group) release() {}
+
+// setCommandLine has no effect, since POSIX programs get their arguments as given
+func setCommandLine(cmd *exec.Cmd, line string) {}
+
+// running sends the process signal 0, which checks it exists without disturbing it
+func running(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
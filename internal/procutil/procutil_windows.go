@@ -0,0 +1,152 @@
+//go:build windows
+
+package procutil
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// Windows API functions for Job Objects, which syscall doesn't wrap
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+)
+
+const (
+	// jobObjectExtendedLimitInformation is the JOBOBJECTINFOCLASS of jobObjectExtendedLimit
+	jobObjectExtendedLimitInformation = 9
+
+	// jobObjectLimitKillOnJobClose kills the job's processes when its last handle is closed,
+	// so they don't outlive the orchestrator either
+	jobObjectLimitKillOnJobClose = 0x2000
+
+	// processSetQuota and processTerminate are the access rights assigning a process to a job needs
+	processSetQuota  = 0x0100
+	processTerminate = 0x0001
+
+	// processQueryLimitedInformation is the access right reading a process's exit code needs
+	processQueryLimitedInformation = 0x1000
+
+	// stillActive is the exit code of a process that hasn't exited
+	stillActive = 259
+)
+
+// jobObjectBasicLimit is JOBOBJECT_BASIC_LIMIT_INFORMATION
+type jobObjectBasicLimit struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+// jobObjectExtendedLimit is JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+type jobObjectExtendedLimit struct {
+	BasicLimitInformation jobObjectBasicLimit
+	IoInfo                [6]uint64
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// group is the Job Object holding the command and the processes it starts (0 if it couldn't be used)
+type group struct {
+	job syscall.Handle
+}
+
+// prepare creates the job, and keeps console interrupts meant for the orchestrator away from the command
+func (g *group) prepare(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		return fmt.Errorf("failed to create job object: %w", err)
+	}
+	info := jobObjectExtendedLimit{}
+	info.BasicLimitInformation.LimitFlags = jobObjectLimitKillOnJobClose
+	ok, _, err := procSetInformationJobObject.Call(job, jobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info))
+	if ok == 0 {
+		_ = syscall.CloseHandle(syscall.Handle(job))
+		return fmt.Errorf("failed to configure job object: %w", err)
+	}
+	g.job = syscall.Handle(job)
+	return nil
+}
+
+// attach assigns the started command to the job; processes it starts from then on join the job too
+// A command that can't be assigned is still killed on its own
+func (g *group) attach(process *os.Process) {
+	handle, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(process.Pid))
+	if err == nil {
+		defer syscall.CloseHandle(handle)
+		if ok, _, assignErr := procAssignProcessToJobObject.Call(uintptr(g.job), uintptr(handle)); ok == 0 {
+			err = assignErr
+		}
+	}
+	if err != nil {
+		slog.Warn("failed to assign process to job object; processes it starts won't be stopped with it", "pid", process.Pid, "error", err)
+		g.release()
+	}
+}
+
+// kill terminates every process in the job
+func (g *group) kill(process *os.Process) error {
+	if g.job == 0 {
+		if process == nil {
+			return os.ErrProcessDone
+		}
+		return process.Kill()
+	}
+	if ok, _, err := procTerminateJobObject.Call(uintptr(g.job), 1); ok == 0 {
+		return fmt.Errorf("failed to terminate job object: %w", err)
+	}
+	return nil
+}
+
+// release closes the job, which kills anything still in it
+func (g *group) release() {
+	if g.job != 0 {
+		_ = syscall.CloseHandle(g.job)
+		g.job = 0
+	}
+}
+
+// setCommandLine passes the command line to the program as written, rather than quoted from its arguments
+func setCommandLine(cmd *exec.Cmd, line string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = line
+}
+
+// running opens the process and checks it hasn't exited; processes of other users can't be opened, but exist
+func running(pid int) bool {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer syscall.CloseHandle(handle)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -72,6 +73,18 @@ type ActionPayload struct {
 	Diff string `json:"diff,omitempty"`
 }
 
+// CancelPayload contains data for a cancel event
+type CancelPayload struct {
+	// TargetAgentID is the agent asked to stop
+	TargetAgentID string `json:"target_agent_id"`
+
+	// Reason says why the agent is asked to stop
+	Reason string `json:"reason"`
+
+	// GraceSeconds is how long the agent has to wrap up before it is killed
+	GraceSeconds float64 `json:"grace_seconds"`
+}
+
 // ErrorPayload contains data for an error event
 type ErrorPayload struct {
 	// Message is the error message
@@ -163,6 +176,37 @@ func (e *Event) UnmarshalErrorPayload() (*ErrorPayload, error) {
 	return &payload, nil
 }
 
+// Snippet summarizes the event in one line (empty if it says nothing worth showing)
+func (e *Event) Snippet() string {
+	switch e.Type {
+	case EventTypeThinking:
+		if payload, err := e.UnmarshalThinkingPayload(); err == nil {
+			return firstLine(payload.Content)
+		}
+	case EventTypeAction:
+		if payload, err := e.UnmarshalActionPayload(); err == nil {
+			return strings.TrimSpace(payload.ActionType + " " + payload.FilePath)
+		}
+	case EventTypeError:
+		if payload, err := e.UnmarshalErrorPayload(); err == nil {
+			return "error: " + firstLine(payload.Message)
+		}
+	case EventTypeComplete:
+		return "complete"
+	}
+	return ""
+}
+
+// firstLine returns the first non-blank line of text
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
 // WriteNDJSON writes events to the given buffer in ND-JSON format
 func WriteNDJSON(buf *bytes.Buffer, events ...*Event) error {
 	for _, event := range events {
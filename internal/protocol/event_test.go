@@ -154,4 +154,21 @@ func TestPayloadTypeChecking(t *testing.T) {
 	// Correct type should work
 	_, err = event.UnmarshalActionPayload()
 	assert.NoError(t, err)
-}
\ No newline at end of file
+}
+
+func TestEventSnippet(t *testing.T) {
+	thinking, err := NewEvent(EventTypeThinking, "agent1", 1).WithPayload(ThinkingPayload{Content: "\n  Reading main.go\nthen tests"})
+	require.NoError(t, err)
+	assert.Equal(t, "Reading main.go", thinking.Snippet())
+
+	action, err := NewEvent(EventTypeAction, "agent1", 2).WithPayload(ActionPayload{ActionType: "file_edit", FilePath: "main.go"})
+	require.NoError(t, err)
+	assert.Equal(t, "file_edit main.go", action.Snippet())
+
+	failure, err := NewEvent(EventTypeError, "agent1", 3).WithPayload(ErrorPayload{Message: "boom\ntrace"})
+	require.NoError(t, err)
+	assert.Equal(t, "error: boom", failure.Snippet())
+
+	assert.Equal(t, "complete", NewEvent(EventTypeComplete, "agent1", 4).Snippet())
+	assert.Empty(t, NewEvent(EventTypePrompt, "agent1", 0).Snippet())
+}
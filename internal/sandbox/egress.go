@@ -0,0 +1,123 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ProxyCommand is the orchestrator subcommand that runs the Proxy inside an egress proxy container
+const ProxyCommand = "egress-proxy"
+
+// ProxyPort is the port the egress proxy listens on
+const ProxyPort = 3128
+
+// proxyBinary is where the orchestrator executable is mounted in an egress proxy container
+const proxyBinary = "/usr/local/bin/orchestrator-egress"
+
+// Egress names the internal network and proxy container of a NetworkAllowlist container
+type Egress struct {
+	// Network is the internal network the container joins, which reaches nothing outside it
+	Network string
+
+	// Proxy is the container on both the internal network and the bridge network that relays to allowed hosts
+	Proxy string
+}
+
+// EgressFor returns the network and proxy names of the container named name
+func EgressFor(name string) Egress {
+	return Egress{Network: name + "-net", Proxy: name + "-proxy"}
+}
+
+// proxyURL is where a container finds its egress proxy
+func (e Egress) proxyURL() string {
+	return "http://" + e.Proxy + ":" + strconv.Itoa(ProxyPort)
+}
+
+// StartEgress creates the internal network and the proxy a NetworkAllowlist container named name reaches
+// the allowed hosts through, and does nothing for other containers
+// The proxy runs this orchestrator executable in a container of the image, so it needs a Linux host
+func (c *Container) StartEgress(ctx context.Context, name string) error {
+	if c.Network != NetworkAllowlist {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("network allowlists run the orchestrator in a container as their proxy, which needs a Linux host, not %s", runtime.GOOS)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the orchestrator executable for the egress proxy: %w", err)
+	}
+
+	egress := EgressFor(name)
+	if err := c.run(ctx, "network", "create", "--internal", egress.Network); err != nil {
+		return err
+	}
+
+	// The proxy starts on the bridge network to reach out, then joins the internal one to be reached
+	proxyArgs := []string{
+		"run", "--detach",
+		"--name", egress.Proxy,
+		"--network", NetworkBridge,
+		"--read-only",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--pids-limit", strconv.Itoa(pidsLimit),
+		"--volume", executable + ":" + proxyBinary + ":ro",
+		"--entrypoint", proxyBinary,
+	}
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		proxyArgs = append(proxyArgs, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	proxyArgs = append(proxyArgs, c.Image, ProxyCommand, "--listen", ":"+strconv.Itoa(ProxyPort), "--allow", strings.Join(c.Allow, ","))
+
+	err = c.run(ctx, proxyArgs...)
+	if err == nil {
+		err = c.run(ctx, "network", "connect", egress.Network, egress.Proxy)
+	}
+	if err != nil {
+		_, stopErr := c.StopEgress(name)
+		return errors.Join(err, stopErr)
+	}
+	return nil
+}
+
+// StopEgress removes the proxy and internal network of the container named name, once the container is removed,
+// and returns the hosts the proxy refused, which the container's command tried to reach
+func (c *Container) StopEgress(name string) ([]string, error) {
+	if c.Network != NetworkAllowlist {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), removeTimeout)
+	defer cancel()
+
+	egress := EgressFor(name)
+	var denied []string
+	if output, err := exec.CommandContext(ctx, c.Runtime, "logs", egress.Proxy).CombinedOutput(); err == nil {
+		denied = deniedHosts(string(output))
+	}
+
+	err := c.Remove(egress.Proxy)
+	output, networkErr := exec.CommandContext(ctx, c.Runtime, "network", "rm", egress.Network).CombinedOutput()
+	// A network that was never created is already gone
+	message := strings.ToLower(string(output))
+	missing := strings.Contains(message, "not found") || strings.Contains(message, "no such network")
+	if networkErr != nil && !missing {
+		err = errors.Join(err, fmt.Errorf("failed to remove network %s: %w: %s", egress.Network, networkErr, strings.TrimSpace(string(output))))
+	}
+	return denied, err
+}
+
+// run runs the container CLI with args, including its output in any error
+func (c *Container) run(ctx context.Context, args ...string) error {
+	output, err := exec.CommandContext(ctx, c.Runtime, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", c.Runtime, strings.Join(args[:2], " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
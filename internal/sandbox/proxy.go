@@ -0,0 +1,174 @@
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deniedPrefix starts the line the proxy logs for each connection it refuses
+const deniedPrefix = "denied "
+
+// dialTimeout bounds connecting to an allowed host
+const dialTimeout = 30 * time.Second
+
+// hopHeaders are meaningful only between a client and the proxy, and are not forwarded
+var hopHeaders = []string{"Connection", "Proxy-Connection", "Proxy-Authorization", "Proxy-Authenticate", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// Proxy is an HTTP proxy that relays requests and CONNECT tunnels to allowed hosts and refuses all others
+// It is the only way out of an allowlisted container's network, so what it refuses can't be reached at all
+type Proxy struct {
+	allow     []string
+	transport http.RoundTripper
+
+	mutex sync.Mutex
+	log   io.Writer
+}
+
+// NewProxy returns a proxy to the hosts matched by allow, logging each host it refuses to log
+// Hosts are names such as api.openai.com, or patterns such as *.anthropic.com that match any subdomain
+func NewProxy(allow []string, log io.Writer) *Proxy {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// The proxy's own environment must not send requests on elsewhere
+	transport.Proxy = nil
+	return &Proxy{allow: allow, transport: transport, log: log}
+}
+
+// Allowed reports whether host, with or without a port, matches the allowlist
+func (p *Proxy) Allowed(host string) bool {
+	return HostAllowed(p.allow, host)
+}
+
+// HostAllowed reports whether host, with or without a port, matches one of the patterns in allow
+func HostAllowed(allow []string, host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, pattern := range allow {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP implements http.Handler
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if r.Method != http.MethodConnect {
+		if !r.URL.IsAbs() {
+			http.Error(w, "only proxy requests are served", http.StatusBadRequest)
+			return
+		}
+		host = r.URL.Host
+	}
+	if !p.Allowed(host) {
+		p.deny(host)
+		http.Error(w, fmt.Sprintf("%s is not on the agent's network allowlist", host), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, host)
+		return
+	}
+	p.forward(w, r)
+}
+
+// tunnel relays the client's connection to host, over which it usually speaks TLS
+func (p *Proxy) tunnel(w http.ResponseWriter, host string) {
+	upstream, err := net.DialTimeout("tcp", host, dialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunnels are not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	_, _ = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Anything the client sent after the request line is already buffered
+		_, _ = io.Copy(upstream, buffered)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+	client.Close()
+	upstream.Close()
+	<-done
+}
+
+// forward sends a plain HTTP request on to its host and copies back the response
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	outgoing := r.Clone(r.Context())
+	outgoing.RequestURI = ""
+	for _, header := range hopHeaders {
+		outgoing.Header.Del(header)
+	}
+
+	response, err := p.transport.RoundTrip(outgoing)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+
+	for _, header := range hopHeaders {
+		response.Header.Del(header)
+	}
+	for name, values := range response.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(response.StatusCode)
+	_, _ = io.Copy(w, response.Body)
+}
+
+// deny logs a refused host
+func (p *Proxy) deny(host string) {
+	if p.log == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	fmt.Fprintf(p.log, "%s%s\n", deniedPrefix, host)
+}
+
+// deniedHosts returns the hosts a proxy's log shows it refused, each once in the order first refused
+func deniedHosts(log string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(log, "\n") {
+		host, ok := strings.CutPrefix(strings.TrimSpace(line), deniedPrefix)
+		if !ok || host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
@@ -0,0 +1,106 @@
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostAllowed(t *testing.T) {
+	allow := []string{"api.openai.com", "*.anthropic.com"}
+
+	assert.True(t, HostAllowed(allow, "api.openai.com"))
+	assert.True(t, HostAllowed(allow, "API.OpenAI.com:443"), "Ports and case don't matter")
+	assert.True(t, HostAllowed(allow, "api.openai.com."))
+	assert.True(t, HostAllowed(allow, "api.anthropic.com:443"))
+	assert.False(t, HostAllowed(allow, "anthropic.com"), "A wildcard matches only subdomains")
+	assert.False(t, HostAllowed(allow, "openai.com"))
+	assert.False(t, HostAllowed(allow, "api.openai.com.evil.example"))
+	assert.False(t, HostAllowed(allow, "evilanthropic.com"))
+}
+
+func TestProxyForward(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	var log strings.Builder
+	proxy := httptest.NewServer(NewProxy([]string{"127.0.0.1"}, &log))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	response, err := client.Get(upstream.URL + "/v1/models")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "hello from /v1/models", string(body))
+
+	// The same server under a name that isn't allowed is refused, and the refusal logged
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(upstream.URL, "http://"))
+	response, err = client.Get("http://localhost:" + port + "/upload")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Equal(t, "denied localhost:"+port+"\n", log.String())
+}
+
+func TestProxyTunnel(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer upstream.Close()
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		_, _ = conn.Write([]byte("echo " + line))
+	}()
+
+	var log strings.Builder
+	proxy := httptest.NewServer(NewProxy([]string{"127.0.0.1"}, &log))
+	defer proxy.Close()
+
+	connect := func(host string) (net.Conn, *bufio.Reader, *http.Response) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(proxy.URL, "http://"))
+		require.NoError(t, err)
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", host, host)
+		reader := bufio.NewReader(conn)
+		response, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		return conn, reader, response
+	}
+
+	conn, reader, response := connect(upstream.Addr().String())
+	defer conn.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	fmt.Fprintf(conn, "ping\n")
+	reply, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "echo ping\n", reply)
+
+	denied, _, response := connect("example.com:443")
+	defer denied.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Equal(t, "denied example.com:443\n", log.String())
+}
+
+func TestDeniedHosts(t *testing.T) {
+	log := "denied example.com:443\nsomething else\ndenied paste.example:443\ndenied example.com:443\n"
+	assert.Equal(t, []string{"example.com:443", "paste.example:443"}, deniedHosts(log))
+	assert.Empty(t, deniedHosts(""))
+}
@@ -0,0 +1,165 @@
+// Package sandbox runs agents and test commands in containers that can see nothing of the host but one directory
+package sandbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Workdir is where the directory a command works in is mounted inside its container
+const Workdir = "/workspace"
+
+// Network modes of a container
+const (
+	// NetworkNone leaves a container with only a loopback interface
+	NetworkNone = "none"
+
+	// NetworkBridge gives a container the runtime's default outbound network, which agents need to reach their model API
+	NetworkBridge = "bridge"
+
+	// NetworkAllowlist confines a container to an internal network whose only way out is an egress proxy
+	// that reaches the hosts in Allow, so an agent can call its model API and nothing else
+	NetworkAllowlist = "allowlist"
+)
+
+// pidsLimit bounds the processes in a container, so a fork bomb in untrusted code can't exhaust the host
+const pidsLimit = 1024
+
+// removeTimeout bounds removing a container that outlived its command
+const removeTimeout = 30 * time.Second
+
+// Container describes the containers commands run in
+// Each container mounts only the command's directory, read-write at Workdir. The root filesystem is read-only,
+// every capability is dropped, privileges can't be regained, and the seccomp and AppArmor profiles are applied,
+// so whatever runs inside reaches the host only through the directory, its output, and its network
+type Container struct {
+	// Runtime is the container CLI, docker or podman
+	Runtime string
+
+	// Image is the image commands run in; it must provide them, e.g. agent CLIs and the test toolchain
+	Image string
+
+	// Network is NetworkNone, NetworkBridge, or NetworkAllowlist
+	Network string
+
+	// Allow lists the hosts a NetworkAllowlist container reaches, such as api.openai.com or *.anthropic.com
+	Allow []string
+
+	// SeccompProfile is the path of a seccomp profile (empty for the runtime's default profile)
+	SeccompProfile string
+
+	// AppArmorProfile is the name of a loaded AppArmor profile (empty for the runtime's default profile)
+	AppArmorProfile string
+
+	// Env names host environment variables passed into the container, such as API keys; no others are
+	Env []string
+
+	// MemoryBytes is the most memory the container may use (0 for no limit)
+	MemoryBytes int64
+}
+
+// NewName returns a unique container name for a command run for the named agent or purpose
+// The name lets a container that outlives its command, such as after the command is killed, be removed
+func NewName(purpose string) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return "orchestrator-" + nameUnsafe.ReplaceAllString(purpose, "-") + "-" + hex.EncodeToString(suffix)
+}
+
+// nameUnsafe matches characters container names can't have
+var nameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// Command returns the runtime invocation that runs command with args in a container named name, with dir mounted at Workdir
+// Commands given as host paths are run by name, since the host's paths don't exist in the image
+func (c *Container) Command(name, dir, command string, args []string) (string, []string) {
+	return c.CommandIn(name, dir, "", command, args)
+}
+
+// CommandIn is Command run from subdir, a slash-separated path inside dir, rather than from Workdir itself
+func (c *Container) CommandIn(name, dir, subdir, command string, args []string) (string, []string) {
+	network := c.Network
+	if network == NetworkAllowlist {
+		network = EgressFor(name).Network
+	}
+	runArgs := []string{
+		"run", "--rm", "--interactive",
+		"--name", name,
+		"--network", network,
+		"--read-only",
+		"--tmpfs", "/tmp",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--pids-limit", strconv.Itoa(pidsLimit),
+		"--volume", dir + ":" + Workdir,
+		"--workdir", path.Join(Workdir, subdir),
+		// Tools that keep state in the home directory find a writable one
+		"--env", "HOME=/tmp",
+	}
+	if c.SeccompProfile != "" {
+		runArgs = append(runArgs, "--security-opt", "seccomp="+c.SeccompProfile)
+	}
+	if c.AppArmorProfile != "" {
+		runArgs = append(runArgs, "--security-opt", "apparmor="+c.AppArmorProfile)
+	}
+	if c.MemoryBytes > 0 {
+		runArgs = append(runArgs, "--memory", strconv.FormatInt(c.MemoryBytes, 10))
+	}
+
+	// Files written to the directory stay owned by the user running the orchestrator
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		runArgs = append(runArgs, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+
+	// Clients that honor the proxy variables, as model API SDKs do, reach the allowed hosts through the egress proxy
+	if c.Network == NetworkAllowlist {
+		proxyURL := EgressFor(name).proxyURL()
+		for _, env := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+			runArgs = append(runArgs, "--env", env+"="+proxyURL)
+		}
+	}
+
+	// Only the values of named variables are passed, and only those set on the host
+	for _, env := range c.Env {
+		if _, ok := os.LookupEnv(env); ok {
+			runArgs = append(runArgs, "--env", env)
+		}
+	}
+
+	if filepath.IsAbs(command) {
+		command = filepath.Base(command)
+	}
+	runArgs = append(runArgs, c.Image, command)
+	return c.Runtime, append(runArgs, args...)
+}
+
+// Remove removes a container if it is still there, such as after its command was killed
+// Killing the runtime CLI doesn't stop the container it started, so commands are always followed by Remove
+func (c *Container) Remove(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), removeTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, c.Runtime, "rm", "--force", name).CombinedOutput()
+	// Docker and Podman word a missing container differently
+	missing := strings.Contains(strings.ToLower(string(output)), "no such container") || strings.Contains(string(output), "no container with")
+	if err != nil && !missing {
+		return fmt.Errorf("failed to remove container %s: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// WithNetwork returns a copy of the container description with another network mode
+func (c *Container) WithNetwork(network string) *Container {
+	copied := *c
+	copied.Network = network
+	return &copied
+}
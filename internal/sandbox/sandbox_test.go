@@ -0,0 +1,132 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewName(t *testing.T) {
+	name := NewName("claude/2")
+	assert.Regexp(t, `^orchestrator-claude-2-[0-9a-f]{8}$`, name)
+	assert.NotEqual(t, name, NewName("claude/2"))
+}
+
+func TestContainerCommand(t *testing.T) {
+	t.Setenv("SANDBOX_TEST_KEY", "secret")
+	container := &Container{
+		Runtime:         "podman",
+		Image:           "sandbox:latest",
+		Network:         NetworkNone,
+		SeccompProfile:  "/etc/orchestrator/seccomp.json",
+		AppArmorProfile: "orchestrator",
+		Env:             []string{"SANDBOX_TEST_KEY", "SANDBOX_TEST_UNSET"},
+		MemoryBytes:     512 << 20,
+	}
+
+	program, args := container.Command("orchestrator-tests-1", "/tmp/worktree", "/usr/local/bin/go", []string{"test", "./..."})
+	assert.Equal(t, "podman", program)
+	line := strings.Join(args, " ")
+	for _, want := range []string{
+		"run --rm --interactive --name orchestrator-tests-1 --network none --read-only",
+		"--cap-drop ALL",
+		"--security-opt no-new-privileges",
+		"--volume /tmp/worktree:/workspace --workdir /workspace",
+		"--security-opt seccomp=/etc/orchestrator/seccomp.json",
+		"--security-opt apparmor=orchestrator",
+		"--memory 536870912",
+		"--env SANDBOX_TEST_KEY ",
+	} {
+		assert.Contains(t, line, want)
+	}
+
+	// Values never appear on the command line, and unset variables aren't passed
+	assert.NotContains(t, line, "secret")
+	assert.NotContains(t, line, "SANDBOX_TEST_UNSET")
+
+	// The host's path to the command means nothing in the image
+	assert.True(t, strings.HasSuffix(line, "sandbox:latest go test ./..."), line)
+
+	// Commands run from a subdirectory still see the whole directory
+	_, args = container.CommandIn("orchestrator-tests-2", "/tmp/worktree", "services/api", "go", []string{"test", "./..."})
+	assert.Contains(t, strings.Join(args, " "), "--volume /tmp/worktree:/workspace --workdir /workspace/services/api")
+}
+
+func TestContainerRemove(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test that runs a fake container runtime in short mode")
+	}
+
+	// A fake runtime reports a missing container like Docker does, and fails for anything else
+	runtime := filepath.Join(t.TempDir(), "docker")
+	script := `#!/bin/sh
+if [ "$3" = "orchestrator-gone" ]; then echo "Error: No such container: $3" >&2; exit 1; fi
+if [ "$3" = "orchestrator-stuck" ]; then echo "Error: cannot kill container" >&2; exit 1; fi
+exit 0
+`
+	require.NoError(t, os.WriteFile(runtime, []byte(script), 0755))
+	container := &Container{Runtime: runtime}
+
+	assert.NoError(t, container.Remove("orchestrator-running"))
+	assert.NoError(t, container.Remove("orchestrator-gone"), "A container that already exited is removed")
+	assert.ErrorContains(t, container.Remove("orchestrator-stuck"), "cannot kill container")
+}
+
+func TestContainerCommandAllowlist(t *testing.T) {
+	container := &Container{Runtime: "docker", Image: "sandbox:latest", Network: NetworkAllowlist, Allow: []string{"api.openai.com"}}
+
+	_, args := container.Command("orchestrator-codex-1", "/tmp/worktree", "codex", nil)
+	line := strings.Join(args, " ")
+	assert.Contains(t, line, "--network orchestrator-codex-1-net ")
+	assert.Contains(t, line, "--env HTTPS_PROXY=http://orchestrator-codex-1-proxy:3128")
+	assert.Contains(t, line, "--env http_proxy=http://orchestrator-codex-1-proxy:3128")
+}
+
+func TestContainerEgress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test that runs a fake container runtime in short mode")
+	}
+
+	// A fake runtime records how it was invoked, and the proxy's logs show one refused host
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	runtime := filepath.Join(dir, "docker")
+	script := `#!/bin/sh
+echo "$@" >> ` + calls + `
+if [ "$1" = "logs" ]; then echo "denied paste.example:443"; fi
+exit 0
+`
+	require.NoError(t, os.WriteFile(runtime, []byte(script), 0755))
+	container := &Container{Runtime: runtime, Image: "sandbox:latest", Network: NetworkAllowlist, Allow: []string{"api.openai.com", "*.anthropic.com"}}
+
+	require.NoError(t, container.StartEgress(context.Background(), "orchestrator-codex-1"))
+	denied, err := container.StopEgress("orchestrator-codex-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"paste.example:443"}, denied)
+
+	recorded, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(recorded)), "\n")
+	require.Len(t, lines, 6)
+	assert.Equal(t, "network create --internal orchestrator-codex-1-net", lines[0])
+	assert.Contains(t, lines[1], "run --detach --name orchestrator-codex-1-proxy --network bridge --read-only")
+	assert.True(t, strings.HasSuffix(lines[1], "sandbox:latest egress-proxy --listen :3128 --allow api.openai.com,*.anthropic.com"), lines[1])
+	assert.Equal(t, "network connect orchestrator-codex-1-net orchestrator-codex-1-proxy", lines[2])
+	assert.Equal(t, "logs orchestrator-codex-1-proxy", lines[3])
+	assert.Equal(t, "rm --force orchestrator-codex-1-proxy", lines[4])
+	assert.Equal(t, "network rm orchestrator-codex-1-net", lines[5])
+
+	// Containers with any other network need no proxy
+	bridged := &Container{Runtime: runtime, Network: NetworkBridge}
+	require.NoError(t, bridged.StartEgress(context.Background(), "orchestrator-claude-1"))
+	denied, err = bridged.StopEgress("orchestrator-claude-1")
+	require.NoError(t, err)
+	assert.Empty(t, denied)
+	recorded, _ = os.ReadFile(calls)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(recorded)), "\n"), 6)
+}
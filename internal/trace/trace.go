@@ -0,0 +1,292 @@
+// Package trace records a run as an OpenTelemetry trace and exports it over OTLP/HTTP
+// Spans are kept in memory and sent in one request when the run finishes, so tracing
+// never slows the run down or makes it depend on the collector being reachable
+package trace
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeout bounds the export so an unreachable collector can't hold up the exit
+const timeout = 10 * time.Second
+
+// TracesPath is where OTLP/HTTP collectors receive traces, relative to their base URL
+const TracesPath = "/v1/traces"
+
+// Tracer collects the spans of one trace
+type Tracer struct {
+	// serviceName identifies the orchestrator in the tracing backend
+	serviceName string
+
+	// traceID is shared by every span of the trace
+	traceID string
+
+	// mutex protects spans and the attributes and status of spans still being recorded
+	mutex sync.Mutex
+
+	// spans holds the spans that have ended, in the order they ended
+	spans []*Span
+}
+
+// NewTracer creates a tracer for a new trace
+func NewTracer(serviceName string) *Tracer {
+	return &Tracer{serviceName: serviceName, traceID: randomID(16)}
+}
+
+// TraceID returns the hex-encoded ID of the trace
+func (t *Tracer) TraceID() string {
+	return t.traceID
+}
+
+// Start begins a root span of the trace and returns a context carrying it
+// A nil tracer records nothing, so callers don't need to check whether tracing is enabled
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := t.newSpan(name, "")
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Spans returns the spans that have ended
+func (t *Tracer) Spans() []*Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]*Span(nil), t.spans...)
+}
+
+// newSpan starts a span with the given parent ("" for a root span)
+func (t *Tracer) newSpan(name, parentID string) *Span {
+	return &Span{
+		tracer:     t,
+		Name:       name,
+		ID:         randomID(8),
+		ParentID:   parentID,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+// Start begins a child of the span carried by ctx and returns a context carrying the child
+// Without a span in ctx nothing is recorded and the returned span is nil, which is safe to use
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent, _ := ctx.Value(spanKey{}).(*Span)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.newSpan(name, parent.ID)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Span is one timed stage of a run
+// All methods may be called on a nil span, which records nothing
+type Span struct {
+	tracer *Tracer
+
+	// Name describes the stage, e.g. "baseline tests"
+	Name string
+
+	// ID and ParentID are hex-encoded span IDs (ParentID is empty for the root span)
+	ID       string
+	ParentID string
+
+	// Start and End are when the stage began and finished
+	Start time.Time
+	End   time.Time
+
+	// Attributes describe the stage, e.g. the agent it belongs to
+	Attributes map[string]interface{}
+
+	// Error is why the stage failed (empty if it succeeded)
+	Error string
+}
+
+// SetAttribute records a string, bool, integer, float, or duration describing the span
+// Durations are recorded in seconds
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	if d, ok := value.(time.Duration); ok {
+		value = d.Seconds()
+	}
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.Attributes[key] = value
+}
+
+// Fail marks the span as failed with a message; an empty message leaves the span as it is
+func (s *Span) Fail(message string) {
+	if s == nil || message == "" {
+		return
+	}
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.Error = message
+}
+
+// SetError marks the span as failed if err is not nil
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.Fail(err.Error())
+	}
+}
+
+// Finish ends the span, adding it to its trace; later calls have no effect
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	if !s.End.IsZero() {
+		return
+	}
+	s.End = time.Now()
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+// Export sends the trace's finished spans to an OTLP/HTTP collector as JSON
+// endpoint is the collector's base URL, e.g. http://localhost:4318, or its full traces URL
+func (t *Tracer) Export(ctx context.Context, endpoint string, headers map[string]string) error {
+	spans := t.Spans()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode trace: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, TracesURL(endpoint), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL may hold credentials, so it is left out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// TracesURL returns the URL traces are posted to for a collector endpoint
+func TracesURL(endpoint string) string {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if strings.HasSuffix(endpoint, TracesPath) {
+		return endpoint
+	}
+	return endpoint + TracesPath
+}
+
+// encode converts spans to an OTLP ExportTraceServiceRequest in its JSON encoding
+func (t *Tracer) encode(spans []*Span) map[string]interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		entry := map[string]interface{}{
+			"traceId":           t.traceID,
+			"spanId":            span.ID,
+			"name":              span.Name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        encodeAttributes(span.Attributes),
+			"status":            map[string]interface{}{"code": 1}, // STATUS_CODE_OK
+		}
+		if span.ParentID != "" {
+			entry["parentSpanId"] = span.ParentID
+		}
+		if span.Error != "" {
+			entry["status"] = map[string]interface{}{"code": 2, "message": span.Error} // STATUS_CODE_ERROR
+		}
+		encoded = append(encoded, entry)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": encodeAttributes(map[string]interface{}{"service.name": t.serviceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "github.com/brettsmith212/orchestrator"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// encodeAttributes converts attributes to OTLP key-value pairs, sorted by key
+func encodeAttributes(attributes map[string]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	encoded := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attributes[key].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": value})
+	}
+	return encoded
+}
+
+// randomID returns n random bytes, hex-encoded, for trace and span IDs
+func randomID(n int) string {
+	id := make([]byte, n)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,121 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	tracer := NewTracer("orchestrator")
+	assert.Len(t, tracer.TraceID(), 32)
+
+	ctx, root := tracer.Start(context.Background(), "run")
+	root.SetAttribute("run.id", "20240102-030405-abcdef")
+
+	_, agent := Start(ctx, "agent")
+	agent.SetAttribute("agent.id", "claude")
+	agent.SetAttribute("agent.duration", 1500*time.Millisecond)
+	agent.Fail("idle limit exceeded: no activity for 2m0s")
+	agent.Finish()
+	agent.Finish()
+
+	_, baseline := Start(ctx, "baseline tests")
+	baseline.SetError(errors.New("tests did not run"))
+	baseline.SetError(nil)
+	baseline.Finish()
+	root.Finish()
+
+	spans := tracer.Spans()
+	require.Len(t, spans, 3, "Spans are recorded once, when they finish")
+	assert.Equal(t, "agent", spans[0].Name)
+	assert.Equal(t, root.ID, spans[0].ParentID)
+	assert.Equal(t, 1.5, spans[0].Attributes["agent.duration"], "Durations are recorded in seconds")
+	assert.Equal(t, "idle limit exceeded: no activity for 2m0s", spans[0].Error)
+	assert.Equal(t, "tests did not run", spans[1].Error)
+	assert.Empty(t, spans[2].ParentID)
+	assert.False(t, spans[2].End.Before(spans[2].Start))
+
+	// Without a tracer nothing is recorded, and the nil spans are safe to use
+	var off *Tracer
+	ctx, span := off.Start(context.Background(), "run")
+	assert.Nil(t, span)
+	span.SetAttribute("run.id", "x")
+	span.SetError(errors.New("failed"))
+	span.Finish()
+	_, child := Start(ctx, "agent")
+	assert.Nil(t, child)
+}
+
+func TestExport(t *testing.T) {
+	var request struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]interface{} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []map[string]interface{} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret-key", r.Header.Get("X-Api-Key"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+	}))
+	defer server.Close()
+
+	tracer := NewTracer("orchestrator")
+	require.NoError(t, tracer.Export(context.Background(), server.URL, nil), "An empty trace isn't sent")
+	assert.Empty(t, request.ResourceSpans)
+
+	ctx, root := tracer.Start(context.Background(), "run")
+	_, agent := Start(ctx, "agent")
+	agent.SetAttribute("agent.id", "claude")
+	agent.SetAttribute("agent.tokens", 1200)
+	agent.SetAttribute("agent.cost_usd", 0.25)
+	agent.SetAttribute("agent.partial", true)
+	agent.Fail("stopped")
+	agent.Finish()
+	root.Finish()
+
+	require.NoError(t, tracer.Export(context.Background(), server.URL+"/", map[string]string{"X-Api-Key": "secret-key"}))
+	require.Len(t, request.ResourceSpans, 1)
+	assert.Equal(t, []map[string]interface{}{
+		{"key": "service.name", "value": map[string]interface{}{"stringValue": "orchestrator"}},
+	}, request.ResourceSpans[0].Resource.Attributes)
+
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, tracer.TraceID(), spans[0]["traceId"])
+	assert.Equal(t, root.ID, spans[0]["parentSpanId"])
+	assert.Equal(t, map[string]interface{}{"code": float64(2), "message": "stopped"}, spans[0]["status"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "agent.cost_usd", "value": map[string]interface{}{"doubleValue": 0.25}},
+		map[string]interface{}{"key": "agent.id", "value": map[string]interface{}{"stringValue": "claude"}},
+		map[string]interface{}{"key": "agent.partial", "value": map[string]interface{}{"boolValue": true}},
+		map[string]interface{}{"key": "agent.tokens", "value": map[string]interface{}{"intValue": "1200"}},
+	}, spans[0]["attributes"])
+	assert.NotContains(t, spans[1], "parentSpanId")
+	assert.Equal(t, map[string]interface{}{"code": float64(1)}, spans[1]["status"])
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	assert.ErrorContains(t, tracer.Export(context.Background(), failing.URL, nil), "401 Unauthorized: unauthorized")
+}
+
+func TestTracesURL(t *testing.T) {
+	assert.Equal(t, "http://localhost:4318/v1/traces", TracesURL("http://localhost:4318"))
+	assert.Equal(t, "http://localhost:4318/v1/traces", TracesURL("http://localhost:4318/"))
+	assert.Equal(t, "https://otlp.example.com/v1/traces", TracesURL("https://otlp.example.com/v1/traces"))
+}
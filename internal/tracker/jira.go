@@ -0,0 +1,175 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Jira is a client for the Jira REST API (version 2, which takes and returns plain-text descriptions and comments)
+type Jira struct {
+	// BaseURL is the site's root, e.g. https://example.atlassian.net
+	BaseURL string
+
+	// Email and Token authenticate with basic auth on Jira Cloud; without an email the token is sent
+	// as a bearer personal access token, as Jira Data Center expects
+	Email string
+	Token string
+
+	// Transition is the name of the transition, or of the status it leads to, applied by Resolve
+	Transition string
+
+	// HTTP sends the requests
+	HTTP *http.Client
+}
+
+// NewJira creates a Jira client
+func NewJira(baseURL, email, token, transition string) *Jira {
+	return &Jira{BaseURL: baseURL, Email: email, Token: token, Transition: transition, HTTP: &http.Client{Timeout: timeout}}
+}
+
+// Name returns "Jira"
+func (j *Jira) Name() string {
+	return "Jira"
+}
+
+// Issue fetches an issue with its comments
+func (j *Jira) Issue(ctx context.Context, key string) (*Issue, error) {
+	var issue struct {
+		ID     string `json:"id"`
+		Key    string `json:"key"`
+		Fields struct {
+			Summary     string `json:"summary"`
+			Description string `json:"description"`
+			Comment     struct {
+				Comments []struct {
+					Body   string `json:"body"`
+					Author struct {
+						DisplayName string `json:"displayName"`
+					} `json:"author"`
+				} `json:"comments"`
+			} `json:"comment"`
+		} `json:"fields"`
+	}
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "?fields=summary,description,comment"
+	if err := j.do(ctx, http.MethodGet, path, nil, &issue); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", key, err)
+	}
+
+	result := &Issue{
+		Key:         issue.Key,
+		id:          issue.ID,
+		Title:       issue.Fields.Summary,
+		Description: issue.Fields.Description,
+		URL:         strings.TrimRight(j.BaseURL, "/") + "/browse/" + issue.Key,
+	}
+	for _, comment := range issue.Fields.Comment.Comments {
+		result.Comments = append(result.Comments, Comment{Author: comment.Author.DisplayName, Body: comment.Body})
+	}
+	return result, nil
+}
+
+// Comment posts a comment on an issue
+func (j *Jira) Comment(ctx context.Context, issue *Issue, body string) error {
+	path := "/rest/api/2/issue/" + url.PathEscape(issue.Key) + "/comment"
+	if err := j.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("failed to comment on %s: %w", issue.Key, err)
+	}
+	return nil
+}
+
+// Resolve applies the configured transition to an issue
+// The transition is found by its name or the name of the status it leads to, since either is what users see
+func (j *Jira) Resolve(ctx context.Context, issue *Issue) error {
+	if j.Transition == "" {
+		return nil
+	}
+
+	var available struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	path := "/rest/api/2/issue/" + url.PathEscape(issue.Key) + "/transitions"
+	if err := j.do(ctx, http.MethodGet, path, nil, &available); err != nil {
+		return fmt.Errorf("failed to fetch transitions of %s: %w", issue.Key, err)
+	}
+	for _, transition := range available.Transitions {
+		if strings.EqualFold(transition.Name, j.Transition) || strings.EqualFold(transition.To.Name, j.Transition) {
+			body := map[string]interface{}{"transition": map[string]string{"id": transition.ID}}
+			if err := j.do(ctx, http.MethodPost, path, body, nil); err != nil {
+				return fmt.Errorf("failed to transition %s: %w", issue.Key, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%s has no transition named %q from its current status", issue.Key, j.Transition)
+}
+
+// do sends a request with an optional JSON body and decodes a JSON response into out, if not nil
+func (j *Jira) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(j.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if j.Email != "" {
+		req.SetBasicAuth(j.Email, j.Token)
+	} else if j.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+j.Token)
+	}
+
+	resp, err := j.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Error responses list what went wrong
+		var apiErr struct {
+			ErrorMessages []string          `json:"errorMessages"`
+			Errors        map[string]string `json:"errors"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil {
+			messages := apiErr.ErrorMessages
+			for field, message := range apiErr.Errors {
+				messages = append(messages, field+": "+message)
+			}
+			if len(messages) > 0 {
+				return fmt.Errorf("Jira API returned %s: %s", resp.Status, strings.Join(messages, "; "))
+			}
+		}
+		return fmt.Errorf("Jira API returned %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse Jira API response: %w", err)
+	}
+	return nil
+}
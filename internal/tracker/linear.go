@@ -0,0 +1,209 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// LinearAPI is Linear's GraphQL endpoint
+const LinearAPI = "https://api.linear.app/graphql"
+
+// Linear is a client for the Linear GraphQL API
+type Linear struct {
+	// URL is the GraphQL endpoint
+	URL string
+
+	// Token is a Linear API key
+	Token string
+
+	// State is the name of the workflow state Resolve moves issues to
+	State string
+
+	// HTTP sends the requests
+	HTTP *http.Client
+}
+
+// NewLinear creates a Linear client
+func NewLinear(token, state string) *Linear {
+	return &Linear{URL: LinearAPI, Token: token, State: state, HTTP: &http.Client{Timeout: timeout}}
+}
+
+// Name returns "Linear"
+func (l *Linear) Name() string {
+	return "Linear"
+}
+
+// linearIssueQuery fetches an issue by its key with its comments
+const linearIssueQuery = `query Issue($id: String!) {
+  issue(id: $id) {
+    id
+    identifier
+    title
+    description
+    url
+    comments(first: 100) { nodes { body createdAt user { name } } }
+  }
+}`
+
+// Issue fetches an issue with its comments
+func (l *Linear) Issue(ctx context.Context, key string) (*Issue, error) {
+	var data struct {
+		Issue *struct {
+			ID          string `json:"id"`
+			Identifier  string `json:"identifier"`
+			Title       string `json:"title"`
+			Description string `json:"description"`
+			URL         string `json:"url"`
+			Comments    struct {
+				Nodes []struct {
+					Body      string `json:"body"`
+					CreatedAt string `json:"createdAt"`
+					User      *struct {
+						Name string `json:"name"`
+					} `json:"user"`
+				} `json:"nodes"`
+			} `json:"comments"`
+		} `json:"issue"`
+	}
+	if err := l.do(ctx, linearIssueQuery, map[string]interface{}{"id": key}, &data); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", key, err)
+	}
+	if data.Issue == nil {
+		return nil, fmt.Errorf("failed to fetch %s: issue not found", key)
+	}
+
+	issue := &Issue{
+		Key:         data.Issue.Identifier,
+		id:          data.Issue.ID,
+		Title:       data.Issue.Title,
+		Description: data.Issue.Description,
+		URL:         data.Issue.URL,
+	}
+	// Comments come newest first; the prompt reads them oldest first
+	nodes := data.Issue.Comments.Nodes
+	for i := len(nodes) - 1; i >= 0; i-- {
+		author := "Unknown"
+		if nodes[i].User != nil {
+			author = nodes[i].User.Name
+		}
+		issue.Comments = append(issue.Comments, Comment{Author: author, Body: nodes[i].Body})
+	}
+	return issue, nil
+}
+
+// Comment posts a comment on an issue
+func (l *Linear) Comment(ctx context.Context, issue *Issue, body string) error {
+	const mutation = `mutation Comment($issueId: String!, $body: String!) {
+  commentCreate(input: {issueId: $issueId, body: $body}) { success }
+}`
+	var data struct {
+		CommentCreate struct {
+			Success bool `json:"success"`
+		} `json:"commentCreate"`
+	}
+	if err := l.do(ctx, mutation, map[string]interface{}{"issueId": issue.id, "body": body}, &data); err != nil {
+		return fmt.Errorf("failed to comment on %s: %w", issue.Key, err)
+	}
+	if !data.CommentCreate.Success {
+		return fmt.Errorf("failed to comment on %s", issue.Key)
+	}
+	return nil
+}
+
+// Resolve moves an issue to the configured workflow state of its team
+func (l *Linear) Resolve(ctx context.Context, issue *Issue) error {
+	if l.State == "" {
+		return nil
+	}
+
+	const query = `query States($id: String!) {
+  issue(id: $id) { team { states { nodes { id name } } } }
+}`
+	var states struct {
+		Issue struct {
+			Team struct {
+				States struct {
+					Nodes []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"nodes"`
+				} `json:"states"`
+			} `json:"team"`
+		} `json:"issue"`
+	}
+	if err := l.do(ctx, query, map[string]interface{}{"id": issue.id}, &states); err != nil {
+		return fmt.Errorf("failed to fetch workflow states of %s: %w", issue.Key, err)
+	}
+
+	for _, state := range states.Issue.Team.States.Nodes {
+		if !strings.EqualFold(state.Name, l.State) {
+			continue
+		}
+		const mutation = `mutation Resolve($id: String!, $stateId: String!) {
+  issueUpdate(id: $id, input: {stateId: $stateId}) { success }
+}`
+		var data struct {
+			IssueUpdate struct {
+				Success bool `json:"success"`
+			} `json:"issueUpdate"`
+		}
+		if err := l.do(ctx, mutation, map[string]interface{}{"id": issue.id, "stateId": state.ID}, &data); err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", issue.Key, state.Name, err)
+		}
+		if !data.IssueUpdate.Success {
+			return fmt.Errorf("failed to move %s to %s", issue.Key, state.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("the team of %s has no workflow state named %q", issue.Key, l.State)
+}
+
+// do sends a GraphQL request and decodes its data into out
+func (l *Linear) do(ctx context.Context, query string, variables map[string]interface{}, out any) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", l.Token)
+
+	resp, err := l.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// GraphQL errors, such as an unknown issue, can come with any status
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+	if len(response.Errors) > 0 {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("Linear API returned %s: %s", resp.Status, strings.Join(messages, "; "))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Linear API returned %s", resp.Status)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failed to parse Linear API response: %w", decodeErr)
+	}
+	if err := json.Unmarshal(response.Data, out); err != nil {
+		return fmt.Errorf("failed to parse Linear API response: %w", err)
+	}
+	return nil
+}
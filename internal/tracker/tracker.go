@@ -0,0 +1,122 @@
+// Package tracker reads issues from Jira and Linear to use as tasks, and reports the outcome back to them
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// timeout bounds each request to a tracker's API
+const timeout = 30 * time.Second
+
+// Issue is an issue from a tracker
+type Issue struct {
+	// Key identifies the issue, e.g. PROJ-123
+	Key string
+
+	// id is the tracker's internal ID, which some updates need instead of the key
+	id string
+
+	Title       string
+	Description string
+
+	// URL is the issue's page in the tracker
+	URL string
+
+	// Comments are the issue's discussion, oldest first
+	Comments []Comment
+}
+
+// Comment is a comment on an issue
+type Comment struct {
+	Author string
+	Body   string
+}
+
+// Tracker is an issue tracker a run's task can come from
+type Tracker interface {
+	// Name is the tracker's name, e.g. "Jira"
+	Name() string
+
+	// Issue fetches an issue and its comments
+	Issue(ctx context.Context, key string) (*Issue, error)
+
+	// Comment posts a plain-text comment on an issue
+	Comment(ctx context.Context, issue *Issue, body string) error
+
+	// Resolve moves an issue to the configured state once a run has solved it
+	// It does nothing if no state is configured
+	Resolve(ctx context.Context, issue *Issue) error
+}
+
+// keyPattern matches an issue key such as PROJ-123
+var keyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*-[0-9]+$`)
+
+// linearPathPattern matches the path of a Linear issue URL, e.g. /team/issue/ENG-123/title-slug
+var linearPathPattern = regexp.MustCompile(`^/[^/]+/issue/([A-Za-z][A-Za-z0-9_]*-[0-9]+)(?:/|$)`)
+
+// jiraPathPattern matches the path of a Jira issue URL, e.g. /browse/PROJ-123
+var jiraPathPattern = regexp.MustCompile(`/browse/([A-Za-z][A-Za-z0-9_]*-[0-9]+)/?$`)
+
+// Kinds of issue reference recognized by ParseRef
+const (
+	KindJira   = "jira"
+	KindLinear = "linear"
+
+	// KindKey is a bare key such as PROJ-123, which could belong to either tracker
+	KindKey = "key"
+)
+
+// ParseRef recognizes a Jira or Linear issue URL, or a bare issue key, returning its kind and key
+// It returns false for anything else, such as a GitHub issue
+func ParseRef(s string) (kind, key string, ok bool) {
+	s = strings.TrimSpace(s)
+	if keyPattern.MatchString(s) {
+		return KindKey, strings.ToUpper(s), true
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+	if u.Host == "linear.app" {
+		if m := linearPathPattern.FindStringSubmatch(u.Path); m != nil {
+			return KindLinear, strings.ToUpper(m[1]), true
+		}
+	}
+	if m := jiraPathPattern.FindStringSubmatch(u.Path); m != nil {
+		return KindJira, strings.ToUpper(m[1]), true
+	}
+	if selected := u.Query().Get("selectedIssue"); keyPattern.MatchString(selected) {
+		return KindJira, strings.ToUpper(selected), true
+	}
+	return "", "", false
+}
+
+// Prompt builds a task prompt from an issue and its discussion
+// The first line names the issue, so commit messages made from the prompt link back to it
+func Prompt(trackerName string, issue *Issue) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Fix %s: %s\n\n", issue.Key, strings.TrimSpace(issue.Title))
+	fmt.Fprintf(&sb, "Make the changes requested in %s issue %s", trackerName, issue.Key)
+	if issue.URL != "" {
+		fmt.Fprintf(&sb, " (%s)", issue.URL)
+	}
+	sb.WriteString(". Its description and discussion follow.\n")
+
+	if description := strings.TrimSpace(issue.Description); description != "" {
+		fmt.Fprintf(&sb, "\nDescription:\n\n%s\n", description)
+	}
+
+	if len(issue.Comments) > 0 {
+		sb.WriteString("\nComments, oldest first:\n")
+		for _, comment := range issue.Comments {
+			fmt.Fprintf(&sb, "\n%s:\n%s\n", comment.Author, strings.TrimSpace(comment.Body))
+		}
+	}
+	return sb.String()
+}
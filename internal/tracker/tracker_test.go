@@ -0,0 +1,165 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		input     string
+		kind, key string
+	}{
+		{"PROJ-123", KindKey, "PROJ-123"},
+		{"eng-7", KindKey, "ENG-7"},
+		{"https://example.atlassian.net/browse/PROJ-123", KindJira, "PROJ-123"},
+		{"https://jira.example.com/jira/browse/OPS-9/", KindJira, "OPS-9"},
+		{"https://example.atlassian.net/jira/software/projects/PROJ/boards/1?selectedIssue=PROJ-5", KindJira, "PROJ-5"},
+		{"https://linear.app/acme/issue/ENG-42/fix-the-crash", KindLinear, "ENG-42"},
+	}
+	for _, tc := range tests {
+		kind, key, ok := ParseRef(tc.input)
+		require.True(t, ok, tc.input)
+		assert.Equal(t, tc.kind, kind, tc.input)
+		assert.Equal(t, tc.key, key, tc.input)
+	}
+
+	for _, input := range []string{"", "org/repo#123", "https://github.com/org/repo/issues/123", "PROJ", "123-PROJ"} {
+		_, _, ok := ParseRef(input)
+		assert.False(t, ok, input)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	prompt := Prompt("Jira", &Issue{
+		Key:         "PROJ-1",
+		Title:       "Crash on empty input",
+		Description: "Steps to reproduce",
+		URL:         "https://example.atlassian.net/browse/PROJ-1",
+		Comments:    []Comment{{Author: "Bob", Body: "Also on whitespace"}},
+	})
+	assert.True(t, strings.HasPrefix(prompt, "Fix PROJ-1: Crash on empty input\n"))
+	assert.Contains(t, prompt, "Jira issue PROJ-1 (https://example.atlassian.net/browse/PROJ-1)")
+	assert.Contains(t, prompt, "Description:\n\nSteps to reproduce\n")
+	assert.Contains(t, prompt, "Bob:\nAlso on whitespace\n")
+}
+
+func TestJira(t *testing.T) {
+	var comment map[string]string
+	var transition map[string]map[string]string
+	var authorization string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rest/api/2/issue/PROJ-1", func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		assert.Equal(t, "summary,description,comment", r.URL.Query().Get("fields"))
+		fmt.Fprint(w, `{"id": "10001", "key": "PROJ-1", "fields": {"summary": "Crash on empty input", "description": "Steps to reproduce",
+			"comment": {"comments": [{"body": "Also on whitespace", "author": {"displayName": "Bob"}}]}}}`)
+	})
+	mux.HandleFunc("POST /rest/api/2/issue/PROJ-1/comment", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&comment)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": "1"}`)
+	})
+	mux.HandleFunc("GET /rest/api/2/issue/PROJ-1/transitions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"transitions": [{"id": "11", "name": "Start", "to": {"name": "In Progress"}}, {"id": "21", "name": "Send to review", "to": {"name": "In Review"}}]}`)
+	})
+	mux.HandleFunc("POST /rest/api/2/issue/PROJ-1/transitions", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&transition)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /rest/api/2/issue/PROJ-404", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errorMessages": ["Issue does not exist or you do not have permission to see it."]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewJira(server.URL, "", "pat", "in review")
+	ctx := context.Background()
+
+	issue, err := client.Issue(ctx, "PROJ-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer pat", authorization, "Without an email the token is a personal access token")
+	assert.Equal(t, "Crash on empty input", issue.Title)
+	assert.Equal(t, server.URL+"/browse/PROJ-1", issue.URL)
+	assert.Equal(t, []Comment{{Author: "Bob", Body: "Also on whitespace"}}, issue.Comments)
+
+	require.NoError(t, client.Comment(ctx, issue, "Solved"))
+	assert.Equal(t, "Solved", comment["body"])
+
+	// The transition is found by the status it leads to
+	require.NoError(t, client.Resolve(ctx, issue))
+	assert.Equal(t, "21", transition["transition"]["id"])
+
+	client.Transition = "Done"
+	assert.ErrorContains(t, client.Resolve(ctx, issue), `no transition named "Done"`)
+
+	_, err = client.Issue(ctx, "PROJ-404")
+	assert.ErrorContains(t, err, "Issue does not exist")
+
+	client.Email = "alice@example.com"
+	_, err = client.Issue(ctx, "PROJ-1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(authorization, "Basic "), "With an email the token is sent with basic auth")
+}
+
+func TestLinear(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "lin_api_key", r.Header.Get("Authorization"))
+		var request struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request.Variables)
+
+		switch {
+		case strings.HasPrefix(request.Query, "query Issue") && request.Variables["id"] == "ENG-404":
+			fmt.Fprint(w, `{"data": null, "errors": [{"message": "Entity not found"}]}`)
+		case strings.HasPrefix(request.Query, "query Issue"):
+			fmt.Fprint(w, `{"data": {"issue": {"id": "uuid-1", "identifier": "ENG-1", "title": "Crash on empty input", "description": "Steps",
+				"url": "https://linear.app/acme/issue/ENG-1/crash", "comments": {"nodes": [
+					{"body": "Second", "user": {"name": "Carol"}}, {"body": "First", "user": null}]}}}}`)
+		case strings.HasPrefix(request.Query, "mutation Comment"):
+			fmt.Fprint(w, `{"data": {"commentCreate": {"success": true}}}`)
+		case strings.HasPrefix(request.Query, "query States"):
+			fmt.Fprint(w, `{"data": {"issue": {"team": {"states": {"nodes": [{"id": "s1", "name": "Todo"}, {"id": "s2", "name": "In Review"}]}}}}}`)
+		case strings.HasPrefix(request.Query, "mutation Resolve"):
+			fmt.Fprint(w, `{"data": {"issueUpdate": {"success": true}}}`)
+		default:
+			t.Errorf("unexpected query: %s", request.Query)
+		}
+	}))
+	defer server.Close()
+
+	client := NewLinear("lin_api_key", "In Review")
+	client.URL = server.URL
+	ctx := context.Background()
+
+	issue, err := client.Issue(ctx, "ENG-1")
+	require.NoError(t, err)
+	assert.Equal(t, "ENG-1", issue.Key)
+	assert.Equal(t, "https://linear.app/acme/issue/ENG-1/crash", issue.URL)
+	assert.Equal(t, []Comment{{Author: "Unknown", Body: "First"}, {Author: "Carol", Body: "Second"}}, issue.Comments, "Comments are oldest first")
+
+	// Updates address the issue by its internal ID
+	require.NoError(t, client.Comment(ctx, issue, "Solved"))
+	assert.Equal(t, map[string]interface{}{"issueId": "uuid-1", "body": "Solved"}, requests[len(requests)-1])
+	require.NoError(t, client.Resolve(ctx, issue))
+	assert.Equal(t, map[string]interface{}{"id": "uuid-1", "stateId": "s2"}, requests[len(requests)-1])
+
+	client.State = "Shipped"
+	assert.ErrorContains(t, client.Resolve(ctx, issue), `no workflow state named "Shipped"`)
+
+	_, err = client.Issue(ctx, "ENG-404")
+	assert.ErrorContains(t, err, "Entity not found")
+}
@@ -0,0 +1,142 @@
+package orchestrator
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Option adjusts how an orchestrator runs tasks
+type Option func(*Orchestrator)
+
+// WithRepo works on the repository at path instead of the current directory
+func WithRepo(path string) Option {
+	return func(o *Orchestrator) { o.opts.Repo = path }
+}
+
+// WithRepoURL clones the repository at url into the working directory and works on the clone
+// A task naming its own repository is cloned instead
+func WithRepoURL(url string) Option {
+	return func(o *Orchestrator) { o.opts.RepoURL = url }
+}
+
+// WithClone sets the history depth (0 for full history) and partial clone filter ("" for a full clone) of clones,
+// which default to a depth of 1 and the "blob:none" filter
+func WithClone(depth int, filter string) Option {
+	return func(o *Orchestrator) {
+		o.opts.Clone.Depth = depth
+		o.opts.Clone.Filter = filter
+	}
+}
+
+// WithLimits overrides the configured limits of agents and runs
+func WithLimits(limits Limits) Option {
+	return func(o *Orchestrator) { o.opts.Limits = limits }
+}
+
+// WithSamples has each agent make n independent attempts, overriding the configured count
+func WithSamples(n int) Option {
+	return func(o *Orchestrator) { o.opts.Samples = n }
+}
+
+// WithPromptVariants has every agent run once with each of n phrasings of the task, the first of the configured
+// prompt variants or else of the built-in ones
+func WithPromptVariants(n int) Option {
+	return func(o *Orchestrator) { o.opts.PromptVariants = n }
+}
+
+// WithMutation scores patches by mutation testing as well, whatever the configuration says
+func WithMutation() Option {
+	return func(o *Orchestrator) { o.opts.Mutation = true }
+}
+
+// WithSpeculative evaluates each patch as its agent finishes, stopping the rest once one is good enough
+func WithSpeculative() Option {
+	return func(o *Orchestrator) { o.opts.Speculative = true }
+}
+
+// WithRefineRounds gives agents up to n follow-up rounds while the best patch fails tests
+func WithRefineRounds(n int) Option {
+	return func(o *Orchestrator) { o.opts.RefineRounds = n }
+}
+
+// WithStack stacks up to n patches into the result while the best one leaves tests failing, keeping each that applies
+// on top of the others and improves the tests
+func WithStack(n int) Option {
+	return func(o *Orchestrator) { o.opts.Stack = n }
+}
+
+// WithPromptTemplate renders agent prompts with the template in the file at path instead of the configured one
+func WithPromptTemplate(path string) Option {
+	return func(o *Orchestrator) { o.opts.PromptTemplate = path }
+}
+
+// WithIncludeDirty starts agents from the repository's uncommitted changes instead of HEAD
+func WithIncludeDirty() Option {
+	return func(o *Orchestrator) { o.opts.IncludeDirty = true }
+}
+
+// WithAccept keeps only the listed files or file#hunk specs of the winning patch, re-validated with tests
+func WithAccept(specs ...string) Option {
+	return func(o *Orchestrator) { o.opts.Accept = specs }
+}
+
+// WithCommit commits the winning patch onto branch ("" for the configured branch_pattern)
+func WithCommit(branch string) Option {
+	return func(o *Orchestrator) {
+		o.opts.Commit = true
+		o.opts.Branch = branch
+	}
+}
+
+// WithApply applies the winning patch to the repository
+func WithApply() Option {
+	return func(o *Orchestrator) { o.opts.Apply = true }
+}
+
+// WithKeepWorktrees keeps every agent's worktree after the run for inspection
+func WithKeepWorktrees() Option {
+	return func(o *Orchestrator) { o.opts.KeepWorktrees = true }
+}
+
+// WithSmokeTest gives every agent a trivial task before each run, leaving out of the run the agents that fail it
+func WithSmokeTest() Option {
+	return func(o *Orchestrator) { o.opts.SmokeTest = true }
+}
+
+// WithTestAuthor has the agent write failing tests before each run's other agents start from them and make them
+// pass, instead of the configured test author
+func WithTestAuthor(agentID string) Option {
+	return func(o *Orchestrator) { o.opts.TestAuthor = agentID }
+}
+
+// WithPatchFiles judges existing patches, such as human-written fixes, alongside the agents' patches, each submitted
+// by an agent named patch-<file name>
+func WithPatchFiles(files ...string) Option {
+	return func(o *Orchestrator) { o.opts.PatchFiles = files }
+}
+
+// WithDeterministic runs agents one at a time in configuration order, with no speculative evaluation to stop them
+// early, so a run's logs, events, and artifacts come out in the same order every time
+func WithDeterministic() Option {
+	return func(o *Orchestrator) { o.opts.Deterministic = true }
+}
+
+// WithDryRun prints what runs would execute instead of starting agents or running tests
+func WithDryRun() Option {
+	return func(o *Orchestrator) { o.opts.DryRun = true }
+}
+
+// WithOutput writes the text the run command prints, such as the best patch and where it was exported, to w
+func WithOutput(w io.Writer) Option {
+	return func(o *Orchestrator) { o.opts.Output = w }
+}
+
+// WithLogger sends the runs' log messages to logger instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Orchestrator) { o.opts.Logger = logger }
+}
+
+// WithProgress tells progress what the agents are doing
+func WithProgress(progress Progress) Option {
+	return func(o *Orchestrator) { o.opts.Progress = progress }
+}
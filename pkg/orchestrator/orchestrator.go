@@ -0,0 +1,160 @@
+// Package orchestrator embeds the orchestrator in Go programs
+// It runs a task the way the run command does: agents work on it in their own worktrees, the arbitrator tests
+// and scores their patches, and the best one is exported and optionally committed or applied
+//
+//	cfg, err := orchestrator.LoadConfig("config.yaml")
+//	if err != nil {
+//		return err
+//	}
+//	result, err := orchestrator.New(cfg, orchestrator.WithRepo("path/to/repo")).Run(ctx, orchestrator.Task{Prompt: "Fix the failing test"})
+package orchestrator
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"github.com/brettsmith212/orchestrator/internal/core"
+	"github.com/brettsmith212/orchestrator/internal/engine"
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+)
+
+// Config configures the agents, tests, and scoring of runs, as the configuration file does
+type Config = core.Config
+
+// AgentConfig configures one agent of a Config
+type AgentConfig = core.AgentConfig
+
+// Task is the work a run does: a prompt, and optionally the repository and base ref to do it on
+type Task = core.Task
+
+// RunResult is the outcome of a run: every agent's patch and the best one
+type RunResult = core.TaskResult
+
+// PatchResult is one agent's scored patch
+type PatchResult = core.PatchResult
+
+// Event is something an agent did or said during a run
+type Event = protocol.Event
+
+// Limits override the configured limits of agents and runs; a zero limit keeps the configured one
+type Limits = core.LimitsConfig
+
+// TokenCounter is an agent's token usage and spend
+type TokenCounter = core.TokenCounter
+
+// Progress is told what the agents are doing during a run
+// Implementations must be safe for concurrent use since every agent reports from its own goroutine
+type Progress = engine.Progress
+
+// Agent states passed to Progress.SetStatus
+const (
+	AgentPending  = engine.AgentPending
+	AgentStarting = engine.AgentStarting
+	AgentRunning  = engine.AgentRunning
+	AgentDone     = engine.AgentDone
+	AgentFailed   = engine.AgentFailed
+	AgentStopped  = engine.AgentStopped
+)
+
+// LoadConfig loads a configuration file, in the format its extension names
+func LoadConfig(path string) (*Config, error) {
+	return core.Load(path)
+}
+
+// Orchestrator runs tasks with a configuration and options
+// It is safe for concurrent use; runs share the working directory, so worktrees left by runs that crashed are
+// reclaimed once before the first run, rather than by each run, which would reclaim the others' worktrees
+type Orchestrator struct {
+	cfg  *Config
+	opts engine.Options
+
+	recovered sync.Once
+
+	mu          sync.Mutex
+	subscribers map[int]func(*Event)
+	next        int
+}
+
+// New returns an orchestrator that runs tasks with cfg, adjusted by options
+// Without options it works on the current directory, prints nothing, and logs to the default logger
+func New(cfg *Config, options ...Option) *Orchestrator {
+	o := &Orchestrator{
+		cfg: cfg,
+		opts: engine.Options{
+			Clone: gitutil.CloneOptions{Depth: 1, Filter: "blob:none"},
+		},
+		subscribers: make(map[int]func(*Event)),
+	}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// Run has the agents work on task and returns every patch and the best one
+// Cancelling ctx stops the agents; the result is nil only when the run failed before any patch was scored
+func (o *Orchestrator) Run(ctx context.Context, task Task) (*RunResult, error) {
+	if o.cfg == nil {
+		return nil, errors.New("orchestrator has no configuration")
+	}
+
+	o.recovered.Do(o.recoverOrphans)
+	opts := o.opts
+	opts.OnEvent = o.publish
+	opts.SharedWorkingDir = true
+	return engine.Run(ctx, o.cfg, task, core.NewRunID(), opts)
+}
+
+// recoverOrphans reclaims the worktrees that runs which crashed left behind, as the batch and serve commands do
+// before their first run; clones are created by runs, and have nothing to reclaim until then
+func (o *Orchestrator) recoverOrphans() {
+	if o.opts.RepoURL != "" {
+		return
+	}
+	repo, err := filepath.Abs(cmp.Or(o.opts.Repo, "."))
+	if err != nil {
+		return
+	}
+	worktreeManager, err := gitutil.NewWorktreeManagerWithBackend(repo, o.cfg.WorkingDir, gitutil.Backend(o.cfg.WorktreeBackend))
+	if err != nil {
+		return
+	}
+	engine.RecoverOrphans(cmp.Or(o.opts.Logger, slog.Default()), worktreeManager)
+}
+
+// Subscribe calls handler with every event an agent emits during this orchestrator's runs, until unsubscribe is called
+// handler is called from the agent's goroutine as the event arrives, so it must be safe for concurrent use and
+// should return quickly
+func (o *Orchestrator) Subscribe(handler func(event *Event)) (unsubscribe func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	id := o.next
+	o.next++
+	o.subscribers[id] = handler
+
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.subscribers, id)
+	}
+}
+
+// publish passes an event to every subscriber
+func (o *Orchestrator) publish(event *Event) {
+	o.mu.Lock()
+	handlers := make([]func(*Event), 0, len(o.subscribers))
+	for _, handler := range o.subscribers {
+		handlers = append(handlers, handler)
+	}
+	o.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,166 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/orchestrator/internal/gitutil"
+	"github.com/brettsmith212/orchestrator/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAppliesOptions(t *testing.T) {
+	o := New(&Config{})
+	assert.Equal(t, gitutil.CloneOptions{Depth: 1, Filter: "blob:none"}, o.opts.Clone)
+
+	o = New(&Config{},
+		WithRepo("repo"),
+		WithClone(0, ""),
+		WithSamples(3),
+		WithLimits(Limits{MaxTokens: 1000}),
+		WithAccept("main.go", "util.go#2"),
+		WithCommit("fix"),
+		WithKeepWorktrees(),
+	)
+	assert.Equal(t, "repo", o.opts.Repo)
+	assert.Equal(t, gitutil.CloneOptions{}, o.opts.Clone)
+	assert.Equal(t, 3, o.opts.Samples)
+	assert.Equal(t, 1000, o.opts.Limits.MaxTokens)
+	assert.Equal(t, []string{"main.go", "util.go#2"}, o.opts.Accept)
+	assert.True(t, o.opts.Commit)
+	assert.Equal(t, "fix", o.opts.Branch)
+	assert.True(t, o.opts.KeepWorktrees)
+	assert.False(t, o.opts.Apply)
+}
+
+func TestSubscribe(t *testing.T) {
+	o := New(&Config{})
+	var first, second []string
+	unsubscribe := o.Subscribe(func(event *Event) { first = append(first, event.AgentID) })
+	o.Subscribe(func(event *Event) { second = append(second, event.AgentID) })
+
+	o.publish(protocol.NewEvent(protocol.EventTypeThinking, "claude", 1))
+	unsubscribe()
+	unsubscribe()
+	o.publish(protocol.NewEvent(protocol.EventTypeComplete, "claude", 2))
+
+	assert.Equal(t, []string{"claude"}, first)
+	assert.Equal(t, []string{"claude", "claude"}, second)
+}
+
+func TestRunWithoutConfig(t *testing.T) {
+	_, err := New(nil).Run(context.Background(), Task{Prompt: "Fix the bug"})
+	assert.Error(t, err)
+}
+
+// newTestRepo creates a repository with an empty initial commit
+func newTestRepo(t *testing.T) string {
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	return repo
+}
+
+// fixerConfig configures an agent that adds fixed.txt, after sleeping for the given seconds, and tests that pass once
+// it exists
+func fixerConfig(t *testing.T, sleep int) *Config {
+	dir := t.TempDir()
+	return &Config{
+		WorkingDir:     filepath.Join(dir, "worktrees"),
+		ArtifactsDir:   filepath.Join(dir, "runs"),
+		TestCommand:    "test -f fixed.txt",
+		TimeoutSeconds: 30,
+		Agents: []AgentConfig{{
+			ID:   "fixer",
+			Type: "cli",
+			Config: map[string]interface{}{
+				"command":       "sh",
+				"args":          []interface{}{"-c", fmt.Sprintf(`sleep %d; echo '{"type":"action","payload":{"action_type":"edit","file_path":"fixed.txt"}}'; echo fixed > fixed.txt; echo '{"type":"complete"}'`, sleep)},
+				"worktree_flag": "",
+			},
+		}},
+	}
+}
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs git and an agent")
+	}
+
+	repo := newTestRepo(t)
+	o := New(fixerConfig(t, 0), WithRepo(repo))
+	var mu sync.Mutex
+	var events []protocol.EventType
+	o.Subscribe(func(event *Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event.Type)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := o.Run(ctx, Task{Prompt: "Add fixed.txt"})
+	require.NoError(t, err)
+	require.NotNil(t, result.Best)
+	assert.Equal(t, "fixer", result.Best.AgentID)
+	assert.True(t, result.Solved())
+	assert.Contains(t, result.Best.Diff, "fixed.txt")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, events, protocol.EventTypeAction)
+
+	_, err = os.Stat(filepath.Join(repo, "fixed.txt"))
+	assert.True(t, os.IsNotExist(err), "the patch is only applied when asked")
+}
+
+func TestRunConcurrently(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs git and agents")
+	}
+
+	// The second run starts while the first one's agent is working, so it must not reclaim the first one's worktree
+	cfg := fixerConfig(t, 2)
+	o := New(cfg, WithRepo(newTestRepo(t)))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	results := make([]*RunResult, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range results {
+		if i > 0 {
+			require.Eventually(t, func() bool {
+				worktrees, _ := filepath.Glob(filepath.Join(cfg.WorkingDir, "worktree-*"))
+				return len(worktrees) > 0
+			}, 10*time.Second, 10*time.Millisecond)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = o.Run(ctx, Task{Prompt: fmt.Sprintf("Add fixed.txt (%d)", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		require.NoError(t, errs[i])
+		require.NotNil(t, result.Best)
+		assert.True(t, result.Solved(), "run %d", i)
+		assert.Contains(t, result.Best.Diff, "fixed.txt")
+	}
+}